@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AutoscalingSpec enables automatic replica changes acting on recommendations. Replicas are changed
+// one member at a time and only while the cluster is healthy, has a recent snapshot and is inside
+// the maintenance window.
+type AutoscalingSpec struct {
+	// MinReplicas is the number of members the cluster is never scaled below.
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas int32 `json:"minReplicas"`
+	// MaxReplicas is the number of members the cluster is never scaled above.
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+	// MaxBackupAge is the maximum age of the last snapshot for replicas to be changed. Defaults to 24h.
+	// +optional
+	MaxBackupAge metav1.Duration `json:"maxBackupAge,omitempty"`
+	// ScaleDownDelay is the minimum time after the last replica change before members are removed. Defaults to 1h.
+	// +optional
+	ScaleDownDelay metav1.Duration `json:"scaleDownDelay,omitempty"`
+	// MaintenanceWindow is the daily time window replicas may be changed in. Replicas may be changed
+	// at any time if not set.
+	// +optional
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+}
+
+// MaintenanceWindow is a daily time window.
+type MaintenanceWindow struct {
+	// Start is the time of day the window starts at in UTC, in the HH:MM format.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+	// Duration is the length of the window.
+	Duration metav1.Duration `json:"duration"`
+}
+
+// Contains checks if the time is inside the window started today or yesterday, so windows may span midnight.
+// An invalid start never contains any time.
+func (w *MaintenanceWindow) Contains(t time.Time) bool {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return false
+	}
+	t = t.UTC()
+	today := time.Date(t.Year(), t.Month(), t.Day(), start.Hour(), start.Minute(), 0, 0, time.UTC)
+	for _, begin := range []time.Time{today, today.AddDate(0, 0, -1)} {
+		if !t.Before(begin) && t.Before(begin.Add(w.Duration.Duration)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AutoscalingStatus defines the observed state of automatic replica changes.
+type AutoscalingStatus struct {
+	// DesiredReplicas is the number of members advised by recommendations within the configured bounds.
+	DesiredReplicas int32 `json:"desiredReplicas"`
+	// LastScaleTime is the time replicas were last changed automatically.
+	// +optional
+	LastScaleTime *metav1.Time `json:"lastScaleTime,omitempty"`
+	// BlockedBy describes the safety condition which prevents replicas from being changed, if any.
+	// +optional
+	BlockedBy string `json:"blockedBy,omitempty"`
+}
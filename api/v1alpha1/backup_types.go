@@ -0,0 +1,492 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultSnapshotKeyTemplate is the layout of storage keys of periodic snapshots used unless KeyTemplate is set.
+const DefaultSnapshotKeyTemplate = "{namespace}/{cluster}/{timestamp}.db"
+
+// ClusterBackupSpec defines periodic snapshots of the cluster taken by the operator.
+type ClusterBackupSpec struct {
+	// Destination is the storage snapshots are uploaded to.
+	Destination BackupDestination `json:"destination"`
+	// AdditionalDestinations are storages every snapshot is uploaded to besides Destination, e.g. an offsite bucket,
+	// so an outage of a single storage doesn't leave the cluster without recent backups. Snapshots are taken once
+	// and streamed to all destinations at the same time, success is tracked for every destination independently.
+	// Snapshots are listed and restored from Destination.
+	// +optional
+	// +kubebuilder:validation:MaxItems=4
+	// +listType=atomic
+	AdditionalDestinations []BackupDestination `json:"additionalDestinations,omitempty"`
+	// Interval between two snapshots.
+	// +optional
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// AutoRestore enables restore of the cluster from the latest snapshot once the quorum is lost.
+	// It is intended for clusters running on emptyDir storage, which trade recovery point objective
+	// for not needing network block storage. Requires emptyDir storage.
+	// +optional
+	AutoRestore *AutoRestoreSpec `json:"autoRestore,omitempty"`
+	// VolumeSnapshots enables publishing of completed snapshots as VolumeSnapshot objects, so backup tooling
+	// working with the Kubernetes snapshot API can catalog them. Requires snapshot CRDs and snapshot controller
+	// to be installed in the cluster.
+	// +optional
+	VolumeSnapshots *VolumeSnapshotPublishing `json:"volumeSnapshots,omitempty"`
+	// Verify checks every snapshot by restoring it in a Job, so broken snapshots are noticed before they
+	// are needed. The result is reported in the SnapshotVerified condition. Jobs are configured with jobTemplate.
+	// +optional
+	Verify bool `json:"verify,omitempty"`
+	// VerificationSchedule periodically verifies the latest snapshot in Destination by restoring it in a Job,
+	// proving continuously that the cluster can be restored. Results of verifications are kept in the status.
+	// Jobs are configured with jobTemplate.
+	// +optional
+	VerificationSchedule *VerificationSchedule `json:"verificationSchedule,omitempty"`
+	// KeyTemplate is the layout of storage keys of periodic snapshots under the destination prefix, so snapshots
+	// of many clusters can share a bucket with the layout an organization requires. Placeholders {namespace},
+	// {cluster}, {timestamp} and {revision} are replaced with the namespace and name of the cluster, the UTC time
+	// of the snapshot and the revision of the cluster when it is taken. Keys have to contain {timestamp}, which
+	// snapshots are ordered by. Defaults to {namespace}/{cluster}/{timestamp}.db.
+	// +optional
+	KeyTemplate string `json:"keyTemplate,omitempty"`
+	// Tags are added to stored snapshots as object tags. Values may contain the placeholders of KeyTemplate.
+	// +optional
+	// +kubebuilder:validation:MaxProperties=10
+	Tags map[string]string `json:"tags,omitempty"`
+	// Retention defines which periodic snapshots are kept. Expired snapshots are deleted from all destinations
+	// together with EtcdBackup objects of the cluster they were taken by. Snapshots are kept forever if it is not set.
+	// +optional
+	Retention *BackupRetention `json:"retention,omitempty"`
+	// Compression is the algorithm snapshots are compressed with before they are uploaded. Snapshots are
+	// decompressed transparently on restore. Defaults to None.
+	// +optional
+	Compression BackupCompression `json:"compression,omitempty"`
+}
+
+// BackupCompression is the algorithm snapshots are compressed with.
+// +kubebuilder:validation:Enum=None;Gzip;Zstd
+type BackupCompression string
+
+const (
+	// BackupCompressionNone uploads snapshots as they are.
+	BackupCompressionNone BackupCompression = "None"
+	// BackupCompressionGzip compresses snapshots with gzip.
+	BackupCompressionGzip BackupCompression = "Gzip"
+	// BackupCompressionZstd compresses snapshots with Zstandard, which is faster and compresses better than gzip.
+	BackupCompressionZstd BackupCompression = "Zstd"
+)
+
+// BackupRetention defines which periodic snapshots are kept. A snapshot is kept if any of the keep rules selects it,
+// or if no keep rule is set, and it is not older than MaxAge. The latest snapshot is always kept.
+// Days and weeks are in UTC, weeks start on Monday.
+type BackupRetention struct {
+	// KeepLast is the number of the latest snapshots kept.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	KeepLast *int32 `json:"keepLast,omitempty"`
+	// KeepDaily is the number of the latest days the last snapshot of the day is kept for.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	KeepDaily *int32 `json:"keepDaily,omitempty"`
+	// KeepWeekly is the number of the latest weeks the last snapshot of the week is kept for.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	KeepWeekly *int32 `json:"keepWeekly,omitempty"`
+	// MaxAge is the age after which snapshots are deleted even if a keep rule selects them.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// AllDestinations returns all storages snapshots are uploaded to, Destination first.
+func (s *ClusterBackupSpec) AllDestinations() []*BackupDestination {
+	destinations := []*BackupDestination{&s.Destination}
+	for i := range s.AdditionalDestinations {
+		destinations = append(destinations, &s.AdditionalDestinations[i])
+	}
+	return destinations
+}
+
+// VerificationSchedule defines how often the latest snapshot is verified.
+type VerificationSchedule struct {
+	// Interval between two verifications. Defaults to 24h.
+	// +optional
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// HistoryLimit is the number of verification results kept in the status. Defaults to 10.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+}
+
+// VolumeSnapshotPublishing defines how snapshots are published as VolumeSnapshot objects.
+type VolumeSnapshotPublishing struct {
+	// ClassName is the name of the VolumeSnapshotClass of published snapshots.
+	// The class has to use the backup.etcd.aenix.io driver.
+	// +optional
+	ClassName string `json:"className,omitempty"`
+}
+
+// AutoRestoreSpec defines when the cluster is restored from the latest snapshot.
+type AutoRestoreSpec struct {
+	// QuorumLossTimeout is how long the quorum has to be lost before the cluster is restored.
+	// +optional
+	QuorumLossTimeout metav1.Duration `json:"quorumLossTimeout,omitempty"`
+}
+
+// BackupDestination defines the storage backups are kept in. Exactly one storage has to be specified.
+type BackupDestination struct {
+	// S3 defines an S3 bucket to store backups in.
+	// +optional
+	S3 *S3Destination `json:"s3,omitempty"`
+	// GCS defines a Google Cloud Storage bucket to store backups in.
+	// +optional
+	GCS *GCSDestination `json:"gcs,omitempty"`
+	// AzureBlob defines an Azure Blob Storage container to store backups in.
+	// +optional
+	AzureBlob *AzureBlobDestination `json:"azureBlob,omitempty"`
+	// Restic defines a restic repository to store backups in, e.g. served by rest-server.
+	// +optional
+	Restic *ResticDestination `json:"restic,omitempty"`
+	// Provider defines storage of a backup storage provider compiled into the operator, for backends
+	// the operator doesn't support natively.
+	// +optional
+	Provider *ProviderDestination `json:"provider,omitempty"`
+	// Encryption defines encryption of snapshots before they are uploaded to the storage.
+	// +optional
+	Encryption *BackupEncryption `json:"encryption,omitempty"`
+	// Proxy is the proxy the storage is reached through, for environments where object storage can only
+	// be reached via a proxy. Unset fields fall back to the proxy environment variables of the operator.
+	// +optional
+	Proxy *ProxySpec `json:"proxy,omitempty"`
+}
+
+// ProxySpec defines an HTTP proxy, with the semantics of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables.
+type ProxySpec struct {
+	// HTTPProxy is the proxy used for HTTP requests.
+	// +optional
+	HTTPProxy string `json:"httpProxy,omitempty"`
+	// HTTPSProxy is the proxy used for HTTPS requests.
+	// +optional
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	// NoProxy is a comma-separated list of hosts, domains and networks reached directly.
+	// +optional
+	NoProxy string `json:"noProxy,omitempty"`
+}
+
+// BackupEncryption defines client-side encryption of snapshots. Snapshots contain all data of the cluster,
+// including secrets, so they are encrypted with AES-256-GCM before they leave the pod taking them.
+type BackupEncryption struct {
+	// KeyRef references the 256-bit key snapshots are encrypted with in a key of a secret, as 32 raw bytes
+	// or base64 encoded. Snapshots can't be restored without the key.
+	KeyRef corev1.SecretKeySelector `json:"keyRef"`
+}
+
+// ProviderDestination defines storage of a backup storage provider registered in the operator binary.
+type ProviderDestination struct {
+	// Name is the name the provider is registered with.
+	Name string `json:"name"`
+	// Config is the provider specific configuration of the storage, e.g. its endpoint and container.
+	// +optional
+	Config map[string]string `json:"config,omitempty"`
+	// CredentialsSecret is the name of the secret with credentials of the storage. Keys read from it are
+	// defined by the provider.
+	// +optional
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// ResticDestination defines a restic repository backups are stored in. Every snapshot is kept as a restic snapshot
+// of a single file, its key being the path of the file.
+type ResticDestination struct {
+	// Repository is the restic repository, e.g. rest:https://backup.example.com/etcd for a repository served
+	// by rest-server. The repository has to be initialized.
+	Repository string `json:"repository"`
+	// CredentialsSecret is the name of the secret with the repository password in the password field and,
+	// for rest-server repositories requiring authentication, the user name and password in restUsername and
+	// restPassword fields.
+	CredentialsSecret string `json:"credentialsSecret"`
+}
+
+// GCSDestination defines a Google Cloud Storage bucket backups are stored in.
+type GCSDestination struct {
+	// Bucket is the name of the bucket.
+	Bucket string `json:"bucket"`
+	// Prefix is prepended to the keys of stored objects.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// CredentialsSecret is the name of the secret with the JSON key of a service account in the
+	// serviceAccountKey field. Application default credentials are used if it is not set, e.g. of the
+	// Kubernetes service account bound to a Google service account with Workload Identity.
+	// +optional
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	// KMSKeyName is the resource name of the Cloud KMS key objects are encrypted with at rest,
+	// instead of the default key of the bucket.
+	// +optional
+	KMSKeyName string `json:"kmsKeyName,omitempty"`
+}
+
+// AzureBlobDestination defines an Azure Blob Storage container backups are stored in.
+type AzureBlobDestination struct {
+	// Account is the name of the storage account. It is read from the connection string if not set.
+	// +optional
+	Account string `json:"account,omitempty"`
+	// Container is the name of the blob container.
+	Container string `json:"container"`
+	// Prefix is prepended to the names of stored blobs.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// CredentialsSecret is the name of the secret with the connection string of the storage account in the
+	// connectionString field, with an account key or a shared access signature. A managed identity is used if
+	// it is not set: the federated identity of Azure Workload Identity if the pod is configured for it,
+	// or the managed identity of the node otherwise.
+	// +optional
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	// ClientID selects the user-assigned managed identity of the node by its client ID.
+	// +optional
+	ClientID string `json:"clientID,omitempty"`
+	// EndpointSuffix is the suffix of storage endpoints of the Azure cloud, e.g. core.chinacloudapi.cn.
+	// Defaults to core.windows.net.
+	// +optional
+	EndpointSuffix string `json:"endpointSuffix,omitempty"`
+}
+
+// S3Destination defines an S3 bucket backups are stored in.
+type S3Destination struct {
+	// Bucket is the name of the bucket.
+	Bucket string `json:"bucket"`
+	// Region of the bucket.
+	// +optional
+	Region string `json:"region,omitempty"`
+	// Prefix is prepended to the keys of stored objects.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// CredentialsSecret is the name of the secret with access credentials.
+	// It is expected to have accessKeyID and secretAccessKey fields in the secret, unless the credentials
+	// are referenced with AccessKeyIDRef and SecretAccessKeyRef.
+	// +optional
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	// AccessKeyIDRef references the access key id in an arbitrary key of a secret, e.g. a secret synced by
+	// External Secrets Operator. Overrides the accessKeyID field of CredentialsSecret.
+	// +optional
+	AccessKeyIDRef *corev1.SecretKeySelector `json:"accessKeyIDRef,omitempty"`
+	// SecretAccessKeyRef references the secret access key in an arbitrary key of a secret.
+	// Overrides the secretAccessKey field of CredentialsSecret.
+	// +optional
+	SecretAccessKeyRef *corev1.SecretKeySelector `json:"secretAccessKeyRef,omitempty"`
+	// SessionTokenRef references the session token of temporary credentials in an arbitrary key of a secret.
+	// +optional
+	SessionTokenRef *corev1.SecretKeySelector `json:"sessionTokenRef,omitempty"`
+	// KMSKeyID is the ID or ARN of the AWS KMS key objects are encrypted with at rest using SSE-KMS.
+	// +optional
+	KMSKeyID string `json:"kmsKeyID,omitempty"`
+	// Endpoint is the URL of an S3-compatible service, such as MinIO or Ceph RGW, e.g.
+	// https://minio.storage.svc:9000. HTTPS is used if the scheme is omitted. Defaults to AWS S3.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// ForcePathStyle addresses buckets in the path of requests instead of the host name,
+	// as required by most S3-compatible services.
+	// +optional
+	ForcePathStyle bool `json:"forcePathStyle,omitempty"`
+	// InsecureSkipVerify disables verification of the certificate of the endpoint, exposing backup credentials and
+	// snapshots to anyone intercepting connections to it. Use CABundleRef instead for endpoints with certificates
+	// issued by a private CA.
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// CABundleRef references PEM encoded certificates of CAs trusted in addition to the system ones
+	// in a key of a secret.
+	// +optional
+	CABundleRef *corev1.SecretKeySelector `json:"caBundleRef,omitempty"`
+}
+
+// ClusterBackupStatus defines the observed state of periodic snapshots.
+type ClusterBackupStatus struct {
+	// LastSnapshotTime is the time the last successful snapshot was taken.
+	// +optional
+	LastSnapshotTime *metav1.Time `json:"lastSnapshotTime,omitempty"`
+	// LastSnapshotKey is the storage key of the last successful snapshot.
+	// +optional
+	LastSnapshotKey string `json:"lastSnapshotKey,omitempty"`
+	// LastFailureTime is the time the last snapshot failed at.
+	// +optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+	// ConsecutiveFailures is the number of snapshots failed since the last successful one. Failed snapshots are
+	// retried with exponential backoff up to the backup interval.
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+	// LastVolumeSnapshot is the name of the VolumeSnapshot the last snapshot is published as.
+	// +optional
+	LastVolumeSnapshot string `json:"lastVolumeSnapshot,omitempty"`
+	// RestoringFrom is the storage key of the snapshot the cluster is being restored from.
+	// +optional
+	RestoringFrom string `json:"restoringFrom,omitempty"`
+	// BootstrappedFrom is the storage key of the snapshot the cluster was bootstrapped from
+	// with BootstrapFromAnnotation.
+	// +optional
+	BootstrappedFrom string `json:"bootstrappedFrom,omitempty"`
+	// BootstrapFailure is the reason the cluster could not be bootstrapped from the snapshot set with
+	// BootstrapFromAnnotation. Failed bootstraps are never retried.
+	// +optional
+	BootstrapFailure string `json:"bootstrapFailure,omitempty"`
+	// RestoreProgress is the progress of the last restore of the cluster from a snapshot.
+	// +optional
+	RestoreProgress *RestoreProgress `json:"restoreProgress,omitempty"`
+	// AvailableBackups are snapshots of the cluster found in the backup storage, the latest periodic snapshots first.
+	// Only the latest snapshots are listed, see LastCatalogTime for the time they were listed at.
+	// +optional
+	// +listType=atomic
+	AvailableBackups []AvailableBackup `json:"availableBackups,omitempty"`
+	// LastCatalogTime is the time snapshots available in the backup storage were last listed at.
+	// +optional
+	LastCatalogTime *metav1.Time `json:"lastCatalogTime,omitempty"`
+	// LastRetentionTime is the time expired snapshots were last deleted at.
+	// +optional
+	LastRetentionTime *metav1.Time `json:"lastRetentionTime,omitempty"`
+	// LastScheduledVerificationTime is the time the last scheduled verification of the latest snapshot started at.
+	// +optional
+	LastScheduledVerificationTime *metav1.Time `json:"lastScheduledVerificationTime,omitempty"`
+	// Verifications are results of the latest snapshot verifications, newest first.
+	// +optional
+	// +listType=atomic
+	Verifications []SnapshotVerification `json:"verifications,omitempty"`
+	// Destinations is the state of snapshots in every backup destination, Destination first, reported when
+	// additional destinations are configured.
+	// +optional
+	// +listType=atomic
+	Destinations []BackupDestinationStatus `json:"destinations,omitempty"`
+}
+
+// SnapshotVerification is the result of a snapshot verification.
+type SnapshotVerification struct {
+	// Snapshot is the storage key of the verified snapshot.
+	Snapshot string `json:"snapshot"`
+	// Job is the name of the Job the snapshot was verified by.
+	Job string `json:"job"`
+	// Scheduled is true if the verification was run by the verification schedule rather than after the snapshot
+	// was taken.
+	// +optional
+	Scheduled bool `json:"scheduled,omitempty"`
+	// CompletionTime is the time the verification finished at.
+	CompletionTime metav1.Time `json:"completionTime"`
+	// Succeeded is true if the snapshot was restored successfully.
+	Succeeded bool `json:"succeeded"`
+}
+
+// BackupDestinationStatus defines the observed state of snapshots uploaded to a backup destination.
+type BackupDestinationStatus struct {
+	// URL identifies the destination, e.g. s3://bucket/prefix.
+	URL string `json:"url"`
+	// LastSnapshotTime is the time the last snapshot uploaded to the destination was taken.
+	// +optional
+	LastSnapshotTime *metav1.Time `json:"lastSnapshotTime,omitempty"`
+	// LastSnapshotKey is the storage key of the last snapshot uploaded to the destination.
+	// +optional
+	LastSnapshotKey string `json:"lastSnapshotKey,omitempty"`
+	// LastFailureTime is the time of the last snapshot which couldn't be uploaded to the destination.
+	// +optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+	// LastFailure is the error of the last snapshot which couldn't be uploaded to the destination.
+	// +optional
+	LastFailure string `json:"lastFailure,omitempty"`
+}
+
+// AvailableBackup is a snapshot of the cluster available in the backup storage.
+type AvailableBackup struct {
+	// Key is the storage key of the snapshot. It can be used as the value of the restore-from annotation.
+	Key string `json:"key"`
+	// TakenAt is the time the periodic snapshot was taken at.
+	// +optional
+	TakenAt *metav1.Time `json:"takenAt,omitempty"`
+	// VeleroBackup is the name of the Velero backup the snapshot was taken before.
+	// +optional
+	VeleroBackup string `json:"veleroBackup,omitempty"`
+}
+
+// RestorePhase is the phase of a member restore.
+type RestorePhase string
+
+const (
+	// RestorePhasePending means the restore container of the member is not started yet.
+	RestorePhasePending RestorePhase = "Pending"
+	// RestorePhaseDownloading means the snapshot is being downloaded.
+	RestorePhaseDownloading RestorePhase = "Downloading"
+	// RestorePhaseRestoring means the data directory is being restored from the downloaded snapshot.
+	RestorePhaseRestoring RestorePhase = "Restoring"
+	// RestorePhaseCompleted means the data directory of the member is restored.
+	RestorePhaseCompleted RestorePhase = "Completed"
+	// RestorePhaseFailed means the restore container of the member failed.
+	RestorePhaseFailed RestorePhase = "Failed"
+)
+
+// RestoreProgress defines the observed progress of a restore of the cluster from a snapshot.
+type RestoreProgress struct {
+	// Snapshot is the storage key of the snapshot the cluster is restored from.
+	Snapshot string `json:"snapshot"`
+	// StartTime is the time the restore started at.
+	StartTime metav1.Time `json:"startTime"`
+	// Jobs is true if data volumes of members are restored by Jobs while members are stopped,
+	// rather than by restore containers of member pods.
+	// +optional
+	Jobs bool `json:"jobs,omitempty"`
+	// Members contains the progress of every member.
+	// +optional
+	Members []MemberRestoreProgress `json:"members,omitempty"`
+}
+
+// MemberRestoreProgress defines the observed progress of a member restore.
+type MemberRestoreProgress struct {
+	// Name is the name of the member.
+	Name string `json:"name"`
+	// Phase is the current phase of the member restore.
+	Phase RestorePhase `json:"phase"`
+	// BytesDownloaded is the number of downloaded bytes of the snapshot.
+	// +optional
+	BytesDownloaded int64 `json:"bytesDownloaded,omitempty"`
+	// TotalBytes is the size of the snapshot, if known.
+	// +optional
+	TotalBytes int64 `json:"totalBytes,omitempty"`
+	// LastProgressTime is the last time the phase or the number of downloaded bytes changed. A restore which
+	// makes no progress for long is likely hung rather than slow.
+	// +optional
+	LastProgressTime *metav1.Time `json:"lastProgressTime,omitempty"`
+}
+
+// VeleroSpec defines integration with Velero backups of the cluster namespace.
+type VeleroSpec struct {
+	// HookTimeout is how long Velero waits for backup and restore hooks of a member to complete.
+	// +optional
+	HookTimeout metav1.Duration `json:"hookTimeout,omitempty"`
+	// Quiesce makes the operator take a snapshot of the cluster to the backup destination as soon as a Velero
+	// backup of the namespace starts, and restore the cluster from it once the cluster is restored by Velero.
+	// All members are restored from the same snapshot, so restored data is consistent. Requires backups.
+	// +optional
+	Quiesce bool `json:"quiesce,omitempty"`
+}
+
+// VeleroStatus defines the observed state of Velero backups and restores of the cluster.
+type VeleroStatus struct {
+	// LastQuiescedBackup is the name of the last Velero backup a snapshot was taken for.
+	// +optional
+	LastQuiescedBackup string `json:"lastQuiescedBackup,omitempty"`
+	// LastQuiesceTime is the time the snapshot for the last Velero backup was taken.
+	// +optional
+	LastQuiesceTime *metav1.Time `json:"lastQuiesceTime,omitempty"`
+	// RestoredBackup is the name of the Velero backup the cluster data was last restored from.
+	// +optional
+	RestoredBackup string `json:"restoredBackup,omitempty"`
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EtcdBackupSpec defines the desired state of EtcdBackup
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+type EtcdBackupSpec struct {
+	// Cluster is the EtcdCluster in the same namespace a snapshot is taken of.
+	// The snapshot is uploaded to the backup destinations of the cluster.
+	Cluster corev1.LocalObjectReference `json:"cluster"`
+	// Compression overrides the compression of snapshots of the cluster for this backup.
+	// +optional
+	Compression BackupCompression `json:"compression,omitempty"`
+}
+
+// EtcdBackupPhase is the lifecycle phase of the backup.
+type EtcdBackupPhase string
+
+const (
+	// EtcdBackupPhasePending means the backup waits for the cluster to become ready.
+	EtcdBackupPhasePending EtcdBackupPhase = "Pending"
+	// EtcdBackupPhaseRunning means the snapshot is being taken.
+	EtcdBackupPhaseRunning EtcdBackupPhase = "Running"
+	// EtcdBackupPhaseSucceeded means the snapshot is uploaded to the backup destination.
+	EtcdBackupPhaseSucceeded EtcdBackupPhase = "Succeeded"
+	// EtcdBackupPhaseFailed means the snapshot could not be taken. Failed backups are never retried.
+	EtcdBackupPhaseFailed EtcdBackupPhase = "Failed"
+)
+
+// EtcdBackupStatus defines the observed state of EtcdBackup
+type EtcdBackupStatus struct {
+	// Phase is the lifecycle phase of the backup.
+	// +optional
+	Phase EtcdBackupPhase `json:"phase,omitempty"`
+	// Conditions represent the latest available observations of the backup.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// StartTime is the time the snapshot was started at.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time the backup succeeded or failed at.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// SnapshotKey is the key of the snapshot in the backup destination.
+	// +optional
+	SnapshotKey string `json:"snapshotKey,omitempty"`
+	// Compression is the algorithm the snapshot is compressed with.
+	// +optional
+	Compression BackupCompression `json:"compression,omitempty"`
+
+	// Revision is the revision of the cluster the snapshot is taken at.
+	// +optional
+	Revision int64 `json:"revision,omitempty"`
+	// RaftTerm is the raft term of the cluster the snapshot is taken at.
+	// +optional
+	RaftTerm int64 `json:"raftTerm,omitempty"`
+	// Size is the size of the snapshot before compression.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+	// SHA256 is the hex encoded SHA-256 checksum of the snapshot before compression, restores verify it.
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+	// EtcdVersion is the version of etcd the snapshot is taken with.
+	// +optional
+	EtcdVersion string `json:"etcdVersion,omitempty"`
+}
+
+const (
+	// EtcdBackupConditionCompleted is true when the backup succeeded and false when it failed.
+	EtcdBackupConditionCompleted = "Completed"
+
+	EtcdBackupReasonClusterNotReady  = "ClusterNotReady"
+	EtcdBackupReasonRunning          = "Running"
+	EtcdBackupReasonSucceeded        = "Succeeded"
+	EtcdBackupReasonFailed           = "Failed"
+	EtcdBackupReasonClusterNotFound  = "ClusterNotFound"
+	EtcdBackupReasonBackupNotEnabled = "BackupNotEnabled"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.cluster.name`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Snapshot",type=string,JSONPath=`.status.snapshotKey`,priority=1
+// +kubebuilder:printcolumn:name="Revision",type=integer,JSONPath=`.status.revision`,priority=1
+// +kubebuilder:printcolumn:name="Size",type=string,JSONPath=`.status.size`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EtcdBackup is the Schema for the etcdbackups API
+type EtcdBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdBackupSpec   `json:"spec,omitempty"`
+	Status EtcdBackupStatus `json:"status,omitempty"`
+}
+
+// Finished checks if the backup succeeded or failed.
+func (b *EtcdBackup) Finished() bool {
+	return b.Status.Phase == EtcdBackupPhaseSucceeded || b.Status.Phase == EtcdBackupPhaseFailed
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdBackupList contains a list of EtcdBackup
+type EtcdBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdBackup{}, &EtcdBackupList{})
+}
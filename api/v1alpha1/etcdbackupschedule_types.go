@@ -0,0 +1,152 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConcurrencyPolicy describes how a backup is created while the previous one of the schedule is still running.
+// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+type ConcurrencyPolicy string
+
+const (
+	// AllowConcurrent allows backups to run concurrently.
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+	// ForbidConcurrent skips the new backup if the previous one hasn't finished yet.
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+	// ReplaceConcurrent deletes the running backup and replaces it with the new one.
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+)
+
+const (
+	// DefaultSuccessfulBackupsHistoryLimit is the default number of succeeded backups kept by a schedule.
+	DefaultSuccessfulBackupsHistoryLimit int32 = 3
+	// DefaultFailedBackupsHistoryLimit is the default number of failed backups kept by a schedule.
+	DefaultFailedBackupsHistoryLimit int32 = 1
+)
+
+// BackupScheduleLabel is the label of backups created by a schedule with the name of the schedule.
+const BackupScheduleLabel = "etcd.aenix.io/backup-schedule"
+
+// EtcdBackupScheduleSpec defines the desired state of EtcdBackupSchedule
+type EtcdBackupScheduleSpec struct {
+	// Cluster is the EtcdCluster in the same namespace backups are taken of.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="cluster is immutable"
+	Cluster corev1.LocalObjectReference `json:"cluster"`
+	// Schedule is the cron expression backups are created on, in UTC.
+	// Five fields and macros like @daily are supported.
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+	// ConcurrencyPolicy describes how a backup is created while the previous one is still running.
+	// +optional
+	// +kubebuilder:default:=Allow
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+	// Suspend stops creating backups, backups already created are not affected.
+	// +optional
+	Suspend *bool `json:"suspend,omitempty"`
+	// StartingDeadlineSeconds is the deadline for creating a backup if its scheduled time is missed.
+	// Missed backups are skipped. A backup is created for the latest missed time regardless of its age if it is not set.
+	// +optional
+	// +kubebuilder:validation:Minimum:=0
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+	// SuccessfulBackupsHistoryLimit is the number of succeeded backups kept. Defaults to 3.
+	// +optional
+	// +kubebuilder:validation:Minimum:=0
+	SuccessfulBackupsHistoryLimit *int32 `json:"successfulBackupsHistoryLimit,omitempty"`
+	// FailedBackupsHistoryLimit is the number of failed backups kept. Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum:=0
+	FailedBackupsHistoryLimit *int32 `json:"failedBackupsHistoryLimit,omitempty"`
+}
+
+// EtcdBackupScheduleStatus defines the observed state of EtcdBackupSchedule
+type EtcdBackupScheduleStatus struct {
+	// Active is the list of names of backups of the schedule which haven't finished yet.
+	// +optional
+	Active []string `json:"active,omitempty"`
+	// LastScheduleTime is the last time a backup was scheduled at.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastSuccessfulTime is the last time a backup of the schedule succeeded at.
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// Conditions represent the latest available observations of the schedule.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// EtcdBackupScheduleConditionValid is true when the cron expression of the schedule is valid.
+	EtcdBackupScheduleConditionValid = "Valid"
+
+	EtcdBackupScheduleReasonValid           = "Valid"
+	EtcdBackupScheduleReasonInvalidSchedule = "InvalidSchedule"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.cluster.name`
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+// +kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+// +kubebuilder:printcolumn:name="Last Successful",type=date,JSONPath=`.status.lastSuccessfulTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EtcdBackupSchedule is the Schema for the etcdbackupschedules API
+type EtcdBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdBackupScheduleSpec   `json:"spec,omitempty"`
+	Status EtcdBackupScheduleStatus `json:"status,omitempty"`
+}
+
+// Suspended checks if creating backups is suspended.
+func (s *EtcdBackupSchedule) Suspended() bool {
+	return s.Spec.Suspend != nil && *s.Spec.Suspend
+}
+
+// SuccessfulHistoryLimit returns the number of succeeded backups kept.
+func (s *EtcdBackupSchedule) SuccessfulHistoryLimit() int {
+	if s.Spec.SuccessfulBackupsHistoryLimit == nil {
+		return int(DefaultSuccessfulBackupsHistoryLimit)
+	}
+	return int(*s.Spec.SuccessfulBackupsHistoryLimit)
+}
+
+// FailedHistoryLimit returns the number of failed backups kept.
+func (s *EtcdBackupSchedule) FailedHistoryLimit() int {
+	if s.Spec.FailedBackupsHistoryLimit == nil {
+		return int(DefaultFailedBackupsHistoryLimit)
+	}
+	return int(*s.Spec.FailedBackupsHistoryLimit)
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdBackupScheduleList contains a list of EtcdBackupSchedule
+type EtcdBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdBackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdBackupSchedule{}, &EtcdBackupScheduleList{})
+}
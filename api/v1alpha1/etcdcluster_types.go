@@ -17,9 +17,16 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/version"
 )
 
 const DefaultEtcdImage = "quay.io/coreos/etcd:v3.5.12"
@@ -35,8 +42,17 @@ type EtcdClusterSpec struct {
 	// +optional
 	// +kubebuilder:example:={enable-v2: "false", debug: "true"}
 	Options map[string]string `json:"options,omitempty"`
+	// Tuning sets commonly tuned etcd server parameters, which otherwise have to be passed in Options.
+	// +optional
+	Tuning *TuningSpec `json:"tuning,omitempty"`
+	// Logging configures etcd logs and shipping them by a sidecar.
+	// +optional
+	Logging *LoggingSpec `json:"logging,omitempty"`
 	// PodTemplate defines the desired state of PodSpec for etcd members. If not specified, default values will be used.
 	PodTemplate PodTemplate `json:"podTemplate,omitempty"`
+	// SecurityContext sets the user and groups members and Jobs accessing their data run as.
+	// +optional
+	SecurityContext *MemberSecurityContext `json:"securityContext,omitempty"`
 	// PodDisruptionBudgetTemplate describes PDB resource to create for etcd cluster members. Nil to disable.
 	// +optional
 	PodDisruptionBudgetTemplate *EmbeddedPodDisruptionBudget `json:"podDisruptionBudgetTemplate,omitempty"`
@@ -44,11 +60,685 @@ type EtcdClusterSpec struct {
 	// Security describes security settings of etcd (authentication, certificates, rbac)
 	// +optional
 	Security *SecuritySpec `json:"security,omitempty"`
+	// Backup configures periodic snapshots of the cluster and restore from them.
+	// +optional
+	Backup *ClusterBackupSpec `json:"backup,omitempty"`
+	// Velero configures backups of the cluster by Velero.
+	// +optional
+	Velero *VeleroSpec `json:"velero,omitempty"`
+	// Rotation enables periodic replacement of members, one at a time.
+	// +optional
+	Rotation *MemberRotationSpec `json:"rotation,omitempty"`
+	// Drain configures handling of drains of nodes members run on.
+	// +optional
+	Drain *DrainSpec `json:"drain,omitempty"`
+	// Startup configures how long members may take to start.
+	// +optional
+	Startup *StartupSpec `json:"startup,omitempty"`
+	// Endpoints configures how endpoints of cluster Services are managed.
+	// +optional
+	Endpoints *EndpointsSpec `json:"endpoints,omitempty"`
+	// FIPS enables FIPS mode: member pods run FIPS-compliant builds of etcd and agent images and TLS is restricted
+	// to FIPS-approved cipher suites. If not set, the operator-wide FIPS mode is used.
+	// +optional
+	FIPS *bool `json:"fips,omitempty"`
+	// JobTemplate configures Jobs the operator runs for the cluster, such as snapshot verification.
+	// +optional
+	JobTemplate *JobTemplate `json:"jobTemplate,omitempty"`
+	// Probes limits how often and how many members at once the operator probes with etcd API requests.
+	// Probes of all clusters are also limited by operator flags.
+	// +optional
+	Probes *ProbesSpec `json:"probes,omitempty"`
+	// EtcdAPI limits etcd API requests the operator sends to manage the cluster, so unresponsive members
+	// can't stall reconciliation.
+	// +optional
+	EtcdAPI *EtcdAPISpec `json:"etcdAPI,omitempty"`
+	// Autoscaling enables automatic replica changes between the configured bounds acting on recommendations.
+	// Replicas are managed by the operator then.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+	// ServiceMesh configures member pods for a service mesh injecting proxy sidecars into them.
+	// +optional
+	ServiceMesh *ServiceMeshSpec `json:"serviceMesh,omitempty"`
+	// Agent configures the agent sidecar running next to etcd in member pods.
+	// +optional
+	Agent *AgentSpec `json:"agent,omitempty"`
+	// Placement configures nodes member pods are scheduled to.
+	// +optional
+	Placement *PlacementSpec `json:"placement,omitempty"`
+	// Architectures restricts member pods and Jobs to nodes of the listed CPU architectures, which the etcd
+	// image has to be built for, e.g. to avoid pulls of images missing on some nodes of mixed-architecture
+	// clusters. Pods are scheduled to nodes of any architecture if not set.
+	// +optional
+	// +listType=set
+	Architectures []Architecture `json:"architectures,omitempty"`
+	// OpenShift enables running the cluster on OpenShift with the restricted security context constraints.
+	// +optional
+	OpenShift *OpenShiftSpec `json:"openShift,omitempty"`
+	// Integration configures objects published for hosted control planes consuming the cluster.
+	// +optional
+	Integration *IntegrationSpec `json:"integration,omitempty"`
+	// Ports overrides ports members listen on and advertise, e.g. to follow port policies or to avoid
+	// collisions of pods in the host network.
+	// +optional
+	Ports *PortsSpec `json:"ports,omitempty"`
+	// ClientURLs adds client URLs members listen on and advertise to the ones generated by the operator, e.g. to
+	// serve in-cluster clients and external clients through load balancers at the same time.
+	// +optional
+	ClientURLs *ClientURLsSpec `json:"clientURLs,omitempty"`
+	// ReadOnly makes the cluster reject writes of all users except root, e.g. to freeze the data during
+	// migrations or incidents. Requires authentication managed by the operator, see SecuritySpec.Auth: roles
+	// of users are replaced with a role permitted to read all keys and granted back once ReadOnly is unset.
+	// +optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// KeyUsage enables periodic reports of the number and size of keys per key prefix, helping to find
+	// applications which bloat the keyspace of a shared cluster.
+	// +optional
+	KeyUsage *KeyUsageSpec `json:"keyUsage,omitempty"`
+	// Notifications are sinks notified of lifecycle events of the cluster, in addition to sinks configured
+	// for all clusters by the operator.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Notifications []NotificationSink `json:"notifications,omitempty"`
+}
+
+// KeyUsageSpec defines periodic reports of key usage per key prefix. Keys are read in pages of a bounded size
+// from a single revision, values are read too to sum up their sizes.
+type KeyUsageSpec struct {
+	// Interval is the time between reports. Defaults to 1h.
+	// +optional
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// Separator separates segments of keys. Defaults to "/".
+	// +optional
+	// +kubebuilder:default:="/"
+	// +kubebuilder:validation:MinLength=1
+	Separator string `json:"separator,omitempty"`
+	// Depth is the number of leading key segments keys are grouped by, e.g. keys /registry/pods/default/app
+	// are reported under /registry/ with depth 1 and under /registry/pods/ with depth 2. Defaults to 1.
+	// +optional
+	// +kubebuilder:default:=1
+	// +kubebuilder:validation:Minimum=1
+	Depth int32 `json:"depth,omitempty"`
+	// MaxKeys is the maximum number of keys read for a report. Reports of larger keyspaces are approximate:
+	// keys after the first MaxKeys ones in the key order are not counted. Defaults to 100000.
+	// +optional
+	// +kubebuilder:default:=100000
+	// +kubebuilder:validation:Minimum=1
+	MaxKeys int64 `json:"maxKeys,omitempty"`
+	// TopPrefixes is the number of the largest prefixes included in the report. Defaults to 20.
+	// +optional
+	// +kubebuilder:default:=20
+	// +kubebuilder:validation:Minimum=1
+	TopPrefixes int32 `json:"topPrefixes,omitempty"`
+	// Quotas are limits of keys under prefixes checked with every report. The KeyQuotaExceeded condition
+	// is set while some of them are exceeded. Writes are rejected only for users listed in FreezeUsers of
+	// the exceeded quotas.
+	// +optional
+	// +listType=map
+	// +listMapKey=prefix
+	// +kubebuilder:validation:MaxItems=64
+	Quotas []KeyQuota `json:"quotas,omitempty"`
+}
+
+// KeyQuota defines limits of keys under a prefix, e.g. of a tenant of a shared cluster.
+type KeyQuota struct {
+	// Prefix is the key prefix the limits apply to. It does not have to match the prefixes reports group keys by.
+	// +kubebuilder:validation:MinLength=1
+	Prefix string `json:"prefix"`
+	// MaxKeys is the maximum number of keys under the prefix.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxKeys *int64 `json:"maxKeys,omitempty"`
+	// MaxBytes is the maximum total size of keys under the prefix and their values.
+	// +optional
+	MaxBytes *resource.Quantity `json:"maxBytes,omitempty"`
+	// FreezeUsers are etcd users writing under the prefix. While the quota is exceeded, their roles permitting
+	// writes of any key under the prefix are replaced with the read-only role of the read-only mode of the cluster
+	// and granted back once keys under the prefix are within the quota. Other roles of the users are kept.
+	// Requires spec.security.auth.
+	// +optional
+	// +listType=set
+	FreezeUsers []string `json:"freezeUsers,omitempty"`
 }
 
+// ClientURLsSpec defines additional client URLs of members. URLs may reference $(POD_NAME) and $(POD_NAMESPACE),
+// so every member gets its own URLs, e.g. https://$(POD_NAME).etcd.example.com:2379.
+type ClientURLsSpec struct {
+	// Advertise are client URLs members advertise in addition to their pod DNS names, e.g. addresses
+	// of external load balancers. Their hosts have to be covered by the server certificate, see TLSSpec.ExtraSANs.
+	// +optional
+	Advertise []string `json:"advertise,omitempty"`
+	// Listen are URLs members accept client connections on in addition to the client port on all addresses.
+	// +optional
+	Listen []string `json:"listen,omitempty"`
+}
+
+const (
+	// DefaultClientPort is the default port members serve clients on.
+	DefaultClientPort int32 = 2379
+	// DefaultPeerPort is the default port members communicate with peers on.
+	DefaultPeerPort int32 = 2380
+	// DefaultMetricsPort is the default port members serve metrics and health endpoints on.
+	DefaultMetricsPort int32 = 2381
+)
+
+// PortsSpec defines ports members listen on and advertise. Unset ports have their default values. Ports can't be
+// changed once the cluster is created: members advertise them to each other and to clients.
+type PortsSpec struct {
+	// Client is the port members serve clients on, 2379 by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Client int32 `json:"client,omitempty"`
+	// Peer is the port members communicate with peers on, 2380 by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Peer int32 `json:"peer,omitempty"`
+	// Metrics is the port members serve metrics and health endpoints on, 2381 by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Metrics int32 `json:"metrics,omitempty"`
+}
+
+// PlacementSpec configures nodes member pods are scheduled to. Node selectors and tolerations set in
+// the pod template take precedence over the ones added here.
+type PlacementSpec struct {
+	// ControlPlane schedules member pods to control plane nodes: pods select nodes with the
+	// node-role.kubernetes.io/control-plane label and tolerate the taints of control plane nodes.
+	// +optional
+	ControlPlane bool `json:"controlPlane,omitempty"`
+}
+
+// Architecture is a CPU architecture of nodes, as in the kubernetes.io/arch node label.
+// +kubebuilder:validation:Enum=amd64;arm64;ppc64le
+type Architecture string
+
 const (
-	EtcdConditionInitialized = "Initialized"
-	EtcdConditionReady       = "Ready"
+	ArchitectureAMD64   Architecture = "amd64"
+	ArchitectureARM64   Architecture = "arm64"
+	ArchitecturePPC64LE Architecture = "ppc64le"
+)
+
+// OpenShiftSpec configures the cluster for OpenShift. Member pods and Jobs get security contexts admitted by
+// the restricted-v2 security context constraints, so they run with a UID assigned to the namespace and don't
+// need the anyuid constraints.
+type OpenShiftSpec struct {
+	// Route exposes the client service outside of the cluster with an OpenShift Route. Clients are passed
+	// through to members, so members have to serve clients over TLS.
+	// +optional
+	Route *RouteSpec `json:"route,omitempty"`
+	// ServiceCA issues the server certificate of members with the OpenShift service CA into the server secret.
+	// The operator trusts the service CA bundle injected into the <name>-service-ca ConfigMap, which clients
+	// in the cluster can mount as well.
+	// +optional
+	ServiceCA bool `json:"serviceCA,omitempty"`
+}
+
+// RouteSpec defines the OpenShift Route of the client service.
+type RouteSpec struct {
+	// Host is the host name of the Route. It is generated by the router if not set.
+	// +optional
+	Host string `json:"host,omitempty"`
+}
+
+// AgentSpec configures the agent sidecar of member pods. The sidecar runs the operator image.
+type AgentSpec struct {
+	// VolumeMetrics enables the sidecar serving capacity and available space of member volumes
+	// in the Prometheus format on port 2383.
+	// +optional
+	VolumeMetrics bool `json:"volumeMetrics,omitempty"`
+	// NativeSidecar runs the sidecar as a native sidecar container, an init container with restartPolicy Always,
+	// which starts before etcd and stops after it, so the sidecar neither misses etcd shutdown nor blocks
+	// pod termination. Defaults to true if the Kubernetes API server is 1.29 or newer.
+	// +optional
+	NativeSidecar *bool `json:"nativeSidecar,omitempty"`
+}
+
+// ServiceMeshProvider is the service mesh member pods run in.
+// +kubebuilder:validation:Enum=Istio;Linkerd
+type ServiceMeshProvider string
+
+const (
+	ServiceMeshIstio   ServiceMeshProvider = "Istio"
+	ServiceMeshLinkerd ServiceMeshProvider = "Linkerd"
+)
+
+// ServiceMeshSpec configures member pods for a service mesh with pod annotations of the mesh provider.
+// Annotations set in the pod template take precedence.
+type ServiceMeshSpec struct {
+	// Provider is the service mesh. Defaults to Istio.
+	// +optional
+	Provider ServiceMeshProvider `json:"provider,omitempty"`
+	// ExcludePorts excludes etcd client, peer and metrics ports from interception by the proxy, so traffic
+	// already secured by etcd TLS is not proxied and the operator reaches members without mesh identity.
+	// Defaults to true.
+	// +optional
+	ExcludePorts *bool `json:"excludePorts,omitempty"`
+	// HoldUntilProxyStarts delays the start of etcd until the proxy is ready, so members can reach their peers
+	// as soon as they start.
+	// +optional
+	HoldUntilProxyStarts bool `json:"holdUntilProxyStarts,omitempty"`
+	// NativeSidecars makes the mesh inject its proxy as a native sidecar container, which starts before init
+	// containers and stops after etcd. Required for restore init containers to reach the backup storage through
+	// the mesh. Requires Kubernetes 1.29 or newer.
+	// +optional
+	NativeSidecars bool `json:"nativeSidecars,omitempty"`
+}
+
+// ProbesSpec limits etcd API probes of cluster members, such as health checks of members serving clients,
+// leader checks of role Services and peer metrics sampling of partition detection.
+type ProbesSpec struct {
+	// Interval is the minimum time between periodic probes of the cluster. Checks which would run more often,
+	// e.g. every 10 seconds while a member is unhealthy, are delayed to it.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Parallelism is the number of members probed at once. Defaults to 1, members are probed one by one.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Parallelism *int32 `json:"parallelism,omitempty"`
+}
+
+// EtcdAPISpec defines timeouts, retries and circuit breaking of etcd API requests the operator sends to members
+// to manage the cluster and to maintain it.
+type EtcdAPISpec struct {
+	// DialTimeout limits establishing connections to members. Defaults to 5s.
+	// +optional
+	DialTimeout *metav1.Duration `json:"dialTimeout,omitempty"`
+	// MemberTimeout limits a request sent to a single member, e.g. a status request, after which the next
+	// member is tried. Defaults to 2s.
+	// +optional
+	MemberTimeout *metav1.Duration `json:"memberTimeout,omitempty"`
+	// RequestTimeout limits every attempt of other requests to the cluster, e.g. member changes. Requests which
+	// take long by design, snapshots and defragmentation, have their own limits. Defaults to 30s.
+	// +optional
+	RequestTimeout *metav1.Duration `json:"requestTimeout,omitempty"`
+	// MaxRetries limits retries of a request failing while members are unavailable or the leader is being
+	// elected, zero disables retries. Defaults to 3 retries of requests to the leader and to the etcd client
+	// default of other requests.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+	// CircuitBreaker rejects requests to the cluster for a while after consecutive requests failed because
+	// members were unavailable, so reconciles of an unreachable cluster fail fast. Disabled if not set.
+	// +optional
+	CircuitBreaker *CircuitBreakerSpec `json:"circuitBreaker,omitempty"`
+}
+
+// CircuitBreakerSpec defines when etcd API requests to the cluster are rejected without being sent.
+type CircuitBreakerSpec struct {
+	// FailureThreshold is the number of consecutive failed requests opening the circuit. Defaults to 5.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+	// OpenDuration is how long requests are rejected once the circuit is open. After it, a single probe request
+	// is sent while others are still rejected: it closes the circuit if it succeeds and opens it again if it fails.
+	// Defaults to 30s.
+	// +optional
+	OpenDuration *metav1.Duration `json:"openDuration,omitempty"`
+}
+
+// JobTemplate defines how Jobs the operator runs for the cluster are created and how many of them are kept.
+type JobTemplate struct {
+	// TTLSecondsAfterFinished is how long a finished Job is kept before Kubernetes deletes it.
+	// If not set, finished Jobs are deleted by the operator once they exceed history limits.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	// BackoffLimit is the number of retries before a Job is considered failed. Defaults to 3.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// SuccessfulJobsHistoryLimit is the number of succeeded Jobs of each kind to keep. Defaults to 3.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	// FailedJobsHistoryLimit is the number of failed Jobs of each kind to keep. Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+	// NodeSelector constrains Job pods to nodes with matching labels.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations of Job pods.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity of Job pods.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// Resources of the Job container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// ImagePullSecrets are used to pull the agent image of Job pods, e.g. from a pull-through registry
+	// requiring authentication. Defaults to imagePullSecrets of the pod template.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+}
+
+// StartupSpec defines how long members may take to start before kubelet restarts them.
+type StartupSpec struct {
+	// Timeout is how long a member may take to load its data and become ready after start. If not set, it grows
+	// with the database size observed in status, so members of large clusters are not restarted while loading data.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// EndpointsMode defines how endpoints of the client Service are selected.
+// +kubebuilder:validation:Enum=Selector;Managed
+type EndpointsMode string
+
+const (
+	// EndpointsModeSelector lets Kubernetes select endpoints of the client Service by labels of member pods.
+	EndpointsModeSelector EndpointsMode = "Selector"
+	// EndpointsModeManaged makes the operator manage EndpointSlices of the client Service itself
+	// and additionally publish members by their role in the leader and followers Services.
+	EndpointsModeManaged EndpointsMode = "Managed"
+)
+
+// EndpointsSpec defines how clients reach members.
+type EndpointsSpec struct {
+	// Mode is how endpoints of the client Service are selected. In Managed mode Services have no selector,
+	// the operator publishes serving members in EndpointSlices of the client Service, the leader in the
+	// <name>-leader Service for writes and other serving members in the <name>-followers Service for reads.
+	// Defaults to Selector.
+	// +optional
+	Mode EndpointsMode `json:"mode,omitempty"`
+	// RoleServices creates the <name>-leader Service pointed at the leader and the <name>-followers Service
+	// pointed at other serving members in Selector mode. The operator labels member pods with their roles
+	// for the Services to select them. Role Services are always created in Managed mode.
+	// +optional
+	RoleServices bool `json:"roleServices,omitempty"`
+}
+
+// TuningSpec defines etcd server parameters. Unset parameters keep etcd defaults.
+type TuningSpec struct {
+	// MaxRequestBytes is the maximum size of a client request, which limits the size of stored values.
+	// It is passed to etcd as --max-request-bytes.
+	// +optional
+	MaxRequestBytes *resource.Quantity `json:"maxRequestBytes,omitempty"`
+	// GRPCKeepaliveMinTime is the minimum interval a client should wait before pinging the server.
+	// It is passed to etcd as --grpc-keepalive-min-time.
+	// +optional
+	GRPCKeepaliveMinTime *metav1.Duration `json:"grpcKeepaliveMinTime,omitempty"`
+	// GRPCKeepaliveInterval is the frequency of server-to-client pings to check if a connection is alive.
+	// It is passed to etcd as --grpc-keepalive-interval.
+	// +optional
+	GRPCKeepaliveInterval *metav1.Duration `json:"grpcKeepaliveInterval,omitempty"`
+	// GRPCKeepaliveTimeout is the time the server waits for a ping response before closing a connection.
+	// It is passed to etcd as --grpc-keepalive-timeout.
+	// +optional
+	GRPCKeepaliveTimeout *metav1.Duration `json:"grpcKeepaliveTimeout,omitempty"`
+	// WatchProgressNotifyInterval is the interval of progress notifications sent to watchers which requested them,
+	// so watchers of rarely changed keys learn the current revision. It is passed to etcd as
+	// --experimental-watch-progress-notify-interval before etcd 3.6 and as --watch-progress-notify-interval since.
+	// Requires etcd 3.4 or newer.
+	// +optional
+	WatchProgressNotifyInterval *metav1.Duration `json:"watchProgressNotifyInterval,omitempty"`
+}
+
+var (
+	// MinWatchProgressNotifyVersion is the first etcd version supporting configurable progress notifications.
+	MinWatchProgressNotifyVersion = version.MajorMinor(3, 4)
+	// stableWatchFlagsVersion is the first etcd version with watch flags no longer experimental.
+	stableWatchFlagsVersion = version.MajorMinor(3, 6)
+)
+
+// Options returns etcd options of the set parameters in the format of EtcdClusterSpec.Options. Flag names
+// depend on the etcd version, nil version is considered to be the default one.
+func (t *TuningSpec) Options(etcdVersion *version.Version) map[string]string {
+	options := map[string]string{}
+	if t.MaxRequestBytes != nil {
+		options["max-request-bytes"] = strconv.FormatInt(t.MaxRequestBytes.Value(), 10)
+	}
+	if t.GRPCKeepaliveMinTime != nil {
+		options["grpc-keepalive-min-time"] = t.GRPCKeepaliveMinTime.Duration.String()
+	}
+	if t.GRPCKeepaliveInterval != nil {
+		options["grpc-keepalive-interval"] = t.GRPCKeepaliveInterval.Duration.String()
+	}
+	if t.GRPCKeepaliveTimeout != nil {
+		options["grpc-keepalive-timeout"] = t.GRPCKeepaliveTimeout.Duration.String()
+	}
+	if t.WatchProgressNotifyInterval != nil {
+		name := "experimental-watch-progress-notify-interval"
+		if etcdVersion != nil && etcdVersion.AtLeast(stableWatchFlagsVersion) {
+			name = "watch-progress-notify-interval"
+		}
+		options[name] = t.WatchProgressNotifyInterval.Duration.String()
+	}
+	return options
+}
+
+// SizePreset defines etcd parameters and rollout pacing of large clusters. A leader of more followers sends more
+// heartbeats and replicates every entry to more peers, so heartbeats are less frequent and followers wait longer
+// before starting an election, and members compact their raft logs more often to bound the memory kept for lagging
+// followers. Parameters set in EtcdClusterSpec.Options take precedence.
+// +kubebuilder:object:generate=false
+type SizePreset struct {
+	// MinReplicas is the smallest number of members the preset applies to.
+	MinReplicas int32
+	// HeartbeatInterval is passed to etcd as --heartbeat-interval.
+	HeartbeatInterval time.Duration
+	// ElectionTimeout is passed to etcd as --election-timeout.
+	ElectionTimeout time.Duration
+	// SnapshotCount is passed to etcd as --snapshot-count.
+	SnapshotCount int64
+	// RolloutSoak is how long a restarted member has to stay ready before the next member is restarted.
+	RolloutSoak time.Duration
+}
+
+// SizePresets are the presets of clusters of five and seven members, from the largest.
+var SizePresets = []SizePreset{
+	{
+		MinReplicas:       7,
+		HeartbeatInterval: 200 * time.Millisecond,
+		ElectionTimeout:   2 * time.Second,
+		SnapshotCount:     50000,
+		RolloutSoak:       2 * time.Minute,
+	},
+	{
+		MinReplicas:       5,
+		HeartbeatInterval: 150 * time.Millisecond,
+		ElectionTimeout:   1500 * time.Millisecond,
+		SnapshotCount:     75000,
+		RolloutSoak:       time.Minute,
+	},
+}
+
+// Options returns etcd options of the preset in the format of EtcdClusterSpec.Options.
+func (p *SizePreset) Options() map[string]string {
+	return map[string]string{
+		"heartbeat-interval": strconv.FormatInt(p.HeartbeatInterval.Milliseconds(), 10),
+		"election-timeout":   strconv.FormatInt(p.ElectionTimeout.Milliseconds(), 10),
+		"snapshot-count":     strconv.FormatInt(p.SnapshotCount, 10),
+	}
+}
+
+// LogLevel is the level of etcd logs.
+// +kubebuilder:validation:Enum=debug;info;warn;error;panic;fatal
+type LogLevel string
+
+// LogFormat is the format of etcd logs.
+// +kubebuilder:validation:Enum=json;console
+type LogFormat string
+
+const (
+	LogFormatJSON    LogFormat = "json"
+	LogFormatConsole LogFormat = "console"
+)
+
+const (
+	// LogShippingPath is the directory of the volume etcd writes logs to while they are shipped by a sidecar.
+	LogShippingPath = "/var/log/etcd"
+	// LogShippingFile is the file etcd writes logs to while they are shipped by a sidecar.
+	LogShippingFile = LogShippingPath + "/etcd.log"
+	// DefaultLogMaxBackups is the default number of rotated log files kept while logs are shipped by a sidecar.
+	DefaultLogMaxBackups int32 = 3
+)
+
+var (
+	// MinLogFormatVersion is the first etcd version supporting configurable log format.
+	MinLogFormatVersion = version.MajorMinor(3, 6)
+	// DefaultLogMaxSize is the default size of the log file after which it is rotated while logs are shipped
+	// by a sidecar.
+	DefaultLogMaxSize = resource.MustParse("100Mi")
+)
+
+// LoggingSpec defines etcd logs. Unset fields keep etcd defaults.
+type LoggingSpec struct {
+	// Level is the minimum level of logged messages. It is passed to etcd as --log-level.
+	// +optional
+	Level LogLevel `json:"level,omitempty"`
+	// Format is the format of logged messages. It is passed to etcd as --log-format. Requires etcd 3.6 or newer,
+	// older versions always log JSON.
+	// +optional
+	Format LogFormat `json:"format,omitempty"`
+	// Outputs are stdout, stderr or paths of files logs are written to. They are passed to etcd as --log-outputs.
+	// Can't be set together with Shipping.
+	// +optional
+	// +kubebuilder:validation:MaxItems=4
+	Outputs []string `json:"outputs,omitempty"`
+	// Shipping writes logs to a file in a volume shared with a log forwarding sidecar instead of stderr, for
+	// platforms which don't collect logs of containers. Logs are not available with kubectl logs then.
+	// +optional
+	Shipping *LogShippingSpec `json:"shipping,omitempty"`
+}
+
+// LogShippingSpec defines the log forwarding sidecar of member pods and rotation of the log file it reads.
+type LogShippingSpec struct {
+	// Container is the log forwarding sidecar, e.g. Fluent Bit or Vector. The volume with logs is mounted to it
+	// read-only at /var/log/etcd, where etcd writes the etcd.log file. Configuration of the forwarder can be
+	// mounted from volumes added in the pod template.
+	Container corev1.Container `json:"container"`
+	// MaxSize is the size of the log file after which it is rotated. Defaults to 100Mi.
+	// +optional
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+	// MaxBackups is the number of rotated log files kept. Defaults to 3.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxBackups *int32 `json:"maxBackups,omitempty"`
+}
+
+// MaxSizeMB returns the size of the log file after which it is rotated in megabytes, the unit etcd accepts.
+func (s *LogShippingSpec) MaxSizeMB() int64 {
+	maxSize := DefaultLogMaxSize
+	if s.MaxSize != nil {
+		maxSize = *s.MaxSize
+	}
+	return max(maxSize.Value()>>20, 1)
+}
+
+// Backups returns the number of rotated log files kept.
+func (s *LogShippingSpec) Backups() int32 {
+	if s.MaxBackups == nil {
+		return DefaultLogMaxBackups
+	}
+	return *s.MaxBackups
+}
+
+// Options returns etcd options of the set fields in the format of EtcdClusterSpec.Options.
+func (l *LoggingSpec) Options() map[string]string {
+	options := map[string]string{}
+	if l.Level != "" {
+		options["log-level"] = string(l.Level)
+	}
+	if l.Format != "" {
+		options["log-format"] = string(l.Format)
+	}
+	if len(l.Outputs) > 0 {
+		options["log-outputs"] = strings.Join(l.Outputs, ",")
+	}
+	if l.Shipping != nil {
+		// rotation of etcd requires the file to be the only output
+		options["log-outputs"] = LogShippingFile
+		options["enable-log-rotation"] = "true"
+		options["log-rotation-config-json"] = fmt.Sprintf(`{"maxsize":%d,"maxbackups":%d}`,
+			l.Shipping.MaxSizeMB(), l.Shipping.Backups())
+	}
+	return options
+}
+
+// DrainSpec defines handling of drains of nodes members run on.
+type DrainSpec struct {
+	// QuorumLossTimeoutExtension is added to the quorum loss timeout of automatic restore while a node a member
+	// runs on is drained, so members being moved to other nodes are tolerated longer before the cluster is restored.
+	// +optional
+	QuorumLossTimeoutExtension metav1.Duration `json:"quorumLossTimeoutExtension,omitempty"`
+}
+
+// MemberRotationSpec defines periodic replacement of members. A member older than MaxAge is removed from the cluster
+// and rejoins it with a new pod and an empty data directory, which refreshes the nodes members run on and
+// the images they run and regularly exercises member replacement.
+type MemberRotationSpec struct {
+	// MaxAge is the age of the member pod after which the member is replaced.
+	MaxAge metav1.Duration `json:"maxAge"`
+	// MinInterval is the minimum time between replacements of two members.
+	// +optional
+	MinInterval metav1.Duration `json:"minInterval,omitempty"`
+}
+
+const (
+	EtcdConditionInitialized    = "Initialized"
+	EtcdConditionReady          = "Ready"
+	EtcdConditionMemberNodeLost = "MemberNodeLost"
+	EtcdConditionQuorumLost     = "QuorumLost"
+	// EtcdConditionMemberNodeDraining is true while nodes some members run on are cordoned or drained.
+	EtcdConditionMemberNodeDraining = "MemberNodeDraining"
+	// EtcdConditionNetworkPartitionSuspected is true while some peer links work in one direction only.
+	EtcdConditionNetworkPartitionSuspected = "NetworkPartitionSuspected"
+	// EtcdConditionSnapshotVerified reflects the result of the last finished snapshot verification Job.
+	EtcdConditionSnapshotVerified = "SnapshotVerified"
+	// EtcdConditionTrafficReady is true while the cluster is safe for client traffic: a quorum of members is healthy
+	// and the cluster is not being restored. It is published in the traffic gate ConfigMap too.
+	EtcdConditionTrafficReady = "TrafficReady"
+	// EtcdConditionVersionDrift is true while some members run an etcd version other than the one of the etcd image,
+	// e.g. after manual edits of pods or a failed rollout.
+	EtcdConditionVersionDrift = "VersionDrift"
+	// EtcdConditionPerformanceDegraded is true while metrics of some members show slow disks, leader changes
+	// or failed proposals. Rollouts and member rotations are paused while it is true.
+	EtcdConditionPerformanceDegraded = "PerformanceDegraded"
+	// EtcdConditionReadOnly is true while writes of users other than root are rejected.
+	EtcdConditionReadOnly = "ReadOnly"
+	// EtcdConditionKeyQuotaExceeded is true while keys under some prefixes exceed their quotas
+	// in the last key usage report.
+	EtcdConditionKeyQuotaExceeded = "KeyQuotaExceeded"
+	// EtcdConditionBackupFailing is true while the last attempt to take, verify, expire or list snapshots failed.
+	// Backup failures don't block management of members.
+	EtcdConditionBackupFailing = "BackupFailing"
+)
+
+// ReplaceMemberAnnotation requests replacement of the named member: the member is removed from the cluster
+// membership, its data volume is deleted and it rejoins the cluster with an empty data directory.
+// It is used to recover members pinned to a node that is gone together with its local data.
+const ReplaceMemberAnnotation = "etcd.aenix.io/replace-member"
+
+const (
+	// RestoreFromAnnotation requests restore of the cluster from the snapshot stored under the given key,
+	// or from the latest snapshot if it is set to RestoreFromLatest. Members are stopped and their data volumes
+	// are restored by Jobs, one per member, running in parallel. The annotation is removed once the restore is done.
+	RestoreFromAnnotation = "etcd.aenix.io/restore-from"
+	// RestoreFromLatest is the value of RestoreFromAnnotation requesting restore from the latest snapshot.
+	RestoreFromLatest = "latest"
+	// BootstrapFromAnnotation is the storage key of the snapshot members of a new cluster restore their data
+	// directories from before etcd starts. It is set by EtcdRestore on the cluster it creates and has no effect
+	// once the cluster is bootstrapped.
+	BootstrapFromAnnotation = "etcd.aenix.io/bootstrap-from"
+)
+
+// RefreshBackupsAnnotation requests listing snapshots available in the backup storage in the cluster status
+// without waiting for the next periodic listing. The annotation is removed once snapshots are listed.
+const RefreshBackupsAnnotation = "etcd.aenix.io/refresh-backups"
+
+const (
+	// CredentialsRotatedAtAnnotation is the time the password in a credentials Secret was generated at.
+	// Pod templates of credential consumers are annotated with it too, so they are restarted on password change.
+	CredentialsRotatedAtAnnotation = "etcd.aenix.io/credentials-rotated-at"
+	// CredentialsAppliedAnnotation is set to "true" on a credentials Secret once its password is set in etcd.
+	CredentialsAppliedAnnotation = "etcd.aenix.io/credentials-applied"
+	// RootUser is the name of the etcd root user.
+	RootUser = "root"
 )
 
 type EtcdCondType string
@@ -60,6 +750,29 @@ const (
 	EtcdCondTypeWaitingForFirstQuorum EtcdCondType = "WaitingForFirstQuorum"
 	EtcdCondTypeStatefulSetReady      EtcdCondType = "StatefulSetReady"
 	EtcdCondTypeStatefulSetNotReady   EtcdCondType = "StatefulSetNotReady"
+	EtcdCondTypePinnedNodeLost        EtcdCondType = "PinnedNodeLost"
+	EtcdCondTypePinnedNodesAvailable  EtcdCondType = "PinnedNodesAvailable"
+	EtcdCondTypeQuorumLost            EtcdCondType = "QuorumLost"
+	EtcdCondTypeQuorumAvailable       EtcdCondType = "QuorumAvailable"
+	EtcdCondTypeRestoringFromSnapshot EtcdCondType = "RestoringFromSnapshot"
+	EtcdCondTypeNodeDraining          EtcdCondType = "NodeDraining"
+	EtcdCondTypeNodesSchedulable      EtcdCondType = "NodesSchedulable"
+	EtcdCondTypeHalfOpenPeerLinks     EtcdCondType = "HalfOpenPeerLinks"
+	EtcdCondTypePeerLinksHealthy      EtcdCondType = "PeerLinksHealthy"
+	EtcdCondTypeSnapshotVerified      EtcdCondType = "SnapshotVerified"
+	EtcdCondTypeSnapshotVerifyFailed  EtcdCondType = "SnapshotVerificationFailed"
+	EtcdCondTypeVersionsMatch         EtcdCondType = "VersionsMatch"
+	EtcdCondTypeVersionMismatch       EtcdCondType = "VersionMismatch"
+	EtcdCondTypeRolloutInProgress     EtcdCondType = "RolloutInProgress"
+	EtcdCondTypeImageVersionUnknown   EtcdCondType = "ImageVersionUnknown"
+	EtcdCondTypePerformanceDegraded   EtcdCondType = "PerformanceDegraded"
+	EtcdCondTypePerformanceNormal     EtcdCondType = "PerformanceNormal"
+	EtcdCondTypeWritesRejected        EtcdCondType = "WritesRejected"
+	EtcdCondTypeWritesAllowed         EtcdCondType = "WritesAllowed"
+	EtcdCondTypeKeyQuotaExceeded      EtcdCondType = "KeyQuotaExceeded"
+	EtcdCondTypeKeyQuotasMet          EtcdCondType = "KeyQuotasMet"
+	EtcdCondTypeBackupFailed          EtcdCondType = "BackupFailed"
+	EtcdCondTypeBackupSucceeded       EtcdCondType = "BackupSucceeded"
 )
 
 const (
@@ -68,11 +781,241 @@ const (
 	EtcdReadyCondNegMessage          EtcdCondMessage = "Cluster StatefulSet is not Ready"
 	EtcdReadyCondPosMessage          EtcdCondMessage = "Cluster StatefulSet is Ready"
 	EtcdReadyCondNegWaitingForQuorum EtcdCondMessage = "Waiting for first quorum to be established"
+	EtcdMemberNodeLostCondPosMessage EtcdCondMessage = "Nodes holding data of some members are gone, members have to be replaced"
+	EtcdMemberNodeLostCondNegMessage EtcdCondMessage = "Nodes holding members data are available"
+	EtcdQuorumLostCondPosMessage     EtcdCondMessage = "Less than quorum of members is healthy"
+	EtcdQuorumLostCondNegMessage     EtcdCondMessage = "Quorum of members is healthy"
+	EtcdQuorumLostCondRestoreMessage EtcdCondMessage = "Cluster is being restored from the latest snapshot"
+	EtcdNodeDrainingCondPosMessage   EtcdCondMessage = "Nodes some members run on are drained, members will be moved"
+	EtcdNodeDrainingCondNegMessage   EtcdCondMessage = "Nodes members run on are schedulable"
+	EtcdPartitionCondNegMessage      EtcdCondMessage = "No asymmetric peer links are observed"
+	EtcdTrafficReadyCondPosMessage   EtcdCondMessage = "Quorum of members is healthy, the cluster is safe for client traffic"
+	EtcdTrafficReadyCondNegRestoring EtcdCondMessage = "Cluster is being restored from a snapshot"
+	EtcdVersionDriftCondNegMessage   EtcdCondMessage = "Members run the etcd version of the image"
+	EtcdVersionDriftCondUnknownImage EtcdCondMessage = "Tag of the etcd image is not a version, member versions are not compared"
+	EtcdPerformanceCondNegMessage    EtcdCondMessage = "Disk latency of members is normal, no leader changes or failed proposals are observed"
+	EtcdReadOnlyCondPosMessage       EtcdCondMessage = "Roles of users are revoked, only the root user can write"
+	EtcdReadOnlyCondNegMessage       EtcdCondMessage = "Roles of users are granted back, users can write"
+	EtcdKeyQuotaCondNegMessage       EtcdCondMessage = "Keys under all prefixes are within their quotas"
+	EtcdBackupFailingCondNegMessage  EtcdCondMessage = "Snapshots are taken, verified, expired and listed"
 )
 
 // EtcdClusterStatus defines the observed state of EtcdCluster
 type EtcdClusterStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Members contains observed state of every etcd member.
+	// +optional
+	Members []MemberStatus `json:"members,omitempty"`
+	// Backup contains the observed state of periodic snapshots.
+	// +optional
+	Backup *ClusterBackupStatus `json:"backup,omitempty"`
+	// Velero contains the observed state of Velero backups and restores of the cluster.
+	// +optional
+	Velero *VeleroStatus `json:"velero,omitempty"`
+	// Rotation contains the observed state of periodic replacement of members.
+	// +optional
+	Rotation *MemberRotationStatus `json:"rotation,omitempty"`
+	// Workflows contains the persisted state of long-running operations in progress, so every operation
+	// is resumed from its current step when the operator restarts.
+	// +optional
+	// +listType=map
+	// +listMapKey=operation
+	Workflows []WorkflowStatus `json:"workflows,omitempty"`
+	// DBSize is the largest database size among members observed while the cluster is ready.
+	// +optional
+	DBSize *resource.Quantity `json:"dbSize,omitempty"`
+	// Recommendations are scaling and tuning changes advised from metrics of members.
+	// They are not applied by the operator.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Recommendations []Recommendation `json:"recommendations,omitempty"`
+	// Autoscaling contains the observed state of automatic replica changes.
+	// +optional
+	Autoscaling *AutoscalingStatus `json:"autoscaling,omitempty"`
+	// Integration is the contract for hosted control planes consuming the cluster.
+	// +optional
+	Integration *IntegrationStatus `json:"integration,omitempty"`
+	// ReadOnly contains the state of the read-only mode while it is enabled or being disabled.
+	// +optional
+	ReadOnly *ReadOnlyStatus `json:"readOnly,omitempty"`
+	// KeyUsage contains the state of key usage reports.
+	// +optional
+	KeyUsage *KeyUsageStatus `json:"keyUsage,omitempty"`
+	// ProductionReadiness is the evaluation of the cluster against a production checklist.
+	// +optional
+	ProductionReadiness *ProductionReadinessReport `json:"productionReadiness,omitempty"`
+	// Quorum is the number of members which have to be available for the cluster to serve requests.
+	// +optional
+	Quorum int32 `json:"quorum,omitempty"`
+	// FaultTolerance is the number of members which can fail without losing the quorum.
+	// +optional
+	FaultTolerance int32 `json:"faultTolerance,omitempty"`
+}
+
+// ProductionReadinessCheckName is an item of the production checklist.
+type ProductionReadinessCheckName string
+
+const (
+	// ProductionCheckOddReplicas passes if the cluster has an odd number of members, three or more.
+	ProductionCheckOddReplicas ProductionReadinessCheckName = "OddReplicas"
+	// ProductionCheckMultiZone passes if members run in as many zones as a quorum needs to survive a zone outage.
+	ProductionCheckMultiZone ProductionReadinessCheckName = "MultiZone"
+	// ProductionCheckTLS passes if peer and client traffic is encrypted and clients are authenticated
+	// with certificates.
+	ProductionCheckTLS ProductionReadinessCheckName = "TLS"
+	// ProductionCheckFreshBackups passes if the last periodic snapshot is not older than two backup intervals.
+	ProductionCheckFreshBackups ProductionReadinessCheckName = "FreshBackups"
+	// ProductionCheckResources passes if the etcd container requests CPU and memory and has a memory limit.
+	ProductionCheckResources ProductionReadinessCheckName = "Resources"
+	// ProductionCheckBackendQuota passes if the backend quota is set explicitly.
+	ProductionCheckBackendQuota ProductionReadinessCheckName = "BackendQuota"
+	// ProductionCheckRecentDefragmentation passes if a Defragment EtcdOperation of the cluster succeeded
+	// within the last 30 days.
+	ProductionCheckRecentDefragmentation ProductionReadinessCheckName = "RecentDefragmentation"
+)
+
+// ProductionReadinessReport is the evaluation of the cluster against a production checklist.
+type ProductionReadinessReport struct {
+	// Score is the percentage of passed checks.
+	Score int32 `json:"score"`
+	// Checks are the results of the checklist items.
+	// +listType=map
+	// +listMapKey=name
+	Checks []ProductionReadinessCheck `json:"checks"`
+}
+
+// ProductionReadinessCheck is the result of an item of the production checklist.
+type ProductionReadinessCheck struct {
+	// Name is the checklist item.
+	Name ProductionReadinessCheckName `json:"name"`
+	// Passed is true if the cluster meets the item.
+	Passed bool `json:"passed"`
+	// Message describes the observed state.
+	Message string `json:"message"`
+}
+
+// KeyUsageStatus defines the state of key usage reports. Reports are published in the <name>-key-usage ConfigMap.
+type KeyUsageStatus struct {
+	// LastReportTime is the time the last report was published.
+	// +optional
+	LastReportTime *metav1.Time `json:"lastReportTime,omitempty"`
+	// ScannedKeys is the number of keys read for the last report.
+	// +optional
+	ScannedKeys int64 `json:"scannedKeys,omitempty"`
+	// Complete is true if all keys were read for the last report, false if the report is approximate.
+	// +optional
+	Complete bool `json:"complete,omitempty"`
+	// ExceededQuotas are prefixes of quotas exceeded in the last report.
+	// +optional
+	// +listType=set
+	ExceededQuotas []string `json:"exceededQuotas,omitempty"`
+	// FrozenUsers are users frozen for exceeding key quotas with their revoked roles, which are granted back
+	// once the quotas are met.
+	// +optional
+	// +listType=map
+	// +listMapKey=user
+	FrozenUsers []FrozenUser `json:"frozenUsers,omitempty"`
+}
+
+// FrozenUser is an etcd user frozen for exceeding key quotas.
+type FrozenUser struct {
+	// User is the name of the etcd user.
+	User string `json:"user"`
+	// Prefixes are prefixes of the exceeded quotas listing the user.
+	// +optional
+	// +listType=set
+	Prefixes []string `json:"prefixes,omitempty"`
+	// Roles are roles revoked from the user, which permit writes under the prefixes.
+	Roles []string `json:"roles"`
+}
+
+// ReadOnlyStatus defines the state of the read-only mode.
+type ReadOnlyStatus struct {
+	// Since is the time writes started to be rejected.
+	Since metav1.Time `json:"since"`
+	// RevokedRoles are roles revoked from users, which are granted back once the read-only mode is disabled.
+	// +optional
+	// +listType=map
+	// +listMapKey=user
+	RevokedRoles []UserRoles `json:"revokedRoles,omitempty"`
+}
+
+// UserRoles are etcd roles of a user.
+type UserRoles struct {
+	// User is the name of the etcd user.
+	User string `json:"user"`
+	// Roles are etcd roles of the user.
+	Roles []string `json:"roles"`
+}
+
+// RecommendationType is the kind of change recommended for a cluster.
+// +kubebuilder:validation:Enum=IncreaseQuota;FasterStorage;MoreResources
+type RecommendationType string
+
+const (
+	// RecommendationIncreaseQuota is recommended when the database is close to its backend quota.
+	RecommendationIncreaseQuota RecommendationType = "IncreaseQuota"
+	// RecommendationFasterStorage is recommended when disk writes of members are slow.
+	RecommendationFasterStorage RecommendationType = "FasterStorage"
+	// RecommendationMoreResources is recommended when members serve a high request rate.
+	RecommendationMoreResources RecommendationType = "MoreResources"
+)
+
+// Recommendation is a scaling or tuning change advised from metrics of members.
+type Recommendation struct {
+	// Type is the kind of the recommended change.
+	Type RecommendationType `json:"type"`
+	// Message describes the observed metrics and the recommended change.
+	Message string `json:"message"`
+	// Since is the time the recommendation was first made.
+	Since metav1.Time `json:"since"`
+}
+
+// MemberRotationStatus defines the observed state of periodic replacement of members.
+type MemberRotationStatus struct {
+	// LastRotatedMember is the name of the last replaced member.
+	// +optional
+	LastRotatedMember string `json:"lastRotatedMember,omitempty"`
+	// LastRotationTime is the time the last member was replaced.
+	// +optional
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+}
+
+// MemberStatus defines the observed state of a single etcd member.
+type MemberStatus struct {
+	// Name is the name of the member, which is equal to the name of its pod.
+	Name string `json:"name"`
+	// NodeName is the node the member pod is scheduled to.
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+	// Version is the etcd version the member reported last.
+	// +optional
+	Version string `json:"version,omitempty"`
+	// PinnedNode is the node the member data volume is bound to. It is set for topology-pinned volumes,
+	// e.g. local PersistentVolumes, and is empty if the volume can be attached to any node.
+	// +optional
+	PinnedNode string `json:"pinnedNode,omitempty"`
+	// PinnedNodeLost is true if PinnedNode does not exist anymore, so the member cannot be started
+	// until it is replaced.
+	// +optional
+	PinnedNodeLost bool `json:"pinnedNodeLost,omitempty"`
+	// NodeDraining is true if NodeName is cordoned or drained, so the member is about to be moved.
+	// +optional
+	NodeDraining bool `json:"nodeDraining,omitempty"`
+	// Restarts is the number of restarts of the etcd container in the current member pod.
+	// +optional
+	Restarts int32 `json:"restarts,omitempty"`
+	// OOMKills is the number of times the etcd container of the member was killed for running out of memory.
+	// Unlike Restarts, it is kept when the member pod is recreated.
+	// +optional
+	OOMKills int32 `json:"oomKills,omitempty"`
+	// LastTerminationReason is the reason of the last termination of the etcd container, e.g. OOMKilled or Error.
+	// +optional
+	LastTerminationReason string `json:"lastTerminationReason,omitempty"`
+	// LastTerminationTime is the time of the last termination of the etcd container.
+	// +optional
+	LastTerminationTime *metav1.Time `json:"lastTerminationTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -87,11 +1030,204 @@ type EtcdCluster struct {
 	Status EtcdClusterStatus `json:"status,omitempty"`
 }
 
+// RestoringWithJobs checks if data volumes of members are being restored by Jobs, so members have to be stopped.
+func (r *EtcdCluster) RestoringWithJobs() bool {
+	status := r.Status.Backup
+	return status != nil && status.RestoringFrom != "" && status.RestoreProgress != nil &&
+		status.RestoreProgress.Jobs && status.RestoreProgress.Snapshot == status.RestoringFrom
+}
+
 // CalculateQuorumSize returns minimum quorum size for current number of replicas
 func (r *EtcdCluster) CalculateQuorumSize() int {
 	return int(*r.Spec.Replicas)/2 + 1
 }
 
+// SizePreset returns the preset of the replica count of the cluster, or nil for clusters of less than five members.
+func (r *EtcdCluster) SizePreset() *SizePreset {
+	if r.Spec.Replicas == nil {
+		return nil
+	}
+	for i := range SizePresets {
+		if *r.Spec.Replicas >= SizePresets[i].MinReplicas {
+			return &SizePresets[i]
+		}
+	}
+	return nil
+}
+
+// EtcdImage returns the image of the etcd container set in the pod template or DefaultEtcdImage.
+func (r *EtcdCluster) EtcdImage() string {
+	for _, c := range r.Spec.PodTemplate.Spec.Containers {
+		if c.Name == "etcd" && c.Image != "" {
+			return c.Image
+		}
+	}
+	return DefaultEtcdImage
+}
+
+// ClientPort returns the port members serve clients on.
+func (r *EtcdCluster) ClientPort() int32 {
+	if r.Spec.Ports != nil && r.Spec.Ports.Client != 0 {
+		return r.Spec.Ports.Client
+	}
+	return DefaultClientPort
+}
+
+// PeerPort returns the port members communicate with peers on.
+func (r *EtcdCluster) PeerPort() int32 {
+	if r.Spec.Ports != nil && r.Spec.Ports.Peer != 0 {
+		return r.Spec.Ports.Peer
+	}
+	return DefaultPeerPort
+}
+
+// MetricsPort returns the port members serve metrics and health endpoints on.
+func (r *EtcdCluster) MetricsPort() int32 {
+	if r.Spec.Ports != nil && r.Spec.Ports.Metrics != 0 {
+		return r.Spec.Ports.Metrics
+	}
+	return DefaultMetricsPort
+}
+
+// ClientScheme returns the scheme members serve clients with, https if the server certificate is configured.
+func (r *EtcdCluster) ClientScheme() string {
+	if r.Spec.Security != nil && r.Spec.Security.TLS.ServerSecret != "" {
+		return "https"
+	}
+	return "http"
+}
+
+// MemberIdentity is the name and network identity of a cluster member. Names, DNS names and URLs of members are
+// derived only from it, so etcd flags, certificates, restore Jobs and clients of the operator agree on them.
+// +kubebuilder:object:generate=false
+type MemberIdentity struct {
+	// Name is the name of the member and its pod.
+	Name string
+	// Host is the DNS name of the member pod in the headless service of the cluster.
+	Host string
+	// ClientURL is the URL the member serves clients on.
+	ClientURL string
+	// PeerURL is the URL the member communicates with peers on.
+	PeerURL string
+	// MetricsURL is the URL the member serves metrics and health endpoints on.
+	MetricsURL string
+}
+
+// MemberName returns the name of the member with the given ordinal.
+func (r *EtcdCluster) MemberName(ordinal int32) string {
+	return fmt.Sprintf("%s-%d", r.Name, ordinal)
+}
+
+// MemberNames returns names of all cluster members in order of their ordinals.
+func (r *EtcdCluster) MemberNames() []string {
+	names := make([]string, 0, *r.Spec.Replicas)
+	for i := int32(0); i < *r.Spec.Replicas; i++ {
+		names = append(names, r.MemberName(i))
+	}
+	return names
+}
+
+// Member returns the identity of the member with the given name.
+func (r *EtcdCluster) Member(name string) MemberIdentity {
+	return r.memberIdentity(name, r.Namespace)
+}
+
+// Members returns identities of all cluster members in order of their ordinals.
+func (r *EtcdCluster) Members() []MemberIdentity {
+	members := make([]MemberIdentity, 0, *r.Spec.Replicas)
+	for _, name := range r.MemberNames() {
+		members = append(members, r.Member(name))
+	}
+	return members
+}
+
+// PodMember returns the identity of the member rendered with references to POD_NAME and POD_NAMESPACE
+// environment variables, for arguments of containers in member pods.
+func (r *EtcdCluster) PodMember() MemberIdentity {
+	return r.memberIdentity("$(POD_NAME)", "$(POD_NAMESPACE)")
+}
+
+// MemberDNSNames returns wildcard DNS names matching hosts of all members, for member certificates.
+func (r *EtcdCluster) MemberDNSNames() []string {
+	return []string{
+		fmt.Sprintf("*.%s.%s.svc", r.Name, r.Namespace),
+		fmt.Sprintf("*.%s.%s.svc.cluster.local", r.Name, r.Namespace),
+	}
+}
+
+func (r *EtcdCluster) memberIdentity(name, namespace string) MemberIdentity {
+	host := fmt.Sprintf("%s.%s.%s.svc", name, r.Name, namespace)
+	return MemberIdentity{
+		Name:       name,
+		Host:       host,
+		ClientURL:  fmt.Sprintf("%s://%s:%d", r.ClientScheme(), host, r.ClientPort()),
+		PeerURL:    fmt.Sprintf("https://%s:%d", host, r.PeerPort()),
+		MetricsURL: fmt.Sprintf("http://%s:%d", host, r.MetricsPort()),
+	}
+}
+
+// EtcdVersion returns etcd version parsed from the tag of the etcd image or nil if the tag is not a version.
+func (r *EtcdCluster) EtcdVersion() *version.Version {
+	image := r.EtcdImage()
+	image, _, _ = strings.Cut(image, "@")
+	idx := strings.LastIndex(image, ":")
+	if idx == -1 || strings.Contains(image[idx:], "/") {
+		return nil
+	}
+	v, err := version.ParseGeneric(image[idx+1:])
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// ProbeInterval returns the interval of periodic probes of the cluster, which is at least Probes.Interval.
+func (r *EtcdCluster) ProbeInterval(interval time.Duration) time.Duration {
+	if r.Spec.Probes != nil && r.Spec.Probes.Interval != nil && r.Spec.Probes.Interval.Duration > interval {
+		return r.Spec.Probes.Interval.Duration
+	}
+	return interval
+}
+
+// ProbeParallelism returns the number of members probed at once.
+func (r *EtcdCluster) ProbeParallelism() int {
+	if r.Spec.Probes != nil && r.Spec.Probes.Parallelism != nil && *r.Spec.Probes.Parallelism > 0 {
+		return int(*r.Spec.Probes.Parallelism)
+	}
+	return 1
+}
+
+// ManagedEndpoints returns true if the operator manages endpoints of cluster Services itself.
+func (r *EtcdCluster) ManagedEndpoints() bool {
+	return r.Spec.Endpoints != nil && r.Spec.Endpoints.Mode == EndpointsModeManaged
+}
+
+// ServiceCABundleConfigMap returns the name of the ConfigMap the OpenShift service CA bundle is injected into.
+func (r *EtcdCluster) ServiceCABundleConfigMap() string {
+	return r.Name + "-service-ca"
+}
+
+// ServiceCAEnabled checks if the server certificate is issued by the OpenShift service CA.
+func (r *EtcdCluster) ServiceCAEnabled() bool {
+	return r.Spec.OpenShift != nil && r.Spec.OpenShift.ServiceCA
+}
+
+// RootCredentialsSecret returns the name of the Secret the root user credentials are stored in.
+func (r *EtcdCluster) RootCredentialsSecret() string {
+	return r.Name + "-root-credentials"
+}
+
+// UserCredentialsSecret returns the name of the Secret the credentials of the managed user are stored in
+// unless the user specifies one.
+func (r *EtcdCluster) UserCredentialsSecret(user string) string {
+	return r.Name + "-" + user + "-credentials"
+}
+
+// RoleServices returns true if the leader and followers Services are created for the cluster.
+func (r *EtcdCluster) RoleServices() bool {
+	return r.ManagedEndpoints() || r.Spec.Endpoints != nil && r.Spec.Endpoints.RoleServices
+}
+
 // +kubebuilder:object:root=true
 
 // EtcdClusterList contains a list of EtcdCluster
@@ -140,6 +1276,31 @@ type PodTemplate struct {
 	Spec corev1.PodSpec `json:"spec,omitempty"`
 }
 
+// MemberSecurityContext defines the user and groups member pods run as, e.g. to satisfy security context constraints
+// assigning a UID range to the namespace or policies forbidding root. It is applied to the pod security context.
+type MemberSecurityContext struct {
+	// RunAsUser is the UID containers run as. Members run as non-root if it is not 0.
+	// +optional
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:validation:Maximum:=2147483647
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+	// RunAsGroup is the GID containers run as.
+	// +optional
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:validation:Maximum:=2147483647
+	RunAsGroup *int64 `json:"runAsGroup,omitempty"`
+	// FSGroup is the supplemental group owning data volumes, so members running as non-root can write them.
+	// +optional
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:validation:Maximum:=2147483647
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+}
+
+// NonRoot checks if members run as a user other than root.
+func (c *MemberSecurityContext) NonRoot() bool {
+	return c.RunAsUser != nil && *c.RunAsUser != 0
+}
+
 // StorageSpec defines the configured storage for a etcd members.
 // If neither `emptyDir` nor `volumeClaimTemplate` is specified, then by default an [EmptyDir](https://kubernetes.io/docs/concepts/storage/volumes/#emptydir) will be used.
 // +k8s:openapi-gen=true
@@ -151,6 +1312,11 @@ type StorageSpec struct {
 	// A PVC spec to be used by the StatefulSets.
 	// +optional
 	VolumeClaimTemplate EmbeddedPersistentVolumeClaim `json:"volumeClaimTemplate,omitempty"`
+	// A PVC spec for a dedicated write-ahead log volume. If specified, a second PVC is provisioned for every member
+	// and etcd is started with --wal-dir pointing to it, so WAL fsyncs can be served by low-latency storage
+	// distinct from the snapshot/db volume. Cannot be combined with emptyDir.
+	// +optional
+	WALVolumeClaimTemplate *EmbeddedPersistentVolumeClaim `json:"walVolumeClaimTemplate,omitempty"`
 }
 
 // SecuritySpec defines security settings for etcd.
@@ -159,6 +1325,50 @@ type SecuritySpec struct {
 	// Section for user-managed tls certificates
 	// +optional
 	TLS TLSSpec `json:"tls,omitempty"`
+	// Auth enables etcd authentication with credentials managed by the operator.
+	// +optional
+	Auth *AuthSpec `json:"auth,omitempty"`
+}
+
+// AuthSpec defines etcd users whose credentials are generated and stored in Secrets by the operator.
+// The root user is always managed, its credentials are stored in the <name>-root-credentials Secret.
+type AuthSpec struct {
+	// Users are application users managed in addition to the root user.
+	// +optional
+	Users []ManagedUser `json:"users,omitempty"`
+	// Rotation enables periodic replacement of passwords of managed users.
+	// +optional
+	Rotation *CredentialRotationSpec `json:"rotation,omitempty"`
+}
+
+// ManagedUser defines an etcd user managed by the operator.
+type ManagedUser struct {
+	// Name is the name of the etcd user.
+	Name string `json:"name"`
+	// Roles are etcd roles granted to the user. Roles are not created by the operator.
+	// +optional
+	Roles []string `json:"roles,omitempty"`
+	// SecretName is the Secret the username and password of the user are stored in.
+	// Defaults to <name>-<user>-credentials.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// Consumers are workloads using the credentials. Their pod template is annotated with the time of the last
+	// password change, so they are restarted to pick up the new password.
+	// +optional
+	Consumers []CredentialConsumer `json:"consumers,omitempty"`
+}
+
+// CredentialConsumer references a workload in the EtcdCluster namespace.
+type CredentialConsumer struct {
+	// +kubebuilder:validation:Enum=Deployment;StatefulSet;DaemonSet
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// CredentialRotationSpec defines how often passwords of managed users are replaced.
+type CredentialRotationSpec struct {
+	// MaxAge is the maximum age of a password, after which a new password is generated.
+	MaxAge metav1.Duration `json:"maxAge"`
 }
 
 // TLSSpec defines user-managed certificates names.
@@ -169,7 +1379,7 @@ type TLSSpec struct {
 	// Certificate secret to secure peer-to-peer communication between etcd nodes. It is expected to have tls.crt and tls.key fields in the secret.
 	// +optional
 	PeerSecret string `json:"peerSecret,omitempty"`
-	// Server certificate secret to secure client-server communication. Is provided to the client who connects to etcd by client port (2379 by default).
+	// Server certificate secret to secure client-server communication. Is provided to the client who connects to etcd by client port (2379 by default, see Ports).
 	// It is expected to have tls.crt and tls.key fields in the secret.
 	// +optional
 	ServerSecret string `json:"serverSecret,omitempty"`
@@ -179,6 +1389,40 @@ type TLSSpec struct {
 	// Client certificate for etcd-operator to do maintenance. It is expected to have tls.crt and tls.key fields in the secret.
 	// +optional
 	ClientSecret string `json:"clientSecret,omitempty"`
+	// Certificate revocation list secret to reject revoked client certificates. It is expected to have crl.pem field
+	// in the secret. Members re-read the list on every client connection, so updates are applied without restarts.
+	// +optional
+	ClientCRLSecret string `json:"clientCRLSecret,omitempty"`
+	// ServerIssuerRef references a cert-manager issuer to issue the server certificate with. If set, the operator
+	// requests the certificate from cert-manager, which stores it in ServerSecret.
+	// +optional
+	ServerIssuerRef *IssuerReference `json:"serverIssuerRef,omitempty"`
+	// ExtraSANs are DNS names and IP addresses added to the server certificate issued with ServerIssuerRef
+	// in addition to names of the cluster services, e.g. hostnames of external load balancers.
+	// +optional
+	ExtraSANs []string `json:"extraSANs,omitempty"`
+	// CipherSuites is the list of cipher suites for client and peer connections, e.g.
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Go defaults are used if empty. Cipher suites of TLS 1.3
+	// are not configurable.
+	// +optional
+	CipherSuites []string `json:"cipherSuites,omitempty"`
+	// MinVersion is the minimum TLS version of client and peer connections.
+	// +optional
+	// +kubebuilder:validation:Enum=TLS1.2;TLS1.3
+	MinVersion string `json:"minVersion,omitempty"`
+}
+
+// IssuerReference references a cert-manager issuer.
+type IssuerReference struct {
+	// Name of the issuer.
+	Name string `json:"name"`
+	// Kind of the issuer, Issuer or ClusterIssuer.
+	// +optional
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	Kind string `json:"kind,omitempty"`
+	// Group of the issuer.
+	// +optional
+	Group string `json:"group,omitempty"`
 }
 
 // EmbeddedPersistentVolumeClaim is an embedded version of k8s.io/api/core/v1.PersistentVolumeClaim.
@@ -1,8 +1,11 @@
 package v1alpha1
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/ptr"
 )
 
@@ -20,3 +23,60 @@ var _ = Context("CalculateQuorumSize", func() {
 		Expect(etcdCluster.CalculateQuorumSize()).To(Equal(3))
 	})
 })
+
+var _ = Context("SizePreset", func() {
+	It("should apply presets to clusters of five and more members", func() {
+		etcdCluster := EtcdCluster{Spec: EtcdClusterSpec{Replicas: ptr.To(int32(3))}}
+		Expect(etcdCluster.SizePreset()).To(BeNil())
+
+		etcdCluster.Spec.Replicas = ptr.To(int32(6))
+		Expect(etcdCluster.SizePreset().Options()).To(Equal(map[string]string{
+			"heartbeat-interval": "150",
+			"election-timeout":   "1500",
+			"snapshot-count":     "75000",
+		}))
+
+		etcdCluster.Spec.Replicas = ptr.To(int32(7))
+		Expect(etcdCluster.SizePreset().MinReplicas).To(Equal(int32(7)))
+		Expect(etcdCluster.SizePreset().RolloutSoak).To(Equal(2 * time.Minute))
+	})
+})
+
+var _ = Context("Probes", func() {
+	It("should probe members one by one at default intervals by default", func() {
+		etcdCluster := EtcdCluster{}
+		Expect(etcdCluster.ProbeInterval(10 * time.Second)).To(Equal(10 * time.Second))
+		Expect(etcdCluster.ProbeParallelism()).To(Equal(1))
+	})
+	It("should never probe more often than the cluster interval", func() {
+		etcdCluster := EtcdCluster{Spec: EtcdClusterSpec{Probes: &ProbesSpec{
+			Interval:    &metav1.Duration{Duration: time.Minute},
+			Parallelism: ptr.To(int32(3)),
+		}}}
+		Expect(etcdCluster.ProbeInterval(10 * time.Second)).To(Equal(time.Minute))
+		Expect(etcdCluster.ProbeInterval(2 * time.Minute)).To(Equal(2 * time.Minute))
+		Expect(etcdCluster.ProbeParallelism()).To(Equal(3))
+	})
+})
+
+var _ = Context("Member identities", func() {
+	It("should derive names and URLs of members", func() {
+		etcdCluster := EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "etcd", Namespace: "db"},
+			Spec: EtcdClusterSpec{
+				Replicas: ptr.To(int32(2)),
+				Ports:    &PortsSpec{Client: 12379},
+				Security: &SecuritySpec{TLS: TLSSpec{ServerSecret: "server"}},
+			},
+		}
+		Expect(etcdCluster.MemberNames()).To(Equal([]string{"etcd-0", "etcd-1"}))
+		Expect(etcdCluster.Members()[1]).To(Equal(MemberIdentity{
+			Name:       "etcd-1",
+			Host:       "etcd-1.etcd.db.svc",
+			ClientURL:  "https://etcd-1.etcd.db.svc:12379",
+			PeerURL:    "https://etcd-1.etcd.db.svc:2380",
+			MetricsURL: "http://etcd-1.etcd.db.svc:2381",
+		}))
+		Expect(etcdCluster.PodMember().PeerURL).To(Equal("https://$(POD_NAME).etcd.$(POD_NAMESPACE).svc:2380"))
+	})
+})
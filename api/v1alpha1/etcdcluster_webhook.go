@@ -17,18 +17,28 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -49,6 +59,129 @@ func (r *EtcdCluster) SetupWebhookWithManager(mgr ctrl.Manager) error {
 
 var _ webhook.Defaulter = &EtcdCluster{}
 
+const (
+	// DefaultBackupInterval is the interval between periodic snapshots if not specified.
+	DefaultBackupInterval = 15 * time.Minute
+	// DefaultVerificationInterval is the interval between scheduled snapshot verifications if not specified.
+	DefaultVerificationInterval = 24 * time.Hour
+	// DefaultVerificationHistoryLimit is the number of snapshot verification results kept if not specified.
+	DefaultVerificationHistoryLimit = 10
+	// DefaultKeyUsageInterval is the interval between key usage reports if not specified.
+	DefaultKeyUsageInterval = time.Hour
+	// DefaultQuorumLossTimeout is how long the quorum has to be lost before automatic restore if not specified.
+	DefaultQuorumLossTimeout = 2 * time.Minute
+	// DefaultVeleroHookTimeout is how long Velero waits for member hooks if not specified.
+	DefaultVeleroHookTimeout = time.Minute
+	// DefaultRotationMinInterval is the minimum time between replacements of two members if not specified.
+	DefaultRotationMinInterval = 10 * time.Minute
+	// MinRotationReplicas is the minimum number of members of a cluster which keeps quorum while a member is replaced.
+	MinRotationReplicas = 3
+	// DefaultVolumeSnapshotClassName is the VolumeSnapshotClass of published snapshots if not specified.
+	DefaultVolumeSnapshotClassName = "etcd-operator"
+	// DefaultIssuerKind is the kind of the cert-manager issuer if not specified.
+	DefaultIssuerKind = "Issuer"
+	// DefaultIssuerGroup is the group of the cert-manager issuer if not specified.
+	DefaultIssuerGroup = "cert-manager.io"
+	// TLSVersion12 is the value of TLSSpec.MinVersion allowing TLS 1.2 and newer.
+	TLSVersion12 = "TLS1.2"
+	// TLSVersion13 is the value of TLSSpec.MinVersion allowing TLS 1.3 only.
+	TLSVersion13 = "TLS1.3"
+	// MinCredentialMaxAge is the minimum age of passwords, which leaves consumers time to pick up a new password.
+	MinCredentialMaxAge = time.Hour
+	// DefaultMaxReplicasChange is the default maximum number of members added or removed by a single update.
+	DefaultMaxReplicasChange = 1
+	// DefaultAutoscalingMaxBackupAge is the maximum age of the last snapshot for automatic replica changes
+	// if not specified.
+	DefaultAutoscalingMaxBackupAge = 24 * time.Hour
+	// DefaultScaleDownDelay is the minimum time between the last replica change and automatic removal of members
+	// if not specified.
+	DefaultScaleDownDelay = time.Hour
+	// DefaultJobBackoffLimit is the number of retries of operator Jobs if not specified.
+	DefaultJobBackoffLimit int32 = 3
+	// DefaultSuccessfulJobsHistoryLimit is the number of succeeded operator Jobs of each kind kept if not specified.
+	DefaultSuccessfulJobsHistoryLimit int32 = 3
+	// DefaultFailedJobsHistoryLimit is the number of failed operator Jobs of each kind kept if not specified.
+	DefaultFailedJobsHistoryLimit int32 = 1
+	// imageArchitecturesTimeout limits the time of looking up architectures of an image at admission.
+	imageArchitecturesTimeout = 10 * time.Second
+)
+
+// FIPSCipherSuites are FIPS-approved cipher suites members accept in FIPS mode.
+var FIPSCipherSuites = []string{
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+}
+
+// maxReplicasChange is the maximum number of members that can be added or removed by a single update,
+// zero means no limit.
+var maxReplicasChange int32 = DefaultMaxReplicasChange
+
+// SetMaxReplicasChange configures the maximum number of members that can be added or removed by a single update.
+// Zero disables the limit.
+func SetMaxReplicasChange(limit int32) {
+	maxReplicasChange = limit
+}
+
+// ImageArchitecturesLookup returns the CPU architectures an image is built for, e.g. from its manifest list.
+// +kubebuilder:object:generate=false
+type ImageArchitecturesLookup func(ctx context.Context, image string) ([]string, error)
+
+// imageArchitecturesLookup looks up architectures of etcd images at admission, nil if images are not checked.
+var imageArchitecturesLookup ImageArchitecturesLookup
+
+// SetImageArchitecturesLookup configures the lookup checking that etcd images of clusters are built for their
+// architectures at admission. Nil disables the check.
+func SetImageArchitecturesLookup(lookup ImageArchitecturesLookup) {
+	imageArchitecturesLookup = lookup
+}
+
+// defaultBackupPolicy is the backup policy of clusters without their own, nil if there is no such policy.
+var defaultBackupPolicy *ClusterBackupSpec
+
+// SetDefaultBackupPolicy configures the backup policy applied to clusters without their own, so every cluster
+// of the fleet is backed up. Nil disables the policy. The policy can't enable automatic restore, as it requires
+// emptyDir storage.
+func SetDefaultBackupPolicy(policy *ClusterBackupSpec) error {
+	if policy != nil {
+		cluster := &EtcdCluster{Spec: EtcdClusterSpec{Backup: policy}}
+		if allErrors := cluster.validateBackup(); len(allErrors) > 0 {
+			return allErrors.ToAggregate()
+		}
+		// the policy is applied by the operator in memory as well, bypassing the webhook, so it is defaulted here
+		defaultBackup(policy)
+	}
+	defaultBackupPolicy = policy
+	return nil
+}
+
+// ApplyDefaultBackupPolicy sets the default backup policy to the cluster if it has no backups configured.
+// It returns true if the policy is applied.
+func (r *EtcdCluster) ApplyDefaultBackupPolicy() bool {
+	if r.Spec.Backup != nil || defaultBackupPolicy == nil {
+		return false
+	}
+	r.Spec.Backup = defaultBackupPolicy.DeepCopy()
+	return true
+}
+
+// defaultBackup sets defaults of the backup spec.
+func defaultBackup(backup *ClusterBackupSpec) {
+	if backup.Interval.Duration == 0 {
+		backup.Interval = metav1.Duration{Duration: DefaultBackupInterval}
+	}
+	if backup.AutoRestore != nil && backup.AutoRestore.QuorumLossTimeout.Duration == 0 {
+		backup.AutoRestore.QuorumLossTimeout = metav1.Duration{Duration: DefaultQuorumLossTimeout}
+	}
+	if schedule := backup.VerificationSchedule; schedule != nil && schedule.Interval.Duration == 0 {
+		schedule.Interval = metav1.Duration{Duration: DefaultVerificationInterval}
+	}
+	if backup.VolumeSnapshots != nil && backup.VolumeSnapshots.ClassName == "" {
+		backup.VolumeSnapshots.ClassName = DefaultVolumeSnapshotClassName
+	}
+}
+
 // Default implements webhook.Defaulter so a webhook will be registered for the type
 func (r *EtcdCluster) Default() {
 	etcdclusterlog.Info("default", "name", r.Name)
@@ -63,6 +196,76 @@ func (r *EtcdCluster) Default() {
 			}
 		}
 	}
+	if wal := r.Spec.Storage.WALVolumeClaimTemplate; wal != nil {
+		if len(wal.Spec.AccessModes) == 0 {
+			wal.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+		}
+		storage := wal.Spec.Resources.Requests.Storage()
+		if storage == nil || storage.IsZero() {
+			wal.Spec.Resources.Requests = corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse("1Gi"),
+			}
+		}
+	}
+	r.ApplyDefaultBackupPolicy()
+	if r.Spec.Backup != nil {
+		defaultBackup(r.Spec.Backup)
+	}
+	if velero := r.Spec.Velero; velero != nil && velero.HookTimeout.Duration == 0 {
+		velero.HookTimeout = metav1.Duration{Duration: DefaultVeleroHookTimeout}
+	}
+	if mesh := r.Spec.ServiceMesh; mesh != nil {
+		if mesh.Provider == "" {
+			mesh.Provider = ServiceMeshIstio
+		}
+		if mesh.ExcludePorts == nil {
+			mesh.ExcludePorts = ptr.To(true)
+		}
+	}
+	if autoscaling := r.Spec.Autoscaling; autoscaling != nil {
+		if autoscaling.MaxBackupAge.Duration == 0 {
+			autoscaling.MaxBackupAge = metav1.Duration{Duration: DefaultAutoscalingMaxBackupAge}
+		}
+		if autoscaling.ScaleDownDelay.Duration == 0 {
+			autoscaling.ScaleDownDelay = metav1.Duration{Duration: DefaultScaleDownDelay}
+		}
+	}
+	if rotation := r.Spec.Rotation; rotation != nil && rotation.MinInterval.Duration == 0 {
+		rotation.MinInterval = metav1.Duration{Duration: DefaultRotationMinInterval}
+	}
+	if usage := r.Spec.KeyUsage; usage != nil && usage.Interval.Duration == 0 {
+		usage.Interval = metav1.Duration{Duration: DefaultKeyUsageInterval}
+	}
+	if r.Spec.Security != nil && r.Spec.Security.Auth != nil {
+		for i := range r.Spec.Security.Auth.Users {
+			if user := &r.Spec.Security.Auth.Users[i]; user.SecretName == "" {
+				user.SecretName = r.UserCredentialsSecret(user.Name)
+			}
+		}
+	}
+	if jobs := r.Spec.JobTemplate; jobs != nil {
+		if jobs.BackoffLimit == nil {
+			jobs.BackoffLimit = ptr.To(DefaultJobBackoffLimit)
+		}
+		if jobs.SuccessfulJobsHistoryLimit == nil {
+			jobs.SuccessfulJobsHistoryLimit = ptr.To(DefaultSuccessfulJobsHistoryLimit)
+		}
+		if jobs.FailedJobsHistoryLimit == nil {
+			jobs.FailedJobsHistoryLimit = ptr.To(DefaultFailedJobsHistoryLimit)
+		}
+	}
+	if r.Spec.Endpoints != nil && r.Spec.Endpoints.Mode == "" {
+		r.Spec.Endpoints.Mode = EndpointsModeSelector
+	}
+	if r.Spec.Security != nil && r.Spec.Security.TLS.ServerIssuerRef != nil {
+		issuer := r.Spec.Security.TLS.ServerIssuerRef
+		if issuer.Kind == "" {
+			issuer.Kind = DefaultIssuerKind
+		}
+		if issuer.Group == "" {
+			issuer.Group = DefaultIssuerGroup
+		}
+	}
 }
 
 // +kubebuilder:webhook:path=/validate-etcd-aenix-io-v1alpha1-etcdcluster,mutating=false,failurePolicy=fail,sideEffects=None,groups=etcd.aenix.io,resources=etcdclusters,verbs=create;update,versions=v1alpha1,name=vetcdcluster.kb.io,admissionReviewVersions=v1
@@ -73,25 +276,12 @@ var _ webhook.Validator = &EtcdCluster{}
 func (r *EtcdCluster) ValidateCreate() (admission.Warnings, error) {
 	etcdclusterlog.Info("validate create", "name", r.Name)
 
-	var allErrors field.ErrorList
-
-	warnings, pdbErr := r.validatePdb()
-	if pdbErr != nil {
-		allErrors = append(allErrors, pdbErr...)
-	}
-
-	securityErr := r.validateSecurity()
-	if securityErr != nil {
-		allErrors = append(allErrors, securityErr...)
-	}
-
-	if errOptions := validateOptions(r); errOptions != nil {
-		allErrors = append(allErrors, field.Invalid(
-			field.NewPath("spec", "options"),
-			r.Spec.Options,
-			errOptions.Error()))
+	warnings, allErrors := r.ValidateSpec()
+	archWarnings, archErr := r.validateImageArchitectures(nil)
+	warnings = append(warnings, archWarnings...)
+	if archErr != nil {
+		allErrors = append(allErrors, archErr)
 	}
-
 	if len(allErrors) > 0 {
 		err := errors.NewInvalid(
 			schema.GroupKind{Group: GroupVersion.Group, Kind: "EtcdCluster"},
@@ -105,35 +295,104 @@ func (r *EtcdCluster) ValidateCreate() (admission.Warnings, error) {
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *EtcdCluster) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
 	etcdclusterlog.Info("validate update", "name", r.Name)
-	var warnings admission.Warnings
 	oldCluster := old.(*EtcdCluster)
-	if *oldCluster.Spec.Replicas != *r.Spec.Replicas {
-		warnings = append(warnings, "cluster resize is not currently supported")
+
+	allErrors := r.ValidateSpecChange(oldCluster)
+	warnings, specErrors := r.ValidateSpec()
+	allErrors = append(allErrors, specErrors...)
+	archWarnings, archErr := r.validateImageArchitectures(oldCluster)
+	warnings = append(warnings, archWarnings...)
+	if archErr != nil {
+		allErrors = append(allErrors, archErr)
+	}
+	if len(allErrors) > 0 {
+		err := errors.NewInvalid(
+			schema.GroupKind{Group: GroupVersion.Group, Kind: "EtcdCluster"},
+			r.Name, allErrors)
+		return warnings, err
 	}
 
+	return warnings, nil
+}
+
+// ValidateSpec validates the defaulted spec with the rules applied to both creates and updates.
+// The rules don't depend on the API server, so manifests can be validated offline as well.
+func (r *EtcdCluster) ValidateSpec() (admission.Warnings, field.ErrorList) {
 	var allErrors field.ErrorList
-	if oldCluster.Spec.Storage.EmptyDir == nil && r.Spec.Storage.EmptyDir != nil ||
-		oldCluster.Spec.Storage.EmptyDir != nil && r.Spec.Storage.EmptyDir == nil {
-		allErrors = append(allErrors, field.Invalid(
-			field.NewPath("spec", "storage", "emptyDir"),
-			r.Spec.Storage.EmptyDir,
-			"field is immutable"),
-		)
-	}
 
-	pdbWarnings, pdbErr := r.validatePdb()
+	warnings, pdbErr := r.validatePdb()
 	if pdbErr != nil {
 		allErrors = append(allErrors, pdbErr...)
 	}
-	if len(pdbWarnings) > 0 {
-		warnings = append(warnings, pdbWarnings...)
-	}
+	warnings = append(warnings, r.serviceMeshWarnings()...)
 
 	securityErr := r.validateSecurity()
 	if securityErr != nil {
 		allErrors = append(allErrors, securityErr...)
 	}
 
+	if storageErr := r.validateStorage(); storageErr != nil {
+		allErrors = append(allErrors, storageErr...)
+	}
+
+	if backupErr := r.validateBackup(); backupErr != nil {
+		allErrors = append(allErrors, backupErr...)
+	}
+	if veleroErr := r.validateVelero(); veleroErr != nil {
+		allErrors = append(allErrors, veleroErr)
+	}
+	if restoreErr := r.validateRestoreRequest(); restoreErr != nil {
+		allErrors = append(allErrors, restoreErr)
+	}
+	if bootstrapErr := r.validateBootstrap(); bootstrapErr != nil {
+		allErrors = append(allErrors, bootstrapErr)
+	}
+	if rotationErr := r.validateRotation(); rotationErr != nil {
+		allErrors = append(allErrors, rotationErr...)
+	}
+	if autoscalingErr := r.validateAutoscaling(); autoscalingErr != nil {
+		allErrors = append(allErrors, autoscalingErr...)
+	}
+	if integrationErr := r.validateIntegration(); integrationErr != nil {
+		allErrors = append(allErrors, integrationErr)
+	}
+	if portsErr := r.validatePorts(); portsErr != nil {
+		allErrors = append(allErrors, portsErr)
+	}
+	if clientURLsErr := r.validateClientURLs(); clientURLsErr != nil {
+		allErrors = append(allErrors, clientURLsErr...)
+	}
+	if tuningErr := r.validateTuning(); tuningErr != nil {
+		allErrors = append(allErrors, tuningErr...)
+	}
+	if loggingErr := r.validateLogging(); loggingErr != nil {
+		allErrors = append(allErrors, loggingErr...)
+	}
+	if startupErr := r.validateStartup(); startupErr != nil {
+		allErrors = append(allErrors, startupErr)
+	}
+	if readOnlyErr := r.validateReadOnly(); readOnlyErr != nil {
+		allErrors = append(allErrors, readOnlyErr)
+	}
+	if keyUsageErr := r.validateKeyUsage(); keyUsageErr != nil {
+		allErrors = append(allErrors, keyUsageErr...)
+	}
+	if notificationsErr := r.validateNotifications(); notificationsErr != nil {
+		allErrors = append(allErrors, notificationsErr...)
+	}
+	if probesErr := r.validateProbes(); probesErr != nil {
+		allErrors = append(allErrors, probesErr)
+	}
+	if etcdAPIErr := r.validateEtcdAPI(); etcdAPIErr != nil {
+		allErrors = append(allErrors, etcdAPIErr...)
+	}
+	if securityContextErr := r.validateSecurityContext(); securityContextErr != nil {
+		allErrors = append(allErrors, securityContextErr...)
+	}
+	if openShiftErr := r.validateOpenShift(); openShiftErr != nil {
+		allErrors = append(allErrors, openShiftErr...)
+	}
+
 	if errOptions := validateOptions(r); errOptions != nil {
 		allErrors = append(allErrors, field.Invalid(
 			field.NewPath("spec", "options"),
@@ -141,14 +400,57 @@ func (r *EtcdCluster) ValidateUpdate(old runtime.Object) (admission.Warnings, er
 			errOptions.Error()))
 	}
 
-	if len(allErrors) > 0 {
-		err := errors.NewInvalid(
-			schema.GroupKind{Group: GroupVersion.Group, Kind: "EtcdCluster"},
-			r.Name, allErrors)
-		return warnings, err
+	return warnings, allErrors
+}
+
+// ValidateSpecChange validates changes of the spec from the old one, such as updates of immutable fields.
+func (r *EtcdCluster) ValidateSpecChange(oldCluster *EtcdCluster) field.ErrorList {
+	var allErrors field.ErrorList
+	if replicasErr := r.validateReplicasChange(oldCluster); replicasErr != nil {
+		allErrors = append(allErrors, replicasErr)
+	}
+	if oldCluster.Spec.Storage.EmptyDir == nil && r.Spec.Storage.EmptyDir != nil ||
+		oldCluster.Spec.Storage.EmptyDir != nil && r.Spec.Storage.EmptyDir == nil {
+		allErrors = append(allErrors, field.Invalid(
+			field.NewPath("spec", "storage", "emptyDir"),
+			r.Spec.Storage.EmptyDir,
+			"field is immutable"),
+		)
+	}
+	if oldCluster.ClientPort() != r.ClientPort() || oldCluster.PeerPort() != r.PeerPort() ||
+		oldCluster.MetricsPort() != r.MetricsPort() {
+		allErrors = append(allErrors, field.Invalid(
+			field.NewPath("spec", "ports"),
+			r.Spec.Ports,
+			"field is immutable"),
+		)
 	}
+	if (oldCluster.Spec.Storage.WALVolumeClaimTemplate == nil) != (r.Spec.Storage.WALVolumeClaimTemplate == nil) {
+		allErrors = append(allErrors, field.Invalid(
+			field.NewPath("spec", "storage", "walVolumeClaimTemplate"),
+			r.Spec.Storage.WALVolumeClaimTemplate,
+			"field is immutable"),
+		)
+	}
+	return allErrors
+}
 
-	return warnings, nil
+// validateReplicasChange rejects updates which add or remove more members than allowed at once.
+// Members are added and removed one by one, each time changing the quorum size, so big jumps destabilize the cluster.
+func (r *EtcdCluster) validateReplicasChange(oldCluster *EtcdCluster) *field.Error {
+	if maxReplicasChange <= 0 || oldCluster.Spec.Replicas == nil || r.Spec.Replicas == nil {
+		return nil
+	}
+	change := *r.Spec.Replicas - *oldCluster.Spec.Replicas
+	if change > maxReplicasChange || change < -maxReplicasChange {
+		return field.Invalid(
+			field.NewPath("spec", "replicas"),
+			*r.Spec.Replicas,
+			fmt.Sprintf("replicas can be changed by at most %d at a time, current value is %d",
+				maxReplicasChange, *oldCluster.Spec.Replicas),
+		)
+	}
+	return nil
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -281,6 +583,53 @@ func (r *EtcdCluster) validateSecurity() field.ErrorList {
 		)
 	}
 
+	if security.TLS.ClientCRLSecret != "" && security.TLS.ClientTrustedCASecret == "" {
+		allErrors = append(allErrors, field.Invalid(
+			field.NewPath("spec", "security", "tls", "clientCRLSecret"),
+			security.TLS.ClientCRLSecret,
+			"certificate revocation list requires client certificate authentication with spec.security.tls.clientTrustedCASecret"),
+		)
+	}
+
+	if security.TLS.ServerIssuerRef != nil && security.TLS.ServerSecret == "" {
+		allErrors = append(allErrors, field.Required(
+			field.NewPath("spec", "security", "tls", "serverSecret"),
+			"secret to store the certificate issued with spec.security.tls.serverIssuerRef is required"),
+		)
+	}
+
+	if len(security.TLS.ExtraSANs) > 0 && security.TLS.ServerIssuerRef == nil {
+		allErrors = append(allErrors, field.Invalid(
+			field.NewPath("spec", "security", "tls", "extraSANs"),
+			security.TLS.ExtraSANs,
+			"extra SANs can be set only for certificates issued with spec.security.tls.serverIssuerRef"),
+		)
+	}
+	for i, san := range security.TLS.ExtraSANs {
+		if net.ParseIP(san) != nil {
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(strings.TrimPrefix(san, "*.")); len(errs) > 0 {
+			allErrors = append(allErrors, field.Invalid(
+				field.NewPath("spec", "security", "tls", "extraSANs").Index(i),
+				san,
+				"must be an IP address or a DNS name: "+strings.Join(errs, "; ")),
+			)
+		}
+	}
+
+	allErrors = append(allErrors, security.TLS.validateCipherSuites()...)
+	allErrors = append(allErrors, r.validateAuth()...)
+	if ptr.Deref(r.Spec.FIPS, false) {
+		for i, suite := range security.TLS.CipherSuites {
+			if !slices.Contains(FIPSCipherSuites, suite) {
+				allErrors = append(allErrors, field.Invalid(
+					field.NewPath("spec", "security", "tls", "cipherSuites").Index(i), suite,
+					"cipher suite is not FIPS-approved"))
+			}
+		}
+	}
+
 	if len(allErrors) > 0 {
 		return allErrors
 	}
@@ -288,6 +637,812 @@ func (r *EtcdCluster) validateSecurity() field.ErrorList {
 	return nil
 }
 
+// validateAuth validates managed users and credential rotation.
+func (r *EtcdCluster) validateAuth() field.ErrorList {
+	auth := r.Spec.Security.Auth
+	if auth == nil {
+		return nil
+	}
+	var allErrors field.ErrorList
+	path := field.NewPath("spec", "security", "auth")
+
+	names := map[string]bool{}
+	secrets := map[string]bool{r.RootCredentialsSecret(): true}
+	for i, user := range auth.Users {
+		switch {
+		case user.Name == "":
+			allErrors = append(allErrors, field.Required(path.Child("users").Index(i).Child("name"), "user name is required"))
+		case user.Name == RootUser:
+			allErrors = append(allErrors, field.Forbidden(path.Child("users").Index(i).Child("name"),
+				"root user is always managed"))
+		case names[user.Name]:
+			allErrors = append(allErrors, field.Duplicate(path.Child("users").Index(i).Child("name"), user.Name))
+		}
+		names[user.Name] = true
+		if user.SecretName != "" && secrets[user.SecretName] {
+			allErrors = append(allErrors, field.Duplicate(path.Child("users").Index(i).Child("secretName"), user.SecretName))
+		}
+		secrets[user.SecretName] = true
+	}
+
+	if auth.Rotation != nil && auth.Rotation.MaxAge.Duration < MinCredentialMaxAge {
+		allErrors = append(allErrors, field.Invalid(path.Child("rotation", "maxAge"), auth.Rotation.MaxAge.Duration.String(),
+			fmt.Sprintf("must be at least %s", MinCredentialMaxAge)))
+	}
+	return allErrors
+}
+
+// validateCipherSuites validates TLS versions and cipher suites passed to etcd.
+func (t *TLSSpec) validateCipherSuites() field.ErrorList {
+	var allErrors field.ErrorList
+	path := field.NewPath("spec", "security", "tls")
+
+	if t.MinVersion != "" && t.MinVersion != TLSVersion12 && t.MinVersion != TLSVersion13 {
+		allErrors = append(allErrors, field.NotSupported(path.Child("minVersion"), t.MinVersion,
+			[]string{TLSVersion12, TLSVersion13}))
+	}
+	if len(t.CipherSuites) > 0 && t.MinVersion == TLSVersion13 {
+		allErrors = append(allErrors, field.Invalid(path.Child("cipherSuites"), t.CipherSuites,
+			"cipher suites cannot be configured when only TLS 1.3 is enabled"))
+	}
+
+	secure := map[string]bool{}
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = true
+	}
+	insecure := map[string]bool{}
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+	for i, suite := range t.CipherSuites {
+		switch {
+		case insecure[suite]:
+			allErrors = append(allErrors, field.Invalid(path.Child("cipherSuites").Index(i), suite,
+				"cipher suite is insecure"))
+		case !secure[suite]:
+			allErrors = append(allErrors, field.Invalid(path.Child("cipherSuites").Index(i), suite,
+				"unknown cipher suite"))
+		}
+	}
+	return allErrors
+}
+
+// validateTuning validates tuned etcd parameters and rejects parameters which are also set in options.
+func (r *EtcdCluster) validateTuning() field.ErrorList {
+	tuning := r.Spec.Tuning
+	if tuning == nil {
+		return nil
+	}
+	var allErrors field.ErrorList
+	path := field.NewPath("spec", "tuning")
+
+	if tuning.MaxRequestBytes != nil && tuning.MaxRequestBytes.Sign() <= 0 {
+		allErrors = append(allErrors, field.Invalid(path.Child("maxRequestBytes"), tuning.MaxRequestBytes.String(),
+			"must be positive"))
+	}
+	durations := []struct {
+		name     string
+		duration *metav1.Duration
+	}{
+		{"grpcKeepaliveMinTime", tuning.GRPCKeepaliveMinTime},
+		{"grpcKeepaliveInterval", tuning.GRPCKeepaliveInterval},
+		{"grpcKeepaliveTimeout", tuning.GRPCKeepaliveTimeout},
+		{"watchProgressNotifyInterval", tuning.WatchProgressNotifyInterval},
+	}
+	for _, d := range durations {
+		if d.duration != nil && d.duration.Duration <= 0 {
+			allErrors = append(allErrors, field.Invalid(path.Child(d.name), d.duration.Duration.String(),
+				"must be positive"))
+		}
+	}
+	etcdVersion := r.EtcdVersion()
+	if tuning.WatchProgressNotifyInterval != nil && etcdVersion != nil &&
+		!etcdVersion.AtLeast(MinWatchProgressNotifyVersion) {
+		allErrors = append(allErrors, field.Forbidden(path.Child("watchProgressNotifyInterval"),
+			fmt.Sprintf("requires etcd %s or newer, image has etcd %s", MinWatchProgressNotifyVersion, etcdVersion)))
+	}
+	for option := range tuning.Options(etcdVersion) {
+		if _, ok := r.Spec.Options[option]; ok {
+			allErrors = append(allErrors, field.Forbidden(field.NewPath("spec", "options").Key(option),
+				"option is set in spec.tuning"))
+		}
+	}
+	return allErrors
+}
+
+// validateLogging validates etcd logs configuration and rejects parameters which are also set in options.
+func (r *EtcdCluster) validateLogging() field.ErrorList {
+	logging := r.Spec.Logging
+	if logging == nil {
+		return nil
+	}
+	var allErrors field.ErrorList
+	path := field.NewPath("spec", "logging")
+
+	if etcdVersion := r.EtcdVersion(); logging.Format != "" && etcdVersion != nil &&
+		!etcdVersion.AtLeast(MinLogFormatVersion) {
+		allErrors = append(allErrors, field.Forbidden(path.Child("format"),
+			fmt.Sprintf("requires etcd %s or newer, image has etcd %s", MinLogFormatVersion, etcdVersion)))
+	}
+	if shipping := logging.Shipping; shipping != nil {
+		if len(logging.Outputs) > 0 {
+			allErrors = append(allErrors, field.Forbidden(path.Child("outputs"),
+				"logs are written to the shipped file only while shipping is enabled"))
+		}
+		if shipping.MaxSize != nil && shipping.MaxSize.Cmp(resource.MustParse("1Mi")) < 0 {
+			allErrors = append(allErrors, field.Invalid(path.Child("shipping", "maxSize"), shipping.MaxSize.String(),
+				"must be at least 1Mi"))
+		}
+		if name := shipping.Container.Name; name == "etcd" || name == "agent" || name == "restore" {
+			allErrors = append(allErrors, field.Invalid(path.Child("shipping", "container", "name"), name,
+				"name is used by a container of the operator"))
+		}
+	}
+	for option := range logging.Options() {
+		if _, ok := r.Spec.Options[option]; ok {
+			allErrors = append(allErrors, field.Forbidden(field.NewPath("spec", "options").Key(option),
+				"option is set in spec.logging"))
+		}
+	}
+	return allErrors
+}
+
+// validateStartup validates the startup timeout of members.
+func (r *EtcdCluster) validateStartup() *field.Error {
+	if r.Spec.Startup == nil || r.Spec.Startup.Timeout == nil || r.Spec.Startup.Timeout.Duration > 0 {
+		return nil
+	}
+	return field.Invalid(field.NewPath("spec", "startup", "timeout"), r.Spec.Startup.Timeout.Duration.String(),
+		"must be positive")
+}
+
+// validateReadOnly requires authentication managed by the operator for the read-only mode, which revokes roles
+// of users.
+func (r *EtcdCluster) validateReadOnly() *field.Error {
+	if !r.Spec.ReadOnly || (r.Spec.Security != nil && r.Spec.Security.Auth != nil) {
+		return nil
+	}
+	return field.Forbidden(field.NewPath("spec", "readOnly"), "requires spec.security.auth")
+}
+
+// validateNotifications validates URLs of notification sinks.
+func (r *EtcdCluster) validateNotifications() field.ErrorList {
+	return ValidateNotificationSinks(field.NewPath("spec", "notifications"), r.Spec.Notifications)
+}
+
+// ValidateNotificationSinks checks that every sink has either a URL or a reference to a Secret with the URL.
+func ValidateNotificationSinks(path *field.Path, sinks []NotificationSink) field.ErrorList {
+	var allErrors field.ErrorList
+	for i, sink := range sinks {
+		switch {
+		case sink.URL != "" && sink.URLSecretRef != nil:
+			allErrors = append(allErrors, field.Forbidden(path.Index(i).Child("urlSecretRef"), "url and urlSecretRef are mutually exclusive"))
+		case sink.URLSecretRef != nil:
+			if sink.URLSecretRef.Name == "" || sink.URLSecretRef.Key == "" {
+				allErrors = append(allErrors, field.Required(path.Index(i).Child("urlSecretRef"), "secret name and key must be specified"))
+			}
+		case sink.URL == "":
+			allErrors = append(allErrors, field.Required(path.Index(i).Child("url"), "url or urlSecretRef must be specified"))
+		default:
+			if u, err := url.Parse(sink.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				allErrors = append(allErrors, field.Invalid(path.Index(i).Child("url"), sink.URL, "must be an http or https URL"))
+			}
+		}
+	}
+	return allErrors
+}
+
+// validateKeyUsage validates the interval between key usage reports and key quotas.
+func (r *EtcdCluster) validateKeyUsage() field.ErrorList {
+	usage := r.Spec.KeyUsage
+	if usage == nil {
+		return nil
+	}
+	var allErrors field.ErrorList
+	path := field.NewPath("spec", "keyUsage")
+	if usage.Interval.Duration < 0 {
+		allErrors = append(allErrors, field.Invalid(path.Child("interval"), usage.Interval.Duration.String(),
+			"must not be negative"))
+	}
+	for i, quota := range usage.Quotas {
+		if quota.MaxKeys == nil && quota.MaxBytes == nil {
+			allErrors = append(allErrors, field.Required(path.Child("quotas").Index(i),
+				"either maxKeys or maxBytes is required"))
+		}
+		if quota.MaxBytes != nil && quota.MaxBytes.Sign() < 0 {
+			allErrors = append(allErrors, field.Invalid(path.Child("quotas").Index(i).Child("maxBytes"),
+				quota.MaxBytes.String(), "must not be negative"))
+		}
+		if len(quota.FreezeUsers) > 0 && (r.Spec.Security == nil || r.Spec.Security.Auth == nil) {
+			allErrors = append(allErrors, field.Forbidden(path.Child("quotas").Index(i).Child("freezeUsers"),
+				"requires spec.security.auth"))
+		}
+		if j := slices.Index(quota.FreezeUsers, RootUser); j != -1 {
+			allErrors = append(allErrors, field.Invalid(path.Child("quotas").Index(i).Child("freezeUsers").Index(j),
+				RootUser, "root user can't be frozen"))
+		}
+	}
+	return allErrors
+}
+
+// validateSecurityContext validates that the user and groups members run as are not set in the pod template as well,
+// and that members running as non-root can write their data. The etcd images run as root and their data directory
+// is on a volume owned by root, except emptyDir volumes which are writable by any user.
+func (r *EtcdCluster) validateSecurityContext() field.ErrorList {
+	securityContext := r.Spec.SecurityContext
+	if securityContext == nil {
+		return nil
+	}
+	var allErrors field.ErrorList
+	path := field.NewPath("spec", "securityContext")
+	if podSecurityContext := r.Spec.PodTemplate.Spec.SecurityContext; podSecurityContext != nil {
+		templatePath := field.NewPath("spec", "podTemplate", "spec", "securityContext")
+		for _, f := range []struct {
+			name              string
+			value, inTemplate *int64
+		}{
+			{"runAsUser", securityContext.RunAsUser, podSecurityContext.RunAsUser},
+			{"runAsGroup", securityContext.RunAsGroup, podSecurityContext.RunAsGroup},
+			{"fsGroup", securityContext.FSGroup, podSecurityContext.FSGroup},
+		} {
+			if f.value != nil && f.inTemplate != nil {
+				allErrors = append(allErrors, field.Forbidden(path.Child(f.name),
+					fmt.Sprintf("cannot be set together with %s", templatePath.Child(f.name))))
+			}
+		}
+		if securityContext.RunAsUser != nil && !securityContext.NonRoot() && ptr.Deref(podSecurityContext.RunAsNonRoot, false) {
+			allErrors = append(allErrors, field.Invalid(path.Child("runAsUser"), *securityContext.RunAsUser,
+				fmt.Sprintf("root user conflicts with %s", templatePath.Child("runAsNonRoot"))))
+		}
+	}
+	if securityContext.NonRoot() && r.Spec.Storage.EmptyDir == nil && securityContext.FSGroup == nil {
+		allErrors = append(allErrors, field.Required(path.Child("fsGroup"),
+			"members running as non-root user require fsGroup to write data on persistent volumes"))
+	}
+	return allErrors
+}
+
+// validateOpenShift validates that members don't run as root, which is only admitted by the anyuid security
+// context constraints, and that TLS is configured for the Route and the service CA.
+func (r *EtcdCluster) validateOpenShift() field.ErrorList {
+	openShift := r.Spec.OpenShift
+	if openShift == nil {
+		return nil
+	}
+	var allErrors field.ErrorList
+	path := field.NewPath("spec", "openShift")
+	if securityContext := r.Spec.SecurityContext; securityContext != nil && securityContext.RunAsUser != nil && !securityContext.NonRoot() {
+		allErrors = append(allErrors, field.Invalid(field.NewPath("spec", "securityContext", "runAsUser"),
+			*securityContext.RunAsUser, "members cannot run as root on OpenShift without the anyuid security context constraints"))
+	}
+	var tls TLSSpec
+	if r.Spec.Security != nil {
+		tls = r.Spec.Security.TLS
+	}
+	if openShift.Route != nil && tls.ServerSecret == "" {
+		allErrors = append(allErrors, field.Invalid(path.Child("route"), openShift.Route,
+			"route passes clients through to members, so it requires spec.security.tls.serverSecret"))
+	}
+	if openShift.ServiceCA {
+		if tls.ServerSecret == "" {
+			allErrors = append(allErrors, field.Required(field.NewPath("spec", "security", "tls", "serverSecret"),
+				"service CA issues the server certificate into the server secret"))
+		}
+		if tls.ServerIssuerRef != nil {
+			allErrors = append(allErrors, field.Forbidden(path.Child("serviceCA"),
+				"cannot be used together with spec.security.tls.serverIssuerRef"))
+		}
+	}
+	return allErrors
+}
+
+// validateImageArchitectures checks that the etcd image is built for the cluster architectures with the configured
+// lookup. It is done on creation and on changes of the image or the architectures only, as the lookup requests
+// the image registry. Failed lookups are reported as warnings, so clusters can be created while the registry
+// is unreachable or requires credentials.
+func (r *EtcdCluster) validateImageArchitectures(oldCluster *EtcdCluster) (admission.Warnings, *field.Error) {
+	if len(r.Spec.Architectures) == 0 || imageArchitecturesLookup == nil {
+		return nil, nil
+	}
+	image := r.EtcdImage()
+	if oldCluster != nil && oldCluster.EtcdImage() == image &&
+		slices.Equal(oldCluster.Spec.Architectures, r.Spec.Architectures) {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), imageArchitecturesTimeout)
+	defer cancel()
+	imageArchitectures, err := imageArchitecturesLookup(ctx, image)
+	if err != nil {
+		return admission.Warnings{fmt.Sprintf("architectures of image %s are not checked: %v", image, err)}, nil
+	}
+	var missing []string
+	for _, arch := range r.Spec.Architectures {
+		if !slices.Contains(imageArchitectures, string(arch)) {
+			missing = append(missing, string(arch))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, field.Invalid(field.NewPath("spec", "architectures"), r.Spec.Architectures,
+			fmt.Sprintf("image %s is not built for %s", image, strings.Join(missing, ", ")))
+	}
+	return nil, nil
+}
+
+// validateProbes validates the interval of etcd API probes.
+func (r *EtcdCluster) validateProbes() *field.Error {
+	if r.Spec.Probes == nil || r.Spec.Probes.Interval == nil || r.Spec.Probes.Interval.Duration >= 0 {
+		return nil
+	}
+	return field.Invalid(field.NewPath("spec", "probes", "interval"), r.Spec.Probes.Interval.Duration.String(),
+		"value cannot be negative")
+}
+
+// validateEtcdAPI validates timeouts of etcd API requests.
+func (r *EtcdCluster) validateEtcdAPI() field.ErrorList {
+	api := r.Spec.EtcdAPI
+	if api == nil {
+		return nil
+	}
+	var openDuration *metav1.Duration
+	if api.CircuitBreaker != nil {
+		openDuration = api.CircuitBreaker.OpenDuration
+	}
+	var allErrors field.ErrorList
+	path := field.NewPath("spec", "etcdAPI")
+	for _, d := range []struct {
+		path     *field.Path
+		duration *metav1.Duration
+	}{
+		{path: path.Child("dialTimeout"), duration: api.DialTimeout},
+		{path: path.Child("memberTimeout"), duration: api.MemberTimeout},
+		{path: path.Child("requestTimeout"), duration: api.RequestTimeout},
+		{path: path.Child("circuitBreaker", "openDuration"), duration: openDuration},
+	} {
+		if d.duration != nil && d.duration.Duration <= 0 {
+			allErrors = append(allErrors, field.Invalid(d.path, d.duration.Duration.String(), "value must be positive"))
+		}
+	}
+	return allErrors
+}
+
+// validateStorage validates storage fields
+func (r *EtcdCluster) validateStorage() field.ErrorList {
+	var allErrors field.ErrorList
+
+	if r.Spec.Storage.EmptyDir != nil && r.Spec.Storage.WALVolumeClaimTemplate != nil {
+		allErrors = append(allErrors, field.Invalid(
+			field.NewPath("spec", "storage", "walVolumeClaimTemplate"),
+			r.Spec.Storage.WALVolumeClaimTemplate,
+			"dedicated WAL volume cannot be used together with emptyDir"),
+		)
+	}
+	if wal := r.Spec.Storage.WALVolumeClaimTemplate; wal != nil {
+		dataName, walName := "data", "wal"
+		if name := r.Spec.Storage.VolumeClaimTemplate.Name; name != "" {
+			dataName = name
+		}
+		if wal.Name != "" {
+			walName = wal.Name
+		}
+		if walName == dataName {
+			allErrors = append(allErrors, field.Invalid(
+				field.NewPath("spec", "storage", "walVolumeClaimTemplate", "metadata", "name"),
+				walName,
+				"WAL volume claim template must have a name different from the data volume claim template"),
+			)
+		}
+		for i, c := range r.Spec.PodTemplate.Spec.Containers {
+			if c.Name != "etcd" {
+				continue
+			}
+			for j, mount := range c.VolumeMounts {
+				if strings.TrimRight(mount.MountPath, "/") == "/var/run/etcd-wal" {
+					allErrors = append(allErrors, field.Forbidden(
+						field.NewPath("spec", "podTemplate", "spec", "containers").Index(i).
+							Child("volumeMounts").Index(j).Child("mountPath"),
+						"mount path is used by the dedicated WAL volume"),
+					)
+				}
+			}
+		}
+	}
+
+	return allErrors
+}
+
+// validateBackup validates periodic backup fields
+func (r *EtcdCluster) validateBackup() field.ErrorList {
+	if r.Spec.Backup == nil {
+		return nil
+	}
+	var allErrors field.ErrorList
+	backupPath := field.NewPath("spec", "backup")
+
+	allErrors = append(allErrors, validateBackupDestination(backupPath.Child("destination"), &r.Spec.Backup.Destination)...)
+	for i := range r.Spec.Backup.AdditionalDestinations {
+		destination := &r.Spec.Backup.AdditionalDestinations[i]
+		path := backupPath.Child("additionalDestinations").Index(i)
+		allErrors = append(allErrors, validateBackupDestination(path, destination)...)
+		for _, previous := range r.Spec.Backup.AllDestinations()[:i+1] {
+			if id := destinationID(destination); id != "" && destinationID(previous) == id {
+				allErrors = append(allErrors, field.Duplicate(path, id))
+				break
+			}
+		}
+	}
+
+	if r.Spec.Backup.Interval.Duration < 0 {
+		allErrors = append(allErrors, field.Invalid(
+			backupPath.Child("interval"),
+			r.Spec.Backup.Interval.Duration.String(),
+			"value cannot be negative"),
+		)
+	}
+	if schedule := r.Spec.Backup.VerificationSchedule; schedule != nil && schedule.Interval.Duration < 0 {
+		allErrors = append(allErrors, field.Invalid(
+			backupPath.Child("verificationSchedule", "interval"),
+			schedule.Interval.Duration.String(),
+			"value cannot be negative"),
+		)
+	}
+	if retention := r.Spec.Backup.Retention; retention != nil && retention.MaxAge != nil {
+		if maxAge := retention.MaxAge.Duration; maxAge <= 0 {
+			allErrors = append(allErrors, field.Invalid(backupPath.Child("retention", "maxAge"), maxAge.String(),
+				"value must be positive"))
+		} else if maxAge < r.Spec.Backup.Interval.Duration {
+			allErrors = append(allErrors, field.Invalid(backupPath.Child("retention", "maxAge"), maxAge.String(),
+				"value cannot be less than the backup interval"))
+		}
+	}
+	if template := r.Spec.Backup.KeyTemplate; template != "" {
+		if err := validateSnapshotPlaceholders(template); err != "" {
+			allErrors = append(allErrors, field.Invalid(backupPath.Child("keyTemplate"), template, err))
+		} else if !strings.Contains(template, "{timestamp}") || strings.HasPrefix(template, "/") {
+			allErrors = append(allErrors, field.Invalid(backupPath.Child("keyTemplate"), template,
+				"must be a relative key containing {timestamp}"))
+		}
+	}
+	for name, value := range r.Spec.Backup.Tags {
+		if err := validateSnapshotPlaceholders(value); err != "" {
+			allErrors = append(allErrors, field.Invalid(backupPath.Child("tags").Key(name), value, err))
+		}
+	}
+	if r.Spec.Backup.AutoRestore != nil && r.Spec.Storage.EmptyDir == nil {
+		allErrors = append(allErrors, field.Invalid(
+			backupPath.Child("autoRestore"),
+			r.Spec.Backup.AutoRestore,
+			"automatic restore can only be used together with emptyDir storage"),
+		)
+	}
+
+	return allErrors
+}
+
+// snapshotPlaceholder matches placeholders of snapshot key and tag templates.
+var snapshotPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// validateSnapshotPlaceholders returns the reason the snapshot key or tag template is invalid, if it contains
+// unknown placeholders.
+func validateSnapshotPlaceholders(template string) string {
+	for _, match := range snapshotPlaceholder.FindAllStringSubmatch(template, -1) {
+		switch match[1] {
+		case "namespace", "cluster", "timestamp", "revision":
+		default:
+			return fmt.Sprintf("unknown placeholder %s, expected {namespace}, {cluster}, {timestamp} or {revision}", match[0])
+		}
+	}
+	return ""
+}
+
+// validateVelero validates that snapshots taken before Velero backups have a destination to be stored in.
+func (r *EtcdCluster) validateVelero() *field.Error {
+	if r.Spec.Velero == nil || !r.Spec.Velero.Quiesce || r.Spec.Backup != nil {
+		return nil
+	}
+	return field.Invalid(
+		field.NewPath("spec", "velero", "quiesce"),
+		r.Spec.Velero.Quiesce,
+		"quiesce requires backups to be configured")
+}
+
+// validatePorts validates that members listen on different ports.
+func (r *EtcdCluster) validatePorts() *field.Error {
+	if r.ClientPort() == r.PeerPort() || r.ClientPort() == r.MetricsPort() || r.PeerPort() == r.MetricsPort() {
+		return field.Invalid(
+			field.NewPath("spec", "ports"),
+			r.Spec.Ports,
+			"client, peer and metrics ports must be different")
+	}
+	return nil
+}
+
+// validateClientURLs validates that additional client URLs are URLs of the scheme members serve clients with.
+// Placeholders of pod fields are replaced before parsing.
+func (r *EtcdCluster) validateClientURLs() field.ErrorList {
+	if r.Spec.ClientURLs == nil {
+		return nil
+	}
+	scheme := "http"
+	if r.Spec.Security != nil && r.Spec.Security.TLS.ServerSecret != "" {
+		scheme = "https"
+	}
+	placeholders := strings.NewReplacer("$(POD_NAME)", "pod", "$(POD_NAMESPACE)", "namespace")
+	var allErrors field.ErrorList
+	for _, urls := range []struct {
+		path *field.Path
+		urls []string
+	}{
+		{path: field.NewPath("spec", "clientURLs", "advertise"), urls: r.Spec.ClientURLs.Advertise},
+		{path: field.NewPath("spec", "clientURLs", "listen"), urls: r.Spec.ClientURLs.Listen},
+	} {
+		for i, raw := range urls.urls {
+			u, err := url.Parse(placeholders.Replace(raw))
+			switch {
+			case err != nil || u.Host == "":
+				allErrors = append(allErrors, field.Invalid(urls.path.Index(i), raw, "must be a URL with a host"))
+			case u.Scheme != scheme:
+				allErrors = append(allErrors, field.Invalid(urls.path.Index(i), raw,
+					fmt.Sprintf("scheme must be %s, as members serve clients with it", scheme)))
+			}
+		}
+	}
+	return allErrors
+}
+
+// validateIntegration validates that certificates copied to the kubeadm-compatible client Secret are configured.
+func (r *EtcdCluster) validateIntegration() *field.Error {
+	if r.Spec.Integration == nil || !r.Spec.Integration.KubeadmClientSecret {
+		return nil
+	}
+	if r.Spec.Security == nil || r.Spec.Security.TLS.ServerSecret == "" || r.Spec.Security.TLS.ClientSecret == "" {
+		return field.Invalid(
+			field.NewPath("spec", "integration", "kubeadmClientSecret"),
+			r.Spec.Integration.KubeadmClientSecret,
+			"kubeadm client secret requires server and client certificates to be configured")
+	}
+	return nil
+}
+
+// validateRestoreRequest validates that the cluster requested to be restored with RestoreFromAnnotation
+// has snapshots to restore from and data volumes to restore them to.
+func (r *EtcdCluster) validateRestoreRequest() *field.Error {
+	key, ok := r.Annotations[RestoreFromAnnotation]
+	if !ok {
+		return nil
+	}
+	path := field.NewPath("metadata", "annotations").Key(RestoreFromAnnotation)
+	switch {
+	case key == "":
+		return field.Required(path, "snapshot key or latest must be specified")
+	case r.Spec.Backup == nil:
+		return field.Invalid(path, key, "restore requires backups to be configured")
+	case r.Spec.Storage.EmptyDir != nil:
+		return field.Invalid(path, key, "emptyDir storage is restored automatically, restore can only be requested "+
+			"for clusters with persistent storage")
+	}
+	return nil
+}
+
+// validateBootstrap validates that the cluster bootstrapped with BootstrapFromAnnotation has backups
+// to restore the snapshot from.
+func (r *EtcdCluster) validateBootstrap() *field.Error {
+	key, ok := r.Annotations[BootstrapFromAnnotation]
+	if !ok {
+		return nil
+	}
+	path := field.NewPath("metadata", "annotations").Key(BootstrapFromAnnotation)
+	switch {
+	case key == "":
+		return field.Required(path, "snapshot key must be specified")
+	case r.Spec.Backup == nil:
+		return field.Invalid(path, key, "bootstrap from a snapshot requires backups to be configured")
+	}
+	return nil
+}
+
+// validateRotation validates that members are rotated only in clusters keeping quorum while a member is replaced.
+func (r *EtcdCluster) validateRotation() field.ErrorList {
+	if r.Spec.Rotation == nil {
+		return nil
+	}
+	var allErrors field.ErrorList
+	rotationPath := field.NewPath("spec", "rotation")
+	if r.Spec.Rotation.MaxAge.Duration <= 0 {
+		allErrors = append(allErrors, field.Invalid(
+			rotationPath.Child("maxAge"),
+			r.Spec.Rotation.MaxAge.Duration.String(),
+			"value must be positive"),
+		)
+	}
+	if r.Spec.Rotation.MinInterval.Duration < 0 {
+		allErrors = append(allErrors, field.Invalid(
+			rotationPath.Child("minInterval"),
+			r.Spec.Rotation.MinInterval.Duration.String(),
+			"value cannot be negative"),
+		)
+	}
+	if r.Spec.Replicas != nil && *r.Spec.Replicas < MinRotationReplicas {
+		allErrors = append(allErrors, field.Invalid(
+			rotationPath,
+			*r.Spec.Replicas,
+			fmt.Sprintf("members can only be rotated in clusters of at least %d members", MinRotationReplicas)),
+		)
+	}
+	return allErrors
+}
+
+// serviceMeshWarnings warns about init containers and Jobs of clusters with backups, which cannot reach
+// the backup storage through a proxy started after them and never complete while the proxy runs.
+func (r *EtcdCluster) serviceMeshWarnings() admission.Warnings {
+	if r.Spec.ServiceMesh == nil || r.Spec.ServiceMesh.NativeSidecars || r.Spec.Backup == nil {
+		return nil
+	}
+	return admission.Warnings{"snapshots are restored and verified by init containers and Jobs, " +
+		"which need spec.serviceMesh.nativeSidecars to work with the mesh proxy"}
+}
+
+// validateAutoscaling validates the autoscaling bounds and that snapshots required before replica changes are taken.
+func (r *EtcdCluster) validateAutoscaling() field.ErrorList {
+	if r.Spec.Autoscaling == nil {
+		return nil
+	}
+	var allErrors field.ErrorList
+	autoscalingPath := field.NewPath("spec", "autoscaling")
+	if r.Spec.Autoscaling.MaxReplicas < r.Spec.Autoscaling.MinReplicas {
+		allErrors = append(allErrors, field.Invalid(
+			autoscalingPath.Child("maxReplicas"),
+			r.Spec.Autoscaling.MaxReplicas,
+			"value cannot be less than minReplicas"),
+		)
+	}
+	if r.Spec.Backup == nil {
+		allErrors = append(allErrors, field.Invalid(
+			autoscalingPath,
+			r.Spec.Autoscaling,
+			"autoscaling requires backups to be configured"),
+		)
+	}
+	if window := r.Spec.Autoscaling.MaintenanceWindow; window != nil {
+		if _, err := time.Parse("15:04", window.Start); err != nil {
+			allErrors = append(allErrors, field.Invalid(
+				autoscalingPath.Child("maintenanceWindow", "start"),
+				window.Start,
+				"value must be a time of day in the HH:MM format"),
+			)
+		}
+		if window.Duration.Duration <= 0 || window.Duration.Duration > 24*time.Hour {
+			allErrors = append(allErrors, field.Invalid(
+				autoscalingPath.Child("maintenanceWindow", "duration"),
+				window.Duration.Duration.String(),
+				"value must be positive and not longer than 24h"),
+			)
+		}
+	}
+	return allErrors
+}
+
+// destinationID identifies the storage of the backup destination.
+func destinationID(destination *BackupDestination) string {
+	switch {
+	case destination.S3 != nil:
+		return "s3://" + destination.S3.Bucket + "/" + destination.S3.Prefix
+	case destination.GCS != nil:
+		return "gs://" + destination.GCS.Bucket + "/" + destination.GCS.Prefix
+	case destination.AzureBlob != nil && destination.AzureBlob.Account != "":
+		// the account can be set in the connection string only
+		return "azblob://" + destination.AzureBlob.Account + "/" + destination.AzureBlob.Container + "/" +
+			destination.AzureBlob.Prefix
+	case destination.Restic != nil:
+		return destination.Restic.Repository
+	}
+	return ""
+}
+
+// validateBackupDestination validates that exactly one storage is configured for backups.
+func validateBackupDestination(path *field.Path, destination *BackupDestination) field.ErrorList {
+	var allErrors field.ErrorList
+	storages := 0
+	for _, set := range []bool{
+		destination.S3 != nil, destination.GCS != nil, destination.AzureBlob != nil,
+		destination.Restic != nil, destination.Provider != nil,
+	} {
+		if set {
+			storages++
+		}
+	}
+	if encryption := destination.Encryption; encryption != nil && (encryption.KeyRef.Name == "" || encryption.KeyRef.Key == "") {
+		allErrors = append(allErrors, field.Required(path.Child("encryption", "keyRef"), "secret name and key must be specified"))
+	}
+	switch {
+	case storages > 1:
+		return append(allErrors, field.Forbidden(path, "only one backup storage can be specified"))
+	case destination.Provider != nil:
+		if destination.Provider.Name == "" {
+			allErrors = append(allErrors, field.Required(path.Child("provider", "name"), "provider name must be specified"))
+		}
+		return allErrors
+	case destination.GCS != nil:
+		if destination.GCS.Bucket == "" {
+			allErrors = append(allErrors, field.Required(path.Child("gcs", "bucket"), "bucket name must be specified"))
+		}
+		return allErrors
+	case destination.AzureBlob != nil:
+		if destination.AzureBlob.Container == "" {
+			allErrors = append(allErrors, field.Required(path.Child("azureBlob", "container"),
+				"container name must be specified"))
+		}
+		if destination.AzureBlob.Account == "" && destination.AzureBlob.CredentialsSecret == "" {
+			allErrors = append(allErrors, field.Required(path.Child("azureBlob", "account"),
+				"account name must be specified for managed identities"))
+		}
+		if destination.AzureBlob.ClientID != "" && destination.AzureBlob.CredentialsSecret != "" {
+			allErrors = append(allErrors, field.Forbidden(path.Child("azureBlob", "clientID"),
+				"managed identity can't be selected together with credentials secret"))
+		}
+		return allErrors
+	case destination.Restic != nil:
+		if destination.Restic.Repository == "" {
+			allErrors = append(allErrors, field.Required(path.Child("restic", "repository"), "repository must be specified"))
+		}
+		if destination.Restic.CredentialsSecret == "" {
+			allErrors = append(allErrors, field.Required(path.Child("restic", "credentialsSecret"),
+				"credentials secret with the repository password must be specified"))
+		}
+		return allErrors
+	case destination.S3 == nil:
+		return append(allErrors, field.Required(path, "backup storage must be specified"))
+	}
+	if destination.S3.Bucket == "" {
+		allErrors = append(allErrors, field.Required(path.Child("s3", "bucket"), "bucket name must be specified"))
+	}
+	if destination.S3.CredentialsSecret == "" && (destination.S3.AccessKeyIDRef == nil || destination.S3.SecretAccessKeyRef == nil) {
+		allErrors = append(allErrors, field.Required(path.Child("s3", "credentialsSecret"),
+			"credentials secret must be specified unless both accessKeyIDRef and secretAccessKeyRef are set"))
+	}
+	for _, ref := range []struct {
+		name     string
+		selector *corev1.SecretKeySelector
+	}{
+		{name: "accessKeyIDRef", selector: destination.S3.AccessKeyIDRef},
+		{name: "secretAccessKeyRef", selector: destination.S3.SecretAccessKeyRef},
+		{name: "sessionTokenRef", selector: destination.S3.SessionTokenRef},
+		{name: "caBundleRef", selector: destination.S3.CABundleRef},
+	} {
+		if ref.selector != nil && (ref.selector.Name == "" || ref.selector.Key == "") {
+			allErrors = append(allErrors, field.Required(path.Child("s3", ref.name), "secret name and key must be specified"))
+		}
+	}
+	if endpoint := destination.S3.Endpoint; endpoint != "" {
+		if err := validateS3Endpoint(endpoint); err != nil {
+			allErrors = append(allErrors, field.Invalid(path.Child("s3", "endpoint"), endpoint, err.Error()))
+		}
+	}
+	if destination.S3.InsecureSkipVerify && destination.S3.CABundleRef != nil {
+		allErrors = append(allErrors, field.Forbidden(path.Child("s3", "insecureSkipVerify"),
+			"certificate verification can't be disabled together with caBundleRef"))
+	}
+	return allErrors
+}
+
+// validateS3Endpoint validates that the endpoint is a host with an optional port and http or https scheme.
+func validateS3Endpoint(endpoint string) error {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	switch {
+	case err != nil:
+		return err
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("scheme must be http or https")
+	case u.Host == "":
+		return fmt.Errorf("host must be specified")
+	case strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.User != nil:
+		return fmt.Errorf("endpoint must not have a path, query or user info")
+	}
+	return nil
+}
+
 func validateOptions(cluster *EtcdCluster) error {
 	if len(cluster.Spec.Options) == 0 {
 		return nil
@@ -303,6 +1458,9 @@ func validateOptions(cluster *EtcdCluster) error {
 		"peer-auto-tls":               {},
 		"advertise-client-urls":       {},
 	}
+	if cluster.Spec.Storage.WALVolumeClaimTemplate != nil {
+		systemflags["wal-dir"] = struct{}{}
+	}
 
 	errlist := []error{}
 
@@ -17,11 +17,16 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/utils/ptr"
@@ -75,6 +80,28 @@ var _ = Describe("EtcdCluster Webhook", func() {
 				Expect(*storage).To(Equal(resource.MustParse("10Gi")))
 			}
 		})
+
+		It("Should default the server certificate issuer reference", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Security: &SecuritySpec{TLS: TLSSpec{
+						ServerSecret:    "server-tls",
+						ServerIssuerRef: &IssuerReference{Name: "ca"},
+					}},
+				},
+			}
+			etcdCluster.Default()
+			Expect(*etcdCluster.Spec.Security.TLS.ServerIssuerRef).To(Equal(IssuerReference{
+				Name: "ca", Kind: DefaultIssuerKind, Group: DefaultIssuerGroup,
+			}))
+		})
+
+		It("Should default the endpoints mode", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{Endpoints: &EndpointsSpec{}}}
+			etcdCluster.Default()
+			Expect(etcdCluster.Spec.Endpoints.Mode).To(Equal(EndpointsModeSelector))
+			Expect(etcdCluster.ManagedEndpoints()).To(BeFalse())
+		})
 	})
 
 	Context("When creating EtcdCluster under Validating Webhook", func() {
@@ -129,88 +156,1299 @@ var _ = Describe("EtcdCluster Webhook", func() {
 		})
 	})
 
-	Context("Validate Security", func() {
-		etcdCluster := &EtcdCluster{
-			Spec: EtcdClusterSpec{
-				Replicas: ptr.To(int32(3)),
-				Security: &SecuritySpec{},
-			},
+	Context("When changing replicas", func() {
+		clusterWithReplicas := func(replicas int32) *EtcdCluster {
+			return &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(replicas),
+					Storage:  StorageSpec{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+				},
+			}
 		}
-		It("Should admit enabled empty security", func() {
-			localCluster := etcdCluster.DeepCopy()
-			err := localCluster.validateSecurity()
-			Expect(err).To(BeNil())
+
+		It("Should allow adding or removing a single member", func() {
+			_, err := clusterWithReplicas(4).ValidateUpdate(clusterWithReplicas(3))
+			Expect(err).To(Succeed())
+			_, err = clusterWithReplicas(2).ValidateUpdate(clusterWithReplicas(3))
+			Expect(err).To(Succeed())
 		})
 
-		It("Should reject if only one peer secret is defined", func() {
-			localCluster := etcdCluster.DeepCopy()
-			localCluster.Spec.Security.TLS = TLSSpec{
-				PeerTrustedCASecret: "test-peer-ca-cert",
+		It("Should reject adding or removing several members at once", func() {
+			_, err := clusterWithReplicas(7).ValidateUpdate(clusterWithReplicas(3))
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("spec.replicas"))
 			}
-			err := localCluster.validateSecurity()
-			if Expect(err).NotTo(BeNil()) {
-				expectedFieldErr := field.Invalid(
-					field.NewPath("spec", "security", "tls"),
-					localCluster.Spec.Security.TLS,
-					"both spec.security.tls.peerSecret and spec.security.tls.peerTrustedCASecret must be filled or empty",
-				)
-				if Expect(err).To(HaveLen(1)) {
-					Expect(*(err[0])).To(Equal(*expectedFieldErr))
-				}
+			_, err = clusterWithReplicas(1).ValidateUpdate(clusterWithReplicas(3))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should respect configured limit", func() {
+			DeferCleanup(SetMaxReplicasChange, int32(DefaultMaxReplicasChange))
+
+			SetMaxReplicasChange(2)
+			_, err := clusterWithReplicas(5).ValidateUpdate(clusterWithReplicas(3))
+			Expect(err).To(Succeed())
+			_, err = clusterWithReplicas(6).ValidateUpdate(clusterWithReplicas(3))
+			Expect(err).To(HaveOccurred())
+
+			SetMaxReplicasChange(0)
+			_, err = clusterWithReplicas(7).ValidateUpdate(clusterWithReplicas(3))
+			Expect(err).To(Succeed())
+		})
+	})
+
+	Context("When using dedicated WAL volume", func() {
+		It("Should default WAL volume claim template", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Storage: StorageSpec{WALVolumeClaimTemplate: &EmbeddedPersistentVolumeClaim{}},
+				},
+			}
+			etcdCluster.Default()
+			wal := etcdCluster.Spec.Storage.WALVolumeClaimTemplate
+			Expect(wal.Spec.AccessModes).To(Equal([]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}))
+			storage := wal.Spec.Resources.Requests.Storage()
+			if Expect(storage).NotTo(BeNil()) {
+				Expect(*storage).To(Equal(resource.MustParse("1Gi")))
 			}
 		})
 
-		It("Should reject if only one peer secret is defined", func() {
-			localCluster := etcdCluster.DeepCopy()
-			localCluster.Spec.Security.TLS = TLSSpec{
-				PeerSecret: "test-peer-cert",
+		It("Should reject WAL volume together with emptyDir", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(1)),
+					Storage: StorageSpec{
+						EmptyDir:               &corev1.EmptyDirVolumeSource{},
+						WALVolumeClaimTemplate: &EmbeddedPersistentVolumeClaim{},
+					},
+				},
 			}
-			err := localCluster.validateSecurity()
-			if Expect(err).NotTo(BeNil()) {
-				expectedFieldErr := field.Invalid(
-					field.NewPath("spec", "security", "tls"),
-					localCluster.Spec.Security.TLS,
-					"both spec.security.tls.peerSecret and spec.security.tls.peerTrustedCASecret must be filled or empty",
-				)
-				if Expect(err).To(HaveLen(1)) {
-					Expect(*(err[0])).To(Equal(*expectedFieldErr))
-				}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("dedicated WAL volume cannot be used together with emptyDir"))
 			}
 		})
 
-		It("Should reject if only one client secret is defined", func() {
-			localCluster := etcdCluster.DeepCopy()
-			localCluster.Spec.Security.TLS = TLSSpec{
-				ClientTrustedCASecret: "test-client-ca-cert",
+		It("Should reject wal-dir in options when WAL volume is set", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(1)),
+					Options:  map[string]string{"wal-dir": "/tmp"},
+					Storage:  StorageSpec{WALVolumeClaimTemplate: &EmbeddedPersistentVolumeClaim{}},
+				},
 			}
-			err := localCluster.validateSecurity()
-			if Expect(err).NotTo(BeNil()) {
-				expectedFieldErr := field.Invalid(
-					field.NewPath("spec", "security", "tls"),
-					localCluster.Spec.Security.TLS,
-					"both spec.security.tls.clientSecret and spec.security.tls.clientTrustedCASecret must be filled or empty",
-				)
-				if Expect(err).To(HaveLen(1)) {
-					Expect(*(err[0])).To(Equal(*expectedFieldErr))
-				}
+			_, err := etcdCluster.ValidateCreate()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should reject WAL volume conflicting with the data volume", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(1)),
+					Storage: StorageSpec{
+						VolumeClaimTemplate: EmbeddedPersistentVolumeClaim{
+							EmbeddedObjectMetadata: EmbeddedObjectMetadata{Name: "etcd"},
+						},
+						WALVolumeClaimTemplate: &EmbeddedPersistentVolumeClaim{
+							EmbeddedObjectMetadata: EmbeddedObjectMetadata{Name: "etcd"},
+						},
+					},
+					PodTemplate: PodTemplate{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+						Name:         "etcd",
+						VolumeMounts: []corev1.VolumeMount{{Name: "scratch", MountPath: "/var/run/etcd-wal/"}},
+					}}}},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("name different from the data volume claim template"))
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("mount path is used by the dedicated WAL volume"))
 			}
+
+			etcdCluster.Spec.Storage.WALVolumeClaimTemplate.Name = ""
+			etcdCluster.Spec.PodTemplate.Spec.Containers[0].VolumeMounts[0].MountPath = "/scratch"
+			_, err = etcdCluster.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("Should reject if only one client secret is defined", func() {
-			localCluster := etcdCluster.DeepCopy()
-			localCluster.Spec.Security.TLS = TLSSpec{
-				ClientTrustedCASecret: "test-client-cert",
+		It("Should reject adding WAL volume to existing cluster", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(1)),
+					Storage:  StorageSpec{WALVolumeClaimTemplate: &EmbeddedPersistentVolumeClaim{}},
+				},
 			}
-			err := localCluster.validateSecurity()
-			if Expect(err).NotTo(BeNil()) {
-				expectedFieldErr := field.Invalid(
-					field.NewPath("spec", "security", "tls"),
-					localCluster.Spec.Security.TLS,
-					"both spec.security.tls.clientSecret and spec.security.tls.clientTrustedCASecret must be filled or empty",
-				)
-				if Expect(err).To(HaveLen(1)) {
-					Expect(*(err[0])).To(Equal(*expectedFieldErr))
-				}
+			oldCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(1)),
+				},
+			}
+			_, err := etcdCluster.ValidateUpdate(oldCluster)
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("field is immutable"))
+			}
+		})
+	})
+
+	Context("When configuring Velero integration", func() {
+		It("Should default hook timeout", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{Velero: &VeleroSpec{}}}
+			etcdCluster.Default()
+			Expect(etcdCluster.Spec.Velero.HookTimeout.Duration).To(Equal(DefaultVeleroHookTimeout))
+		})
+
+		It("Should reject quiesce without backups", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Velero:   &VeleroSpec{Quiesce: true},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("quiesce requires backups to be configured"))
+			}
+		})
+	})
+
+	Context("When configuring hosted control plane integration", func() {
+		It("Should reject the kubeadm client secret without client certificate", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas:    ptr.To(int32(3)),
+					Integration: &IntegrationSpec{KubeadmClientSecret: true},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("requires server and client certificates"))
+			}
+		})
+	})
+
+	Context("When configuring ports", func() {
+		It("Should reject equal ports", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Ports:    &PortsSpec{Client: 2380},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("client, peer and metrics ports must be different"))
+			}
+		})
+
+		It("Should reject port changes", func() {
+			oldCluster := &EtcdCluster{Spec: EtcdClusterSpec{Replicas: ptr.To(int32(3))}}
+			etcdCluster := oldCluster.DeepCopy()
+			etcdCluster.Spec.Ports = &PortsSpec{Peer: 12380, Client: 12379}
+			_, err := etcdCluster.ValidateUpdate(oldCluster)
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("spec.ports: Invalid value"))
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("field is immutable"))
+			}
+		})
+	})
+
+	Context("When configuring client URLs", func() {
+		It("Should admit URLs with pod placeholders", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					ClientURLs: &ClientURLsSpec{
+						Advertise: []string{"http://$(POD_NAME).etcd.example.com:2379"},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should reject URLs of another scheme than the server one", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Security: &SecuritySpec{TLS: TLSSpec{ServerSecret: "server"}},
+					ClientURLs: &ClientURLsSpec{
+						Advertise: []string{"http://etcd.example.com:2379"},
+						Listen:    []string{"etcd.example.com"},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("spec.clientURLs.advertise[0]: Invalid value"))
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("scheme must be https"))
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("spec.clientURLs.listen[0]: Invalid value"))
+			}
+		})
+	})
+
+	Context("When configuring member rotation", func() {
+		It("Should default minimum interval", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{Rotation: &MemberRotationSpec{}}}
+			etcdCluster.Default()
+			Expect(etcdCluster.Spec.Rotation.MinInterval.Duration).To(Equal(DefaultRotationMinInterval))
+		})
+
+		It("Should admit rotation of three members", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Rotation: &MemberRotationSpec{MaxAge: metav1.Duration{Duration: 720 * time.Hour}},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should reject rotation of a single member", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(1)),
+					Rotation: &MemberRotationSpec{MaxAge: metav1.Duration{Duration: 720 * time.Hour}},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("members can only be rotated in clusters of at least 3 members"))
+			}
+		})
+	})
+
+	Context("When configuring autoscaling", func() {
+		autoscalingCluster := func(autoscaling *AutoscalingSpec) *EtcdCluster {
+			return &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas:    ptr.To(int32(3)),
+					Backup:      &ClusterBackupSpec{Destination: BackupDestination{S3: &S3Destination{Bucket: "etcd", CredentialsSecret: "s3"}}},
+					Autoscaling: autoscaling,
+				},
+			}
+		}
+
+		It("Should default backup age and scale down delay", func() {
+			etcdCluster := autoscalingCluster(&AutoscalingSpec{MinReplicas: 3, MaxReplicas: 5})
+			etcdCluster.Default()
+			Expect(etcdCluster.Spec.Autoscaling.MaxBackupAge.Duration).To(Equal(DefaultAutoscalingMaxBackupAge))
+			Expect(etcdCluster.Spec.Autoscaling.ScaleDownDelay.Duration).To(Equal(DefaultScaleDownDelay))
+		})
+
+		It("Should reject inverted bounds and invalid maintenance window", func() {
+			etcdCluster := autoscalingCluster(&AutoscalingSpec{
+				MinReplicas:       5,
+				MaxReplicas:       3,
+				MaintenanceWindow: &MaintenanceWindow{Start: "25:00", Duration: metav1.Duration{Duration: time.Hour}},
+			})
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("value cannot be less than minReplicas"))
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("spec.autoscaling.maintenanceWindow.start"))
+			}
+		})
+
+		It("Should reject autoscaling without backups", func() {
+			etcdCluster := autoscalingCluster(&AutoscalingSpec{MinReplicas: 3, MaxReplicas: 5})
+			etcdCluster.Spec.Backup = nil
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("autoscaling requires backups to be configured"))
+			}
+		})
+
+		It("Should check maintenance windows spanning midnight", func() {
+			window := &MaintenanceWindow{Start: "23:00", Duration: metav1.Duration{Duration: 2 * time.Hour}}
+			Expect(window.Contains(time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC))).To(BeTrue())
+			Expect(window.Contains(time.Date(2024, 5, 2, 0, 30, 0, 0, time.UTC))).To(BeTrue())
+			Expect(window.Contains(time.Date(2024, 5, 2, 1, 0, 0, 0, time.UTC))).To(BeFalse())
+			Expect(window.Contains(time.Date(2024, 5, 2, 22, 59, 0, 0, time.UTC))).To(BeFalse())
+		})
+	})
+
+	Context("When running in a service mesh", func() {
+		It("Should default provider and port exclusion", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{ServiceMesh: &ServiceMeshSpec{}}}
+			etcdCluster.Default()
+			Expect(etcdCluster.Spec.ServiceMesh.Provider).To(Equal(ServiceMeshIstio))
+			Expect(etcdCluster.Spec.ServiceMesh.ExcludePorts).To(Equal(ptr.To(true)))
+		})
+
+		It("Should warn about backups without native sidecars", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas:    ptr.To(int32(3)),
+					Backup:      &ClusterBackupSpec{Destination: BackupDestination{S3: &S3Destination{Bucket: "etcd", CredentialsSecret: "s3"}}},
+					ServiceMesh: &ServiceMeshSpec{},
+				},
+			}
+			warnings, err := etcdCluster.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("spec.serviceMesh.nativeSidecars")))
+
+			etcdCluster.Spec.ServiceMesh.NativeSidecars = true
+			warnings, err = etcdCluster.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+	})
+
+	Context("When tuning etcd parameters", func() {
+		It("Should admit positive parameters", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{Tuning: &TuningSpec{
+				MaxRequestBytes:      ptr.To(resource.MustParse("10Mi")),
+				GRPCKeepaliveTimeout: &metav1.Duration{Duration: 20 * time.Second},
+			}}}
+			Expect(etcdCluster.validateTuning()).To(BeEmpty())
+		})
+
+		It("Should reject non-positive parameters", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{Tuning: &TuningSpec{
+				MaxRequestBytes:      ptr.To(resource.MustParse("0")),
+				GRPCKeepaliveMinTime: &metav1.Duration{Duration: -time.Second},
+			}}}
+			err := etcdCluster.validateTuning()
+			if Expect(err).To(HaveLen(2)) {
+				Expect(err[0].Field).To(Equal("spec.tuning.maxRequestBytes"))
+				Expect(err[1].Field).To(Equal("spec.tuning.grpcKeepaliveMinTime"))
+			}
+		})
+
+		It("Should reject progress notify interval on etcd without its support", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				PodTemplate: PodTemplate{Spec: corev1.PodSpec{Containers: []corev1.Container{
+					{Name: "etcd", Image: "quay.io/coreos/etcd:v3.3.27"},
+				}}},
+				Tuning: &TuningSpec{WatchProgressNotifyInterval: &metav1.Duration{Duration: 10 * time.Minute}},
+			}}
+			err := etcdCluster.validateTuning()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.tuning.watchProgressNotifyInterval"))
+			}
+		})
+
+		It("Should name watch flags by etcd version", func() {
+			tuning := &TuningSpec{WatchProgressNotifyInterval: &metav1.Duration{Duration: 10 * time.Minute}}
+			etcdCluster := &EtcdCluster{}
+			Expect(tuning.Options(etcdCluster.EtcdVersion())).To(HaveKey("experimental-watch-progress-notify-interval"))
+			etcdCluster.Spec.PodTemplate.Spec.Containers = []corev1.Container{
+				{Name: "etcd", Image: "registry.example.com:5000/etcd:v3.6.0"},
+			}
+			Expect(tuning.Options(etcdCluster.EtcdVersion())).To(HaveKeyWithValue("watch-progress-notify-interval", "10m0s"))
+		})
+
+		It("Should not parse version of images without version tag", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				PodTemplate: PodTemplate{Spec: corev1.PodSpec{Containers: []corev1.Container{
+					{Name: "etcd", Image: "registry.example.com:5000/etcd"},
+				}}},
+			}}
+			Expect(etcdCluster.EtcdVersion()).To(BeNil())
+		})
+
+		It("Should reject parameters also set in options", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				Options: map[string]string{"max-request-bytes": "1048576"},
+				Tuning:  &TuningSpec{MaxRequestBytes: ptr.To(resource.MustParse("10Mi"))},
+			}}
+			err := etcdCluster.validateTuning()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.options[max-request-bytes]"))
+			}
+		})
+	})
+
+	Context("When configuring logs", func() {
+		It("Should reject log format on etcd without its support", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				Logging: &LoggingSpec{Format: LogFormatConsole},
+			}}
+			err := etcdCluster.validateLogging()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.logging.format"))
+			}
+			etcdCluster.Spec.PodTemplate.Spec.Containers = []corev1.Container{
+				{Name: "etcd", Image: "quay.io/coreos/etcd:v3.6.0"},
+			}
+			Expect(etcdCluster.validateLogging()).To(BeEmpty())
+		})
+
+		It("Should reject outputs while logs are shipped", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				Options: map[string]string{"log-level": "debug"},
+				Logging: &LoggingSpec{
+					Level:    "info",
+					Outputs:  []string{"stdout"},
+					Shipping: &LogShippingSpec{Container: corev1.Container{Name: "etcd"}},
+				},
+			}}
+			err := etcdCluster.validateLogging()
+			if Expect(err).To(HaveLen(3)) {
+				Expect(err[0].Field).To(Equal("spec.logging.outputs"))
+				Expect(err[1].Field).To(Equal("spec.logging.shipping.container.name"))
+				Expect(err[2].Field).To(Equal("spec.options[log-level]"))
+			}
+		})
+	})
+
+	Context("When making the cluster read-only", func() {
+		It("Should require authentication", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{ReadOnly: true}}
+			err := etcdCluster.validateReadOnly()
+			if Expect(err).NotTo(BeNil()) {
+				Expect(err.Field).To(Equal("spec.readOnly"))
+			}
+			etcdCluster.Spec.Security = &SecuritySpec{Auth: &AuthSpec{}}
+			Expect(etcdCluster.validateReadOnly()).To(BeNil())
+		})
+	})
+
+	Context("When notifying sinks", func() {
+		It("Should require exactly one of the URL and its secret", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{Notifications: []NotificationSink{
+				{Name: "valid", Type: NotificationSinkWebhook, URL: "https://hooks.example.com/etcd"},
+				{Name: "missing", Type: NotificationSinkSlack},
+				{Name: "both", Type: NotificationSinkSlack, URL: "https://hooks.example.com/etcd",
+					URLSecretRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "slack"}, Key: "url"}},
+				{Name: "scheme", Type: NotificationSinkCloudEvents, URL: "ftp://events.example.com"},
+			}}}
+			err := etcdCluster.validateNotifications()
+			if Expect(err).To(HaveLen(3)) {
+				Expect(err[0].Field).To(Equal("spec.notifications[1].url"))
+				Expect(err[1].Field).To(Equal("spec.notifications[2].urlSecretRef"))
+				Expect(err[2].Field).To(Equal("spec.notifications[3].url"))
+			}
+		})
+	})
+
+	Context("When reporting key usage", func() {
+		It("Should require a limit of every quota", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{KeyUsage: &KeyUsageSpec{Quotas: []KeyQuota{
+				{Prefix: "/a/", MaxKeys: ptr.To(int64(10))},
+				{Prefix: "/b/"},
+			}}}}
+			err := etcdCluster.validateKeyUsage()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.keyUsage.quotas[1]"))
+			}
+		})
+
+		It("Should require authentication to freeze users other than root", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{KeyUsage: &KeyUsageSpec{Quotas: []KeyQuota{
+				{Prefix: "/a/", MaxKeys: ptr.To(int64(10)), FreezeUsers: []string{"tenant-a"}},
+			}}}}
+			err := etcdCluster.validateKeyUsage()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.keyUsage.quotas[0].freezeUsers"))
+			}
+
+			etcdCluster.Spec.Security = &SecuritySpec{Auth: &AuthSpec{}}
+			Expect(etcdCluster.validateKeyUsage()).To(BeEmpty())
+			etcdCluster.Spec.KeyUsage.Quotas[0].FreezeUsers = append(etcdCluster.Spec.KeyUsage.Quotas[0].FreezeUsers, RootUser)
+			err = etcdCluster.validateKeyUsage()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.keyUsage.quotas[0].freezeUsers[1]"))
+			}
+		})
+	})
+
+	Context("When configuring startup timeout", func() {
+		It("Should reject non-positive timeout", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				Startup: &StartupSpec{Timeout: &metav1.Duration{}},
+			}}
+			err := etcdCluster.validateStartup()
+			if Expect(err).NotTo(BeNil()) {
+				Expect(err.Field).To(Equal("spec.startup.timeout"))
+			}
+		})
+	})
+
+	Context("When limiting etcd API probes", func() {
+		It("Should reject negative interval", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				Probes: &ProbesSpec{Interval: &metav1.Duration{Duration: -time.Second}},
+			}}
+			err := etcdCluster.validateProbes()
+			if Expect(err).NotTo(BeNil()) {
+				Expect(err.Field).To(Equal("spec.probes.interval"))
+			}
+		})
+	})
+
+	Context("When limiting etcd API requests", func() {
+		It("Should reject non-positive timeouts", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				EtcdAPI: &EtcdAPISpec{
+					MemberTimeout:  &metav1.Duration{Duration: 0},
+					RequestTimeout: &metav1.Duration{Duration: time.Minute},
+					CircuitBreaker: &CircuitBreakerSpec{OpenDuration: &metav1.Duration{Duration: -time.Second}},
+				},
+			}}
+			errs := etcdCluster.validateEtcdAPI()
+			Expect(errs).To(HaveLen(2))
+			Expect(errs[0].Field).To(Equal("spec.etcdAPI.memberTimeout"))
+			Expect(errs[1].Field).To(Equal("spec.etcdAPI.circuitBreaker.openDuration"))
+		})
+	})
+
+	Context("When running members as a configured user", func() {
+		It("Should accept non-root user with fsGroup", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				SecurityContext: &MemberSecurityContext{RunAsUser: ptr.To(int64(1000)), FSGroup: ptr.To(int64(1000))},
+			}}
+			Expect(etcdCluster.validateSecurityContext()).To(BeEmpty())
+		})
+
+		It("Should require fsGroup for non-root user with persistent storage", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				SecurityContext: &MemberSecurityContext{RunAsUser: ptr.To(int64(1000))},
+			}}
+			errs := etcdCluster.validateSecurityContext()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.securityContext.fsGroup"))
+
+			etcdCluster.Spec.Storage.EmptyDir = &corev1.EmptyDirVolumeSource{}
+			Expect(etcdCluster.validateSecurityContext()).To(BeEmpty())
+		})
+
+		It("Should reject fields set in the pod template as well", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				SecurityContext: &MemberSecurityContext{RunAsUser: ptr.To(int64(0)), RunAsGroup: ptr.To(int64(0))},
+				PodTemplate: PodTemplate{Spec: corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{
+					RunAsGroup:   ptr.To(int64(0)),
+					RunAsNonRoot: ptr.To(true),
+				}}},
+			}}
+			errs := etcdCluster.validateSecurityContext()
+			Expect(errs).To(HaveLen(2))
+			Expect(errs[0].Field).To(Equal("spec.securityContext.runAsGroup"))
+			Expect(errs[1].Field).To(Equal("spec.securityContext.runAsUser"))
+		})
+	})
+
+	Context("When restricting architectures", func() {
+		It("Should check architectures of the etcd image on changes", func() {
+			var lookups []string
+			DeferCleanup(func() { SetImageArchitecturesLookup(nil) })
+			SetImageArchitecturesLookup(func(_ context.Context, image string) ([]string, error) {
+				lookups = append(lookups, image)
+				if image == "registry.local/etcd:v3.5.12" {
+					return nil, fmt.Errorf("unauthorized")
+				}
+				return []string{"amd64", "arm64"}, nil
+			})
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				Architectures: []Architecture{ArchitectureAMD64, ArchitectureARM64},
+			}}
+			warnings, err := etcdCluster.validateImageArchitectures(nil)
+			Expect(warnings).To(BeEmpty())
+			Expect(err).To(BeNil())
+			Expect(lookups).To(Equal([]string{DefaultEtcdImage}))
+
+			warnings, err = etcdCluster.validateImageArchitectures(etcdCluster.DeepCopy())
+			Expect(warnings).To(BeEmpty())
+			Expect(err).To(BeNil())
+			Expect(lookups).To(HaveLen(1))
+
+			updated := etcdCluster.DeepCopy()
+			updated.Spec.Architectures = append(updated.Spec.Architectures, ArchitecturePPC64LE)
+			_, err = updated.validateImageArchitectures(etcdCluster)
+			if Expect(err).NotTo(BeNil()) {
+				Expect(err.Field).To(Equal("spec.architectures"))
+				Expect(err.Detail).To(ContainSubstring("is not built for ppc64le"))
+			}
+
+			updated = etcdCluster.DeepCopy()
+			updated.Spec.PodTemplate.Spec.Containers = []corev1.Container{{Name: "etcd", Image: "registry.local/etcd:v3.5.12"}}
+			warnings, err = updated.validateImageArchitectures(etcdCluster)
+			Expect(warnings).To(ConsistOf(ContainSubstring("unauthorized")))
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Context("When running on OpenShift", func() {
+		It("Should accept route and service CA with server secret", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				Security:  &SecuritySpec{TLS: TLSSpec{ServerSecret: "server-tls"}},
+				OpenShift: &OpenShiftSpec{Route: &RouteSpec{}, ServiceCA: true},
+			}}
+			Expect(etcdCluster.validateOpenShift()).To(BeEmpty())
+		})
+
+		It("Should reject root user and route without TLS", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				SecurityContext: &MemberSecurityContext{RunAsUser: ptr.To(int64(0))},
+				OpenShift:       &OpenShiftSpec{Route: &RouteSpec{}, ServiceCA: true},
+			}}
+			errs := etcdCluster.validateOpenShift()
+			Expect(errs).To(HaveLen(3))
+			Expect(errs[0].Field).To(Equal("spec.securityContext.runAsUser"))
+			Expect(errs[1].Field).To(Equal("spec.openShift.route"))
+			Expect(errs[2].Field).To(Equal("spec.security.tls.serverSecret"))
+		})
+
+		It("Should reject service CA together with cert-manager issuer", func() {
+			etcdCluster := &EtcdCluster{Spec: EtcdClusterSpec{
+				Security: &SecuritySpec{TLS: TLSSpec{
+					ServerSecret:    "server-tls",
+					ServerIssuerRef: &IssuerReference{Name: "ca"},
+				}},
+				OpenShift: &OpenShiftSpec{ServiceCA: true},
+			}}
+			errs := etcdCluster.validateOpenShift()
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.openShift.serviceCA"))
+		})
+	})
+
+	Context("When configuring periodic backups", func() {
+		It("Should default backup interval and quorum loss timeout", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Storage: StorageSpec{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					Backup:  &ClusterBackupSpec{AutoRestore: &AutoRestoreSpec{}},
+				},
+			}
+			etcdCluster.Default()
+			Expect(etcdCluster.Spec.Backup.Interval.Duration).To(Equal(DefaultBackupInterval))
+			Expect(etcdCluster.Spec.Backup.AutoRestore.QuorumLossTimeout.Duration).To(Equal(DefaultQuorumLossTimeout))
+		})
+
+		It("Should apply default backup policy to clusters without backups", func() {
+			DeferCleanup(SetDefaultBackupPolicy, (*ClusterBackupSpec)(nil))
+
+			Expect(SetDefaultBackupPolicy(&ClusterBackupSpec{
+				Destination: BackupDestination{S3: &S3Destination{Bucket: "fleet", CredentialsSecret: "s3"}},
+			})).To(Succeed())
+			etcdCluster := &EtcdCluster{}
+			etcdCluster.Default()
+			Expect(etcdCluster.Spec.Backup).NotTo(BeNil())
+			Expect(etcdCluster.Spec.Backup.Destination.S3.Bucket).To(Equal("fleet"))
+			Expect(etcdCluster.Spec.Backup.Interval.Duration).To(Equal(DefaultBackupInterval))
+
+			own := &EtcdCluster{Spec: EtcdClusterSpec{Backup: &ClusterBackupSpec{
+				Destination: BackupDestination{S3: &S3Destination{Bucket: "own", CredentialsSecret: "s3"}},
+			}}}
+			Expect(own.ApplyDefaultBackupPolicy()).To(BeFalse())
+			Expect(own.Spec.Backup.Destination.S3.Bucket).To(Equal("own"))
+		})
+
+		It("Should default backup policy applied in memory", func() {
+			DeferCleanup(SetDefaultBackupPolicy, (*ClusterBackupSpec)(nil))
+
+			Expect(SetDefaultBackupPolicy(&ClusterBackupSpec{
+				Destination:     BackupDestination{S3: &S3Destination{Bucket: "fleet", CredentialsSecret: "s3"}},
+				VolumeSnapshots: &VolumeSnapshotPublishing{},
+			})).To(Succeed())
+			etcdCluster := &EtcdCluster{}
+			Expect(etcdCluster.ApplyDefaultBackupPolicy()).To(BeTrue())
+			Expect(etcdCluster.Spec.Backup.Interval.Duration).To(Equal(DefaultBackupInterval))
+			Expect(etcdCluster.Spec.Backup.VolumeSnapshots.ClassName).To(Equal(DefaultVolumeSnapshotClassName))
+		})
+
+		It("Should reject default backup policy with automatic restore", func() {
+			Expect(SetDefaultBackupPolicy(&ClusterBackupSpec{AutoRestore: &AutoRestoreSpec{}})).NotTo(Succeed())
+		})
+
+		It("Should default volume snapshot class", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Backup: &ClusterBackupSpec{VolumeSnapshots: &VolumeSnapshotPublishing{}},
+				},
+			}
+			etcdCluster.Default()
+			Expect(etcdCluster.Spec.Backup.VolumeSnapshots.ClassName).To(Equal(DefaultVolumeSnapshotClassName))
+		})
+
+		It("Should default verification interval", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Backup: &ClusterBackupSpec{VerificationSchedule: &VerificationSchedule{}},
+				},
+			}
+			etcdCluster.Default()
+			Expect(etcdCluster.Spec.Backup.VerificationSchedule.Interval.Duration).To(Equal(DefaultVerificationInterval))
+		})
+
+		It("Should admit automatic restore with emptyDir storage", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Storage:  StorageSpec{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{S3: &S3Destination{Bucket: "backups", CredentialsSecret: "s3"}},
+						AutoRestore: &AutoRestoreSpec{},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should reject automatic restore with persistent storage", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{S3: &S3Destination{Bucket: "backups", CredentialsSecret: "s3"}},
+						AutoRestore: &AutoRestoreSpec{},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("automatic restore can only be used together with emptyDir storage"))
+			}
+		})
+
+		It("Should reject key templates without timestamp or with unknown placeholders", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{S3: &S3Destination{Bucket: "backups", CredentialsSecret: "s3"}},
+						KeyTemplate: "{namespace}/{cluster}.db",
+						Tags:        map[string]string{"env": "{environment}"},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("must be a relative key containing {timestamp}"))
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("unknown placeholder {environment}"))
+			}
+		})
+
+		It("Should reject retention max age shorter than backup interval", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{S3: &S3Destination{Bucket: "backups", CredentialsSecret: "s3"}},
+						Interval:    metav1.Duration{Duration: 24 * time.Hour},
+						Retention:   &BackupRetention{MaxAge: &metav1.Duration{Duration: time.Hour}},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Details.Causes).To(HaveLen(1))
+				Expect(statusErr.ErrStatus.Details.Causes[0].Field).To(Equal("spec.backup.retention.maxAge"))
+			}
+		})
+
+		It("Should reject restic destinations without credentials or with another storage", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{Restic: &ResticDestination{Repository: "rest:https://backup/etcd"}},
+						AdditionalDestinations: []BackupDestination{{
+							S3:     &S3Destination{Bucket: "offsite", CredentialsSecret: "offsite"},
+							Restic: &ResticDestination{Repository: "rest:https://offsite/etcd", CredentialsSecret: "restic"},
+						}},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Details.Causes).To(HaveLen(2))
+				Expect(statusErr.ErrStatus.Details.Causes[0].Field).To(Equal("spec.backup.destination.restic.credentialsSecret"))
+				Expect(statusErr.ErrStatus.Details.Causes[1].Field).To(Equal("spec.backup.additionalDestinations[0]"))
+			}
+		})
+
+		It("Should accept GCS destinations without credentials and require their bucket", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination:            BackupDestination{GCS: &GCSDestination{Bucket: "backups"}},
+						AdditionalDestinations: []BackupDestination{{GCS: &GCSDestination{CredentialsSecret: "gcs"}}},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Details.Causes).To(HaveLen(1))
+				Expect(statusErr.ErrStatus.Details.Causes[0].Field).To(Equal("spec.backup.additionalDestinations[0].gcs.bucket"))
+			}
+		})
+
+		It("Should require the account of Azure Blob destinations using managed identities", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{AzureBlob: &AzureBlobDestination{
+							Container: "backups", CredentialsSecret: "azure",
+						}},
+						AdditionalDestinations: []BackupDestination{
+							{AzureBlob: &AzureBlobDestination{Container: "backups", ClientID: "identity"}},
+						},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Details.Causes).To(HaveLen(1))
+				Expect(statusErr.ErrStatus.Details.Causes[0].Field).To(Equal("spec.backup.additionalDestinations[0].azureBlob.account"))
+			}
+			etcdCluster.Spec.Backup.AdditionalDestinations[0].AzureBlob.Account = "offsite"
+			_, err = etcdCluster.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should require the secret of the encryption key", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{
+							GCS:        &GCSDestination{Bucket: "backups", KMSKeyName: "projects/p/locations/l/keyRings/r/cryptoKeys/k"},
+							Encryption: &BackupEncryption{KeyRef: corev1.SecretKeySelector{Key: "key"}},
+						},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Details.Causes).To(HaveLen(1))
+				Expect(statusErr.ErrStatus.Details.Causes[0].Field).To(Equal("spec.backup.destination.encryption.keyRef"))
+			}
+			etcdCluster.Spec.Backup.Destination.Encryption.KeyRef.Name = "backup-key"
+			_, err = etcdCluster.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should reject additional destinations duplicating other destinations", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{S3: &S3Destination{Bucket: "backups", CredentialsSecret: "s3"}},
+						AdditionalDestinations: []BackupDestination{
+							{S3: &S3Destination{Bucket: "offsite", CredentialsSecret: "offsite"}},
+							{S3: &S3Destination{Bucket: "backups", CredentialsSecret: "s3"}},
+						},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Details.Causes).To(HaveLen(1))
+				Expect(statusErr.ErrStatus.Details.Causes[0].Field).To(Equal("spec.backup.additionalDestinations[1]"))
+			}
+		})
+
+		It("Should reject backup without destination", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Storage:  StorageSpec{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					Backup:   &ClusterBackupSpec{},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("backup storage must be specified"))
+			}
+		})
+
+		It("Should admit credentials referenced by secret keys", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{S3: &S3Destination{
+							Bucket: "backups",
+							AccessKeyIDRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "sops"}, Key: "AWS_ACCESS_KEY_ID",
+							},
+							SecretAccessKeyRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "sops"}, Key: "AWS_SECRET_ACCESS_KEY",
+							},
+						}},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should reject credentials without secret", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{S3: &S3Destination{
+							Bucket: "backups",
+							AccessKeyIDRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "sops"},
+							},
+						}},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("credentials secret must be specified"))
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("secret name and key must be specified"))
+			}
+		})
+
+		It("Should admit S3-compatible endpoints", func() {
+			for _, endpoint := range []string{"minio.storage.svc:9000", "http://minio.storage.svc:9000", "https://rgw.example.com/"} {
+				etcdCluster := &EtcdCluster{
+					Spec: EtcdClusterSpec{
+						Replicas: ptr.To(int32(3)),
+						Backup: &ClusterBackupSpec{
+							Destination: BackupDestination{S3: &S3Destination{
+								Bucket:            "backups",
+								CredentialsSecret: "s3",
+								Endpoint:          endpoint,
+								ForcePathStyle:    true,
+								CABundleRef: &corev1.SecretKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{Name: "minio-ca"}, Key: "ca.crt",
+								},
+							}},
+						},
+					},
+				}
+				_, err := etcdCluster.ValidateCreate()
+				Expect(err).NotTo(HaveOccurred(), endpoint)
+			}
+		})
+
+		It("Should reject invalid S3-compatible endpoints", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{S3: &S3Destination{
+							Bucket:             "backups",
+							CredentialsSecret:  "s3",
+							Endpoint:           "ftp://minio.storage.svc/backups",
+							InsecureSkipVerify: true,
+							CABundleRef:        &corev1.SecretKeySelector{Key: "ca.crt"},
+						}},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("scheme must be http or https"))
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("secret name and key must be specified"))
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("can't be disabled together with caBundleRef"))
+			}
+			etcdCluster.Spec.Backup.Destination.S3.Endpoint = "https://minio.storage.svc/backups"
+			_, err = etcdCluster.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("must not have a path")))
+		})
+	})
+
+	Context("When requesting restore", func() {
+		It("Should admit restore of persistent cluster", func() {
+			etcdCluster := &EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{RestoreFromAnnotation: RestoreFromLatest}},
+				Spec: EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Backup: &ClusterBackupSpec{
+						Destination: BackupDestination{S3: &S3Destination{Bucket: "backups", CredentialsSecret: "s3"}},
+					},
+				},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should reject restore without backups and of emptyDir clusters", func() {
+			etcdCluster := &EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{RestoreFromAnnotation: RestoreFromLatest}},
+				Spec:       EtcdClusterSpec{Replicas: ptr.To(int32(3))},
+			}
+			_, err := etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("restore requires backups to be configured"))
+			}
+
+			etcdCluster.Spec.Storage.EmptyDir = &corev1.EmptyDirVolumeSource{}
+			etcdCluster.Spec.Backup = &ClusterBackupSpec{
+				Destination: BackupDestination{S3: &S3Destination{Bucket: "backups", CredentialsSecret: "s3"}},
+			}
+			_, err = etcdCluster.ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				statusErr := err.(*errors.StatusError)
+				Expect(statusErr.ErrStatus.Message).To(ContainSubstring("emptyDir storage is restored automatically"))
+			}
+		})
+	})
+
+	Context("When configuring operator jobs", func() {
+		It("Should default backoff and history limits", func() {
+			etcdCluster := &EtcdCluster{
+				Spec: EtcdClusterSpec{JobTemplate: &JobTemplate{FailedJobsHistoryLimit: ptr.To(int32(5))}},
+			}
+			etcdCluster.Default()
+			Expect(etcdCluster.Spec.JobTemplate.BackoffLimit).To(Equal(ptr.To(DefaultJobBackoffLimit)))
+			Expect(etcdCluster.Spec.JobTemplate.SuccessfulJobsHistoryLimit).To(Equal(ptr.To(DefaultSuccessfulJobsHistoryLimit)))
+			Expect(etcdCluster.Spec.JobTemplate.FailedJobsHistoryLimit).To(Equal(ptr.To(int32(5))))
+		})
+	})
+
+	Context("Validate Security", func() {
+		etcdCluster := &EtcdCluster{
+			Spec: EtcdClusterSpec{
+				Replicas: ptr.To(int32(3)),
+				Security: &SecuritySpec{},
+			},
+		}
+		It("Should admit enabled empty security", func() {
+			localCluster := etcdCluster.DeepCopy()
+			err := localCluster.validateSecurity()
+			Expect(err).To(BeNil())
+		})
+
+		It("Should reject if only one peer secret is defined", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				PeerTrustedCASecret: "test-peer-ca-cert",
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).NotTo(BeNil()) {
+				expectedFieldErr := field.Invalid(
+					field.NewPath("spec", "security", "tls"),
+					localCluster.Spec.Security.TLS,
+					"both spec.security.tls.peerSecret and spec.security.tls.peerTrustedCASecret must be filled or empty",
+				)
+				if Expect(err).To(HaveLen(1)) {
+					Expect(*(err[0])).To(Equal(*expectedFieldErr))
+				}
+			}
+		})
+
+		It("Should reject if only one peer secret is defined", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				PeerSecret: "test-peer-cert",
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).NotTo(BeNil()) {
+				expectedFieldErr := field.Invalid(
+					field.NewPath("spec", "security", "tls"),
+					localCluster.Spec.Security.TLS,
+					"both spec.security.tls.peerSecret and spec.security.tls.peerTrustedCASecret must be filled or empty",
+				)
+				if Expect(err).To(HaveLen(1)) {
+					Expect(*(err[0])).To(Equal(*expectedFieldErr))
+				}
+			}
+		})
+
+		It("Should reject if only one client secret is defined", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				ClientTrustedCASecret: "test-client-ca-cert",
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).NotTo(BeNil()) {
+				expectedFieldErr := field.Invalid(
+					field.NewPath("spec", "security", "tls"),
+					localCluster.Spec.Security.TLS,
+					"both spec.security.tls.clientSecret and spec.security.tls.clientTrustedCASecret must be filled or empty",
+				)
+				if Expect(err).To(HaveLen(1)) {
+					Expect(*(err[0])).To(Equal(*expectedFieldErr))
+				}
+			}
+		})
+
+		It("Should reject if only one client secret is defined", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				ClientTrustedCASecret: "test-client-cert",
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).NotTo(BeNil()) {
+				expectedFieldErr := field.Invalid(
+					field.NewPath("spec", "security", "tls"),
+					localCluster.Spec.Security.TLS,
+					"both spec.security.tls.clientSecret and spec.security.tls.clientTrustedCASecret must be filled or empty",
+				)
+				if Expect(err).To(HaveLen(1)) {
+					Expect(*(err[0])).To(Equal(*expectedFieldErr))
+				}
+			}
+		})
+
+		It("Should reject certificate revocation list without client certificate authentication", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				ClientCRLSecret: "test-client-crl",
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.security.tls.clientCRLSecret"))
+			}
+		})
+
+		It("Should admit secure cipher suites", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+				MinVersion:   TLSVersion12,
+			}
+			Expect(localCluster.validateSecurity()).To(BeNil())
+		})
+
+		It("Should reject unknown and insecure cipher suites", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_UNKNOWN"},
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).To(HaveLen(2)) {
+				Expect(err[0].Field).To(Equal("spec.security.tls.cipherSuites[0]"))
+				Expect(err[1].Field).To(Equal("spec.security.tls.cipherSuites[1]"))
+			}
+		})
+
+		It("Should reject cipher suites with TLS 1.3 only", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+				MinVersion:   TLSVersion13,
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.security.tls.cipherSuites"))
+			}
+		})
+
+		It("Should reject cipher suites which are not FIPS-approved in FIPS mode", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.FIPS = ptr.To(true)
+			localCluster.Spec.Security.TLS = TLSSpec{
+				CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"},
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.security.tls.cipherSuites[1]"))
+			}
+		})
+
+		It("Should reject unsupported TLS versions", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{MinVersion: "TLS1.1"}
+			err := localCluster.validateSecurity()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Type).To(Equal(field.ErrorTypeNotSupported))
+			}
+		})
+
+		It("Should admit extra SANs of the issued server certificate", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				ServerSecret:    "test-server-cert",
+				ServerIssuerRef: &IssuerReference{Name: "ca"},
+				ExtraSANs:       []string{"etcd.example.com", "*.etcd.example.com", "10.0.0.1"},
+			}
+			Expect(localCluster.validateSecurity()).To(BeNil())
+		})
+
+		It("Should reject invalid extra SANs", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				ServerSecret:    "test-server-cert",
+				ServerIssuerRef: &IssuerReference{Name: "ca"},
+				ExtraSANs:       []string{"etcd.example.com", "Not_A_Name"},
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.security.tls.extraSANs[1]"))
+			}
+		})
+
+		It("Should reject extra SANs of user-managed certificates", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				ServerSecret: "test-server-cert",
+				ExtraSANs:    []string{"etcd.example.com"},
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.security.tls.extraSANs"))
+			}
+		})
+
+		It("Should require server secret for issued certificates", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.TLS = TLSSpec{
+				ServerIssuerRef: &IssuerReference{Name: "ca"},
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Type).To(Equal(field.ErrorTypeRequired))
+			}
+		})
+
+		It("Should default secrets of managed users", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Name = "test"
+			localCluster.Spec.Security.Auth = &AuthSpec{Users: []ManagedUser{{Name: "app"}}}
+			localCluster.Default()
+			Expect(localCluster.Spec.Security.Auth.Users[0].SecretName).To(Equal("test-app-credentials"))
+			Expect(localCluster.validateSecurity()).To(BeNil())
+		})
+
+		It("Should reject managed root and duplicate users", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.Auth = &AuthSpec{Users: []ManagedUser{
+				{Name: RootUser, SecretName: "root"},
+				{Name: "app", SecretName: "app"},
+				{Name: "app", SecretName: "app-2"},
+			}}
+			err := localCluster.validateSecurity()
+			if Expect(err).To(HaveLen(2)) {
+				Expect(err[0].Type).To(Equal(field.ErrorTypeForbidden))
+				Expect(err[1].Field).To(Equal("spec.security.auth.users[2].name"))
+			}
+		})
+
+		It("Should reject too short password maximum age", func() {
+			localCluster := etcdCluster.DeepCopy()
+			localCluster.Spec.Security.Auth = &AuthSpec{
+				Rotation: &CredentialRotationSpec{MaxAge: metav1.Duration{Duration: time.Minute}},
+			}
+			err := localCluster.validateSecurity()
+			if Expect(err).To(HaveLen(1)) {
+				Expect(err[0].Field).To(Equal("spec.security.auth.rotation.maxAge"))
 			}
 		})
 	})
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KeySetDeletionPolicy defines what happens to the managed keys when the EtcdKeySet is deleted.
+// +kubebuilder:validation:Enum=Retain;Delete
+type KeySetDeletionPolicy string
+
+const (
+	// KeySetDeletionPolicyRetain leaves the keys in the cluster.
+	KeySetDeletionPolicyRetain KeySetDeletionPolicy = "Retain"
+	// KeySetDeletionPolicyDelete deletes all keys under the owned prefix.
+	KeySetDeletionPolicyDelete KeySetDeletionPolicy = "Delete"
+)
+
+// EtcdKeySetSpec defines the desired state of EtcdKeySet
+type EtcdKeySetSpec struct {
+	// ClusterRef is the EtcdCluster in the same namespace the keys are written to.
+	ClusterRef corev1.LocalObjectReference `json:"clusterRef"`
+	// Prefix is the key prefix owned by the key set, it must start and end with a slash. All keys are written
+	// under it and no other EtcdKeySet can own an overlapping prefix in the same cluster.
+	// +kubebuilder:validation:MinLength:=2
+	// +kubebuilder:validation:Pattern:=`^/.*/$`
+	Prefix string `json:"prefix"`
+	// Keys are the keys to write, relative to the prefix.
+	// +optional
+	// +listType=map
+	// +listMapKey=key
+	Keys []EtcdKey `json:"keys,omitempty"`
+	// Prune deletes keys under the prefix which are not listed in Keys.
+	// +optional
+	// +kubebuilder:default:=true
+	Prune *bool `json:"prune,omitempty"`
+	// DeletionPolicy defines whether keys under the prefix are deleted together with the key set.
+	// +optional
+	// +kubebuilder:default:=Retain
+	DeletionPolicy KeySetDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// EtcdKey is a single key with its value.
+type EtcdKey struct {
+	// Key is the key name relative to the key set prefix.
+	// +kubebuilder:validation:MinLength:=1
+	Key string `json:"key"`
+	// Value is the literal value of the key.
+	// +optional
+	Value string `json:"value,omitempty"`
+	// ValueFrom sources the value from a secret or a config map in the key set namespace.
+	// +optional
+	ValueFrom *EtcdKeyValueSource `json:"valueFrom,omitempty"`
+}
+
+// EtcdKeyValueSource is the source of a key value. Exactly one of its fields must be set.
+type EtcdKeyValueSource struct {
+	// SecretKeyRef selects a key of a secret.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+	// ConfigMapKeyRef selects a key of a config map.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+// EtcdKeySetStatus defines the observed state of EtcdKeySet
+type EtcdKeySetStatus struct {
+	// Conditions represent the latest available observations of the key set.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ObservedGeneration is the generation of the spec applied to the cluster.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ManagedKeys is the number of keys written by the key set.
+	// +optional
+	ManagedKeys int32 `json:"managedKeys,omitempty"`
+	// LastSyncTime is the time keys were last compared with the cluster.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+}
+
+const (
+	// EtcdKeySetConditionSynced is true when the keys in the cluster match the spec.
+	EtcdKeySetConditionSynced = "Synced"
+
+	EtcdKeySetReasonSynced          = "Synced"
+	EtcdKeySetReasonClusterNotFound = "ClusterNotFound"
+	EtcdKeySetReasonPrefixConflict  = "PrefixConflict"
+	EtcdKeySetReasonValueNotFound   = "ValueNotFound"
+	EtcdKeySetReasonSyncFailed      = "SyncFailed"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.clusterRef.name`
+// +kubebuilder:printcolumn:name="Prefix",type=string,JSONPath=`.spec.prefix`
+// +kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EtcdKeySet is the Schema for the etcdkeysets API
+type EtcdKeySet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdKeySetSpec   `json:"spec,omitempty"`
+	Status EtcdKeySetStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdKeySetList contains a list of EtcdKeySet
+type EtcdKeySetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdKeySet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdKeySet{}, &EtcdKeySetList{})
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var etcdkeysetlog = logf.Log.WithName("etcdkeyset-resource")
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks
+func (r *EtcdKeySet) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-etcd-aenix-io-v1alpha1-etcdkeyset,mutating=false,failurePolicy=fail,sideEffects=None,groups=etcd.aenix.io,resources=etcdkeysets,verbs=create;update,versions=v1alpha1,name=vetcdkeyset.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &EtcdKeySet{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *EtcdKeySet) ValidateCreate() (admission.Warnings, error) {
+	etcdkeysetlog.Info("validate create", "name", r.Name)
+	return nil, r.toInvalidErr(r.validateKeys())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *EtcdKeySet) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	etcdkeysetlog.Info("validate update", "name", r.Name)
+	oldKeySet := old.(*EtcdKeySet)
+
+	allErrors := r.validateKeys()
+	if r.Spec.ClusterRef.Name != oldKeySet.Spec.ClusterRef.Name {
+		allErrors = append(allErrors, field.Invalid(
+			field.NewPath("spec", "clusterRef", "name"),
+			r.Spec.ClusterRef.Name,
+			"field is immutable"),
+		)
+	}
+	if r.Spec.Prefix != oldKeySet.Spec.Prefix {
+		allErrors = append(allErrors, field.Invalid(
+			field.NewPath("spec", "prefix"),
+			r.Spec.Prefix,
+			"field is immutable"),
+		)
+	}
+	return nil, r.toInvalidErr(allErrors)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *EtcdKeySet) ValidateDelete() (admission.Warnings, error) {
+	etcdkeysetlog.Info("validate delete", "name", r.Name)
+	return nil, nil
+}
+
+func (r *EtcdKeySet) validateKeys() field.ErrorList {
+	var allErrors field.ErrorList
+	keysPath := field.NewPath("spec", "keys")
+	for i, key := range r.Spec.Keys {
+		keyPath := keysPath.Index(i)
+		if strings.HasPrefix(key.Key, "/") {
+			allErrors = append(allErrors, field.Invalid(keyPath.Child("key"), key.Key,
+				"key must be relative to the prefix"))
+		}
+		if key.ValueFrom == nil {
+			continue
+		}
+		if key.Value != "" {
+			allErrors = append(allErrors, field.Invalid(keyPath.Child("valueFrom"), key.ValueFrom,
+				"value and valueFrom are mutually exclusive"))
+		}
+		if (key.ValueFrom.SecretKeyRef == nil) == (key.ValueFrom.ConfigMapKeyRef == nil) {
+			allErrors = append(allErrors, field.Invalid(keyPath.Child("valueFrom"), key.ValueFrom,
+				"exactly one of secretKeyRef and configMapKeyRef must be set"))
+		}
+	}
+	return allErrors
+}
+
+func (r *EtcdKeySet) toInvalidErr(allErrors field.ErrorList) error {
+	if len(allErrors) == 0 {
+		return nil
+	}
+	return errors.NewInvalid(
+		schema.GroupKind{Group: GroupVersion.Group, Kind: "EtcdKeySet"},
+		r.Name, allErrors)
+}
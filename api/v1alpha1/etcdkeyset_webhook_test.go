@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+var _ = Describe("EtcdKeySet Webhook", func() {
+	newKeySet := func(keys ...EtcdKey) *EtcdKeySet {
+		return &EtcdKeySet{
+			Spec: EtcdKeySetSpec{
+				ClusterRef: corev1.LocalObjectReference{Name: "test"},
+				Prefix:     "/config/app/",
+				Keys:       keys,
+			},
+		}
+	}
+
+	Context("When creating EtcdKeySet under Validating Webhook", func() {
+		It("Should accept literal and referenced values", func() {
+			keySet := newKeySet(
+				EtcdKey{Key: "mode", Value: "production"},
+				EtcdKey{Key: "token", ValueFrom: &EtcdKeyValueSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "app"},
+						Key:                  "token",
+					},
+				}},
+			)
+			_, err := keySet.ValidateCreate()
+			Expect(err).To(Succeed())
+		})
+
+		It("Should reject absolute keys", func() {
+			_, err := newKeySet(EtcdKey{Key: "/mode", Value: "production"}).ValidateCreate()
+			if Expect(err).To(HaveOccurred()) {
+				Expect(err.(*errors.StatusError).ErrStatus.Message).To(ContainSubstring("relative to the prefix"))
+			}
+		})
+
+		It("Should reject ambiguous value sources", func() {
+			_, err := newKeySet(EtcdKey{Key: "mode", Value: "production", ValueFrom: &EtcdKeyValueSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{Key: "mode"},
+			}}).ValidateCreate()
+			Expect(err).To(HaveOccurred())
+
+			_, err = newKeySet(EtcdKey{Key: "mode", ValueFrom: &EtcdKeyValueSource{}}).ValidateCreate()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When updating EtcdKeySet under Validating Webhook", func() {
+		It("Should reject changing cluster and prefix", func() {
+			keySet := newKeySet()
+			keySet.Spec.Prefix = "/config/other/"
+			_, err := keySet.ValidateUpdate(newKeySet())
+			Expect(err).To(HaveOccurred())
+
+			keySet = newKeySet()
+			keySet.Spec.ClusterRef.Name = "other"
+			_, err = keySet.ValidateUpdate(newKeySet())
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should allow changing keys", func() {
+			_, err := newKeySet(EtcdKey{Key: "mode", Value: "staging"}).ValidateUpdate(newKeySet())
+			Expect(err).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EtcdMirrorSpec defines the desired state of EtcdMirror
+// +kubebuilder:validation:XValidation:rule="self.source.name != self.destination.name",message="source and destination must be different clusters"
+type EtcdMirrorSpec struct {
+	// Source is the EtcdCluster in the same namespace keys are replicated from.
+	Source corev1.LocalObjectReference `json:"source"`
+	// Destination is the EtcdCluster in the same namespace keys are replicated to.
+	Destination corev1.LocalObjectReference `json:"destination"`
+	// Prefixes are the key prefixes replicated between the clusters.
+	// +optional
+	// +kubebuilder:default:={"/"}
+	// +kubebuilder:validation:MinItems:=1
+	Prefixes []string `json:"prefixes,omitempty"`
+	// Comparison configures periodic comparison of the replicated prefixes.
+	// +optional
+	Comparison MirrorComparisonSpec `json:"comparison,omitempty"`
+}
+
+// MirrorComparisonSpec configures periodic comparison of mirrored clusters.
+type MirrorComparisonSpec struct {
+	// Interval between comparisons.
+	// +optional
+	// +kubebuilder:default:="10m"
+	Interval metav1.Duration `json:"interval,omitempty"`
+}
+
+// EtcdMirrorStatus defines the observed state of EtcdMirror
+type EtcdMirrorStatus struct {
+	// Conditions represent the latest available observations of the mirror.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// LastComparisonTime is the time of the last comparison.
+	// +optional
+	LastComparisonTime *metav1.Time `json:"lastComparisonTime,omitempty"`
+	// LastInSyncTime is the time of the last comparison which found all prefixes identical.
+	// Replication lag is at most the time passed since then.
+	// +optional
+	LastInSyncTime *metav1.Time `json:"lastInSyncTime,omitempty"`
+	// Prefixes contains comparison results of every replicated prefix.
+	// +optional
+	Prefixes []PrefixComparison `json:"prefixes,omitempty"`
+}
+
+// PrefixComparison is the result of comparison of a single prefix between the source and destination clusters.
+type PrefixComparison struct {
+	// Prefix is the compared key prefix.
+	Prefix string `json:"prefix"`
+	// SourceKeys is the number of keys under the prefix in the source cluster.
+	SourceKeys int64 `json:"sourceKeys"`
+	// DestinationKeys is the number of keys under the prefix in the destination cluster.
+	DestinationKeys int64 `json:"destinationKeys"`
+	// SourceRevision is the latest modification revision of keys under the prefix in the source cluster.
+	// +optional
+	SourceRevision int64 `json:"sourceRevision,omitempty"`
+	// DestinationRevision is the latest modification revision of keys under the prefix in the destination cluster.
+	// +optional
+	DestinationRevision int64 `json:"destinationRevision,omitempty"`
+	// SourceHash is the hash of keys and values under the prefix in the source cluster.
+	// +optional
+	SourceHash string `json:"sourceHash,omitempty"`
+	// DestinationHash is the hash of keys and values under the prefix in the destination cluster.
+	// +optional
+	DestinationHash string `json:"destinationHash,omitempty"`
+	// MissingKeys is the number of source keys absent in the destination cluster.
+	// +optional
+	MissingKeys int64 `json:"missingKeys,omitempty"`
+	// ExtraKeys is the number of destination keys absent in the source cluster.
+	// +optional
+	ExtraKeys int64 `json:"extraKeys,omitempty"`
+	// DifferentKeys is the number of keys with different values in the clusters.
+	// +optional
+	DifferentKeys int64 `json:"differentKeys,omitempty"`
+}
+
+const (
+	// EtcdMirrorConditionInSync is true when all replicated prefixes are identical in both clusters.
+	EtcdMirrorConditionInSync = "InSync"
+
+	EtcdMirrorReasonInSync           = "InSync"
+	EtcdMirrorReasonDiverged         = "Diverged"
+	EtcdMirrorReasonClusterNotFound  = "ClusterNotFound"
+	EtcdMirrorReasonComparisonFailed = "ComparisonFailed"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.spec.source.name`
+// +kubebuilder:printcolumn:name="Destination",type=string,JSONPath=`.spec.destination.name`
+// +kubebuilder:printcolumn:name="In Sync",type=string,JSONPath=`.status.conditions[?(@.type=="InSync")].status`
+// +kubebuilder:printcolumn:name="Last In Sync",type=date,JSONPath=`.status.lastInSyncTime`
+
+// EtcdMirror is the Schema for the etcdmirrors API
+type EtcdMirror struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdMirrorSpec   `json:"spec,omitempty"`
+	Status EtcdMirrorStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdMirrorList contains a list of EtcdMirror
+type EtcdMirrorList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdMirror `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdMirror{}, &EtcdMirrorList{})
+}
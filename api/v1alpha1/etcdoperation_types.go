@@ -0,0 +1,143 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EtcdOperationType is the type of the action performed on the cluster.
+// +kubebuilder:validation:Enum=Defragment;Compact;MoveLeader;Snapshot;RemoveMember
+type EtcdOperationType string
+
+const (
+	// EtcdOperationDefragment defragments members one by one, the leader last.
+	EtcdOperationDefragment EtcdOperationType = "Defragment"
+	// EtcdOperationCompact compacts the key-value history of the cluster.
+	EtcdOperationCompact EtcdOperationType = "Compact"
+	// EtcdOperationMoveLeader transfers leadership to another member.
+	EtcdOperationMoveLeader EtcdOperationType = "MoveLeader"
+	// EtcdOperationSnapshot takes a snapshot of the cluster to the backup destination.
+	EtcdOperationSnapshot EtcdOperationType = "Snapshot"
+	// EtcdOperationRemoveMember removes the member with its data, so it rejoins the cluster empty.
+	EtcdOperationRemoveMember EtcdOperationType = "RemoveMember"
+)
+
+// EtcdOperationSpec defines the desired state of EtcdOperation
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+// +kubebuilder:validation:XValidation:rule="self.type != 'RemoveMember' || has(self.member)",message="member is required to remove a member"
+// +kubebuilder:validation:XValidation:rule="self.type == 'Compact' || !has(self.revision)",message="revision is allowed only for compaction"
+type EtcdOperationSpec struct {
+	// Cluster is the EtcdCluster in the same namespace the operation is performed on.
+	Cluster corev1.LocalObjectReference `json:"cluster"`
+	// Type is the action performed on the cluster.
+	Type EtcdOperationType `json:"type"`
+	// Member is the name of the member the operation targets.
+	// Defragment targets all members if it is not set, MoveLeader picks any member other than the leader.
+	// +optional
+	Member string `json:"member,omitempty"`
+	// Revision is the revision Compact compacts the history at. The current revision is used if it is not set.
+	// +optional
+	// +kubebuilder:validation:Minimum:=1
+	Revision *int64 `json:"revision,omitempty"`
+}
+
+// EtcdOperationPhase is the lifecycle phase of the operation.
+type EtcdOperationPhase string
+
+const (
+	// EtcdOperationPhasePending means the operation waits for another operation of the cluster to finish.
+	EtcdOperationPhasePending EtcdOperationPhase = "Pending"
+	// EtcdOperationPhaseRunning means the operation is started and waits for the cluster to recover.
+	EtcdOperationPhaseRunning EtcdOperationPhase = "Running"
+	// EtcdOperationPhaseSucceeded means the operation is done.
+	EtcdOperationPhaseSucceeded EtcdOperationPhase = "Succeeded"
+	// EtcdOperationPhaseFailed means the operation failed. Failed operations are never retried.
+	EtcdOperationPhaseFailed EtcdOperationPhase = "Failed"
+)
+
+// EtcdOperationStatus defines the observed state of EtcdOperation
+type EtcdOperationStatus struct {
+	// Phase is the lifecycle phase of the operation.
+	// +optional
+	Phase EtcdOperationPhase `json:"phase,omitempty"`
+	// Conditions represent the latest available observations of the operation.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// StartTime is the time the operation was started at.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time the operation succeeded or failed at.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Leader is the name of the cluster leader after MoveLeader.
+	// +optional
+	Leader string `json:"leader,omitempty"`
+	// Revision is the revision the history is compacted at by Compact.
+	// +optional
+	Revision int64 `json:"revision,omitempty"`
+	// SnapshotKey is the key of the snapshot taken by Snapshot in the backup destination.
+	// +optional
+	SnapshotKey string `json:"snapshotKey,omitempty"`
+}
+
+const (
+	// EtcdOperationConditionCompleted is true when the operation succeeded and false when it failed.
+	EtcdOperationConditionCompleted = "Completed"
+
+	EtcdOperationReasonWaitingForLock  = "WaitingForLock"
+	EtcdOperationReasonRunning         = "Running"
+	EtcdOperationReasonSucceeded       = "Succeeded"
+	EtcdOperationReasonFailed          = "Failed"
+	EtcdOperationReasonClusterNotFound = "ClusterNotFound"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.cluster.name`
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Member",type=string,JSONPath=`.spec.member`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EtcdOperation is the Schema for the etcdoperations API
+type EtcdOperation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdOperationSpec   `json:"spec,omitempty"`
+	Status EtcdOperationStatus `json:"status,omitempty"`
+}
+
+// Finished checks if the operation succeeded or failed.
+func (o *EtcdOperation) Finished() bool {
+	return o.Status.Phase == EtcdOperationPhaseSucceeded || o.Status.Phase == EtcdOperationPhaseFailed
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdOperationList contains a list of EtcdOperation
+type EtcdOperationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdOperation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdOperation{}, &EtcdOperationList{})
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EtcdRestoreSpec defines the desired state of EtcdRestore
+// +kubebuilder:validation:XValidation:rule="has(self.backup) != has(self.snapshotKey)",message="either backup or snapshotKey must be specified"
+// +kubebuilder:validation:XValidation:rule="has(self.backup) == has(oldSelf.backup) && (!has(self.backup) || self.backup == oldSelf.backup)",message="backup is immutable"
+// +kubebuilder:validation:XValidation:rule="has(self.snapshotKey) == has(oldSelf.snapshotKey) && (!has(self.snapshotKey) || self.snapshotKey == oldSelf.snapshotKey)",message="snapshotKey is immutable"
+type EtcdRestoreSpec struct {
+	// Backup is the EtcdBackup in the same namespace the snapshot of is restored.
+	// The restore waits for the backup to succeed.
+	// +optional
+	Backup *corev1.LocalObjectReference `json:"backup,omitempty"`
+	// SnapshotKey is the storage key of the snapshot in the backup destination of the cluster.
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	SnapshotKey string `json:"snapshotKey,omitempty"`
+	// Cluster is the new EtcdCluster created from the snapshot.
+	// Its backup destination must contain the snapshot.
+	Cluster RestoredClusterTemplate `json:"cluster"`
+}
+
+// RestoredClusterTemplate describes the EtcdCluster created by the restore.
+type RestoredClusterTemplate struct {
+	// Name is the name of the new cluster in the namespace of the restore. The cluster must not exist.
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="name is immutable"
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Labels are added to the cluster.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to the cluster.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Spec is the spec of the cluster. It is used only to create the cluster, later changes of the cluster
+	// are made to the cluster itself.
+	// +kubebuilder:validation:XValidation:rule="has(self.backup)",message="backup destination is required to restore a snapshot"
+	Spec EtcdClusterSpec `json:"spec"`
+}
+
+// EtcdRestorePhase is the lifecycle phase of the restore.
+type EtcdRestorePhase string
+
+const (
+	// EtcdRestorePhasePending means the restore waits for the backup to succeed.
+	EtcdRestorePhasePending EtcdRestorePhase = "Pending"
+	// EtcdRestorePhaseRestoring means the cluster is created and members restore their data from the snapshot.
+	EtcdRestorePhaseRestoring EtcdRestorePhase = "Restoring"
+	// EtcdRestorePhaseSucceeded means the cluster is restored and has quorum.
+	EtcdRestorePhaseSucceeded EtcdRestorePhase = "Succeeded"
+	// EtcdRestorePhaseFailed means the cluster could not be restored. Failed restores are never retried.
+	EtcdRestorePhaseFailed EtcdRestorePhase = "Failed"
+)
+
+// EtcdRestoreStatus defines the observed state of EtcdRestore
+type EtcdRestoreStatus struct {
+	// Phase is the lifecycle phase of the restore.
+	// +optional
+	Phase EtcdRestorePhase `json:"phase,omitempty"`
+	// Conditions represent the latest available observations of the restore.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// SnapshotKey is the storage key of the snapshot the cluster is restored from.
+	// +optional
+	SnapshotKey string `json:"snapshotKey,omitempty"`
+	// StartTime is the time the cluster was created at.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time the restore succeeded or failed at.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Progress is the progress of member restores, mirrored from the status of the cluster.
+	// +optional
+	Progress *RestoreProgress `json:"progress,omitempty"`
+}
+
+const (
+	// EtcdRestoreConditionCompleted is true when the restore succeeded and false when it failed.
+	EtcdRestoreConditionCompleted = "Completed"
+
+	EtcdRestoreReasonWaitingForBackup = "WaitingForBackup"
+	EtcdRestoreReasonRestoring        = "Restoring"
+	EtcdRestoreReasonSucceeded        = "Succeeded"
+	EtcdRestoreReasonBackupNotFound   = "BackupNotFound"
+	EtcdRestoreReasonBackupFailed     = "BackupFailed"
+	EtcdRestoreReasonSnapshotNotFound = "SnapshotNotFound"
+	EtcdRestoreReasonClusterExists    = "ClusterExists"
+	EtcdRestoreReasonClusterDeleted   = "ClusterDeleted"
+	EtcdRestoreReasonBootstrapFailed  = "BootstrapFailed"
+)
+
+// RestoreLabel is the label of clusters created by a restore with the name of the restore.
+const RestoreLabel = "etcd.aenix.io/restore"
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type=string,JSONPath=`.spec.cluster.name`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Snapshot",type=string,JSONPath=`.status.snapshotKey`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// EtcdRestore is the Schema for the etcdrestores API
+type EtcdRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EtcdRestoreSpec   `json:"spec,omitempty"`
+	Status EtcdRestoreStatus `json:"status,omitempty"`
+}
+
+// Finished checks if the restore succeeded or failed.
+func (r *EtcdRestore) Finished() bool {
+	return r.Status.Phase == EtcdRestorePhaseSucceeded || r.Status.Phase == EtcdRestorePhaseFailed
+}
+
+// +kubebuilder:object:root=true
+
+// EtcdRestoreList contains a list of EtcdRestore
+type EtcdRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EtcdRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EtcdRestore{}, &EtcdRestoreList{})
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// IntegrationContractVersion is the version of the contract published in IntegrationStatus. It is changed
+// only if published fields or Secrets change incompatibly.
+const IntegrationContractVersion = "v1"
+
+const (
+	// EndpointsSecretEndpointsKey is the key of comma-separated client URLs of members in the endpoints Secret.
+	EndpointsSecretEndpointsKey = "endpoints"
+	// CACertKey is the key of the CA certificate of server certificates in Secrets published for consumers.
+	CACertKey = "ca.crt"
+)
+
+// IntegrationSpec configures objects published for hosted control planes, such as Kamaji or Cluster API
+// control plane providers, consuming the cluster.
+type IntegrationSpec struct {
+	// KubeadmClientSecret generates the <cluster>-apiserver-etcd-client Secret in the format kubeadm and
+	// Cluster API use for external etcd: tls.crt and tls.key of the client certificate in
+	// spec.security.tls.clientSecret and ca.crt of the server certificate.
+	// +optional
+	KubeadmClientSecret bool `json:"kubeadmClientSecret,omitempty"`
+	// DatastoreSecret generates the <cluster>-datastore Secret with endpoints and certificates in the layout
+	// expected by datastore consumers, such as Kamaji or kine.
+	// +optional
+	DatastoreSecret *DatastoreSecretSpec `json:"datastoreSecret,omitempty"`
+}
+
+// DatastoreFormat is the layout of the datastore connection Secret.
+// +kubebuilder:validation:Enum=Kamaji;Kine
+type DatastoreFormat string
+
+const (
+	// DatastoreFormatKamaji has the endpoints key with comma-separated host:port pairs as Kamaji DataStore
+	// endpoints, and ca.crt, tls.crt and tls.key keys with certificates.
+	DatastoreFormatKamaji DatastoreFormat = "Kamaji"
+	// DatastoreFormatKine has the endpoint key with comma-separated client URLs as the kine --endpoint flag,
+	// and ca.crt, client.crt and client.key keys with certificates.
+	DatastoreFormatKine DatastoreFormat = "Kine"
+)
+
+// DatastoreSecretSpec configures the datastore connection Secret. Certificates are copied from the server
+// and client certificate Secrets, so they are present only if members serve TLS.
+type DatastoreSecretSpec struct {
+	// Format is the layout of the Secret.
+	// +optional
+	// +kubebuilder:default=Kamaji
+	Format DatastoreFormat `json:"format,omitempty"`
+}
+
+// IntegrationStatus is the contract for hosted control planes consuming the cluster. Consumers are expected
+// to connect to the cluster once its TrafficReady condition is True.
+type IntegrationStatus struct {
+	// ContractVersion is the version of the contract, see IntegrationContractVersion.
+	ContractVersion string `json:"contractVersion"`
+	// Endpoints are client URLs of members.
+	Endpoints []string `json:"endpoints"`
+	// EndpointsSecret is the Secret with the endpoints key holding comma-separated client URLs of members
+	// and, if members serve TLS, the ca.crt key holding the CA certificate of the server certificate.
+	EndpointsSecret string `json:"endpointsSecret"`
+	// ReadyCondition is the condition type consumers wait for to be True before connecting.
+	ReadyCondition string `json:"readyCondition"`
+	// KubeadmClientSecret is the kubeadm-compatible client Secret if its generation is enabled.
+	// +optional
+	KubeadmClientSecret string `json:"kubeadmClientSecret,omitempty"`
+	// DatastoreSecret is the datastore connection Secret if its generation is enabled.
+	// +optional
+	DatastoreSecret string `json:"datastoreSecret,omitempty"`
+}
+
+// EndpointsSecretName returns the name of the Secret published with client URLs of members.
+func (r *EtcdCluster) EndpointsSecretName() string {
+	return r.Name + "-endpoints"
+}
+
+// KubeadmClientSecretName returns the name of the kubeadm-compatible client Secret, following the
+// naming of the Cluster API external etcd client Secret.
+func (r *EtcdCluster) KubeadmClientSecretName() string {
+	return r.Name + "-apiserver-etcd-client"
+}
+
+// DatastoreSecretName returns the name of the datastore connection Secret.
+func (r *EtcdCluster) DatastoreSecretName() string {
+	return r.Name + "-datastore"
+}
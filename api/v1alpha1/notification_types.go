@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NotificationEvent is a lifecycle event of a cluster sinks are notified of.
+// +kubebuilder:validation:Enum=Created;Ready;Degraded;BackupCompleted;BackupFailed;QuorumLost;UpgradeCompleted
+type NotificationEvent string
+
+const (
+	// NotificationCreated is sent when members and auxiliary objects of a new cluster are created.
+	NotificationCreated NotificationEvent = "Created"
+	// NotificationReady is sent when all members of the cluster become ready.
+	NotificationReady NotificationEvent = "Ready"
+	// NotificationDegraded is sent when members of the ready cluster stop being ready.
+	NotificationDegraded NotificationEvent = "Degraded"
+	// NotificationBackupCompleted is sent when a periodic snapshot is uploaded to all backup destinations.
+	NotificationBackupCompleted NotificationEvent = "BackupCompleted"
+	// NotificationBackupFailed is sent when a snapshot of the cluster can't be taken or verified.
+	NotificationBackupFailed NotificationEvent = "BackupFailed"
+	// NotificationQuorumLost is sent when less than a quorum of members is healthy.
+	NotificationQuorumLost NotificationEvent = "QuorumLost"
+	// NotificationUpgradeCompleted is sent when all members run the etcd version of a new image.
+	NotificationUpgradeCompleted NotificationEvent = "UpgradeCompleted"
+)
+
+// NotificationSinkType is the format notifications are posted to a sink in.
+// +kubebuilder:validation:Enum=Webhook;Slack;CloudEvents
+type NotificationSinkType string
+
+const (
+	// NotificationSinkWebhook posts notifications as JSON objects.
+	NotificationSinkWebhook NotificationSinkType = "Webhook"
+	// NotificationSinkSlack posts notifications as messages to Slack-compatible incoming webhooks.
+	NotificationSinkSlack NotificationSinkType = "Slack"
+	// NotificationSinkCloudEvents posts notifications as CloudEvents in the structured content mode.
+	NotificationSinkCloudEvents NotificationSinkType = "CloudEvents"
+)
+
+// NotificationSink is an HTTP endpoint notifications of lifecycle events are posted to.
+type NotificationSink struct {
+	// Name identifies the sink.
+	Name string `json:"name"`
+	// Type is the format notifications are posted in.
+	Type NotificationSinkType `json:"type"`
+	// URL is the URL notifications are posted to.
+	// +optional
+	URL string `json:"url,omitempty"`
+	// URLSecretRef references the key of a Secret in the cluster namespace with the URL, for URLs embedding
+	// credentials such as Slack incoming webhooks. Exactly one of URL and URLSecretRef has to be set.
+	// +optional
+	URLSecretRef *corev1.SecretKeySelector `json:"urlSecretRef,omitempty"`
+	// Events are events the sink is notified of, all events if empty.
+	// +optional
+	Events []NotificationEvent `json:"events,omitempty"`
+}
+
+// Notifies checks if the sink is notified of the event.
+func (s *NotificationSink) Notifies(event NotificationEvent) bool {
+	return len(s.Events) == 0 || slices.Contains(s.Events, event)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WorkflowPhase is the phase of a long-running operation.
+type WorkflowPhase string
+
+const (
+	// WorkflowPhaseRunning means the current step of the operation is being applied.
+	WorkflowPhaseRunning WorkflowPhase = "Running"
+	// WorkflowPhaseWaiting means the current step is applied and the operation waits for the cluster to catch up.
+	WorkflowPhaseWaiting WorkflowPhase = "Waiting"
+	// WorkflowPhaseRetrying means the last attempt of the current step failed and the step is retried.
+	WorkflowPhaseRetrying WorkflowPhase = "Retrying"
+)
+
+// WorkflowStep is a step of a long-running operation.
+type WorkflowStep string
+
+const (
+	// WorkflowStepResetMember means the member is re-registered in the cluster and its data volumes are deleted.
+	WorkflowStepResetMember WorkflowStep = "ResetMember"
+	// WorkflowStepRestartMember means the member pod is deleted to be recreated by the StatefulSet.
+	WorkflowStepRestartMember WorkflowStep = "RestartMember"
+	// WorkflowStepWaitForMember means the operation waits for the recreated member to become ready.
+	WorkflowStepWaitForMember WorkflowStep = "WaitForMember"
+	// WorkflowStepSoakMember means the operation waits for the recreated member to stay ready for the rollout soak
+	// of the size preset of the cluster.
+	WorkflowStepSoakMember WorkflowStep = "SoakMember"
+	// WorkflowStepChangeMembership means added members are registered as learners and removed members
+	// are removed from the cluster membership before the StatefulSet is scaled.
+	WorkflowStepChangeMembership WorkflowStep = "ChangeMembership"
+	// WorkflowStepScaleMembers means the operation waits for the StatefulSet to reach the desired number of members.
+	WorkflowStepScaleMembers WorkflowStep = "ScaleMembers"
+	// WorkflowStepPromoteLearners means added members are promoted to voting members once they catch up with the leader.
+	WorkflowStepPromoteLearners WorkflowStep = "PromoteLearners"
+	// WorkflowStepStopMembers means the operation waits for all member pods to be deleted.
+	WorkflowStepStopMembers WorkflowStep = "StopMembers"
+	// WorkflowStepRestoreData means data volumes of stopped members are restored by Jobs.
+	WorkflowStepRestoreData WorkflowStep = "RestoreData"
+	// WorkflowStepStartMembers means members are started with the restored data.
+	WorkflowStepStartMembers WorkflowStep = "StartMembers"
+)
+
+// WorkflowStatus defines the persisted state of a long-running operation of the cluster.
+type WorkflowStatus struct {
+	// Operation is the name of the operation, e.g. rollout, rotation or restore.
+	Operation string `json:"operation"`
+	// Member is the name of the member the operation is applied to, if any.
+	// +optional
+	Member string `json:"member,omitempty"`
+	// Phase is the phase of the current step.
+	Phase WorkflowPhase `json:"phase"`
+	// Step is the current step of the operation.
+	Step WorkflowStep `json:"step"`
+	// Retries is the number of failed attempts of the current step.
+	// +optional
+	Retries int32 `json:"retries,omitempty"`
+	// LastError is the error of the last failed attempt of the current step.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+	// StartTime is the time the operation started.
+	StartTime metav1.Time `json:"startTime"`
+	// StepStartTime is the time the current step started.
+	StepStartTime metav1.Time `json:"stepStartTime"`
+}
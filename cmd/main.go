@@ -17,25 +17,47 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"golang.org/x/net/http/httpproxy"
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/agent"
 	"github.com/aenix-io/etcd-operator/internal/controller"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/diagnostics"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+	"github.com/aenix-io/etcd-operator/internal/healthapi"
+	"github.com/aenix-io/etcd-operator/internal/inspect"
+	"github.com/aenix-io/etcd-operator/internal/inventory"
+	"github.com/aenix-io/etcd-operator/internal/notify"
+	"github.com/aenix-io/etcd-operator/internal/protection"
+	"github.com/aenix-io/etcd-operator/internal/registry"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -52,11 +74,60 @@ func init() {
 }
 
 func main() {
+	// the manager binary also serves as an agent running inside etcd member pods and operator Jobs
+	// and validates manifests offline
+	if len(os.Args) > 1 {
+		var run func(context.Context, []string) error
+		switch os.Args[1] {
+		case agent.RestoreCommand:
+			run = agent.RunRestore
+		case agent.VerifyCommand:
+			run = agent.RunVerify
+		case agent.MetricsCommand:
+			run = agent.RunMetrics
+		case validateCommand:
+			run = runValidate
+		}
+		if run != nil {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			err := run(ctx, os.Args[2:])
+			stop()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var agentImage string
+	var enableInPlaceResize bool
+	var maxReplicasChange int
+	var etcdctlAddr string
+	var etcdctlCertDir string
+	var healthAPIAddr string
+	var healthAPICertDir string
+	var inventoryAddr string
+	var inventoryCertDir string
+	var fips bool
+	var fipsImages string
+	var watchNamespace string
+	var probeQPS float64
+	var probeBurst int
+	var maxConcurrentProbes int
+	var enableDiagnostics bool
+	var secretProtection string
+	var defaultBackupPolicy string
+	var notificationSinks string
+	var fieldManager string
+	var checkImageArchitectures bool
+	var diagnosticsAddr string
+	var diagnosticsCertDir string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -66,6 +137,55 @@ func main() {
 		"If set the metrics endpoint is served securely")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&agentImage, "agent-image", factory.DefaultAgentImage,
+		"The operator image used to run agents inside etcd member pods.")
+	flag.BoolVar(&enableInPlaceResize, "enable-in-place-resize", true,
+		"If set, etcd container resources changes are applied by resizing member pods in place "+
+			"when the InPlacePodVerticalScaling feature is available, instead of restarting them.")
+	flag.IntVar(&maxReplicasChange, "max-replicas-change", etcdaenixiov1alpha1.DefaultMaxReplicasChange,
+		"The maximum number of members that can be added or removed by a single EtcdCluster update, 0 means no limit.")
+	flag.StringVar(&etcdctlAddr, "etcdctl-bind-address", "0",
+		"The address the read-only etcdctl API binds to. Use 0 to disable the API.")
+	flag.StringVar(&etcdctlCertDir, "etcdctl-cert-dir", "",
+		"The directory with tls.crt and tls.key of the etcdctl API, self-signed certificate is used if empty.")
+	flag.StringVar(&healthAPIAddr, "health-api-bind-address", "0",
+		"The address the cluster health API binds to. Use 0 to disable the API.")
+	flag.StringVar(&healthAPICertDir, "health-api-cert-dir", "",
+		"The directory with tls.crt and tls.key of the cluster health API, self-signed certificate is used if empty.")
+	flag.StringVar(&inventoryAddr, "inventory-bind-address", "0",
+		"The address the cluster inventory endpoint binds to. Use 0 to disable the endpoint.")
+	flag.StringVar(&inventoryCertDir, "inventory-cert-dir", "",
+		"The directory with tls.crt and tls.key of the cluster inventory endpoint, self-signed certificate is used if empty.")
+	flag.BoolVar(&fips, "fips", false,
+		"If set, clusters which don't configure FIPS mode explicitly run in FIPS mode.")
+	flag.StringVar(&fipsImages, "fips-images", "",
+		"Comma-separated list of image=fips-image pairs mapping images of member pods to their FIPS-compliant builds.")
+	flag.StringVar(&watchNamespace, "watch-namespace", "",
+		"If set, the operator manages clusters only in this namespace and never accesses cluster-scoped resources, "+
+			"so it can run with a Role instead of a ClusterRole.")
+	flag.Float64Var(&probeQPS, "probe-qps", 0,
+		"The maximum number of etcd API probes of members per second across all clusters, 0 means no limit.")
+	flag.IntVar(&probeBurst, "probe-burst", 0,
+		"The number of etcd API probes allowed in a row over --probe-qps. Defaults to --probe-qps.")
+	flag.IntVar(&maxConcurrentProbes, "max-concurrent-probes", 0,
+		"The maximum number of etcd API probes of members in flight across all clusters, 0 means no limit.")
+	flag.BoolVar(&enableDiagnostics, "diagnostics", false,
+		"If set, pprof profiles and expvar runtime variables are served to callers authorized to get their paths.")
+	flag.StringVar(&diagnosticsAddr, "diagnostics-bind-address", ":8446",
+		"The address the diagnostics endpoints bind to.")
+	flag.StringVar(&diagnosticsCertDir, "diagnostics-cert-dir", "",
+		"The directory with tls.crt and tls.key of the diagnostics endpoints, self-signed certificate is used if empty.")
+	flag.StringVar(&secretProtection, "secret-deletion-protection", string(protection.ModeBlock),
+		"How deletion of Secrets with backup storage credentials of clusters is handled: block, warn or disabled.")
+	flag.StringVar(&defaultBackupPolicy, "default-backup-policy", "",
+		"JSON encoded backup spec applied to clusters without their own, so every cluster is backed up.")
+	flag.StringVar(&notificationSinks, "notification-sinks", "",
+		"JSON encoded list of sinks notified of lifecycle events of all clusters, in addition to sinks of clusters.")
+	flag.StringVar(&fieldManager, "field-manager", factory.DefaultFieldManager,
+		"The field manager of writes of the operator, also stamped on generated objects in the etcd.aenix.io/owned-by annotation.")
+	flag.BoolVar(&checkImageArchitectures, "check-image-architectures", true,
+		"Check at admission that etcd images are built for the architectures of clusters by reading their manifests "+
+			"from image registries.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -74,6 +194,50 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	fipsImageMapping, err := factory.ParseImageMapping(fipsImages)
+	if err != nil {
+		setupLog.Error(err, "invalid FIPS images")
+		os.Exit(1)
+	}
+	if err = setDefaultBackupPolicy(defaultBackupPolicy); err != nil {
+		setupLog.Error(err, "invalid default backup policy")
+		os.Exit(1)
+	}
+	operatorSinks, err := parseNotificationSinks(notificationSinks)
+	if err != nil {
+		setupLog.Error(err, "invalid notification sinks")
+		os.Exit(1)
+	}
+	secretProtectionMode, err := protection.ParseMode(secretProtection)
+	if err != nil {
+		setupLog.Error(err, "invalid secret deletion protection")
+		os.Exit(1)
+	}
+	if err = validateFieldManager(fieldManager); err != nil {
+		setupLog.Error(err, "invalid field manager")
+		os.Exit(1)
+	}
+	restConfig := ctrl.GetConfigOrDie()
+	restConfig.UserAgent = userAgent(fieldManager)
+	nativeSidecars, err := nativeSidecarsSupported(restConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to get Kubernetes version")
+		os.Exit(1)
+	}
+	factory.Configure(factory.Settings{
+		AgentImage:     agentImage,
+		FIPS:           fips,
+		FIPSImages:     fipsImageMapping,
+		NativeSidecars: nativeSidecars,
+		Proxy:          proxyFromEnvironment(),
+		FieldManager:   fieldManager,
+	})
+	etcd.ConfigureProbes(etcd.ProbeLimits{
+		QPS:           probeQPS,
+		Burst:         probeBurst,
+		MaxConcurrent: maxConcurrentProbes,
+	})
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancelation and
@@ -94,8 +258,25 @@ func main() {
 		TLSOpts: tlsOpts,
 	})
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme: scheme,
+	namespaced := watchNamespace != ""
+	cacheOpts := cache.Options{
+		ByObject:         controller.CacheByObject(),
+		DefaultTransform: controller.StripManagedFields,
+	}
+	if namespaced {
+		// etcdctl and health APIs and diagnostics authenticate requests with cluster-scoped reviews
+		if etcdctlAddr != "0" || healthAPIAddr != "0" || enableDiagnostics {
+			setupLog.Error(nil, "etcdctl and health APIs and diagnostics can't be enabled when watching a single namespace")
+			os.Exit(1)
+		}
+		setupLog.Info("managing clusters in a single namespace", "namespace", watchNamespace)
+		cacheOpts.DefaultNamespaces = map[string]cache.Config{watchNamespace: {}}
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		Scheme:    scheme,
+		Cache:     cacheOpts,
+		NewClient: controller.NewClient,
 		Metrics: metricsserver.Options{
 			BindAddress:   metricsAddr,
 			SecureServing: secureMetrics,
@@ -105,38 +286,168 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "1b04a718.etcd.aenix.io",
-		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
-		// when the Manager ends. This requires the binary to immediately end when the
-		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
-		// speeds up voluntary leader transitions as the new leader don't have to wait
-		// LeaseDuration time first.
-		//
-		// In the default scaffold provided, the program ends immediately after
-		// the manager stops, so would be fine to enable this option. However,
-		// if you are doing or is intended to do any operation such as perform cleanups
-		// after the manager stops then its usage might be unsafe.
-		// LeaderElectionReleaseOnCancel: true,
+		// The leader steps down as soon as the manager stops, so the next leader resumes operations without
+		// waiting for the lease to expire. The program ends right after the manager stops, and operations in
+		// progress are recorded in the cluster status before every disruptive step.
+		LeaderElectionReleaseOnCancel: true,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	// events of clusters notify sinks of lifecycle events
+	clusterRecorder := &notify.Recorder{
+		EventRecorder: mgr.GetEventRecorderFor("etcdcluster-controller"),
+		Reader:        mgr.GetClient(),
+		Sinks:         operatorSinks,
+	}
 	if err = (&controller.EtcdClusterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:        controller.NewChangeRecordingClient(mgr.GetClient(), clusterRecorder),
+		Scheme:        mgr.GetScheme(),
+		Recorder:      clusterRecorder,
+		InPlaceResize: enableInPlaceResize,
+		Namespaced:    namespaced,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "EtcdCluster")
 		os.Exit(1)
 	}
+	if err = (&controller.EtcdKeySetReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("etcdkeyset-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EtcdKeySet")
+		os.Exit(1)
+	}
+	if err = (&controller.EtcdMirrorReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("etcdmirror-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EtcdMirror")
+		os.Exit(1)
+	}
+	if err = (&controller.EtcdOperationReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("etcdoperation-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EtcdOperation")
+		os.Exit(1)
+	}
+	if err = (&controller.EtcdBackupReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("etcdbackup-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EtcdBackup")
+		os.Exit(1)
+	}
+	if err = (&controller.EtcdBackupScheduleReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("etcdbackupschedule-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EtcdBackupSchedule")
+		os.Exit(1)
+	}
+	if err = (&controller.EtcdRestoreReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("etcdrestore-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EtcdRestore")
+		os.Exit(1)
+	}
+	if err = (&controller.RecommendationReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("recommendation-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Recommendation")
+		os.Exit(1)
+	}
+	if namespaced {
+		// Velero backups are kept in the Velero namespace
+		setupLog.Info("clusters are not quiesced before Velero backups when watching a single namespace")
+	} else if _, err = mgr.GetRESTMapper().RESTMapping(controller.VeleroBackupGVK.GroupKind(), controller.VeleroBackupGVK.Version); err == nil {
+		if err = (&controller.VeleroBackupReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor("velerobackup-controller"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "VeleroBackup")
+			os.Exit(1)
+		}
+	} else {
+		setupLog.Info("Velero is not installed, clusters are not quiesced before Velero backups")
+	}
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		etcdaenixiov1alpha1.SetMaxReplicasChange(int32(maxReplicasChange))
+		if checkImageArchitectures {
+			etcdaenixiov1alpha1.SetImageArchitecturesLookup((&registry.Client{}).Architectures)
+		}
 		if err = (&etcdaenixiov1alpha1.EtcdCluster{}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "EtcdCluster")
 			os.Exit(1)
 		}
+		if err = (&etcdaenixiov1alpha1.EtcdKeySet{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "EtcdKeySet")
+			os.Exit(1)
+		}
+		if err = (&protection.SecretValidator{
+			Client: mgr.GetClient(),
+			Mode:   secretProtectionMode,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Secret")
+			os.Exit(1)
+		}
 	}
 	//+kubebuilder:scaffold:builder
 
+	if etcdctlAddr != "0" {
+		if err = mgr.Add(&inspect.Server{
+			BindAddress: etcdctlAddr,
+			CertDir:     etcdctlCertDir,
+			Client:      mgr.GetClient(),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up etcdctl API")
+			os.Exit(1)
+		}
+	}
+	if healthAPIAddr != "0" {
+		if err = mgr.Add(&healthapi.Server{
+			BindAddress: healthAPIAddr,
+			CertDir:     healthAPICertDir,
+			Client:      mgr.GetClient(),
+			Informers:   mgr.GetCache(),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up cluster health API")
+			os.Exit(1)
+		}
+	}
+	if inventoryAddr != "0" {
+		if err = mgr.Add(&inventory.Server{
+			BindAddress: inventoryAddr,
+			CertDir:     inventoryCertDir,
+			Client:      mgr.GetClient(),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up cluster inventory")
+			os.Exit(1)
+		}
+	}
+	if enableDiagnostics {
+		if err = mgr.Add(&diagnostics.Server{
+			BindAddress: diagnosticsAddr,
+			CertDir:     diagnosticsCertDir,
+			Client:      mgr.GetClient(),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up diagnostics")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -152,3 +463,88 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// nativeSidecarsSupported checks if the API server supports native sidecar containers, enabled by default since 1.29.
+func nativeSidecarsSupported(config *rest.Config) (bool, error) {
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return false, err
+	}
+	info, err := client.ServerVersion()
+	if err != nil {
+		return false, err
+	}
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return false, err
+	}
+	return serverVersion.AtLeast(version.MajorMinor(1, 29)), nil
+}
+
+// proxyFromEnvironment returns the proxy the operator is configured with in its environment, passed to agents.
+func proxyFromEnvironment() etcdaenixiov1alpha1.ProxySpec {
+	config := httpproxy.FromEnvironment()
+	return etcdaenixiov1alpha1.ProxySpec{
+		HTTPProxy:  config.HTTPProxy,
+		HTTPSProxy: config.HTTPSProxy,
+		NoProxy:    config.NoProxy,
+	}
+}
+
+// setDefaultBackupPolicy configures the JSON encoded backup policy of clusters without their own.
+func setDefaultBackupPolicy(encoded string) error {
+	if encoded == "" {
+		return nil
+	}
+	policy := &etcdaenixiov1alpha1.ClusterBackupSpec{}
+	decoder := json.NewDecoder(strings.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(policy); err != nil {
+		return err
+	}
+	return etcdaenixiov1alpha1.SetDefaultBackupPolicy(policy)
+}
+
+// validateFieldManager checks the field manager can be used as the user agent prefix the API server derives
+// field managers of writes from.
+func validateFieldManager(manager string) error {
+	switch {
+	case manager == "":
+		return fmt.Errorf("field manager is empty")
+	case len(manager) > 128:
+		return fmt.Errorf("field manager %q is longer than 128 characters", manager)
+	case strings.ContainsAny(manager, "/ "):
+		return fmt.Errorf("field manager %q contains a slash or a space", manager)
+	}
+	return nil
+}
+
+// userAgent returns the default user agent with the field manager in place of the binary name. The API server
+// attributes writes without an explicit field manager to the user agent prefix, so all writes of the operator
+// are managed by the field manager.
+func userAgent(manager string) string {
+	_, suffix, _ := strings.Cut(rest.DefaultKubernetesUserAgent(), "/")
+	return manager + "/" + suffix
+}
+
+// parseNotificationSinks parses the JSON encoded list of sinks notified of events of all clusters. The sinks
+// don't belong to any namespace, so they can't reference Secrets.
+func parseNotificationSinks(encoded string) ([]etcdaenixiov1alpha1.NotificationSink, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	var sinks []etcdaenixiov1alpha1.NotificationSink
+	decoder := json.NewDecoder(strings.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&sinks); err != nil {
+		return nil, err
+	}
+	path := field.NewPath("notificationSinks")
+	allErrors := etcdaenixiov1alpha1.ValidateNotificationSinks(path, sinks)
+	for i, sink := range sinks {
+		if sink.URLSecretRef != nil {
+			allErrors = append(allErrors, field.Forbidden(path.Index(i).Child("urlSecretRef"), "sinks of the operator can't reference secrets"))
+		}
+	}
+	return sinks, allErrors.ToAggregate()
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aenix-io/etcd-operator/pkg/lint"
+)
+
+// validateCommand validates EtcdCluster manifests offline with the rules of the admission webhook.
+const validateCommand = "validate"
+
+// runValidate validates clusters in the files given with -f, "-" reads the standard input. It prints every
+// rejected cluster and warnings and fails if any cluster is rejected.
+func runValidate(_ context.Context, args []string) error {
+	var files []string
+	fs := flag.NewFlagSet(validateCommand, flag.ContinueOnError)
+	fs.Func("f", "File with EtcdCluster manifests, - for the standard input. Can be repeated.", func(file string) error {
+		files = append(files, file)
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("at least one file must be specified with -f")
+	}
+
+	invalid := 0
+	for _, file := range files {
+		results, err := validateFile(file)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", file, err)
+		}
+		for _, result := range results {
+			for _, warning := range result.Warnings {
+				fmt.Printf("%s: %s: warning: %s\n", file, result.Name, warning)
+			}
+			if result.Err != nil {
+				invalid++
+				fmt.Printf("%s: %s: %s\n", file, result.Name, result.Err)
+			}
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d clusters are invalid", invalid)
+	}
+	return nil
+}
+
+func validateFile(file string) ([]lint.Result, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return lint.Manifests(r)
+}
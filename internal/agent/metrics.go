@@ -0,0 +1,131 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"syscall"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"go.uber.org/zap"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// MetricsCommand is the name of the subcommand serving usage metrics of member volumes.
+	MetricsCommand = "metrics"
+	// MetricsPort is the port usage metrics of member volumes are served on.
+	MetricsPort = 2383
+	// MetricsPath is the HTTP path of usage metrics of member volumes.
+	MetricsPath = "/metrics"
+)
+
+// volume is a member volume metrics are served for.
+type volume struct {
+	name string
+	path string
+}
+
+// RunMetrics serves usage metrics of member data and WAL volumes in the Prometheus text format until
+// the context is cancelled. etcd does not report free space of its volumes, which is needed to alert before
+// the database or WAL fill them up.
+func RunMetrics(ctx context.Context, args []string) error {
+	var dataDir, walDir, address string
+	fs := flag.NewFlagSet(MetricsCommand, flag.ContinueOnError)
+	fs.StringVar(&dataDir, "data-dir", "", "Directory the member data volume is mounted to.")
+	fs.StringVar(&walDir, "wal-dir", "", "Directory the dedicated member WAL volume is mounted to, if any.")
+	fs.StringVar(&address, "address", fmt.Sprintf(":%d", MetricsPort), "The address metrics are served on.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if dataDir == "" {
+		return errors.New("data directory must be specified")
+	}
+	volumes := []volume{{name: "data", path: dataDir}}
+	if walDir != "" {
+		volumes = append(volumes, volume{name: "wal", path: walDir})
+	}
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(MetricsPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", string(expfmt.FmtText))
+		for _, family := range volumeMetrics(volumes, logger) {
+			if len(family.Metric) == 0 {
+				continue
+			}
+			if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+				return
+			}
+		}
+	})
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	logger.Info("serving volume metrics", zap.String("address", address))
+	if err = server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// volumeMetrics returns capacity and available space of the volumes. Volumes which cannot be inspected are skipped.
+func volumeMetrics(volumes []volume, logger *zap.Logger) []*dto.MetricFamily {
+	capacity := &dto.MetricFamily{
+		Name: ptr.To("etcd_member_volume_capacity_bytes"),
+		Help: ptr.To("Capacity of the member volume in bytes."),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	available := &dto.MetricFamily{
+		Name: ptr.To("etcd_member_volume_available_bytes"),
+		Help: ptr.To("Space of the member volume available to etcd in bytes."),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	for _, v := range volumes {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(v.path, &stat); err != nil {
+			logger.Warn("cannot inspect volume", zap.String("volume", v.name), zap.Error(err))
+			continue
+		}
+		labels := []*dto.LabelPair{{Name: ptr.To("volume"), Value: ptr.To(v.name)}}
+		blockSize := float64(stat.Bsize)
+		capacity.Metric = append(capacity.Metric, &dto.Metric{
+			Label: labels,
+			Gauge: &dto.Gauge{Value: ptr.To(float64(stat.Blocks) * blockSize)},
+		})
+		available.Metric = append(available.Metric, &dto.Metric{
+			Label: labels,
+			Gauge: &dto.Gauge{Value: ptr.To(float64(stat.Bavail) * blockSize)},
+		})
+	}
+	return []*dto.MetricFamily{capacity, available}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package agent implements operator subcommands which run inside etcd member pods and operator Jobs.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+)
+
+const (
+	// RestoreCommand is the name of the subcommand restoring member data directory from a snapshot.
+	RestoreCommand = "restore"
+	// RestoreSnapshotEnv is the environment variable with the key of the snapshot to restore from.
+	// Restore is skipped if it is empty.
+	RestoreSnapshotEnv = "RESTORE_SNAPSHOT_KEY"
+	// RestoreProgressPort is the port the restore container serves progress of the restore on.
+	RestoreProgressPort = 2382
+	// RestoreProgressPath is the HTTP path of the restore progress.
+	RestoreProgressPath = "/progress"
+)
+
+// RunRestore restores member data directory from the snapshot if restore is requested.
+func RunRestore(ctx context.Context, args []string) error {
+	var (
+		destination     string
+		credentialsDir  string
+		progressAddress string
+		opts            backup.RestoreOptions
+	)
+	fs := flag.NewFlagSet(RestoreCommand, flag.ContinueOnError)
+	fs.StringVar(&destination, "destination", "", "JSON encoded backup destination.")
+	fs.StringVar(&credentialsDir, "credentials-dir", "", "Directory the backup storage credentials are mounted to.")
+	fs.StringVar(&opts.DataDir, "data-dir", "", "Data directory of the member.")
+	fs.StringVar(&opts.WALDir, "wal-dir", "", "Dedicated WAL directory of the member.")
+	fs.StringVar(&opts.Name, "name", os.Getenv("POD_NAME"), "Name of the member.")
+	fs.StringVar(&opts.PeerURL, "peer-url", "", "Advertised peer URL of the member.")
+	fs.StringVar(&opts.InitialCluster, "initial-cluster", os.Getenv("ETCD_INITIAL_CLUSTER"),
+		"Initial cluster configuration of the restored cluster.")
+	fs.StringVar(&opts.InitialClusterToken, "initial-cluster-token", os.Getenv("ETCD_INITIAL_CLUSTER_TOKEN"),
+		"Initial cluster token of the restored cluster.")
+	fs.StringVar(&progressAddress, "progress-address", fmt.Sprintf(":%d", RestoreProgressPort),
+		"The address progress of the restore is served on, empty to disable.")
+	fs.BoolVar(&opts.Overwrite, "overwrite", false,
+		"Replace existing data directory unless it is already restored from the snapshot.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return err
+	}
+	key := os.Getenv(RestoreSnapshotEnv)
+	if key == "" {
+		logger.Info("restore is not requested")
+		return nil
+	}
+
+	dest := &etcdaenixiov1alpha1.BackupDestination{}
+	if err = json.Unmarshal([]byte(destination), dest); err != nil {
+		return fmt.Errorf("cannot parse backup destination: %w", err)
+	}
+	credentials, err := backup.LoadCredentials(credentialsDir)
+	if err != nil {
+		return err
+	}
+	storage, err := backup.NewStorage(dest, credentials)
+	if err != nil {
+		return err
+	}
+
+	opts.Progress = &backup.Progress{}
+	if progressAddress != "" {
+		server := &http.Server{
+			Addr:              progressAddress,
+			Handler:           progressHandler(opts.Progress),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				logger.Warn("cannot serve restore progress", zap.Error(err))
+			}
+		}()
+		defer func() {
+			_ = server.Close()
+		}()
+	}
+
+	logger.Info("restoring member data", zap.String("snapshot", key), zap.String("member", opts.Name))
+	return backup.Restore(ctx, storage, key, opts, logger)
+}
+
+// progressHandler serves the current progress of the restore as JSON.
+func progressHandler(progress *backup.Progress) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(RestoreProgressPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(progress.Report())
+	})
+	return mux
+}
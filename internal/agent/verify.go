@@ -0,0 +1,73 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+)
+
+// VerifyCommand is the name of the subcommand checking that a snapshot can be restored.
+const VerifyCommand = "verify"
+
+// RunVerify restores the snapshot into a scratch directory and fails if it is broken.
+func RunVerify(ctx context.Context, args []string) error {
+	var destination, credentialsDir, key, workDir string
+	fs := flag.NewFlagSet(VerifyCommand, flag.ContinueOnError)
+	fs.StringVar(&destination, "destination", "", "JSON encoded backup destination.")
+	fs.StringVar(&credentialsDir, "credentials-dir", "", "Directory the backup storage credentials are mounted to.")
+	fs.StringVar(&key, "snapshot", "", "Storage key of the snapshot to verify.")
+	fs.StringVar(&workDir, "work-dir", "", "Directory the snapshot is restored to.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if key == "" || workDir == "" {
+		return errors.New("snapshot and work directory must be specified")
+	}
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return err
+	}
+	dest := &etcdaenixiov1alpha1.BackupDestination{}
+	if err = json.Unmarshal([]byte(destination), dest); err != nil {
+		return fmt.Errorf("cannot parse backup destination: %w", err)
+	}
+	credentials, err := backup.LoadCredentials(credentialsDir)
+	if err != nil {
+		return err
+	}
+	storage, err := backup.NewStorage(dest, credentials)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("verifying snapshot", zap.String("snapshot", key))
+	if err = backup.Verify(ctx, storage, key, workDir, logger); err != nil {
+		return err
+	}
+	logger.Info("snapshot verified", zap.String("snapshot", key))
+	return nil
+}
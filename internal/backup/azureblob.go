@@ -0,0 +1,502 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// AzureConnectionString is the key of the connection string of the storage account in the Azure credentials secret.
+	AzureConnectionString = "connectionString"
+
+	azureAPIVersion            = "2021-08-06"
+	azureDefaultEndpointSuffix = "core.windows.net"
+	azureStorageScope          = "https://storage.azure.com/.default"
+	azureStorageResource       = "https://storage.azure.com/"
+	azureIMDSEndpoint          = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureDefaultAuthorityHost  = "https://login.microsoftonline.com/"
+	azureTokenTimeout          = 30 * time.Second
+	// azureBlockSize is the size of blocks snapshots are uploaded in.
+	azureBlockSize = 16 << 20
+)
+
+// azureBlobStorage stores blobs in an Azure Blob Storage container using the REST API. Requests are signed with
+// the account key, authorized by a shared access signature or by tokens of a managed identity. Snapshots are
+// streamed, so they are uploaded in blocks committed once the snapshot is read.
+type azureBlobStorage struct {
+	client    *http.Client
+	endpoint  string
+	account   string
+	container string
+	// key is the account key requests are signed with, nil if requests are authorized otherwise.
+	key []byte
+	// sas is the shared access signature added to requests.
+	sas       url.Values
+	blockSize int
+}
+
+func newAzureBlobStorage(
+	destination *etcdaenixiov1alpha1.AzureBlobDestination,
+	proxy *etcdaenixiov1alpha1.ProxySpec,
+	creds map[string][]byte,
+) (*azureBlobStorage, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = proxyFunc(proxy)
+	}
+	s := &azureBlobStorage{
+		client:    &http.Client{Transport: transport},
+		account:   destination.Account,
+		container: destination.Container,
+		blockSize: azureBlockSize,
+	}
+	scheme, suffix := "https", destination.EndpointSuffix
+	if suffix == "" {
+		suffix = azureDefaultEndpointSuffix
+	}
+	if connectionString, ok := creds[AzureConnectionString]; ok {
+		settings := parseAzureConnectionString(string(connectionString))
+		if name := settings["AccountName"]; name != "" {
+			if s.account != "" && s.account != name {
+				return nil, fmt.Errorf("account %s doesn't match account %s of the connection string", s.account, name)
+			}
+			s.account = name
+		}
+		if protocol := settings["DefaultEndpointsProtocol"]; protocol != "" {
+			scheme = protocol
+		}
+		if endpointSuffix := settings["EndpointSuffix"]; endpointSuffix != "" {
+			suffix = endpointSuffix
+		}
+		s.endpoint = strings.TrimSuffix(settings["BlobEndpoint"], "/")
+		var err error
+		switch {
+		case settings["AccountKey"] != "":
+			if s.account == "" {
+				return nil, errors.New("connection string with an account key has no account name")
+			}
+			if s.key, err = base64.StdEncoding.DecodeString(settings["AccountKey"]); err != nil {
+				return nil, fmt.Errorf("invalid account key: %w", err)
+			}
+		case settings["SharedAccessSignature"] != "":
+			if s.sas, err = url.ParseQuery(strings.TrimPrefix(settings["SharedAccessSignature"], "?")); err != nil {
+				return nil, fmt.Errorf("invalid shared access signature: %w", err)
+			}
+		default:
+			return nil, errors.New("connection string has neither an account key nor a shared access signature")
+		}
+	} else {
+		tokens := azureTokenSource(destination.ClientID, transport)
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, s.client)
+		s.client = oauth2.NewClient(ctx, oauth2.ReuseTokenSource(nil, tokens))
+	}
+	if s.endpoint == "" {
+		if s.account == "" {
+			return nil, errors.New("storage account is not specified")
+		}
+		s.endpoint = fmt.Sprintf("%s://%s.blob.%s", scheme, s.account, suffix)
+	}
+	return s, nil
+}
+
+// parseAzureConnectionString parses the settings of a connection string such as
+// DefaultEndpointsProtocol=https;AccountName=account;AccountKey=key;EndpointSuffix=core.windows.net.
+func parseAzureConnectionString(connectionString string) map[string]string {
+	settings := map[string]string{}
+	for _, setting := range strings.Split(strings.TrimSpace(connectionString), ";") {
+		// values such as keys and signatures contain '='
+		if name, value, ok := strings.Cut(setting, "="); ok {
+			settings[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return settings
+}
+
+func (s *azureBlobStorage) Upload(ctx context.Context, key string, r io.Reader, tags map[string]string) error {
+	if err := s.upload(ctx, key, r, tags); err != nil {
+		return fmt.Errorf("cannot upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *azureBlobStorage) upload(ctx context.Context, key string, r io.Reader, tags map[string]string) error {
+	header := http.Header{}
+	if len(tags) > 0 {
+		values := url.Values{}
+		for name, value := range tags {
+			values.Set(name, value)
+		}
+		header.Set("x-ms-tags", strings.ReplaceAll(values.Encode(), "+", "%20"))
+	}
+	buf := make([]byte, s.blockSize)
+	var blocks []string
+	for {
+		n, err := io.ReadFull(r, buf)
+		last := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !last {
+			return err
+		}
+		if last && len(blocks) == 0 {
+			// the blob fits into a single request
+			header.Set("x-ms-blob-type", "BlockBlob")
+			return s.send(ctx, http.MethodPut, s.blobURL(key, nil), buf[:n], header, http.StatusCreated)
+		}
+		if n > 0 {
+			// block IDs of a blob have to be of the same length
+			id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", len(blocks))))
+			query := url.Values{"comp": {"block"}, "blockid": {id}}
+			if err = s.send(ctx, http.MethodPut, s.blobURL(key, query), buf[:n], nil, http.StatusCreated); err != nil {
+				return err
+			}
+			blocks = append(blocks, id)
+		}
+		if last {
+			break
+		}
+	}
+	var blockList bytes.Buffer
+	blockList.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for _, id := range blocks {
+		blockList.WriteString("<Latest>" + id + "</Latest>")
+	}
+	blockList.WriteString("</BlockList>")
+	header.Set("Content-Type", "application/xml")
+	return s.send(ctx, http.MethodPut, s.blobURL(key, url.Values{"comp": {"blocklist"}}), blockList.Bytes(), header,
+		http.StatusCreated)
+}
+
+func (s *azureBlobStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.blobURL(key, nil), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download %s: %w", key, err)
+	}
+	return httpObject{ReadCloser: resp.Body, size: resp.ContentLength}, nil
+}
+
+func (s *azureBlobStorage) Delete(ctx context.Context, key string) error {
+	err := s.send(ctx, http.MethodDelete, s.blobURL(key, nil), nil, nil, http.StatusAccepted)
+	var notFound azureNotFoundError
+	if err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("cannot delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *azureBlobStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {prefix}}
+	for {
+		resp, err := s.do(ctx, http.MethodGet, s.containerURL(query), nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list blobs: %w", err)
+		}
+		var page struct {
+			Blobs struct {
+				Blob []struct{ Name string }
+			}
+			NextMarker string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot list blobs: %w", err)
+		}
+		for _, blob := range page.Blobs.Blob {
+			keys = append(keys, blob.Name)
+		}
+		if page.NextMarker == "" {
+			// blobs are listed in lexicographic order
+			return keys, nil
+		}
+		query.Set("marker", page.NextMarker)
+	}
+}
+
+// containerURL returns the URL of the container with the query and the shared access signature.
+func (s *azureBlobStorage) containerURL(query url.Values) string {
+	return s.withQuery(s.endpoint+"/"+url.PathEscape(s.container), query)
+}
+
+// blobURL returns the URL of the blob with the query and the shared access signature.
+func (s *azureBlobStorage) blobURL(key string, query url.Values) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return s.withQuery(s.endpoint+"/"+url.PathEscape(s.container)+"/"+strings.Join(segments, "/"), query)
+}
+
+func (s *azureBlobStorage) withQuery(u string, query url.Values) string {
+	values := url.Values{}
+	for name, value := range s.sas {
+		values[name] = value
+	}
+	for name, value := range query {
+		values[name] = value
+	}
+	if len(values) > 0 {
+		u += "?" + values.Encode()
+	}
+	return u
+}
+
+// send sends the request with the body and returns an error unless the response has one of the statuses.
+func (s *azureBlobStorage) send(
+	ctx context.Context,
+	method, u string,
+	body []byte,
+	header http.Header,
+	statuses ...int,
+) error {
+	resp, err := s.do(ctx, method, u, body, header)
+	if err != nil {
+		return err
+	}
+	return checkAzureResponse(resp, statuses...)
+}
+
+// do sends the request and returns the response if it succeeded. The caller is responsible for closing its body.
+func (s *azureBlobStorage) do(
+	ctx context.Context,
+	method, u string,
+	body []byte,
+	header http.Header,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if s.key != nil {
+		s.sign(req)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, checkAzureResponse(resp)
+	}
+	return resp, nil
+}
+
+// sign signs the request with the account key using the Shared Key authorization scheme.
+func (s *azureBlobStorage) sign(req *http.Request) {
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+	var b strings.Builder
+	for _, value := range []string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		// the date is passed in x-ms-date
+		"",
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	} {
+		b.WriteString(value + "\n")
+	}
+	var names []string
+	for name := range req.Header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-ms-") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		b.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	b.WriteString("/" + s.account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for name := range query {
+		params = append(params, name)
+	}
+	slices.Sort(params)
+	for _, name := range params {
+		values := slices.Clone(query[name])
+		slices.Sort(values)
+		b.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(values, ","))
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(b.String()))
+	req.Header.Set("Authorization", "SharedKey "+s.account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// azureNotFoundError is returned for requests to missing blobs.
+type azureNotFoundError struct {
+	error
+}
+
+// checkAzureResponse closes the body of the response and returns an error unless it has one of the statuses.
+func checkAzureResponse(resp *http.Response, statuses ...int) error {
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if slices.Contains(statuses, resp.StatusCode) {
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := fmt.Errorf("azure returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	if resp.StatusCode == http.StatusNotFound {
+		return azureNotFoundError{err}
+	}
+	return err
+}
+
+// azureTokenSource returns the source of storage tokens of the managed identity: the federated identity
+// of Azure Workload Identity if its token is mounted into the pod, or the managed identity of the node
+// from the instance metadata service otherwise.
+func azureTokenSource(clientID string, transport *http.Transport) oauth2.TokenSource {
+	if tokenFile := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); tokenFile != "" {
+		if clientID == "" {
+			clientID = os.Getenv("AZURE_CLIENT_ID")
+		}
+		authorityHost := os.Getenv("AZURE_AUTHORITY_HOST")
+		if authorityHost == "" {
+			authorityHost = azureDefaultAuthorityHost
+		}
+		return &azureWorkloadIdentity{
+			client:        &http.Client{Transport: transport, Timeout: azureTokenTimeout},
+			authorityHost: authorityHost,
+			tenantID:      os.Getenv("AZURE_TENANT_ID"),
+			clientID:      clientID,
+			tokenFile:     tokenFile,
+		}
+	}
+	// the instance metadata service is link-local, so it is never reached through a proxy
+	imds := transport.Clone()
+	imds.Proxy = nil
+	return &azureManagedIdentity{
+		client:   &http.Client{Transport: imds, Timeout: azureTokenTimeout},
+		endpoint: azureIMDSEndpoint,
+		clientID: clientID,
+	}
+}
+
+// azureWorkloadIdentity exchanges the service account token of the pod for tokens of the federated identity.
+type azureWorkloadIdentity struct {
+	client        *http.Client
+	authorityHost string
+	tenantID      string
+	clientID      string
+	tokenFile     string
+}
+
+func (t *azureWorkloadIdentity) Token() (*oauth2.Token, error) {
+	// the token is rotated by the kubelet
+	assertion, err := os.ReadFile(t.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read federated token: %w", err)
+	}
+	resp, err := t.client.PostForm(strings.TrimSuffix(t.authorityHost, "/")+"/"+t.tenantID+"/oauth2/v2.0/token", url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {t.clientID},
+		"scope":                 {azureStorageScope},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot request workload identity token: %w", err)
+	}
+	return decodeAzureToken(resp)
+}
+
+// azureManagedIdentity requests tokens of the managed identity of the node from the instance metadata service.
+type azureManagedIdentity struct {
+	client   *http.Client
+	endpoint string
+	// clientID selects a user-assigned identity, the system-assigned identity is used if it is empty.
+	clientID string
+}
+
+func (t *azureManagedIdentity) Token() (*oauth2.Token, error) {
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {azureStorageResource}}
+	if t.clientID != "" {
+		query.Set("client_id", t.clientID)
+	}
+	req, err := http.NewRequest(http.MethodGet, t.endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot request managed identity token: %w", err)
+	}
+	return decodeAzureToken(resp)
+}
+
+// decodeAzureToken decodes the token response of Microsoft Entra ID or of the instance metadata service.
+func decodeAzureToken(resp *http.Response) (*oauth2.Token, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, checkAzureResponse(resp)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var token struct {
+		AccessToken string `json:"access_token"`
+		// the instance metadata service returns the expiry as a string
+		ExpiresIn json.Number `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("cannot decode token: %w", err)
+	}
+	expiresIn, err := token.ExpiresIn.Int64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid token expiry: %w", err)
+	}
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(time.Duration(expiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// fakeAzureBlob serves the part of the Blob Storage REST API used by the storage.
+type fakeAzureBlob struct {
+	mu     sync.Mutex
+	blobs  map[string][]byte
+	tags   map[string]url.Values
+	blocks map[string][]byte
+	// requests counts requests uploading blobs and blocks.
+	requests int
+}
+
+func (f *fakeAzureBlob) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	Expect(r.Header.Get("x-ms-version")).To(Equal(azureAPIVersion))
+	Expect(r.Header.Get("Authorization")).To(HavePrefix("SharedKey account:"))
+	query := r.URL.Query()
+	if r.URL.Path == "/backups" {
+		Expect(r.Method).To(Equal(http.MethodGet))
+		Expect(query.Get("restype")).To(Equal("container"))
+		Expect(query.Get("comp")).To(Equal("list"))
+		var names []string
+		for name := range f.blobs {
+			if strings.HasPrefix(name, query.Get("prefix")) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		// pages of a single blob
+		start, _ := strconv.Atoi(query.Get("marker"))
+		var page struct {
+			XMLName    xml.Name `xml:"EnumerationResults"`
+			Names      []string `xml:"Blobs>Blob>Name"`
+			NextMarker string
+		}
+		if start < len(names) {
+			page.Names = names[start : start+1]
+		}
+		if start+1 < len(names) {
+			page.NextMarker = strconv.Itoa(start + 1)
+		}
+		Expect(xml.NewEncoder(w).Encode(page)).To(Succeed())
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/backups/")
+	switch {
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		data, _ := io.ReadAll(r.Body)
+		f.blocks[name+"#"+query.Get("blockid")] = data
+		f.requests++
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var list struct {
+			Latest []string
+		}
+		Expect(xml.NewDecoder(r.Body).Decode(&list)).To(Succeed())
+		var data []byte
+		for _, id := range list.Latest {
+			block, ok := f.blocks[name+"#"+id]
+			Expect(ok).To(BeTrue())
+			data = append(data, block...)
+		}
+		f.put(name, data, r.Header.Get("x-ms-tags"))
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut:
+		Expect(r.Header.Get("x-ms-blob-type")).To(Equal("BlockBlob"))
+		data, _ := io.ReadAll(r.Body)
+		f.put(name, data, r.Header.Get("x-ms-tags"))
+		f.requests++
+		w.WriteHeader(http.StatusCreated)
+	case f.blobs[name] == nil:
+		http.Error(w, "<Error><Code>BlobNotFound</Code></Error>", http.StatusNotFound)
+	case r.Method == http.MethodDelete:
+		delete(f.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodGet:
+		w.Header().Set("Content-Length", strconv.Itoa(len(f.blobs[name])))
+		_, _ = w.Write(f.blobs[name])
+	default:
+		http.Error(w, fmt.Sprintf("unexpected %s %s", r.Method, r.URL), http.StatusBadRequest)
+	}
+}
+
+func (f *fakeAzureBlob) put(name string, data []byte, tags string) {
+	f.blobs[name] = append([]byte{}, data...)
+	f.tags[name], _ = url.ParseQuery(tags)
+}
+
+var _ = Describe("Azure Blob storage", func() {
+	var (
+		azure   *fakeAzureBlob
+		storage *azureBlobStorage
+	)
+
+	BeforeEach(func() {
+		azure = &fakeAzureBlob{blobs: map[string][]byte{}, tags: map[string]url.Values{}, blocks: map[string][]byte{}}
+		server := httptest.NewServer(azure)
+		DeferCleanup(server.Close)
+		storage = &azureBlobStorage{
+			client:    server.Client(),
+			endpoint:  server.URL,
+			account:   "account",
+			container: "backups",
+			key:       []byte("key"),
+			blockSize: 4,
+		}
+	})
+
+	It("should upload snapshots in blocks with tags", func(ctx SpecContext) {
+		tags := map[string]string{"env": "prod", "team": "platform team"}
+		Expect(storage.Upload(ctx, "ns/test/1.db", strings.NewReader("snapshot!"), tags)).To(Succeed())
+		Expect(string(azure.blobs["ns/test/1.db"])).To(Equal("snapshot!"))
+		Expect(azure.tags["ns/test/1.db"]).To(Equal(url.Values{"env": {"prod"}, "team": {"platform team"}}))
+		Expect(azure.requests).To(Equal(3))
+
+		// small blobs are uploaded in a single request
+		Expect(storage.Upload(ctx, "ns/test/1.db.json", strings.NewReader("{}"), nil)).To(Succeed())
+		Expect(string(azure.blobs["ns/test/1.db.json"])).To(Equal("{}"))
+		Expect(azure.requests).To(Equal(4))
+	})
+
+	It("should download, list and delete blobs", func(ctx SpecContext) {
+		azure.blobs["ns/test/1.db"] = []byte("one")
+		azure.blobs["ns/test/2.db"] = []byte("two")
+		azure.blobs["ns/other/1.db"] = []byte("other")
+
+		keys, err := storage.List(ctx, "ns/test/")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(Equal([]string{"ns/test/1.db", "ns/test/2.db"}))
+
+		rc, err := storage.Download(ctx, "ns/test/2.db")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rc.(sizer).Size()).To(Equal(int64(3)))
+		data, err := io.ReadAll(rc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rc.Close()).To(Succeed())
+		Expect(string(data)).To(Equal("two"))
+
+		Expect(storage.Delete(ctx, "ns/test/1.db")).To(Succeed())
+		Expect(storage.Delete(ctx, "ns/test/1.db")).To(Succeed())
+		Expect(azure.blobs).NotTo(HaveKey("ns/test/1.db"))
+
+		_, err = storage.Download(ctx, "ns/test/1.db")
+		Expect(err).To(MatchError(ContainSubstring("BlobNotFound")))
+	})
+
+	It("should configure the storage from connection strings", func() {
+		key := base64.StdEncoding.EncodeToString([]byte("key"))
+		destination := &etcdaenixiov1alpha1.AzureBlobDestination{Container: "backups"}
+		s, err := newAzureBlobStorage(destination, nil, map[string][]byte{
+			AzureConnectionString: []byte("DefaultEndpointsProtocol=https;AccountName=account;AccountKey=" + key +
+				";EndpointSuffix=core.chinacloudapi.cn"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.endpoint).To(Equal("https://account.blob.core.chinacloudapi.cn"))
+		Expect(s.key).To(Equal([]byte("key")))
+
+		s, err = newAzureBlobStorage(destination, nil, map[string][]byte{
+			AzureConnectionString: []byte("BlobEndpoint=http://azurite:10000/account/;SharedAccessSignature=sv=2021-08-06&sig=a%2Bb"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.blobURL("ns/1.db", nil)).To(Equal("http://azurite:10000/account/backups/ns/1.db?sig=a%2Bb&sv=2021-08-06"))
+
+		destination.Account = "other"
+		_, err = newAzureBlobStorage(destination, nil, map[string][]byte{
+			AzureConnectionString: []byte("AccountName=account;AccountKey=" + key),
+		})
+		Expect(err).To(MatchError(ContainSubstring("doesn't match")))
+	})
+
+	It("should request tokens of managed identities", func() {
+		var requests []*http.Request
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			requests = append(requests, r)
+			if r.Method == http.MethodGet {
+				_, _ = io.WriteString(w, `{"access_token": "imds", "expires_in": "3599"}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{"access_token": "federated", "expires_in": 3599}`)
+		}))
+		DeferCleanup(server.Close)
+
+		token, err := (&azureManagedIdentity{client: server.Client(), endpoint: server.URL, clientID: "node"}).Token()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("imds"))
+		Expect(requests[0].Header.Get("Metadata")).To(Equal("true"))
+		Expect(requests[0].Form.Get("client_id")).To(Equal("node"))
+		Expect(requests[0].Form.Get("resource")).To(Equal(azureStorageResource))
+
+		tokenFile := filepath.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(tokenFile, []byte("service-account-token"), 0o600)).To(Succeed())
+		token, err = (&azureWorkloadIdentity{
+			client:        server.Client(),
+			authorityHost: server.URL + "/",
+			tenantID:      "tenant",
+			clientID:      "client",
+			tokenFile:     tokenFile,
+		}).Token()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("federated"))
+		Expect(requests[1].URL.Path).To(Equal("/tenant/oauth2/v2.0/token"))
+		Expect(requests[1].Form.Get("client_assertion")).To(Equal("service-account-token"))
+		Expect(requests[1].Form.Get("scope")).To(Equal(azureStorageScope))
+	})
+})
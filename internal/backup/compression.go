@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// newCompressor returns a writer compressing data written to it to w with the algorithm. The writer has to be closed
+// to flush the compressed data.
+func newCompressor(w io.Writer, compression etcdaenixiov1alpha1.BackupCompression) (io.WriteCloser, error) {
+	switch compression {
+	case "", etcdaenixiov1alpha1.BackupCompressionNone:
+		return nopWriteCloser{w}, nil
+	case etcdaenixiov1alpha1.BackupCompressionGzip:
+		return gzip.NewWriter(w), nil
+	case etcdaenixiov1alpha1.BackupCompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unsupported compression %s", compression)
+}
+
+// newDecompressor returns a reader decompressing data compressed with the algorithm read from r.
+func newDecompressor(r io.Reader, compression etcdaenixiov1alpha1.BackupCompression) (io.ReadCloser, error) {
+	switch compression {
+	case "", etcdaenixiov1alpha1.BackupCompressionNone:
+		return io.NopCloser(r), nil
+	case etcdaenixiov1alpha1.BackupCompressionGzip:
+		return gzip.NewReader(r)
+	case etcdaenixiov1alpha1.BackupCompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported compression %s", compression)
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// boltMagic is the magic number of bbolt databases, which etcd snapshots are, stored in their first meta page
+// after the page header.
+const (
+	boltMagic       = 0xED0CDAED
+	boltMagicOffset = 16
+)
+
+// detectCompression returns the algorithm the snapshot read from r is compressed with, found by its leading bytes,
+// falling back to the algorithm it is known to be compressed with if the bytes are not recognized.
+// It fails if neither tells the algorithm, rather than restoring compressed bytes as a database.
+func detectCompression(r *bufio.Reader, known etcdaenixiov1alpha1.BackupCompression) (etcdaenixiov1alpha1.BackupCompression, error) {
+	head, err := r.Peek(boltMagicOffset + 4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return etcdaenixiov1alpha1.BackupCompressionGzip, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		return etcdaenixiov1alpha1.BackupCompressionZstd, nil
+	case len(head) == boltMagicOffset+4 && binary.LittleEndian.Uint32(head[boltMagicOffset:]) == boltMagic:
+		return etcdaenixiov1alpha1.BackupCompressionNone, nil
+	case known != "":
+		return known, nil
+	}
+	return "", errors.New("cannot determine compression")
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// EncryptionKey is the name the key snapshots are encrypted with is passed to the storage with.
+	EncryptionKey = "encryptionKey"
+
+	// encryptionMagic starts encrypted objects, it can't be the start of a bbolt database.
+	encryptionMagic = "etcdenc1"
+	// encryptionChunkSize is the size of plaintext chunks sealed separately, so objects are streamed.
+	encryptionChunkSize = 64 << 10
+	encryptionKeySize   = 32
+)
+
+// encryptedStorage encrypts objects with AES-256-GCM before they are uploaded and decrypts them on download.
+// Every object is encrypted with a random data key stored in its header sealed with the key of the destination.
+// The object is sealed in chunks with nonces made of the chunk number and a flag of the last chunk, so chunks
+// can't be reordered or cut off. Manifests are stored unencrypted, they don't hold data of the cluster.
+type encryptedStorage struct {
+	Storage
+	key cipher.AEAD
+}
+
+func newEncryptedStorage(storage Storage, creds map[string][]byte) (*encryptedStorage, error) {
+	key, err := parseEncryptionKey(creds[EncryptionKey])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedStorage{Storage: storage, key: aead}, nil
+}
+
+// parseEncryptionKey accepts raw and base64 encoded keys, secrets created from files of
+// `openssl rand 32` and of its -base64 output are both common.
+func parseEncryptionKey(data []byte) ([]byte, error) {
+	if len(data) == encryptionKeySize {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != encryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, raw or base64 encoded", encryptionKeySize)
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *encryptedStorage) Upload(ctx context.Context, key string, r io.Reader, tags map[string]string) error {
+	if strings.HasSuffix(key, ManifestSuffix) {
+		return s.Storage.Upload(ctx, key, r, tags)
+	}
+	dataKey := make([]byte, encryptionKeySize)
+	nonce := make([]byte, s.key.NonceSize())
+	for _, b := range [][]byte{dataKey, nonce} {
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("cannot generate data key: %w", err)
+		}
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	header := append([]byte(encryptionMagic), nonce...)
+	header = s.key.Seal(header, nonce, dataKey, []byte(encryptionMagic))
+	return s.Storage.Upload(ctx, key, &encryptingReader{
+		src:   r,
+		aead:  aead,
+		plain: make([]byte, encryptionChunkSize),
+		out:   header,
+	}, tags)
+}
+
+func (s *encryptedStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := s.Storage.Download(ctx, key)
+	if err != nil || strings.HasSuffix(key, ManifestSuffix) {
+		return rc, err
+	}
+	br := bufio.NewReader(rc)
+	// objects uploaded before encryption was enabled are passed through
+	if magic, _ := br.Peek(len(encryptionMagic)); !bytes.Equal(magic, []byte(encryptionMagic)) {
+		return decryptedObject{Reader: br, object: rc}, nil
+	}
+	header := make([]byte, encryptionHeaderSize(s.key))
+	if _, err := io.ReadFull(br, header); err != nil {
+		_ = rc.Close()
+		return nil, fmt.Errorf("cannot read encryption header of %s: %w", key, err)
+	}
+	nonce := header[len(encryptionMagic) : len(encryptionMagic)+s.key.NonceSize()]
+	dataKey, err := s.key.Open(nil, nonce, header[len(encryptionMagic)+len(nonce):], []byte(encryptionMagic))
+	if err != nil {
+		_ = rc.Close()
+		return nil, fmt.Errorf("cannot decrypt data key of %s, the snapshot is encrypted with another key: %w", key, err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return decryptedObject{
+		Reader:     &decryptingReader{src: br, aead: aead, buf: make([]byte, encryptionChunkSize+aead.Overhead())},
+		object:     rc,
+		headerSize: int64(len(header)),
+		overhead:   int64(aead.Overhead()),
+	}, nil
+}
+
+func encryptionHeaderSize(aead cipher.AEAD) int {
+	return len(encryptionMagic) + aead.NonceSize() + encryptionKeySize + aead.Overhead()
+}
+
+// chunkNonce returns the nonce of the chunk. Data keys are never reused, so a counter is a safe nonce.
+func chunkNonce(aead cipher.AEAD, counter uint64, last bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce, counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// encryptingReader encrypts the source in chunks. The last chunk is always shorter than a full chunk,
+// it is empty if the size of the source is a multiple of the chunk size.
+type encryptingReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	counter uint64
+	plain   []byte
+	sealed  []byte
+	out     []byte
+	done    bool
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.src, r.plain)
+		last := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !last {
+			return 0, err
+		}
+		r.sealed = r.aead.Seal(r.sealed[:0], chunkNonce(r.aead, r.counter, last), r.plain[:n], nil)
+		r.out = r.sealed
+		r.counter++
+		r.done = last
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// decryptingReader decrypts chunks written by encryptingReader.
+type decryptingReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	counter uint64
+	buf     []byte
+	out     []byte
+	done    bool
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.src, r.buf)
+		switch {
+		case errors.Is(err, io.EOF):
+			return 0, errors.New("encrypted snapshot is truncated")
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			r.done = true
+		case err != nil:
+			return 0, err
+		}
+		r.out, err = r.aead.Open(r.buf[:0], chunkNonce(r.aead, r.counter, r.done), r.buf[:n], nil)
+		if err != nil {
+			return 0, fmt.Errorf("cannot decrypt snapshot: %w", err)
+		}
+		r.counter++
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// decryptedObject is a downloaded object decrypted as it is read.
+type decryptedObject struct {
+	io.Reader
+	object     io.ReadCloser
+	headerSize int64
+	overhead   int64
+}
+
+func (o decryptedObject) Close() error {
+	return o.object.Close()
+}
+
+// Size returns the size of the plaintext, derived from the size of the object.
+func (o decryptedObject) Size() (int64, error) {
+	s, ok := o.object.(sizer)
+	if !ok {
+		return 0, errors.New("object size is unknown")
+	}
+	size, err := s.Size()
+	if err != nil || o.overhead == 0 {
+		return size, err
+	}
+	sealed := size - o.headerSize
+	chunk := encryptionChunkSize + o.overhead
+	return sealed/chunk*encryptionChunkSize + sealed%chunk - o.overhead, nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// sizedObject is a downloaded object which knows its size.
+type sizedObject struct {
+	io.ReadCloser
+	size int64
+}
+
+func (o sizedObject) Size() (int64, error) {
+	return o.size, nil
+}
+
+// sizedStorage is memory storage returning objects which know their size.
+type sizedStorage struct {
+	memoryStorage
+}
+
+func (s sizedStorage) Download(_ context.Context, key string) (io.ReadCloser, error) {
+	data := s.memoryStorage[key]
+	return sizedObject{ReadCloser: io.NopCloser(bytes.NewReader(data)), size: int64(len(data))}, nil
+}
+
+var _ = Describe("Encrypted storage", func() {
+	var (
+		objects memoryStorage
+		key     []byte
+		storage Storage
+	)
+
+	BeforeEach(func() {
+		objects = memoryStorage{}
+		key = make([]byte, encryptionKeySize)
+		_, _ = rand.Read(key)
+		var err error
+		storage, err = newEncryptedStorage(sizedStorage{objects}, map[string][]byte{EncryptionKey: key})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	download := func(ctx context.Context, key string) ([]byte, error) {
+		rc, err := storage.Download(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = rc.Close()
+		}()
+		return io.ReadAll(rc)
+	}
+
+	DescribeTable("should encrypt and decrypt snapshots",
+		func(ctx SpecContext, size int) {
+			snapshot := make([]byte, size)
+			_, _ = rand.Read(snapshot)
+			Expect(storage.Upload(ctx, "ns/test/1.db", bytes.NewReader(snapshot), nil)).To(Succeed())
+			if size > 0 {
+				Expect(bytes.Contains(objects["ns/test/1.db"], snapshot[:min(size, 64)])).To(BeFalse())
+			}
+
+			rc, err := storage.Download(ctx, "ns/test/1.db")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rc.(sizer).Size()).To(Equal(int64(size)))
+			data, err := io.ReadAll(rc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal(snapshot))
+		},
+		Entry("empty", 0),
+		Entry("smaller than a chunk", 100),
+		Entry("of whole chunks", 2*encryptionChunkSize),
+		Entry("of partial chunks", 2*encryptionChunkSize+5),
+	)
+
+	It("should keep manifests readable", func(ctx SpecContext) {
+		Expect(WriteManifest(ctx, storage, "ns/test/1.db", &Manifest{Revision: 42})).To(Succeed())
+		Expect(string(objects[ManifestKey("ns/test/1.db")])).To(ContainSubstring("42"))
+		Expect(ReadManifest(ctx, storage, "ns/test/1.db")).To(HaveField("Revision", int64(42)))
+	})
+
+	It("should read snapshots taken before encryption was enabled", func(ctx SpecContext) {
+		objects["ns/test/1.db"] = []byte("plain snapshot")
+		Expect(download(ctx, "ns/test/1.db")).To(Equal([]byte("plain snapshot")))
+	})
+
+	It("should reject snapshots encrypted with another key", func(ctx SpecContext) {
+		Expect(storage.Upload(ctx, "ns/test/1.db", bytes.NewReader([]byte("snapshot")), nil)).To(Succeed())
+		other, err := newEncryptedStorage(objects, map[string][]byte{EncryptionKey: bytes.Repeat([]byte{1}, encryptionKeySize)})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = other.Download(ctx, "ns/test/1.db")
+		Expect(err).To(MatchError(ContainSubstring("encrypted with another key")))
+	})
+
+	It("should detect truncated and modified snapshots", func(ctx SpecContext) {
+		snapshot := make([]byte, 2*encryptionChunkSize)
+		Expect(storage.Upload(ctx, "ns/test/1.db", bytes.NewReader(snapshot), nil)).To(Succeed())
+		encrypted := objects["ns/test/1.db"]
+
+		// the empty last chunk is cut off
+		objects["ns/test/1.db"] = encrypted[:len(encrypted)-16]
+		_, err := download(ctx, "ns/test/1.db")
+		Expect(err).To(MatchError("encrypted snapshot is truncated"))
+
+		objects["ns/test/1.db"] = encrypted[:len(encrypted)-100]
+		_, err = download(ctx, "ns/test/1.db")
+		Expect(err).To(MatchError(ContainSubstring("cannot decrypt snapshot")))
+
+		modified := bytes.Clone(encrypted)
+		modified[len(modified)/2] ^= 1
+		objects["ns/test/1.db"] = modified
+		_, err = download(ctx, "ns/test/1.db")
+		Expect(err).To(MatchError(ContainSubstring("cannot decrypt snapshot")))
+	})
+
+	It("should accept base64 encoded keys only of 256 bits", func() {
+		Expect(parseEncryptionKey([]byte(base64.StdEncoding.EncodeToString(key) + "\n"))).To(Equal(key))
+		_, err := parseEncryptionKey([]byte(base64.StdEncoding.EncodeToString(key[:16])))
+		Expect(err).To(HaveOccurred())
+		_, err = parseEncryptionKey(nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should pass the key to the storage as a credential", func() {
+		ref := corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "backup-key"}, Key: "key"}
+		Expect(CredentialRefs(&etcdaenixiov1alpha1.BackupDestination{
+			GCS:        &etcdaenixiov1alpha1.GCSDestination{Bucket: "backups"},
+			Encryption: &etcdaenixiov1alpha1.BackupEncryption{KeyRef: ref},
+		})).To(Equal(map[string]corev1.SecretKeySelector{EncryptionKey: ref}))
+	})
+})
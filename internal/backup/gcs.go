@@ -0,0 +1,263 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// GCSServiceAccountKey is the key of the JSON key of a service account in the GCS credentials secret.
+	GCSServiceAccountKey = "serviceAccountKey"
+
+	gcsEndpoint = "https://storage.googleapis.com"
+	gcsScope    = "https://www.googleapis.com/auth/devstorage.read_write"
+	// gcsChunkSize is the size of chunks of resumable uploads, it has to be a multiple of 256 KiB.
+	gcsChunkSize = 16 << 20
+)
+
+// gcsStorage stores objects in a Google Cloud Storage bucket using the JSON API. Snapshots are streamed,
+// so they are uploaded in chunks of a resumable upload.
+type gcsStorage struct {
+	client    *http.Client
+	endpoint  string
+	bucket    string
+	chunkSize int
+	// kmsKeyName is the Cloud KMS key objects are encrypted with instead of the default key of the bucket.
+	kmsKeyName string
+}
+
+func newGCSStorage(
+	destination *etcdaenixiov1alpha1.GCSDestination,
+	proxy *etcdaenixiov1alpha1.ProxySpec,
+	creds map[string][]byte,
+) (*gcsStorage, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = proxyFunc(proxy)
+	}
+	// tokens are requested through the same transport
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: transport})
+	var credentials *google.Credentials
+	var err error
+	if key, ok := creds[GCSServiceAccountKey]; ok {
+		credentials, err = google.CredentialsFromJSON(ctx, key, gcsScope)
+	} else {
+		credentials, err = google.FindDefaultCredentials(ctx, gcsScope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load gcs credentials: %w", err)
+	}
+	return &gcsStorage{
+		client:     oauth2.NewClient(ctx, credentials.TokenSource),
+		endpoint:   gcsEndpoint,
+		bucket:     destination.Bucket,
+		chunkSize:  gcsChunkSize,
+		kmsKeyName: destination.KMSKeyName,
+	}, nil
+}
+
+func (s *gcsStorage) Upload(ctx context.Context, key string, r io.Reader, tags map[string]string) error {
+	if err := s.upload(ctx, key, r, tags); err != nil {
+		return fmt.Errorf("cannot upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *gcsStorage) upload(ctx context.Context, key string, r io.Reader, tags map[string]string) error {
+	metadata, err := json.Marshal(map[string]interface{}{"name": key, "metadata": tags})
+	if err != nil {
+		return err
+	}
+	query := url.Values{"uploadType": {"resumable"}}
+	if s.kmsKeyName != "" {
+		query.Set("kmsKeyName", s.kmsKeyName)
+	}
+	resp, err := s.do(ctx, http.MethodPost, s.bucketURL("/upload/storage/v1", "", query),
+		bytes.NewReader(metadata), http.Header{"Content-Type": {"application/json; charset=UTF-8"}})
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return errors.New("gcs returned no upload session")
+	}
+
+	buf := make([]byte, s.chunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		last := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !last {
+			return err
+		}
+		total := "*"
+		if last {
+			total = strconv.FormatInt(offset+int64(n), 10)
+		}
+		contentRange := fmt.Sprintf("bytes %d-%d/%s", offset, offset+int64(n)-1, total)
+		if n == 0 {
+			contentRange = "bytes */" + total
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, session, bytes.NewReader(buf[:n]))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Range", contentRange)
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if last {
+			return checkGCSResponse(resp, http.StatusOK, http.StatusCreated)
+		}
+		if err = checkGCSResponse(resp, http.StatusPermanentRedirect); err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+}
+
+func (s *gcsStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.bucketURL("/storage/v1", key, url.Values{"alt": {"media"}}), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download %s: %w", key, err)
+	}
+	return httpObject{ReadCloser: resp.Body, size: resp.ContentLength}, nil
+}
+
+// httpObject is an object downloaded in the body of an HTTP response.
+type httpObject struct {
+	io.ReadCloser
+	size int64
+}
+
+func (o httpObject) Size() (int64, error) {
+	if o.size < 0 {
+		return 0, errors.New("object size is unknown")
+	}
+	return o.size, nil
+}
+
+func (s *gcsStorage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.bucketURL("/storage/v1", key, nil), nil, nil)
+	var notFound gcsNotFoundError
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot delete %s: %w", key, err)
+	}
+	return resp.Body.Close()
+}
+
+func (s *gcsStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+	for {
+		resp, err := s.do(ctx, http.MethodGet, s.bucketURL("/storage/v1", "", query), nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list objects: %w", err)
+		}
+		var page struct {
+			Items         []struct{ Name string } `json:"items"`
+			NextPageToken string                  `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot list objects: %w", err)
+		}
+		for _, item := range page.Items {
+			keys = append(keys, item.Name)
+		}
+		if page.NextPageToken == "" {
+			// objects are listed in lexicographic order
+			return keys, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// bucketURL returns the URL of the API with the base path for the object of the bucket, or for objects
+// of the bucket if the key is empty.
+func (s *gcsStorage) bucketURL(base, key string, query url.Values) string {
+	u := s.endpoint + base + "/b/" + url.PathEscape(s.bucket) + "/o"
+	if key != "" {
+		u += "/" + url.PathEscape(key)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do sends the request and returns the response if it succeeded. The caller is responsible for closing its body.
+func (s *gcsStorage) do(ctx context.Context, method, u string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, checkGCSResponse(resp)
+	}
+	return resp, nil
+}
+
+// gcsNotFoundError is returned for requests to missing objects.
+type gcsNotFoundError struct {
+	error
+}
+
+// checkGCSResponse closes the body of the response and returns an error unless it has one of the statuses.
+func checkGCSResponse(resp *http.Response, statuses ...int) error {
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := fmt.Errorf("gcs returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	if resp.StatusCode == http.StatusNotFound {
+		return gcsNotFoundError{err}
+	}
+	return err
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeGCS serves the part of the GCS JSON API used by the storage.
+type fakeGCS struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	metadata map[string]map[string]string
+	uploads  map[string]string
+	chunks   int
+	// kmsKeyName is the KMS key of the last upload
+	kmsKeyName string
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := r.URL.EscapedPath()
+	switch {
+	case r.Method == http.MethodPost && path == "/upload/storage/v1/b/backups/o":
+		var metadata struct {
+			Name     string            `json:"name"`
+			Metadata map[string]string `json:"metadata"`
+		}
+		Expect(json.NewDecoder(r.Body).Decode(&metadata)).To(Succeed())
+		f.kmsKeyName = r.URL.Query().Get("kmsKeyName")
+		session := strconv.Itoa(len(f.uploads))
+		f.uploads[session] = metadata.Name
+		f.metadata[metadata.Name] = metadata.Metadata
+		w.Header().Set("Location", "http://"+r.Host+"/upload/session/"+session)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/upload/session/"):
+		name := f.uploads[strings.TrimPrefix(path, "/upload/session/")]
+		match := regexp.MustCompile(`^bytes (?:(\d+)-\d+|\*)/(\d+|\*)$`).FindStringSubmatch(r.Header.Get("Content-Range"))
+		Expect(match).NotTo(BeNil())
+		data, _ := io.ReadAll(r.Body)
+		if match[1] != "" {
+			Expect(match[1]).To(Equal(strconv.Itoa(len(f.objects[name]))))
+		}
+		f.objects[name] = append(f.objects[name], data...)
+		f.chunks++
+		if match[2] == "*" {
+			w.WriteHeader(http.StatusPermanentRedirect)
+		}
+	case r.Method == http.MethodGet && path == "/storage/v1/b/backups/o":
+		var names []string
+		for name := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		// pages of a single object
+		start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		page := map[string]interface{}{}
+		if start < len(names) {
+			page["items"] = []map[string]string{{"name": names[start]}}
+		}
+		if start+1 < len(names) {
+			page["nextPageToken"] = strconv.Itoa(start + 1)
+		}
+		Expect(json.NewEncoder(w).Encode(page)).To(Succeed())
+	case strings.HasPrefix(path, "/storage/v1/b/backups/o/"):
+		name, _ := url.PathUnescape(strings.TrimPrefix(path, "/storage/v1/b/backups/o/"))
+		data, ok := f.objects[name]
+		if !ok {
+			http.Error(w, `{"error":{"code":404}}`, http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(f.objects, name)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		Expect(r.URL.Query().Get("alt")).To(Equal("media"))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, _ = w.Write(data)
+	default:
+		http.Error(w, fmt.Sprintf("unexpected %s %s", r.Method, path), http.StatusBadRequest)
+	}
+}
+
+var _ = Describe("GCS storage", func() {
+	var (
+		gcs     *fakeGCS
+		storage *gcsStorage
+	)
+
+	BeforeEach(func() {
+		gcs = &fakeGCS{objects: map[string][]byte{}, metadata: map[string]map[string]string{}, uploads: map[string]string{}}
+		server := httptest.NewServer(gcs)
+		DeferCleanup(server.Close)
+		storage = &gcsStorage{client: server.Client(), endpoint: server.URL, bucket: "backups", chunkSize: 4}
+	})
+
+	It("should upload snapshots in chunks with metadata", func(ctx SpecContext) {
+		Expect(storage.Upload(ctx, "ns/test/1.db", strings.NewReader("snapshot!"), map[string]string{"env": "prod"})).To(Succeed())
+		Expect(string(gcs.objects["ns/test/1.db"])).To(Equal("snapshot!"))
+		Expect(gcs.metadata["ns/test/1.db"]).To(Equal(map[string]string{"env": "prod"}))
+		Expect(gcs.chunks).To(Equal(3))
+
+		// the last chunk is empty if the size is a multiple of the chunk size
+		Expect(storage.Upload(ctx, "ns/test/2.db", strings.NewReader("snapshot"), nil)).To(Succeed())
+		Expect(string(gcs.objects["ns/test/2.db"])).To(Equal("snapshot"))
+		Expect(gcs.chunks).To(Equal(6))
+	})
+
+	It("should encrypt objects with the KMS key", func(ctx SpecContext) {
+		storage.kmsKeyName = "projects/p/locations/global/keyRings/etcd/cryptoKeys/backups"
+		Expect(storage.Upload(ctx, "ns/test/1.db", strings.NewReader("snapshot"), nil)).To(Succeed())
+		Expect(gcs.kmsKeyName).To(Equal(storage.kmsKeyName))
+	})
+
+	It("should download, list and delete objects", func(ctx SpecContext) {
+		gcs.objects["ns/test/1.db"] = []byte("one")
+		gcs.objects["ns/test/2.db"] = []byte("two")
+		gcs.objects["ns/other/1.db"] = []byte("other")
+
+		keys, err := storage.List(ctx, "ns/test/")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(Equal([]string{"ns/test/1.db", "ns/test/2.db"}))
+
+		rc, err := storage.Download(ctx, "ns/test/2.db")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rc.(sizer).Size()).To(Equal(int64(3)))
+		data, err := io.ReadAll(rc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rc.Close()).To(Succeed())
+		Expect(string(data)).To(Equal("two"))
+
+		Expect(storage.Delete(ctx, "ns/test/1.db")).To(Succeed())
+		Expect(storage.Delete(ctx, "ns/test/1.db")).To(Succeed())
+		Expect(gcs.objects).NotTo(HaveKey("ns/test/1.db"))
+
+		_, err = storage.Download(ctx, "ns/test/1.db")
+		Expect(err).To(MatchError(ContainSubstring("404")))
+	})
+})
@@ -0,0 +1,121 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/version"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// ManifestSuffix is appended to keys of snapshots to get keys of their manifests.
+const ManifestSuffix = ".manifest.json"
+
+const (
+	// TLSModeNone is the TLS mode of clusters serving clients over plain HTTP.
+	TLSModeNone = "none"
+	// TLSModeServer is the TLS mode of clusters serving clients over TLS.
+	TLSModeServer = "server"
+	// TLSModeMutual is the TLS mode of clusters authenticating clients by certificates.
+	TLSModeMutual = "mutual"
+)
+
+// Manifest describes a snapshot. It is stored next to the snapshot, so restores can check the snapshot
+// without downloading it.
+type Manifest struct {
+	// ClusterUID is the UID of the EtcdCluster the snapshot is taken of.
+	ClusterUID string `json:"clusterUID"`
+	// EtcdVersion is the version of etcd the snapshot is taken with.
+	EtcdVersion string `json:"etcdVersion"`
+	// Revision is the revision of the cluster when the snapshot is taken.
+	Revision int64 `json:"revision"`
+	// RaftTerm is the raft term of the cluster when the snapshot is taken.
+	RaftTerm uint64 `json:"raftTerm,omitempty"`
+	// Hash is the SHA-256 hash of the snapshot.
+	Hash string `json:"hash"`
+	// Size is the size of the snapshot in bytes.
+	Size int64 `json:"size"`
+	// TLSMode is how the cluster served clients: none, server or mutual.
+	TLSMode string `json:"tlsMode"`
+	// TakenAt is the time the snapshot is taken at.
+	TakenAt time.Time `json:"takenAt"`
+	// Compression is the algorithm the stored snapshot is compressed with, Hash and Size are of the
+	// decompressed snapshot.
+	Compression etcdaenixiov1alpha1.BackupCompression `json:"compression,omitempty"`
+}
+
+// ManifestKey returns the key of the manifest of the snapshot stored under the key.
+func ManifestKey(key string) string {
+	return key + ManifestSuffix
+}
+
+// WriteManifest stores the manifest of the snapshot stored under the key.
+func WriteManifest(ctx context.Context, storage Storage, key string, manifest *Manifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("cannot encode snapshot manifest: %w", err)
+	}
+	return storage.Upload(ctx, ManifestKey(key), bytes.NewReader(data), nil)
+}
+
+// ReadManifest returns the manifest of the snapshot stored under the key or nil if the snapshot has no manifest,
+// e.g. if it is taken by an older operator.
+func ReadManifest(ctx context.Context, storage Storage, key string) (*Manifest, error) {
+	exists, err := SnapshotExists(ctx, storage, ManifestKey(key))
+	if err != nil || !exists {
+		return nil, err
+	}
+	rc, err := storage.Download(ctx, ManifestKey(key))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest of snapshot %s: %w", key, err)
+	}
+	manifest := &Manifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest of snapshot %s: %w", key, err)
+	}
+	return manifest, nil
+}
+
+// CheckCompatibility checks that the snapshot can be restored by etcd of the version. Snapshots of newer minor
+// versions are refused, as their data may use features older versions don't know. Snapshots without a known
+// etcd version are allowed.
+func (m *Manifest) CheckCompatibility(etcdVersion *version.Version) error {
+	snapshotVersion, err := version.ParseGeneric(m.EtcdVersion)
+	if err != nil || etcdVersion == nil {
+		return nil
+	}
+	target := version.MajorMinor(etcdVersion.Major(), etcdVersion.Minor())
+	if !target.AtLeast(version.MajorMinor(snapshotVersion.Major(), snapshotVersion.Minor())) {
+		return fmt.Errorf("snapshot is taken with etcd %s, which is newer than etcd %s it is restored with",
+			snapshotVersion, etcdVersion)
+	}
+	return nil
+}
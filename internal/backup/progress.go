@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"sync"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// ProgressReport is the progress of a member restore at a point in time.
+type ProgressReport struct {
+	Phase           etcdaenixiov1alpha1.RestorePhase `json:"phase"`
+	BytesDownloaded int64                            `json:"bytesDownloaded"`
+	TotalBytes      int64                            `json:"totalBytes,omitempty"`
+}
+
+// Progress tracks progress of a member restore. It is safe for concurrent use and a nil Progress ignores updates.
+// It counts bytes written to it as downloaded.
+type Progress struct {
+	mu     sync.Mutex
+	report ProgressReport
+}
+
+// Report returns the current progress.
+func (p *Progress) Report() ProgressReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.report
+}
+
+func (p *Progress) Write(b []byte) (int, error) {
+	if p != nil {
+		p.mu.Lock()
+		p.report.BytesDownloaded += int64(len(b))
+		p.mu.Unlock()
+	}
+	return len(b), nil
+}
+
+func (p *Progress) setPhase(phase etcdaenixiov1alpha1.RestorePhase) {
+	if p != nil {
+		p.mu.Lock()
+		p.report.Phase = phase
+		p.mu.Unlock()
+	}
+}
+
+func (p *Progress) setTotal(total int64) {
+	if p != nil {
+		p.mu.Lock()
+		p.report.TotalBytes = total
+		p.mu.Unlock()
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"fmt"
+	"net/http"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/pkg/backupstorage"
+)
+
+// newProviderStorage creates storage of the destination with the provider registered under its name.
+func newProviderStorage(
+	destination *etcdaenixiov1alpha1.ProviderDestination,
+	proxy *etcdaenixiov1alpha1.ProxySpec,
+	creds map[string][]byte,
+) (Storage, error) {
+	provider, ok := backupstorage.Lookup(destination.Name)
+	if !ok {
+		return nil, fmt.Errorf("backup storage provider %s is not registered, registered providers are %v",
+			destination.Name, backupstorage.Names())
+	}
+	options := backupstorage.Options{
+		Config:      destination.Config,
+		Credentials: creds,
+		Proxy:       http.ProxyFromEnvironment,
+	}
+	if proxy != nil {
+		options.Proxy = proxyFunc(proxy)
+	}
+	storage, err := provider.New(options)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create storage of provider %s: %w", destination.Name, err)
+	}
+	return storage, nil
+}
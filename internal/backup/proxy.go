@@ -0,0 +1,45 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// proxyFunc returns the function selecting the proxy of requests to the storage. Fields of the proxy which are
+// not set are read from the environment, so the proxy of the operator is used unless overridden.
+func proxyFunc(proxy *etcdaenixiov1alpha1.ProxySpec) func(*http.Request) (*url.URL, error) {
+	config := httpproxy.FromEnvironment()
+	if proxy.HTTPProxy != "" {
+		config.HTTPProxy = proxy.HTTPProxy
+	}
+	if proxy.HTTPSProxy != "" {
+		config.HTTPSProxy = proxy.HTTPSProxy
+	}
+	if proxy.NoProxy != "" {
+		config.NoProxy = proxy.NoProxy
+	}
+	proxyURL := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyURL(req.URL)
+	}
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// ResticPassword is the key of the repository password in the restic credentials secret.
+	ResticPassword = "password"
+	// ResticRESTUsername is the key of the rest-server user name in the restic credentials secret.
+	ResticRESTUsername = "restUsername"
+	// ResticRESTPassword is the key of the rest-server password in the restic credentials secret.
+	ResticRESTPassword = "restPassword"
+
+	// resticTag marks snapshots stored by the operator in restic repositories.
+	resticTag = "etcd-operator"
+)
+
+// resticBinary is the restic executable, shipped in the operator image.
+var resticBinary = "restic"
+
+// resticStorage keeps every object as a restic snapshot of a single file, its key being the path of the file.
+// Repositories are accessed by the restic binary, so all restic backends, e.g. rest-server, can be used.
+type resticStorage struct {
+	env []string
+}
+
+func newResticStorage(
+	destination *etcdaenixiov1alpha1.ResticDestination,
+	proxy *etcdaenixiov1alpha1.ProxySpec,
+	creds map[string][]byte,
+) (*resticStorage, error) {
+	if len(creds[ResticPassword]) == 0 {
+		return nil, errors.New("restic repository password is not set")
+	}
+	env := append(os.Environ(),
+		"RESTIC_REPOSITORY="+destination.Repository,
+		"RESTIC_PASSWORD="+string(creds[ResticPassword]),
+	)
+	if username := creds[ResticRESTUsername]; len(username) > 0 {
+		env = append(env, "RESTIC_REST_USERNAME="+string(username), "RESTIC_REST_PASSWORD="+string(creds[ResticRESTPassword]))
+	}
+	if proxy != nil {
+		for name, value := range map[string]string{
+			"HTTP_PROXY":  proxy.HTTPProxy,
+			"HTTPS_PROXY": proxy.HTTPSProxy,
+			"NO_PROXY":    proxy.NoProxy,
+		} {
+			if value != "" {
+				env = append(env, name+"="+value)
+			}
+		}
+	}
+	return &resticStorage{env: env}, nil
+}
+
+func (s *resticStorage) Upload(ctx context.Context, key string, r io.Reader, tags map[string]string) error {
+	args := []string{"backup", "--stdin", "--stdin-filename", resticPath(key), "--host", resticTag, "--tag", resticTag}
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		args = append(args, "--tag", name+"="+tags[name])
+	}
+	cmd := s.command(ctx, args...)
+	cmd.Stdin = r
+	if _, err := s.run(cmd); err != nil {
+		return fmt.Errorf("cannot upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *resticStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	path := resticPath(key)
+	cmd := s.command(ctx, "dump", "--tag", resticTag, "--path", path, "latest", path)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("cannot download %s: %w", key, err)
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot download %s: %w", key, err)
+	}
+	return &resticDump{ReadCloser: stdout, cmd: cmd, stderr: stderr, key: key}, nil
+}
+
+// resticDump is an object being dumped from a restic repository. The object ends with an error if the dump fails.
+type resticDump struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	key    string
+	err    error
+	done   bool
+}
+
+func (d *resticDump) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	if err == io.EOF {
+		if err = d.wait(); err == nil {
+			err = io.EOF
+		}
+	}
+	return n, err
+}
+
+func (d *resticDump) Close() error {
+	_ = d.ReadCloser.Close()
+	_ = d.wait()
+	return nil
+}
+
+func (d *resticDump) wait() error {
+	if !d.done {
+		d.done = true
+		if err := d.cmd.Wait(); err != nil {
+			d.err = fmt.Errorf("cannot download %s: %w", d.key, resticError(err, d.stderr.Bytes()))
+		}
+	}
+	return d.err
+}
+
+func (s *resticStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	output, err := s.run(s.command(ctx, "snapshots", "--json", "--tag", resticTag))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list objects: %w", err)
+	}
+	var snapshots []struct {
+		Paths []string `json:"paths"`
+	}
+	if err = json.Unmarshal(output, &snapshots); err != nil {
+		return nil, fmt.Errorf("cannot parse restic snapshots: %w", err)
+	}
+	var keys []string
+	for _, snapshot := range snapshots {
+		for _, path := range snapshot.Paths {
+			if key := strings.TrimPrefix(path, "/"); strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+// Delete forgets all snapshots of the key and prunes data not referenced anymore.
+func (s *resticStorage) Delete(ctx context.Context, key string) error {
+	output, err := s.run(s.command(ctx, "snapshots", "--json", "--tag", resticTag, "--path", resticPath(key)))
+	if err != nil {
+		return fmt.Errorf("cannot delete %s: %w", key, err)
+	}
+	var snapshots []struct {
+		ID string `json:"id"`
+	}
+	if err = json.Unmarshal(output, &snapshots); err != nil {
+		return fmt.Errorf("cannot parse restic snapshots: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+	args := []string{"forget", "--prune"}
+	for _, snapshot := range snapshots {
+		args = append(args, snapshot.ID)
+	}
+	if _, err = s.run(s.command(ctx, args...)); err != nil {
+		return fmt.Errorf("cannot delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// command returns restic command run against the repository. The cache is disabled, as the operator has no
+// writable home directory.
+func (s *resticStorage) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, resticBinary, append([]string{"--no-cache", "--quiet"}, args...)...)
+	cmd.Env = s.env
+	return cmd
+}
+
+// run runs the restic command and returns its output.
+func (s *resticStorage) run(cmd *exec.Cmd) ([]byte, error) {
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, resticError(err, stderr.Bytes())
+	}
+	return output, nil
+}
+
+// resticError adds the error output of restic to the error of the command.
+func resticError(err error, stderr []byte) error {
+	if message := strings.TrimSpace(string(stderr)); message != "" {
+		return fmt.Errorf("%w: %s", err, message)
+	}
+	return err
+}
+
+// resticPath returns the path of the file the object stored under the key is kept as.
+func resticPath(key string) string {
+	return "/" + strings.TrimPrefix(key, "/")
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// ExpiredSnapshots returns periodic snapshots of the cluster in the storage which are not kept by the retention
+// policy of the cluster at the time.
+func ExpiredSnapshots(
+	ctx context.Context,
+	storage Storage,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	now time.Time,
+) ([]etcdaenixiov1alpha1.AvailableBackup, error) {
+	if cluster.Spec.Backup.Retention == nil {
+		return nil, nil
+	}
+	snapshots, err := periodicSnapshots(ctx, storage, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return expiredSnapshots(snapshots, cluster.Spec.Backup.Retention, now), nil
+}
+
+// expiredSnapshots returns snapshots, sorted the latest first, which are not kept by the retention policy.
+func expiredSnapshots(
+	snapshots []etcdaenixiov1alpha1.AvailableBackup,
+	retention *etcdaenixiov1alpha1.BackupRetention,
+	now time.Time,
+) []etcdaenixiov1alpha1.AvailableBackup {
+	keepAll := retention.KeepLast == nil && retention.KeepDaily == nil && retention.KeepWeekly == nil
+	last := int(ptr.Deref(retention.KeepLast, 0))
+	daily := newBucketKeeper(int(ptr.Deref(retention.KeepDaily, 0)), func(t time.Time) string {
+		return t.UTC().Format(time.DateOnly)
+	})
+	weekly := newBucketKeeper(int(ptr.Deref(retention.KeepWeekly, 0)), func(t time.Time) string {
+		year, week := t.UTC().ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+
+	var expired []etcdaenixiov1alpha1.AvailableBackup
+	for i, snapshot := range snapshots {
+		takenAt := snapshot.TakenAt.Time
+		// buckets are counted by every rule, so they are not skipped when a snapshot is kept by another rule
+		keptDaily, keptWeekly := daily.keep(takenAt), weekly.keep(takenAt)
+		kept := keepAll || i < last || keptDaily || keptWeekly
+		if retention.MaxAge != nil && now.Sub(takenAt) > retention.MaxAge.Duration {
+			kept = false
+		}
+		if !kept && i > 0 {
+			expired = append(expired, snapshot)
+		}
+	}
+	return expired
+}
+
+// bucketKeeper keeps the latest snapshot of each of a number of the latest time buckets, e.g. days.
+type bucketKeeper struct {
+	limit  int
+	bucket func(time.Time) string
+	seen   map[string]bool
+}
+
+func newBucketKeeper(limit int, bucket func(time.Time) string) *bucketKeeper {
+	return &bucketKeeper{limit: limit, bucket: bucket, seen: map[string]bool{}}
+}
+
+// keep checks if the snapshot taken at the time is kept. Snapshots have to be passed the latest first.
+func (k *bucketKeeper) keep(t time.Time) bool {
+	bucket := k.bucket(t)
+	if k.seen[bucket] || len(k.seen) >= k.limit {
+		return false
+	}
+	k.seen[bucket] = true
+	return true
+}
+
+// DeleteSnapshot deletes the snapshot stored under the key together with its manifest.
+func DeleteSnapshot(ctx context.Context, storage Storage, key string) error {
+	if err := storage.Delete(ctx, ManifestKey(key)); err != nil {
+		return fmt.Errorf("cannot delete manifest of snapshot %s: %w", key, err)
+	}
+	if err := storage.Delete(ctx, key); err != nil {
+		return fmt.Errorf("cannot delete snapshot %s: %w", key, err)
+	}
+	return nil
+}
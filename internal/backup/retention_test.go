@@ -0,0 +1,95 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"slices"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Backup retention", func() {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	// snapshots taken every 6 hours over 3 weeks, the latest first
+	var snapshots []etcdaenixiov1alpha1.AvailableBackup
+	for t := now; t.After(now.Add(-21 * 24 * time.Hour)); t = t.Add(-6 * time.Hour) {
+		snapshots = append(snapshots, etcdaenixiov1alpha1.AvailableBackup{
+			Key: t.Format(snapshotTimeFormat), TakenAt: &metav1.Time{Time: t},
+		})
+	}
+	kept := func(retention *etcdaenixiov1alpha1.BackupRetention) []string {
+		expired := expiredSnapshots(snapshots, retention, now)
+		var keys []string
+		for _, snapshot := range snapshots {
+			if !slices.Contains(expired, snapshot) {
+				keys = append(keys, snapshot.Key)
+			}
+		}
+		return keys
+	}
+
+	It("should keep the latest snapshots", func() {
+		Expect(kept(&etcdaenixiov1alpha1.BackupRetention{KeepLast: ptr.To(int32(3))})).To(Equal([]string{
+			"20240515T120000Z", "20240515T060000Z", "20240515T000000Z",
+		}))
+	})
+
+	It("should keep the last snapshot of days and weeks", func() {
+		Expect(kept(&etcdaenixiov1alpha1.BackupRetention{
+			KeepDaily:  ptr.To(int32(2)),
+			KeepWeekly: ptr.To(int32(3)),
+		})).To(Equal([]string{
+			"20240515T120000Z", "20240514T180000Z", "20240512T180000Z", "20240505T180000Z",
+		}))
+	})
+
+	It("should combine rules", func() {
+		Expect(kept(&etcdaenixiov1alpha1.BackupRetention{
+			KeepLast:  ptr.To(int32(2)),
+			KeepDaily: ptr.To(int32(2)),
+		})).To(Equal([]string{"20240515T120000Z", "20240515T060000Z", "20240514T180000Z"}))
+	})
+
+	It("should delete snapshots older than max age", func() {
+		Expect(kept(&etcdaenixiov1alpha1.BackupRetention{
+			KeepWeekly: ptr.To(int32(3)),
+			MaxAge:     &metav1.Duration{Duration: 7 * 24 * time.Hour},
+		})).To(Equal([]string{"20240515T120000Z", "20240512T180000Z"}))
+		Expect(kept(&etcdaenixiov1alpha1.BackupRetention{
+			MaxAge: &metav1.Duration{Duration: 24 * time.Hour},
+		})).To(HaveLen(5))
+	})
+
+	It("should always keep the latest snapshot", func() {
+		Expect(expiredSnapshots(snapshots, &etcdaenixiov1alpha1.BackupRetention{
+			MaxAge: &metav1.Duration{Duration: time.Hour},
+		}, now.Add(time.Hour*24))).To(HaveLen(len(snapshots) - 1))
+	})
+
+	It("should delete snapshots with manifests", func(ctx SpecContext) {
+		storage := memoryStorage{"a.db": nil, "a.db" + ManifestSuffix: nil, "b.db": nil}
+		Expect(DeleteSnapshot(ctx, storage, "a.db")).To(Succeed())
+		Expect(storage).To(HaveLen(1))
+		Expect(storage).To(HaveKey("b.db"))
+	})
+})
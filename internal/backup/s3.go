@@ -0,0 +1,176 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// S3AccessKeyID is the key of the access key id in the S3 credentials secret.
+	S3AccessKeyID = "accessKeyID"
+	// S3SecretAccessKey is the key of the secret access key in the S3 credentials secret.
+	S3SecretAccessKey = "secretAccessKey"
+	// S3SessionToken is the key of the session token of temporary credentials.
+	S3SessionToken = "sessionToken"
+	// S3CABundle is the name of PEM encoded CA certificates trusted by the S3 client.
+	S3CABundle = "caBundle"
+
+	defaultS3Endpoint = "s3.amazonaws.com"
+)
+
+type s3Storage struct {
+	client *minio.Client
+	bucket string
+	// sse is the server-side encryption of uploaded objects, nil for the default encryption of the bucket.
+	sse encrypt.ServerSide
+}
+
+func newS3Storage(
+	destination *etcdaenixiov1alpha1.S3Destination,
+	proxy *etcdaenixiov1alpha1.ProxySpec,
+	creds map[string][]byte,
+) (*s3Storage, error) {
+	transport, err := minio.DefaultTransport(true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create s3 transport: %w", err)
+	}
+	if proxy != nil {
+		transport.Proxy = proxyFunc(proxy)
+	}
+	endpoint, secure, err := parseS3Endpoint(destination.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if transport.TLSClientConfig == nil {
+		// the default transport only has a TLS config when it is created secure
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = destination.InsecureSkipVerify
+	if caBundle := creds[S3CABundle]; len(caBundle) > 0 {
+		pool := transport.TLSClientConfig.RootCAs
+		if pool == nil {
+			if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+		}
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no certificates found in s3 ca bundle")
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	bucketLookup := minio.BucketLookupAuto
+	if destination.ForcePathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(
+			string(creds[S3AccessKeyID]), string(creds[S3SecretAccessKey]), string(creds[S3SessionToken])),
+		Secure:       secure,
+		Region:       destination.Region,
+		Transport:    transport,
+		BucketLookup: bucketLookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create s3 client: %w", err)
+	}
+	storage := &s3Storage{client: client, bucket: destination.Bucket}
+	if destination.KMSKeyID != "" {
+		if storage.sse, err = encrypt.NewSSEKMS(destination.KMSKeyID, nil); err != nil {
+			return nil, fmt.Errorf("cannot use kms key: %w", err)
+		}
+	}
+	return storage, nil
+}
+
+// parseS3Endpoint returns the host of the endpoint and whether it is accessed with HTTPS.
+func parseS3Endpoint(endpoint string) (string, bool, error) {
+	if endpoint == "" {
+		return defaultS3Endpoint, true, nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		return strings.TrimSuffix(endpoint, "/"), true, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false, fmt.Errorf("invalid s3 endpoint scheme %q", u.Scheme)
+	}
+	return u.Host, u.Scheme == "https", nil
+}
+
+func (s *s3Storage) Upload(ctx context.Context, key string, r io.Reader, tags map[string]string) error {
+	if _, err := s.client.PutObject(ctx, s.bucket, key, r, -1, minio.PutObjectOptions{
+		UserTags:             tags,
+		ServerSideEncryption: s.sse,
+	}); err != nil {
+		return fmt.Errorf("cannot upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *s3Storage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot download %s: %w", key, err)
+	}
+	return s3Object{obj}, nil
+}
+
+// s3Object is a downloaded S3 object.
+type s3Object struct {
+	*minio.Object
+}
+
+func (o s3Object) Size() (int64, error) {
+	info, err := o.Stat()
+	return info.Size, err
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("cannot delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *s3Storage) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("cannot list objects: %w", obj.Err)
+		}
+		keys = append(keys, obj.Key)
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
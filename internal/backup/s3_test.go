@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// fakeS3 serves listing of objects of the S3 API with path-style bucket addressing.
+type fakeS3 struct{}
+
+func (fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || r.URL.Path != "/backups/" || r.URL.Query().Get("list-type") != "2" {
+		http.Error(w, fmt.Sprintf("unexpected request %s %s", r.Method, r.URL), http.StatusNotImplemented)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+<Name>backups</Name><Prefix>etcd/</Prefix><KeyCount>1</KeyCount><MaxKeys>1000</MaxKeys>
+<IsTruncated>false</IsTruncated><Contents><Key>etcd/rev-1.snap</Key><Size>1</Size></Contents>
+</ListBucketResult>`)
+}
+
+var _ = Describe("S3 storage", func() {
+	var (
+		server      *httptest.Server
+		destination *etcdaenixiov1alpha1.S3Destination
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewTLSServer(fakeS3{})
+		DeferCleanup(server.Close)
+		destination = &etcdaenixiov1alpha1.S3Destination{
+			Bucket:         "backups",
+			Region:         "us-east-1",
+			Endpoint:       server.URL,
+			ForcePathStyle: true,
+		}
+	})
+
+	It("should trust endpoints with certificates of the CA bundle", func(ctx SpecContext) {
+		caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		storage, err := newS3Storage(destination, nil, map[string][]byte{S3CABundle: caBundle})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(storage.List(ctx, "etcd/")).To(Equal([]string{"etcd/rev-1.snap"}))
+	})
+
+	It("should reject untrusted certificates unless verification is skipped", func(ctx SpecContext) {
+		storage, err := newS3Storage(destination, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		// the client retries failed requests until the context is done
+		listCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		defer cancel()
+		_, err = storage.List(listCtx, "etcd/")
+		Expect(err).To(HaveOccurred())
+
+		destination.InsecureSkipVerify = true
+		storage, err = newS3Storage(destination, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(storage.List(ctx, "etcd/")).To(Equal([]string{"etcd/rev-1.snap"}))
+	})
+
+	It("should fail if the CA bundle has no certificates", func() {
+		_, err := newS3Storage(destination, nil, map[string][]byte{S3CABundle: []byte("not a certificate")})
+		Expect(err).To(MatchError(ContainSubstring("no certificates")))
+	})
+
+	DescribeTable("should parse endpoints",
+		func(endpoint, host string, secure bool) {
+			parsedHost, parsedSecure, err := parseS3Endpoint(endpoint)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsedHost).To(Equal(host))
+			Expect(parsedSecure).To(Equal(secure))
+		},
+		Entry("default", "", defaultS3Endpoint, true),
+		Entry("without scheme", "minio.storage.svc:9000", "minio.storage.svc:9000", true),
+		Entry("with https", "https://rgw.example.com", "rgw.example.com", true),
+		Entry("with http", "http://minio.storage.svc:9000/", "minio.storage.svc:9000", false),
+	)
+})
@@ -0,0 +1,352 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	etcdversion "go.etcd.io/etcd/api/v3/version"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/etcdutl/v3/snapshot"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// Target is a storage a snapshot is uploaded to under the key.
+type Target struct {
+	Storage Storage
+	Key     string
+}
+
+// Snapshot streams a snapshot of the etcd cluster to the storage under the key tagged with the tags.
+// The manifest is completed with the size and hash of the snapshot and stored next to it.
+func Snapshot(
+	ctx context.Context,
+	cli clientv3.Maintenance,
+	storage Storage,
+	key string,
+	tags map[string]string,
+	manifest *Manifest,
+) error {
+	return FanOutSnapshot(ctx, cli, []Target{{Storage: storage, Key: key}}, tags, manifest)[0]
+}
+
+// FanOutSnapshot streams a single snapshot of the etcd cluster to all targets at the same time, tagged with the tags,
+// and stores the manifest next to every copy. A target failing is dropped while the others go on, so the returned
+// errors, one per target, are independent of each other.
+func FanOutSnapshot(
+	ctx context.Context,
+	cli clientv3.Maintenance,
+	targets []Target,
+	tags map[string]string,
+	manifest *Manifest,
+) []error {
+	errs := make([]error, len(targets))
+	rc, err := cli.Snapshot(ctx)
+	if err != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("cannot start snapshot: %w", err)
+		}
+		return errs
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	return fanOut(ctx, rc, targets, tags, manifest)
+}
+
+// fanOut streams the snapshot read from rc to all targets at the same time, compressed with the compression
+// of the manifest, and stores the manifest next to every copy, returning an error per target.
+func fanOut(ctx context.Context, rc io.Reader, targets []Target, tags map[string]string, manifest *Manifest) []error {
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	writers := make([]*io.PipeWriter, len(targets))
+	for i, target := range targets {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = target.Storage.Upload(ctx, target.Key, pr, tags)
+			// unblocks writes to the target which failed before reading the whole snapshot
+			_ = pr.CloseWithError(cmp.Or(errs[i], io.ErrClosedPipe))
+		}()
+	}
+	hash := sha256.New()
+	r := &countingReader{r: io.TeeReader(rc, hash)}
+	// snapshots are compressed once for all targets
+	w, err := newCompressor(&fanOutWriter{writers: slices.Clone(writers)}, manifest.Compression)
+	if err == nil {
+		_, err = io.Copy(w, r)
+		err = cmp.Or(err, w.Close())
+	}
+	for _, pw := range writers {
+		_ = pw.CloseWithError(err)
+	}
+	wg.Wait()
+
+	manifest.Size = r.n
+	manifest.Hash = hex.EncodeToString(hash.Sum(nil))
+	for i, target := range targets {
+		if errs[i] == nil {
+			errs[i] = WriteManifest(ctx, target.Storage, target.Key, manifest)
+		}
+	}
+	return errs
+}
+
+// fanOutWriter writes to all writers, dropping ones which fail. It fails only once all writers failed.
+type fanOutWriter struct {
+	writers []*io.PipeWriter
+}
+
+func (f *fanOutWriter) Write(p []byte) (int, error) {
+	var err error
+	for i, w := range f.writers {
+		if w == nil {
+			continue
+		}
+		if _, err = w.Write(p); err != nil {
+			f.writers[i] = nil
+		}
+	}
+	for _, w := range f.writers {
+		if w != nil {
+			return len(p), nil
+		}
+	}
+	return 0, cmp.Or(err, io.ErrClosedPipe)
+}
+
+// countingReader counts bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// RestoreOptions define the member data directory is restored for.
+type RestoreOptions struct {
+	// DataDir is the data directory of the member.
+	DataDir string
+	// WALDir is the dedicated WAL directory of the member, if any.
+	WALDir string
+	// Name is the name of the member.
+	Name string
+	// PeerURL is the advertised peer URL of the member.
+	PeerURL string
+	// InitialCluster is the initial cluster configuration of the restored cluster.
+	InitialCluster string
+	// InitialClusterToken is the initial cluster token of the restored cluster.
+	InitialClusterToken string
+	// Overwrite replaces existing data directory unless it is already restored from the same snapshot.
+	Overwrite bool
+	// Progress is updated as the restore goes, if set.
+	Progress *Progress
+}
+
+// restoredMarkerSuffix is appended to the data directory path to get the file with the key
+// of the snapshot the data directory is restored from.
+const restoredMarkerSuffix = ".restored"
+
+// restoringSuffix is appended to the data and WAL directory paths to get the directories
+// the snapshot is restored into before they replace existing ones.
+const restoringSuffix = ".restoring"
+
+// Restore downloads the snapshot stored under the key and restores member data directory from it.
+// Nothing is done if the data directory already exists, so the member keeps its data on restart,
+// unless overwrite is requested and the data directory is not restored from the snapshot yet.
+func Restore(ctx context.Context, storage Storage, key string, opts RestoreOptions, logger *zap.Logger) error {
+	marker := opts.DataDir + restoredMarkerSuffix
+	replace := false
+	if _, err := os.Stat(opts.DataDir); err == nil {
+		restored, _ := os.ReadFile(marker)
+		if !opts.Overwrite || string(restored) == key {
+			logger.Info("data directory exists, skipping restore", zap.String("data-dir", opts.DataDir))
+			return nil
+		}
+		replace = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot check data directory: %w", err)
+	}
+
+	// the snapshot is downloaded, checked and restored aside, so existing data is replaced only once it succeeds
+	manifest, err := ReadManifest(ctx, storage, key)
+	if err != nil {
+		return err
+	}
+	if manifest != nil {
+		if err = manifest.CheckCompatibility(version.MustParseGeneric(etcdversion.Version)); err != nil {
+			return fmt.Errorf("cannot restore snapshot %s: %w", key, err)
+		}
+	}
+
+	snapshotPath := filepath.Join(filepath.Dir(opts.DataDir), "restore.db")
+	opts.Progress.setPhase(etcdaenixiov1alpha1.RestorePhaseDownloading)
+	var compression etcdaenixiov1alpha1.BackupCompression
+	if manifest != nil {
+		compression = manifest.Compression
+	}
+	hash, err := download(ctx, storage, key, compression, snapshotPath, opts.Progress)
+	defer func() {
+		_ = os.Remove(snapshotPath)
+	}()
+	if err != nil {
+		return err
+	}
+	if manifest != nil && manifest.Hash != "" && manifest.Hash != hash {
+		return fmt.Errorf("snapshot %s is corrupted: its hash %s doesn't match hash %s of the manifest", key, hash, manifest.Hash)
+	}
+
+	opts.Progress.setPhase(etcdaenixiov1alpha1.RestorePhaseRestoring)
+	// leftovers of an interrupted restore are dropped, etcdutl refuses to restore into non-empty directories
+	stagingDataDir, stagingWALDir := opts.DataDir+restoringSuffix, ""
+	if opts.WALDir != "" {
+		stagingWALDir = opts.WALDir + restoringSuffix
+	}
+	for _, dir := range []string{stagingDataDir, stagingWALDir} {
+		if dir == "" {
+			continue
+		}
+		if err = os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("cannot clean up restore directory: %w", err)
+		}
+		defer func() {
+			_ = os.RemoveAll(dir)
+		}()
+	}
+	err = snapshot.NewV3(logger).Restore(snapshot.RestoreConfig{
+		SnapshotPath:        snapshotPath,
+		Name:                opts.Name,
+		OutputDataDir:       stagingDataDir,
+		OutputWALDir:        stagingWALDir,
+		PeerURLs:            []string{opts.PeerURL},
+		InitialCluster:      opts.InitialCluster,
+		InitialClusterToken: opts.InitialClusterToken,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot restore snapshot %s: %w", key, err)
+	}
+
+	if replace {
+		logger.Info("replacing data directory", zap.String("data-dir", opts.DataDir))
+	}
+	// the WAL directory is swapped first, the data directory being in place marks the restore done
+	if stagingWALDir != "" {
+		if err = replaceDir(stagingWALDir, opts.WALDir); err != nil {
+			return fmt.Errorf("cannot replace WAL directory: %w", err)
+		}
+	}
+	if err = replaceDir(stagingDataDir, opts.DataDir); err != nil {
+		return fmt.Errorf("cannot replace data directory: %w", err)
+	}
+	if err = os.WriteFile(marker, []byte(key), 0o600); err != nil {
+		return fmt.Errorf("cannot mark data directory restored: %w", err)
+	}
+	opts.Progress.setPhase(etcdaenixiov1alpha1.RestorePhaseCompleted)
+	return nil
+}
+
+// replaceDir moves the src directory to dst, removing what dst holds.
+// Both are on the same volume, so the move is a rename.
+func replaceDir(src, dst string) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// Verify downloads the snapshot stored under the key and restores a scratch member data directory in dir from it,
+// which checks the snapshot integrity hash and that the database can be opened.
+func Verify(ctx context.Context, storage Storage, key, dir string, logger *zap.Logger) error {
+	const peerURL = "http://localhost:2380"
+	return Restore(ctx, storage, key, RestoreOptions{
+		DataDir:        filepath.Join(dir, "verify.etcd"),
+		Name:           "verify",
+		PeerURL:        peerURL,
+		InitialCluster: "verify=" + peerURL,
+		Overwrite:      true,
+	}, logger)
+}
+
+// download stores the snapshot stored under the key decompressed in the dst file and returns its SHA-256 hash.
+// The snapshot is decompressed with the algorithm found by its leading bytes, or the compression if they are not known.
+// Progress is reported in bytes downloaded, which is the size of the stored snapshot.
+func download(
+	ctx context.Context,
+	storage Storage,
+	key string,
+	compression etcdaenixiov1alpha1.BackupCompression,
+	dst string,
+	progress *Progress,
+) (string, error) {
+	rc, err := storage.Download(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	if s, ok := rc.(sizer); ok {
+		if size, err := s.Size(); err == nil {
+			progress.setTotal(size)
+		}
+	}
+
+	br := bufio.NewReader(io.TeeReader(rc, progress))
+	// the compression is told by the snapshot itself, as manifests may be missing or written before compression
+	compression, err = detectCompression(br, compression)
+	if err != nil {
+		return "", fmt.Errorf("cannot decompress snapshot %s: %w", key, err)
+	}
+	r, err := newDecompressor(br, compression)
+	if err != nil {
+		return "", fmt.Errorf("cannot decompress snapshot %s: %w", key, err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", fmt.Errorf("cannot create snapshot file: %w", err)
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(f, hash), r); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("cannot download snapshot %s: %w", key, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), f.Close()
+}
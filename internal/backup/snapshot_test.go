@@ -0,0 +1,190 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// failingStorage fails uploads after reading a part of the object.
+type failingStorage struct {
+	memoryStorage
+}
+
+func (f failingStorage) Upload(_ context.Context, _ string, r io.Reader, _ map[string]string) error {
+	_, _ = io.ReadFull(r, make([]byte, 3))
+	return errors.New("storage is unavailable")
+}
+
+var _ = Describe("Snapshot fan-out", func() {
+	It("should upload snapshots to other targets when one fails", func(ctx SpecContext) {
+		regional, offsite := memoryStorage{}, memoryStorage{}
+		data := strings.Repeat("snapshot", 10000)
+		manifest := &Manifest{EtcdVersion: "3.5.13"}
+		errs := fanOut(ctx, strings.NewReader(data), []Target{
+			{Storage: regional, Key: "etcd/ns/test/1.db"},
+			{Storage: failingStorage{memoryStorage{}}, Key: "ns/test/1.db"},
+			{Storage: offsite, Key: "offsite/ns/test/1.db"},
+		}, nil, manifest)
+		Expect(errs[0]).To(Succeed())
+		Expect(errs[1]).To(MatchError("storage is unavailable"))
+		Expect(errs[2]).To(Succeed())
+		Expect(string(regional["etcd/ns/test/1.db"])).To(Equal(data))
+		Expect(string(offsite["offsite/ns/test/1.db"])).To(Equal(data))
+		Expect(manifest.Size).To(Equal(int64(len(data))))
+		Expect(ReadManifest(ctx, offsite, "offsite/ns/test/1.db")).To(HaveField("Hash", manifest.Hash))
+	})
+
+	DescribeTable("should compress snapshots and decompress them on download",
+		func(ctx SpecContext, compression etcdaenixiov1alpha1.BackupCompression) {
+			storage := memoryStorage{}
+			data := strings.Repeat("snapshot", 10000)
+			manifest := &Manifest{Compression: compression}
+			Expect(fanOut(ctx, strings.NewReader(data), []Target{{Storage: storage, Key: "ns/test/1.db"}}, nil, manifest)).
+				To(HaveExactElements(Succeed()))
+			Expect(len(storage["ns/test/1.db"])).To(BeNumerically("<", len(data)/10))
+			Expect(manifest.Size).To(Equal(int64(len(data))))
+
+			stored, err := ReadManifest(ctx, storage, "ns/test/1.db")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Compression).To(Equal(compression))
+			progress := &Progress{}
+			dst := filepath.Join(GinkgoT().TempDir(), "restore.db")
+			Expect(download(ctx, storage, "ns/test/1.db", stored.Compression, dst, progress)).To(Equal(stored.Hash))
+			Expect(os.ReadFile(dst)).To(Equal([]byte(data)))
+			Expect(progress.Report().BytesDownloaded).To(Equal(int64(len(storage["ns/test/1.db"]))))
+		},
+		Entry("with gzip", etcdaenixiov1alpha1.BackupCompressionGzip),
+		Entry("with zstd", etcdaenixiov1alpha1.BackupCompressionZstd),
+	)
+})
+
+// brokenSnapshot starts as a bbolt database does, so it is taken for an uncompressed snapshot.
+var brokenSnapshot = append(make([]byte, boltMagicOffset), 0xed, 0xda, 0x0c, 0xed, 'b', 'r', 'o', 'k', 'e', 'n')
+
+var _ = Describe("Snapshot restore", func() {
+	var opts RestoreOptions
+
+	BeforeEach(func() {
+		opts = RestoreOptions{DataDir: filepath.Join(GinkgoT().TempDir(), "default.etcd")}
+		Expect(os.Mkdir(opts.DataDir, 0o700)).To(Succeed())
+	})
+
+	It("should keep existing data directory", func(ctx SpecContext) {
+		Expect(Restore(ctx, memoryStorage{}, "ns/test/velero/daily.db", opts, zap.NewNop())).To(Succeed())
+		Expect(opts.DataDir).To(BeADirectory())
+	})
+
+	It("should not overwrite data directory restored from the same snapshot", func(ctx SpecContext) {
+		opts.Overwrite = true
+		Expect(os.WriteFile(opts.DataDir+restoredMarkerSuffix, []byte("ns/test/velero/daily.db"), 0o600)).To(Succeed())
+		Expect(Restore(ctx, memoryStorage{}, "ns/test/velero/daily.db", opts, zap.NewNop())).To(Succeed())
+		Expect(opts.DataDir).To(BeADirectory())
+	})
+
+	It("should replace data directory restored from another snapshot", func(ctx SpecContext) {
+		opts.Overwrite = true
+		Expect(os.WriteFile(opts.DataDir+restoredMarkerSuffix, []byte("ns/test/velero/weekly.db"), 0o600)).To(Succeed())
+		// the snapshot is empty, so restore fails before the data directory is replaced
+		Expect(Restore(ctx, memoryStorage{}, "ns/test/velero/daily.db", opts, zap.NewNop())).NotTo(Succeed())
+		Expect(opts.DataDir).To(BeADirectory())
+		Expect(opts.DataDir + restoringSuffix).NotTo(BeADirectory())
+	})
+
+	It("should report download progress", func(ctx SpecContext) {
+		opts.Overwrite = true
+		opts.Progress = &Progress{}
+		storage := memoryStorage{"ns/test/1.db": brokenSnapshot}
+		// the snapshot is broken, so restore fails after it is downloaded
+		Expect(Restore(ctx, storage, "ns/test/1.db", opts, zap.NewNop())).NotTo(Succeed())
+		Expect(opts.Progress.Report()).To(Equal(ProgressReport{
+			Phase:           etcdaenixiov1alpha1.RestorePhaseRestoring,
+			BytesDownloaded: int64(len(brokenSnapshot)),
+		}))
+	})
+
+	DescribeTable("should detect compression of snapshots",
+		func(ctx SpecContext, compression etcdaenixiov1alpha1.BackupCompression) {
+			storage := memoryStorage{}
+			manifest := &Manifest{Compression: compression}
+			Expect(fanOut(ctx, bytes.NewReader(brokenSnapshot), []Target{{Storage: storage, Key: "ns/test/1.db"}}, nil, manifest)).
+				To(HaveExactElements(Succeed()))
+			dst := filepath.Join(GinkgoT().TempDir(), "restore.db")
+			// the compression is not known, as if the manifest was missing
+			Expect(download(ctx, storage, "ns/test/1.db", "", dst, nil)).To(Equal(manifest.Hash))
+			Expect(os.ReadFile(dst)).To(Equal(brokenSnapshot))
+		},
+		Entry("without compression", etcdaenixiov1alpha1.BackupCompressionNone),
+		Entry("with gzip", etcdaenixiov1alpha1.BackupCompressionGzip),
+		Entry("with zstd", etcdaenixiov1alpha1.BackupCompressionZstd),
+	)
+
+	It("should refuse snapshots of unknown compression", func(ctx SpecContext) {
+		opts.Overwrite = true
+		storage := memoryStorage{"ns/test/1.db": []byte("not a snapshot")}
+		err := Restore(ctx, storage, "ns/test/1.db", opts, zap.NewNop())
+		Expect(err).To(MatchError(ContainSubstring("cannot determine compression")))
+		Expect(opts.DataDir).To(BeADirectory())
+	})
+
+	It("should refuse snapshots of newer etcd versions", func(ctx SpecContext) {
+		opts.Overwrite = true
+		storage := memoryStorage{"ns/test/1.db": brokenSnapshot}
+		Expect(WriteManifest(ctx, storage, "ns/test/1.db", &Manifest{EtcdVersion: "9.0.0"})).To(Succeed())
+		err := Restore(ctx, storage, "ns/test/1.db", opts, zap.NewNop())
+		Expect(err).To(MatchError(ContainSubstring("snapshot is taken with etcd 9.0.0")))
+		Expect(opts.DataDir).To(BeADirectory())
+	})
+
+	It("should refuse snapshots not matching the hash of the manifest", func(ctx SpecContext) {
+		opts.Overwrite = true
+		storage := memoryStorage{"ns/test/1.db": brokenSnapshot}
+		manifest := &Manifest{EtcdVersion: "3.5.13", Hash: "0b1c"}
+		Expect(WriteManifest(ctx, storage, "ns/test/1.db", manifest)).To(Succeed())
+		Expect(ReadManifest(ctx, storage, "ns/test/1.db")).To(Equal(manifest))
+		err := Restore(ctx, storage, "ns/test/1.db", opts, zap.NewNop())
+		Expect(err).To(MatchError(ContainSubstring("is corrupted")))
+	})
+
+	It("should keep existing data when the snapshot doesn't match the hash of the manifest", func(ctx SpecContext) {
+		opts.Overwrite = true
+		opts.WALDir = filepath.Join(filepath.Dir(opts.DataDir), "default.wal")
+		Expect(os.Mkdir(opts.WALDir, 0o700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(opts.DataDir, "db"), []byte("data"), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(opts.WALDir, "0.wal"), []byte("wal"), 0o600)).To(Succeed())
+		storage := memoryStorage{"ns/test/1.db": brokenSnapshot}
+		Expect(WriteManifest(ctx, storage, "ns/test/1.db", &Manifest{EtcdVersion: "3.5.13", Hash: "0b1c"})).To(Succeed())
+		err := Restore(ctx, storage, "ns/test/1.db", opts, zap.NewNop())
+		Expect(err).To(MatchError(ContainSubstring("is corrupted")))
+		Expect(os.ReadFile(filepath.Join(opts.DataDir, "db"))).To(Equal([]byte("data")))
+		Expect(os.ReadFile(filepath.Join(opts.WALDir, "0.wal"))).To(Equal([]byte("wal")))
+		Expect(opts.DataDir + restoredMarkerSuffix).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(filepath.Dir(opts.DataDir), "restore.db")).NotTo(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,331 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/pkg/backupstorage"
+)
+
+const (
+	snapshotTimeFormat = "20060102T150405Z"
+	snapshotExtension  = ".db"
+)
+
+// Storage is a place backups are kept in.
+type Storage = backupstorage.Storage
+
+// sizer is implemented by downloaded objects which know their size.
+type sizer interface {
+	Size() (int64, error)
+}
+
+// NewStorage creates storage for the destination. Credentials are the data of the secret referenced in the destination.
+func NewStorage(destination *etcdaenixiov1alpha1.BackupDestination, credentials map[string][]byte) (Storage, error) {
+	storage, err := newStorage(destination, credentials)
+	if err != nil || destination.Encryption == nil {
+		return storage, err
+	}
+	return newEncryptedStorage(storage, credentials)
+}
+
+func newStorage(destination *etcdaenixiov1alpha1.BackupDestination, credentials map[string][]byte) (Storage, error) {
+	switch {
+	case destination.S3 != nil:
+		return newS3Storage(destination.S3, destination.Proxy, credentials)
+	case destination.GCS != nil:
+		return newGCSStorage(destination.GCS, destination.Proxy, credentials)
+	case destination.AzureBlob != nil:
+		return newAzureBlobStorage(destination.AzureBlob, destination.Proxy, credentials)
+	case destination.Restic != nil:
+		return newResticStorage(destination.Restic, destination.Proxy, credentials)
+	case destination.Provider != nil:
+		return newProviderStorage(destination.Provider, destination.Proxy, credentials)
+	default:
+		return nil, errors.New("backup storage is not specified")
+	}
+}
+
+// CredentialRefs returns references to secret keys credentials of the destination are read from, keyed by
+// the names credentials are passed to the storage with. Credentials not referenced explicitly are read from
+// the keys of the same names in the credentials secret of the destination.
+func CredentialRefs(destination *etcdaenixiov1alpha1.BackupDestination) map[string]corev1.SecretKeySelector {
+	refs := map[string]corev1.SecretKeySelector{}
+	if s3 := destination.S3; s3 != nil {
+		for name, ref := range map[string]*corev1.SecretKeySelector{
+			S3AccessKeyID:     s3.AccessKeyIDRef,
+			S3SecretAccessKey: s3.SecretAccessKeyRef,
+			S3SessionToken:    s3.SessionTokenRef,
+		} {
+			switch {
+			case ref != nil:
+				refs[name] = *ref
+			case s3.CredentialsSecret != "" && name != S3SessionToken:
+				refs[name] = corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: s3.CredentialsSecret},
+					Key:                  name,
+				}
+			}
+		}
+		if s3.CABundleRef != nil {
+			refs[S3CABundle] = *s3.CABundleRef
+		}
+	}
+	if gcs := destination.GCS; gcs != nil && gcs.CredentialsSecret != "" {
+		refs[GCSServiceAccountKey] = corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: gcs.CredentialsSecret},
+			Key:                  GCSServiceAccountKey,
+		}
+	}
+	if azure := destination.AzureBlob; azure != nil && azure.CredentialsSecret != "" {
+		refs[AzureConnectionString] = corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: azure.CredentialsSecret},
+			Key:                  AzureConnectionString,
+		}
+	}
+	if restic := destination.Restic; restic != nil {
+		for _, name := range []string{ResticPassword, ResticRESTUsername, ResticRESTPassword} {
+			refs[name] = corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: restic.CredentialsSecret},
+				Key:                  name,
+				Optional:             ptr.To(name != ResticPassword),
+			}
+		}
+	}
+	if provider := destination.Provider; provider != nil && provider.CredentialsSecret != "" {
+		registered, _ := backupstorage.Lookup(provider.Name)
+		for _, names := range [][]string{registered.Credentials, registered.OptionalCredentials} {
+			for _, name := range names {
+				refs[name] = corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: provider.CredentialsSecret},
+					Key:                  name,
+					Optional:             ptr.To(!slices.Contains(registered.Credentials, name)),
+				}
+			}
+		}
+	}
+	if encryption := destination.Encryption; encryption != nil {
+		refs[EncryptionKey] = encryption.KeyRef
+	}
+	return refs
+}
+
+// LoadCredentials reads credentials from the directory credentials are mounted to, file names are the names
+// returned by CredentialRefs.
+func LoadCredentials(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read credentials directory: %w", err)
+	}
+	credentials := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		// secret volume contains hidden data directory and symlinks to its files
+		if entry.IsDir() || entry.Name()[0] == '.' {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read credentials: %w", err)
+		}
+		credentials[entry.Name()] = data
+	}
+	return credentials, nil
+}
+
+// SnapshotKeyPrefix returns the prefix of keys of the cluster snapshots in the default layout. Snapshots taken
+// before Velero backups are stored under it regardless of the key template.
+func SnapshotKeyPrefix(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	return path.Join(destinationPrefix(&cluster.Spec.Backup.Destination), cluster.Namespace, cluster.Name) + "/"
+}
+
+// SnapshotKey returns the key of the cluster snapshot taken at the given time and revision, laid out
+// by the key template of the cluster.
+func SnapshotKey(cluster *etcdaenixiov1alpha1.EtcdCluster, t time.Time, revision int64) string {
+	return path.Join(destinationPrefix(&cluster.Spec.Backup.Destination),
+		snapshotReplacer(cluster, t, revision).Replace(snapshotKeyTemplate(cluster)))
+}
+
+// SnapshotTags returns object tags of the cluster snapshot taken at the given time and revision.
+func SnapshotTags(cluster *etcdaenixiov1alpha1.EtcdCluster, t time.Time, revision int64) map[string]string {
+	if len(cluster.Spec.Backup.Tags) == 0 {
+		return nil
+	}
+	replacer := snapshotReplacer(cluster, t, revision)
+	tags := make(map[string]string, len(cluster.Spec.Backup.Tags))
+	for name, value := range cluster.Spec.Backup.Tags {
+		tags[name] = replacer.Replace(value)
+	}
+	return tags
+}
+
+// VeleroSnapshotKey returns the key of the cluster snapshot taken before the Velero backup.
+// These snapshots are kept apart from periodic ones and are never considered the latest snapshot.
+func VeleroSnapshotKey(cluster *etcdaenixiov1alpha1.EtcdCluster, backupName string) string {
+	return SnapshotKeyPrefix(cluster) + "velero/" + backupName + snapshotExtension
+}
+
+// LatestSnapshot returns the key of the latest periodic snapshot of the cluster or empty string if there are
+// no snapshots.
+func LatestSnapshot(ctx context.Context, storage Storage, cluster *etcdaenixiov1alpha1.EtcdCluster) (string, error) {
+	snapshots, err := periodicSnapshots(ctx, storage, cluster)
+	if err != nil || len(snapshots) == 0 {
+		return "", err
+	}
+	return snapshots[0].Key, nil
+}
+
+// ListSnapshots returns snapshots of the cluster found in the storage, periodic snapshots from the latest one
+// followed by snapshots taken before Velero backups.
+func ListSnapshots(ctx context.Context, storage Storage, cluster *etcdaenixiov1alpha1.EtcdCluster) ([]etcdaenixiov1alpha1.AvailableBackup, error) {
+	snapshots, err := periodicSnapshots(ctx, storage, cluster)
+	if err != nil {
+		return nil, err
+	}
+	prefix := SnapshotKeyPrefix(cluster) + "velero/"
+	keys, err := storage.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list snapshots: %w", err)
+	}
+	for _, key := range keys {
+		backupName, ok := strings.CutSuffix(strings.TrimPrefix(key, prefix), snapshotExtension)
+		if ok && !strings.Contains(backupName, "/") {
+			snapshots = append(snapshots, etcdaenixiov1alpha1.AvailableBackup{Key: key, VeleroBackup: backupName})
+		}
+	}
+	return snapshots, nil
+}
+
+// periodicSnapshots returns periodic snapshots of the cluster from the latest one. Snapshots are found by matching
+// keys against the key template, listing keys under its part preceding the first snapshot-specific placeholder.
+func periodicSnapshots(ctx context.Context, storage Storage, cluster *etcdaenixiov1alpha1.EtcdCluster) ([]etcdaenixiov1alpha1.AvailableBackup, error) {
+	template := path.Join(destinationPrefix(&cluster.Spec.Backup.Destination), snapshotKeyTemplate(cluster))
+	template = strings.NewReplacer("{namespace}", cluster.Namespace, "{cluster}", cluster.Name).Replace(template)
+	prefix := template
+	if i := strings.IndexByte(template, '{'); i >= 0 {
+		prefix = template[:i]
+	}
+	pattern := regexp.MustCompile("^" + strings.NewReplacer(
+		`\{timestamp\}`, `(?P<timestamp>\d{8}T\d{6}Z)`,
+		`\{revision\}`, `\d+`,
+	).Replace(regexp.QuoteMeta(template)) + "$")
+
+	keys, err := storage.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list snapshots: %w", err)
+	}
+	var snapshots []etcdaenixiov1alpha1.AvailableBackup
+	for _, key := range keys {
+		match := pattern.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		takenAt, err := time.Parse(snapshotTimeFormat, match[pattern.SubexpIndex("timestamp")])
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, etcdaenixiov1alpha1.AvailableBackup{Key: key, TakenAt: &metav1.Time{Time: takenAt}})
+	}
+	slices.SortStableFunc(snapshots, func(a, b etcdaenixiov1alpha1.AvailableBackup) int {
+		return b.TakenAt.Compare(a.TakenAt.Time)
+	})
+	return snapshots, nil
+}
+
+// snapshotKeyTemplate returns the key template of periodic snapshots of the cluster.
+func snapshotKeyTemplate(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	return cmp.Or(cluster.Spec.Backup.KeyTemplate, etcdaenixiov1alpha1.DefaultSnapshotKeyTemplate)
+}
+
+// snapshotReplacer replaces placeholders of key and tag templates for the snapshot taken at the time and revision.
+func snapshotReplacer(cluster *etcdaenixiov1alpha1.EtcdCluster, t time.Time, revision int64) *strings.Replacer {
+	return strings.NewReplacer(
+		"{namespace}", cluster.Namespace,
+		"{cluster}", cluster.Name,
+		"{timestamp}", t.UTC().Format(snapshotTimeFormat),
+		"{revision}", strconv.FormatInt(revision, 10),
+	)
+}
+
+// SnapshotExists checks if there is a snapshot stored under the key.
+func SnapshotExists(ctx context.Context, storage Storage, key string) (bool, error) {
+	keys, err := storage.List(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("cannot list snapshots: %w", err)
+	}
+	return slices.Contains(keys, key), nil
+}
+
+// SnapshotURL returns the URL of the snapshot stored under the key in the destination.
+func SnapshotURL(destination *etcdaenixiov1alpha1.BackupDestination, key string) string {
+	switch {
+	case destination.S3 != nil:
+		return "s3://" + path.Join(destination.S3.Bucket, key)
+	case destination.GCS != nil:
+		return "gs://" + path.Join(destination.GCS.Bucket, key)
+	case destination.AzureBlob != nil:
+		return "azblob://" + path.Join(destination.AzureBlob.Container, key)
+	case destination.Restic != nil && key != "":
+		// snapshots in restic repositories are addressed by their paths
+		return destination.Restic.Repository + "#/" + key
+	case destination.Restic != nil:
+		return destination.Restic.Repository
+	case destination.Provider != nil:
+		return destination.Provider.Name + "://" + key
+	}
+	return key
+}
+
+// DestinationURL returns the URL identifying the destination.
+func DestinationURL(destination *etcdaenixiov1alpha1.BackupDestination) string {
+	return SnapshotURL(destination, destinationPrefix(destination))
+}
+
+// DestinationKey returns the key the snapshot stored under the key in the backup destination of the cluster
+// is stored under in another destination, keeping the layout of the key under the prefix of the destination.
+func DestinationKey(cluster *etcdaenixiov1alpha1.EtcdCluster, destination *etcdaenixiov1alpha1.BackupDestination, key string) string {
+	relative := strings.TrimPrefix(key, destinationPrefix(&cluster.Spec.Backup.Destination))
+	return path.Join(destinationPrefix(destination), strings.TrimLeft(relative, "/"))
+}
+
+func destinationPrefix(destination *etcdaenixiov1alpha1.BackupDestination) string {
+	switch {
+	case destination.S3 != nil:
+		return destination.S3.Prefix
+	case destination.GCS != nil:
+		return destination.GCS.Prefix
+	case destination.AzureBlob != nil:
+		return destination.AzureBlob.Prefix
+	}
+	return ""
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/pkg/backupstorage"
+)
+
+// memoryStorage keeps objects in memory.
+type memoryStorage map[string][]byte
+
+func (m memoryStorage) Upload(_ context.Context, key string, r io.Reader, _ map[string]string) error {
+	data, err := io.ReadAll(r)
+	m[key] = data
+	return err
+}
+
+func (m memoryStorage) Download(_ context.Context, key string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(m[key])), nil
+}
+
+func (m memoryStorage) List(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (m memoryStorage) Delete(_ context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+var _ = Describe("Backup storage", func() {
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+		Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+			Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+				Destination: etcdaenixiov1alpha1.BackupDestination{
+					S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups", Prefix: "etcd"},
+				},
+			},
+		},
+	}
+
+	Context("When generating snapshot keys", func() {
+		It("should put snapshots under cluster prefix", func() {
+			t := time.Date(2024, 4, 1, 12, 30, 0, 0, time.UTC)
+			Expect(SnapshotKey(cluster, t, 42)).To(Equal("etcd/ns/test/20240401T123000Z.db"))
+		})
+
+		It("should address snapshots by bucket URL", func() {
+			Expect(SnapshotURL(&cluster.Spec.Backup.Destination, "etcd/ns/test/20240401T123000Z.db")).
+				To(Equal("s3://backups/etcd/ns/test/20240401T123000Z.db"))
+			gcs := &etcdaenixiov1alpha1.BackupDestination{GCS: &etcdaenixiov1alpha1.GCSDestination{Bucket: "backups", Prefix: "etcd"}}
+			Expect(SnapshotURL(gcs, "etcd/ns/test/20240401T123000Z.db")).To(Equal("gs://backups/etcd/ns/test/20240401T123000Z.db"))
+			Expect(DestinationKey(cluster, gcs, "etcd/ns/test/20240401T123000Z.db")).To(Equal("etcd/ns/test/20240401T123000Z.db"))
+			azure := &etcdaenixiov1alpha1.BackupDestination{
+				AzureBlob: &etcdaenixiov1alpha1.AzureBlobDestination{Container: "backups", Prefix: "dr"},
+			}
+			Expect(SnapshotURL(azure, "dr/ns/test/20240401T123000Z.db")).To(Equal("azblob://backups/dr/ns/test/20240401T123000Z.db"))
+			Expect(DestinationKey(cluster, azure, "etcd/ns/test/20240401T123000Z.db")).To(Equal("dr/ns/test/20240401T123000Z.db"))
+		})
+
+		It("should keep snapshot layout in additional destinations", func() {
+			offsite := &etcdaenixiov1alpha1.BackupDestination{S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "offsite"}}
+			Expect(DestinationKey(cluster, offsite, "etcd/ns/test/20240401T123000Z.db")).To(Equal("ns/test/20240401T123000Z.db"))
+			offsite.S3.Prefix = "dr/etcd"
+			Expect(DestinationKey(cluster, offsite, "etcd/ns/test/20240401T123000Z.db")).To(Equal("dr/etcd/ns/test/20240401T123000Z.db"))
+			Expect(DestinationURL(offsite)).To(Equal("s3://offsite/dr/etcd"))
+		})
+	})
+
+	Context("When looking for the latest snapshot", func() {
+		It("should return the most recent snapshot of the cluster", func(ctx SpecContext) {
+			storage := memoryStorage{
+				"etcd/ns/test/20240401T120000Z.db":  nil,
+				"etcd/ns/test/20240401T130000Z.db":  nil,
+				"etcd/ns/test/20240401T140000Z.txt": nil,
+				"etcd/ns/test/velero/daily.db":      nil,
+				"etcd/ns/other/20240402T120000Z.db": nil,
+			}
+			Expect(LatestSnapshot(ctx, storage, cluster)).To(Equal("etcd/ns/test/20240401T130000Z.db"))
+		})
+
+		It("should return empty key without snapshots", func(ctx SpecContext) {
+			Expect(LatestSnapshot(ctx, memoryStorage{}, cluster)).To(BeEmpty())
+		})
+
+		It("should find snapshots taken before Velero backups", func(ctx SpecContext) {
+			key := VeleroSnapshotKey(cluster, "daily")
+			Expect(key).To(Equal("etcd/ns/test/velero/daily.db"))
+			Expect(SnapshotExists(ctx, memoryStorage{key: nil}, key)).To(BeTrue())
+			Expect(SnapshotExists(ctx, memoryStorage{key: nil}, VeleroSnapshotKey(cluster, "weekly"))).To(BeFalse())
+		})
+	})
+
+	Context("When listing snapshots", func() {
+		It("should list the latest periodic snapshots first followed by Velero ones", func(ctx SpecContext) {
+			storage := memoryStorage{
+				"etcd/ns/test/20240401T120000Z.db":  nil,
+				"etcd/ns/test/20240401T130000Z.db":  nil,
+				"etcd/ns/test/20240401T140000Z.txt": nil,
+				"etcd/ns/test/velero/daily.db":      nil,
+				"etcd/ns/other/20240402T120000Z.db": nil,
+			}
+			snapshots, err := ListSnapshots(ctx, storage, cluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshots).To(HaveLen(3))
+			Expect(snapshots[0].Key).To(Equal("etcd/ns/test/20240401T130000Z.db"))
+			Expect(snapshots[0].TakenAt.Time).To(Equal(time.Date(2024, 4, 1, 13, 0, 0, 0, time.UTC)))
+			Expect(snapshots[1].Key).To(Equal("etcd/ns/test/20240401T120000Z.db"))
+			Expect(snapshots[2]).To(Equal(etcdaenixiov1alpha1.AvailableBackup{
+				Key: "etcd/ns/test/velero/daily.db", VeleroBackup: "daily",
+			}))
+		})
+	})
+
+	Context("When laying out snapshots by the key template", func() {
+		templated := cluster.DeepCopy()
+		templated.Spec.Backup.KeyTemplate = "clusters/{cluster}-{namespace}/rev-{revision}-{timestamp}.snap"
+		templated.Spec.Backup.Tags = map[string]string{"cluster": "{namespace}/{cluster}", "team": "etcd"}
+		t := time.Date(2024, 4, 1, 12, 30, 0, 0, time.UTC)
+
+		It("should render keys and tags", func() {
+			Expect(SnapshotKey(templated, t, 42)).To(Equal("etcd/clusters/test-ns/rev-42-20240401T123000Z.snap"))
+			Expect(SnapshotTags(templated, t, 42)).To(Equal(map[string]string{"cluster": "ns/test", "team": "etcd"}))
+		})
+
+		It("should find snapshots matching the template", func(ctx SpecContext) {
+			storage := memoryStorage{
+				"etcd/clusters/test-ns/rev-9-20240401T130000Z.snap":    nil,
+				"etcd/clusters/test-ns/rev-42-20240401T123000Z.snap":   nil,
+				"etcd/clusters/test-ns/notes.txt":                      nil,
+				"etcd/clusters/test-other/rev-1-20240402T120000Z.snap": nil,
+				"etcd/ns/test/velero/daily.db":                         nil,
+			}
+			Expect(LatestSnapshot(ctx, storage, templated)).To(Equal("etcd/clusters/test-ns/rev-9-20240401T130000Z.snap"))
+			snapshots, err := ListSnapshots(ctx, storage, templated)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshots).To(HaveLen(3))
+			Expect(snapshots[1].Key).To(Equal("etcd/clusters/test-ns/rev-42-20240401T123000Z.snap"))
+			Expect(snapshots[2].VeleroBackup).To(Equal("daily"))
+		})
+	})
+
+	Context("When resolving credential references", func() {
+		It("should read credentials from the credentials secret by default", func() {
+			destination := &etcdaenixiov1alpha1.BackupDestination{
+				S3: &etcdaenixiov1alpha1.S3Destination{CredentialsSecret: "s3"},
+			}
+			Expect(CredentialRefs(destination)).To(Equal(map[string]corev1.SecretKeySelector{
+				S3AccessKeyID: {LocalObjectReference: corev1.LocalObjectReference{Name: "s3"}, Key: S3AccessKeyID},
+				S3SecretAccessKey: {
+					LocalObjectReference: corev1.LocalObjectReference{Name: "s3"}, Key: S3SecretAccessKey,
+				},
+			}))
+		})
+
+		It("should read the GCS service account key unless Workload Identity is used", func() {
+			destination := &etcdaenixiov1alpha1.BackupDestination{
+				GCS: &etcdaenixiov1alpha1.GCSDestination{Bucket: "backups", CredentialsSecret: "gcs"},
+			}
+			Expect(CredentialRefs(destination)).To(Equal(map[string]corev1.SecretKeySelector{
+				GCSServiceAccountKey: {LocalObjectReference: corev1.LocalObjectReference{Name: "gcs"}, Key: GCSServiceAccountKey},
+			}))
+			destination.GCS.CredentialsSecret = ""
+			Expect(CredentialRefs(destination)).To(BeEmpty())
+		})
+
+		It("should read the Azure connection string unless a managed identity is used", func() {
+			destination := &etcdaenixiov1alpha1.BackupDestination{
+				AzureBlob: &etcdaenixiov1alpha1.AzureBlobDestination{Container: "backups", CredentialsSecret: "azure"},
+			}
+			Expect(CredentialRefs(destination)).To(Equal(map[string]corev1.SecretKeySelector{
+				AzureConnectionString: {LocalObjectReference: corev1.LocalObjectReference{Name: "azure"}, Key: AzureConnectionString},
+			}))
+			destination.AzureBlob.CredentialsSecret = ""
+			Expect(CredentialRefs(destination)).To(BeEmpty())
+		})
+
+		It("should override keys of the credentials secret with references", func() {
+			token := corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "sts"}, Key: "token"}
+			destination := &etcdaenixiov1alpha1.BackupDestination{
+				S3: &etcdaenixiov1alpha1.S3Destination{
+					CredentialsSecret: "s3",
+					AccessKeyIDRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "sops"}, Key: "AWS_ACCESS_KEY_ID",
+					},
+					SessionTokenRef: &token,
+				},
+			}
+			refs := CredentialRefs(destination)
+			Expect(refs).To(HaveLen(3))
+			Expect(refs[S3AccessKeyID].Key).To(Equal("AWS_ACCESS_KEY_ID"))
+			Expect(refs[S3SecretAccessKey].Name).To(Equal("s3"))
+			Expect(refs[S3SessionToken]).To(Equal(token))
+		})
+
+		It("should read the CA bundle of S3-compatible endpoints", func() {
+			ca := corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "minio-ca"}, Key: "ca.crt"}
+			destination := &etcdaenixiov1alpha1.BackupDestination{
+				S3: &etcdaenixiov1alpha1.S3Destination{CredentialsSecret: "s3", CABundleRef: &ca},
+			}
+			refs := CredentialRefs(destination)
+			Expect(refs).To(HaveLen(3))
+			Expect(refs[S3CABundle]).To(Equal(ca))
+		})
+	})
+
+	Context("When loading credentials", func() {
+		It("should read files of mounted secret", func() {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, S3AccessKeyID), []byte("key"), 0o600)).To(Succeed())
+			Expect(os.Mkdir(filepath.Join(dir, "..data"), 0o700)).To(Succeed())
+			Expect(LoadCredentials(dir)).To(Equal(map[string][]byte{S3AccessKeyID: []byte("key")}))
+		})
+	})
+
+	Context("When storing snapshots in restic repositories", func() {
+		It("should keep snapshots as restic snapshots of files", func(ctx SpecContext) {
+			dir := GinkgoT().TempDir()
+			// the fake restic records its arguments and lists two snapshots of the same file
+			script := `#!/bin/sh
+echo "$RESTIC_REPOSITORY $RESTIC_PASSWORD $*" >> ` + filepath.Join(dir, "calls") + `
+cat >/dev/null
+echo '[{"paths":["/ns/test/2.db"]},{"paths":["/ns/test/1.db"]},{"paths":["/ns/test/1.db"]},{"paths":["/ns/other/1.db"]}]'
+`
+			Expect(os.WriteFile(filepath.Join(dir, "restic"), []byte(script), 0o700)).To(Succeed())
+			DeferCleanup(func(binary string) { resticBinary = binary }, resticBinary)
+			resticBinary = filepath.Join(dir, "restic")
+
+			destination := &etcdaenixiov1alpha1.BackupDestination{
+				Restic: &etcdaenixiov1alpha1.ResticDestination{Repository: "rest:http://backup:8000/etcd", CredentialsSecret: "restic"},
+			}
+			storage, err := NewStorage(destination, map[string][]byte{ResticPassword: []byte("secret")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storage.Upload(ctx, "ns/test/3.db", strings.NewReader("snapshot"), map[string]string{"env": "prod"})).To(Succeed())
+			Expect(storage.List(ctx, "ns/test/")).To(Equal([]string{"ns/test/1.db", "ns/test/2.db"}))
+
+			calls, err := os.ReadFile(filepath.Join(dir, "calls"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Split(strings.TrimSpace(string(calls)), "\n")).To(Equal([]string{
+				"rest:http://backup:8000/etcd secret --no-cache --quiet backup --stdin --stdin-filename /ns/test/3.db " +
+					"--host etcd-operator --tag etcd-operator --tag env=prod",
+				"rest:http://backup:8000/etcd secret --no-cache --quiet snapshots --json --tag etcd-operator",
+			}))
+			Expect(SnapshotURL(destination, "ns/test/3.db")).To(Equal("rest:http://backup:8000/etcd#/ns/test/3.db"))
+		})
+	})
+
+	Context("provider storage", func() {
+		It("should create storage of the registered provider with its credentials", func(ctx SpecContext) {
+			objects := memoryStorage{}
+			var options backupstorage.Options
+			backupstorage.Register("memory", backupstorage.Provider{
+				Credentials:         []string{"token"},
+				OptionalCredentials: []string{"ca"},
+				New: func(o backupstorage.Options) (backupstorage.Storage, error) {
+					options = o
+					return objects, nil
+				},
+			})
+
+			destination := &etcdaenixiov1alpha1.BackupDestination{
+				Provider: &etcdaenixiov1alpha1.ProviderDestination{
+					Name:              "memory",
+					Config:            map[string]string{"container": "etcd"},
+					CredentialsSecret: "memory-credentials",
+				},
+			}
+			refs := CredentialRefs(destination)
+			Expect(refs).To(HaveLen(2))
+			Expect(refs["token"].Name).To(Equal("memory-credentials"))
+			Expect(*refs["token"].Optional).To(BeFalse())
+			Expect(*refs["ca"].Optional).To(BeTrue())
+
+			storage, err := NewStorage(destination, map[string][]byte{"token": []byte("secret")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(options.Config).To(Equal(map[string]string{"container": "etcd"}))
+			Expect(options.Credentials).To(Equal(map[string][]byte{"token": []byte("secret")}))
+			Expect(storage.Upload(ctx, "ns/test/1.db", strings.NewReader("snapshot"), nil)).To(Succeed())
+			Expect(storage.Delete(ctx, "ns/test/1.db")).To(Succeed())
+			Expect(objects).To(BeEmpty())
+			Expect(SnapshotURL(destination, "ns/test/1.db")).To(Equal("memory://ns/test/1.db"))
+
+			destination.Provider.Name = "swift"
+			_, err = NewStorage(destination, nil)
+			Expect(err).To(MatchError("backup storage provider swift is not registered, registered providers are [memory]"))
+		})
+	})
+})
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+// CacheByObject restricts the cache of ConfigMaps to the objects created by the operator.
+// Otherwise every ConfigMap of watched namespaces is cached, which dominates the operator memory at scale.
+// ConfigMaps referenced by name are read with the client returned by NewClient. Secrets are cached as metadata
+// only, see NewClient.
+func CacheByObject() map[client.Object]cache.ByObject {
+	managed := labels.SelectorFromSet(labels.Set(factory.NewLabelsBuilder().WithManagedBy()))
+	return map[client.Object]cache.ByObject{
+		&corev1.ConfigMap{}: {Label: managed},
+	}
+}
+
+// StripManagedFields is the cache transform dropping managed fields, which are never read by the operator.
+func StripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, err := meta.Accessor(obj); err == nil {
+		accessor.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
+// NewClient creates the manager client. Secrets are always read from the API server, so their contents are
+// never cached, while Secrets are watched as metadata only. ConfigMaps missing in the cache are read from
+// the API server, since ConfigMaps referenced by name are not cached.
+func NewClient(config *rest.Config, options client.Options) (client.Client, error) {
+	if options.Cache != nil {
+		options.Cache.DisableFor = append(options.Cache.DisableFor, &corev1.Secret{})
+	}
+	cached, err := client.New(config, options)
+	if err != nil {
+		return nil, err
+	}
+	options.Cache = nil
+	uncached, err := client.New(config, options)
+	if err != nil {
+		return nil, err
+	}
+	return &referencedObjectsClient{Client: cached, apiReader: uncached}, nil
+}
+
+// referencedObjectsClient falls back to apiReader for ConfigMaps not found in the cache.
+type referencedObjectsClient struct {
+	client.Client
+	apiReader client.Reader
+}
+
+func (c *referencedObjectsClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	err := c.Client.Get(ctx, key, obj, opts...)
+	if !errors.IsNotFound(err) {
+		return err
+	}
+	if _, ok := obj.(*corev1.ConfigMap); ok {
+		return c.apiReader.Get(ctx, key, obj, opts...)
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Operator cache", func() {
+	It("should cache only ConfigMaps created by the operator", func() {
+		byObject := CacheByObject()
+		Expect(byObject).To(HaveLen(1))
+		for _, options := range byObject {
+			Expect(options.Label.Matches(labels.Set{"app.kubernetes.io/managed-by": "etcd-operator"})).To(BeTrue())
+			Expect(options.Label.Matches(labels.Set{})).To(BeFalse())
+		}
+	})
+
+	It("should strip managed fields", func() {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}}}}
+		Expect(StripManagedFields(pod)).To(Equal(&corev1.Pod{}))
+	})
+
+	It("should read referenced objects missing in the cache from the API server", func(ctx SpecContext) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "values"}}
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-0"}}
+		rclient := &referencedObjectsClient{
+			Client:    fake.NewClientBuilder().WithScheme(scheme).Build(),
+			apiReader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(configMap, pod).Build(),
+		}
+
+		Expect(rclient.Get(ctx, client.ObjectKeyFromObject(configMap), &corev1.ConfigMap{})).To(Succeed())
+		err := rclient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
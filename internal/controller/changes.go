@@ -0,0 +1,99 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/k8sutils"
+)
+
+// maxChangesInEvent is the number of changed fields listed in events, all of them are logged.
+const maxChangesInEvent = 10
+
+// changeRecordingClient logs fields changed by updates of objects controlled by clusters and records them
+// in Updated events of the clusters, so it can be told later why, for example, members were restarted.
+type changeRecordingClient struct {
+	client.Client
+	recorder record.EventRecorder
+}
+
+// NewChangeRecordingClient returns the client recording changes of objects controlled by clusters in events.
+func NewChangeRecordingClient(c client.Client, recorder record.EventRecorder) client.Client {
+	return &changeRecordingClient{Client: c, recorder: recorder}
+}
+
+// Update implements client.Writer.
+func (c *changeRecordingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil || owner.Kind != "EtcdCluster" || owner.APIVersion != etcdaenixiov1alpha1.GroupVersion.String() {
+		return c.Client.Update(ctx, obj, opts...)
+	}
+	current, ok := obj.DeepCopyObject().(client.Object)
+	if !ok || c.Client.Get(ctx, client.ObjectKeyFromObject(obj), current) != nil {
+		return c.Client.Update(ctx, obj, opts...)
+	}
+	if err := c.Client.Update(ctx, obj, opts...); err != nil {
+		return err
+	}
+	c.recordChanges(ctx, owner, current, obj)
+	return nil
+}
+
+// recordChanges logs changes between the current and the updated object and records them in an event
+// of the owner cluster.
+func (c *changeRecordingClient) recordChanges(ctx context.Context, owner *metav1.OwnerReference, current, updated client.Object) {
+	logger := log.FromContext(ctx)
+	changes, err := k8sutils.Diff(current, updated)
+	if err != nil {
+		logger.Error(err, "cannot compute changes of updated object", "name", updated.GetName())
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	kind := "object"
+	if gvk, err := apiutil.GVKForObject(updated, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	fields := make([]string, 0, len(changes))
+	for _, change := range changes {
+		fields = append(fields, change.String())
+	}
+	logger.Info("object updated", "kind", kind, "name", updated.GetName(), "changes", fields)
+
+	message := strings.Join(fields[:min(len(fields), maxChangesInEvent)], ", ")
+	if len(fields) > maxChangesInEvent {
+		message += fmt.Sprintf(" and %d more", len(fields)-maxChangesInEvent)
+	}
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{
+		Namespace: updated.GetNamespace(),
+		Name:      owner.Name,
+		UID:       owner.UID,
+	}}
+	c.recorder.Eventf(cluster, corev1.EventTypeNormal, "Updated", "Updated %s %s: %s", kind, updated.GetName(), message)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Change recording client", func() {
+	It("should record changed fields of objects controlled by clusters", func(ctx SpecContext) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		configMap := func(name, value string, controlled bool) *corev1.ConfigMap {
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+				Data:       map[string]string{"ETCD_QUOTA_BACKEND_BYTES": value},
+			}
+			if controlled {
+				cm.OwnerReferences = []metav1.OwnerReference{{
+					APIVersion: etcdaenixiov1alpha1.GroupVersion.String(),
+					Kind:       "EtcdCluster",
+					Name:       "test",
+					UID:        "uid",
+					Controller: ptr.To(true),
+				}}
+			}
+			return cm
+		}
+		recorder := record.NewFakeRecorder(10)
+		c := NewChangeRecordingClient(fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(configMap("test", "2147483648", true), configMap("other", "1", false)).Build(), recorder)
+
+		updated := configMap("test", "4294967296", true)
+		Expect(c.Update(ctx, updated)).To(Succeed())
+		Expect(recorder.Events).To(Receive(Equal(
+			`Normal Updated Updated ConfigMap test: data.ETCD_QUOTA_BACKEND_BYTES: "2147483648" -> "4294967296"`)))
+
+		// updates without changes and updates of other objects are not recorded
+		Expect(c.Update(ctx, updated)).To(Succeed())
+		Expect(c.Update(ctx, configMap("other", "2", false))).To(Succeed())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+})
@@ -0,0 +1,166 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// backupClusterRetryInterval is how often a pending backup checks if the cluster became ready.
+const backupClusterRetryInterval = 30 * time.Second
+
+// EtcdBackupReconciler reconciles a EtcdBackup object
+type EtcdBackupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdbackups,verbs=get;list;watch
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdbackups/status,verbs=get;update;patch
+
+// Reconcile takes a snapshot of the cluster to its backup destinations once the cluster is ready and reports
+// the result in the backup status. Finished backups are never taken again.
+func (r *EtcdBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	etcdBackup := &etcdaenixiov1alpha1.EtcdBackup{}
+	if err := r.Get(ctx, req.NamespacedName, etcdBackup); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !etcdBackup.DeletionTimestamp.IsZero() || etcdBackup.Finished() {
+		return ctrl.Result{}, nil
+	}
+	if etcdBackup.Status.Phase == etcdaenixiov1alpha1.EtcdBackupPhaseRunning {
+		// the operator restarted while the snapshot was streamed, its result is unknown
+		return ctrl.Result{}, r.setPhase(ctx, etcdBackup, etcdaenixiov1alpha1.EtcdBackupPhaseFailed,
+			etcdaenixiov1alpha1.EtcdBackupReasonFailed, "snapshot was interrupted")
+	}
+
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: etcdBackup.Namespace, Name: etcdBackup.Spec.Cluster.Name}, cluster)
+	if errors.IsNotFound(err) {
+		return ctrl.Result{}, r.setPhase(ctx, etcdBackup, etcdaenixiov1alpha1.EtcdBackupPhaseFailed,
+			etcdaenixiov1alpha1.EtcdBackupReasonClusterNotFound,
+			fmt.Sprintf("cluster %s does not exist", etcdBackup.Spec.Cluster.Name))
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	applyDefaultBackupPolicy(ctx, cluster)
+	if cluster.Spec.Backup == nil {
+		return ctrl.Result{}, r.setPhase(ctx, etcdBackup, etcdaenixiov1alpha1.EtcdBackupPhaseFailed,
+			etcdaenixiov1alpha1.EtcdBackupReasonBackupNotEnabled,
+			fmt.Sprintf("cluster %s has no backup destination", cluster.Name))
+	}
+	ready, err := membersReady(ctx, r.Client, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !ready {
+		return ctrl.Result{RequeueAfter: backupClusterRetryInterval}, r.setPhase(ctx, etcdBackup,
+			etcdaenixiov1alpha1.EtcdBackupPhasePending, etcdaenixiov1alpha1.EtcdBackupReasonClusterNotReady,
+			fmt.Sprintf("waiting for cluster %s to become ready", cluster.Name))
+	}
+
+	if etcdBackup.Spec.Compression != "" {
+		cluster.Spec.Backup.Compression = etcdBackup.Spec.Compression
+	}
+
+	now := time.Now()
+	etcdBackup.Status.StartTime = &metav1.Time{Time: now}
+	if err = r.setPhase(ctx, etcdBackup, etcdaenixiov1alpha1.EtcdBackupPhaseRunning,
+		etcdaenixiov1alpha1.EtcdBackupReasonRunning, "taking snapshot"); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.FromContext(ctx).Info("taking snapshot", "cluster", cluster.Name)
+	snapshot, err := snapshotCluster(ctx, r.Client, r.Recorder, cluster, now, "")
+	if err == nil {
+		err = snapshot.err()
+	}
+	if err != nil {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "SnapshotFailed",
+			"Cannot take snapshot for backup %s: %v", etcdBackup.Name, err)
+		return ctrl.Result{}, r.setPhase(ctx, etcdBackup, etcdaenixiov1alpha1.EtcdBackupPhaseFailed,
+			etcdaenixiov1alpha1.EtcdBackupReasonFailed, err.Error())
+	}
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "SnapshotTaken", "Took snapshot %s", snapshot.key)
+	etcdBackup.Status.SnapshotKey = snapshot.key
+	manifest := snapshot.manifest
+	etcdBackup.Status.Compression = cmp.Or(manifest.Compression, etcdaenixiov1alpha1.BackupCompressionNone)
+	etcdBackup.Status.Revision = manifest.Revision
+	etcdBackup.Status.RaftTerm = int64(manifest.RaftTerm)
+	etcdBackup.Status.Size = resource.NewQuantity(manifest.Size, resource.BinarySI)
+	etcdBackup.Status.SHA256 = manifest.Hash
+	etcdBackup.Status.EtcdVersion = manifest.EtcdVersion
+	return ctrl.Result{}, r.setPhase(ctx, etcdBackup, etcdaenixiov1alpha1.EtcdBackupPhaseSucceeded,
+		etcdaenixiov1alpha1.EtcdBackupReasonSucceeded, fmt.Sprintf("snapshot is taken to %s", snapshot.key))
+}
+
+// setPhase updates the phase of the backup together with its Completed condition.
+func (r *EtcdBackupReconciler) setPhase(
+	ctx context.Context,
+	etcdBackup *etcdaenixiov1alpha1.EtcdBackup,
+	phase etcdaenixiov1alpha1.EtcdBackupPhase,
+	reason, message string,
+) error {
+	status := metav1.ConditionUnknown
+	switch phase {
+	case etcdaenixiov1alpha1.EtcdBackupPhaseSucceeded:
+		status = metav1.ConditionTrue
+		r.Recorder.Event(etcdBackup, corev1.EventTypeNormal, reason, message)
+	case etcdaenixiov1alpha1.EtcdBackupPhaseFailed:
+		status = metav1.ConditionFalse
+		r.Recorder.Event(etcdBackup, corev1.EventTypeWarning, reason, message)
+	}
+	etcdBackup.Status.Phase = phase
+	if etcdBackup.Finished() {
+		etcdBackup.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	}
+	meta.SetStatusCondition(&etcdBackup.Status.Conditions, metav1.Condition{
+		Type:               etcdaenixiov1alpha1.EtcdBackupConditionCompleted,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: etcdBackup.Generation,
+	})
+	return r.Status().Update(ctx, etcdBackup)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&etcdaenixiov1alpha1.EtcdBackup{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+	"github.com/aenix-io/etcd-operator/pkg/backupstorage"
+	"github.com/aenix-io/etcd-operator/pkg/etcdclient/etcdclienttest"
+)
+
+var _ = Describe("EtcdBackup controller", func() {
+	var (
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+		r       *EtcdBackupReconciler
+	)
+
+	reconcile := func(ctx SpecContext, etcdBackup *etcdaenixiov1alpha1.EtcdBackup) (ctrl.Result, *etcdaenixiov1alpha1.EtcdBackup) {
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: etcdBackup.Namespace, Name: etcdBackup.Name}}
+		result, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, req.NamespacedName, etcdBackup)).To(Succeed())
+		return result, etcdBackup
+	}
+	newBackup := func(clusterName string) *etcdaenixiov1alpha1.EtcdBackup {
+		return &etcdaenixiov1alpha1.EtcdBackup{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "backup"},
+			Spec:       etcdaenixiov1alpha1.EtcdBackupSpec{Cluster: corev1.LocalObjectReference{Name: clusterName}},
+		}
+	}
+
+	BeforeEach(func() {
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+			Spec:       etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(1))},
+		}
+	})
+
+	JustBeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		r = &EtcdBackupReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).
+				WithStatusSubresource(&etcdaenixiov1alpha1.EtcdBackup{}).Build(),
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	It("should fail if the cluster does not exist", func(ctx SpecContext) {
+		etcdBackup := newBackup("missing")
+		Expect(r.Create(ctx, etcdBackup)).To(Succeed())
+		_, etcdBackup = reconcile(ctx, etcdBackup)
+		Expect(etcdBackup.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdBackupPhaseFailed))
+		Expect(etcdBackup.Status.CompletionTime).NotTo(BeNil())
+		condition := meta.FindStatusCondition(etcdBackup.Status.Conditions, etcdaenixiov1alpha1.EtcdBackupConditionCompleted)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(etcdaenixiov1alpha1.EtcdBackupReasonClusterNotFound))
+	})
+
+	It("should fail if the cluster has no backup destination", func(ctx SpecContext) {
+		etcdBackup := newBackup("test")
+		Expect(r.Create(ctx, etcdBackup)).To(Succeed())
+		_, etcdBackup = reconcile(ctx, etcdBackup)
+		Expect(etcdBackup.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdBackupPhaseFailed))
+		Expect(etcdBackup.Status.Conditions[0].Reason).To(Equal(etcdaenixiov1alpha1.EtcdBackupReasonBackupNotEnabled))
+	})
+
+	When("the cluster has a backup destination", func() {
+		BeforeEach(func() {
+			cluster.Spec.Backup = &etcdaenixiov1alpha1.ClusterBackupSpec{}
+		})
+
+		It("should wait for the cluster to become ready", func(ctx SpecContext) {
+			etcdBackup := newBackup("test")
+			Expect(r.Create(ctx, etcdBackup)).To(Succeed())
+			result, etcdBackup := reconcile(ctx, etcdBackup)
+			Expect(result.RequeueAfter).To(Equal(backupClusterRetryInterval))
+			Expect(etcdBackup.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdBackupPhasePending))
+			Expect(etcdBackup.Status.Conditions[0].Reason).To(Equal(etcdaenixiov1alpha1.EtcdBackupReasonClusterNotReady))
+		})
+	})
+
+	When("the cluster is ready", func() {
+		var (
+			bucket   memoryStorage
+			fakeEtcd *etcdclienttest.Cluster
+		)
+
+		BeforeEach(func() {
+			bucket = memoryStorage{}
+			backupstorage.Register("backup-status-test", backupstorage.Provider{
+				New: func(backupstorage.Options) (backupstorage.Storage, error) {
+					return bucket, nil
+				},
+			})
+			cluster.Spec.Backup = &etcdaenixiov1alpha1.ClusterBackupSpec{
+				Destination: etcdaenixiov1alpha1.BackupDestination{
+					Provider: &etcdaenixiov1alpha1.ProviderDestination{Name: "backup-status-test"},
+				},
+			}
+			cluster.Spec.EtcdAPI = &etcdaenixiov1alpha1.EtcdAPISpec{MaxRetries: ptr.To(int32(0))}
+			fakeEtcd = etcdclienttest.NewClusterFor(cluster)
+			fakeEtcd.SetVersion("3.5.13")
+			etcd.ConfigureClientFactory(etcdclienttest.NewFactory(fakeEtcd))
+			DeferCleanup(func() {
+				etcd.ConfigureClientFactory(nil)
+			})
+		})
+
+		It("should record the snapshot in status", func(ctx SpecContext) {
+			Expect(r.Create(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-0"},
+				Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+					{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+				}},
+			})).To(Succeed())
+			cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(cli.Close)
+			for _, key := range []string{"/app/a", "/app/b", "/app/a"} {
+				_, err = cli.Put(ctx, key, "value")
+				Expect(err).NotTo(HaveOccurred())
+			}
+			status, err := cli.Status(ctx, cli.Endpoints()[0])
+			Expect(err).NotTo(HaveOccurred())
+
+			etcdBackup := newBackup("test")
+			Expect(r.Create(ctx, etcdBackup)).To(Succeed())
+			_, etcdBackup = reconcile(ctx, etcdBackup)
+			Expect(etcdBackup.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdBackupPhaseSucceeded))
+			Expect(bucket).To(HaveKey(etcdBackup.Status.SnapshotKey))
+			snapshot := bucket[etcdBackup.Status.SnapshotKey]
+			hash := sha256.Sum256(snapshot)
+			Expect(etcdBackup.Status.Revision).To(Equal(status.Header.Revision))
+			Expect(etcdBackup.Status.RaftTerm).To(Equal(int64(status.RaftTerm)))
+			Expect(etcdBackup.Status.RaftTerm).To(BeNumerically(">", 0))
+			Expect(etcdBackup.Status.Size.Value()).To(Equal(int64(len(snapshot))))
+			Expect(etcdBackup.Status.SHA256).To(Equal(hex.EncodeToString(hash[:])))
+			Expect(etcdBackup.Status.EtcdVersion).To(Equal("3.5.13"))
+			Expect(etcdBackup.Status.Compression).To(Equal(etcdaenixiov1alpha1.BackupCompressionNone))
+		})
+	})
+
+	It("should fail backups interrupted while running", func(ctx SpecContext) {
+		etcdBackup := newBackup("test")
+		Expect(r.Create(ctx, etcdBackup)).To(Succeed())
+		etcdBackup.Status.Phase = etcdaenixiov1alpha1.EtcdBackupPhaseRunning
+		Expect(r.Status().Update(ctx, etcdBackup)).To(Succeed())
+		_, etcdBackup = reconcile(ctx, etcdBackup)
+		Expect(etcdBackup.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdBackupPhaseFailed))
+	})
+})
@@ -0,0 +1,293 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/cron"
+)
+
+// EtcdBackupScheduleReconciler reconciles a EtcdBackupSchedule object
+type EtcdBackupScheduleReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdbackupschedules,verbs=get;list;watch
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdbackupschedules/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdbackups,verbs=create;delete
+
+// Reconcile creates a backup of the cluster when the schedule is due, like a CronJob creates Jobs,
+// and deletes finished backups beyond the history limits of the schedule.
+func (r *EtcdBackupScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	schedule := &etcdaenixiov1alpha1.EtcdBackupSchedule{}
+	if err := r.Get(ctx, req.NamespacedName, schedule); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !schedule.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	original := schedule.Status.DeepCopy()
+	result, err := r.reconcileSchedule(ctx, schedule)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !equality.Semantic.DeepEqual(original, &schedule.Status) {
+		if err = r.Status().Update(ctx, schedule); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return result, nil
+}
+
+// reconcileSchedule creates the backup if it is due and updates the schedule status without saving it.
+func (r *EtcdBackupScheduleReconciler) reconcileSchedule(
+	ctx context.Context,
+	schedule *etcdaenixiov1alpha1.EtcdBackupSchedule,
+) (ctrl.Result, error) {
+	cronSchedule, err := cron.Parse(schedule.Spec.Schedule)
+	if err != nil {
+		if !meta.IsStatusConditionFalse(schedule.Status.Conditions, etcdaenixiov1alpha1.EtcdBackupScheduleConditionValid) {
+			r.Recorder.Event(schedule, corev1.EventTypeWarning, etcdaenixiov1alpha1.EtcdBackupScheduleReasonInvalidSchedule, err.Error())
+		}
+		r.setValid(schedule, metav1.ConditionFalse, etcdaenixiov1alpha1.EtcdBackupScheduleReasonInvalidSchedule, err.Error())
+		// the schedule is parsed again once it is changed
+		return ctrl.Result{}, nil
+	}
+	r.setValid(schedule, metav1.ConditionTrue, etcdaenixiov1alpha1.EtcdBackupScheduleReasonValid, "schedule is valid")
+
+	backups, err := r.scheduledBackups(ctx, schedule)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	schedule.Status.Active = nil
+	for _, etcdBackup := range backups {
+		switch etcdBackup.Status.Phase {
+		case etcdaenixiov1alpha1.EtcdBackupPhaseSucceeded:
+			completed := etcdBackup.Status.CompletionTime
+			if last := schedule.Status.LastSuccessfulTime; completed != nil && (last == nil || last.Before(completed)) {
+				schedule.Status.LastSuccessfulTime = completed
+			}
+		case etcdaenixiov1alpha1.EtcdBackupPhaseFailed:
+		default:
+			schedule.Status.Active = append(schedule.Status.Active, etcdBackup.Name)
+		}
+	}
+	for _, etcdBackup := range backupsToPrune(backups, schedule.SuccessfulHistoryLimit(), schedule.FailedHistoryLimit()) {
+		if err = r.Delete(ctx, &etcdBackup); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, fmt.Errorf("cannot delete backup %s: %w", etcdBackup.Name, err)
+		}
+	}
+	if schedule.Suspended() {
+		return ctrl.Result{}, nil
+	}
+
+	now := time.Now().UTC()
+	earliest := schedule.CreationTimestamp.Time
+	if schedule.Status.LastScheduleTime != nil {
+		earliest = schedule.Status.LastScheduleTime.Time
+	}
+	if deadline := schedule.Spec.StartingDeadlineSeconds; deadline != nil {
+		// times before the deadline are skipped anyway
+		earliest = maxTime(earliest, now.Add(-time.Duration(*deadline)*time.Second))
+	}
+	next := cronSchedule.Next(now)
+	requeue := ctrl.Result{}
+	if !next.IsZero() {
+		requeue.RequeueAfter = next.Sub(now)
+	}
+	scheduled, tooManyMissed := mostRecentScheduleTime(cronSchedule, earliest.UTC(), now)
+	if scheduled.IsZero() {
+		return requeue, nil
+	}
+
+	log := log.FromContext(ctx)
+	if tooManyMissed {
+		log.Info("too many missed activation times, only the latest is used", "scheduled", scheduled)
+		r.Recorder.Eventf(schedule, corev1.EventTypeWarning, "TooManyMissedTimes",
+			"More than %d activation times were missed, only the latest one is used. "+
+				"Set or decrease .spec.startingDeadlineSeconds or check clock skew", maxMissedSchedules)
+	}
+	switch {
+	case len(schedule.Status.Active) == 0:
+	case schedule.Spec.ConcurrencyPolicy == etcdaenixiov1alpha1.ForbidConcurrent:
+		// the backup is created once the active one finishes, unless the deadline passes
+		log.Info("skipping backup while the previous one is active", "scheduled", scheduled)
+		return requeue, nil
+	case schedule.Spec.ConcurrencyPolicy == etcdaenixiov1alpha1.ReplaceConcurrent:
+		for _, etcdBackup := range backups {
+			if !etcdBackup.Finished() {
+				if err = r.Delete(ctx, &etcdBackup); client.IgnoreNotFound(err) != nil {
+					return ctrl.Result{}, fmt.Errorf("cannot delete backup %s: %w", etcdBackup.Name, err)
+				}
+			}
+		}
+		schedule.Status.Active = nil
+	}
+
+	etcdBackup := &etcdaenixiov1alpha1.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: schedule.Namespace,
+			// the name is stable for the scheduled time, so the backup isn't created twice
+			Name:   fmt.Sprintf("%s-%d", schedule.Name, scheduled.Unix()/60),
+			Labels: map[string]string{etcdaenixiov1alpha1.BackupScheduleLabel: schedule.Name},
+		},
+		Spec: etcdaenixiov1alpha1.EtcdBackupSpec{Cluster: schedule.Spec.Cluster},
+	}
+	if err = ctrl.SetControllerReference(schedule, etcdBackup, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	schedule.Status.LastScheduleTime = &metav1.Time{Time: scheduled}
+	if err = r.Create(ctx, etcdBackup); errors.IsAlreadyExists(err) {
+		// the backup was created by a previous reconciliation, whose status update was lost,
+		// it is listed as active above unless it has already finished
+		log.V(2).Info("backup already exists", "backup", etcdBackup.Name, "scheduled", scheduled)
+		return requeue, nil
+	} else if err != nil {
+		r.Recorder.Eventf(schedule, corev1.EventTypeWarning, "BackupFailed", "Cannot create backup: %v", err)
+		return ctrl.Result{}, fmt.Errorf("cannot create backup %s: %w", etcdBackup.Name, err)
+	}
+	log.Info("backup created", "backup", etcdBackup.Name, "scheduled", scheduled)
+	r.Recorder.Eventf(schedule, corev1.EventTypeNormal, "BackupCreated", "Created backup %s", etcdBackup.Name)
+	if !slices.Contains(schedule.Status.Active, etcdBackup.Name) {
+		schedule.Status.Active = append(schedule.Status.Active, etcdBackup.Name)
+	}
+	return requeue, nil
+}
+
+// setValid sets the Valid condition of the schedule.
+func (r *EtcdBackupScheduleReconciler) setValid(
+	schedule *etcdaenixiov1alpha1.EtcdBackupSchedule,
+	status metav1.ConditionStatus,
+	reason, message string,
+) {
+	meta.SetStatusCondition(&schedule.Status.Conditions, metav1.Condition{
+		Type:               etcdaenixiov1alpha1.EtcdBackupScheduleConditionValid,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: schedule.Generation,
+	})
+}
+
+// scheduledBackups returns backups created by the schedule, the oldest first.
+func (r *EtcdBackupScheduleReconciler) scheduledBackups(
+	ctx context.Context,
+	schedule *etcdaenixiov1alpha1.EtcdBackupSchedule,
+) ([]etcdaenixiov1alpha1.EtcdBackup, error) {
+	list := &etcdaenixiov1alpha1.EtcdBackupList{}
+	if err := r.List(ctx, list, client.InNamespace(schedule.Namespace),
+		client.MatchingLabels{etcdaenixiov1alpha1.BackupScheduleLabel: schedule.Name}); err != nil {
+		return nil, fmt.Errorf("cannot list backups: %w", err)
+	}
+	backups := slices.DeleteFunc(list.Items, func(etcdBackup etcdaenixiov1alpha1.EtcdBackup) bool {
+		return !metav1.IsControlledBy(&etcdBackup, schedule)
+	})
+	slices.SortFunc(backups, func(a, b etcdaenixiov1alpha1.EtcdBackup) int {
+		return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+	})
+	return backups, nil
+}
+
+// maxMissedSchedules is the number of missed activation times iterated over before looking for the latest one
+// directly, like a CronJob does.
+const maxMissedSchedules = 100
+
+// mostRecentScheduleTime returns the latest activation time of the schedule after the earliest time and not after
+// now, or zero time if there is none. Only the latest of missed times is returned, like a CronJob does.
+// It reports if more than maxMissedSchedules times were missed.
+func mostRecentScheduleTime(schedule cron.Schedule, earliest, now time.Time) (time.Time, bool) {
+	var scheduled time.Time
+	missed := 0
+	for t := schedule.Next(earliest); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		if missed++; missed > maxMissedSchedules {
+			return latestScheduleTime(schedule, scheduled, now), true
+		}
+		scheduled = t
+	}
+	return scheduled, false
+}
+
+// latestScheduleTime returns the latest activation time of the schedule after the earliest time and not after now,
+// looking for it in periods before now doubled until one has an activation time.
+func latestScheduleTime(schedule cron.Schedule, earliest, now time.Time) time.Time {
+	for period := time.Minute; ; period *= 2 {
+		from := maxTime(earliest, now.Add(-period))
+		var scheduled time.Time
+		for t := schedule.Next(from); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+			scheduled = t
+		}
+		if !scheduled.IsZero() || from.Equal(earliest) {
+			return scheduled
+		}
+	}
+}
+
+// backupsToPrune returns finished backups, sorted the oldest first, beyond the history limits.
+func backupsToPrune(backups []etcdaenixiov1alpha1.EtcdBackup, successfulLimit, failedLimit int) []etcdaenixiov1alpha1.EtcdBackup {
+	var succeeded, failed []etcdaenixiov1alpha1.EtcdBackup
+	for _, etcdBackup := range backups {
+		switch etcdBackup.Status.Phase {
+		case etcdaenixiov1alpha1.EtcdBackupPhaseSucceeded:
+			succeeded = append(succeeded, etcdBackup)
+		case etcdaenixiov1alpha1.EtcdBackupPhaseFailed:
+			failed = append(failed, etcdBackup)
+		}
+	}
+	var pruned []etcdaenixiov1alpha1.EtcdBackup
+	if extra := len(succeeded) - successfulLimit; extra > 0 {
+		pruned = append(pruned, succeeded[:extra]...)
+	}
+	if extra := len(failed) - failedLimit; extra > 0 {
+		pruned = append(pruned, failed[:extra]...)
+	}
+	return pruned
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdBackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&etcdaenixiov1alpha1.EtcdBackupSchedule{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&etcdaenixiov1alpha1.EtcdBackup{}).
+		Complete(r)
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/cron"
+)
+
+var _ = Describe("EtcdBackupSchedule controller", func() {
+	var r *EtcdBackupScheduleReconciler
+
+	newSchedule := func(expr string) *etcdaenixiov1alpha1.EtcdBackupSchedule {
+		return &etcdaenixiov1alpha1.EtcdBackupSchedule{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "ns",
+				Name:              "nightly",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-48 * time.Hour)},
+			},
+			Spec: etcdaenixiov1alpha1.EtcdBackupScheduleSpec{
+				Cluster:  corev1.LocalObjectReference{Name: "test"},
+				Schedule: expr,
+			},
+		}
+	}
+	reconcile := func(ctx SpecContext, schedule *etcdaenixiov1alpha1.EtcdBackupSchedule) ctrl.Result {
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: schedule.Namespace, Name: schedule.Name}}
+		result, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, req.NamespacedName, schedule)).To(Succeed())
+		return result
+	}
+	listBackups := func(ctx SpecContext) []etcdaenixiov1alpha1.EtcdBackup {
+		list := &etcdaenixiov1alpha1.EtcdBackupList{}
+		Expect(r.List(ctx, list, client.InNamespace("ns"))).To(Succeed())
+		return list.Items
+	}
+
+	createBackup := func(
+		ctx SpecContext,
+		schedule *etcdaenixiov1alpha1.EtcdBackupSchedule,
+		name string,
+		phase etcdaenixiov1alpha1.EtcdBackupPhase,
+	) {
+		etcdBackup := &etcdaenixiov1alpha1.EtcdBackup{ObjectMeta: metav1.ObjectMeta{
+			Namespace:         schedule.Namespace,
+			Name:              name,
+			Labels:            map[string]string{etcdaenixiov1alpha1.BackupScheduleLabel: schedule.Name},
+			CreationTimestamp: metav1.Time{Time: time.Now().Add(time.Duration(len(listBackups(ctx))) * time.Minute)},
+		}}
+		Expect(ctrl.SetControllerReference(schedule, etcdBackup, r.Scheme)).To(Succeed())
+		Expect(r.Create(ctx, etcdBackup)).To(Succeed())
+		if phase != "" {
+			etcdBackup.Status.Phase = phase
+			if etcdBackup.Finished() {
+				etcdBackup.Status.CompletionTime = &metav1.Time{Time: time.Now().Truncate(time.Second)}
+			}
+			Expect(r.Status().Update(ctx, etcdBackup)).To(Succeed())
+		}
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		r = &EtcdBackupScheduleReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).
+				WithStatusSubresource(&etcdaenixiov1alpha1.EtcdBackupSchedule{}, &etcdaenixiov1alpha1.EtcdBackup{}).Build(),
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	It("should create a backup for the latest missed time only", func(ctx SpecContext) {
+		schedule := newSchedule("@hourly")
+		Expect(r.Create(ctx, schedule)).To(Succeed())
+
+		result := reconcile(ctx, schedule)
+		Expect(result.RequeueAfter).To(BeNumerically("<=", time.Hour))
+		backups := listBackups(ctx)
+		Expect(backups).To(HaveLen(1))
+		Expect(backups[0].Spec.Cluster.Name).To(Equal("test"))
+		Expect(backups[0].Labels).To(HaveKeyWithValue(etcdaenixiov1alpha1.BackupScheduleLabel, "nightly"))
+		Expect(metav1.IsControlledBy(&backups[0], schedule)).To(BeTrue())
+		Expect(schedule.Status.Active).To(ConsistOf(backups[0].Name))
+		Expect(schedule.Status.LastScheduleTime.Time).To(BeTemporally("==", time.Now().Truncate(time.Hour)))
+
+		reconcile(ctx, schedule)
+		Expect(listBackups(ctx)).To(HaveLen(1))
+	})
+
+	It("should not report a backup created by a previous reconciliation again", func(ctx SpecContext) {
+		schedule := newSchedule("@hourly")
+		Expect(r.Create(ctx, schedule)).To(Succeed())
+		name := fmt.Sprintf("nightly-%d", time.Now().Truncate(time.Hour).Unix()/60)
+		createBackup(ctx, schedule, name, "")
+
+		reconcile(ctx, schedule)
+		Expect(listBackups(ctx)).To(HaveLen(1))
+		Expect(schedule.Status.Active).To(Equal([]string{name}))
+		Expect(schedule.Status.LastScheduleTime.Time).To(BeTemporally("==", time.Now().Truncate(time.Hour)))
+		Expect(r.Recorder.(*record.FakeRecorder).Events).To(BeEmpty())
+	})
+
+	It("should not create backups while suspended", func(ctx SpecContext) {
+		schedule := newSchedule("@hourly")
+		schedule.Spec.Suspend = ptr.To(true)
+		Expect(r.Create(ctx, schedule)).To(Succeed())
+		reconcile(ctx, schedule)
+		Expect(listBackups(ctx)).To(BeEmpty())
+	})
+
+	It("should skip missed times beyond the starting deadline", func(ctx SpecContext) {
+		schedule := newSchedule("0 0 1 1 *")
+		schedule.Spec.StartingDeadlineSeconds = ptr.To(int64(60))
+		Expect(r.Create(ctx, schedule)).To(Succeed())
+		reconcile(ctx, schedule)
+		Expect(listBackups(ctx)).To(BeEmpty())
+		Expect(schedule.Status.LastScheduleTime).To(BeNil())
+	})
+
+	It("should not create a backup while the previous one is active if concurrency is forbidden", func(ctx SpecContext) {
+		schedule := newSchedule("* * * * *")
+		schedule.Spec.ConcurrencyPolicy = etcdaenixiov1alpha1.ForbidConcurrent
+		Expect(r.Create(ctx, schedule)).To(Succeed())
+		createBackup(ctx, schedule, "nightly-1", "")
+
+		reconcile(ctx, schedule)
+		Expect(listBackups(ctx)).To(HaveLen(1))
+		Expect(schedule.Status.Active).To(ConsistOf("nightly-1"))
+		Expect(schedule.Status.LastScheduleTime).To(BeNil())
+	})
+
+	It("should replace the active backup if concurrency policy is Replace", func(ctx SpecContext) {
+		schedule := newSchedule("* * * * *")
+		schedule.Spec.ConcurrencyPolicy = etcdaenixiov1alpha1.ReplaceConcurrent
+		Expect(r.Create(ctx, schedule)).To(Succeed())
+		createBackup(ctx, schedule, "nightly-1", etcdaenixiov1alpha1.EtcdBackupPhaseRunning)
+
+		reconcile(ctx, schedule)
+		backups := listBackups(ctx)
+		Expect(backups).To(HaveLen(1))
+		Expect(backups[0].Name).NotTo(Equal("nightly-1"))
+		Expect(schedule.Status.Active).To(ConsistOf(backups[0].Name))
+	})
+
+	It("should report invalid cron expressions", func(ctx SpecContext) {
+		schedule := newSchedule("every day")
+		Expect(r.Create(ctx, schedule)).To(Succeed())
+		reconcile(ctx, schedule)
+		Expect(listBackups(ctx)).To(BeEmpty())
+		condition := meta.FindStatusCondition(schedule.Status.Conditions, etcdaenixiov1alpha1.EtcdBackupScheduleConditionValid)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(etcdaenixiov1alpha1.EtcdBackupScheduleReasonInvalidSchedule))
+	})
+
+	It("should keep finished backups within history limits and track the last successful time", func(ctx SpecContext) {
+		schedule := newSchedule("@yearly")
+		schedule.Spec.SuccessfulBackupsHistoryLimit = ptr.To(int32(1))
+		schedule.Spec.FailedBackupsHistoryLimit = ptr.To(int32(0))
+		schedule.Status.LastScheduleTime = &metav1.Time{Time: time.Now()}
+		Expect(r.Create(ctx, schedule)).To(Succeed())
+		createBackup(ctx, schedule, "nightly-1", etcdaenixiov1alpha1.EtcdBackupPhaseSucceeded)
+		createBackup(ctx, schedule, "nightly-2", etcdaenixiov1alpha1.EtcdBackupPhaseSucceeded)
+		createBackup(ctx, schedule, "nightly-3", etcdaenixiov1alpha1.EtcdBackupPhaseFailed)
+
+		reconcile(ctx, schedule)
+		backups := listBackups(ctx)
+		Expect(backups).To(HaveLen(1))
+		Expect(backups[0].Name).To(Equal("nightly-2"))
+		Expect(schedule.Status.LastSuccessfulTime).To(Equal(backups[0].Status.CompletionTime))
+		Expect(schedule.Status.Active).To(BeEmpty())
+	})
+
+	It("should find the latest missed activation time", func() {
+		schedule, err := cron.Parse("0 */6 * * *")
+		Expect(err).NotTo(HaveOccurred())
+		earliest := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		scheduled, tooManyMissed := mostRecentScheduleTime(schedule, earliest, earliest.Add(5*time.Hour))
+		Expect(scheduled.IsZero()).To(BeTrue())
+		Expect(tooManyMissed).To(BeFalse())
+		scheduled, tooManyMissed = mostRecentScheduleTime(schedule, earliest, earliest.Add(20*time.Hour))
+		Expect(scheduled).To(Equal(earliest.Add(18 * time.Hour)))
+		Expect(tooManyMissed).To(BeFalse())
+	})
+
+	It("should find the latest of too many missed activation times", func() {
+		schedule, err := cron.Parse("* 0 * * *")
+		Expect(err).NotTo(HaveOccurred())
+		earliest := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		scheduled, tooManyMissed := mostRecentScheduleTime(schedule, earliest, earliest.Add(3*time.Hour))
+		Expect(scheduled).To(Equal(earliest.Add(59 * time.Minute)))
+		Expect(tooManyMissed).To(BeFalse())
+
+		scheduled, tooManyMissed = mostRecentScheduleTime(schedule, earliest, earliest.AddDate(1, 0, 0).Add(90*time.Minute))
+		Expect(scheduled).To(Equal(earliest.AddDate(1, 0, 0).Add(59 * time.Minute)))
+		Expect(tooManyMissed).To(BeTrue())
+	})
+})
@@ -0,0 +1,262 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// passwordBytes is the number of random bytes of generated passwords.
+const passwordBytes = 24
+
+// reconcileAuth generates credentials of the root user and managed users, stores them in Secrets and sets them
+// in etcd, enabling authentication once the root user exists. Passwords older than the rotation maximum age are
+// replaced: the new password is stored in the Secret first, the previous one is kept until the new password is
+// set in etcd, then consumers of the credentials are restarted. It returns time after which the next password
+// has to be rotated or zero if rotation is disabled.
+func (r *EtcdClusterReconciler) reconcileAuth(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	if cluster.Spec.Security == nil || cluster.Spec.Security.Auth == nil {
+		return 0, nil
+	}
+	auth := cluster.Spec.Security.Auth
+	now := time.Now()
+
+	// the root user goes last, since changing its password invalidates tokens of the operator client
+	users := append(slices.Clone(auth.Users), etcdaenixiov1alpha1.ManagedUser{
+		Name:       etcdaenixiov1alpha1.RootUser,
+		Roles:      []string{etcdaenixiov1alpha1.RootUser},
+		SecretName: cluster.RootCredentialsSecret(),
+	})
+	var rotateIn time.Duration
+	pending := map[string]*corev1.Secret{}
+	for _, user := range users {
+		secret, err := r.ensureCredentials(ctx, cluster, user, now)
+		if err != nil {
+			return 0, err
+		}
+		if secret.Annotations[etcdaenixiov1alpha1.CredentialsAppliedAnnotation] != "true" {
+			pending[user.Name] = secret
+		}
+		if auth.Rotation != nil {
+			rotateIn = minPositive(rotateIn, credentialsExpireIn(secret, now, auth.Rotation.MaxAge.Duration))
+		}
+	}
+	if len(pending) == 0 {
+		return rotateIn, nil
+	}
+
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return 0, fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	for _, user := range users {
+		secret, ok := pending[user.Name]
+		if !ok {
+			continue
+		}
+		password := string(secret.Data[corev1.BasicAuthPasswordKey])
+		roles := user.Roles
+		if cluster.Spec.ReadOnly && user.Name != etcdaenixiov1alpha1.RootUser {
+			// granted once the cluster is writable again, see reconcileReadOnly
+			roles = nil
+		} else if frozen, ok := quotaFrozenRoles(cluster, user.Name); ok {
+			// roles permitting writes over key quotas are granted once the quotas are met, see enforceKeyQuotas
+			roles = withoutRoles(roles, frozen)
+		}
+		if err = etcd.SetUserPassword(ctx, cli, user.Name, password, roles); err != nil {
+			return 0, err
+		}
+		if user.Name == etcdaenixiov1alpha1.RootUser {
+			_ = cli.Close()
+			if cli, err = etcd.NewClusterClientAs(ctx, r.Client, cluster, user.Name, password); err != nil {
+				return 0, fmt.Errorf("cannot create etcd client: %w", err)
+			}
+		}
+	}
+	if err = etcd.EnableAuth(ctx, cli); err != nil {
+		return 0, err
+	}
+
+	for _, user := range users {
+		secret, ok := pending[user.Name]
+		if !ok {
+			continue
+		}
+		if err = r.markCredentialsApplied(ctx, secret); err != nil {
+			return 0, err
+		}
+		rotatedAt := secret.Annotations[etcdaenixiov1alpha1.CredentialsRotatedAtAnnotation]
+		for _, consumer := range user.Consumers {
+			if err = r.restartConsumer(ctx, cluster.Namespace, consumer, rotatedAt); err != nil {
+				return 0, err
+			}
+		}
+		log.FromContext(ctx).Info("password is set in etcd", "user", user.Name)
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "CredentialsRotated",
+			"Password of user %s is set from secret %s", user.Name, secret.Name)
+	}
+	return rotateIn, nil
+}
+
+// ensureCredentials creates the credentials Secret of the user with a generated password or replaces
+// the password if it is older than the rotation maximum age. The password is not set in etcd yet.
+func (r *EtcdClusterReconciler) ensureCredentials(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	user etcdaenixiov1alpha1.ManagedUser,
+	now time.Time,
+) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: user.SecretName}, secret)
+	found := err == nil
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("cannot get credentials secret %s: %w", user.SecretName, err)
+	}
+	if found {
+		// a password which is not set in etcd yet is never replaced, so the previous password is not lost
+		rotation := cluster.Spec.Security.Auth.Rotation
+		if rotation == nil || credentialsExpireIn(secret, now, rotation.MaxAge.Duration) > 0 ||
+			secret.Annotations[etcdaenixiov1alpha1.CredentialsAppliedAnnotation] != "true" {
+			return secret, nil
+		}
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: cluster.Namespace,
+				Name:      user.SecretName,
+				Labels:    factory.NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy(),
+			},
+			Type: corev1.SecretTypeBasicAuth,
+			Data: map[string][]byte{corev1.BasicAuthUsernameKey: []byte(user.Name)},
+		}
+		if err = factory.SetOwner(cluster, secret, r.Scheme); err != nil {
+			return nil, fmt.Errorf("cannot set controller reference: %w", err)
+		}
+	} else {
+		secret.Data[etcd.PreviousPasswordKey] = secret.Data[corev1.BasicAuthPasswordKey]
+	}
+	secret.Data[corev1.BasicAuthPasswordKey] = []byte(password)
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[etcdaenixiov1alpha1.CredentialsRotatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	secret.Annotations[etcdaenixiov1alpha1.CredentialsAppliedAnnotation] = "false"
+
+	if !found {
+		err = r.Create(ctx, secret)
+	} else {
+		err = r.Update(ctx, secret)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot store credentials in secret %s: %w", secret.Name, err)
+	}
+	return secret, nil
+}
+
+// markCredentialsApplied marks the password of the Secret as set in etcd and removes the previous password.
+func (r *EtcdClusterReconciler) markCredentialsApplied(ctx context.Context, secret *corev1.Secret) error {
+	delete(secret.Data, etcd.PreviousPasswordKey)
+	secret.Annotations[etcdaenixiov1alpha1.CredentialsAppliedAnnotation] = "true"
+	if err := r.Update(ctx, secret); err != nil {
+		return fmt.Errorf("cannot update credentials secret %s: %w", secret.Name, err)
+	}
+	return nil
+}
+
+// restartConsumer annotates the pod template of the workload with the time of the password change,
+// so its pods are recreated with the new password. Missing workloads are ignored.
+func (r *EtcdClusterReconciler) restartConsumer(
+	ctx context.Context,
+	namespace string,
+	consumer etcdaenixiov1alpha1.CredentialConsumer,
+	rotatedAt string,
+) error {
+	var obj client.Object
+	var template *corev1.PodTemplateSpec
+	switch consumer.Kind {
+	case "Deployment":
+		deployment := &appsv1.Deployment{}
+		obj, template = deployment, &deployment.Spec.Template
+	case "StatefulSet":
+		sts := &appsv1.StatefulSet{}
+		obj, template = sts, &sts.Spec.Template
+	case "DaemonSet":
+		ds := &appsv1.DaemonSet{}
+		obj, template = ds, &ds.Spec.Template
+	default:
+		return fmt.Errorf("unsupported credentials consumer kind %s", consumer.Kind)
+	}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: consumer.Name}, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if template.Annotations[etcdaenixiov1alpha1.CredentialsRotatedAtAnnotation] == rotatedAt {
+		return nil
+	}
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[etcdaenixiov1alpha1.CredentialsRotatedAtAnnotation] = rotatedAt
+	if err := r.Patch(ctx, obj, patch); err != nil {
+		return fmt.Errorf("cannot restart %s %s: %w", consumer.Kind, consumer.Name, err)
+	}
+	return nil
+}
+
+// credentialsExpireIn returns time left until the password of the Secret is older than maxAge.
+// Secrets without the rotation time are rotated immediately.
+func credentialsExpireIn(secret *corev1.Secret, now time.Time, maxAge time.Duration) time.Duration {
+	rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[etcdaenixiov1alpha1.CredentialsRotatedAtAnnotation])
+	if err != nil {
+		return 0
+	}
+	return rotatedAt.Add(maxAge).Sub(now)
+}
+
+func generatePassword() (string, error) {
+	b := make([]byte, passwordBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+var _ = Describe("EtcdCluster credentials", func() {
+	var (
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+		r       *EtcdClusterReconciler
+		user    etcdaenixiov1alpha1.ManagedUser
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Security: &etcdaenixiov1alpha1.SecuritySpec{Auth: &etcdaenixiov1alpha1.AuthSpec{
+					Rotation: &etcdaenixiov1alpha1.CredentialRotationSpec{MaxAge: metav1.Duration{Duration: 24 * time.Hour}},
+				}},
+			},
+		}
+		user = etcdaenixiov1alpha1.ManagedUser{Name: "app", SecretName: "test-app-credentials"}
+		r = &EtcdClusterReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+	})
+
+	It("should generate credentials and rotate them once they are too old", func(ctx SpecContext) {
+		now := time.Now()
+		secret, err := r.ensureCredentials(ctx, cluster, user, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Type).To(Equal(corev1.SecretTypeBasicAuth))
+		Expect(secret.Data).To(HaveKeyWithValue(corev1.BasicAuthUsernameKey, []byte("app")))
+		Expect(secret.Data[corev1.BasicAuthPasswordKey]).NotTo(BeEmpty())
+		Expect(secret.Annotations).To(HaveKeyWithValue(etcdaenixiov1alpha1.CredentialsAppliedAnnotation, "false"))
+		password := secret.Data[corev1.BasicAuthPasswordKey]
+
+		// not applied password is never replaced
+		later := now.Add(48 * time.Hour)
+		secret, err = r.ensureCredentials(ctx, cluster, user, later)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Data[corev1.BasicAuthPasswordKey]).To(Equal(password))
+
+		Expect(r.markCredentialsApplied(ctx, secret)).To(Succeed())
+		Expect(credentialsExpireIn(secret, now, 24*time.Hour)).To(BeNumerically(">", 23*time.Hour))
+		secret, err = r.ensureCredentials(ctx, cluster, user, later)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Data[corev1.BasicAuthPasswordKey]).NotTo(Equal(password))
+		Expect(secret.Data).To(HaveKeyWithValue(etcd.PreviousPasswordKey, password))
+
+		Expect(r.markCredentialsApplied(ctx, secret)).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+		Expect(secret.Data).NotTo(HaveKey(etcd.PreviousPasswordKey))
+	})
+
+	It("should restart consumers of rotated credentials", func(ctx SpecContext) {
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "app"}}
+		Expect(r.Create(ctx, deployment)).To(Succeed())
+		consumer := etcdaenixiov1alpha1.CredentialConsumer{Kind: "Deployment", Name: "app"}
+		Expect(r.restartConsumer(ctx, "ns", consumer, "2024-01-01T00:00:00Z")).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Annotations).To(
+			HaveKeyWithValue(etcdaenixiov1alpha1.CredentialsRotatedAtAnnotation, "2024-01-01T00:00:00Z"))
+
+		missing := etcdaenixiov1alpha1.CredentialConsumer{Kind: "DaemonSet", Name: "missing"}
+		Expect(r.restartConsumer(ctx, "ns", missing, "2024-01-01T00:00:00Z")).To(Succeed())
+	})
+})
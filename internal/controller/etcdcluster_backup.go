@@ -0,0 +1,688 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+const (
+	// backupCatalogInterval is how often snapshots available in the backup storage are listed in the cluster status.
+	backupCatalogInterval = 10 * time.Minute
+	// maxAvailableBackups is the maximum number of snapshots listed in the cluster status.
+	maxAvailableBackups = 50
+	// backupRetentionInterval is how often expired snapshots are deleted besides after every new snapshot.
+	backupRetentionInterval = time.Hour
+	// snapshotRetryBackoff is the delay of the first retry of a failed snapshot, it doubles with every failure.
+	snapshotRetryBackoff = 30 * time.Second
+)
+
+// newBackupStorage creates storage for the cluster backup destination using credentials from the secret keys
+// it references. Secrets are read on every call, so credentials rotated by external tools are picked up.
+func newBackupStorage(
+	ctx context.Context,
+	rclient client.Reader,
+	namespace string,
+	destination *etcdaenixiov1alpha1.BackupDestination,
+) (backup.Storage, error) {
+	credentials := map[string][]byte{}
+	secrets := map[string]*corev1.Secret{}
+	for name, ref := range backup.CredentialRefs(destination) {
+		secret, ok := secrets[ref.Name]
+		if !ok {
+			secret = &corev1.Secret{}
+			err := rclient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, secret)
+			if err != nil && !(errors.IsNotFound(err) && ptr.Deref(ref.Optional, false)) {
+				return nil, fmt.Errorf("cannot get backup credentials secret %s: %w", ref.Name, err)
+			}
+			secrets[ref.Name] = secret
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			if ptr.Deref(ref.Optional, false) {
+				continue
+			}
+			return nil, fmt.Errorf("backup credentials secret %s has no key %s", ref.Name, ref.Key)
+		}
+		credentials[name] = value
+	}
+	return backup.NewStorage(destination, credentials)
+}
+
+// applyDefaultBackupPolicy gives the default backup policy of the operator to the cluster without backups configured,
+// e.g. created before the policy is configured. Clusters created or updated since are given the policy by the webhook.
+// The policy is applied to the cluster in memory only, so the stored spec stays as applied and GitOps tools
+// don't see drift. Patching the cluster resets its spec to the stored one, so the policy is applied again after.
+func applyDefaultBackupPolicy(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) {
+	if cluster.ApplyDefaultBackupPolicy() {
+		log.FromContext(ctx).V(2).Info("cluster has no backups configured, applying the default backup policy")
+	}
+}
+
+// clusterSnapshot is a snapshot of the cluster uploaded to its backup destinations.
+type clusterSnapshot struct {
+	// key is the key of the snapshot in the backup destination of the cluster.
+	key string
+	// manifest is the manifest of the snapshot stored next to it.
+	manifest *backup.Manifest
+	// keys and errs are keys of the snapshot and errors of uploading it for every destination of the cluster,
+	// the backup destination first.
+	keys []string
+	errs []error
+}
+
+// err returns the error of uploading the snapshot to the backup destination of the cluster, which snapshots
+// are restored from.
+func (s *clusterSnapshot) err() error {
+	return s.errs[0]
+}
+
+// snapshotCluster streams a snapshot of the cluster taken at the time to all its backup destinations at once.
+// Snapshots taken for a Velero backup are stored under the key of the backup, others under the key generated from
+// the key template of the cluster. The manifest of the snapshot is stored next to it. The error is returned only
+// if the snapshot isn't uploaded to any destination, otherwise errors of destinations are kept in the snapshot.
+func snapshotCluster(
+	ctx context.Context,
+	rclient client.Reader,
+	recorder record.EventRecorder,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	takenAt time.Time,
+	veleroBackup string,
+) (*clusterSnapshot, error) {
+	cli, err := etcd.NewClusterClient(ctx, rclient, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	// the revision is read from any available member, so stopped members don't prevent backups
+	var status *clientv3.StatusResponse
+	err = etcd.OnAnyMember(ctx, cli, func(ctx context.Context, member etcd.Client) (err error) {
+		status, err = member.Status(ctx, member.Endpoints()[0])
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cluster revision: %w", err)
+	}
+	revision := status.Header.Revision
+	snapshot := &clusterSnapshot{key: backup.SnapshotKey(cluster, takenAt, revision)}
+	if veleroBackup != "" {
+		snapshot.key = backup.VeleroSnapshotKey(cluster, veleroBackup)
+	}
+
+	// destinations which can't be reached don't prevent uploads to the others
+	destinations := cluster.Spec.Backup.AllDestinations()
+	snapshot.errs = make([]error, len(destinations))
+	var targets []backup.Target
+	var uploaded []int
+	for i, destination := range destinations {
+		snapshot.keys = append(snapshot.keys, backup.DestinationKey(cluster, destination, snapshot.key))
+		warnInsecureDestination(ctx, recorder, cluster, destination)
+		storage, err := newBackupStorage(ctx, rclient, cluster.Namespace, destination)
+		if err != nil {
+			snapshot.errs[i] = err
+			continue
+		}
+		targets = append(targets, backup.Target{Storage: storage, Key: snapshot.keys[i]})
+		uploaded = append(uploaded, i)
+	}
+	if len(targets) > 0 {
+		snapshot.manifest = &backup.Manifest{
+			ClusterUID:  string(cluster.UID),
+			EtcdVersion: status.Version,
+			Revision:    revision,
+			RaftTerm:    status.RaftTerm,
+			TLSMode:     snapshotTLSMode(cluster),
+			TakenAt:     takenAt.UTC(),
+			Compression: cluster.Spec.Backup.Compression,
+		}
+		errs := backup.FanOutSnapshot(ctx, cli, targets, backup.SnapshotTags(cluster, takenAt, revision), snapshot.manifest)
+		for i, err := range errs {
+			snapshot.errs[uploaded[i]] = err
+		}
+	}
+	if !slices.Contains(snapshot.errs, nil) {
+		return nil, goerrors.Join(snapshot.errs...)
+	}
+	return snapshot, nil
+}
+
+// warnInsecureDestination reports the backup destination if the certificate of its endpoint is not verified,
+// so backup credentials and snapshots sent to it may be intercepted.
+func warnInsecureDestination(
+	ctx context.Context,
+	recorder record.EventRecorder,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	destination *etcdaenixiov1alpha1.BackupDestination,
+) {
+	if destination.S3 == nil || !destination.S3.InsecureSkipVerify {
+		return
+	}
+	url := backup.DestinationURL(destination)
+	log.FromContext(ctx).Info("certificate of backup destination is not verified, backup credentials may be intercepted",
+		"destination", url)
+	recorder.Eventf(cluster, corev1.EventTypeWarning, "InsecureBackupDestination",
+		"Certificate of backup destination %s is not verified, backup credentials and snapshots may be intercepted", url)
+}
+
+// setDestinationStatuses records the result of uploading the snapshot taken at the time to every backup destination
+// in the cluster status and reports destinations the snapshot couldn't be uploaded to.
+func (r *EtcdClusterReconciler) setDestinationStatuses(cluster *etcdaenixiov1alpha1.EtcdCluster, snapshot *clusterSnapshot, takenAt time.Time) {
+	destinations := cluster.Spec.Backup.AllDestinations()
+	previous := cluster.Status.Backup.Destinations
+	cluster.Status.Backup.Destinations = nil
+	for i, destination := range destinations {
+		url := backup.DestinationURL(destination)
+		if err := snapshot.errs[i]; err != nil {
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "SnapshotFailed", "Cannot upload snapshot to %s: %v", url, err)
+		}
+		if len(destinations) == 1 {
+			continue
+		}
+		status := etcdaenixiov1alpha1.BackupDestinationStatus{URL: url}
+		if j := slices.IndexFunc(previous, func(s etcdaenixiov1alpha1.BackupDestinationStatus) bool { return s.URL == url }); j >= 0 {
+			status = previous[j]
+		}
+		if err := snapshot.errs[i]; err != nil {
+			status.LastFailureTime = &metav1.Time{Time: takenAt}
+			status.LastFailure = err.Error()
+		} else {
+			status.LastSnapshotTime = &metav1.Time{Time: takenAt}
+			status.LastSnapshotKey = snapshot.keys[i]
+			status.LastFailureTime, status.LastFailure = nil, ""
+		}
+		cluster.Status.Backup.Destinations = append(cluster.Status.Backup.Destinations, status)
+	}
+}
+
+// snapshotTLSMode returns how the cluster serves clients, recorded in manifests of its snapshots.
+func snapshotTLSMode(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	switch {
+	case cluster.Spec.Security == nil || cluster.Spec.Security.TLS.ServerSecret == "":
+		return backup.TLSModeNone
+	case cluster.Spec.Security.TLS.ClientSecret != "":
+		return backup.TLSModeMutual
+	default:
+		return backup.TLSModeServer
+	}
+}
+
+// nextSnapshotIn returns time left until the next periodic snapshot is due. Failed snapshots are retried
+// with exponential backoff up to the backup interval.
+func nextSnapshotIn(cluster *etcdaenixiov1alpha1.EtcdCluster, now time.Time) time.Duration {
+	status := cluster.Status.Backup
+	interval := cluster.Spec.Backup.Interval.Duration
+	if status != nil && status.ConsecutiveFailures > 0 && status.LastFailureTime != nil {
+		backoff := interval
+		if status.ConsecutiveFailures <= 16 {
+			backoff = min(snapshotRetryBackoff<<(status.ConsecutiveFailures-1), interval)
+		}
+		return max(status.LastFailureTime.Add(backoff).Sub(now), 0)
+	}
+	if status == nil || status.LastSnapshotTime == nil {
+		return 0
+	}
+	return max(status.LastSnapshotTime.Add(interval).Sub(now), 0)
+}
+
+// reconcileBackup takes periodic snapshot of the ready cluster if it is due and returns time until the next one.
+func (r *EtcdClusterReconciler) reconcileBackup(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	clusterReady bool,
+) (time.Duration, error) {
+	if cluster.Spec.Backup == nil {
+		return 0, nil
+	}
+	interval := cluster.Spec.Backup.Interval.Duration
+	if cluster.Status.Backup == nil {
+		cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{}
+	}
+	if !clusterReady || cluster.Status.Backup.RestoringFrom != "" {
+		return interval, nil
+	}
+	now := time.Now()
+	if next := nextSnapshotIn(cluster, now); next > 0 {
+		return next, nil
+	}
+
+	snapshot, err := snapshotCluster(ctx, r.Client, r.Recorder, cluster, now, "")
+	if err != nil {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "SnapshotFailed", "Cannot take snapshot: %v", err)
+		cluster.Status.Backup.LastFailureTime = &metav1.Time{Time: now}
+		cluster.Status.Backup.ConsecutiveFailures++
+		return nextSnapshotIn(cluster, now), err
+	}
+	// the snapshot is uploaded to some destinations at least, so it is not retried until the next one
+	cluster.Status.Backup.ConsecutiveFailures = 0
+	r.setDestinationStatuses(cluster, snapshot, now)
+	key := snapshot.key
+	log.FromContext(ctx).Info("snapshot taken", "key", key)
+	cluster.Status.Backup.LastSnapshotTime = &metav1.Time{Time: now}
+	cluster.Status.Backup.LastSnapshotKey = key
+	if snapshot.err() != nil {
+		// verification and publishing work with the backup destination
+		return interval, nil
+	}
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "SnapshotTaken", "Took snapshot %s", key)
+
+	if cluster.Spec.Backup.Verify {
+		if err = factory.CreateSnapshotVerificationJob(ctx, cluster, r.Client, r.Scheme, key, now, false); err != nil {
+			// the snapshot is taken anyway, it is just left unverified
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "SnapshotVerificationFailed", "Cannot verify snapshot %s: %v", key, err)
+		}
+	}
+	if cluster.Spec.Backup.VolumeSnapshots != nil {
+		name, err := r.publishVolumeSnapshot(ctx, cluster, key, snapshot.manifest.Size, now)
+		if err != nil {
+			// the snapshot is taken anyway, so it is not retried until the next one
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "VolumeSnapshotFailed", "Cannot publish snapshot %s: %v", key, err)
+			return interval, nil
+		}
+		cluster.Status.Backup.LastVolumeSnapshot = name
+	}
+	return interval, nil
+}
+
+// setBackupCondition reports errors of backup steps of the last reconcile in the BackupFailing condition
+// and emits an event once they start failing.
+func (r *EtcdClusterReconciler) setBackupCondition(cluster *etcdaenixiov1alpha1.EtcdCluster, errs []error) {
+	if cluster.Spec.Backup == nil && len(errs) == 0 {
+		meta.RemoveStatusCondition(&cluster.Status.Conditions, etcdaenixiov1alpha1.EtcdConditionBackupFailing)
+		return
+	}
+	wasFailing := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionBackupFailing)
+	reason := etcdaenixiov1alpha1.EtcdCondTypeBackupSucceeded
+	message := string(etcdaenixiov1alpha1.EtcdBackupFailingCondNegMessage)
+	if len(errs) > 0 {
+		reason = etcdaenixiov1alpha1.EtcdCondTypeBackupFailed
+		messages := make([]string, 0, len(errs))
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		message = strings.Join(messages, "; ")
+		if wasFailing == nil || wasFailing.Status != metav1.ConditionTrue {
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, string(reason), "%s", message)
+		}
+	}
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionBackupFailing).
+		WithStatus(len(errs) > 0).
+		WithReason(string(reason)).
+		WithMessage(message).
+		Complete())
+}
+
+// reconcileScheduledVerification verifies the latest snapshot in the backup destination when the verification
+// schedule of the cluster is due and returns time until the next verification.
+func (r *EtcdClusterReconciler) reconcileScheduledVerification(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	if cluster.Spec.Backup == nil || cluster.Spec.Backup.VerificationSchedule == nil || cluster.Status.Backup == nil {
+		return 0, nil
+	}
+	interval := cluster.Spec.Backup.VerificationSchedule.Interval.Duration
+	status := cluster.Status.Backup
+	now := time.Now()
+	if status.LastScheduledVerificationTime != nil {
+		if next := status.LastScheduledVerificationTime.Add(interval).Sub(now); next > 0 {
+			return next, nil
+		}
+	}
+
+	storage, err := newBackupStorage(ctx, r.Client, cluster.Namespace, &cluster.Spec.Backup.Destination)
+	if err != nil {
+		return 0, err
+	}
+	key, err := backup.LatestSnapshot(ctx, storage, cluster)
+	if err != nil {
+		return 0, err
+	}
+	status.LastScheduledVerificationTime = &metav1.Time{Time: now}
+	if key == "" {
+		r.Recorder.Event(cluster, corev1.EventTypeWarning, "SnapshotVerificationFailed", "There is no snapshot to verify")
+		return interval, nil
+	}
+	if err = factory.CreateSnapshotVerificationJob(ctx, cluster, r.Client, r.Scheme, key, now, true); err != nil {
+		return 0, err
+	}
+	log.FromContext(ctx).Info("scheduled snapshot verification started", "key", key)
+	return interval, nil
+}
+
+// reconcileSnapshotVerification reports the result of the last finished snapshot verification Job
+// in the SnapshotVerified condition, records results of finished Jobs in the verification history
+// and deletes finished Jobs beyond history limits.
+func (r *EtcdClusterReconciler) reconcileSnapshotVerification(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	jobs, err := factory.ListJobs(ctx, cluster, r.Client, factory.SnapshotVerificationComponent)
+	if err != nil {
+		return err
+	}
+	reported := false
+	for i := range jobs {
+		finished, succeeded := factory.JobFinished(&jobs[i])
+		if !finished {
+			continue
+		}
+		if !reported {
+			setSnapshotVerifiedCondition(cluster, &jobs[i], succeeded)
+			reported = true
+		}
+		recordSnapshotVerification(cluster, &jobs[i], succeeded)
+	}
+	return factory.PruneJobs(ctx, cluster, r.Client, jobs)
+}
+
+// recordSnapshotVerification adds the result of the finished verification Job to the verification history,
+// unless it is recorded already. The history is kept newest first within its limit.
+func recordSnapshotVerification(cluster *etcdaenixiov1alpha1.EtcdCluster, job *batchv1.Job, succeeded bool) {
+	status := cluster.Status.Backup
+	if status == nil || slices.ContainsFunc(status.Verifications, func(v etcdaenixiov1alpha1.SnapshotVerification) bool {
+		return v.Job == job.Name
+	}) {
+		return
+	}
+	status.Verifications = append(status.Verifications, etcdaenixiov1alpha1.SnapshotVerification{
+		Snapshot:       job.Annotations[factory.SnapshotKeyAnnotation],
+		Job:            job.Name,
+		Scheduled:      job.Annotations[factory.ScheduledVerificationAnnotation] == "true",
+		CompletionTime: factory.JobFinishTime(job),
+		Succeeded:      succeeded,
+	})
+	slices.SortStableFunc(status.Verifications, func(a, b etcdaenixiov1alpha1.SnapshotVerification) int {
+		return b.CompletionTime.Compare(a.CompletionTime.Time)
+	})
+	limit := int32(etcdaenixiov1alpha1.DefaultVerificationHistoryLimit)
+	if backup := cluster.Spec.Backup; backup != nil && backup.VerificationSchedule != nil {
+		limit = ptr.Deref(backup.VerificationSchedule.HistoryLimit, limit)
+	}
+	status.Verifications = status.Verifications[:min(len(status.Verifications), int(limit))]
+}
+
+// reconcileBackupCatalog lists snapshots available in the backup storage in the cluster status.
+// Snapshots are listed periodically, after a new snapshot is taken and on demand with RefreshBackupsAnnotation.
+// It returns time until the next listing.
+func (r *EtcdClusterReconciler) reconcileBackupCatalog(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	if cluster.Spec.Backup == nil || cluster.Status.Backup == nil {
+		return 0, nil
+	}
+	status := cluster.Status.Backup
+	now := time.Now()
+	_, requested := cluster.Annotations[etcdaenixiov1alpha1.RefreshBackupsAnnotation]
+	if !requested && status.LastCatalogTime != nil && !status.LastCatalogTime.Before(status.LastSnapshotTime) {
+		if next := status.LastCatalogTime.Add(backupCatalogInterval).Sub(now); next > 0 {
+			return next, nil
+		}
+	}
+
+	storage, err := newBackupStorage(ctx, r.Client, cluster.Namespace, &cluster.Spec.Backup.Destination)
+	if err != nil {
+		return 0, err
+	}
+	snapshots, err := backup.ListSnapshots(ctx, storage, cluster)
+	if err != nil {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "BackupCatalogFailed", "Cannot list available snapshots: %v", err)
+		return 0, err
+	}
+	if requested {
+		// a copy is patched, as patching resets spec and status to the stored ones, losing the state
+		// computed by this reconcile
+		stored := cluster.DeepCopy()
+		patch := client.MergeFrom(stored.DeepCopy())
+		delete(stored.Annotations, etcdaenixiov1alpha1.RefreshBackupsAnnotation)
+		if err = r.Patch(ctx, stored, patch); err != nil {
+			return 0, fmt.Errorf("cannot remove %s annotation: %w", etcdaenixiov1alpha1.RefreshBackupsAnnotation, err)
+		}
+		cluster.ObjectMeta = stored.ObjectMeta
+	}
+	status.AvailableBackups = snapshots[:min(len(snapshots), maxAvailableBackups)]
+	status.LastCatalogTime = &metav1.Time{Time: now}
+	return backupCatalogInterval, nil
+}
+
+// reconcileBackupRetention deletes snapshots expired by the retention policy of the cluster from all its backup
+// destinations together with EtcdBackup objects of the cluster they were taken by. Expired snapshots are looked up
+// in the backup destination and deleted under the same keys elsewhere, failures to delete from additional
+// destinations are only reported. It runs periodically and after a new snapshot is taken and returns time until
+// the next run.
+func (r *EtcdClusterReconciler) reconcileBackupRetention(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	if cluster.Spec.Backup == nil || cluster.Spec.Backup.Retention == nil || cluster.Status.Backup == nil {
+		return 0, nil
+	}
+	status := cluster.Status.Backup
+	now := time.Now()
+	if status.LastRetentionTime != nil && !status.LastRetentionTime.Before(status.LastSnapshotTime) {
+		if next := status.LastRetentionTime.Add(backupRetentionInterval).Sub(now); next > 0 {
+			return next, nil
+		}
+	}
+
+	storage, err := newBackupStorage(ctx, r.Client, cluster.Namespace, &cluster.Spec.Backup.Destination)
+	if err != nil {
+		return 0, err
+	}
+	expired, err := backup.ExpiredSnapshots(ctx, storage, cluster, now)
+	if err != nil {
+		return 0, err
+	}
+	keys := make([]string, 0, len(expired))
+	for _, snapshot := range expired {
+		if err = backup.DeleteSnapshot(ctx, storage, snapshot.Key); err != nil {
+			return 0, err
+		}
+		keys = append(keys, snapshot.Key)
+	}
+	for _, destination := range cluster.Spec.Backup.AllDestinations()[1:] {
+		if err = deleteSnapshots(ctx, r.Client, cluster, destination, keys); err != nil {
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "SnapshotDeletionFailed",
+				"Cannot delete expired snapshots from %s: %v", backup.DestinationURL(destination), err)
+		}
+	}
+
+	backups := &etcdaenixiov1alpha1.EtcdBackupList{}
+	if err = r.List(ctx, backups, client.InNamespace(cluster.Namespace)); err != nil {
+		return 0, fmt.Errorf("cannot list backups: %w", err)
+	}
+	for i := range backups.Items {
+		etcdBackup := &backups.Items[i]
+		if etcdBackup.Spec.Cluster.Name != cluster.Name || !slices.Contains(keys, etcdBackup.Status.SnapshotKey) {
+			continue
+		}
+		if err = r.Delete(ctx, etcdBackup); client.IgnoreNotFound(err) != nil {
+			return 0, fmt.Errorf("cannot delete backup %s: %w", etcdBackup.Name, err)
+		}
+	}
+
+	status.LastRetentionTime = &metav1.Time{Time: now}
+	if len(keys) > 0 {
+		log.FromContext(ctx).Info("expired snapshots deleted", "keys", keys)
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "SnapshotsExpired", "Deleted %d expired snapshots", len(keys))
+		// list the remaining snapshots
+		status.LastCatalogTime = nil
+	}
+	return backupRetentionInterval, nil
+}
+
+// deleteSnapshots deletes snapshots stored under the keys in the backup destination of the cluster
+// from another destination.
+func deleteSnapshots(
+	ctx context.Context,
+	rclient client.Reader,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	destination *etcdaenixiov1alpha1.BackupDestination,
+	keys []string,
+) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	storage, err := newBackupStorage(ctx, rclient, cluster.Namespace, destination)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = backup.DeleteSnapshot(ctx, storage, backup.DestinationKey(cluster, destination, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setSnapshotVerifiedCondition sets the SnapshotVerified condition from the result of the verification Job.
+func setSnapshotVerifiedCondition(cluster *etcdaenixiov1alpha1.EtcdCluster, job *batchv1.Job, succeeded bool) {
+	key := job.Annotations[factory.SnapshotKeyAnnotation]
+	reason := etcdaenixiov1alpha1.EtcdCondTypeSnapshotVerified
+	message := fmt.Sprintf("Snapshot %s is restored successfully", key)
+	if !succeeded {
+		reason = etcdaenixiov1alpha1.EtcdCondTypeSnapshotVerifyFailed
+		message = fmt.Sprintf("Snapshot %s cannot be restored, see logs of job %s", key, job.Name)
+	}
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionSnapshotVerified).
+		WithStatus(succeeded).
+		WithReason(string(reason)).
+		WithMessage(message).
+		Complete())
+}
+
+// reconcileAutoRestore watches the cluster quorum and restores the cluster from the latest snapshot once the quorum
+// is lost for longer than the configured timeout. Restore is done by recreating all member pods: emptyDir data
+// directories are wiped and the restore init container fills them from the snapshot set in the cluster state ConfigMap.
+// It returns time after which the quorum has to be checked again.
+func (r *EtcdClusterReconciler) reconcileAutoRestore(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	if cluster.Spec.Backup == nil || cluster.Spec.Backup.AutoRestore == nil {
+		return 0, nil
+	}
+	readyCond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionReady)
+	if readyCond == nil || readyCond.Reason == string(etcdaenixiov1alpha1.EtcdCondTypeWaitingForFirstQuorum) {
+		// the cluster never had quorum, there is nothing to restore
+		return 0, nil
+	}
+	if cluster.Status.Backup == nil {
+		cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{}
+	}
+	timeout := quorumLossTimeout(cluster)
+
+	healthy, err := etcd.HealthyMembers(ctx, r.Client, cluster)
+	if err != nil {
+		return 0, err
+	}
+	quorumLost := healthy < cluster.CalculateQuorumSize()
+
+	if cluster.Status.Backup.RestoringFrom != "" {
+		if quorumLost {
+			// renew the lock while the restore is in progress
+			_, err = r.acquireOperationLock(ctx, cluster, factory.OperationRestore)
+			return timeout, err
+		}
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "Restored",
+			"Cluster is restored from snapshot %s", cluster.Status.Backup.RestoringFrom)
+		cluster.Status.Backup.RestoringFrom = ""
+		setQuorumLostCondition(cluster, false, etcdaenixiov1alpha1.EtcdCondTypeQuorumAvailable,
+			etcdaenixiov1alpha1.EtcdQuorumLostCondNegMessage)
+		if err = factory.ReleaseOperationLock(ctx, cluster, r.Client, factory.OperationRestore); err != nil {
+			return 0, err
+		}
+		// clear the snapshot, so recreated members don't restore it again
+		return 0, factory.CreateOrUpdateClusterStateConfigMap(ctx, cluster, r.Client, r.Scheme)
+	}
+
+	if !quorumLost {
+		setQuorumLostCondition(cluster, false, etcdaenixiov1alpha1.EtcdCondTypeQuorumAvailable,
+			etcdaenixiov1alpha1.EtcdQuorumLostCondNegMessage)
+		return 0, nil
+	}
+	setQuorumLostCondition(cluster, true, etcdaenixiov1alpha1.EtcdCondTypeQuorumLost,
+		etcdaenixiov1alpha1.EtcdQuorumLostCondPosMessage)
+	lostFor := time.Since(factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionQuorumLost).LastTransitionTime.Time)
+	if lostFor < timeout {
+		return timeout - lostFor, nil
+	}
+
+	storage, err := newBackupStorage(ctx, r.Client, cluster.Namespace, &cluster.Spec.Backup.Destination)
+	if err != nil {
+		return 0, err
+	}
+	key, err := backup.LatestSnapshot(ctx, storage, cluster)
+	if err != nil {
+		return 0, err
+	}
+	if key == "" {
+		r.Recorder.Event(cluster, corev1.EventTypeWarning, "RestoreFailed", "Quorum is lost and there is no snapshot to restore from")
+		return timeout, nil
+	}
+	incompatibility, err := snapshotIncompatibility(ctx, storage, cluster, key)
+	if err != nil {
+		return 0, err
+	}
+	if incompatibility != "" {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "RestoreFailed", "Quorum is lost, but %s", incompatibility)
+		return timeout, nil
+	}
+
+	if acquired, err := r.acquireOperationLock(ctx, cluster, factory.OperationRestore); !acquired {
+		return rolloutCheckInterval, err
+	}
+	log.FromContext(ctx).Info("quorum is lost, restoring cluster", "snapshot", key)
+	cluster.Status.Backup.RestoringFrom = key
+	if err = factory.CreateOrUpdateClusterStateConfigMap(ctx, cluster, r.Client, r.Scheme); err != nil {
+		return 0, err
+	}
+	for _, name := range cluster.MemberNames() {
+		pod := &corev1.Pod{}
+		pod.Namespace, pod.Name = cluster.Namespace, name
+		if err = r.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+			return 0, fmt.Errorf("cannot delete member pod %s: %w", name, err)
+		}
+	}
+	setQuorumLostCondition(cluster, true, etcdaenixiov1alpha1.EtcdCondTypeRestoringFromSnapshot,
+		etcdaenixiov1alpha1.EtcdQuorumLostCondRestoreMessage)
+	r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "RestoreStarted",
+		"Quorum is lost for %s, restoring cluster from snapshot %s", lostFor.Round(time.Second), key)
+	return timeout, nil
+}
+
+func setQuorumLostCondition(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	status bool,
+	reason etcdaenixiov1alpha1.EtcdCondType,
+	message etcdaenixiov1alpha1.EtcdCondMessage,
+) {
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionQuorumLost).
+		WithStatus(status).
+		WithReason(string(reason)).
+		WithMessage(string(message)).
+		Complete())
+}
@@ -0,0 +1,470 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/pkg/backupstorage"
+)
+
+// memoryStorage keeps objects in memory.
+type memoryStorage map[string][]byte
+
+func (m memoryStorage) Upload(_ context.Context, key string, r io.Reader, _ map[string]string) error {
+	data, err := io.ReadAll(r)
+	m[key] = data
+	return err
+}
+
+func (m memoryStorage) Download(_ context.Context, key string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(m[key])), nil
+}
+
+func (m memoryStorage) List(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (m memoryStorage) Delete(_ context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+var _ = Describe("EtcdCluster backups", func() {
+	Context("When scheduling periodic snapshots", func() {
+		now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+		cluster := func(last *time.Time) *etcdaenixiov1alpha1.EtcdCluster {
+			c := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{Interval: metav1.Duration{Duration: 10 * time.Minute}},
+				},
+			}
+			if last != nil {
+				c.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{LastSnapshotTime: &metav1.Time{Time: *last}}
+			}
+			return c
+		}
+
+		It("should take the first snapshot immediately", func() {
+			Expect(nextSnapshotIn(cluster(nil), now)).To(BeZero())
+		})
+
+		It("should wait for the interval after the last snapshot", func() {
+			last := now.Add(-4 * time.Minute)
+			Expect(nextSnapshotIn(cluster(&last), now)).To(Equal(6 * time.Minute))
+		})
+
+		It("should take overdue snapshot immediately", func() {
+			last := now.Add(-time.Hour)
+			Expect(nextSnapshotIn(cluster(&last), now)).To(BeZero())
+		})
+
+		It("should retry failed snapshots with backoff up to the interval", func() {
+			last := now.Add(-time.Hour)
+			c := cluster(&last)
+			c.Status.Backup.LastFailureTime = &metav1.Time{Time: now.Add(-10 * time.Second)}
+			c.Status.Backup.ConsecutiveFailures = 1
+			Expect(nextSnapshotIn(c, now)).To(Equal(20 * time.Second))
+			c.Status.Backup.ConsecutiveFailures = 3
+			Expect(nextSnapshotIn(c, now)).To(Equal(110 * time.Second))
+			c.Status.Backup.ConsecutiveFailures = 40
+			Expect(nextSnapshotIn(c, now)).To(Equal(10*time.Minute - 10*time.Second))
+		})
+	})
+
+	Context("When calculating requeue interval", func() {
+		It("should pick the smallest positive duration", func() {
+			Expect(minPositive(0, 5*time.Minute, time.Minute)).To(Equal(time.Minute))
+			Expect(minPositive(0, 0)).To(BeZero())
+		})
+	})
+
+	Context("When publishing volume snapshots", func() {
+		takenAt := time.Date(2024, 4, 1, 12, 30, 0, 0, time.UTC)
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+					Destination: etcdaenixiov1alpha1.BackupDestination{
+						S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups"},
+					},
+					VolumeSnapshots: &etcdaenixiov1alpha1.VolumeSnapshotPublishing{ClassName: "etcd-operator"},
+				},
+			},
+		}
+
+		It("should bind ready content to the snapshot", func(ctx SpecContext) {
+			content := &unstructured.Unstructured{}
+			content.SetGroupVersionKind(volumeSnapshotContentGVK)
+			r := &EtcdClusterReconciler{
+				Client:   fake.NewClientBuilder().WithStatusSubresource(content).Build(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+
+			name, err := r.publishVolumeSnapshot(ctx, cluster, "ns/test/20240401T123000Z.db", 1024, takenAt)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("test-20240401t123000z"))
+
+			Expect(r.Get(ctx, client.ObjectKey{Name: "etcd-0b1c-20240401t123000z"}, content)).To(Succeed())
+			Expect(content.Object).To(HaveKeyWithValue("spec", SatisfyAll(
+				HaveKeyWithValue("source", HaveKeyWithValue("snapshotHandle", "s3://backups/ns/test/20240401T123000Z.db")),
+				HaveKeyWithValue("volumeSnapshotRef", HaveKeyWithValue("name", name)),
+			)))
+			Expect(content.Object).To(HaveKeyWithValue("status", SatisfyAll(
+				HaveKeyWithValue("readyToUse", true),
+				HaveKeyWithValue("restoreSize", BeNumerically("==", 1024)),
+			)))
+
+			snapshot := &unstructured.Unstructured{}
+			snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+			Expect(r.Get(ctx, client.ObjectKey{Namespace: "ns", Name: name}, snapshot)).To(Succeed())
+			Expect(snapshot.Object).To(HaveKeyWithValue("spec",
+				HaveKeyWithValue("source", HaveKeyWithValue("volumeSnapshotContentName", "etcd-0b1c-20240401t123000z"))))
+		})
+	})
+
+	Context("When uploading snapshots to additional destinations", func() {
+		It("should track uploads to every destination independently", func() {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+						Destination: etcdaenixiov1alpha1.BackupDestination{
+							S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups"},
+						},
+						AdditionalDestinations: []etcdaenixiov1alpha1.BackupDestination{
+							{S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "offsite", Prefix: "dr"}},
+						},
+					},
+				},
+				Status: etcdaenixiov1alpha1.EtcdClusterStatus{Backup: &etcdaenixiov1alpha1.ClusterBackupStatus{}},
+			}
+			recorder := record.NewFakeRecorder(10)
+			r := &EtcdClusterReconciler{Recorder: recorder}
+			first := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+			r.setDestinationStatuses(cluster, &clusterSnapshot{
+				keys: []string{"ns/test/1.db", "dr/ns/test/1.db"},
+				errs: []error{nil, nil},
+			}, first)
+			second := first.Add(time.Hour)
+			r.setDestinationStatuses(cluster, &clusterSnapshot{
+				keys: []string{"ns/test/2.db", "dr/ns/test/2.db"},
+				errs: []error{errors.New("connection refused"), nil},
+			}, second)
+
+			Expect(cluster.Status.Backup.Destinations).To(Equal([]etcdaenixiov1alpha1.BackupDestinationStatus{
+				{
+					URL:              "s3://backups",
+					LastSnapshotTime: &metav1.Time{Time: first},
+					LastSnapshotKey:  "ns/test/1.db",
+					LastFailureTime:  &metav1.Time{Time: second},
+					LastFailure:      "connection refused",
+				},
+				{URL: "s3://offsite/dr", LastSnapshotTime: &metav1.Time{Time: second}, LastSnapshotKey: "dr/ns/test/2.db"},
+			}))
+			Expect(recorder.Events).To(Receive(ContainSubstring("Cannot upload snapshot to s3://backups: connection refused")))
+		})
+
+		It("should report failing backup steps once in an event", func() {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{}},
+			}
+			recorder := record.NewFakeRecorder(10)
+			r := &EtcdClusterReconciler{Recorder: recorder}
+			errs := []error{errors.New("cannot take snapshot: access denied")}
+			r.setBackupCondition(cluster, errs)
+			r.setBackupCondition(cluster, errs)
+
+			cond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionBackupFailing)
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Message).To(Equal("cannot take snapshot: access denied"))
+			Expect(recorder.Events).To(HaveLen(1))
+
+			r.setBackupCondition(cluster, nil)
+			cond = factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionBackupFailing)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		})
+	})
+
+	Context("When verifying snapshots", func() {
+		job := func(name string, created time.Time, condition batchv1.JobConditionType) *batchv1.Job {
+			return &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:         "ns",
+					Name:              name,
+					CreationTimestamp: metav1.NewTime(created),
+					Labels: factory.NewLabelsBuilder().WithInstance("test").WithManagedBy().
+						WithComponent(factory.SnapshotVerificationComponent),
+					Annotations: map[string]string{factory.SnapshotKeyAnnotation: name + ".db"},
+				},
+				Status: batchv1.JobStatus{
+					Conditions: []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue}},
+				},
+			}
+		}
+
+		It("should report the result of the last finished job", func(ctx SpecContext) {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"}}
+			now := time.Now().Truncate(time.Second)
+			running := job("test-verify-3", now, "")
+			running.Status.Conditions = nil
+			r := &EtcdClusterReconciler{
+				Client: fake.NewClientBuilder().WithObjects(
+					job("test-verify-1", now.Add(-2*time.Hour), batchv1.JobComplete),
+					job("test-verify-2", now.Add(-time.Hour), batchv1.JobFailed),
+					running,
+				).Build(),
+			}
+			Expect(r.reconcileSnapshotVerification(ctx, cluster)).To(Succeed())
+			condition := meta.FindStatusCondition(cluster.Status.Conditions, etcdaenixiov1alpha1.EtcdConditionSnapshotVerified)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(string(etcdaenixiov1alpha1.EtcdCondTypeSnapshotVerifyFailed)))
+			Expect(condition.Message).To(ContainSubstring("test-verify-2.db"))
+		})
+
+		It("should keep the history of verifications within its limit", func(ctx SpecContext) {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+						VerificationSchedule: &etcdaenixiov1alpha1.VerificationSchedule{HistoryLimit: ptr.To(int32(2))},
+					},
+				},
+				Status: etcdaenixiov1alpha1.EtcdClusterStatus{Backup: &etcdaenixiov1alpha1.ClusterBackupStatus{}},
+			}
+			now := time.Now().Truncate(time.Second)
+			scheduled := job("test-verify-3", now.Add(-time.Hour), batchv1.JobComplete)
+			scheduled.Annotations[factory.ScheduledVerificationAnnotation] = "true"
+			scheduled.Status.CompletionTime = &metav1.Time{Time: now}
+			failed := job("test-verify-2", now.Add(-2*time.Hour), batchv1.JobFailed)
+			failed.Status.Conditions[0].LastTransitionTime = metav1.NewTime(now.Add(-time.Hour))
+			r := &EtcdClusterReconciler{
+				Client: fake.NewClientBuilder().WithObjects(
+					job("test-verify-1", now.Add(-3*time.Hour), batchv1.JobComplete),
+					failed,
+					scheduled,
+				).Build(),
+			}
+			Expect(r.reconcileSnapshotVerification(ctx, cluster)).To(Succeed())
+			Expect(r.reconcileSnapshotVerification(ctx, cluster)).To(Succeed())
+			Expect(cluster.Status.Backup.Verifications).To(HaveExactElements(
+				etcdaenixiov1alpha1.SnapshotVerification{
+					Snapshot:       "test-verify-3.db",
+					Job:            "test-verify-3",
+					Scheduled:      true,
+					CompletionTime: metav1.Time{Time: now},
+					Succeeded:      true,
+				},
+				HaveField("Job", "test-verify-2"),
+			))
+		})
+	})
+
+	Context("When uploading snapshots", func() {
+		It("should warn about destinations with certificates not verified", func(ctx SpecContext) {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+						Destination: etcdaenixiov1alpha1.BackupDestination{
+							S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups"},
+						},
+						AdditionalDestinations: []etcdaenixiov1alpha1.BackupDestination{{
+							S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "offsite", Endpoint: "https://minio.example.com",
+								InsecureSkipVerify: true},
+						}},
+					},
+				},
+			}
+			recorder := record.NewFakeRecorder(10)
+			for _, destination := range cluster.Spec.Backup.AllDestinations() {
+				warnInsecureDestination(ctx, recorder, cluster, destination)
+			}
+			Expect(recorder.Events).To(HaveLen(1))
+			Expect(<-recorder.Events).To(And(
+				HavePrefix("Warning InsecureBackupDestination"),
+				ContainSubstring("offsite"),
+			))
+		})
+	})
+
+	Context("When listing available snapshots", func() {
+		It("should list snapshots again only when due or after a new snapshot", func(ctx SpecContext) {
+			now := time.Now()
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+						Destination: etcdaenixiov1alpha1.BackupDestination{
+							S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups", CredentialsSecret: "s3"},
+						},
+					},
+				},
+				Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupStatus{
+						LastSnapshotTime: &metav1.Time{Time: now.Add(-time.Hour)},
+						LastCatalogTime:  &metav1.Time{Time: now.Add(-time.Minute)},
+					},
+				},
+			}
+			r := &EtcdClusterReconciler{Client: fake.NewClientBuilder().Build()}
+			next, err := r.reconcileBackupCatalog(ctx, cluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(next).To(BeNumerically("~", backupCatalogInterval-time.Minute, time.Second))
+
+			cluster.Status.Backup.LastSnapshotTime = &metav1.Time{Time: now}
+			_, err = r.reconcileBackupCatalog(ctx, cluster)
+			Expect(err).To(MatchError(ContainSubstring("cannot get backup credentials secret s3")))
+		})
+
+		It("should keep the state of the reconcile when listing snapshots on demand", func(ctx SpecContext) {
+			backupstorage.Register("catalog-test", backupstorage.Provider{
+				New: func(backupstorage.Options) (backupstorage.Storage, error) {
+					return memoryStorage{}, nil
+				},
+			})
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", Annotations: map[string]string{
+					etcdaenixiov1alpha1.RefreshBackupsAnnotation: "",
+				}},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+						Destination: etcdaenixiov1alpha1.BackupDestination{
+							Provider: &etcdaenixiov1alpha1.ProviderDestination{Name: "catalog-test"},
+						},
+					},
+				},
+			}
+			scheme := runtime.NewScheme()
+			Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+			r := &EtcdClusterReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).Build()}
+			cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{}
+			factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionReady).
+				WithStatus(true).WithReason(string(etcdaenixiov1alpha1.EtcdCondTypeStatefulSetReady)).Complete())
+
+			next, err := r.reconcileBackupCatalog(ctx, cluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(next).To(Equal(backupCatalogInterval))
+			Expect(cluster.Annotations).NotTo(HaveKey(etcdaenixiov1alpha1.RefreshBackupsAnnotation))
+			Expect(cluster.Status.Backup.LastCatalogTime).NotTo(BeNil())
+			Expect(factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionReady)).NotTo(BeNil())
+			stored := &etcdaenixiov1alpha1.EtcdCluster{}
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(cluster), stored)).To(Succeed())
+			Expect(stored.Annotations).NotTo(HaveKey(etcdaenixiov1alpha1.RefreshBackupsAnnotation))
+		})
+	})
+
+	Context("When deleting expired snapshots", func() {
+		It("should delete expired snapshots from all destinations together with their backups", func(ctx SpecContext) {
+			buckets := map[string]memoryStorage{"primary": {}, "offsite": {}}
+			backupstorage.Register("retention-test", backupstorage.Provider{
+				New: func(o backupstorage.Options) (backupstorage.Storage, error) {
+					return buckets[o.Config["bucket"]], nil
+				},
+			})
+			destination := func(bucket string) etcdaenixiov1alpha1.BackupDestination {
+				return etcdaenixiov1alpha1.BackupDestination{Provider: &etcdaenixiov1alpha1.ProviderDestination{
+					Name: "retention-test", Config: map[string]string{"bucket": bucket},
+				}}
+			}
+			now := time.Now()
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+						Destination:            destination("primary"),
+						AdditionalDestinations: []etcdaenixiov1alpha1.BackupDestination{destination("offsite")},
+						Retention:              &etcdaenixiov1alpha1.BackupRetention{KeepLast: ptr.To(int32(2))},
+					},
+				},
+				Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupStatus{
+						LastSnapshotTime: &metav1.Time{Time: now},
+						LastCatalogTime:  &metav1.Time{Time: now},
+					},
+				},
+			}
+			var keys []string
+			for i := range 4 {
+				key := backup.SnapshotKey(cluster, now.Add(-time.Duration(i)*time.Hour), 0)
+				keys = append(keys, key)
+				for _, bucket := range buckets {
+					bucket[key] = nil
+					bucket[backup.ManifestKey(key)] = nil
+				}
+			}
+			expiredBackup := &etcdaenixiov1alpha1.EtcdBackup{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "expired"},
+				Spec:       etcdaenixiov1alpha1.EtcdBackupSpec{Cluster: corev1.LocalObjectReference{Name: "test"}},
+				Status:     etcdaenixiov1alpha1.EtcdBackupStatus{SnapshotKey: keys[3]},
+			}
+			keptBackup := &etcdaenixiov1alpha1.EtcdBackup{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "kept"},
+				Spec:       etcdaenixiov1alpha1.EtcdBackupSpec{Cluster: corev1.LocalObjectReference{Name: "test"}},
+				Status:     etcdaenixiov1alpha1.EtcdBackupStatus{SnapshotKey: keys[0]},
+			}
+			c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).WithObjects(expiredBackup, keptBackup).Build()
+			r := &EtcdClusterReconciler{Client: c, Recorder: record.NewFakeRecorder(10)}
+
+			next, err := r.reconcileBackupRetention(ctx, cluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(next).To(Equal(backupRetentionInterval))
+			for _, bucket := range buckets {
+				Expect(bucket).To(HaveLen(4))
+				Expect(bucket).To(HaveKey(keys[0]))
+				Expect(bucket).To(HaveKey(keys[1]))
+			}
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(expiredBackup), expiredBackup)).NotTo(Succeed())
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(keptBackup), keptBackup)).To(Succeed())
+			Expect(cluster.Status.Backup.LastRetentionTime).NotTo(BeNil())
+			Expect(cluster.Status.Backup.LastCatalogTime).To(BeNil())
+
+			next, err = r.reconcileBackupRetention(ctx, cluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(next).To(BeNumerically("~", backupRetentionInterval, time.Second))
+		})
+	})
+})
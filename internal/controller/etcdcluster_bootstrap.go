@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// bootstrapCheckInterval is how often a cluster bootstrapped from a snapshot is checked for quorum.
+const bootstrapCheckInterval = 10 * time.Second
+
+// bootstrapSnapshot returns the key of the snapshot the new cluster is requested to be bootstrapped from with
+// BootstrapFromAnnotation, or empty string if the cluster is bootstrapped already, failed to be or was never
+// requested to be.
+func bootstrapSnapshot(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	key := cluster.Annotations[etcdaenixiov1alpha1.BootstrapFromAnnotation]
+	if key == "" || cluster.Spec.Backup == nil {
+		return ""
+	}
+	if status := cluster.Status.Backup; status != nil && (status.BootstrappedFrom != "" || status.BootstrapFailure != "") {
+		return ""
+	}
+	return key
+}
+
+// reconcileBootstrap restores data directories of members of the new cluster from the snapshot set with
+// BootstrapFromAnnotation. The snapshot is set in the cluster state ConfigMap before members are created,
+// so the restore container of every member restores it before etcd starts, the same way members restore
+// their data once quorum is lost. Once the restored members form a quorum, the snapshot is cleared, so members
+// recreated later join the cluster empty. It returns time after which the bootstrap has to be checked again
+// or zero if there is nothing to bootstrap.
+func (r *EtcdClusterReconciler) reconcileBootstrap(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	key := bootstrapSnapshot(cluster)
+	if key == "" {
+		return 0, nil
+	}
+	if cluster.Status.Backup == nil {
+		cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{}
+	}
+
+	if cluster.Status.Backup.RestoringFrom == key {
+		healthy, err := etcd.HealthyMembers(ctx, r.Client, cluster)
+		if err != nil {
+			return 0, err
+		}
+		if healthy < cluster.CalculateQuorumSize() {
+			return bootstrapCheckInterval, nil
+		}
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "Restored", "Cluster is bootstrapped from snapshot %s", key)
+		cluster.Status.Backup.RestoringFrom = ""
+		cluster.Status.Backup.BootstrappedFrom = key
+		// the cluster state ConfigMap is updated with the snapshot cleared along with other cluster objects
+		return 0, nil
+	}
+	if initialized := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionInitialized); initialized != nil &&
+		initialized.Status == metav1.ConditionTrue {
+		// members are created already, so they would not restore the snapshot
+		cluster.Status.Backup.BootstrapFailure = fmt.Sprintf("cluster is created already, it cannot be bootstrapped from snapshot %s", key)
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "RestoreFailed",
+			"Cluster is created already, it cannot be bootstrapped from snapshot %s", key)
+		return 0, nil
+	}
+
+	// rollouts and other operations disrupting members wait for the restore to finish
+	log.FromContext(ctx).Info("bootstrapping cluster from snapshot", "snapshot", key)
+	cluster.Status.Backup.RestoringFrom = key
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "RestoreStarted", "Bootstrapping cluster from snapshot %s", key)
+	return bootstrapCheckInterval, nil
+}
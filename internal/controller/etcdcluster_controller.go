@@ -20,16 +20,25 @@ import (
 	"context"
 	goerrors "errors"
 	"fmt"
+	"sync"
+	"time"
 
 	policyv1 "k8s.io/api/policy/v1"
 
 	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -37,21 +46,56 @@ import (
 
 	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
 	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
 )
 
 // EtcdClusterReconciler reconciles a EtcdCluster object
 type EtcdClusterReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// InPlaceResize enables applying etcd container resources changes by resizing member pods without restart.
+	InPlaceResize bool
+	// Namespaced disables access to cluster-scoped resources when the operator is granted permissions in its
+	// namespace only. Nodes, persistent volumes and storage classes are not observed then, so member node drains,
+	// lost pinned nodes and storage class binding modes are not detected.
+	Namespaced bool
+
+	// peerMetrics holds the last peerMetricsSample of every cluster keyed by its namespaced name.
+	peerMetrics sync.Map
+	// performanceMetrics holds the last performanceSample of every cluster keyed by its namespaced name.
+	performanceMetrics sync.Map
+	// versionChecks holds the time etcd versions of members of every cluster were last checked at keyed by
+	// its namespaced name.
+	versionChecks sync.Map
+	// fair limits the rate of reconciliations of every cluster, it is set up with the controller.
+	fair *fairReconciler
 }
 
 // +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdclusters/finalizers,verbs=update
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdbackups,verbs=get;list;watch;delete
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;watch;delete;patch
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;create;delete;update;patch;list;watch
 // +kubebuilder:rbac:groups="apps",resources=statefulsets,verbs=get;create;delete;update;patch;list;watch
+// +kubebuilder:rbac:groups="discovery.k8s.io",resources=endpointslices,verbs=get;list;watch;create;update;delete
 // +kubebuilder:rbac:groups="policy",resources=poddisruptionbudgets,verbs=get;create;delete;update;patch;list;watch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;delete;patch;update
+// +kubebuilder:rbac:groups="",resources=pods/resize,verbs=patch
+// +kubebuilder:rbac:groups="",resources=pods/status,verbs=patch
+// +kubebuilder:rbac:groups="apps",resources=controllerrevisions,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups="",resources=persistentvolumes,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups="storage.k8s.io",resources=storageclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="apps",resources=deployments;daemonsets,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups="batch",resources=jobs,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups="coordination.k8s.io",resources=leases,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="route.openshift.io",resources=routes,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="route.openshift.io",resources=routes/custom-host,verbs=create;update
 
 // Reconcile checks CR and current cluster state and performs actions to transform current state to desired.
 func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -62,6 +106,7 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			logger.V(2).Info("object not found", "namespaced_name", req.NamespacedName)
+			r.forgetCluster(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		// Error retrieving object, requeue
@@ -69,9 +114,35 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 	// If object is being deleted, skipping reconciliation
 	if !instance.DeletionTimestamp.IsZero() {
+		r.forgetCluster(req.NamespacedName)
 		return reconcile.Result{}, nil
 	}
 
+	applyDefaultBackupPolicy(ctx, instance)
+
+	// status changes are written relative to the observed status, so changes of other writers are kept
+	original := instance.DeepCopy()
+
+	// replace member if requested, before status is modified
+	if err = r.replaceMember(ctx, instance); err != nil {
+		logger.Error(err, "cannot replace member")
+		return r.updateStatusOnErr(ctx, original, instance, err)
+	}
+
+	// restore the cluster from a snapshot if requested, before status is modified
+	restoreRequestIn, err := r.reconcileRestoreRequest(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot restore cluster")
+		return r.updateStatusOnErr(ctx, original, instance, err)
+	}
+
+	// restore data of the new cluster from a snapshot, before members are created
+	bootstrapIn, err := r.reconcileBootstrap(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot bootstrap cluster from snapshot")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot bootstrap cluster from snapshot: %w", err))
+	}
+
 	// fill conditions
 	if len(instance.Status.Conditions) == 0 {
 		factory.FillConditions(instance)
@@ -80,10 +151,58 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// ensure managed resources
 	if err := r.ensureClusterObjects(ctx, instance); err != nil {
 		logger.Error(err, "cannot create Cluster auxiliary objects")
-		return r.updateStatusOnErr(ctx, instance, fmt.Errorf("cannot create Cluster auxiliary objects: %w", err))
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot create Cluster auxiliary objects: %w", err))
+	}
+	scaleCheckIn, err := r.reconcileScale(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot check scaling")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot check scaling: %w", err))
+	}
+
+	if err := r.checkStorageClassBindingMode(ctx, instance); err != nil {
+		logger.Error(err, "cannot check storage class")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot check storage class: %w", err))
+	}
+
+	// observe members placement
+	if err := r.updateMembersStatus(ctx, instance); err != nil {
+		logger.Error(err, "cannot update members status")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot update members status: %w", err))
+	}
+
+	// exclude learners and unhealthy members from the client Service
+	servingCheckIn, err := r.reconcileServing(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot update serving members")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot update serving members: %w", err))
+	}
+
+	// publish serving members when endpoints are managed by the operator
+	endpointsCheckIn, err := r.reconcileEndpoints(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot update endpoints")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot update endpoints: %w", err))
+	}
+
+	// restore data of the cluster restored by Velero, before the restored members form a cluster
+	veleroRestoreCheckIn, err := r.reconcileVeleroRestore(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot restore cluster from Velero backup")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot restore cluster from Velero backup: %w", err))
+	}
+
+	// report progress of members restoring data from a snapshot
+	restoreProgressIn, err := r.reconcileRestoreProgress(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot check restore progress")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot check restore progress: %w", err))
 	}
 
 	// set cluster initialization condition
+	if initialized := factory.GetCondition(instance, etcdaenixiov1alpha1.EtcdConditionInitialized); initialized == nil ||
+		initialized.Status != metav1.ConditionTrue {
+		r.Recorder.Event(instance, corev1.EventTypeNormal, "Created", "Created members and auxiliary objects of the cluster")
+	}
 	factory.SetCondition(instance, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionInitialized).
 		WithStatus(true).
 		WithReason(string(etcdaenixiov1alpha1.EtcdCondTypeInitComplete)).
@@ -94,7 +213,7 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	clusterReady, err := r.isStatefulSetReady(ctx, instance)
 	if err != nil {
 		logger.Error(err, "failed to check etcd cluster state")
-		return r.updateStatusOnErr(ctx, instance, fmt.Errorf("cannot check Cluster readiness: %w", err))
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot check Cluster readiness: %w", err))
 	}
 
 	// set cluster readiness condition
@@ -102,11 +221,21 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	if existingCondition.Reason == string(etcdaenixiov1alpha1.EtcdCondTypeWaitingForFirstQuorum) && !clusterReady {
 		// if we are still "waiting for first quorum establishment" and the StatefulSet
 		// isn't ready yet, don't update the EtcdConditionReady, but circuit-break.
-		return r.updateStatus(ctx, instance)
+		if _, err = r.reconcileTrafficGate(ctx, instance); err != nil {
+			logger.Error(err, "cannot update traffic gate")
+			return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot update traffic gate: %w", err))
+		}
+		res, err := r.updateStatus(ctx, original, instance)
+		if err == nil && !res.Requeue {
+			res.RequeueAfter = minPositive(veleroRestoreCheckIn, bootstrapIn, restoreRequestIn, restoreProgressIn, servingCheckIn, endpointsCheckIn,
+				scaleCheckIn)
+		}
+		return res, err
 	}
 
 	// otherwise, EtcdConditionReady is set to true/false with the reason that the
 	// StatefulSet is or isn't ready.
+	wasReady := existingCondition.Status == metav1.ConditionTrue
 	reason := etcdaenixiov1alpha1.EtcdCondTypeStatefulSetNotReady
 	message := etcdaenixiov1alpha1.EtcdReadyCondNegMessage
 	if clusterReady {
@@ -119,24 +248,214 @@ func (r *EtcdClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		WithReason(string(reason)).
 		WithMessage(string(message)).
 		Complete())
-	return r.updateStatus(ctx, instance)
+	switch {
+	case clusterReady && !wasReady:
+		r.Recorder.Event(instance, corev1.EventTypeNormal, "Ready", "All members are ready")
+	case !clusterReady && wasReady:
+		r.Recorder.Event(instance, corev1.EventTypeWarning, "Degraded", "Not all members are ready")
+	}
+
+	// observe database size to scale the startup probe of members
+	if clusterReady {
+		if err = r.observeDBSize(ctx, instance); err != nil {
+			logger.Error(err, "cannot observe database size")
+			return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot observe database size: %w", err))
+		}
+	}
+
+	// manage credentials and enable authentication
+	var authRotateIn time.Duration
+	if clusterReady {
+		if authRotateIn, err = r.reconcileAuth(ctx, instance); err != nil {
+			logger.Error(err, "cannot manage credentials")
+			return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot manage credentials: %w", err))
+		}
+		if err = r.reconcileReadOnly(ctx, instance); err != nil {
+			logger.Error(err, "cannot switch read-only mode")
+			return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot switch read-only mode: %w", err))
+		}
+	}
+
+	// detect peer links working in one direction only
+	partitionCheckIn, err := r.reconcilePartition(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot check network partitions")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot check network partitions: %w", err))
+	}
+
+	// watch disk latency and stability of members gating disruptive operations
+	performanceCheckIn, err := r.reconcilePerformance(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot check member performance")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot check member performance: %w", err))
+	}
+
+	// compare etcd versions members run with the etcd image
+	versionCheckIn := r.reconcileVersionDrift(ctx, instance)
+
+	// move leadership away from members on drained nodes
+	if instance.Status.Backup == nil || instance.Status.Backup.RestoringFrom == "" {
+		if err = r.reconcileDrain(ctx, instance); err != nil {
+			logger.Error(err, "cannot handle node drain")
+			return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot handle node drain: %w", err))
+		}
+	}
+
+	// restore the cluster if quorum is lost and take periodic snapshots
+	restoreCheckIn := veleroRestoreCheckIn
+	if restoreCheckIn == 0 {
+		restoreCheckIn, err = r.reconcileAutoRestore(ctx, instance)
+		if err != nil {
+			logger.Error(err, "cannot restore cluster")
+			return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot restore cluster: %w", err))
+		}
+	}
+	// backup failures don't block management of members, they are reported by the condition and retried
+	var backupErrs []error
+	snapshotIn, err := r.reconcileBackup(ctx, instance, clusterReady)
+	if err != nil {
+		logger.Error(err, "cannot take snapshot")
+		backupErrs = append(backupErrs, fmt.Errorf("cannot take snapshot: %w", err))
+	}
+	verificationIn, err := r.reconcileScheduledVerification(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot verify latest snapshot")
+		backupErrs = append(backupErrs, fmt.Errorf("cannot verify latest snapshot: %w", err))
+	}
+	if err = r.reconcileSnapshotVerification(ctx, instance); err != nil {
+		logger.Error(err, "cannot check snapshot verification")
+		backupErrs = append(backupErrs, fmt.Errorf("cannot check snapshot verification: %w", err))
+	}
+	retentionIn, err := r.reconcileBackupRetention(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot delete expired snapshots")
+		backupErrs = append(backupErrs, fmt.Errorf("cannot delete expired snapshots: %w", err))
+	}
+	catalogIn, err := r.reconcileBackupCatalog(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot list available snapshots")
+		backupErrs = append(backupErrs, fmt.Errorf("cannot list available snapshots: %w", err))
+	}
+	r.setBackupCondition(instance, backupErrs)
+
+	// report usage of the keyspace by key prefixes
+	var keyUsageIn time.Duration
+	if clusterReady {
+		if keyUsageIn, err = r.reconcileKeyUsage(ctx, instance); err != nil {
+			logger.Error(err, "cannot report key usage")
+			return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot report key usage: %w", err))
+		}
+	}
+
+	// update members one by one while the cluster stays healthy
+	var rolloutCheckIn, rotationCheckIn time.Duration
+	if instance.Status.Backup == nil || instance.Status.Backup.RestoringFrom == "" {
+		rolloutCheckIn, err = r.rolloutMembers(ctx, instance)
+		if err != nil {
+			logger.Error(err, "cannot roll out member changes")
+			return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot roll out member changes: %w", err))
+		}
+	}
+	// replace aged members, unless members are being updated, but always finish the member replaced before
+	if (rolloutCheckIn == 0 || findWorkflow(instance, factory.OperationRotation) != nil) && (instance.Status.Backup == nil || instance.Status.Backup.RestoringFrom == "") {
+		rotationCheckIn, err = r.reconcileRotation(ctx, instance)
+		if err != nil {
+			logger.Error(err, "cannot rotate members")
+			return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot rotate members: %w", err))
+		}
+	}
+
+	// publish the contract for hosted control planes consuming the cluster
+	if err = factory.CreateOrUpdateIntegrationSecrets(ctx, instance, r.Client, r.Scheme); err != nil {
+		logger.Error(err, "cannot publish integration secrets")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot publish integration secrets: %w", err))
+	}
+
+	// evaluate the cluster against the production checklist
+	if err = r.reconcileProductionReadiness(ctx, instance); err != nil {
+		logger.Error(err, "cannot evaluate production readiness")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot evaluate production readiness: %w", err))
+	}
+
+	// publish whether the cluster is safe for client traffic
+	trafficGateIn, err := r.reconcileTrafficGate(ctx, instance)
+	if err != nil {
+		logger.Error(err, "cannot update traffic gate")
+		return r.updateStatusOnErr(ctx, original, instance, fmt.Errorf("cannot update traffic gate: %w", err))
+	}
+
+	res, err := r.updateStatus(ctx, original, instance)
+	if err != nil || res.Requeue {
+		return res, err
+	}
+	if len(backupErrs) > 0 {
+		// requeued with the backoff of the controller, snapshots are not retried before their own backoff
+		return ctrl.Result{}, goerrors.Join(backupErrs...)
+	}
+	res.RequeueAfter = minPositive(restoreCheckIn, bootstrapIn, restoreRequestIn, restoreProgressIn, snapshotIn, verificationIn, retentionIn, catalogIn, keyUsageIn,
+		rolloutCheckIn, rotationCheckIn, partitionCheckIn, performanceCheckIn, versionCheckIn, servingCheckIn, endpointsCheckIn, authRotateIn, scaleCheckIn, trafficGateIn)
+	return res, nil
 }
 
-// ensureClusterObjects creates or updates all objects owned by cluster CR
+// forgetCluster drops the state kept in memory for the deleted cluster.
+func (r *EtcdClusterReconciler) forgetCluster(key types.NamespacedName) {
+	r.peerMetrics.Delete(key.String())
+	r.performanceMetrics.Delete(key.String())
+	r.versionChecks.Delete(key.String())
+	clusterStatuses.forget(key)
+	etcd.ForgetCluster(key)
+	if r.fair != nil {
+		r.fair.forget(key)
+	}
+}
+
+// minPositive returns the smallest positive duration or zero if there are none.
+func minPositive(durations ...time.Duration) time.Duration {
+	var result time.Duration
+	for _, d := range durations {
+		if d > 0 && (result == 0 || d < result) {
+			result = d
+		}
+	}
+	return result
+}
+
+// ensureClusterObjects creates or updates all objects owned by cluster CR. Objects are created in the order
+// they depend on each other: the cluster state ConfigMap and the headless Service members are named in before
+// the StatefulSet, and services routing to members after it. Creating objects is idempotent, objects created by
+// an overlapping reconcile are adopted.
 func (r *EtcdClusterReconciler) ensureClusterObjects(
 	ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	if err := factory.RecordSpecHistory(ctx, cluster, r.Client, r.Scheme); err != nil {
+		return err
+	}
 	if err := factory.CreateOrUpdateClusterStateConfigMap(ctx, cluster, r.Client, r.Scheme); err != nil {
 		return err
 	}
 	if err := factory.CreateOrUpdateClusterService(ctx, cluster, r.Client, r.Scheme); err != nil {
 		return err
 	}
+	if err := factory.CreateOrUpdateServerCertificate(ctx, cluster, r.Client, r.Scheme); err != nil {
+		return err
+	}
+	if err := factory.CreateOrUpdateServiceCABundle(ctx, cluster, r.Client, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.reportOutOfBandReplicas(ctx, cluster); err != nil {
+		return err
+	}
 	if err := factory.CreateOrUpdateStatefulSet(ctx, cluster, r.Client, r.Scheme); err != nil {
 		return err
 	}
 	if err := factory.CreateOrUpdateClientService(ctx, cluster, r.Client, r.Scheme); err != nil {
 		return err
 	}
+	if err := factory.CreateOrUpdateRoleServices(ctx, cluster, r.Client, r.Scheme); err != nil {
+		return err
+	}
+	if err := factory.CreateOrUpdateRoute(ctx, cluster, r.Client, r.Scheme); err != nil {
+		return err
+	}
 	if err := factory.CreateOrUpdatePdb(ctx, cluster, r.Client, r.Scheme); err != nil {
 		return err
 	}
@@ -145,18 +464,20 @@ func (r *EtcdClusterReconciler) ensureClusterObjects(
 }
 
 // updateStatusOnErr wraps error and updates EtcdCluster status
-func (r *EtcdClusterReconciler) updateStatusOnErr(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, err error) (ctrl.Result, error) {
-	res, statusErr := r.updateStatus(ctx, cluster)
+func (r *EtcdClusterReconciler) updateStatusOnErr(ctx context.Context, original, cluster *etcdaenixiov1alpha1.EtcdCluster, err error) (ctrl.Result, error) {
+	res, statusErr := r.updateStatus(ctx, original, cluster)
 	if statusErr != nil {
 		return res, goerrors.Join(statusErr, err)
 	}
 	return res, err
 }
 
-// updateStatus updates EtcdCluster status and returns error and requeue in case status could not be updated due to conflict
-func (r *EtcdClusterReconciler) updateStatus(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (ctrl.Result, error) {
+// updateStatus writes EtcdCluster status changes made since original was read and returns error and requeue
+// in case status could not be updated due to conflict after retries. Status is written even if the operator
+// is stopping, so the next leader continues from the observed state.
+func (r *EtcdClusterReconciler) updateStatus(ctx context.Context, original, cluster *etcdaenixiov1alpha1.EtcdCluster) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
-	if err := r.Status().Update(ctx, cluster); err != nil {
+	if err := r.persistStatus(ctx, original, cluster); err != nil {
 		logger.Error(err, "unable to update cluster status")
 		if errors.IsConflict(err) {
 			return ctrl.Result{Requeue: true}, nil
@@ -168,6 +489,10 @@ func (r *EtcdClusterReconciler) updateStatus(ctx context.Context, cluster *etcda
 
 // isStatefulSetReady gets managed StatefulSet and checks its readiness.
 func (r *EtcdClusterReconciler) isStatefulSetReady(ctx context.Context, c *etcdaenixiov1alpha1.EtcdCluster) (bool, error) {
+	if c.RestoringWithJobs() {
+		// members are stopped
+		return false, nil
+	}
 	sts := &appsv1.StatefulSet{}
 	err := r.Get(ctx, client.ObjectKeyFromObject(c), sts)
 	if err == nil {
@@ -177,12 +502,28 @@ func (r *EtcdClusterReconciler) isStatefulSetReady(ctx context.Context, c *etcda
 }
 
 // SetupWithManager sets up the controller with the Manager.
+// Every cluster is reconciled at a limited rate and failing clusters are retried with growing delays,
+// so clusters changing constantly or failing never starve reconciliation of others.
+// Referenced Secrets are watched as metadata only, so rotated TLS certificates and credentials are noticed
+// without caching contents of all Secrets.
 func (r *EtcdClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&etcdaenixiov1alpha1.EtcdCluster{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&etcdaenixiov1alpha1.EtcdCluster{}, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+		))).
 		Owns(&appsv1.StatefulSet{}).
 		Owns(&corev1.ConfigMap{}).
 		Owns(&corev1.Service{}).
+		Owns(&discoveryv1.EndpointSlice{}).
 		Owns(&policyv1.PodDisruptionBudget{}).
-		Complete(r)
+		Owns(&batchv1.Job{}).
+		WatchesMetadata(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.clustersReferencingSecret))
+	if !r.Namespaced {
+		b = b.Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(r.clustersOnNode),
+			builder.WithPredicates(nodeDrainChangedPredicate))
+	}
+	r.fair = newFairReconciler(r)
+	return b.WithOptions(controller.Options{RateLimiter: r.fair.failures}).
+		Complete(r.fair)
 }
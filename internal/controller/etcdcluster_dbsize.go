@@ -0,0 +1,60 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// dbSizeTimeout limits the time members are asked for their database sizes.
+const dbSizeTimeout = 5 * time.Second
+
+// observeDBSize stores the largest database size among reachable members in the cluster status. It is used to scale
+// the startup probe of members, so it is observed only while the cluster is ready and members report full sizes.
+func (r *EtcdClusterReconciler) observeDBSize(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	ctx, cancel := context.WithTimeout(ctx, dbSizeTimeout)
+	defer cancel()
+	if size := maxDBSize(etcd.GetEndpointStatus(ctx, cli)); size > 0 {
+		cluster.Status.DBSize = resource.NewQuantity(size, resource.BinarySI)
+	}
+	return nil
+}
+
+// maxDBSize returns the largest database size of members which responded to status requests.
+func maxDBSize(statuses []etcd.EndpointStatus) int64 {
+	var size int64
+	for _, status := range statuses {
+		if status.DBSize > size {
+			size = status.DBSize
+		}
+	}
+	return size
+}
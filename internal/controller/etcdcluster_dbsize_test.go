@@ -0,0 +1,34 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+var _ = Describe("EtcdCluster database size", func() {
+	It("should report the largest size of reachable members", func() {
+		Expect(maxDBSize([]etcd.EndpointStatus{
+			{Endpoint: "test-0", DBSize: 2048},
+			{Endpoint: "test-1", Errors: []string{"context deadline exceeded"}},
+			{Endpoint: "test-2", DBSize: 4096},
+		})).To(Equal(int64(4096)))
+	})
+})
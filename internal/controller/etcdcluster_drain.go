@@ -0,0 +1,154 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// ToBeDeletedTaint is the taint cluster autoscaler puts on nodes it is about to drain and remove.
+const ToBeDeletedTaint = "ToBeDeletedByClusterAutoscaler"
+
+// isNodeDraining checks if the node is cordoned or is about to be drained by cluster autoscaler.
+func isNodeDraining(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	return slices.ContainsFunc(node.Spec.Taints, func(t corev1.Taint) bool { return t.Key == ToBeDeletedTaint })
+}
+
+// reconcileDrain sets MemberNodeDraining condition and moves leadership away from members running on drained nodes,
+// so the leader is not lost when they are evicted. Leadership is moved only while the cluster is fully healthy.
+func (r *EtcdClusterReconciler) reconcileDrain(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	draining := drainingMembers(cluster)
+	reason := etcdaenixiov1alpha1.EtcdCondTypeNodesSchedulable
+	message := etcdaenixiov1alpha1.EtcdNodeDrainingCondNegMessage
+	if len(draining) > 0 {
+		reason = etcdaenixiov1alpha1.EtcdCondTypeNodeDraining
+		message = etcdaenixiov1alpha1.EtcdNodeDrainingCondPosMessage
+	}
+	cond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionMemberNodeDraining)
+	if len(draining) > 0 && (cond == nil || cond.Status != "True") {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, string(etcdaenixiov1alpha1.EtcdCondTypeNodeDraining),
+			"Nodes members %s run on are drained", strings.Join(draining, ", "))
+	}
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionMemberNodeDraining).
+		WithStatus(len(draining) > 0).
+		WithReason(string(reason)).
+		WithMessage(string(message)).
+		Complete())
+	if len(draining) == 0 || len(draining) == len(cluster.Status.Members) {
+		return nil
+	}
+
+	healthy, err := etcd.HealthyMembers(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+	if healthy < int(*cluster.Spec.Replicas) {
+		return nil
+	}
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	leader, err := etcd.MoveLeaderAway(ctx, cli, draining)
+	if err != nil {
+		return err
+	}
+	if leader != "" {
+		log.FromContext(ctx).Info("leadership moved away from drained node", "leader", leader)
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "LeadershipTransferred",
+			"Leadership is moved to member %s, because the node of the previous leader is drained", leader)
+	}
+	return nil
+}
+
+// drainingMembers returns names of members whose nodes are drained.
+func drainingMembers(cluster *etcdaenixiov1alpha1.EtcdCluster) []string {
+	var draining []string
+	for _, member := range cluster.Status.Members {
+		if member.NodeDraining {
+			draining = append(draining, member.Name)
+		}
+	}
+	return draining
+}
+
+// quorumLossTimeout returns how long the quorum has to be lost before automatic restore. The timeout is extended
+// while some members are moved from drained nodes, so the cluster is not restored because of a planned drain.
+func quorumLossTimeout(cluster *etcdaenixiov1alpha1.EtcdCluster) time.Duration {
+	timeout := cluster.Spec.Backup.AutoRestore.QuorumLossTimeout.Duration
+	if cluster.Spec.Drain != nil && len(drainingMembers(cluster)) > 0 {
+		timeout += cluster.Spec.Drain.QuorumLossTimeoutExtension.Duration
+	}
+	return timeout
+}
+
+// clustersOnNode enqueues clusters having members on the node, so they react to the node being drained.
+func (r *EtcdClusterReconciler) clustersOnNode(ctx context.Context, obj client.Object) []reconcile.Request {
+	clusters := &etcdaenixiov1alpha1.EtcdClusterList{}
+	if err := r.List(ctx, clusters); err != nil {
+		log.FromContext(ctx).Error(err, "cannot list clusters")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, cluster := range clusters.Items {
+		if slices.ContainsFunc(cluster.Status.Members, func(m etcdaenixiov1alpha1.MemberStatus) bool {
+			return m.NodeName == obj.GetName()
+		}) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cluster)})
+		}
+	}
+	return requests
+}
+
+// nodeDrainChangedPredicate passes only node updates which start or finish node drain.
+var nodeDrainChangedPredicate = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNode, ok := e.ObjectOld.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		newNode, ok := e.ObjectNew.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		return isNodeDraining(oldNode) != isNodeDraining(newNode)
+	},
+}
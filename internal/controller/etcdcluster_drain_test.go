@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+var _ = Describe("EtcdCluster node drain", func() {
+	Context("When checking nodes", func() {
+		It("should treat cordoned nodes as drained", func() {
+			Expect(isNodeDraining(&corev1.Node{Spec: corev1.NodeSpec{Unschedulable: true}})).To(BeTrue())
+		})
+
+		It("should treat nodes removed by cluster autoscaler as drained", func() {
+			node := &corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+				{Key: ToBeDeletedTaint, Effect: corev1.TaintEffectNoSchedule},
+			}}}
+			Expect(isNodeDraining(node)).To(BeTrue())
+		})
+
+		It("should pass only updates starting or finishing drain", func() {
+			schedulable := &corev1.Node{}
+			cordoned := &corev1.Node{Spec: corev1.NodeSpec{Unschedulable: true}}
+			labeled := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"a": "b"}}}
+			Expect(nodeDrainChangedPredicate.Update(event.UpdateEvent{ObjectOld: schedulable, ObjectNew: cordoned})).To(BeTrue())
+			Expect(nodeDrainChangedPredicate.Update(event.UpdateEvent{ObjectOld: cordoned, ObjectNew: schedulable})).To(BeTrue())
+			Expect(nodeDrainChangedPredicate.Update(event.UpdateEvent{ObjectOld: schedulable, ObjectNew: labeled})).To(BeFalse())
+		})
+	})
+
+	Context("When members run on drained nodes", func() {
+		var cluster *etcdaenixiov1alpha1.EtcdCluster
+
+		BeforeEach(func() {
+			cluster = &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+						AutoRestore: &etcdaenixiov1alpha1.AutoRestoreSpec{
+							QuorumLossTimeout: metav1.Duration{Duration: 2 * time.Minute},
+						},
+					},
+					Drain: &etcdaenixiov1alpha1.DrainSpec{
+						QuorumLossTimeoutExtension: metav1.Duration{Duration: 5 * time.Minute},
+					},
+				},
+				Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+					Members: []etcdaenixiov1alpha1.MemberStatus{
+						{Name: "test-0", NodeName: "node-a"},
+						{Name: "test-1", NodeName: "node-b", NodeDraining: true},
+						{Name: "test-2", NodeName: "node-c"},
+					},
+				},
+			}
+		})
+
+		It("should report drained members", func() {
+			Expect(drainingMembers(cluster)).To(Equal([]string{"test-1"}))
+		})
+
+		It("should extend quorum loss timeout only during drain", func() {
+			Expect(quorumLossTimeout(cluster)).To(Equal(7 * time.Minute))
+			cluster.Status.Members[1].NodeDraining = false
+			Expect(quorumLossTimeout(cluster)).To(Equal(2 * time.Minute))
+		})
+
+		It("should clear condition once nodes are schedulable", func(ctx SpecContext) {
+			cluster.Status.Members[1].NodeDraining = false
+			r := &EtcdClusterReconciler{Recorder: record.NewFakeRecorder(10)}
+			Expect(r.reconcileDrain(ctx, cluster)).To(Succeed())
+			cond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionMemberNodeDraining)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(string(etcdaenixiov1alpha1.EtcdCondTypeNodesSchedulable)))
+		})
+
+		It("should enqueue clusters having members on the node", func(ctx SpecContext) {
+			scheme := runtime.NewScheme()
+			Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+			other := &etcdaenixiov1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "other"}}
+			r := &EtcdClusterReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster, other).Build()}
+
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}}
+			Expect(r.clustersOnNode(ctx, node)).To(ConsistOf(
+				reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "test"}},
+			))
+		})
+	})
+})
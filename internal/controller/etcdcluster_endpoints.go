@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// endpointsCheckInterval is how often the leader is checked to follow leadership changes in role Services.
+const endpointsCheckInterval = 10 * time.Second
+
+// reconcileEndpoints points cluster Services at serving members. Members serve clients once their
+// factory.ServingReadinessGate condition is true. In Managed endpoints mode it publishes EndpointSlices:
+// all serving members for the client Service, the leader for the leader Service and other serving members
+// for the followers Service. In Selector mode with role Services it labels member pods with their roles
+// for role Services to select them. It returns time after which the leader has to be checked again
+// or zero if there are no role Services.
+func (r *EtcdClusterReconciler) reconcileEndpoints(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	if !cluster.RoleServices() {
+		return 0, nil
+	}
+
+	var pods, serving []*corev1.Pod
+	for _, name := range cluster.MemberNames() {
+		pod := &corev1.Pod{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, pod)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("cannot get member pod %s: %w", name, err)
+		}
+		pods = append(pods, pod)
+		if isMemberServing(pod) {
+			serving = append(serving, pod)
+		}
+	}
+
+	leader := ""
+	if len(serving) > 0 {
+		var err error
+		if leader, err = r.leaderName(ctx, cluster); err != nil {
+			log.FromContext(ctx).V(2).Info("cannot find leader", "reason", err.Error())
+		}
+	}
+	var leaders, followers []*corev1.Pod
+	for _, pod := range serving {
+		if pod.Name == leader {
+			leaders = append(leaders, pod)
+		} else {
+			followers = append(followers, pod)
+		}
+	}
+
+	if !cluster.ManagedEndpoints() {
+		for _, pod := range pods {
+			role := ""
+			if slices.Contains(leaders, pod) {
+				role = factory.RoleLeader
+			} else if slices.Contains(followers, pod) {
+				role = factory.RoleFollower
+			}
+			if err := r.setMemberRole(ctx, pod, role); err != nil {
+				return 0, err
+			}
+		}
+		return cluster.ProbeInterval(endpointsCheckInterval), nil
+	}
+
+	for _, service := range []struct {
+		name string
+		pods []*corev1.Pod
+	}{
+		{name: factory.GetClientServiceName(cluster), pods: serving},
+		{name: factory.GetLeaderServiceName(cluster), pods: leaders},
+		{name: factory.GetFollowersServiceName(cluster), pods: followers},
+	} {
+		if err := factory.CreateOrUpdateEndpointSlice(ctx, cluster, r.Client, r.Scheme, service.name, service.pods); err != nil {
+			return 0, fmt.Errorf("cannot update endpoints of service %s: %w", service.name, err)
+		}
+	}
+	return cluster.ProbeInterval(endpointsCheckInterval), nil
+}
+
+// setMemberRole sets factory.RoleLabel of the member pod to the role or removes it if the role is empty.
+func (r *EtcdClusterReconciler) setMemberRole(ctx context.Context, pod *corev1.Pod, role string) error {
+	if pod.Labels[factory.RoleLabel] == role {
+		return nil
+	}
+	patch := client.MergeFrom(pod.DeepCopy())
+	if role == "" {
+		delete(pod.Labels, factory.RoleLabel)
+	} else {
+		if pod.Labels == nil {
+			pod.Labels = map[string]string{}
+		}
+		pod.Labels[factory.RoleLabel] = role
+	}
+	if err := r.Patch(ctx, pod, patch); err != nil {
+		return fmt.Errorf("cannot set role of member pod %s: %w", pod.Name, err)
+	}
+	return nil
+}
+
+func (r *EtcdClusterReconciler) leaderName(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (string, error) {
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return "", fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	var leader string
+	err = etcd.Probe(ctx, func(ctx context.Context) (err error) {
+		leader, err = etcd.LeaderName(ctx, cli)
+		return err
+	})
+	return leader, err
+}
+
+// isMemberServing checks if the member pod has an IP and its factory.ServingReadinessGate condition is true.
+func isMemberServing(pod *corev1.Pod) bool {
+	return pod.Status.PodIP != "" && slices.ContainsFunc(pod.Status.Conditions, func(c corev1.PodCondition) bool {
+		return c.Type == factory.ServingReadinessGate && c.Status == corev1.ConditionTrue
+	})
+}
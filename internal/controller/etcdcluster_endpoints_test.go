@@ -0,0 +1,52 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+var _ = Describe("EtcdCluster endpoints", func() {
+	It("should treat members with the serving condition as serving", func() {
+		pod := &corev1.Pod{Status: corev1.PodStatus{PodIP: "10.0.0.1"}}
+		Expect(isMemberServing(pod)).To(BeFalse())
+		pod.Status.Conditions = []corev1.PodCondition{{Type: factory.ServingReadinessGate, Status: corev1.ConditionTrue}}
+		Expect(isMemberServing(pod)).To(BeTrue())
+		pod.Status.PodIP = ""
+		Expect(isMemberServing(pod)).To(BeFalse())
+	})
+
+	It("should label member pods with their roles", func(ctx SpecContext) {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-0"}}
+		r := &EtcdClusterReconciler{Client: fake.NewClientBuilder().WithObjects(pod).Build()}
+
+		Expect(r.setMemberRole(ctx, pod, factory.RoleLeader)).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pod), pod)).To(Succeed())
+		Expect(pod.Labels).To(HaveKeyWithValue(factory.RoleLabel, factory.RoleLeader))
+
+		Expect(r.setMemberRole(ctx, pod, "")).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pod), pod)).To(Succeed())
+		Expect(pod.Labels).NotTo(HaveKey(factory.RoleLabel))
+	})
+})
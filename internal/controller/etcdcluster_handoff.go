@@ -0,0 +1,36 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// handoffTimeout is how long status is still written after the operator is asked to stop, so the state
+// of operations in progress is handed off to the next leader.
+const handoffTimeout = 10 * time.Second
+
+// persistStatus writes status changes made since original was read right away. The write is not canceled
+// when the operator stops, so progress made before the shutdown is never lost.
+func (r *EtcdClusterReconciler) persistStatus(ctx context.Context, original, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), handoffTimeout)
+	defer cancel()
+	return clusterStatuses.write(ctx, r.Client, original, cluster)
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// reconcileKeyUsage publishes a report of the number and size of keys per key prefix once the interval since
+// the last report passed and freezes users of prefixes exceeding their quotas. It returns time after which
+// the next report is due or zero if reports are disabled.
+func (r *EtcdClusterReconciler) reconcileKeyUsage(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	var next time.Duration
+	if spec := cluster.Spec.KeyUsage; spec != nil {
+		interval := cmp.Or(spec.Interval.Duration, etcdaenixiov1alpha1.DefaultKeyUsageInterval)
+		now := time.Now()
+		next = interval
+		if status := cluster.Status.KeyUsage; status != nil && status.LastReportTime != nil {
+			next = status.LastReportTime.Add(interval).Sub(now)
+		}
+		if next <= 0 {
+			if err := r.reportKeyUsage(ctx, cluster, now); err != nil {
+				return 0, err
+			}
+			next = interval
+		}
+	}
+	if err := r.enforceKeyQuotas(ctx, cluster); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// reportKeyUsage publishes a report of the key usage and checks key quotas.
+func (r *EtcdClusterReconciler) reportKeyUsage(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, now time.Time) error {
+	spec := cluster.Spec.KeyUsage
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	quotaPrefixes := make([]string, 0, len(spec.Quotas))
+	for _, quota := range spec.Quotas {
+		quotaPrefixes = append(quotaPrefixes, quota.Prefix)
+	}
+	usage, err := etcd.GetKeyUsage(ctx, cli, cmp.Or(spec.Separator, "/"), int(max(spec.Depth, 1)),
+		cmp.Or(spec.MaxKeys, 100000), quotaPrefixes)
+	if err != nil {
+		return err
+	}
+	report, err := json.Marshal(usage.Top(int(cmp.Or(spec.TopPrefixes, 20))))
+	if err != nil {
+		return fmt.Errorf("cannot encode key usage report: %w", err)
+	}
+	if err = factory.CreateOrUpdateKeyUsageConfigMap(ctx, cluster, report, r.Client, r.Scheme); err != nil {
+		return fmt.Errorf("cannot publish key usage report: %w", err)
+	}
+	log.FromContext(ctx).V(2).Info("key usage report published", "keys", usage.ScannedKeys, "complete", usage.Complete)
+	exceeded, exceededPrefixes := exceededKeyQuotas(spec.Quotas, usage.Quotas)
+	status := &etcdaenixiov1alpha1.KeyUsageStatus{
+		LastReportTime: &metav1.Time{Time: now.Truncate(time.Second)},
+		ScannedKeys:    usage.ScannedKeys,
+		Complete:       usage.Complete,
+		ExceededQuotas: exceededPrefixes,
+	}
+	if cluster.Status.KeyUsage != nil {
+		status.FrozenUsers = cluster.Status.KeyUsage.FrozenUsers
+	}
+	cluster.Status.KeyUsage = status
+
+	wasExceeded := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionKeyQuotaExceeded)
+	if len(spec.Quotas) == 0 {
+		if wasExceeded != nil {
+			meta.RemoveStatusCondition(&cluster.Status.Conditions, etcdaenixiov1alpha1.EtcdConditionKeyQuotaExceeded)
+		}
+		return nil
+	}
+	setKeyQuotaCondition(cluster, exceeded)
+	if len(exceeded) > 0 && (wasExceeded == nil || wasExceeded.Status != metav1.ConditionTrue) {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, string(etcdaenixiov1alpha1.EtcdCondTypeKeyQuotaExceeded),
+			"%s", keyQuotaMessage(exceeded))
+	}
+	return nil
+}
+
+// enforceKeyQuotas freezes users of quotas exceeded in the last report and grants roles back to users whose quotas
+// are met again or who are not listed in exceeded quotas anymore. Only roles permitting writes under prefixes of
+// the exceeded quotas are revoked, so a user listed in several quotas keeps writing under prefixes within their
+// quotas unless the same role permits both. While the cluster is read-only, roles of users whose quotas are met
+// are moved to roles revoked by the read-only mode instead. Revoked roles are recorded in status before they are
+// revoked, so they are not lost if the operator stops in between.
+func (r *EtcdClusterReconciler) enforceKeyQuotas(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	freeze := usersToFreeze(cluster)
+	status := cluster.Status.KeyUsage
+	if frozenAsExceeded(status, freeze) {
+		return nil
+	}
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	users, err := etcd.UsersRoles(ctx, cli)
+	if err != nil {
+		return err
+	}
+
+	for _, frozen := range slices.Clone(status.FrozenUsers) {
+		if _, ok := freeze[frozen.User]; ok {
+			continue
+		}
+		if err = r.grantFrozenRoles(ctx, cli, cluster, frozen.User, frozen.Roles, true); err != nil {
+			return err
+		}
+		status.FrozenUsers = slices.DeleteFunc(status.FrozenUsers,
+			func(u etcdaenixiov1alpha1.FrozenUser) bool { return u.User == frozen.User })
+		log.FromContext(ctx).Info("user is within key quotas again", "user", frozen.User)
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "KeyQuotaUserThawed",
+			"Key quotas of user %s are met, its roles are granted back", frozen.User)
+	}
+
+	revoked, granted := map[string][]string{}, map[string][]string{}
+	original := cluster.DeepCopy()
+	for _, name := range sortedKeys(freeze) {
+		prefixes := freeze[name]
+		idx := slices.IndexFunc(status.FrozenUsers, func(u etcdaenixiov1alpha1.FrozenUser) bool { return u.User == name })
+		roles, ok := users[name]
+		if !ok || idx != -1 && slices.Equal(status.FrozenUsers[idx].Prefixes, prefixes) {
+			continue
+		}
+		held := slices.DeleteFunc(slices.Clone(roles), func(role string) bool { return role == etcd.ReadOnlyRole })
+		var recorded []string
+		if idx != -1 {
+			recorded = status.FrozenUsers[idx].Roles
+		}
+		// roles recorded for quotas which are met now are checked too, to be granted back if they don't permit
+		// writes under the prefixes of exceeded quotas
+		writing, err := etcd.WritingRoles(ctx, cli, append(slices.Clone(recorded), held...), prefixes)
+		if err != nil {
+			return err
+		}
+		slices.Sort(writing)
+		writing = slices.Compact(writing)
+		revoked[name] = slices.DeleteFunc(slices.Clone(held), func(role string) bool { return !slices.Contains(writing, role) })
+		granted[name] = withoutRoles(recorded, writing)
+		if idx == -1 {
+			status.FrozenUsers = append(status.FrozenUsers, etcdaenixiov1alpha1.FrozenUser{User: name})
+			idx = len(status.FrozenUsers) - 1
+		}
+		status.FrozenUsers[idx].Prefixes = prefixes
+		status.FrozenUsers[idx].Roles = writing
+		if writing == nil {
+			status.FrozenUsers[idx].Roles = []string{}
+		}
+	}
+	if len(revoked) == 0 {
+		return nil
+	}
+	if err = r.persistStatus(ctx, original, cluster); err != nil {
+		return fmt.Errorf("cannot record revoked roles: %w", err)
+	}
+	for _, name := range sortedKeys(revoked) {
+		if err = etcd.FreezeUser(ctx, cli, name, revoked[name]); err != nil {
+			return err
+		}
+		if err = r.grantFrozenRoles(ctx, cli, cluster, name, granted[name], false); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("user exceeds key quotas", "user", name, "prefixes", freeze[name], "roles", revoked[name])
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "KeyQuotaUserFrozen",
+			"User %s can't write under %s until keys under them are within their quotas",
+			name, strings.Join(freeze[name], ", "))
+	}
+	return nil
+}
+
+// grantFrozenRoles grants roles revoked for exceeding key quotas back to the user, with roles of the user if it
+// is managed by the operator and the read-only role is revoked too. While the cluster is read-only, the roles are
+// recorded as revoked by the read-only mode instead.
+func (r *EtcdClusterReconciler) grantFrozenRoles(
+	ctx context.Context,
+	cli etcd.Client,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	name string,
+	roles []string,
+	thaw bool,
+) error {
+	switch {
+	case cluster.Status.ReadOnly != nil:
+		recordRevokedRoles(cluster.Status.ReadOnly, map[string][]string{name: roles})
+		return nil
+	case thaw:
+		return etcd.ThawUser(ctx, cli, name, append(slices.Clone(roles), managedUserRoles(cluster, name)...))
+	case len(roles) > 0:
+		return etcd.GrantRoles(ctx, cli, name, roles)
+	}
+	return nil
+}
+
+// usersToFreeze returns sorted prefixes of quotas exceeded in the last report keyed by names of users listed
+// in the quotas.
+func usersToFreeze(cluster *etcdaenixiov1alpha1.EtcdCluster) map[string][]string {
+	users := map[string][]string{}
+	if cluster.Spec.KeyUsage == nil || cluster.Status.KeyUsage == nil {
+		return users
+	}
+	for _, quota := range cluster.Spec.KeyUsage.Quotas {
+		if slices.Contains(cluster.Status.KeyUsage.ExceededQuotas, quota.Prefix) {
+			for _, name := range quota.FreezeUsers {
+				users[name] = append(users[name], quota.Prefix)
+			}
+		}
+	}
+	for _, prefixes := range users {
+		slices.Sort(prefixes)
+	}
+	return users
+}
+
+// frozenAsExceeded returns true if exactly the users to freeze are frozen for the same prefixes.
+func frozenAsExceeded(status *etcdaenixiov1alpha1.KeyUsageStatus, freeze map[string][]string) bool {
+	if status == nil {
+		return len(freeze) == 0
+	}
+	return len(status.FrozenUsers) == len(freeze) && !slices.ContainsFunc(status.FrozenUsers,
+		func(u etcdaenixiov1alpha1.FrozenUser) bool { return !slices.Equal(u.Prefixes, freeze[u.User]) })
+}
+
+// quotaFrozenRoles returns roles revoked from the user for exceeding key quotas and true if the user is frozen.
+func quotaFrozenRoles(cluster *etcdaenixiov1alpha1.EtcdCluster, name string) ([]string, bool) {
+	if cluster.Status.KeyUsage == nil {
+		return nil, false
+	}
+	for _, u := range cluster.Status.KeyUsage.FrozenUsers {
+		if u.User == name {
+			return u.Roles, true
+		}
+	}
+	return nil, false
+}
+
+// withoutRoles returns the roles except the excluded ones.
+func withoutRoles(roles, excluded []string) []string {
+	return slices.DeleteFunc(slices.Clone(roles), func(role string) bool { return slices.Contains(excluded, role) })
+}
+
+// exceededKeyQuotas describes quotas exceeded by the usage of their prefixes, which is in the order of quotas,
+// and returns prefixes of the exceeded quotas.
+func exceededKeyQuotas(quotas []etcdaenixiov1alpha1.KeyQuota, usage []etcd.PrefixUsage) ([]string, []string) {
+	var exceeded, prefixes []string
+	for i, quota := range quotas {
+		n := len(exceeded)
+		if quota.MaxKeys != nil && usage[i].Keys > *quota.MaxKeys {
+			exceeded = append(exceeded, fmt.Sprintf("%s has %d keys, quota is %d", quota.Prefix, usage[i].Keys, *quota.MaxKeys))
+		}
+		if quota.MaxBytes != nil && usage[i].Bytes > quota.MaxBytes.Value() {
+			exceeded = append(exceeded, fmt.Sprintf("%s has %s, quota is %s", quota.Prefix,
+				resource.NewQuantity(usage[i].Bytes, resource.BinarySI), quota.MaxBytes))
+		}
+		if len(exceeded) > n {
+			prefixes = append(prefixes, quota.Prefix)
+		}
+	}
+	return exceeded, prefixes
+}
+
+// keyQuotaMessage describes exceeded quotas.
+func keyQuotaMessage(exceeded []string) string {
+	return "Key quotas are exceeded: " + strings.Join(exceeded, "; ")
+}
+
+func setKeyQuotaCondition(cluster *etcdaenixiov1alpha1.EtcdCluster, exceeded []string) {
+	reason := etcdaenixiov1alpha1.EtcdCondTypeKeyQuotasMet
+	message := string(etcdaenixiov1alpha1.EtcdKeyQuotaCondNegMessage)
+	if len(exceeded) > 0 {
+		reason = etcdaenixiov1alpha1.EtcdCondTypeKeyQuotaExceeded
+		message = keyQuotaMessage(exceeded)
+	}
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionKeyQuotaExceeded).
+		WithStatus(len(exceeded) > 0).
+		WithReason(string(reason)).
+		WithMessage(message).
+		Complete())
+}
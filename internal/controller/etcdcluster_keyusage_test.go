@@ -0,0 +1,189 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+	"github.com/aenix-io/etcd-operator/pkg/etcdclient/etcdclienttest"
+)
+
+var _ = Describe("EtcdCluster key usage reports", func() {
+	It("should group keys by their leading segments", func() {
+		Expect(etcd.KeyPrefix("/registry/pods/default/app", "/", 1)).To(Equal("/registry/"))
+		Expect(etcd.KeyPrefix("/registry/pods/default/app", "/", 2)).To(Equal("/registry/pods/"))
+		Expect(etcd.KeyPrefix("config/app/mode", "/", 1)).To(Equal("config/"))
+		Expect(etcd.KeyPrefix("/registry", "/", 1)).To(Equal("/registry"))
+		Expect(etcd.KeyPrefix("tenant-a:users:1", ":", 1)).To(Equal("tenant-a:"))
+	})
+
+	It("should keep the largest prefixes in the report", func() {
+		usage := &etcd.KeyUsage{ScannedKeys: 3, Prefixes: []etcd.PrefixUsage{
+			{Prefix: "/a/", Keys: 1, Bytes: 30}, {Prefix: "/b/", Keys: 2, Bytes: 20},
+		}}
+		Expect(usage.Top(1).Prefixes).To(Equal([]etcd.PrefixUsage{{Prefix: "/a/", Keys: 1, Bytes: 30}}))
+		Expect(usage.Top(5).Prefixes).To(HaveLen(2))
+		Expect(usage.Prefixes).To(HaveLen(2))
+	})
+
+	It("should report exceeded key quotas", func() {
+		quotas := []etcdaenixiov1alpha1.KeyQuota{
+			{Prefix: "/tenant-a/", MaxKeys: ptr.To(int64(100)), MaxBytes: ptr.To(resource.MustParse("1Mi"))},
+			{Prefix: "/tenant-b/", MaxKeys: ptr.To(int64(100))},
+		}
+		exceeded, prefixes := exceededKeyQuotas(quotas, []etcd.PrefixUsage{
+			{Prefix: "/tenant-a/", Keys: 50, Bytes: 2 << 20},
+			{Prefix: "/tenant-b/", Keys: 100, Bytes: 2 << 20},
+		})
+		Expect(exceeded).To(Equal([]string{"/tenant-a/ has 2Mi, quota is 1Mi"}))
+		Expect(prefixes).To(Equal([]string{"/tenant-a/"}))
+
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+		setKeyQuotaCondition(cluster, exceeded)
+		cond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionKeyQuotaExceeded)
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Message).To(ContainSubstring("/tenant-a/ has 2Mi"))
+	})
+
+	It("should freeze users of exceeded key quotas", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{KeyUsage: &etcdaenixiov1alpha1.KeyUsageSpec{
+				Quotas: []etcdaenixiov1alpha1.KeyQuota{
+					{Prefix: "/tenant-a/", MaxKeys: ptr.To(int64(100)), FreezeUsers: []string{"tenant-a", "shared"}},
+					{Prefix: "/tenant-b/", MaxKeys: ptr.To(int64(100)), FreezeUsers: []string{"tenant-b", "shared"}},
+					{Prefix: "/tenant-c/", MaxKeys: ptr.To(int64(100)), FreezeUsers: []string{"tenant-c"}},
+				},
+			}},
+			Status: etcdaenixiov1alpha1.EtcdClusterStatus{KeyUsage: &etcdaenixiov1alpha1.KeyUsageStatus{
+				ExceededQuotas: []string{"/tenant-a/", "/tenant-b/"},
+				FrozenUsers: []etcdaenixiov1alpha1.FrozenUser{
+					{User: "tenant-c", Prefixes: []string{"/tenant-c/"}, Roles: []string{"tenant-c-rw"}},
+				},
+			}},
+		}
+		freeze := usersToFreeze(cluster)
+		Expect(freeze).To(Equal(map[string][]string{
+			"shared":   {"/tenant-a/", "/tenant-b/"},
+			"tenant-a": {"/tenant-a/"},
+			"tenant-b": {"/tenant-b/"},
+		}))
+		Expect(frozenAsExceeded(cluster.Status.KeyUsage, freeze)).To(BeFalse())
+		roles, frozen := quotaFrozenRoles(cluster, "tenant-c")
+		Expect(frozen).To(BeTrue())
+		Expect(roles).To(Equal([]string{"tenant-c-rw"}))
+		_, frozen = quotaFrozenRoles(cluster, "tenant-a")
+		Expect(frozen).To(BeFalse())
+
+		cluster.Status.KeyUsage.FrozenUsers = []etcdaenixiov1alpha1.FrozenUser{
+			{User: "shared", Prefixes: []string{"/tenant-a/"}, Roles: []string{"tenant-a-rw"}},
+			{User: "tenant-a", Prefixes: []string{"/tenant-a/"}, Roles: []string{"tenant-a-rw"}},
+			{User: "tenant-b", Prefixes: []string{"/tenant-b/"}, Roles: []string{"tenant-b-rw"}},
+		}
+		Expect(frozenAsExceeded(cluster.Status.KeyUsage, freeze)).To(BeFalse())
+		cluster.Status.KeyUsage.FrozenUsers[0].Prefixes = []string{"/tenant-a/", "/tenant-b/"}
+		Expect(frozenAsExceeded(cluster.Status.KeyUsage, freeze)).To(BeTrue())
+
+		cluster.Spec.KeyUsage = nil
+		Expect(usersToFreeze(cluster)).To(BeEmpty())
+	})
+
+	It("should revoke only roles writing under prefixes of exceeded quotas", func(ctx SpecContext) {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(1)),
+				KeyUsage: &etcdaenixiov1alpha1.KeyUsageSpec{Quotas: []etcdaenixiov1alpha1.KeyQuota{
+					{Prefix: "/tenant-a/", MaxKeys: ptr.To(int64(100)), FreezeUsers: []string{"tenant-a", "shared"}},
+					{Prefix: "/tenant-b/", MaxKeys: ptr.To(int64(100)), FreezeUsers: []string{"shared"}},
+				}},
+				EtcdAPI: &etcdaenixiov1alpha1.EtcdAPISpec{MaxRetries: ptr.To(int32(0))},
+			},
+			Status: etcdaenixiov1alpha1.EtcdClusterStatus{KeyUsage: &etcdaenixiov1alpha1.KeyUsageStatus{}},
+		}
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		r := &EtcdClusterReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).
+				WithStatusSubresource(&etcdaenixiov1alpha1.EtcdCluster{}).Build(),
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+		etcd.ConfigureClientFactory(etcdclienttest.NewFactory(etcdclienttest.NewClusterFor(cluster)))
+		DeferCleanup(func() {
+			etcd.ConfigureClientFactory(nil)
+		})
+		cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(cli.Close)
+		for _, prefix := range []string{"/tenant-a/", "/tenant-b/"} {
+			role := prefix[1:len(prefix)-1] + "-rw"
+			_, err = cli.RoleAdd(ctx, role)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cli.RoleGrantPermission(ctx, role, prefix, clientv3.GetPrefixRangeEnd(prefix),
+				clientv3.PermissionType(clientv3.PermReadWrite))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(etcd.SetUserPassword(ctx, cli, "tenant-a", "secret", []string{"tenant-a-rw"})).To(Succeed())
+		Expect(etcd.SetUserPassword(ctx, cli, "shared", "secret", []string{"tenant-a-rw", "tenant-b-rw"})).To(Succeed())
+
+		enforce := func(exceeded ...string) map[string][]string {
+			Expect(r.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+			cluster.Status.KeyUsage.ExceededQuotas = exceeded
+			Expect(r.enforceKeyQuotas(ctx, cluster)).To(Succeed())
+			Expect(r.Status().Update(ctx, cluster)).To(Succeed())
+			users, err := etcd.UsersRoles(ctx, cli)
+			Expect(err).NotTo(HaveOccurred())
+			return users
+		}
+
+		users := enforce("/tenant-a/")
+		Expect(users["tenant-a"]).To(ConsistOf(etcd.ReadOnlyRole))
+		Expect(users["shared"]).To(ConsistOf(etcd.ReadOnlyRole, "tenant-b-rw"))
+		Expect(cluster.Status.KeyUsage.FrozenUsers).To(ConsistOf(
+			etcdaenixiov1alpha1.FrozenUser{User: "shared", Prefixes: []string{"/tenant-a/"}, Roles: []string{"tenant-a-rw"}},
+			etcdaenixiov1alpha1.FrozenUser{User: "tenant-a", Prefixes: []string{"/tenant-a/"}, Roles: []string{"tenant-a-rw"}},
+		))
+
+		users = enforce("/tenant-a/", "/tenant-b/")
+		Expect(users["shared"]).To(ConsistOf(etcd.ReadOnlyRole))
+
+		users = enforce("/tenant-b/")
+		Expect(users["tenant-a"]).To(ConsistOf("tenant-a-rw"))
+		Expect(users["shared"]).To(ConsistOf(etcd.ReadOnlyRole, "tenant-a-rw"))
+		Expect(cluster.Status.KeyUsage.FrozenUsers).To(ConsistOf(
+			etcdaenixiov1alpha1.FrozenUser{User: "shared", Prefixes: []string{"/tenant-b/"}, Roles: []string{"tenant-b-rw"}},
+		))
+
+		users = enforce()
+		Expect(users["shared"]).To(ConsistOf("tenant-a-rw", "tenant-b-rw"))
+		Expect(cluster.Status.KeyUsage.FrozenUsers).To(BeEmpty())
+	})
+})
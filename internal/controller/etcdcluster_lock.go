@@ -0,0 +1,99 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+// acquireOperationLock takes the operation lock of the cluster for the disruptive operation.
+// It returns false if another operation holds the lock, so the operation has to wait for it to finish.
+func (r *EtcdClusterReconciler) acquireOperationLock(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	operation factory.Operation,
+) (bool, error) {
+	holder, err := factory.AcquireOperationLock(ctx, cluster, r.Client, r.Scheme, operation)
+	if err != nil {
+		return false, err
+	}
+	if holder != operation {
+		log.FromContext(ctx).Info("operation is waiting for another one to finish", "operation", operation, "running", holder)
+		return false, nil
+	}
+	return true, nil
+}
+
+// releaseOperationLockWhenReady releases the operation lock held by the operation once all members are running
+// and ready, so the next operation never starts while members taken down by the previous one are recovering.
+func (r *EtcdClusterReconciler) releaseOperationLockWhenReady(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	operation factory.Operation,
+) error {
+	holder, err := factory.OperationLockHolder(ctx, cluster, r.Client)
+	if err != nil || holder != operation {
+		return err
+	}
+	if ready, err := membersReady(ctx, r.Client, cluster); !ready {
+		return err
+	}
+	return factory.ReleaseOperationLock(ctx, cluster, r.Client, operation)
+}
+
+// membersReady checks if pods of all members exist, are not terminating and are ready.
+func membersReady(ctx context.Context, rclient client.Reader, cluster *etcdaenixiov1alpha1.EtcdCluster) (bool, error) {
+	for _, name := range cluster.MemberNames() {
+		if ready, err := memberReady(ctx, rclient, cluster, name); !ready {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// memberReady checks if the member pod exists, is not terminating and is ready.
+func memberReady(ctx context.Context, rclient client.Reader, cluster *etcdaenixiov1alpha1.EtcdCluster, name string) (bool, error) {
+	pod := &corev1.Pod{}
+	err := rclient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, pod)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot get member pod %s: %w", name, err)
+	}
+	return pod.DeletionTimestamp.IsZero() && isPodReady(pod), nil
+}
+
+// isPodReady checks if the pod has the Ready condition set.
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+var _ = Describe("EtcdCluster operation lock", func() {
+	It("should release the lock once all members are ready", func(ctx SpecContext) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+			Spec:       etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(2))},
+		}
+		member := func(name string, ready corev1.ConditionStatus) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+				},
+			}
+		}
+		notReady := member("test-1", corev1.ConditionFalse)
+		r := &EtcdClusterReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(member("test-0", corev1.ConditionTrue), notReady).Build(),
+			Scheme: scheme,
+		}
+		Expect(r.acquireOperationLock(ctx, cluster, factory.OperationRotation)).To(BeTrue())
+		Expect(r.acquireOperationLock(ctx, cluster, factory.OperationRollout)).To(BeFalse())
+
+		Expect(r.releaseOperationLockWhenReady(ctx, cluster, factory.OperationRotation)).To(Succeed())
+		Expect(factory.OperationLockHolder(ctx, cluster, r.Client)).To(Equal(factory.OperationRotation))
+
+		notReady.Status.Conditions[0].Status = corev1.ConditionTrue
+		Expect(r.Status().Update(ctx, notReady)).To(Succeed())
+		Expect(r.releaseOperationLockWhenReady(ctx, cluster, factory.OperationRotation)).To(Succeed())
+		Expect(factory.OperationLockHolder(ctx, cluster, r.Client)).To(BeEmpty())
+		Expect(r.acquireOperationLock(ctx, cluster, factory.OperationRollout)).To(BeTrue())
+	})
+})
@@ -0,0 +1,329 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+const (
+	// localVolumeProvisioner is the provisioner of statically provisioned local PersistentVolumes.
+	localVolumeProvisioner = "kubernetes.io/no-provisioner"
+	// oomKilledReason is the container termination reason set by the kubelet when the container runs out of memory.
+	oomKilledReason = "OOMKilled"
+)
+
+// memberPVCName returns name of the PersistentVolumeClaim created by the StatefulSet for the given member.
+func memberPVCName(claimName, memberName string) string {
+	return claimName + "-" + memberName
+}
+
+// updateMembersStatus fills status of every member with the node its pod runs on and whether it is drained, restarts
+// of its etcd container and the node its data volume is pinned to, and the quorum and the fault tolerance of the cluster.
+// If a pinned node does not exist anymore, the member is marked as lost and MemberNodeLost condition is set.
+func (r *EtcdClusterReconciler) updateMembersStatus(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	members := make([]etcdaenixiov1alpha1.MemberStatus, 0, *cluster.Spec.Replicas)
+	var lost []string
+	for _, name := range cluster.MemberNames() {
+		member := etcdaenixiov1alpha1.MemberStatus{Name: name}
+		if idx := slices.IndexFunc(cluster.Status.Members, func(m etcdaenixiov1alpha1.MemberStatus) bool {
+			return m.Name == name
+		}); idx != -1 {
+			prev := cluster.Status.Members[idx]
+			member.Version = prev.Version
+			member.OOMKills = prev.OOMKills
+			member.LastTerminationReason = prev.LastTerminationReason
+			member.LastTerminationTime = prev.LastTerminationTime
+		}
+
+		pod := &corev1.Pod{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, pod)
+		if err == nil {
+			member.NodeName = pod.Spec.NodeName
+			r.observeMemberTermination(cluster, &member, pod)
+			if member.NodeDraining, err = r.isMemberNodeDraining(ctx, member.NodeName); err != nil {
+				return err
+			}
+		} else if !errors.IsNotFound(err) {
+			return fmt.Errorf("cannot get member pod %s: %w", name, err)
+		}
+
+		if cluster.Spec.Storage.EmptyDir == nil && !r.Namespaced {
+			member.PinnedNode, err = r.getPinnedNode(ctx, cluster.Namespace, memberPVCName(factory.GetPVCName(cluster), name))
+			if err != nil {
+				return err
+			}
+		}
+		if member.PinnedNode != "" {
+			err = r.Get(ctx, types.NamespacedName{Name: member.PinnedNode}, &corev1.Node{})
+			if errors.IsNotFound(err) {
+				member.PinnedNodeLost = true
+				lost = append(lost, name)
+			} else if err != nil {
+				return fmt.Errorf("cannot get node %s: %w", member.PinnedNode, err)
+			}
+		}
+		members = append(members, member)
+	}
+	cluster.Status.Members = members
+	cluster.Status.Quorum, cluster.Status.FaultTolerance = 0, 0
+	if *cluster.Spec.Replicas > 0 {
+		cluster.Status.Quorum = int32(cluster.CalculateQuorumSize())
+		cluster.Status.FaultTolerance = *cluster.Spec.Replicas - cluster.Status.Quorum
+	}
+
+	if cluster.Spec.Storage.EmptyDir != nil || r.Namespaced {
+		return nil
+	}
+	if len(lost) > 0 {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, string(etcdaenixiov1alpha1.EtcdCondTypePinnedNodeLost),
+			"Nodes holding data of members %s are gone, annotate the cluster with %s=<member> to replace a member",
+			strings.Join(lost, ", "), etcdaenixiov1alpha1.ReplaceMemberAnnotation)
+	}
+	reason := etcdaenixiov1alpha1.EtcdCondTypePinnedNodesAvailable
+	message := etcdaenixiov1alpha1.EtcdMemberNodeLostCondNegMessage
+	if len(lost) > 0 {
+		reason = etcdaenixiov1alpha1.EtcdCondTypePinnedNodeLost
+		message = etcdaenixiov1alpha1.EtcdMemberNodeLostCondPosMessage
+	}
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionMemberNodeLost).
+		WithStatus(len(lost) > 0).
+		WithReason(string(reason)).
+		WithMessage(string(message)).
+		Complete())
+	return nil
+}
+
+// isMemberNodeDraining checks if the node a member runs on is drained. Unscheduled members and removed nodes
+// are not considered drained.
+func (r *EtcdClusterReconciler) isMemberNodeDraining(ctx context.Context, nodeName string) (bool, error) {
+	if nodeName == "" || r.Namespaced {
+		return false, nil
+	}
+	node := &corev1.Node{}
+	if err := r.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("cannot get node %s: %w", nodeName, err)
+	}
+	return isNodeDraining(node), nil
+}
+
+// observeMemberTermination updates restart counters of the member from the etcd container status of its pod
+// and records an event for every termination not observed before.
+func (r *EtcdClusterReconciler) observeMemberTermination(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	member *etcdaenixiov1alpha1.MemberStatus,
+	pod *corev1.Pod,
+) {
+	idx := slices.IndexFunc(pod.Status.ContainerStatuses, func(c corev1.ContainerStatus) bool {
+		return c.Name == etcdContainerName
+	})
+	if idx == -1 {
+		return
+	}
+	status := pod.Status.ContainerStatuses[idx]
+	member.Restarts = status.RestartCount
+
+	terminated := status.LastTerminationState.Terminated
+	if terminated == nil || terminated.FinishedAt.IsZero() {
+		return
+	}
+	if member.LastTerminationTime != nil && !terminated.FinishedAt.After(member.LastTerminationTime.Time) {
+		return
+	}
+	member.LastTerminationReason = terminated.Reason
+	member.LastTerminationTime = terminated.FinishedAt.DeepCopy()
+	if terminated.Reason == oomKilledReason {
+		member.OOMKills++
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "MemberOOMKilled",
+			"Member %s was killed for running out of memory, restarts: %d, OOM kills: %d",
+			member.Name, member.Restarts, member.OOMKills)
+		return
+	}
+	r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "MemberTerminated",
+		"Member %s terminated with reason %s and exit code %d, restarts: %d",
+		member.Name, terminated.Reason, terminated.ExitCode, member.Restarts)
+}
+
+// getPinnedNode returns the node the volume bound to the claim is restricted to by its node affinity.
+// Empty string is returned if the claim does not exist or is not bound yet, which is expected for storage classes
+// with WaitForFirstConsumer binding mode until the pod is scheduled, or if the volume is accessible
+// from more than one node.
+func (r *EtcdClusterReconciler) getPinnedNode(ctx context.Context, namespace, claimName string) (string, error) {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: claimName}, pvc)
+	if err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	if pvc.Spec.VolumeName == "" {
+		return "", nil
+	}
+
+	pv := &corev1.PersistentVolume{}
+	if err = r.Get(ctx, types.NamespacedName{Name: pvc.Spec.VolumeName}, pv); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	return pinnedNodeFromAffinity(pv.Spec.NodeAffinity), nil
+}
+
+// pinnedNodeFromAffinity returns the node name if volume node affinity allows exactly one node by hostname.
+func pinnedNodeFromAffinity(affinity *corev1.VolumeNodeAffinity) string {
+	if affinity == nil || affinity.Required == nil || len(affinity.Required.NodeSelectorTerms) != 1 {
+		return ""
+	}
+	for _, expr := range affinity.Required.NodeSelectorTerms[0].MatchExpressions {
+		if expr.Key == corev1.LabelHostname && expr.Operator == corev1.NodeSelectorOpIn && len(expr.Values) == 1 {
+			return expr.Values[0]
+		}
+	}
+	return ""
+}
+
+// checkStorageClassBindingMode warns if local volumes are bound immediately. Such volumes are bound before
+// the pod is scheduled, ignoring pod scheduling constraints, so several members may end up on the same node
+// or on a node the pod cannot be scheduled to.
+func (r *EtcdClusterReconciler) checkStorageClassBindingMode(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	if cluster.Spec.Storage.EmptyDir != nil || r.Namespaced {
+		return nil
+	}
+	className := cluster.Spec.Storage.VolumeClaimTemplate.Spec.StorageClassName
+	if className == nil || *className == "" {
+		return nil
+	}
+	storageClass := &storagev1.StorageClass{}
+	if err := r.Get(ctx, types.NamespacedName{Name: *className}, storageClass); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if storageClass.Provisioner == localVolumeProvisioner &&
+		(storageClass.VolumeBindingMode == nil || *storageClass.VolumeBindingMode != storagev1.VolumeBindingWaitForFirstConsumer) {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "ImmediateVolumeBinding",
+			"StorageClass %s provides local volumes but does not use %s volume binding mode",
+			storageClass.Name, storagev1.VolumeBindingWaitForFirstConsumer)
+	}
+	return nil
+}
+
+// replaceMember handles the member replacement requested with ReplaceMemberAnnotation.
+// The member is re-registered in the cluster membership, its volumes and pod are deleted, so the StatefulSet
+// recreates them and the member joins the cluster with an empty data directory. The replacement waits while
+// the cluster is restored, and the annotation is removed once the member pod is deleted.
+func (r *EtcdClusterReconciler) replaceMember(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	memberName, ok := cluster.Annotations[etcdaenixiov1alpha1.ReplaceMemberAnnotation]
+	state := findWorkflow(cluster, factory.OperationReplaceMember)
+	if state != nil {
+		// the member is already disrupted, so its replacement is finished even if the annotation is removed
+		memberName, ok = state.Member, true
+	}
+	if !ok {
+		return r.releaseOperationLockWhenReady(ctx, cluster, factory.OperationReplaceMember)
+	}
+	logger := log.FromContext(ctx)
+
+	if state == nil && !slices.Contains(cluster.MemberNames(), memberName) {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "MemberReplacementFailed",
+			"Member %q does not exist in the cluster", memberName)
+		return r.removeReplaceMemberAnnotation(ctx, cluster)
+	}
+	// the annotation is kept until the replacement can start
+	if acquired, err := r.acquireOperationLock(ctx, cluster, factory.OperationReplaceMember); !acquired {
+		return err
+	}
+
+	if state == nil {
+		logger.Info("replacing member", "member", memberName)
+	}
+	done, err := r.runWorkflow(ctx, cluster, workflow{
+		operation: factory.OperationReplaceMember,
+		member:    memberName,
+		steps: []workflowStep{
+			r.resetMemberStep(cluster, memberName),
+			// pod pinned to the lost node can't be gracefully terminated, so it is deleted immediately
+			r.restartMemberStep(cluster, memberName, client.GracePeriodSeconds(0)),
+		},
+	})
+	if !done {
+		return err
+	}
+
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "MemberReplaced",
+		"Member %s is re-registered and its data is removed, it will rejoin the cluster", memberName)
+	if _, requested := cluster.Annotations[etcdaenixiov1alpha1.ReplaceMemberAnnotation]; !requested {
+		return nil
+	}
+	return r.removeReplaceMemberAnnotation(ctx, cluster)
+}
+
+// resetMember re-registers the member in the cluster membership and deletes its data volumes,
+// so the member rejoins the cluster with an empty data directory once its pod is recreated.
+func resetMember(ctx context.Context, rclient client.Client, cluster *etcdaenixiov1alpha1.EtcdCluster, memberName string) error {
+	cli, err := etcd.NewClusterClient(ctx, rclient, cluster)
+	if err != nil {
+		return fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	if err = etcd.ReplaceMember(ctx, cli, etcd.PeerURL(cluster, memberName)); err != nil {
+		return fmt.Errorf("cannot replace member %s: %w", memberName, err)
+	}
+
+	if cluster.Spec.Storage.EmptyDir != nil {
+		return nil
+	}
+	claims := []string{memberPVCName(factory.GetPVCName(cluster), memberName)}
+	if cluster.Spec.Storage.WALVolumeClaimTemplate != nil {
+		claims = append(claims, memberPVCName(factory.GetWALPVCName(cluster), memberName))
+	}
+	for _, claim := range claims {
+		pvc := &corev1.PersistentVolumeClaim{}
+		pvc.Namespace, pvc.Name = cluster.Namespace, claim
+		if err = rclient.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("cannot delete claim %s: %w", claim, err)
+		}
+	}
+	return nil
+}
+
+// removeReplaceMemberAnnotation removes ReplaceMemberAnnotation from the cluster.
+func (r *EtcdClusterReconciler) removeReplaceMemberAnnotation(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	// patching the cluster resets its status to the stored one
+	status := cluster.Status.DeepCopy()
+	patch := client.MergeFrom(cluster.DeepCopy())
+	delete(cluster.Annotations, etcdaenixiov1alpha1.ReplaceMemberAnnotation)
+	if err := r.Patch(ctx, cluster, patch); err != nil {
+		return fmt.Errorf("cannot remove %s annotation: %w", etcdaenixiov1alpha1.ReplaceMemberAnnotation, err)
+	}
+	applyDefaultBackupPolicy(ctx, cluster)
+	cluster.Status = *status
+	return nil
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+func hostnameAffinity(hosts ...string) *corev1.VolumeNodeAffinity {
+	return &corev1.VolumeNodeAffinity{
+		Required: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchExpressions: []corev1.NodeSelectorRequirement{{
+					Key:      corev1.LabelHostname,
+					Operator: corev1.NodeSelectorOpIn,
+					Values:   hosts,
+				}},
+			}},
+		},
+	}
+}
+
+var _ = Describe("EtcdCluster members", func() {
+	Context("When detecting pinned node of a volume", func() {
+		It("should return node of a local volume", func() {
+			Expect(pinnedNodeFromAffinity(hostnameAffinity("node-1"))).To(Equal("node-1"))
+		})
+
+		It("should not pin volume accessible from several nodes", func() {
+			Expect(pinnedNodeFromAffinity(hostnameAffinity("node-1", "node-2"))).To(BeEmpty())
+			Expect(pinnedNodeFromAffinity(nil)).To(BeEmpty())
+		})
+	})
+
+	Context("When observing member container terminations", func() {
+		var (
+			reconciler *EtcdClusterReconciler
+			recorder   *record.FakeRecorder
+			cluster    *etcdaenixiov1alpha1.EtcdCluster
+		)
+
+		terminatedPod := func(restarts int32, reason string, finishedAt time.Time) *corev1.Pod {
+			return &corev1.Pod{
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{{
+						Name:         etcdContainerName,
+						RestartCount: restarts,
+						LastTerminationState: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{
+								Reason:     reason,
+								ExitCode:   137,
+								FinishedAt: metav1.NewTime(finishedAt),
+							},
+						},
+					}},
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			recorder = record.NewFakeRecorder(10)
+			reconciler = &EtcdClusterReconciler{Recorder: recorder}
+			cluster = &etcdaenixiov1alpha1.EtcdCluster{}
+		})
+
+		It("should count OOM kills once per termination", func() {
+			member := &etcdaenixiov1alpha1.MemberStatus{Name: "test-0"}
+			finishedAt := time.Now().Truncate(time.Second)
+
+			reconciler.observeMemberTermination(cluster, member, terminatedPod(1, oomKilledReason, finishedAt))
+			Expect(member.Restarts).To(Equal(int32(1)))
+			Expect(member.OOMKills).To(Equal(int32(1)))
+			Expect(member.LastTerminationReason).To(Equal(oomKilledReason))
+			Expect(recorder.Events).To(Receive(ContainSubstring("MemberOOMKilled")))
+
+			reconciler.observeMemberTermination(cluster, member, terminatedPod(1, oomKilledReason, finishedAt))
+			Expect(member.OOMKills).To(Equal(int32(1)))
+			Expect(recorder.Events).ToNot(Receive())
+
+			reconciler.observeMemberTermination(cluster, member, terminatedPod(2, "Error", finishedAt.Add(time.Minute)))
+			Expect(member.Restarts).To(Equal(int32(2)))
+			Expect(member.OOMKills).To(Equal(int32(1)))
+			Expect(member.LastTerminationReason).To(Equal("Error"))
+			Expect(recorder.Events).To(Receive(ContainSubstring("MemberTerminated")))
+		})
+
+		It("should not report anything for a member that never terminated", func() {
+			member := &etcdaenixiov1alpha1.MemberStatus{Name: "test-0"}
+			pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: etcdContainerName}}}}
+			reconciler.observeMemberTermination(cluster, member, pod)
+			Expect(member.Restarts).To(BeZero())
+			Expect(member.LastTerminationTime).To(BeNil())
+			Expect(recorder.Events).ToNot(Receive())
+		})
+	})
+
+	Context("When the operator is namespaced", func() {
+		It("should never access cluster-scoped resources", func(ctx SpecContext) {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Replicas: ptr.To(int32(1)),
+					Storage: etcdaenixiov1alpha1.StorageSpec{
+						VolumeClaimTemplate: etcdaenixiov1alpha1.EmbeddedPersistentVolumeClaim{
+							Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: ptr.To("local")},
+						},
+					},
+				},
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-0"},
+				Spec:       corev1.PodSpec{NodeName: "node"},
+			}
+			pvc := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: memberPVCName(factory.GetPVCName(cluster), "test-0")},
+				Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv"},
+			}
+			reconciler := &EtcdClusterReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(pod, pvc).
+					WithInterceptorFuncs(interceptor.Funcs{
+						Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+							if key.Namespace == "" {
+								return fmt.Errorf("cluster-scoped %T %s is accessed", obj, key.Name)
+							}
+							return c.Get(ctx, key, obj, opts...)
+						},
+					}).Build(),
+				Scheme:     scheme,
+				Recorder:   record.NewFakeRecorder(10),
+				Namespaced: true,
+			}
+
+			Expect(reconciler.checkStorageClassBindingMode(ctx, cluster)).To(Succeed())
+			Expect(reconciler.updateMembersStatus(ctx, cluster)).To(Succeed())
+			Expect(cluster.Status.Members).To(HaveLen(1))
+			Expect(cluster.Status.Members[0].NodeName).To(Equal("node"))
+			Expect(cluster.Status.Members[0].PinnedNode).To(BeEmpty())
+			Expect(cluster.Status.Quorum).To(Equal(int32(1)))
+			Expect(cluster.Status.FaultTolerance).To(BeZero())
+			Expect(factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionMemberNodeLost)).To(BeNil())
+		})
+	})
+
+	Context("When member volume is pinned to a node", func() {
+		var (
+			reconciler  *EtcdClusterReconciler
+			ns          *corev1.Namespace
+			etcdcluster etcdaenixiov1alpha1.EtcdCluster
+			node        corev1.Node
+		)
+
+		BeforeEach(func(ctx SpecContext) {
+			reconciler = &EtcdClusterReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+			}
+			ns = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "test-"}}
+			Expect(k8sClient.Create(ctx, ns)).Should(Succeed())
+			DeferCleanup(k8sClient.Delete, ns)
+
+			etcdcluster = etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "test-etcdcluster-",
+					Namespace:    ns.GetName(),
+				},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Replicas: ptr.To(int32(1)),
+					Storage: etcdaenixiov1alpha1.StorageSpec{
+						VolumeClaimTemplate: etcdaenixiov1alpha1.EmbeddedPersistentVolumeClaim{
+							Spec: corev1.PersistentVolumeClaimSpec{
+								AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+								Resources: corev1.VolumeResourceRequirements{
+									Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+								},
+							},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, &etcdcluster)).Should(Succeed())
+			DeferCleanup(k8sClient.Delete, &etcdcluster)
+
+			node = corev1.Node{ObjectMeta: metav1.ObjectMeta{GenerateName: "node-"}}
+			Expect(k8sClient.Create(ctx, &node)).Should(Succeed())
+			DeferCleanup(func(ctx SpecContext) {
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, &node))).To(Succeed())
+			})
+
+			pv := &corev1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{GenerateName: "local-pv-"},
+				Spec: corev1.PersistentVolumeSpec{
+					Capacity:    corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						Local: &corev1.LocalVolumeSource{Path: "/mnt/etcd"},
+					},
+					NodeAffinity: hostnameAffinity(node.Name),
+				},
+			}
+			Expect(k8sClient.Create(ctx, pv)).Should(Succeed())
+			DeferCleanup(k8sClient.Delete, pv)
+
+			pvc := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ns.GetName(),
+					Name:      memberPVCName(factory.GetPVCName(&etcdcluster), etcdcluster.Name+"-0"),
+				},
+				Spec: *etcdcluster.Spec.Storage.VolumeClaimTemplate.Spec.DeepCopy(),
+			}
+			pvc.Spec.VolumeName = pv.Name
+			Expect(k8sClient.Create(ctx, pvc)).Should(Succeed())
+			DeferCleanup(k8sClient.Delete, pvc)
+		})
+
+		It("should report pinned node and detect its loss", func(ctx SpecContext) {
+			By("reconciling with available node", func() {
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&etcdcluster)})
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(Get(&etcdcluster)).Should(Succeed())
+				Expect(etcdcluster.Status.Members).To(HaveLen(1))
+				Expect(etcdcluster.Status.Members[0].PinnedNode).To(Equal(node.Name))
+				Expect(etcdcluster.Status.Members[0].PinnedNodeLost).To(BeFalse())
+				cond := factory.GetCondition(&etcdcluster, etcdaenixiov1alpha1.EtcdConditionMemberNodeLost)
+				Expect(cond).ToNot(BeNil())
+				Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			})
+
+			By("reconciling after node is deleted", func() {
+				Expect(k8sClient.Delete(ctx, &node)).Should(Succeed())
+				_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&etcdcluster)})
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(Get(&etcdcluster)).Should(Succeed())
+				Expect(etcdcluster.Status.Members[0].PinnedNodeLost).To(BeTrue())
+				cond := factory.GetCondition(&etcdcluster, etcdaenixiov1alpha1.EtcdConditionMemberNodeLost)
+				Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+				Expect(cond.Reason).To(Equal(string(etcdaenixiov1alpha1.EtcdCondTypePinnedNodeLost)))
+			})
+		})
+
+		It("should drop replacement request for unknown member", func(ctx SpecContext) {
+			Eventually(Object(&etcdcluster)).Should(Not(BeNil()))
+			patch := client.MergeFrom(etcdcluster.DeepCopy())
+			etcdcluster.Annotations = map[string]string{etcdaenixiov1alpha1.ReplaceMemberAnnotation: "unknown"}
+			Expect(k8sClient.Patch(ctx, &etcdcluster, patch)).Should(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&etcdcluster)})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(Get(&etcdcluster)).Should(Succeed())
+			Expect(etcdcluster.Annotations).ToNot(HaveKey(etcdaenixiov1alpha1.ReplaceMemberAnnotation))
+		})
+	})
+})
@@ -0,0 +1,145 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+const (
+	// partitionCheckInterval is how often peer metrics of members are sampled to detect half-open partitions.
+	// It is longer than the interval members probe their peers with, so working links always have new probes.
+	partitionCheckInterval = 30 * time.Second
+	metricsTimeout         = 2 * time.Second
+)
+
+var metricsClient = &http.Client{Timeout: metricsTimeout}
+
+// peerMetricsSample is peer metrics of all reachable members of a cluster taken at the same time.
+type peerMetricsSample struct {
+	takenAt time.Time
+	members map[string]etcd.PeerMetrics
+}
+
+// reconcilePartition samples peer metrics of members and compares them with the previous sample. If some peer links
+// stopped working while the opposite direction still works, NetworkPartitionSuspected condition is set with
+// the links involved. It returns time after which the next sample has to be taken.
+func (r *EtcdClusterReconciler) reconcilePartition(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	key := client.ObjectKeyFromObject(cluster).String()
+	interval := cluster.ProbeInterval(partitionCheckInterval)
+	var previous peerMetricsSample
+	if value, ok := r.peerMetrics.Load(key); ok {
+		previous = value.(peerMetricsSample)
+		if next := interval - time.Since(previous.takenAt); next > 0 {
+			return next, nil
+		}
+	}
+
+	current := peerMetricsSample{takenAt: time.Now(), members: map[string]etcd.PeerMetrics{}}
+	for _, name := range cluster.MemberNames() {
+		var metrics etcd.PeerMetrics
+		err := etcd.Probe(ctx, func(ctx context.Context) (err error) {
+			metrics, err = etcd.GetPeerMetrics(ctx, metricsClient, etcd.MetricsURL(cluster, name))
+			return err
+		})
+		if err != nil {
+			log.FromContext(ctx).V(2).Info("cannot get member metrics", "member", name, "reason", err.Error())
+			continue
+		}
+		current.members[name] = metrics
+	}
+	r.peerMetrics.Store(key, current)
+	if len(previous.members) == 0 || len(current.members) < 2 {
+		return interval, nil
+	}
+
+	ids, err := r.memberIDs(ctx, cluster)
+	if err != nil || ids == nil {
+		return interval, err
+	}
+	links := etcd.HalfOpenLinks(previous.members, current.members, ids)
+	failed := etcd.FailedProposals(previous.members, current.members)
+	setPartitionCondition(cluster, links, failed)
+	if len(links) > 0 {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, string(etcdaenixiov1alpha1.EtcdCondTypeHalfOpenPeerLinks),
+			"%s", partitionMessage(links, failed))
+	}
+	return interval, nil
+}
+
+// memberIDs returns IDs of cluster members keyed by member names.
+func (r *EtcdClusterReconciler) memberIDs(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (map[string]string, error) {
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	ctx, cancel := context.WithTimeout(ctx, metricsTimeout)
+	defer cancel()
+	members, err := etcd.ListMembers(ctx, cli)
+	if err != nil {
+		// membership is not available without quorum, keep the condition until it is
+		log.FromContext(ctx).V(2).Info("cannot list members", "reason", err.Error())
+		return nil, nil
+	}
+	ids := make(map[string]string, len(members))
+	for _, m := range members {
+		ids[m.Name] = m.ID
+	}
+	return ids, nil
+}
+
+func setPartitionCondition(cluster *etcdaenixiov1alpha1.EtcdCluster, links []etcd.PeerLink, failedProposals float64) {
+	reason := etcdaenixiov1alpha1.EtcdCondTypePeerLinksHealthy
+	message := string(etcdaenixiov1alpha1.EtcdPartitionCondNegMessage)
+	if len(links) > 0 {
+		reason = etcdaenixiov1alpha1.EtcdCondTypeHalfOpenPeerLinks
+		message = partitionMessage(links, failedProposals)
+	}
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionNetworkPartitionSuspected).
+		WithStatus(len(links) > 0).
+		WithReason(string(reason)).
+		WithMessage(message).
+		Complete())
+}
+
+// partitionMessage describes half-open links and failed proposals correlated with them.
+func partitionMessage(links []etcd.PeerLink, failedProposals float64) string {
+	descriptions := make([]string, 0, len(links))
+	for _, link := range links {
+		descriptions = append(descriptions, link.String())
+	}
+	message := fmt.Sprintf("Peer links %s are broken while the opposite directions work", strings.Join(descriptions, ", "))
+	if failedProposals > 0 {
+		message += fmt.Sprintf(", %.0f proposals failed", failedProposals)
+	}
+	return message
+}
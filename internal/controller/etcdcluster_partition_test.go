@@ -0,0 +1,78 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+var _ = Describe("EtcdCluster network partition detection", func() {
+	const metrics = `# TYPE etcd_network_peer_round_trip_time_seconds histogram
+etcd_network_peer_round_trip_time_seconds_bucket{To="b",le="+Inf"} 7
+etcd_network_peer_round_trip_time_seconds_sum{To="b"} 0.01
+etcd_network_peer_round_trip_time_seconds_count{To="b"} 7
+# TYPE etcd_network_peer_sent_failures_total counter
+etcd_network_peer_sent_failures_total{To="b"} 3
+# TYPE etcd_server_proposals_failed_total counter
+etcd_server_proposals_failed_total 2
+`
+	ids := map[string]string{"test-0": "a", "test-1": "b"}
+	sample := func(roundTrips uint64, failures float64) etcd.PeerMetrics {
+		return etcd.PeerMetrics{RoundTrips: map[string]uint64{"a": roundTrips, "b": roundTrips},
+			SentFailures: map[string]float64{"a": failures, "b": failures}}
+	}
+
+	It("should parse peer metrics of a member", func() {
+		m, err := etcd.ParsePeerMetrics(strings.NewReader(metrics))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.RoundTrips).To(HaveKeyWithValue("b", uint64(7)))
+		Expect(m.SentFailures).To(HaveKeyWithValue("b", float64(3)))
+		Expect(m.ProposalsFailed).To(Equal(float64(2)))
+	})
+
+	It("should report links broken in one direction only", func() {
+		previous := map[string]etcd.PeerMetrics{"test-0": sample(1, 0), "test-1": sample(1, 0)}
+		current := map[string]etcd.PeerMetrics{"test-0": sample(2, 1), "test-1": sample(2, 0)}
+		Expect(etcd.HalfOpenLinks(previous, current, ids)).To(Equal([]etcd.PeerLink{{From: "test-0", To: "test-1"}}))
+
+		// both directions are broken, it is a full partition
+		current = map[string]etcd.PeerMetrics{"test-0": sample(1, 0), "test-1": sample(1, 0)}
+		Expect(etcd.HalfOpenLinks(previous, current, ids)).To(BeEmpty())
+	})
+
+	It("should set the condition with the links", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+		setPartitionCondition(cluster, []etcd.PeerLink{{From: "test-0", To: "test-1"}}, 3)
+		cond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionNetworkPartitionSuspected)
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(string(etcdaenixiov1alpha1.EtcdCondTypeHalfOpenPeerLinks)))
+		Expect(cond.Message).To(ContainSubstring("test-0 -> test-1"))
+		Expect(cond.Message).To(ContainSubstring("3 proposals failed"))
+
+		setPartitionCondition(cluster, nil, 0)
+		cond = factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionNetworkPartitionSuspected)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+	})
+})
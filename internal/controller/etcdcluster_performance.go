@@ -0,0 +1,197 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// performanceCheckInterval is how often performance metrics of members are sampled. Latencies, leader changes
+// and failed proposals are evaluated over the time between two samples.
+const performanceCheckInterval = 30 * time.Second
+
+// slowRequestEventInterval is the minimum time between events about slow requests of a cluster with the same reason,
+// so a cluster with a slow disk does not flood the events.
+const slowRequestEventInterval = 10 * time.Minute
+
+const (
+	slowApplyEventReason     = "SlowApply"
+	slowFdatasyncEventReason = "SlowFdatasync"
+)
+
+// performanceSample is performance metrics of all reachable members of a cluster taken at the same time.
+type performanceSample struct {
+	takenAt time.Time
+	members map[string]etcd.PerformanceMetrics
+	// eventsAt is when events about slow requests were last recorded keyed by their reasons.
+	eventsAt map[string]time.Time
+}
+
+// reconcilePerformance samples performance metrics of members and compares them with the previous sample.
+// If disks of some members are slow, or leader changes or failed proposals are seen, PerformanceDegraded condition
+// is set with the members involved, which pauses rollouts and member rotations. It returns time after which
+// the next sample has to be taken.
+func (r *EtcdClusterReconciler) reconcilePerformance(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	key := client.ObjectKeyFromObject(cluster).String()
+	interval := cluster.ProbeInterval(performanceCheckInterval)
+	var previous performanceSample
+	if value, ok := r.performanceMetrics.Load(key); ok {
+		previous = value.(performanceSample)
+		if next := interval - time.Since(previous.takenAt); next > 0 {
+			return next, nil
+		}
+	}
+
+	current := performanceSample{takenAt: time.Now(), members: map[string]etcd.PerformanceMetrics{},
+		eventsAt: map[string]time.Time{}}
+	for reason, at := range previous.eventsAt {
+		current.eventsAt[reason] = at
+	}
+	for _, name := range cluster.MemberNames() {
+		var metrics etcd.PerformanceMetrics
+		err := etcd.Probe(ctx, func(ctx context.Context) (err error) {
+			metrics, err = etcd.GetPerformanceMetrics(ctx, metricsClient, etcd.MetricsURL(cluster, name))
+			return err
+		})
+		if err != nil {
+			log.FromContext(ctx).V(2).Info("cannot get member metrics", "member", name, "reason", err.Error())
+			continue
+		}
+		current.members[name] = metrics
+	}
+	r.performanceMetrics.Store(key, current)
+	if len(previous.members) == 0 {
+		return interval, nil
+	}
+
+	for reason, message := range slowRequestEvents(previous.members, current.members) {
+		if current.takenAt.Sub(current.eventsAt[reason]) < slowRequestEventInterval {
+			continue
+		}
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, reason, "%s", message)
+		current.eventsAt[reason] = current.takenAt
+	}
+
+	problems := performanceProblems(previous.members, current.members)
+	wasDegraded := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionPerformanceDegraded)
+	setPerformanceCondition(cluster, problems)
+	if len(problems) > 0 && (wasDegraded == nil || wasDegraded.Status != metav1.ConditionTrue) {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, string(etcdaenixiov1alpha1.EtcdCondTypePerformanceDegraded),
+			"%s", performanceMessage(problems))
+	}
+	return interval, nil
+}
+
+// performanceProblems returns performance problems of members present in both samples keyed by member names.
+func performanceProblems(previous, current map[string]etcd.PerformanceMetrics) map[string][]string {
+	problems := map[string][]string{}
+	for name, cur := range current {
+		prev, ok := previous[name]
+		if !ok {
+			continue
+		}
+		if p := etcd.ComparePerformance(prev, cur).Problems(); len(p) > 0 {
+			problems[name] = p
+		}
+	}
+	return problems
+}
+
+// slowRequestEvents returns messages of events about requests which took too long to apply and slow WAL fsyncs
+// of members present in both samples keyed by event reasons.
+func slowRequestEvents(previous, current map[string]etcd.PerformanceMetrics) map[string]string {
+	var applies, fdatasyncs []string
+	for _, name := range sortedKeys(current) {
+		prev, ok := previous[name]
+		if !ok {
+			continue
+		}
+		perf := etcd.ComparePerformance(prev, current[name])
+		if perf.SlowApplies > 0 {
+			applies = append(applies, fmt.Sprintf("%s (%.0f)", name, perf.SlowApplies))
+		}
+		if perf.SlowFdatasyncs > 0 {
+			fdatasyncs = append(fdatasyncs, fmt.Sprintf("%s (%d)", name, perf.SlowFdatasyncs))
+		}
+	}
+	events := map[string]string{}
+	if len(applies) > 0 {
+		events[slowApplyEventReason] = "Requests took too long to apply on members " + strings.Join(applies, ", ") +
+			", the disk or CPU of the members is too slow"
+	}
+	if len(fdatasyncs) > 0 {
+		events[slowFdatasyncEventReason] = fmt.Sprintf("WAL fsyncs took longer than %s on members %s, "+
+			"the disk of the members is too slow", etcd.SlowFdatasync, strings.Join(fdatasyncs, ", "))
+	}
+	return events
+}
+
+func setPerformanceCondition(cluster *etcdaenixiov1alpha1.EtcdCluster, problems map[string][]string) {
+	reason := etcdaenixiov1alpha1.EtcdCondTypePerformanceNormal
+	message := string(etcdaenixiov1alpha1.EtcdPerformanceCondNegMessage)
+	if len(problems) > 0 {
+		reason = etcdaenixiov1alpha1.EtcdCondTypePerformanceDegraded
+		message = performanceMessage(problems)
+	}
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionPerformanceDegraded).
+		WithStatus(len(problems) > 0).
+		WithReason(string(reason)).
+		WithMessage(message).
+		Complete())
+}
+
+// performanceMessage describes performance problems of members.
+func performanceMessage(problems map[string][]string) string {
+	names := sortedKeys(problems)
+	descriptions := make([]string, 0, len(names))
+	for _, name := range names {
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s", name, strings.Join(problems[name], ", ")))
+	}
+	return "Performance of members is degraded: " + strings.Join(descriptions, "; ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// performanceGate returns why disruptive operations have to wait for the performance of members to recover,
+// or an empty string if they may go on.
+func performanceGate(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	cond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionPerformanceDegraded)
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		return ""
+	}
+	return cond.Message
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"math"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+var _ = Describe("EtcdCluster member performance", func() {
+	const metrics = `# TYPE etcd_disk_wal_fsync_duration_seconds histogram
+etcd_disk_wal_fsync_duration_seconds_bucket{le="0.001"} 90
+etcd_disk_wal_fsync_duration_seconds_bucket{le="0.1"} 100
+etcd_disk_wal_fsync_duration_seconds_bucket{le="+Inf"} 100
+etcd_disk_wal_fsync_duration_seconds_sum 0.5
+etcd_disk_wal_fsync_duration_seconds_count 100
+# TYPE etcd_server_leader_changes_seen_total counter
+etcd_server_leader_changes_seen_total 2
+# TYPE etcd_server_proposals_failed_total counter
+etcd_server_proposals_failed_total 1
+`
+	bounds := []float64{0.001, 0.1, math.Inf(1)}
+	fast := etcd.Histogram{UpperBounds: bounds, Counts: []uint64{10, 10, 10}}
+	slow := etcd.Histogram{UpperBounds: bounds, Counts: []uint64{10, 20, 20}}
+
+	It("should parse performance metrics of a member", func() {
+		m, err := etcd.ParsePerformanceMetrics(strings.NewReader(metrics))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.WALFsync.Counts).To(Equal([]uint64{90, 100, 100}))
+		Expect(m.LeaderChanges).To(Equal(float64(2)))
+		Expect(m.ProposalsFailed).To(Equal(float64(1)))
+	})
+
+	It("should report latencies observed between samples only", func() {
+		previous := map[string]etcd.PerformanceMetrics{"test-0": {WALFsync: fast}, "test-1": {WALFsync: fast}}
+		current := map[string]etcd.PerformanceMetrics{"test-0": {WALFsync: slow}, "test-1": {WALFsync: fast, LeaderChanges: 1}}
+		problems := performanceProblems(previous, current)
+		Expect(problems).To(HaveLen(2))
+		Expect(problems["test-0"]).To(ConsistOf(ContainSubstring("WAL fsync p99")))
+		Expect(problems["test-1"]).To(ConsistOf(ContainSubstring("1 leader changes")))
+
+		Expect(performanceProblems(current, current)).To(BeEmpty())
+	})
+
+	It("should describe slow applies and fdatasyncs of members", func() {
+		bounds := []float64{0.001, 0.512, 1.024, math.Inf(1)}
+		previous := map[string]etcd.PerformanceMetrics{
+			"test-0": {WALFsync: etcd.Histogram{UpperBounds: bounds, Counts: []uint64{10, 10, 10, 10}}, SlowApplies: 1},
+			"test-1": {SlowApplies: 1},
+		}
+		current := map[string]etcd.PerformanceMetrics{
+			"test-0": {WALFsync: etcd.Histogram{UpperBounds: bounds, Counts: []uint64{10, 10, 11, 13}}, SlowApplies: 1},
+			"test-1": {SlowApplies: 4},
+			"test-2": {SlowApplies: 7},
+		}
+		events := slowRequestEvents(previous, current)
+		Expect(events).To(HaveKeyWithValue(slowApplyEventReason, ContainSubstring("members test-1 (3),")))
+		Expect(events).To(HaveKeyWithValue(slowFdatasyncEventReason, ContainSubstring("members test-0 (2),")))
+
+		Expect(slowRequestEvents(current, current)).To(BeEmpty())
+	})
+
+	It("should pause disruptive operations while performance is degraded", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+		Expect(performanceGate(cluster)).To(BeEmpty())
+
+		setPerformanceCondition(cluster, map[string][]string{"test-1": {"2 proposals failed"}})
+		cond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionPerformanceDegraded)
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(string(etcdaenixiov1alpha1.EtcdCondTypePerformanceDegraded)))
+		Expect(performanceGate(cluster)).To(ContainSubstring("test-1: 2 proposals failed"))
+
+		setPerformanceCondition(cluster, nil)
+		Expect(performanceGate(cluster)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,255 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// defragmentationMaxAge is the age of the last successful defragmentation after which it is not recent anymore.
+const defragmentationMaxAge = 30 * 24 * time.Hour
+
+// reconcileProductionReadiness evaluates the cluster against the production checklist and publishes the scored
+// report in status.
+func (r *EtcdClusterReconciler) reconcileProductionReadiness(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	zones, err := r.memberZones(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	lastDefragmentation, err := r.lastDefragmentation(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	cluster.Status.ProductionReadiness = evaluateProductionReadiness(cluster, zones, lastDefragmentation, time.Now())
+	return nil
+}
+
+// memberZones returns zones of nodes members run on keyed by member names. Members which are not scheduled
+// or run on nodes without a zone have an empty zone. It returns nil if nodes can't be read in namespaced mode.
+func (r *EtcdClusterReconciler) memberZones(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (map[string]string, error) {
+	if r.Namespaced {
+		return nil, nil
+	}
+	zones := map[string]string{}
+	for _, member := range cluster.Status.Members {
+		zones[member.Name] = ""
+		if member.NodeName == "" {
+			continue
+		}
+		node := &corev1.Node{}
+		if err := r.Get(ctx, types.NamespacedName{Name: member.NodeName}, node); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("cannot get node %s: %w", member.NodeName, err)
+		}
+		zones[member.Name] = node.Labels[corev1.LabelTopologyZone]
+	}
+	return zones, nil
+}
+
+// lastDefragmentation returns the completion time of the last successful Defragment operation of the cluster.
+func (r *EtcdClusterReconciler) lastDefragmentation(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (*time.Time, error) {
+	operations := &etcdaenixiov1alpha1.EtcdOperationList{}
+	if err := r.List(ctx, operations, client.InNamespace(cluster.Namespace)); err != nil {
+		return nil, fmt.Errorf("cannot list operations: %w", err)
+	}
+	var last *time.Time
+	for _, operation := range operations.Items {
+		if operation.Spec.Cluster.Name != cluster.Name || operation.Spec.Type != etcdaenixiov1alpha1.EtcdOperationDefragment ||
+			operation.Status.Phase != etcdaenixiov1alpha1.EtcdOperationPhaseSucceeded || operation.Status.CompletionTime == nil {
+			continue
+		}
+		if completed := operation.Status.CompletionTime.Time; last == nil || completed.After(*last) {
+			last = &completed
+		}
+	}
+	return last, nil
+}
+
+// evaluateProductionReadiness checks the cluster against every item of the production checklist.
+func evaluateProductionReadiness(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	zones map[string]string,
+	lastDefragmentation *time.Time,
+	now time.Time,
+) *etcdaenixiov1alpha1.ProductionReadinessReport {
+	checks := []etcdaenixiov1alpha1.ProductionReadinessCheck{
+		checkOddReplicas(cluster),
+		checkMultiZone(cluster, zones),
+		checkTLS(cluster),
+		checkFreshBackups(cluster, now),
+		checkResources(cluster),
+		checkBackendQuota(cluster),
+		checkRecentDefragmentation(lastDefragmentation, now),
+	}
+	passed := 0
+	for _, check := range checks {
+		if check.Passed {
+			passed++
+		}
+	}
+	return &etcdaenixiov1alpha1.ProductionReadinessReport{
+		Score:  int32(passed * 100 / len(checks)),
+		Checks: checks,
+	}
+}
+
+func productionCheck(name etcdaenixiov1alpha1.ProductionReadinessCheckName, passed bool, format string, args ...any) etcdaenixiov1alpha1.ProductionReadinessCheck {
+	return etcdaenixiov1alpha1.ProductionReadinessCheck{Name: name, Passed: passed, Message: fmt.Sprintf(format, args...)}
+}
+
+func checkOddReplicas(cluster *etcdaenixiov1alpha1.EtcdCluster) etcdaenixiov1alpha1.ProductionReadinessCheck {
+	replicas := int32(0)
+	if cluster.Spec.Replicas != nil {
+		replicas = *cluster.Spec.Replicas
+	}
+	if replicas < 3 || replicas%2 == 0 {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckOddReplicas, false,
+			"Cluster has %d members, an odd number of 3 or more tolerates member failures best", replicas)
+	}
+	return productionCheck(etcdaenixiov1alpha1.ProductionCheckOddReplicas, true, "Cluster has %d members", replicas)
+}
+
+func checkMultiZone(cluster *etcdaenixiov1alpha1.EtcdCluster, zones map[string]string) etcdaenixiov1alpha1.ProductionReadinessCheck {
+	if zones == nil {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckMultiZone, false,
+			"Zones of members are unknown, nodes can't be read in namespaced mode")
+	}
+	perZone := map[string]int{}
+	for _, zone := range zones {
+		perZone[zone]++
+	}
+	if n := perZone[""]; n > 0 {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckMultiZone, false,
+			"Zones of %d members are unknown, they are not scheduled or nodes have no %s label", n, corev1.LabelTopologyZone)
+	}
+	descriptions := make([]string, 0, len(perZone))
+	largest := 0
+	for _, zone := range sortedKeys(perZone) {
+		descriptions = append(descriptions, zone+": "+strconv.Itoa(perZone[zone]))
+		largest = max(largest, perZone[zone])
+	}
+	spread := strings.Join(descriptions, ", ")
+	if len(zones)-largest < cluster.CalculateQuorumSize() {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckMultiZone, false,
+			"Members run in zones %s, an outage of a zone loses the quorum", spread)
+	}
+	return productionCheck(etcdaenixiov1alpha1.ProductionCheckMultiZone, true, "Members run in zones %s", spread)
+}
+
+func checkTLS(cluster *etcdaenixiov1alpha1.EtcdCluster) etcdaenixiov1alpha1.ProductionReadinessCheck {
+	var tls etcdaenixiov1alpha1.TLSSpec
+	if cluster.Spec.Security != nil {
+		tls = cluster.Spec.Security.TLS
+	}
+	var missing []string
+	if tls.PeerSecret == "" {
+		missing = append(missing, "peer certificates")
+	}
+	if tls.ServerSecret == "" {
+		missing = append(missing, "server certificate")
+	}
+	if tls.ClientSecret == "" {
+		missing = append(missing, "client certificate authentication")
+	}
+	if len(missing) > 0 {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckTLS, false, "TLS is not configured: %s", strings.Join(missing, ", "))
+	}
+	return productionCheck(etcdaenixiov1alpha1.ProductionCheckTLS, true, "Peer and client traffic is encrypted")
+}
+
+func checkFreshBackups(cluster *etcdaenixiov1alpha1.EtcdCluster, now time.Time) etcdaenixiov1alpha1.ProductionReadinessCheck {
+	backup := cluster.Spec.Backup
+	if backup == nil {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckFreshBackups, false, "Periodic snapshots are disabled")
+	}
+	if cluster.Status.Backup == nil || cluster.Status.Backup.LastSnapshotTime == nil {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckFreshBackups, false, "No snapshot is taken yet")
+	}
+	// messages carry times rather than ages, so the report doesn't change with every reconciliation
+	taken := cluster.Status.Backup.LastSnapshotTime.UTC()
+	interval := backup.Interval.Duration
+	if interval == 0 {
+		interval = etcdaenixiov1alpha1.DefaultBackupInterval
+	}
+	if now.Sub(taken) > 2*interval {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckFreshBackups, false,
+			"Last snapshot was taken at %s, snapshots are taken every %s", taken.Format(time.RFC3339), interval)
+	}
+	return productionCheck(etcdaenixiov1alpha1.ProductionCheckFreshBackups, true,
+		"Last snapshot was taken at %s", taken.Format(time.RFC3339))
+}
+
+func checkResources(cluster *etcdaenixiov1alpha1.EtcdCluster) etcdaenixiov1alpha1.ProductionReadinessCheck {
+	var resources corev1.ResourceRequirements
+	if idx := slices.IndexFunc(cluster.Spec.PodTemplate.Spec.Containers, func(c corev1.Container) bool {
+		return c.Name == "etcd"
+	}); idx != -1 {
+		resources = cluster.Spec.PodTemplate.Spec.Containers[idx].Resources
+	}
+	var missing []string
+	if resources.Requests.Cpu().IsZero() {
+		missing = append(missing, "CPU request")
+	}
+	if resources.Requests.Memory().IsZero() {
+		missing = append(missing, "memory request")
+	}
+	if resources.Limits.Memory().IsZero() {
+		missing = append(missing, "memory limit")
+	}
+	if len(missing) > 0 {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckResources, false,
+			"etcd container has no %s", strings.Join(missing, ", "))
+	}
+	return productionCheck(etcdaenixiov1alpha1.ProductionCheckResources, true, "etcd container has resources set")
+}
+
+func checkBackendQuota(cluster *etcdaenixiov1alpha1.EtcdCluster) etcdaenixiov1alpha1.ProductionReadinessCheck {
+	quota, ok := cluster.Spec.Options["quota-backend-bytes"]
+	if !ok {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckBackendQuota, false,
+			"Backend quota is not set, etcd defaults to 2GiB")
+	}
+	return productionCheck(etcdaenixiov1alpha1.ProductionCheckBackendQuota, true, "Backend quota is %s bytes", quota)
+}
+
+func checkRecentDefragmentation(last *time.Time, now time.Time) etcdaenixiov1alpha1.ProductionReadinessCheck {
+	if last == nil {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckRecentDefragmentation, false,
+			"Cluster was never defragmented by a Defragment operation")
+	}
+	completed := last.UTC().Format(time.RFC3339)
+	if now.Sub(*last) > defragmentationMaxAge {
+		return productionCheck(etcdaenixiov1alpha1.ProductionCheckRecentDefragmentation, false,
+			"Last defragmentation completed at %s, more than %s ago", completed, defragmentationMaxAge)
+	}
+	return productionCheck(etcdaenixiov1alpha1.ProductionCheckRecentDefragmentation, true,
+		"Last defragmentation completed at %s", completed)
+}
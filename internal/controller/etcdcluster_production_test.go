@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("EtcdCluster production readiness", func() {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	It("should score a cluster passing every check", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(3)),
+				Options:  map[string]string{"quota-backend-bytes": "8589934592"},
+				Security: &etcdaenixiov1alpha1.SecuritySpec{TLS: etcdaenixiov1alpha1.TLSSpec{
+					PeerSecret: "peer", ServerSecret: "server", ClientSecret: "client",
+				}},
+				Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{Interval: metav1.Duration{Duration: time.Hour}},
+				PodTemplate: etcdaenixiov1alpha1.PodTemplate{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "etcd",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("1"),
+								corev1.ResourceMemory: resource.MustParse("2Gi"),
+							},
+							Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+						},
+					}},
+				}},
+			},
+			Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupStatus{LastSnapshotTime: ptr.To(metav1.NewTime(now.Add(-time.Hour)))},
+			},
+		}
+		zones := map[string]string{"test-0": "a", "test-1": "b", "test-2": "c"}
+		defragmented := now.Add(-24 * time.Hour)
+
+		report := evaluateProductionReadiness(cluster, zones, &defragmented, now)
+		Expect(report.Score).To(Equal(int32(100)))
+		Expect(report.Checks).To(HaveLen(7))
+	})
+
+	It("should report failed checks of a default cluster", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(2))},
+		}
+
+		report := evaluateProductionReadiness(cluster, nil, nil, now)
+		Expect(report.Score).To(BeZero())
+		for _, check := range report.Checks {
+			Expect(check.Passed).To(BeFalse(), string(check.Name))
+		}
+	})
+
+	It("should fail when a zone outage loses the quorum", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(3))},
+		}
+
+		check := checkMultiZone(cluster, map[string]string{"test-0": "a", "test-1": "a", "test-2": "b"})
+		Expect(check.Passed).To(BeFalse())
+		Expect(check.Message).To(Equal("Members run in zones a: 2, b: 1, an outage of a zone loses the quorum"))
+
+		check = checkMultiZone(cluster, map[string]string{"test-0": "a", "test-1": "b", "test-2": ""})
+		Expect(check.Passed).To(BeFalse())
+		Expect(check.Message).To(ContainSubstring("Zones of 1 members are unknown"))
+	})
+
+	It("should fail when the last snapshot is older than two intervals", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{Interval: metav1.Duration{Duration: time.Hour}},
+			},
+			Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupStatus{LastSnapshotTime: ptr.To(metav1.NewTime(now.Add(-3 * time.Hour)))},
+			},
+		}
+
+		check := checkFreshBackups(cluster, now)
+		Expect(check.Passed).To(BeFalse())
+		Expect(check.Message).To(Equal("Last snapshot was taken at 2024-05-01T09:00:00Z, snapshots are taken every 1h0m0s"))
+	})
+
+	It("should not change the report while the cluster doesn't change", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{Interval: metav1.Duration{Duration: time.Hour}},
+			},
+			Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupStatus{LastSnapshotTime: ptr.To(metav1.NewTime(now.Add(-time.Hour)))},
+			},
+		}
+		defragmented := now.Add(-24 * time.Hour)
+
+		Expect(evaluateProductionReadiness(cluster, nil, &defragmented, now)).
+			To(Equal(evaluateProductionReadiness(cluster, nil, &defragmented, now.Add(time.Minute))))
+	})
+})
@@ -0,0 +1,177 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// reconcileReadOnly replaces roles of users other than root with the read-only role while the cluster is
+// read-only and grants them back once it is not, except roles revoked from users frozen for exceeding key quotas,
+// who keep the read-only role. Users created while the cluster is read-only are frozen too.
+// Revoked roles are recorded in status before they are revoked, so they are not lost if the operator stops
+// in between.
+func (r *EtcdClusterReconciler) reconcileReadOnly(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	if !cluster.Spec.ReadOnly && cluster.Status.ReadOnly == nil {
+		return nil
+	}
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	users, err := etcd.UsersRoles(ctx, cli)
+	if err != nil {
+		return err
+	}
+
+	if !cluster.Spec.ReadOnly {
+		for name, roles := range rolesToGrant(cluster, users) {
+			thaw := etcd.ThawUser
+			if _, ok := quotaFrozenRoles(cluster, name); ok {
+				thaw = etcd.GrantRoles
+			}
+			if err = thaw(ctx, cli, name, roles); err != nil {
+				return err
+			}
+		}
+		cluster.Status.ReadOnly = nil
+		setReadOnlyCondition(cluster, false)
+		log.FromContext(ctx).Info("cluster is writable again")
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "ReadOnlyDisabled", "Roles of users are granted back")
+		return nil
+	}
+
+	revoked := rolesToRevoke(users)
+	if len(revoked) == 0 {
+		return nil
+	}
+	original := cluster.DeepCopy()
+	enabling := cluster.Status.ReadOnly == nil
+	if enabling {
+		cluster.Status.ReadOnly = &etcdaenixiov1alpha1.ReadOnlyStatus{Since: metav1.NewTime(time.Now().Truncate(time.Second))}
+	}
+	recordRevokedRoles(cluster.Status.ReadOnly, revoked)
+	setReadOnlyCondition(cluster, true)
+	if err = r.persistStatus(ctx, original, cluster); err != nil {
+		return fmt.Errorf("cannot record revoked roles: %w", err)
+	}
+	for name, roles := range revoked {
+		if err = etcd.FreezeUser(ctx, cli, name, roles); err != nil {
+			return err
+		}
+	}
+	if enabling {
+		log.FromContext(ctx).Info("cluster is read-only")
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "ReadOnlyEnabled",
+			"Roles of users are revoked, only the root user can write")
+	}
+	return nil
+}
+
+// rolesToRevoke returns roles to revoke from users which are not frozen yet keyed by user names.
+func rolesToRevoke(users map[string][]string) map[string][]string {
+	revoked := map[string][]string{}
+	for name, roles := range users {
+		others := slices.DeleteFunc(slices.Clone(roles), func(role string) bool { return role == etcd.ReadOnlyRole })
+		if frozen := len(others) < len(roles); !frozen || len(others) > 0 {
+			revoked[name] = others
+		}
+	}
+	return revoked
+}
+
+// recordRevokedRoles adds the revoked roles to the roles recorded in status.
+func recordRevokedRoles(status *etcdaenixiov1alpha1.ReadOnlyStatus, revoked map[string][]string) {
+	for _, name := range sortedKeys(revoked) {
+		idx := slices.IndexFunc(status.RevokedRoles, func(u etcdaenixiov1alpha1.UserRoles) bool { return u.User == name })
+		if idx == -1 {
+			status.RevokedRoles = append(status.RevokedRoles, etcdaenixiov1alpha1.UserRoles{User: name, Roles: []string{}})
+			idx = len(status.RevokedRoles) - 1
+		}
+		for _, role := range revoked[name] {
+			if !slices.Contains(status.RevokedRoles[idx].Roles, role) {
+				status.RevokedRoles[idx].Roles = append(status.RevokedRoles[idx].Roles, role)
+			}
+		}
+	}
+}
+
+// rolesToGrant returns roles to grant back to frozen users keyed by user names: the roles recorded in status
+// and the roles of managed users, whose roles are not granted while the cluster is read-only. Roles revoked
+// for exceeding key quotas are not granted.
+func rolesToGrant(cluster *etcdaenixiov1alpha1.EtcdCluster, users map[string][]string) map[string][]string {
+	granted := map[string][]string{}
+	for name, roles := range users {
+		if !slices.Contains(roles, etcd.ReadOnlyRole) {
+			continue
+		}
+		var grant []string
+		if cluster.Status.ReadOnly != nil {
+			for _, u := range cluster.Status.ReadOnly.RevokedRoles {
+				if u.User == name {
+					grant = append(grant, u.Roles...)
+				}
+			}
+		}
+		grant = append(grant, managedUserRoles(cluster, name)...)
+		frozen, _ := quotaFrozenRoles(cluster, name)
+		grant = withoutRoles(grant, frozen)
+		slices.Sort(grant)
+		granted[name] = slices.Compact(grant)
+	}
+	return granted
+}
+
+// managedUserRoles returns roles of the user if it is managed by the operator.
+func managedUserRoles(cluster *etcdaenixiov1alpha1.EtcdCluster, name string) []string {
+	if cluster.Spec.Security == nil || cluster.Spec.Security.Auth == nil {
+		return nil
+	}
+	var roles []string
+	for _, u := range cluster.Spec.Security.Auth.Users {
+		if u.Name == name {
+			roles = append(roles, u.Roles...)
+		}
+	}
+	return roles
+}
+
+func setReadOnlyCondition(cluster *etcdaenixiov1alpha1.EtcdCluster, readOnly bool) {
+	reason, message := etcdaenixiov1alpha1.EtcdCondTypeWritesAllowed, etcdaenixiov1alpha1.EtcdReadOnlyCondNegMessage
+	if readOnly {
+		reason, message = etcdaenixiov1alpha1.EtcdCondTypeWritesRejected, etcdaenixiov1alpha1.EtcdReadOnlyCondPosMessage
+	}
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionReadOnly).
+		WithStatus(readOnly).
+		WithReason(string(reason)).
+		WithMessage(string(message)).
+		Complete())
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+var _ = Describe("EtcdCluster read-only mode", func() {
+	It("should revoke roles of users not frozen yet", func() {
+		revoked := rolesToRevoke(map[string][]string{
+			"app":    {"app-rw"},
+			"new":    {},
+			"frozen": {etcd.ReadOnlyRole},
+			"edited": {etcd.ReadOnlyRole, "app-rw"},
+		})
+		Expect(revoked).To(Equal(map[string][]string{
+			"app":    {"app-rw"},
+			"new":    {},
+			"edited": {"app-rw"},
+		}))
+	})
+
+	It("should keep roles revoked before", func() {
+		status := &etcdaenixiov1alpha1.ReadOnlyStatus{RevokedRoles: []etcdaenixiov1alpha1.UserRoles{
+			{User: "app", Roles: []string{"app-rw"}},
+		}}
+		recordRevokedRoles(status, map[string][]string{"app": {"app-admin"}, "new": {}})
+		Expect(status.RevokedRoles).To(Equal([]etcdaenixiov1alpha1.UserRoles{
+			{User: "app", Roles: []string{"app-rw", "app-admin"}},
+			{User: "new", Roles: []string{}},
+		}))
+	})
+
+	It("should grant back revoked roles and roles of managed users", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{Security: &etcdaenixiov1alpha1.SecuritySpec{
+				Auth: &etcdaenixiov1alpha1.AuthSpec{Users: []etcdaenixiov1alpha1.ManagedUser{
+					{Name: "app", Roles: []string{"app-rw"}},
+					{Name: "new", Roles: []string{"new-rw"}},
+				}},
+			}},
+			Status: etcdaenixiov1alpha1.EtcdClusterStatus{ReadOnly: &etcdaenixiov1alpha1.ReadOnlyStatus{
+				RevokedRoles: []etcdaenixiov1alpha1.UserRoles{{User: "app", Roles: []string{"app-rw", "app-admin"}}},
+			}},
+		}
+		granted := rolesToGrant(cluster, map[string][]string{
+			"app":   {etcd.ReadOnlyRole},
+			"new":   {etcd.ReadOnlyRole},
+			"other": {"other-rw"},
+		})
+		Expect(granted).To(Equal(map[string][]string{
+			"app": {"app-admin", "app-rw"},
+			"new": {"new-rw"},
+		}))
+	})
+
+	It("should not grant roles revoked for exceeding key quotas", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+				ReadOnly: &etcdaenixiov1alpha1.ReadOnlyStatus{RevokedRoles: []etcdaenixiov1alpha1.UserRoles{
+					{User: "app", Roles: []string{"app-rw"}},
+					{User: "tenant", Roles: []string{"tenant-rw", "tenant-admin"}},
+				}},
+				KeyUsage: &etcdaenixiov1alpha1.KeyUsageStatus{FrozenUsers: []etcdaenixiov1alpha1.FrozenUser{
+					{User: "tenant", Prefixes: []string{"/tenant/"}, Roles: []string{"tenant-admin"}},
+				}},
+			},
+		}
+		granted := rolesToGrant(cluster, map[string][]string{
+			"app":    {etcd.ReadOnlyRole},
+			"tenant": {etcd.ReadOnlyRole},
+		})
+		Expect(granted).To(Equal(map[string][]string{"app": {"app-rw"}, "tenant": {"tenant-rw"}}))
+	})
+})
@@ -0,0 +1,471 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/agent"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+// restoreProgressInterval is how often progress of member restores is checked.
+const restoreProgressInterval = 10 * time.Second
+
+var restoreProgressClient = &http.Client{Timeout: metricsTimeout}
+
+// reconcileRestoreRequest handles the restore requested with RestoreFromAnnotation. Once the restore is started,
+// members are stopped, and as soon as all member pods are gone, a Job restoring data volumes is created for every
+// member at once, so all members are restored in parallel. When all Jobs succeed, the annotation is removed and
+// members are started with the restored data. Removing the annotation earlier cancels the restore. Steps of the
+// restore run as a workflow, so the restore is resumed from its current step after the operator restarts. It returns
+// time after which the restore has to be checked again or zero if no restore is requested.
+func (r *EtcdClusterReconciler) reconcileRestoreRequest(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	key, requested := cluster.Annotations[etcdaenixiov1alpha1.RestoreFromAnnotation]
+	if !cluster.RestoringWithJobs() {
+		if !requested {
+			return 0, nil
+		}
+		if cluster.Status.Backup != nil && cluster.Status.Backup.RestoringFrom != "" {
+			// wait for the automatic restore to finish
+			return restoreProgressInterval, nil
+		}
+		return r.startRestore(ctx, cluster, key)
+	}
+
+	progress := cluster.Status.Backup.RestoreProgress
+	state := findWorkflow(cluster, factory.OperationRestore)
+	// the annotation is removed by the restore itself once members are started
+	if !requested && (state == nil || state.Step != etcdaenixiov1alpha1.WorkflowStepStartMembers) {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "RestoreCancelled",
+			"Restore from snapshot %s is cancelled, members are started with data restored so far", progress.Snapshot)
+		cluster.Status.Backup.RestoringFrom = ""
+		removeWorkflow(cluster, factory.OperationRestore)
+		if err := r.pruneRestoreJobs(ctx, cluster); err != nil {
+			return 0, err
+		}
+		return 0, factory.ReleaseOperationLock(ctx, cluster, r.Client, factory.OperationRestore)
+	}
+	// renew the lock while the restore is in progress
+	if _, err := r.acquireOperationLock(ctx, cluster, factory.OperationRestore); err != nil {
+		return 0, err
+	}
+
+	done, err := r.runWorkflow(ctx, cluster, workflow{
+		operation: factory.OperationRestore,
+		steps: []workflowStep{
+			{name: etcdaenixiov1alpha1.WorkflowStepStopMembers, run: r.membersStopped(cluster)},
+			{name: etcdaenixiov1alpha1.WorkflowStepRestoreData, run: r.restoreData(cluster, progress)},
+			{name: etcdaenixiov1alpha1.WorkflowStepStartMembers, disruptive: true, run: r.startRestoredMembers(cluster, progress)},
+		},
+	})
+	if !done {
+		return restoreProgressInterval, err
+	}
+	log.FromContext(ctx).Info("cluster is restored, starting members", "snapshot", progress.Snapshot)
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "Restored", "Cluster is restored from snapshot %s", progress.Snapshot)
+	cluster.Status.Backup.RestoringFrom = ""
+	if err := r.pruneRestoreJobs(ctx, cluster); err != nil {
+		return 0, err
+	}
+	return 0, factory.ReleaseOperationLock(ctx, cluster, r.Client, factory.OperationRestore)
+}
+
+// pruneRestoreJobs deletes finished restore Jobs beyond history limits once the restore is over, the results
+// of Jobs of the running restore are needed until then.
+func (r *EtcdClusterReconciler) pruneRestoreJobs(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	jobs, err := factory.ListJobs(ctx, cluster, r.Client, factory.RestoreComponent)
+	if err != nil {
+		return err
+	}
+	return factory.PruneJobs(ctx, cluster, r.Client, jobs)
+}
+
+// membersStopped is the restore step waiting for all member pods to be deleted, since data volumes
+// can only be restored once members are stopped.
+func (r *EtcdClusterReconciler) membersStopped(cluster *etcdaenixiov1alpha1.EtcdCluster) func(context.Context, *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+	return func(ctx context.Context, _ *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+		for _, name := range cluster.MemberNames() {
+			if pod, err := r.getMemberPod(ctx, cluster, name); pod != nil || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+}
+
+// restoreData is the restore step creating a Job restoring data volumes of every member at once and waiting
+// for all of them to succeed. Results of Jobs are recorded in the restore progress first, so Jobs deleted once
+// they succeeded, e.g. after their TTL, count as done. Failed Jobs are deleted and created again on the next
+// attempt, members stay stopped until all of them are restored or the restore is cancelled.
+func (r *EtcdClusterReconciler) restoreData(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	progress *etcdaenixiov1alpha1.RestoreProgress,
+) func(context.Context, *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+	return func(ctx context.Context, _ *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+		if _, err := r.reconcileRestoreProgress(ctx, cluster); err != nil {
+			return false, err
+		}
+		done := true
+		var failed []string
+		for _, name := range cluster.MemberNames() {
+			if slices.ContainsFunc(progress.Members, func(m etcdaenixiov1alpha1.MemberRestoreProgress) bool {
+				return m.Name == name && m.Phase == etcdaenixiov1alpha1.RestorePhaseCompleted
+			}) {
+				continue
+			}
+			done = false
+			job := &batchv1.Job{}
+			jobName := factory.RestoreJobName(name, progress.StartTime.Time)
+			err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: jobName}, job)
+			if errors.IsNotFound(err) {
+				err = factory.CreateRestoreJob(ctx, cluster, r.Client, r.Scheme, name, progress.Snapshot, progress.StartTime.Time)
+			}
+			if err != nil {
+				return false, err
+			}
+			if finished, succeeded := factory.JobFinished(job); finished && !succeeded {
+				err = r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+				if client.IgnoreNotFound(err) != nil {
+					return false, fmt.Errorf("cannot delete failed restore job %s: %w", jobName, err)
+				}
+				failed = append(failed, name)
+			}
+		}
+		if len(failed) > 0 {
+			return false, fmt.Errorf("restore jobs of members %s failed, they are created again", strings.Join(failed, ", "))
+		}
+		return done, nil
+	}
+}
+
+// startRestoredMembers is the restore step removing RestoreFromAnnotation, so members are started with
+// the restored data.
+func (r *EtcdClusterReconciler) startRestoredMembers(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	progress *etcdaenixiov1alpha1.RestoreProgress,
+) func(context.Context, *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+	return func(ctx context.Context, _ *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+		if _, requested := cluster.Annotations[etcdaenixiov1alpha1.RestoreFromAnnotation]; requested {
+			// patching the cluster resets its status to the stored one
+			status := cluster.Status.DeepCopy()
+			if err := r.removeRestoreFromAnnotation(ctx, cluster); err != nil {
+				return false, err
+			}
+			cluster.Status = *status
+		}
+		if _, err := r.reconcileRestoreProgress(ctx, cluster); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+}
+
+// startRestore resolves the snapshot to restore the cluster from and starts the restore with Jobs.
+func (r *EtcdClusterReconciler) startRestore(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, key string) (time.Duration, error) {
+	storage, err := newBackupStorage(ctx, r.Client, cluster.Namespace, &cluster.Spec.Backup.Destination)
+	if err != nil {
+		return 0, err
+	}
+	exists := false
+	if key == etcdaenixiov1alpha1.RestoreFromLatest {
+		key, err = backup.LatestSnapshot(ctx, storage, cluster)
+		exists = key != ""
+	} else {
+		exists, err = backup.SnapshotExists(ctx, storage, key)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "RestoreFailed", "Snapshot %s to restore from does not exist",
+			cluster.Annotations[etcdaenixiov1alpha1.RestoreFromAnnotation])
+		return 0, r.removeRestoreFromAnnotation(ctx, cluster)
+	}
+	incompatibility, err := snapshotIncompatibility(ctx, storage, cluster, key)
+	if err != nil {
+		return 0, err
+	}
+	if incompatibility != "" {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "RestoreFailed", "Cannot restore cluster: %s", incompatibility)
+		return 0, r.removeRestoreFromAnnotation(ctx, cluster)
+	}
+
+	if acquired, err := r.acquireOperationLock(ctx, cluster, factory.OperationRestore); !acquired {
+		return restoreProgressInterval, err
+	}
+	log.FromContext(ctx).Info("restoring cluster, stopping members", "snapshot", key)
+	if cluster.Status.Backup == nil {
+		cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{}
+	}
+	cluster.Status.Backup.RestoringFrom = key
+	cluster.Status.Backup.RestoreProgress = &etcdaenixiov1alpha1.RestoreProgress{
+		Snapshot:  key,
+		StartTime: metav1.NewTime(time.Now().Truncate(time.Second)),
+		Jobs:      true,
+	}
+	r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "RestoreStarted",
+		"Members are stopped to restore the cluster from snapshot %s", key)
+	return restoreProgressInterval, nil
+}
+
+// snapshotIncompatibility returns the reason the snapshot stored under the key can't be restored into the cluster,
+// found in its manifest, or empty string if it can be restored. Snapshots without manifests are not checked.
+func snapshotIncompatibility(
+	ctx context.Context,
+	storage backup.Storage,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	key string,
+) (string, error) {
+	manifest, err := backup.ReadManifest(ctx, storage, key)
+	if err != nil || manifest == nil {
+		return "", err
+	}
+	if err = manifest.CheckCompatibility(cluster.EtcdVersion()); err != nil {
+		return fmt.Sprintf("snapshot %s cannot be restored: %v", key, err), nil
+	}
+	return "", nil
+}
+
+// removeRestoreFromAnnotation removes RestoreFromAnnotation from the cluster.
+func (r *EtcdClusterReconciler) removeRestoreFromAnnotation(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	patch := client.MergeFrom(cluster.DeepCopy())
+	delete(cluster.Annotations, etcdaenixiov1alpha1.RestoreFromAnnotation)
+	if err := r.Patch(ctx, cluster, patch); err != nil {
+		return fmt.Errorf("cannot remove %s annotation: %w", etcdaenixiov1alpha1.RestoreFromAnnotation, err)
+	}
+	applyDefaultBackupPolicy(ctx, cluster)
+	return nil
+}
+
+// reconcileRestoreProgress reports progress of member restores in status while the cluster is restored
+// from a snapshot. Phases of members are taken from their restore containers, and the progress of running
+// restores is fetched from the restore agent. It returns time after which the progress has to be checked again
+// or zero if no restore is in progress.
+func (r *EtcdClusterReconciler) reconcileRestoreProgress(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	if cluster.Status.Backup == nil || cluster.Status.Backup.RestoringFrom == "" {
+		return 0, nil
+	}
+	progress := cluster.Status.Backup.RestoreProgress
+	if progress == nil || progress.Snapshot != cluster.Status.Backup.RestoringFrom {
+		progress = &etcdaenixiov1alpha1.RestoreProgress{
+			Snapshot:  cluster.Status.Backup.RestoringFrom,
+			StartTime: metav1.NewTime(time.Now().Truncate(time.Second)),
+		}
+		cluster.Status.Backup.RestoreProgress = progress
+	}
+
+	now := metav1.Now()
+	members := make([]etcdaenixiov1alpha1.MemberRestoreProgress, 0, len(progress.Members))
+	for _, name := range cluster.MemberNames() {
+		member := etcdaenixiov1alpha1.MemberRestoreProgress{Name: name, Phase: etcdaenixiov1alpha1.RestorePhasePending}
+		idx := slices.IndexFunc(progress.Members, func(m etcdaenixiov1alpha1.MemberRestoreProgress) bool { return m.Name == name })
+		if idx != -1 {
+			member = progress.Members[idx]
+		}
+
+		report := backup.ProgressReport{
+			Phase:           etcdaenixiov1alpha1.RestorePhasePending,
+			BytesDownloaded: member.BytesDownloaded,
+			TotalBytes:      member.TotalBytes,
+		}
+		pod, phase, err := r.memberRestorePod(ctx, cluster, name, progress)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case phase != "":
+			report.Phase = phase
+		case progress.Jobs && member.Phase == etcdaenixiov1alpha1.RestorePhaseCompleted:
+			// the Job succeeded and is deleted since, e.g. after its TTL
+			report.Phase = member.Phase
+		case pod != nil:
+			report.Phase = restorePhase(pod)
+			if report.Phase == etcdaenixiov1alpha1.RestorePhaseDownloading {
+				// the restore container is running, ask it how far it is
+				fetched, err := fetchRestoreProgress(ctx, pod.Status.PodIP)
+				switch {
+				case err != nil:
+					log.FromContext(ctx).V(1).Info("cannot fetch restore progress", "member", name, "reason", err.Error())
+					report.Phase = member.Phase
+				case fetched.Phase != "":
+					report = fetched
+				}
+			}
+		}
+
+		if updateMemberRestoreProgress(&member, report, now) {
+			if member.Phase == etcdaenixiov1alpha1.RestorePhaseFailed {
+				r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "MemberRestoreFailed",
+					"Member %s cannot be restored from snapshot %s", name, progress.Snapshot)
+			} else {
+				r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "MemberRestoreProgress",
+					"Member %s restore is %s, %s", name, member.Phase, restoredBytes(&member))
+			}
+		}
+		members = append(members, member)
+	}
+	progress.Members = members
+	return restoreProgressInterval, nil
+}
+
+// memberRestorePod returns the pod restoring data of the member started after the restore, if any. If the restore
+// is done by a Job which is already finished, the phase of the restore is returned instead.
+func (r *EtcdClusterReconciler) memberRestorePod(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	member string,
+	progress *etcdaenixiov1alpha1.RestoreProgress,
+) (*corev1.Pod, etcdaenixiov1alpha1.RestorePhase, error) {
+	if !progress.Jobs {
+		pod := &corev1.Pod{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: member}, pod)
+		if errors.IsNotFound(err) || err == nil && (pod.DeletionTimestamp != nil || pod.CreationTimestamp.Before(&progress.StartTime)) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot get member pod %s: %w", member, err)
+		}
+		return pod, "", nil
+	}
+
+	job := &batchv1.Job{}
+	name := factory.RestoreJobName(member, progress.StartTime.Time)
+	err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, job)
+	if errors.IsNotFound(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot get restore job %s: %w", name, err)
+	}
+	if finished, succeeded := factory.JobFinished(job); finished {
+		if succeeded {
+			return nil, etcdaenixiov1alpha1.RestorePhaseCompleted, nil
+		}
+		return nil, etcdaenixiov1alpha1.RestorePhaseFailed, nil
+	}
+	pods := &corev1.PodList{}
+	err = r.List(ctx, pods, client.InNamespace(cluster.Namespace), client.MatchingLabels{batchv1.JobNameLabel: name})
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot list pods of restore job %s: %w", name, err)
+	}
+	// the newest pod is the current attempt
+	var pod *corev1.Pod
+	for i := range pods.Items {
+		if pod == nil || pod.CreationTimestamp.Before(&pods.Items[i].CreationTimestamp) {
+			pod = &pods.Items[i]
+		}
+	}
+	return pod, "", nil
+}
+
+// restorePhase returns the phase of the member restore observed in the state of the restore container, which is
+// an init container of member pods and the only container of restore Job pods. Running restore containers
+// are reported as downloading, the restore agent knows the exact phase.
+func restorePhase(pod *corev1.Pod) etcdaenixiov1alpha1.RestorePhase {
+	statuses := slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses)
+	idx := slices.IndexFunc(statuses, func(s corev1.ContainerStatus) bool {
+		return s.Name == factory.RestoreContainerName
+	})
+	if idx == -1 {
+		return etcdaenixiov1alpha1.RestorePhasePending
+	}
+	status := statuses[idx]
+	switch {
+	case status.State.Terminated != nil && status.State.Terminated.ExitCode == 0:
+		return etcdaenixiov1alpha1.RestorePhaseCompleted
+	case status.State.Terminated != nil:
+		return etcdaenixiov1alpha1.RestorePhaseFailed
+	case status.State.Running != nil:
+		return etcdaenixiov1alpha1.RestorePhaseDownloading
+	case status.LastTerminationState.Terminated != nil && status.LastTerminationState.Terminated.ExitCode != 0:
+		// the container is waiting to be restarted after a failure
+		return etcdaenixiov1alpha1.RestorePhaseFailed
+	default:
+		return etcdaenixiov1alpha1.RestorePhasePending
+	}
+}
+
+// fetchRestoreProgress fetches progress of the restore from the restore agent of the member pod.
+func fetchRestoreProgress(ctx context.Context, podIP string) (backup.ProgressReport, error) {
+	var report backup.ProgressReport
+	if podIP == "" {
+		return report, fmt.Errorf("pod has no IP")
+	}
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(podIP, strconv.Itoa(agent.RestoreProgressPort)), agent.RestoreProgressPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return report, err
+	}
+	resp, err := restoreProgressClient.Do(req)
+	if err != nil {
+		return report, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return report, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	return report, err
+}
+
+// updateMemberRestoreProgress applies the observed progress to the member and returns true if its phase changed.
+// The progress time is only updated when the restore moves forward, so a hung restore keeps an old one.
+func updateMemberRestoreProgress(
+	member *etcdaenixiov1alpha1.MemberRestoreProgress,
+	report backup.ProgressReport,
+	now metav1.Time,
+) bool {
+	phaseChanged := member.Phase != report.Phase
+	if phaseChanged || member.BytesDownloaded != report.BytesDownloaded || member.LastProgressTime == nil {
+		member.LastProgressTime = &now
+	}
+	member.Phase = report.Phase
+	member.BytesDownloaded = report.BytesDownloaded
+	if report.TotalBytes > 0 {
+		member.TotalBytes = report.TotalBytes
+	}
+	return phaseChanged
+}
+
+// restoredBytes describes how much of the snapshot is downloaded by the member.
+func restoredBytes(member *etcdaenixiov1alpha1.MemberRestoreProgress) string {
+	if member.TotalBytes > 0 {
+		return fmt.Sprintf("%d of %d bytes downloaded", member.BytesDownloaded, member.TotalBytes)
+	}
+	return fmt.Sprintf("%d bytes downloaded", member.BytesDownloaded)
+}
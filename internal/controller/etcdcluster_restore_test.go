@@ -0,0 +1,232 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+var _ = Describe("EtcdCluster restore progress", func() {
+	restorePod := func(name string, created time.Time, state corev1.ContainerState) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, CreationTimestamp: metav1.NewTime(created)},
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{Name: "restore", State: state}},
+			},
+		}
+	}
+
+	It("should derive phases from restore containers", func() {
+		now := time.Now()
+		Expect(restorePhase(&corev1.Pod{})).To(Equal(etcdaenixiov1alpha1.RestorePhasePending))
+		Expect(restorePhase(restorePod("test-0", now, corev1.ContainerState{
+			Running: &corev1.ContainerStateRunning{},
+		}))).To(Equal(etcdaenixiov1alpha1.RestorePhaseDownloading))
+		Expect(restorePhase(restorePod("test-0", now, corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
+		}))).To(Equal(etcdaenixiov1alpha1.RestorePhaseCompleted))
+
+		crashing := restorePod("test-0", now, corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{}})
+		crashing.Status.InitContainerStatuses[0].LastTerminationState.Terminated = &corev1.ContainerStateTerminated{ExitCode: 1}
+		Expect(restorePhase(crashing)).To(Equal(etcdaenixiov1alpha1.RestorePhaseFailed))
+	})
+
+	It("should only move progress time when the restore moves forward", func() {
+		start := metav1.NewTime(time.Now().Add(-time.Minute))
+		member := &etcdaenixiov1alpha1.MemberRestoreProgress{
+			Name:             "test-0",
+			Phase:            etcdaenixiov1alpha1.RestorePhaseDownloading,
+			BytesDownloaded:  100,
+			LastProgressTime: &start,
+		}
+		report := backup.ProgressReport{Phase: etcdaenixiov1alpha1.RestorePhaseDownloading, BytesDownloaded: 100}
+		Expect(updateMemberRestoreProgress(member, report, metav1.Now())).To(BeFalse())
+		Expect(member.LastProgressTime).To(Equal(&start))
+
+		report.BytesDownloaded, report.TotalBytes = 200, 1000
+		now := metav1.Now()
+		Expect(updateMemberRestoreProgress(member, report, now)).To(BeFalse())
+		Expect(member.LastProgressTime).To(Equal(&now))
+		Expect(member.TotalBytes).To(Equal(int64(1000)))
+
+		report.Phase = etcdaenixiov1alpha1.RestorePhaseRestoring
+		Expect(updateMemberRestoreProgress(member, report, now)).To(BeTrue())
+	})
+
+	It("should report phases of recreated members only", func(ctx SpecContext) {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+			Spec:       etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(2))},
+			Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupStatus{RestoringFrom: "etcd/ns/test/1.db"},
+			},
+		}
+		completed := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}}
+		recorder := record.NewFakeRecorder(10)
+		r := &EtcdClusterReconciler{
+			Client: fake.NewClientBuilder().WithObjects(
+				restorePod("test-0", time.Now().Add(time.Minute), completed),
+				// the pod of the previous restore is about to be deleted
+				restorePod("test-1", time.Now().Add(-time.Hour), completed),
+			).Build(),
+			Recorder: recorder,
+		}
+		Expect(r.reconcileRestoreProgress(ctx, cluster)).To(Equal(restoreProgressInterval))
+		progress := cluster.Status.Backup.RestoreProgress
+		Expect(progress.Snapshot).To(Equal("etcd/ns/test/1.db"))
+		Expect(progress.Members).To(HaveLen(2))
+		Expect(progress.Members[0].Phase).To(Equal(etcdaenixiov1alpha1.RestorePhaseCompleted))
+		Expect(progress.Members[1].Phase).To(Equal(etcdaenixiov1alpha1.RestorePhasePending))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Member test-0 restore is Completed")))
+	})
+
+	It("should restore stopped members by parallel jobs", func(ctx SpecContext) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		start := metav1.NewTime(time.Now().Truncate(time.Second))
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ns",
+				Name:        "test",
+				UID:         "0b1c",
+				Annotations: map[string]string{etcdaenixiov1alpha1.RestoreFromAnnotation: "etcd/ns/test/1.db"},
+			},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas:    ptr.To(int32(3)),
+				JobTemplate: &etcdaenixiov1alpha1.JobTemplate{SuccessfulJobsHistoryLimit: ptr.To(int32(1))},
+				Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+					Destination: etcdaenixiov1alpha1.BackupDestination{
+						S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups", CredentialsSecret: "s3"},
+					},
+				},
+			},
+		}
+		rclient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).
+			WithStatusSubresource(&etcdaenixiov1alpha1.EtcdCluster{}).Build()
+		Expect(rclient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+		cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{
+			RestoringFrom:   "etcd/ns/test/1.db",
+			RestoreProgress: &etcdaenixiov1alpha1.RestoreProgress{Snapshot: "etcd/ns/test/1.db", StartTime: start, Jobs: true},
+		}
+		Expect(cluster.RestoringWithJobs()).To(BeTrue())
+		r := &EtcdClusterReconciler{Client: rclient, Scheme: scheme, Recorder: record.NewFakeRecorder(20)}
+
+		Expect(r.reconcileRestoreRequest(ctx, cluster)).To(Equal(restoreProgressInterval))
+		jobs := &batchv1.JobList{}
+		Expect(rclient.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(3))
+
+		for i := range jobs.Items {
+			jobs.Items[i].Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+			Expect(rclient.Status().Update(ctx, &jobs.Items[i])).To(Succeed())
+		}
+		Expect(r.reconcileRestoreRequest(ctx, cluster)).To(BeZero())
+		Expect(cluster.Annotations).NotTo(HaveKey(etcdaenixiov1alpha1.RestoreFromAnnotation))
+		Expect(cluster.Status.Backup.RestoringFrom).To(BeEmpty())
+		Expect(cluster.Status.Backup.RestoreProgress.Members).To(HaveEach(
+			HaveField("Phase", etcdaenixiov1alpha1.RestorePhaseCompleted)))
+		Expect(cluster.Status.Workflows).To(BeEmpty())
+		// finished jobs beyond history limits are deleted once the restore is over
+		Expect(rclient.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+	})
+
+	It("should count deleted jobs as done and retry failed ones", func(ctx SpecContext) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		start := metav1.NewTime(time.Now().Truncate(time.Second))
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ns",
+				Name:        "test",
+				UID:         "0b1c",
+				Annotations: map[string]string{etcdaenixiov1alpha1.RestoreFromAnnotation: "etcd/ns/test/1.db"},
+			},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(2)),
+				Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+					Destination: etcdaenixiov1alpha1.BackupDestination{
+						S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups", CredentialsSecret: "s3"},
+					},
+				},
+			},
+		}
+		rclient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).
+			WithStatusSubresource(&etcdaenixiov1alpha1.EtcdCluster{}).Build()
+		Expect(rclient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+		cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{
+			RestoringFrom:   "etcd/ns/test/1.db",
+			RestoreProgress: &etcdaenixiov1alpha1.RestoreProgress{Snapshot: "etcd/ns/test/1.db", StartTime: start, Jobs: true},
+		}
+		r := &EtcdClusterReconciler{Client: rclient, Scheme: scheme, Recorder: record.NewFakeRecorder(20)}
+		Expect(r.reconcileRestoreRequest(ctx, cluster)).To(Equal(restoreProgressInterval))
+
+		succeeded := &batchv1.Job{}
+		Expect(rclient.Get(ctx, types.NamespacedName{Namespace: "ns", Name: factory.RestoreJobName("test-0", start.Time)}, succeeded)).To(Succeed())
+		succeeded.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		Expect(rclient.Status().Update(ctx, succeeded)).To(Succeed())
+		failed := &batchv1.Job{}
+		Expect(rclient.Get(ctx, types.NamespacedName{Namespace: "ns", Name: factory.RestoreJobName("test-1", start.Time)}, failed)).To(Succeed())
+		failed.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+		Expect(rclient.Status().Update(ctx, failed)).To(Succeed())
+
+		delay, err := r.reconcileRestoreRequest(ctx, cluster)
+		Expect(err).To(MatchError(ContainSubstring("test-1")))
+		Expect(delay).To(Equal(restoreProgressInterval))
+		Expect(cluster.Status.Workflows).To(ConsistOf(And(
+			HaveField("Phase", etcdaenixiov1alpha1.WorkflowPhaseRetrying),
+			HaveField("Retries", int32(1)))))
+		Expect(rclient.Get(ctx, client.ObjectKeyFromObject(failed), &batchv1.Job{})).To(Satisfy(errors.IsNotFound))
+		Expect(cluster.Status.Backup.RestoreProgress.Members).To(ConsistOf(
+			HaveField("Phase", etcdaenixiov1alpha1.RestorePhaseCompleted),
+			HaveField("Phase", etcdaenixiov1alpha1.RestorePhaseFailed)))
+
+		// the succeeded job is deleted after its TTL, the failed one is created again
+		Expect(rclient.Delete(ctx, succeeded)).To(Succeed())
+		Expect(r.reconcileRestoreRequest(ctx, cluster)).To(Equal(restoreProgressInterval))
+		jobs := &batchv1.JobList{}
+		Expect(rclient.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(ConsistOf(HaveField("Name", failed.Name)))
+
+		jobs.Items[0].Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		Expect(rclient.Status().Update(ctx, &jobs.Items[0])).To(Succeed())
+		Expect(r.reconcileRestoreRequest(ctx, cluster)).To(BeZero())
+		Expect(cluster.Status.Backup.RestoringFrom).To(BeEmpty())
+		Expect(cluster.Status.Backup.RestoreProgress.Members).To(HaveEach(
+			HaveField("Phase", etcdaenixiov1alpha1.RestorePhaseCompleted)))
+	})
+})
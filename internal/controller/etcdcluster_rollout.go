@@ -0,0 +1,246 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+const (
+	etcdContainerName = "etcd"
+	// rolloutCheckInterval is how often the rollout progress is checked.
+	rolloutCheckInterval = 10 * time.Second
+)
+
+// revisionTemplate is the part of ControllerRevision data the StatefulSet controller stores pod template in.
+type revisionTemplate struct {
+	Spec struct {
+		Template corev1.PodTemplateSpec `json:"template"`
+	} `json:"spec"`
+}
+
+// rolloutMembers brings member pods up to date with the StatefulSet update revision one member at a time.
+// Next member is updated only when all members are ready and healthy. If only etcd container resources
+// are changed and in-place resize is enabled, the pod is resized without restart, otherwise it is deleted
+// and recreated by the StatefulSet. It returns time after which the rollout has to be checked again
+// or zero if all members are up to date.
+func (r *EtcdClusterReconciler) rolloutMembers(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(cluster), sts); err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	// finish the member restart started before, even if the member is up to date already
+	if state := findWorkflow(cluster, factory.OperationRollout); state != nil {
+		if acquired, err := r.acquireOperationLock(ctx, cluster, factory.OperationRollout); !acquired {
+			return rolloutCheckInterval, err
+		}
+		return r.restartMember(ctx, cluster, state.Member)
+	}
+	if sts.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType || sts.Status.UpdateRevision == "" {
+		return 0, nil
+	}
+
+	var outdated []*corev1.Pod
+	for _, name := range cluster.MemberNames() {
+		pod := &corev1.Pod{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, pod)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("cannot get member pod %s: %w", name, err)
+		}
+		if pod.Labels[appsv1.ControllerRevisionHashLabelKey] != sts.Status.UpdateRevision {
+			outdated = append(outdated, pod)
+		}
+	}
+	if len(outdated) == 0 {
+		return 0, r.releaseOperationLockWhenReady(ctx, cluster, factory.OperationRollout)
+	}
+	if acquired, err := r.acquireOperationLock(ctx, cluster, factory.OperationRollout); !acquired {
+		return rolloutCheckInterval, err
+	}
+
+	// health gate: never take down a member while another one is not healthy
+	if sts.Status.ReadyReplicas < *sts.Spec.Replicas {
+		return rolloutCheckInterval, nil
+	}
+	unhealthy, err := etcd.UnhealthyMembers(ctx, r.Client, cluster)
+	if err != nil {
+		return 0, err
+	}
+	if len(unhealthy) > 0 {
+		log.FromContext(ctx).Info("rollout is paused until all members are healthy", "unhealthy", unhealthy.Error())
+		return rolloutCheckInterval, nil
+	}
+	if reason := performanceGate(cluster); reason != "" {
+		log.FromContext(ctx).Info("rollout is paused until performance of members recovers", "reason", reason)
+		return rolloutCheckInterval, nil
+	}
+
+	// update members in reverse ordinal order, like the StatefulSet controller does
+	pod := outdated[len(outdated)-1]
+	if r.InPlaceResize {
+		resized, err := r.resizeMember(ctx, cluster, sts, pod)
+		if err != nil {
+			return 0, err
+		}
+		if resized {
+			return rolloutCheckInterval, nil
+		}
+	}
+
+	log.FromContext(ctx).Info("restarting member to update it", "member", pod.Name)
+	return r.restartMember(ctx, cluster, pod.Name)
+}
+
+// restartMember runs the rollout workflow of the member: the member pod is deleted to be recreated from the update
+// revision, and the rollout continues once the recreated member is ready.
+func (r *EtcdClusterReconciler) restartMember(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, member string) (time.Duration, error) {
+	done, err := r.runWorkflow(ctx, cluster, workflow{
+		operation: factory.OperationRollout,
+		member:    member,
+		steps: []workflowStep{
+			r.restartMemberStep(cluster, member),
+			r.waitForMemberStep(cluster, member),
+			soakMemberStep(cluster),
+		},
+	})
+	if done {
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "MemberRestarted", "Member %s is restarted to apply changes", member)
+	}
+	return rolloutCheckInterval, err
+}
+
+// soakMemberStep waits for the rollout soak of the size preset of the cluster after the restarted member
+// became ready, so a large cluster settles before the next member is taken down. The step is part of
+// the rollout of every cluster, so the workflow is not started over if the replica count changes meanwhile.
+func soakMemberStep(cluster *etcdaenixiov1alpha1.EtcdCluster) workflowStep {
+	return workflowStep{
+		name: etcdaenixiov1alpha1.WorkflowStepSoakMember,
+		run: func(_ context.Context, state *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+			preset := cluster.SizePreset()
+			return preset == nil || time.Since(state.StepStartTime.Time) >= preset.RolloutSoak, nil
+		},
+	}
+}
+
+// resizeMember applies etcd container resources of the StatefulSet update revision to the pod in place
+// if they are the only difference between the pod revision and the update revision.
+// It returns false if the pod has to be recreated instead.
+func (r *EtcdClusterReconciler) resizeMember(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	sts *appsv1.StatefulSet,
+	pod *corev1.Pod,
+) (bool, error) {
+	if pod.Status.Resize == corev1.PodResizeStatusInfeasible {
+		return false, nil
+	}
+	current, err := r.getRevisionTemplate(ctx, sts.Namespace, pod.Labels[appsv1.ControllerRevisionHashLabelKey])
+	if err != nil || current == nil {
+		return false, err
+	}
+	desired, err := r.getRevisionTemplate(ctx, sts.Namespace, sts.Status.UpdateRevision)
+	if err != nil || desired == nil {
+		return false, err
+	}
+	resources, ok := resourcesOnlyChange(current, desired)
+	if !ok {
+		return false, nil
+	}
+
+	patch := client.MergeFrom(pod.DeepCopy())
+	idx := slices.IndexFunc(pod.Spec.Containers, func(c corev1.Container) bool { return c.Name == etcdContainerName })
+	pod.Spec.Containers[idx].Resources = resources
+	if err = r.patchPodResources(ctx, pod, patch); err != nil {
+		if errors.IsInvalid(err) || errors.IsForbidden(err) || errors.IsMethodNotSupported(err) {
+			log.FromContext(ctx).Info("in-place pod resize is not available, falling back to restart", "reason", err.Error())
+			r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "InPlaceResizeUnavailable",
+				"Cannot resize member %s in place, restarting it instead: %v", pod.Name, err)
+			return false, nil
+		}
+		return false, fmt.Errorf("cannot resize member pod %s: %w", pod.Name, err)
+	}
+
+	// mark the pod as updated, so the StatefulSet controller counts it as the pod of the update revision
+	patch = client.MergeFrom(pod.DeepCopy())
+	pod.Labels[appsv1.ControllerRevisionHashLabelKey] = sts.Status.UpdateRevision
+	if err = r.Patch(ctx, pod, patch); err != nil {
+		return false, fmt.Errorf("cannot update revision of member pod %s: %w", pod.Name, err)
+	}
+	log.FromContext(ctx).Info("member resized in place", "member", pod.Name)
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "MemberResized", "Member %s is resized in place", pod.Name)
+	return true, nil
+}
+
+// patchPodResources patches pod resources using the resize subresource and falls back to patching the pod itself
+// on clusters which allow resizing pods without the subresource.
+func (r *EtcdClusterReconciler) patchPodResources(ctx context.Context, pod *corev1.Pod, patch client.Patch) error {
+	err := r.SubResource("resize").Patch(ctx, pod, patch)
+	if errors.IsNotFound(err) {
+		return r.Patch(ctx, pod, patch)
+	}
+	return err
+}
+
+// getRevisionTemplate returns pod template stored in the ControllerRevision or nil if the revision does not exist.
+func (r *EtcdClusterReconciler) getRevisionTemplate(ctx context.Context, namespace, name string) (*corev1.PodTemplateSpec, error) {
+	revision := &appsv1.ControllerRevision{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, revision)
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	data := &revisionTemplate{}
+	if err = json.Unmarshal(revision.Data.Raw, data); err != nil {
+		return nil, fmt.Errorf("cannot parse controller revision %s: %w", name, err)
+	}
+	return &data.Spec.Template, nil
+}
+
+// resourcesOnlyChange checks if pod templates differ only in etcd container resources and returns desired resources.
+func resourcesOnlyChange(current, desired *corev1.PodTemplateSpec) (corev1.ResourceRequirements, bool) {
+	current, desired = current.DeepCopy(), desired.DeepCopy()
+	currentIdx := slices.IndexFunc(current.Spec.Containers, func(c corev1.Container) bool { return c.Name == etcdContainerName })
+	desiredIdx := slices.IndexFunc(desired.Spec.Containers, func(c corev1.Container) bool { return c.Name == etcdContainerName })
+	if currentIdx == -1 || desiredIdx == -1 {
+		return corev1.ResourceRequirements{}, false
+	}
+	resources := desired.Spec.Containers[desiredIdx].Resources
+	if equality.Semantic.DeepEqual(current.Spec.Containers[currentIdx].Resources, resources) {
+		return corev1.ResourceRequirements{}, false
+	}
+	current.Spec.Containers[currentIdx].Resources = corev1.ResourceRequirements{}
+	desired.Spec.Containers[desiredIdx].Resources = corev1.ResourceRequirements{}
+	return resources, equality.Semantic.DeepEqual(current, desired)
+}
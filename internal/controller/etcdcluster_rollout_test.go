@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+func memberTemplate(cpu string) *corev1.PodTemplateSpec {
+	return &corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  etcdContainerName,
+				Image: "quay.io/coreos/etcd:v3.5.12",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+				},
+			}},
+		},
+	}
+}
+
+var _ = Describe("EtcdCluster rollout", func() {
+	Context("When comparing member pod templates", func() {
+		It("should resize when only etcd container resources changed", func() {
+			resources, ok := resourcesOnlyChange(memberTemplate("100m"), memberTemplate("200m"))
+			Expect(ok).To(BeTrue())
+			Expect(resources.Requests.Cpu().String()).To(Equal("200m"))
+		})
+
+		It("should restart when anything else changed", func() {
+			desired := memberTemplate("200m")
+			desired.Spec.Containers[0].Image = "quay.io/coreos/etcd:v3.5.13"
+			_, ok := resourcesOnlyChange(memberTemplate("100m"), desired)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should not resize when resources are the same", func() {
+			desired := memberTemplate("100m")
+			desired.Labels = map[string]string{"app": "etcd"}
+			_, ok := resourcesOnlyChange(memberTemplate("100m"), desired)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("When soaking a restarted member", func() {
+		It("should wait for the rollout soak of large clusters only", func(ctx SpecContext) {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(5))},
+			}
+			state := &etcdaenixiov1alpha1.WorkflowStatus{StepStartTime: metav1.NewTime(time.Now().Add(-30 * time.Second))}
+			step := soakMemberStep(cluster)
+			Expect(step.run(ctx, state)).To(BeFalse())
+
+			state.StepStartTime = metav1.NewTime(time.Now().Add(-time.Minute))
+			Expect(step.run(ctx, state)).To(BeTrue())
+
+			cluster.Spec.Replicas = ptr.To(int32(3))
+			state.StepStartTime = metav1.Now()
+			Expect(step.run(ctx, state)).To(BeTrue())
+		})
+	})
+})
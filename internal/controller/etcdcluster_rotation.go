@@ -0,0 +1,160 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// reconcileRotation replaces the oldest member once its pod is older than the configured maximum age.
+// Members are replaced one at a time: the next member is replaced only after the minimum interval has passed
+// and all members are ready and healthy again. It returns time after which rotation has to be checked again.
+func (r *EtcdClusterReconciler) reconcileRotation(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	// the member of the rotation started before is already disrupted, so it is replaced even if rotation is disabled
+	if state := findWorkflow(cluster, factory.OperationRotation); state != nil {
+		if acquired, err := r.acquireOperationLock(ctx, cluster, factory.OperationRotation); !acquired {
+			return rolloutCheckInterval, err
+		}
+		return r.rotateMember(ctx, cluster, state.Member)
+	}
+	rotation := cluster.Spec.Rotation
+	if rotation == nil {
+		return 0, nil
+	}
+	if err := r.releaseOperationLockWhenReady(ctx, cluster, factory.OperationRotation); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if status := cluster.Status.Rotation; status != nil && status.LastRotationTime != nil {
+		if next := status.LastRotationTime.Add(rotation.MinInterval.Duration).Sub(now); next > 0 {
+			return next, nil
+		}
+	}
+
+	created := make(map[string]time.Time, *cluster.Spec.Replicas)
+	for _, name := range cluster.MemberNames() {
+		pod := &corev1.Pod{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, pod)
+		if errors.IsNotFound(err) {
+			// the member is being recreated
+			return rolloutCheckInterval, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("cannot get member pod %s: %w", name, err)
+		}
+		created[name] = pod.CreationTimestamp.Time
+	}
+	member, wait := nextRotation(cluster.MemberNames(), created, rotation.MaxAge.Duration, now)
+	if member == "" {
+		return wait, nil
+	}
+
+	if acquired, err := r.acquireOperationLock(ctx, cluster, factory.OperationRotation); !acquired {
+		return rolloutCheckInterval, err
+	}
+
+	// health gate: never take down a member while another one is not healthy
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(cluster), sts); err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	if sts.Status.ReadyReplicas < *sts.Spec.Replicas {
+		return rolloutCheckInterval, nil
+	}
+	healthy, err := etcd.HealthyMembers(ctx, r.Client, cluster)
+	if err != nil {
+		return 0, err
+	}
+	if healthy < int(*cluster.Spec.Replicas) {
+		return rolloutCheckInterval, nil
+	}
+	if reason := performanceGate(cluster); reason != "" {
+		log.FromContext(ctx).Info("rotation is paused until performance of members recovers", "reason", reason)
+		return rolloutCheckInterval, nil
+	}
+
+	log.FromContext(ctx).Info("rotating member", "member", member, "age", now.Sub(created[member]).Round(time.Second))
+	return r.rotateMember(ctx, cluster, member)
+}
+
+// rotateMember runs the rotation workflow of the member: the member is reset, its pod is recreated with an empty
+// data directory, and the rotation is recorded once the member is ready. A rotation started before the operator
+// restarted is resumed without the health gate, since the member may already be removed from the cluster.
+func (r *EtcdClusterReconciler) rotateMember(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, member string) (time.Duration, error) {
+	state := findWorkflow(cluster, factory.OperationRotation)
+	started := time.Now().Truncate(time.Second)
+	if state != nil {
+		started = state.StartTime.Time
+	}
+	done, err := r.runWorkflow(ctx, cluster, workflow{
+		operation: factory.OperationRotation,
+		member:    member,
+		steps: []workflowStep{
+			r.resetMemberStep(cluster, member),
+			r.restartMemberStep(cluster, member),
+			r.waitForMemberStep(cluster, member),
+		},
+	})
+	if !done {
+		return rolloutCheckInterval, err
+	}
+
+	cluster.Status.Rotation = &etcdaenixiov1alpha1.MemberRotationStatus{
+		LastRotatedMember: member,
+		LastRotationTime:  &metav1.Time{Time: started},
+	}
+	rotation := cluster.Spec.Rotation
+	if rotation == nil {
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "MemberRotated", "Member %s is replaced with a new one", member)
+		return 0, nil
+	}
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "MemberRotated",
+		"Member %s is older than %s, it is replaced with a new one", member, rotation.MaxAge.Duration)
+	return rotation.MinInterval.Duration, nil
+}
+
+// nextRotation returns the oldest member whose pod is older than the maximum age. If there is no such member,
+// it returns empty name and time until the oldest member reaches the maximum age.
+func nextRotation(members []string, created map[string]time.Time, maxAge time.Duration, now time.Time) (string, time.Duration) {
+	oldest := ""
+	for _, name := range members {
+		if oldest == "" || created[name].Before(created[oldest]) {
+			oldest = name
+		}
+	}
+	if oldest == "" {
+		return "", 0
+	}
+	if wait := created[oldest].Add(maxAge).Sub(now); wait > 0 {
+		return "", wait
+	}
+	return oldest, 0
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EtcdCluster rotation", func() {
+	Context("When picking a member to rotate", func() {
+		now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+		members := []string{"test-0", "test-1", "test-2"}
+		created := map[string]time.Time{
+			"test-0": now.Add(-20 * time.Hour),
+			"test-1": now.Add(-30 * time.Hour),
+			"test-2": now.Add(-10 * time.Hour),
+		}
+
+		It("should rotate the oldest member older than maximum age", func() {
+			member, wait := nextRotation(members, created, 24*time.Hour, now)
+			Expect(member).To(Equal("test-1"))
+			Expect(wait).To(BeZero())
+		})
+
+		It("should wait until the oldest member reaches maximum age", func() {
+			member, wait := nextRotation(members, created, 48*time.Hour, now)
+			Expect(member).To(BeEmpty())
+			Expect(wait).To(Equal(18 * time.Hour))
+		})
+	})
+})
@@ -0,0 +1,161 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// reconcileScale scales members as a workflow while the scale operation holds the operation lock: added members
+// are registered as learners and removed members are removed from the membership before the number of StatefulSet
+// replicas is changed, see factory.CreateOrUpdateStatefulSet, and learners are promoted once they catch up.
+// Members are added one per workflow pass, the pass is run again until the StatefulSet reaches the desired replicas.
+// It returns time after which scaling has to be checked again or zero if members are not being scaled.
+func (r *EtcdClusterReconciler) reconcileScale(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	var member string
+	if findWorkflow(cluster, factory.OperationScale) == nil {
+		holder, err := factory.OperationLockHolder(ctx, cluster, r.Client)
+		if err != nil || holder != factory.OperationScale {
+			return 0, err
+		}
+		if member, err = r.addedMember(ctx, cluster); err != nil {
+			return 0, err
+		}
+	}
+	done, err := r.runWorkflow(ctx, cluster, workflow{
+		operation: factory.OperationScale,
+		member:    member,
+		steps: []workflowStep{
+			{name: etcdaenixiov1alpha1.WorkflowStepChangeMembership, disruptive: true, run: r.membershipChanged(cluster)},
+			{name: etcdaenixiov1alpha1.WorkflowStepScaleMembers, run: r.membersScaled(cluster)},
+			{name: etcdaenixiov1alpha1.WorkflowStepPromoteLearners, run: r.learnersPromoted(cluster)},
+		},
+	})
+	if done {
+		// the StatefulSet runs members of the finished pass, so members left to add are added by the next one
+		if next, err := r.addedMember(ctx, cluster); next != "" || err != nil {
+			return rolloutCheckInterval, err
+		}
+		return 0, nil
+	}
+	return rolloutCheckInterval, err
+}
+
+// addedMember returns the name of the member the next scale pass adds or empty string if members are removed.
+func (r *EtcdClusterReconciler) addedMember(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (string, error) {
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(cluster), sts); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	if replicas := ptr.Deref(sts.Spec.Replicas, 0); replicas < *cluster.Spec.Replicas {
+		return cluster.MemberName(replicas), nil
+	}
+	return "", nil
+}
+
+// membershipChanged is the scale step registering the added member as a learner and removing removed members
+// from the membership. Members are removed only while all remaining members are ready, so quorum is kept.
+func (r *EtcdClusterReconciler) membershipChanged(cluster *etcdaenixiov1alpha1.EtcdCluster) func(context.Context, *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+	return func(ctx context.Context, state *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+		sts := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(cluster), sts); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		if ptr.Deref(sts.Spec.Replicas, 0) > *cluster.Spec.Replicas {
+			for _, name := range cluster.MemberNames() {
+				if ready, err := memberReady(ctx, r.Client, cluster, name); !ready || err != nil {
+					return false, err
+				}
+			}
+		}
+		cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+		if err != nil {
+			return false, fmt.Errorf("cannot create etcd client: %w", err)
+		}
+		defer func() {
+			_ = cli.Close()
+		}()
+		// members left to add are added by the next passes, once the learner of this one is promoted
+		peerURLs := memberPeerURLs(cluster)[:factory.ScaledReplicas(cluster, state)]
+		if _, err = etcd.ScaleMembership(ctx, cli, peerURLs); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+}
+
+// membersScaled is the scale step waiting for the StatefulSet to run the number of ready members of the pass.
+func (r *EtcdClusterReconciler) membersScaled(cluster *etcdaenixiov1alpha1.EtcdCluster) func(context.Context, *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+	return func(ctx context.Context, state *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+		sts := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(cluster), sts); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		replicas := factory.ScaledReplicas(cluster, state)
+		return ptr.Deref(sts.Spec.Replicas, 0) == replicas && sts.Status.ReadyReplicas == replicas, nil
+	}
+}
+
+// learnersPromoted is the scale step promoting added members to voting members once they catch up with the leader.
+func (r *EtcdClusterReconciler) learnersPromoted(cluster *etcdaenixiov1alpha1.EtcdCluster) func(context.Context, *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+	return func(ctx context.Context, _ *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+		cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+		if err != nil {
+			return false, fmt.Errorf("cannot create etcd client: %w", err)
+		}
+		defer func() {
+			_ = cli.Close()
+		}()
+		return etcd.PromoteLearners(ctx, cli, memberPeerURLs(cluster))
+	}
+}
+
+// reportOutOfBandReplicas records a warning event if replicas of the cluster StatefulSet were changed bypassing
+// member management, e.g. by kubectl scale. The change is reverted by factory.CreateOrUpdateStatefulSet.
+func (r *EtcdClusterReconciler) reportOutOfBandReplicas(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	sts := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(cluster), sts); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if applied, edited := factory.OutOfBandReplicas(sts); edited {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "StatefulSetReplicasReverted",
+			"Replicas of StatefulSet %s were changed to %d bypassing member management, reverting to %d, change spec.replicas instead",
+			sts.Name, ptr.Deref(sts.Spec.Replicas, 0), applied)
+	}
+	return nil
+}
+
+// memberPeerURLs returns peer URLs of all cluster members.
+func memberPeerURLs(cluster *etcdaenixiov1alpha1.EtcdCluster) []string {
+	names := cluster.MemberNames()
+	urls := make([]string, 0, len(names))
+	for _, name := range names {
+		urls = append(urls, etcd.PeerURL(cluster, name))
+	}
+	return urls
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+)
+
+// referencedSecrets returns names of the Secrets provided by users the cluster references, i.e. TLS secrets
+// and backup credentials. Secrets created by the operator are not included.
+func referencedSecrets(cluster *etcdaenixiov1alpha1.EtcdCluster) []string {
+	var names []string
+	if security := cluster.Spec.Security; security != nil {
+		tls := security.TLS
+		for _, name := range []string{tls.PeerTrustedCASecret, tls.PeerSecret, tls.ServerSecret,
+			tls.ClientTrustedCASecret, tls.ClientSecret, tls.ClientCRLSecret} {
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	if cluster.Spec.Backup != nil {
+		for _, destination := range cluster.Spec.Backup.AllDestinations() {
+			for _, ref := range backup.CredentialRefs(destination) {
+				names = append(names, ref.Name)
+			}
+		}
+	}
+	return names
+}
+
+// clustersReferencingSecret maps a Secret to clusters in its namespace referencing it. Secrets are watched
+// as metadata only, their content is read when clusters are reconciled.
+func (r *EtcdClusterReconciler) clustersReferencingSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	clusters := &etcdaenixiov1alpha1.EtcdClusterList{}
+	if err := r.List(ctx, clusters, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "cannot list clusters")
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range clusters.Items {
+		if slices.Contains(referencedSecrets(&clusters.Items[i]), obj.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&clusters.Items[i])})
+		}
+	}
+	return requests
+}
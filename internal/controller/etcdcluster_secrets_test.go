@@ -0,0 +1,73 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("EtcdCluster referenced secrets", func() {
+	It("should enqueue clusters referencing changed secrets", func(ctx SpecContext) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		tlsCluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "tls"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Security: &etcdaenixiov1alpha1.SecuritySpec{
+					TLS: etcdaenixiov1alpha1.TLSSpec{ServerSecret: "server-tls", ClientSecret: "client-tls"},
+				},
+			},
+		}
+		backupCluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "backup"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+					Destination: etcdaenixiov1alpha1.BackupDestination{
+						S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups", CredentialsSecret: "s3"},
+					},
+				},
+			},
+		}
+		otherNamespace := tlsCluster.DeepCopy()
+		otherNamespace.Namespace = "other"
+		Expect(referencedSecrets(tlsCluster)).To(ConsistOf("server-tls", "client-tls"))
+
+		r := &EtcdClusterReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(tlsCluster, backupCluster, otherNamespace).Build(),
+		}
+		secret := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "server-tls"}}
+		Expect(r.clustersReferencingSecret(ctx, secret)).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "tls"}},
+		))
+		secret.Name = "s3"
+		Expect(r.clustersReferencingSecret(ctx, secret)).To(ConsistOf(
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "backup"}},
+		))
+		secret.Name = "unrelated"
+		Expect(r.clustersReferencingSecret(ctx, secret)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,159 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+const (
+	// servingCheckInterval is how often members excluded from the client Service are checked again.
+	servingCheckInterval = 10 * time.Second
+
+	reasonMemberServing   = "MemberServing"
+	reasonMemberLearner   = "MemberIsLearner"
+	reasonMemberUnhealthy = "MemberUnhealthy"
+)
+
+// reconcileServing sets factory.ServingReadinessGate condition of member pods. Pods of learners and unhealthy
+// members are not ready, so they are removed from the client Service endpoints and clients never read from
+// a member which is still catching up. It returns time after which excluded members have to be checked again
+// or zero if all members serve clients.
+func (r *EtcdClusterReconciler) reconcileServing(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	var pods []*corev1.Pod
+	for _, name := range cluster.MemberNames() {
+		pod := &corev1.Pod{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, pod)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("cannot get member pod %s: %w", name, err)
+		}
+		if slices.ContainsFunc(pod.Spec.ReadinessGates, func(g corev1.PodReadinessGate) bool {
+			return g.ConditionType == factory.ServingReadinessGate
+		}) {
+			pods = append(pods, pod)
+		}
+	}
+	if len(pods) == 0 {
+		return 0, nil
+	}
+
+	unhealthy, err := etcd.UnhealthyMembers(ctx, r.Client, cluster)
+	if err != nil {
+		return 0, err
+	}
+	learners, err := r.learnerMembers(ctx, cluster)
+	if err != nil {
+		return 0, err
+	}
+
+	var checkIn time.Duration
+	for _, pod := range pods {
+		condition := corev1.PodCondition{
+			Type:   factory.ServingReadinessGate,
+			Status: corev1.ConditionTrue,
+			Reason: reasonMemberServing,
+		}
+		endpoint := etcd.ClientEndpoint(cluster, pod.Name)
+		if idx := slices.IndexFunc(unhealthy, func(e etcd.MemberError) bool { return e.Endpoint == endpoint }); idx != -1 {
+			condition.Status, condition.Reason, condition.Message = corev1.ConditionFalse, reasonMemberUnhealthy, unhealthy[idx].Err.Error()
+		} else if slices.Contains(learners, pod.Name) {
+			condition.Status, condition.Reason = corev1.ConditionFalse, reasonMemberLearner
+			condition.Message = "Member is a learner catching up with the leader"
+		}
+		if condition.Status == corev1.ConditionFalse {
+			checkIn = cluster.ProbeInterval(servingCheckInterval)
+		}
+		if err = r.setPodCondition(ctx, pod, condition); err != nil {
+			return 0, err
+		}
+	}
+	return checkIn, nil
+}
+
+// learnerMembers returns names of members which are learners. Membership is not available without quorum,
+// so no learners are reported then. Members are unhealthy in this case anyway.
+func (r *EtcdClusterReconciler) learnerMembers(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) ([]string, error) {
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	var members []etcd.Member
+	err = etcd.Probe(ctx, func(ctx context.Context) (err error) {
+		members, err = etcd.ListMembers(ctx, cli)
+		return err
+	})
+	if err != nil {
+		log.FromContext(ctx).V(2).Info("cannot list members", "reason", err.Error())
+		return nil, nil
+	}
+	var learners []string
+	for _, m := range members {
+		if m.IsLearner && m.Name != "" {
+			learners = append(learners, m.Name)
+		}
+	}
+	return learners, nil
+}
+
+// setPodCondition updates the pod status condition if its status, reason or message changed.
+func (r *EtcdClusterReconciler) setPodCondition(ctx context.Context, pod *corev1.Pod, condition corev1.PodCondition) error {
+	idx := slices.IndexFunc(pod.Status.Conditions, func(c corev1.PodCondition) bool { return c.Type == condition.Type })
+	if idx != -1 {
+		current := pod.Status.Conditions[idx]
+		if current.Status == condition.Status && current.Reason == condition.Reason && current.Message == condition.Message {
+			return nil
+		}
+	}
+
+	patch := client.MergeFromWithOptions(pod.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	condition.LastTransitionTime = metav1.Now()
+	if idx == -1 {
+		pod.Status.Conditions = append(pod.Status.Conditions, condition)
+	} else {
+		if pod.Status.Conditions[idx].Status == condition.Status {
+			condition.LastTransitionTime = pod.Status.Conditions[idx].LastTransitionTime
+		}
+		pod.Status.Conditions[idx] = condition
+	}
+	if err := r.Status().Patch(ctx, pod, patch); err != nil {
+		return fmt.Errorf("cannot update serving condition of member pod %s: %w", pod.Name, err)
+	}
+	if condition.Status == corev1.ConditionFalse {
+		log.FromContext(ctx).Info("member is excluded from client service", "member", pod.Name, "reason", condition.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+var _ = Describe("EtcdCluster serving members", func() {
+	It("should update the serving condition of member pods only when it changes", func(ctx SpecContext) {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-0"}}
+		r := &EtcdClusterReconciler{Client: fake.NewClientBuilder().WithObjects(pod).WithStatusSubresource(pod).Build()}
+
+		learner := corev1.PodCondition{
+			Type:    factory.ServingReadinessGate,
+			Status:  corev1.ConditionFalse,
+			Reason:  reasonMemberLearner,
+			Message: "Member is a learner catching up with the leader",
+		}
+		Expect(r.setPodCondition(ctx, pod, learner)).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pod), pod)).To(Succeed())
+		Expect(pod.Status.Conditions).To(HaveLen(1))
+		Expect(pod.Status.Conditions[0].Status).To(Equal(corev1.ConditionFalse))
+		version := pod.ResourceVersion
+
+		Expect(r.setPodCondition(ctx, pod, learner)).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pod), pod)).To(Succeed())
+		Expect(pod.ResourceVersion).To(Equal(version))
+
+		serving := corev1.PodCondition{Type: factory.ServingReadinessGate, Status: corev1.ConditionTrue, Reason: reasonMemberServing}
+		Expect(r.setPodCondition(ctx, pod, serving)).To(Succeed())
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(pod), pod)).To(Succeed())
+		Expect(pod.Status.Conditions).To(HaveLen(1))
+		Expect(pod.Status.Conditions[0].Status).To(Equal(corev1.ConditionTrue))
+	})
+})
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// clusterStatuses is the status writer shared by all controllers updating EtcdCluster status.
+var clusterStatuses clusterStatusWriter
+
+// clusterStatusWriter writes EtcdCluster status changes made by several controllers. Writes of a cluster are
+// serialized, writes without changes are skipped, and on conflicts the changes are merged into the latest status
+// and written again, so writers don't overwrite each other and don't fail with conflicts at scale.
+type clusterStatusWriter struct {
+	// locks holds a *sync.Mutex of every cluster keyed by its namespaced name.
+	locks sync.Map
+}
+
+// write writes the changes of the cluster status made since original was read. On success cluster holds
+// the written object.
+func (w *clusterStatusWriter) write(ctx context.Context, rclient client.Client,
+	original, cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	if equality.Semantic.DeepEqual(original.Status, cluster.Status) {
+		return nil
+	}
+	key := client.ObjectKeyFromObject(cluster)
+	lock, _ := w.locks.LoadOrStore(key.String(), &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	modified := cluster.Status.DeepCopy()
+	latest := cluster.DeepCopy()
+	first := true
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			if err := rclient.Get(ctx, key, latest); err != nil {
+				return err
+			}
+			status, err := mergeClusterStatus(&original.Status, modified, &latest.Status)
+			if err != nil {
+				return err
+			}
+			if equality.Semantic.DeepEqual(latest.Status, *status) {
+				return nil
+			}
+			latest.Status = *status
+		}
+		first = false
+		return rclient.Status().Update(ctx, latest)
+	})
+	if err != nil {
+		return err
+	}
+	latest.DeepCopyInto(cluster)
+	// the stored spec replaced the normalized one
+	applyDefaultBackupPolicy(ctx, cluster)
+	return nil
+}
+
+// forget drops the lock of the deleted cluster.
+func (w *clusterStatusWriter) forget(key client.ObjectKey) {
+	w.locks.Delete(key.String())
+}
+
+// mergeClusterStatus applies the changes between original and modified to latest. Fields are merged as a JSON
+// merge patch, conditions are merged by type, so conditions changed by other writers are kept.
+func mergeClusterStatus(original, modified, latest *etcdaenixiov1alpha1.EtcdClusterStatus) (*etcdaenixiov1alpha1.EtcdClusterStatus, error) {
+	withoutConditions := func(status *etcdaenixiov1alpha1.EtcdClusterStatus) ([]byte, error) {
+		status = status.DeepCopy()
+		status.Conditions = nil
+		return json.Marshal(status)
+	}
+	originalJSON, err := withoutConditions(original)
+	if err != nil {
+		return nil, err
+	}
+	modifiedJSON, err := withoutConditions(modified)
+	if err != nil {
+		return nil, err
+	}
+	latestJSON, err := withoutConditions(latest)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.CreateMergePatch(originalJSON, modifiedJSON)
+	if err != nil {
+		return nil, err
+	}
+	mergedJSON, err := jsonpatch.MergePatch(latestJSON, patch)
+	if err != nil {
+		return nil, err
+	}
+	merged := &etcdaenixiov1alpha1.EtcdClusterStatus{}
+	if err = json.Unmarshal(mergedJSON, merged); err != nil {
+		return nil, err
+	}
+
+	merged.Conditions = append(merged.Conditions, latest.Conditions...)
+	for _, condition := range original.Conditions {
+		if meta.FindStatusCondition(modified.Conditions, condition.Type) == nil {
+			meta.RemoveStatusCondition(&merged.Conditions, condition.Type)
+		}
+	}
+	for _, condition := range modified.Conditions {
+		if previous := meta.FindStatusCondition(original.Conditions, condition.Type); previous == nil ||
+			!equality.Semantic.DeepEqual(*previous, condition) {
+			meta.SetStatusCondition(&merged.Conditions, condition)
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Cluster status writer", func() {
+	var (
+		rclient client.Client
+		updates int
+		writer  clusterStatusWriter
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+			Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+				Conditions: []metav1.Condition{
+					{Type: etcdaenixiov1alpha1.EtcdConditionReady, Status: metav1.ConditionFalse, Reason: "NotReady"},
+				},
+			},
+		}
+		updates = 0
+		writer = clusterStatusWriter{}
+		rclient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).
+			WithStatusSubresource(&etcdaenixiov1alpha1.EtcdCluster{}).
+			WithInterceptorFuncs(interceptor.Funcs{
+				SubResourceUpdate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object,
+					opts ...client.SubResourceUpdateOption) error {
+					updates++
+					return c.SubResource(subResourceName).Update(ctx, obj, opts...)
+				},
+			}).Build()
+	})
+
+	get := func(ctx SpecContext) *etcdaenixiov1alpha1.EtcdCluster {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test"}, cluster)).To(Succeed())
+		return cluster
+	}
+
+	It("should skip writes without changes", func(ctx SpecContext) {
+		cluster := get(ctx)
+		Expect(writer.write(ctx, rclient, cluster.DeepCopy(), cluster)).To(Succeed())
+		Expect(updates).To(BeZero())
+	})
+
+	It("should merge changes of concurrent writers", func(ctx SpecContext) {
+		stale := get(ctx)
+		original := stale.DeepCopy()
+
+		concurrent := get(ctx)
+		concurrentOriginal := concurrent.DeepCopy()
+		concurrent.Status.Velero = &etcdaenixiov1alpha1.VeleroStatus{LastQuiescedBackup: "daily"}
+		meta.SetStatusCondition(&concurrent.Status.Conditions, metav1.Condition{
+			Type: "Quiesced", Status: metav1.ConditionTrue, Reason: "Quiesced",
+		})
+		Expect(writer.write(ctx, rclient, concurrentOriginal, concurrent)).To(Succeed())
+
+		meta.SetStatusCondition(&stale.Status.Conditions, metav1.Condition{
+			Type: etcdaenixiov1alpha1.EtcdConditionReady, Status: metav1.ConditionTrue, Reason: "Ready",
+		})
+		stale.Status.Members = []etcdaenixiov1alpha1.MemberStatus{{Name: "test-0"}}
+		Expect(writer.write(ctx, rclient, original, stale)).To(Succeed())
+
+		cluster := get(ctx)
+		Expect(cluster.Status.Velero).NotTo(BeNil())
+		Expect(cluster.Status.Velero.LastQuiescedBackup).To(Equal("daily"))
+		Expect(cluster.Status.Members).To(HaveLen(1))
+		Expect(meta.IsStatusConditionTrue(cluster.Status.Conditions, etcdaenixiov1alpha1.EtcdConditionReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(cluster.Status.Conditions, "Quiesced")).To(BeTrue())
+		Expect(stale.ResourceVersion).To(Equal(cluster.ResourceVersion))
+		// the stale write conflicts and is retried with merged status
+		Expect(updates).To(Equal(3))
+	})
+
+	It("should drop locks of deleted clusters", func(ctx SpecContext) {
+		cluster := get(ctx)
+		original := cluster.DeepCopy()
+		cluster.Status.Members = []etcdaenixiov1alpha1.MemberStatus{{Name: "test-0"}}
+		Expect(writer.write(ctx, rclient, original, cluster)).To(Succeed())
+		_, ok := writer.locks.Load("ns/test")
+		Expect(ok).To(BeTrue())
+
+		writer.forget(client.ObjectKeyFromObject(cluster))
+		_, ok = writer.locks.Load("ns/test")
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// trafficGateInterval is how often the quorum is checked to update the traffic gate.
+const trafficGateInterval = 30 * time.Second
+
+// reconcileTrafficGate sets the TrafficReady condition and publishes it in the traffic gate ConfigMap. The cluster
+// is safe for client traffic once it formed its first quorum, while a quorum of members is healthy and the cluster
+// is not being restored from a snapshot. It returns time after which the gate has to be checked again.
+func (r *EtcdClusterReconciler) reconcileTrafficGate(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	ready, reason, message, err := r.trafficReady(ctx, cluster)
+	if err != nil {
+		return 0, err
+	}
+	previous := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionTrafficReady)
+	if previous != nil && (previous.Status == metav1.ConditionTrue) != ready {
+		eventType := corev1.EventTypeWarning
+		if ready {
+			eventType = corev1.EventTypeNormal
+		}
+		r.Recorder.Eventf(cluster, eventType, "TrafficReadyChanged", "Cluster traffic gate is %s: %s", gateState(ready), message)
+	}
+	if reason == etcdaenixiov1alpha1.EtcdCondTypeQuorumLost && (previous == nil || previous.Reason != string(reason)) {
+		r.Recorder.Event(cluster, corev1.EventTypeWarning, string(reason), string(message))
+	}
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionTrafficReady).
+		WithStatus(ready).
+		WithReason(string(reason)).
+		WithMessage(string(message)).
+		Complete())
+	if err = factory.CreateOrUpdateTrafficGateConfigMap(ctx, cluster, r.Client, r.Scheme); err != nil {
+		return 0, fmt.Errorf("cannot publish traffic gate: %w", err)
+	}
+	return cluster.ProbeInterval(trafficGateInterval), nil
+}
+
+// trafficReady checks if the cluster is safe for client traffic and returns the reason and message of the condition.
+func (r *EtcdClusterReconciler) trafficReady(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+) (bool, etcdaenixiov1alpha1.EtcdCondType, etcdaenixiov1alpha1.EtcdCondMessage, error) {
+	readyCond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionReady)
+	if readyCond == nil || readyCond.Reason == string(etcdaenixiov1alpha1.EtcdCondTypeWaitingForFirstQuorum) {
+		return false, etcdaenixiov1alpha1.EtcdCondTypeWaitingForFirstQuorum, etcdaenixiov1alpha1.EtcdReadyCondNegWaitingForQuorum, nil
+	}
+	if cluster.Status.Backup != nil && cluster.Status.Backup.RestoringFrom != "" {
+		return false, etcdaenixiov1alpha1.EtcdCondTypeRestoringFromSnapshot, etcdaenixiov1alpha1.EtcdTrafficReadyCondNegRestoring, nil
+	}
+	healthy, err := etcd.HealthyMembers(ctx, r.Client, cluster)
+	if err != nil {
+		return false, "", "", err
+	}
+	if healthy < cluster.CalculateQuorumSize() {
+		return false, etcdaenixiov1alpha1.EtcdCondTypeQuorumLost, etcdaenixiov1alpha1.EtcdQuorumLostCondPosMessage, nil
+	}
+	return true, etcdaenixiov1alpha1.EtcdCondTypeQuorumAvailable, etcdaenixiov1alpha1.EtcdTrafficReadyCondPosMessage, nil
+}
+
+// gateState describes the state of the traffic gate in events.
+func gateState(ready bool) string {
+	if ready {
+		return "open"
+	}
+	return "closed"
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+var _ = Describe("EtcdCluster traffic gate", func() {
+	var (
+		r        *EtcdClusterReconciler
+		recorder *record.FakeRecorder
+		cluster  *etcdaenixiov1alpha1.EtcdCluster
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "uid"},
+			Spec:       etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(3))},
+		}
+		recorder = record.NewFakeRecorder(10)
+		r = &EtcdClusterReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme).Build(),
+			Scheme:   scheme,
+			Recorder: recorder,
+		}
+	})
+
+	gate := func(ctx SpecContext) *corev1.ConfigMap {
+		configMap := &corev1.ConfigMap{}
+		key := client.ObjectKey{Namespace: "ns", Name: factory.GetTrafficGateConfigMapName(cluster)}
+		Expect(r.Get(ctx, key, configMap)).To(Succeed())
+		return configMap
+	}
+
+	It("should keep the gate closed until the first quorum is formed", func(ctx SpecContext) {
+		factory.FillConditions(cluster)
+		Expect(r.reconcileTrafficGate(ctx, cluster)).NotTo(BeZero())
+
+		cond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionTrafficReady)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(string(etcdaenixiov1alpha1.EtcdCondTypeWaitingForFirstQuorum)))
+		Expect(gate(ctx).Data).To(HaveKeyWithValue(factory.TrafficGateReadyKey, "false"))
+		Expect(gate(ctx).Labels).To(HaveKeyWithValue("app.kubernetes.io/managed-by", "etcd-operator"))
+	})
+
+	It("should close the gate while the cluster is restored", func(ctx SpecContext) {
+		factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionReady).
+			WithStatus(true).
+			WithReason(string(etcdaenixiov1alpha1.EtcdCondTypeStatefulSetReady)).
+			Complete())
+		factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionTrafficReady).
+			WithStatus(true).
+			WithReason(string(etcdaenixiov1alpha1.EtcdCondTypeQuorumAvailable)).
+			Complete())
+		cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{RestoringFrom: "etcd/ns/test/1.db"}
+		Expect(r.reconcileTrafficGate(ctx, cluster)).NotTo(BeZero())
+
+		cond := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionTrafficReady)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(string(etcdaenixiov1alpha1.EtcdCondTypeRestoringFromSnapshot)))
+		Expect(gate(ctx).Data).To(HaveKeyWithValue("reason", string(etcdaenixiov1alpha1.EtcdCondTypeRestoringFromSnapshot)))
+		Expect(recorder.Events).To(Receive(ContainSubstring("TrafficReadyChanged")))
+	})
+})
@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+const (
+	// veleroBackupNameLabel and veleroRestoreNameLabel are set by Velero on restored objects.
+	veleroBackupNameLabel  = "velero.io/backup-name"
+	veleroRestoreNameLabel = "velero.io/restore-name"
+	// veleroRestoreCheckInterval is how often the progress of restore from a Velero backup is checked.
+	veleroRestoreCheckInterval = 10 * time.Second
+)
+
+// veleroRestorePending checks if the cluster is restored by Velero, but its data is not restored
+// from the snapshot taken before the backup yet.
+func veleroRestorePending(cluster *etcdaenixiov1alpha1.EtcdCluster) bool {
+	if cluster.Spec.Velero == nil || !cluster.Spec.Velero.Quiesce || cluster.Spec.Backup == nil {
+		return false
+	}
+	backupName := cluster.Labels[veleroBackupNameLabel]
+	if backupName == "" || cluster.Labels[veleroRestoreNameLabel] == "" {
+		return false
+	}
+	return cluster.Status.Velero == nil || cluster.Status.Velero.RestoredBackup != backupName
+}
+
+// reconcileVeleroRestore restores data of the cluster restored by Velero from the snapshot taken before the backup.
+// Data volumes restored by Velero are backed up at different moments, so all members are restored from the snapshot
+// the same way they are restored once quorum is lost. It returns time after which the restore has to be checked
+// again or zero if there is nothing to restore.
+func (r *EtcdClusterReconciler) reconcileVeleroRestore(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) (time.Duration, error) {
+	if !veleroRestorePending(cluster) {
+		return 0, nil
+	}
+	if cluster.Status.Velero == nil {
+		cluster.Status.Velero = &etcdaenixiov1alpha1.VeleroStatus{}
+	}
+	if cluster.Status.Backup == nil {
+		cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{}
+	}
+	backupName := cluster.Labels[veleroBackupNameLabel]
+	key := backup.VeleroSnapshotKey(cluster, backupName)
+
+	if cluster.Status.Backup.RestoringFrom == key {
+		healthy, err := etcd.HealthyMembers(ctx, r.Client, cluster)
+		if err != nil {
+			return 0, err
+		}
+		if healthy < cluster.CalculateQuorumSize() {
+			// renew the lock while the restore is in progress
+			_, err = r.acquireOperationLock(ctx, cluster, factory.OperationRestore)
+			return veleroRestoreCheckInterval, err
+		}
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "Restored",
+			"Cluster is restored from snapshot of Velero backup %s", backupName)
+		cluster.Status.Backup.RestoringFrom = ""
+		cluster.Status.Velero.RestoredBackup = backupName
+		if err = factory.ReleaseOperationLock(ctx, cluster, r.Client, factory.OperationRestore); err != nil {
+			return 0, err
+		}
+		// clear the snapshot, so recreated members don't restore it again
+		return 0, factory.CreateOrUpdateClusterStateConfigMap(ctx, cluster, r.Client, r.Scheme)
+	}
+
+	storage, err := newBackupStorage(ctx, r.Client, cluster.Namespace, &cluster.Spec.Backup.Destination)
+	if err != nil {
+		return 0, err
+	}
+	exists, err := backup.SnapshotExists(ctx, storage, key)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "VeleroSnapshotMissing",
+			"There is no snapshot taken for Velero backup %s, keeping data restored by Velero", backupName)
+		cluster.Status.Velero.RestoredBackup = backupName
+		return 0, nil
+	}
+
+	if acquired, err := r.acquireOperationLock(ctx, cluster, factory.OperationRestore); !acquired {
+		return veleroRestoreCheckInterval, err
+	}
+	log.FromContext(ctx).Info("cluster is restored by Velero, restoring its data", "backup", backupName, "snapshot", key)
+	cluster.Status.Backup.RestoringFrom = key
+	if err = factory.CreateOrUpdateClusterStateConfigMap(ctx, cluster, r.Client, r.Scheme); err != nil {
+		return 0, err
+	}
+	for _, name := range cluster.MemberNames() {
+		pod := &corev1.Pod{}
+		pod.Namespace, pod.Name = cluster.Namespace, name
+		if err = r.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+			return 0, fmt.Errorf("cannot delete member pod %s: %w", name, err)
+		}
+	}
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "RestoreStarted",
+		"Cluster is restored by Velero, restoring its data from snapshot %s", key)
+	return veleroRestoreCheckInterval, nil
+}
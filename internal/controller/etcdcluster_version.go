@@ -0,0 +1,114 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// versionCheckInterval is how often etcd versions members run are checked.
+const versionCheckInterval = time.Minute
+
+// reconcileVersionDrift records the etcd version every member reports in its status and sets the VersionDrift
+// condition if some members run a version other than the one of the etcd image. Unreachable members keep
+// the version reported before. It returns time after which versions have to be checked again.
+func (r *EtcdClusterReconciler) reconcileVersionDrift(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster) time.Duration {
+	key := client.ObjectKeyFromObject(cluster).String()
+	interval := cluster.ProbeInterval(versionCheckInterval)
+	if value, ok := r.versionChecks.Load(key); ok {
+		if next := interval - time.Since(value.(time.Time)); next > 0 {
+			return next
+		}
+	}
+	r.versionChecks.Store(key, time.Now())
+
+	for i := range cluster.Status.Members {
+		member := &cluster.Status.Members[i]
+		var serverVersion string
+		err := etcd.Probe(ctx, func(ctx context.Context) (err error) {
+			serverVersion, err = etcd.GetServerVersion(ctx, metricsClient, etcd.MetricsURL(cluster, member.Name))
+			return err
+		})
+		if err != nil {
+			log.FromContext(ctx).V(2).Info("cannot get member version", "member", member.Name, "reason", err.Error())
+			continue
+		}
+		member.Version = serverVersion
+	}
+
+	previous := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionVersionDrift)
+	setVersionDriftCondition(cluster, findWorkflow(cluster, factory.OperationRollout) != nil)
+	current := factory.GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionVersionDrift)
+	if current.Reason == string(etcdaenixiov1alpha1.EtcdCondTypeVersionMismatch) &&
+		(previous == nil || previous.Reason != current.Reason) {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, current.Reason, "%s", current.Message)
+	}
+	if current.Reason == string(etcdaenixiov1alpha1.EtcdCondTypeVersionsMatch) &&
+		previous != nil && previous.Reason == string(etcdaenixiov1alpha1.EtcdCondTypeRolloutInProgress) {
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "UpgradeCompleted", "All members run etcd %s", cluster.EtcdVersion())
+	}
+	return interval
+}
+
+// setVersionDriftCondition compares versions members reported with the version of the etcd image. Drift
+// is expected while members are rolled out, it is reported with a separate reason then.
+func setVersionDriftCondition(cluster *etcdaenixiov1alpha1.EtcdCluster, rollingOut bool) {
+	expected := cluster.EtcdVersion()
+	var drifted []string
+	if expected != nil {
+		for _, member := range cluster.Status.Members {
+			actual, err := version.ParseGeneric(member.Version)
+			if err != nil {
+				continue
+			}
+			if !actual.AtLeast(expected) || !expected.AtLeast(actual) {
+				drifted = append(drifted, fmt.Sprintf("%s runs %s", member.Name, actual))
+			}
+		}
+	}
+
+	reason := etcdaenixiov1alpha1.EtcdCondTypeVersionsMatch
+	message := string(etcdaenixiov1alpha1.EtcdVersionDriftCondNegMessage)
+	switch {
+	case expected == nil:
+		reason = etcdaenixiov1alpha1.EtcdCondTypeImageVersionUnknown
+		message = string(etcdaenixiov1alpha1.EtcdVersionDriftCondUnknownImage)
+	case len(drifted) > 0 && rollingOut:
+		reason = etcdaenixiov1alpha1.EtcdCondTypeRolloutInProgress
+		message = fmt.Sprintf("Members are rolled out to etcd %s: %s", expected, strings.Join(drifted, ", "))
+	case len(drifted) > 0:
+		reason = etcdaenixiov1alpha1.EtcdCondTypeVersionMismatch
+		message = fmt.Sprintf("Members run versions other than etcd %s of the image: %s", expected, strings.Join(drifted, ", "))
+	}
+	factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionVersionDrift).
+		WithStatus(len(drifted) > 0).
+		WithReason(string(reason)).
+		WithMessage(message).
+		Complete())
+}
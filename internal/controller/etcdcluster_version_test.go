@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+var _ = Describe("EtcdCluster version drift detection", func() {
+	cluster := func(image string, versions ...string) *etcdaenixiov1alpha1.EtcdCluster {
+		c := &etcdaenixiov1alpha1.EtcdCluster{}
+		c.Spec.PodTemplate.Spec.Containers = []corev1.Container{{Name: "etcd", Image: image}}
+		for i, v := range versions {
+			c.Status.Members = append(c.Status.Members, etcdaenixiov1alpha1.MemberStatus{Name: fmt.Sprintf("test-%d", i), Version: v})
+		}
+		return c
+	}
+
+	It("should parse the version of a member", func() {
+		v, err := etcd.ParseServerVersion(strings.NewReader(`# TYPE etcd_server_version gauge
+etcd_server_version{server_version="3.5.13"} 1
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v).To(Equal("3.5.13"))
+	})
+
+	It("should report members running other versions", func() {
+		c := cluster("quay.io/coreos/etcd:v3.5.13", "3.5.13", "3.5.9", "")
+		setVersionDriftCondition(c, false)
+		cond := factory.GetCondition(c, etcdaenixiov1alpha1.EtcdConditionVersionDrift)
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(string(etcdaenixiov1alpha1.EtcdCondTypeVersionMismatch)))
+		Expect(cond.Message).To(ContainSubstring("test-1 runs 3.5.9"))
+		Expect(cond.Message).NotTo(ContainSubstring("test-2"))
+
+		setVersionDriftCondition(c, true)
+		cond = factory.GetCondition(c, etcdaenixiov1alpha1.EtcdConditionVersionDrift)
+		Expect(cond.Reason).To(Equal(string(etcdaenixiov1alpha1.EtcdCondTypeRolloutInProgress)))
+	})
+
+	It("should not report drift if versions match or the image version is unknown", func() {
+		c := cluster("quay.io/coreos/etcd:v3.5.13", "3.5.13", "3.5.13")
+		setVersionDriftCondition(c, false)
+		Expect(factory.GetCondition(c, etcdaenixiov1alpha1.EtcdConditionVersionDrift).Status).To(Equal(metav1.ConditionFalse))
+
+		c = cluster("quay.io/coreos/etcd:latest", "3.5.9")
+		setVersionDriftCondition(c, false)
+		cond := factory.GetCondition(c, etcdaenixiov1alpha1.EtcdConditionVersionDrift)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(string(etcdaenixiov1alpha1.EtcdCondTypeImageVersionUnknown)))
+	})
+})
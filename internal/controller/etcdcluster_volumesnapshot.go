@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+// VolumeSnapshotDriver is the driver of VolumeSnapshotClasses snapshots taken by the operator are published with.
+const VolumeSnapshotDriver = "backup.etcd.aenix.io"
+
+var (
+	volumeSnapshotGVK        = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+	volumeSnapshotContentGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshotContent"}
+)
+
+// publishVolumeSnapshot publishes the snapshot stored under the key as a pre-provisioned VolumeSnapshotContent
+// bound to a VolumeSnapshot in the cluster namespace. The operator acts as the driver of the snapshot class,
+// so it marks the content ready itself, and the snapshot controller propagates it to the VolumeSnapshot.
+// Published objects are retained when the cluster is deleted and the snapshot data is never deleted with them.
+// It returns the name of the VolumeSnapshot.
+func (r *EtcdClusterReconciler) publishVolumeSnapshot(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	key string,
+	size int64,
+	takenAt time.Time,
+) (string, error) {
+	snapshotName, contentName := volumeSnapshotNames(cluster, takenAt)
+	handle := backup.SnapshotURL(&cluster.Spec.Backup.Destination, key)
+	labels := factory.NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy()
+
+	content := &unstructured.Unstructured{}
+	content.SetGroupVersionKind(volumeSnapshotContentGVK)
+	content.SetName(contentName)
+	content.SetLabels(labels)
+	content.Object["spec"] = map[string]interface{}{
+		"driver":                  VolumeSnapshotDriver,
+		"deletionPolicy":          "Retain",
+		"volumeSnapshotClassName": cluster.Spec.Backup.VolumeSnapshots.ClassName,
+		"source": map[string]interface{}{
+			"snapshotHandle": handle,
+		},
+		"volumeSnapshotRef": map[string]interface{}{
+			"namespace": cluster.Namespace,
+			"name":      snapshotName,
+		},
+	}
+	if err := r.Create(ctx, content); client.IgnoreAlreadyExists(err) != nil {
+		return "", fmt.Errorf("cannot create volume snapshot content %s: %w", contentName, err)
+	}
+	content.Object["status"] = map[string]interface{}{
+		"readyToUse":     true,
+		"snapshotHandle": handle,
+		"creationTime":   takenAt.UnixNano(),
+		"restoreSize":    size,
+	}
+	if err := r.Status().Update(ctx, content); err != nil && !errors.IsConflict(err) {
+		return "", fmt.Errorf("cannot update volume snapshot content %s status: %w", contentName, err)
+	}
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	snapshot.SetNamespace(cluster.Namespace)
+	snapshot.SetName(snapshotName)
+	snapshot.SetLabels(labels)
+	snapshot.Object["spec"] = map[string]interface{}{
+		"volumeSnapshotClassName": cluster.Spec.Backup.VolumeSnapshots.ClassName,
+		"source": map[string]interface{}{
+			"volumeSnapshotContentName": contentName,
+		},
+	}
+	if err := r.Create(ctx, snapshot); client.IgnoreAlreadyExists(err) != nil {
+		return "", fmt.Errorf("cannot create volume snapshot %s: %w", snapshotName, err)
+	}
+	return snapshotName, nil
+}
+
+// volumeSnapshotNames returns names of the VolumeSnapshot and the VolumeSnapshotContent of the cluster snapshot
+// taken at the given time. Content is cluster-scoped, so its name is made unique with the cluster UID.
+func volumeSnapshotNames(cluster *etcdaenixiov1alpha1.EtcdCluster, takenAt time.Time) (string, string) {
+	suffix := strings.ToLower(takenAt.UTC().Format("20060102T150405Z"))
+	return cluster.Name + "-" + suffix, fmt.Sprintf("etcd-%s-%s", cluster.UID, suffix)
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+// workflowStep is a step of a long-running operation.
+type workflowStep struct {
+	name etcdaenixiov1alpha1.WorkflowStep
+	// disruptive steps take members down, so they are written to status before they run. Other steps are written
+	// with the rest of the status.
+	disruptive bool
+	// run applies the step and returns true once it is done. The step is run again if the operator stops before
+	// the next step is recorded, so it has to be idempotent.
+	run func(ctx context.Context, state *etcdaenixiov1alpha1.WorkflowStatus) (bool, error)
+}
+
+// workflow is a long-running operation of the cluster made of steps run in order. The phase, the current step
+// and failed attempts of the operation are recorded in status, so the operation is resumed from its current step
+// after the operator restarts instead of being started over.
+type workflow struct {
+	operation factory.Operation
+	// member is the member the operation is applied to, if any.
+	member string
+	steps  []workflowStep
+}
+
+// runWorkflow runs steps of the workflow starting from the step recorded in status, or from the first one
+// if the workflow is not started yet. It returns true once all steps are done and the workflow is removed
+// from status. The caller has to hold the operation lock.
+func (r *EtcdClusterReconciler) runWorkflow(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, w workflow) (bool, error) {
+	original := cluster.DeepCopy()
+	now := metav1.NewTime(time.Now().Truncate(time.Second))
+	state := findWorkflow(cluster, w.operation)
+	if state == nil {
+		cluster.Status.Workflows = append(cluster.Status.Workflows, etcdaenixiov1alpha1.WorkflowStatus{
+			Operation:     string(w.operation),
+			Member:        w.member,
+			Phase:         etcdaenixiov1alpha1.WorkflowPhaseRunning,
+			Step:          w.steps[0].name,
+			StartTime:     now,
+			StepStartTime: now,
+		})
+		state = findWorkflow(cluster, w.operation)
+	}
+	idx := slices.IndexFunc(w.steps, func(s workflowStep) bool { return s.name == state.Step })
+	if idx == -1 {
+		// the step is unknown to this version of the operator, steps are idempotent, so the operation is started over
+		log.FromContext(ctx).Info("unknown workflow step, starting the operation over", "operation", w.operation, "step", state.Step)
+		idx = 0
+	}
+
+	for ; idx < len(w.steps); idx++ {
+		step := w.steps[idx]
+		if state.Step != step.name {
+			state.Step = step.name
+			state.Phase = etcdaenixiov1alpha1.WorkflowPhaseRunning
+			state.StepStartTime = now
+			state.Retries = 0
+			state.LastError = ""
+		}
+		if step.disruptive {
+			if err := r.persistStatus(ctx, original, cluster); err != nil {
+				return false, fmt.Errorf("cannot record %s step %s: %w", w.operation, step.name, err)
+			}
+			original = cluster.DeepCopy()
+			state = findWorkflow(cluster, w.operation)
+		}
+
+		done, err := step.run(ctx, state.DeepCopy())
+		// the step may replace the status, e.g. by patching the cluster
+		state = findWorkflow(cluster, w.operation)
+		if err != nil {
+			state.Phase = etcdaenixiov1alpha1.WorkflowPhaseRetrying
+			state.Retries++
+			state.LastError = err.Error()
+			return false, err
+		}
+		if !done {
+			state.Phase = etcdaenixiov1alpha1.WorkflowPhaseWaiting
+			return false, nil
+		}
+	}
+	removeWorkflow(cluster, w.operation)
+	return true, nil
+}
+
+// findWorkflow returns the state of the operation recorded in status or nil if the operation is not in progress.
+func findWorkflow(cluster *etcdaenixiov1alpha1.EtcdCluster, operation factory.Operation) *etcdaenixiov1alpha1.WorkflowStatus {
+	idx := slices.IndexFunc(cluster.Status.Workflows, func(w etcdaenixiov1alpha1.WorkflowStatus) bool {
+		return w.Operation == string(operation)
+	})
+	if idx == -1 {
+		return nil
+	}
+	return &cluster.Status.Workflows[idx]
+}
+
+// removeWorkflow removes the state of the operation from status.
+func removeWorkflow(cluster *etcdaenixiov1alpha1.EtcdCluster, operation factory.Operation) {
+	cluster.Status.Workflows = slices.DeleteFunc(cluster.Status.Workflows, func(w etcdaenixiov1alpha1.WorkflowStatus) bool {
+		return w.Operation == string(operation)
+	})
+	if len(cluster.Status.Workflows) == 0 {
+		cluster.Status.Workflows = nil
+	}
+}
+
+// resetMemberStep re-registers the member and deletes its data volumes, unless its pod is already recreated
+// since the operation started.
+func (r *EtcdClusterReconciler) resetMemberStep(cluster *etcdaenixiov1alpha1.EtcdCluster, member string) workflowStep {
+	return workflowStep{
+		name:       etcdaenixiov1alpha1.WorkflowStepResetMember,
+		disruptive: true,
+		run: func(ctx context.Context, state *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+			pod, err := r.getMemberPod(ctx, cluster, member)
+			if err != nil || pod != nil && !pod.CreationTimestamp.Before(&state.StartTime) {
+				return err == nil, err
+			}
+			return true, resetMember(ctx, r.Client, cluster, member)
+		},
+	}
+}
+
+// restartMemberStep deletes the member pod, so it is recreated by the StatefulSet, unless the pod is already
+// deleted or recreated since the step started.
+func (r *EtcdClusterReconciler) restartMemberStep(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	member string,
+	opts ...client.DeleteOption,
+) workflowStep {
+	return workflowStep{
+		name:       etcdaenixiov1alpha1.WorkflowStepRestartMember,
+		disruptive: true,
+		run: func(ctx context.Context, state *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+			pod, err := r.getMemberPod(ctx, cluster, member)
+			if err != nil || pod == nil || !pod.CreationTimestamp.Before(&state.StepStartTime) {
+				return err == nil, err
+			}
+			if err = r.Delete(ctx, pod, opts...); client.IgnoreNotFound(err) != nil {
+				return false, fmt.Errorf("cannot delete member pod %s: %w", member, err)
+			}
+			return true, nil
+		},
+	}
+}
+
+// waitForMemberStep waits for the recreated member pod to become ready.
+func (r *EtcdClusterReconciler) waitForMemberStep(cluster *etcdaenixiov1alpha1.EtcdCluster, member string) workflowStep {
+	return workflowStep{
+		name: etcdaenixiov1alpha1.WorkflowStepWaitForMember,
+		run: func(ctx context.Context, _ *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+			return memberReady(ctx, r.Client, cluster, member)
+		},
+	}
+}
+
+// getMemberPod returns the member pod or nil if it does not exist.
+func (r *EtcdClusterReconciler) getMemberPod(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, member string) (*corev1.Pod, error) {
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: member}, pod)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get member pod %s: %w", member, err)
+	}
+	return pod, nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+var _ = Describe("Cluster workflows", func() {
+	var (
+		r   *EtcdClusterReconciler
+		ran []etcdaenixiov1alpha1.WorkflowStep
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "uid"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(3)),
+				Rotation: &etcdaenixiov1alpha1.MemberRotationSpec{
+					MaxAge:      metav1.Duration{Duration: 24 * time.Hour},
+					MinInterval: metav1.Duration{Duration: time.Hour},
+				},
+			},
+		}
+		r = &EtcdClusterReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).
+				WithStatusSubresource(&etcdaenixiov1alpha1.EtcdCluster{}).Build(),
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+		ran = nil
+	})
+
+	get := func(ctx context.Context) *etcdaenixiov1alpha1.EtcdCluster {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+		Expect(r.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test"}, cluster)).To(Succeed())
+		return cluster
+	}
+
+	step := func(name etcdaenixiov1alpha1.WorkflowStep, disruptive bool, done bool, err error) workflowStep {
+		return workflowStep{
+			name:       name,
+			disruptive: disruptive,
+			run: func(context.Context, *etcdaenixiov1alpha1.WorkflowStatus) (bool, error) {
+				ran = append(ran, name)
+				return done, err
+			},
+		}
+	}
+
+	It("should record disruptive steps before running them, even if the operator is stopping", func(ctx SpecContext) {
+		stopping, stop := context.WithCancel(ctx)
+		stop()
+		cluster := get(ctx)
+		done, err := r.runWorkflow(stopping, cluster, workflow{
+			operation: factory.OperationRollout,
+			member:    "test-2",
+			steps:     []workflowStep{step(etcdaenixiov1alpha1.WorkflowStepRestartMember, true, false, nil)},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeFalse())
+
+		state := findWorkflow(get(ctx), factory.OperationRollout)
+		Expect(state).NotTo(BeNil())
+		Expect(state.Member).To(Equal("test-2"))
+		Expect(state.Step).To(Equal(etcdaenixiov1alpha1.WorkflowStepRestartMember))
+		Expect(state.Phase).To(Equal(etcdaenixiov1alpha1.WorkflowPhaseRunning))
+		Expect(findWorkflow(cluster, factory.OperationRollout).Phase).To(Equal(etcdaenixiov1alpha1.WorkflowPhaseWaiting))
+	})
+
+	It("should resume from the recorded step", func(ctx SpecContext) {
+		cluster := get(ctx)
+		cluster.Status.Workflows = []etcdaenixiov1alpha1.WorkflowStatus{{
+			Operation: string(factory.OperationRestore),
+			Phase:     etcdaenixiov1alpha1.WorkflowPhaseWaiting,
+			Step:      etcdaenixiov1alpha1.WorkflowStepRestoreData,
+		}}
+		done, err := r.runWorkflow(ctx, cluster, workflow{
+			operation: factory.OperationRestore,
+			steps: []workflowStep{
+				step(etcdaenixiov1alpha1.WorkflowStepStopMembers, false, true, nil),
+				step(etcdaenixiov1alpha1.WorkflowStepRestoreData, false, true, nil),
+				step(etcdaenixiov1alpha1.WorkflowStepStartMembers, false, true, nil),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeTrue())
+		Expect(ran).To(Equal([]etcdaenixiov1alpha1.WorkflowStep{
+			etcdaenixiov1alpha1.WorkflowStepRestoreData, etcdaenixiov1alpha1.WorkflowStepStartMembers,
+		}))
+		Expect(cluster.Status.Workflows).To(BeEmpty())
+	})
+
+	It("should count failed attempts of a step", func(ctx SpecContext) {
+		cluster := get(ctx)
+		w := workflow{
+			operation: factory.OperationScale,
+			steps:     []workflowStep{step(etcdaenixiov1alpha1.WorkflowStepScaleMembers, false, false, errors.New("boom"))},
+		}
+		for range 2 {
+			_, err := r.runWorkflow(ctx, cluster, w)
+			Expect(err).To(MatchError("boom"))
+		}
+		state := findWorkflow(cluster, factory.OperationScale)
+		Expect(state.Phase).To(Equal(etcdaenixiov1alpha1.WorkflowPhaseRetrying))
+		Expect(state.Retries).To(BeEquivalentTo(2))
+		Expect(state.LastError).To(Equal("boom"))
+	})
+
+	It("should keep workflows of other operations", func(ctx SpecContext) {
+		cluster := get(ctx)
+		cluster.Status.Workflows = []etcdaenixiov1alpha1.WorkflowStatus{
+			{Operation: string(factory.OperationRotation), Step: etcdaenixiov1alpha1.WorkflowStepResetMember},
+		}
+		done, err := r.runWorkflow(ctx, cluster, workflow{
+			operation: factory.OperationScale,
+			steps:     []workflowStep{step(etcdaenixiov1alpha1.WorkflowStepScaleMembers, false, true, nil)},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeTrue())
+		Expect(cluster.Status.Workflows).To(HaveLen(1))
+		Expect(findWorkflow(cluster, factory.OperationRotation)).NotTo(BeNil())
+	})
+
+	It("should complete the rotation of the member recreated before the restart", func(ctx SpecContext) {
+		started := metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+		cluster := get(ctx)
+		cluster.Status.Workflows = []etcdaenixiov1alpha1.WorkflowStatus{{
+			Operation:     string(factory.OperationRotation),
+			Member:        "test-0",
+			Phase:         etcdaenixiov1alpha1.WorkflowPhaseRunning,
+			Step:          etcdaenixiov1alpha1.WorkflowStepRestartMember,
+			StartTime:     started,
+			StepStartTime: started,
+		}}
+		// the pod is created after the step started, so it is the replacement
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-0", CreationTimestamp: metav1.Now()},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+		}
+		Expect(r.Create(ctx, pod)).To(Succeed())
+
+		checkIn, err := r.reconcileRotation(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkIn).To(Equal(time.Hour))
+		Expect(cluster.Status.Workflows).To(BeEmpty())
+		Expect(cluster.Status.Rotation).NotTo(BeNil())
+		Expect(cluster.Status.Rotation.LastRotatedMember).To(Equal("test-0"))
+		Expect(cluster.Status.Rotation.LastRotationTime.Time).To(BeTemporally("==", started.Time))
+	})
+})
@@ -0,0 +1,272 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+const (
+	// keySetFinalizer lets the controller delete keys of the key set with Delete deletion policy.
+	keySetFinalizer = "etcd.aenix.io/keyset"
+	// keySetResyncInterval is how often keys are compared with the cluster to revert manual changes.
+	keySetResyncInterval = 5 * time.Minute
+)
+
+// EtcdKeySetReconciler reconciles a EtcdKeySet object
+type EtcdKeySetReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdkeysets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdkeysets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdkeysets/finalizers,verbs=update
+
+// Reconcile writes keys of the key set to the referenced cluster and prunes keys under the owned prefix.
+func (r *EtcdKeySetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	keySet := &etcdaenixiov1alpha1.EtcdKeySet{}
+	if err := r.Get(ctx, req.NamespacedName, keySet); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: keySet.Namespace, Name: keySet.Spec.ClusterRef.Name}, cluster)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	clusterFound := err == nil
+
+	if !keySet.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, keySet, cluster, clusterFound)
+	}
+	if controllerutil.AddFinalizer(keySet, keySetFinalizer) {
+		if err = r.Update(ctx, keySet); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if !clusterFound {
+		return ctrl.Result{}, r.setSynced(ctx, keySet, false, etcdaenixiov1alpha1.EtcdKeySetReasonClusterNotFound,
+			fmt.Sprintf("EtcdCluster %s not found", keySet.Spec.ClusterRef.Name))
+	}
+	owner, err := r.prefixOwner(ctx, keySet)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if owner != "" {
+		return ctrl.Result{}, r.setSynced(ctx, keySet, false, etcdaenixiov1alpha1.EtcdKeySetReasonPrefixConflict,
+			fmt.Sprintf("prefix overlaps with the prefix of EtcdKeySet %s", owner))
+	}
+
+	desired, err := r.desiredKeys(ctx, keySet)
+	if err != nil {
+		return ctrl.Result{}, r.setSynced(ctx, keySet, false, etcdaenixiov1alpha1.EtcdKeySetReasonValueNotFound, err.Error())
+	}
+
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	result, err := etcd.SyncKeys(ctx, cli, keySet.Spec.Prefix, desired, keySet.Spec.Prune == nil || *keySet.Spec.Prune)
+	if err != nil {
+		logger.Error(err, "cannot sync keys")
+		return ctrl.Result{}, r.setSynced(ctx, keySet, false, etcdaenixiov1alpha1.EtcdKeySetReasonSyncFailed, err.Error())
+	}
+	if result.Written > 0 || result.Pruned > 0 {
+		r.Recorder.Eventf(keySet, corev1.EventTypeNormal, "KeysSynced",
+			"Written %d and pruned %d keys under %s", result.Written, result.Pruned, keySet.Spec.Prefix)
+	}
+
+	keySet.Status.ManagedKeys = int32(len(desired))
+	keySet.Status.ObservedGeneration = keySet.Generation
+	keySet.Status.LastSyncTime = &metav1.Time{Time: time.Now()}
+	err = r.setSynced(ctx, keySet, true, etcdaenixiov1alpha1.EtcdKeySetReasonSynced, "keys are in sync with the cluster")
+	return ctrl.Result{RequeueAfter: keySetResyncInterval}, err
+}
+
+// finalize deletes keys under the prefix if requested by the deletion policy and removes the finalizer.
+// Keys are left in place if the cluster does not exist anymore.
+func (r *EtcdKeySetReconciler) finalize(
+	ctx context.Context,
+	keySet *etcdaenixiov1alpha1.EtcdKeySet,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	clusterFound bool,
+) error {
+	if !controllerutil.ContainsFinalizer(keySet, keySetFinalizer) {
+		return nil
+	}
+	if clusterFound && keySet.Spec.DeletionPolicy == etcdaenixiov1alpha1.KeySetDeletionPolicyDelete {
+		owner, err := r.prefixOwner(ctx, keySet)
+		if err != nil {
+			return err
+		}
+		// keys under a conflicting prefix belong to another key set
+		if owner == "" {
+			cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+			if err != nil {
+				return fmt.Errorf("cannot create etcd client: %w", err)
+			}
+			defer func() {
+				_ = cli.Close()
+			}()
+			if err = etcd.DeletePrefix(ctx, cli, keySet.Spec.Prefix); err != nil {
+				return err
+			}
+		}
+	}
+	controllerutil.RemoveFinalizer(keySet, keySetFinalizer)
+	return r.Update(ctx, keySet)
+}
+
+// prefixOwner returns name of another key set of the same cluster which owns a prefix overlapping with the prefix
+// of the key set. The oldest key set owns the prefix, ties are broken by name.
+func (r *EtcdKeySetReconciler) prefixOwner(ctx context.Context, keySet *etcdaenixiov1alpha1.EtcdKeySet) (string, error) {
+	keySets := &etcdaenixiov1alpha1.EtcdKeySetList{}
+	if err := r.List(ctx, keySets, client.InNamespace(keySet.Namespace)); err != nil {
+		return "", fmt.Errorf("cannot list key sets: %w", err)
+	}
+	for i := range keySets.Items {
+		other := &keySets.Items[i]
+		if other.Name == keySet.Name || other.Spec.ClusterRef.Name != keySet.Spec.ClusterRef.Name {
+			continue
+		}
+		if !prefixesOverlap(other.Spec.Prefix, keySet.Spec.Prefix) {
+			continue
+		}
+		if olderKeySet(other, keySet) {
+			return other.Name, nil
+		}
+	}
+	return "", nil
+}
+
+func prefixesOverlap(a, b string) bool {
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+func olderKeySet(a, b *etcdaenixiov1alpha1.EtcdKeySet) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+// desiredKeys resolves values of the key set keys and returns them by full key name.
+func (r *EtcdKeySetReconciler) desiredKeys(ctx context.Context, keySet *etcdaenixiov1alpha1.EtcdKeySet) (map[string]string, error) {
+	desired := make(map[string]string, len(keySet.Spec.Keys))
+	for _, key := range keySet.Spec.Keys {
+		value := key.Value
+		if src := key.ValueFrom; src != nil {
+			switch {
+			case src.SecretKeyRef != nil:
+				secret := &corev1.Secret{}
+				name := types.NamespacedName{Namespace: keySet.Namespace, Name: src.SecretKeyRef.Name}
+				if err := r.Get(ctx, name, secret); err != nil {
+					return nil, fmt.Errorf("cannot get secret %s for key %s: %w", name.Name, key.Key, err)
+				}
+				data, ok := secret.Data[src.SecretKeyRef.Key]
+				if !ok {
+					return nil, fmt.Errorf("secret %s has no key %s", name.Name, src.SecretKeyRef.Key)
+				}
+				value = string(data)
+			case src.ConfigMapKeyRef != nil:
+				configMap := &corev1.ConfigMap{}
+				name := types.NamespacedName{Namespace: keySet.Namespace, Name: src.ConfigMapKeyRef.Name}
+				if err := r.Get(ctx, name, configMap); err != nil {
+					return nil, fmt.Errorf("cannot get config map %s for key %s: %w", name.Name, key.Key, err)
+				}
+				data, ok := configMap.Data[src.ConfigMapKeyRef.Key]
+				if !ok {
+					return nil, fmt.Errorf("config map %s has no key %s", name.Name, src.ConfigMapKeyRef.Key)
+				}
+				value = data
+			}
+		}
+		desired[keySet.Spec.Prefix+key.Key] = value
+	}
+	return desired, nil
+}
+
+func (r *EtcdKeySetReconciler) setSynced(
+	ctx context.Context,
+	keySet *etcdaenixiov1alpha1.EtcdKeySet,
+	synced bool,
+	reason, message string,
+) error {
+	status := metav1.ConditionFalse
+	if synced {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&keySet.Status.Conditions, metav1.Condition{
+		Type:               etcdaenixiov1alpha1.EtcdKeySetConditionSynced,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: keySet.Generation,
+	})
+	return r.Status().Update(ctx, keySet)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdKeySetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&etcdaenixiov1alpha1.EtcdKeySet{}).
+		Watches(&etcdaenixiov1alpha1.EtcdCluster{}, handler.EnqueueRequestsFromMapFunc(r.keySetsOfCluster)).
+		Complete(r)
+}
+
+// keySetsOfCluster enqueues key sets referencing the cluster, so they are synced once the cluster is created.
+func (r *EtcdKeySetReconciler) keySetsOfCluster(ctx context.Context, obj client.Object) []reconcile.Request {
+	keySets := &etcdaenixiov1alpha1.EtcdKeySetList{}
+	if err := r.List(ctx, keySets, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "cannot list key sets")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, keySet := range keySets.Items {
+		if keySet.Spec.ClusterRef.Name == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&keySet)})
+		}
+	}
+	return requests
+}
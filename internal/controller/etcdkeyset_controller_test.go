@@ -0,0 +1,101 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("EtcdKeySet controller", func() {
+	Context("When checking prefix ownership", func() {
+		It("should detect overlapping prefixes", func() {
+			Expect(prefixesOverlap("/config/", "/config/app/")).To(BeTrue())
+			Expect(prefixesOverlap("/config/app/", "/config/")).To(BeTrue())
+			Expect(prefixesOverlap("/config/app/", "/config/app/")).To(BeTrue())
+			Expect(prefixesOverlap("/config/app/", "/config/application/")).To(BeFalse())
+		})
+
+		It("should give the prefix to the oldest key set", func() {
+			now := time.Now()
+			older := &etcdaenixiov1alpha1.EtcdKeySet{ObjectMeta: metav1.ObjectMeta{
+				Name: "b", CreationTimestamp: metav1.NewTime(now.Add(-time.Minute)),
+			}}
+			newer := &etcdaenixiov1alpha1.EtcdKeySet{ObjectMeta: metav1.ObjectMeta{
+				Name: "a", CreationTimestamp: metav1.NewTime(now),
+			}}
+			Expect(olderKeySet(older, newer)).To(BeTrue())
+			Expect(olderKeySet(newer, older)).To(BeFalse())
+
+			older.CreationTimestamp = newer.CreationTimestamp
+			Expect(olderKeySet(newer, older)).To(BeTrue())
+		})
+	})
+
+	Context("When reconciling a key set", func() {
+		var (
+			reconciler *EtcdKeySetReconciler
+			ns         *corev1.Namespace
+			keySet     etcdaenixiov1alpha1.EtcdKeySet
+		)
+
+		BeforeEach(func(ctx SpecContext) {
+			reconciler = &EtcdKeySetReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+			}
+			ns = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "test-"}}
+			Expect(k8sClient.Create(ctx, ns)).Should(Succeed())
+			DeferCleanup(k8sClient.Delete, ns)
+
+			keySet = etcdaenixiov1alpha1.EtcdKeySet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns.Name, Name: "test"},
+				Spec: etcdaenixiov1alpha1.EtcdKeySetSpec{
+					ClusterRef: corev1.LocalObjectReference{Name: "missing"},
+					Prefix:     "/config/",
+					Keys:       []etcdaenixiov1alpha1.EtcdKey{{Key: "mode", Value: "production"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, &keySet)).Should(Succeed())
+		})
+
+		It("should report missing cluster and release the key set on deletion", func(ctx SpecContext) {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&keySet)})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(Get(&keySet)).Should(Succeed())
+			Expect(keySet.Finalizers).To(ContainElement(keySetFinalizer))
+			Expect(keySet.Status.Conditions).To(ContainElement(HaveField("Reason",
+				etcdaenixiov1alpha1.EtcdKeySetReasonClusterNotFound)))
+
+			Expect(k8sClient.Delete(ctx, &keySet)).Should(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&keySet)})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(Get(&keySet)).ShouldNot(Succeed())
+		})
+	})
+})
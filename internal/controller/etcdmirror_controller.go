@@ -0,0 +1,211 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// EtcdMirrorReconciler reconciles a EtcdMirror object
+type EtcdMirrorReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdmirrors,verbs=get;list;watch
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdmirrors/status,verbs=get;update;patch
+
+// Reconcile periodically compares replicated prefixes of the source and destination clusters and reports
+// the divergence in the mirror status.
+func (r *EtcdMirrorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	mirror := &etcdaenixiov1alpha1.EtcdMirror{}
+	if err := r.Get(ctx, req.NamespacedName, mirror); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !mirror.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	interval := mirror.Spec.Comparison.Interval.Duration
+	now := time.Now()
+	// compare right away if the spec is changed, otherwise wait for the next comparison
+	cond := meta.FindStatusCondition(mirror.Status.Conditions, etcdaenixiov1alpha1.EtcdMirrorConditionInSync)
+	if last := mirror.Status.LastComparisonTime; last != nil && cond != nil && cond.ObservedGeneration == mirror.Generation {
+		if next := last.Add(interval).Sub(now); next > 0 {
+			return ctrl.Result{RequeueAfter: next}, nil
+		}
+	}
+
+	source, err := r.getCluster(ctx, mirror.Namespace, mirror.Spec.Source.Name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	destination, err := r.getCluster(ctx, mirror.Namespace, mirror.Spec.Destination.Name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if source == nil || destination == nil {
+		return ctrl.Result{RequeueAfter: interval}, r.setInSync(ctx, mirror, false,
+			etcdaenixiov1alpha1.EtcdMirrorReasonClusterNotFound, "source or destination cluster does not exist")
+	}
+
+	comparisons, err := r.compare(ctx, mirror, source, destination)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "cannot compare clusters")
+		return ctrl.Result{RequeueAfter: interval}, r.setInSync(ctx, mirror, false,
+			etcdaenixiov1alpha1.EtcdMirrorReasonComparisonFailed, err.Error())
+	}
+
+	mirror.Status.Prefixes = comparisons
+	mirror.Status.LastComparisonTime = &metav1.Time{Time: now}
+	if diverged := divergedPrefixes(comparisons); diverged > 0 {
+		message := fmt.Sprintf("%d of %d prefixes differ", diverged, len(comparisons))
+		if meta.IsStatusConditionTrue(mirror.Status.Conditions, etcdaenixiov1alpha1.EtcdMirrorConditionInSync) {
+			r.Recorder.Event(mirror, corev1.EventTypeWarning, etcdaenixiov1alpha1.EtcdMirrorReasonDiverged, message)
+		}
+		return ctrl.Result{RequeueAfter: interval}, r.setInSync(ctx, mirror, false,
+			etcdaenixiov1alpha1.EtcdMirrorReasonDiverged, message)
+	}
+	mirror.Status.LastInSyncTime = &metav1.Time{Time: now}
+	return ctrl.Result{RequeueAfter: interval}, r.setInSync(ctx, mirror, true,
+		etcdaenixiov1alpha1.EtcdMirrorReasonInSync, "all prefixes are identical")
+}
+
+// getCluster returns the cluster or nil if it does not exist.
+func (r *EtcdMirrorReconciler) getCluster(ctx context.Context, namespace, name string) (*etcdaenixiov1alpha1.EtcdCluster, error) {
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, cluster)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return cluster, err
+}
+
+// compare builds digests of every replicated prefix in both clusters and compares them.
+func (r *EtcdMirrorReconciler) compare(
+	ctx context.Context,
+	mirror *etcdaenixiov1alpha1.EtcdMirror,
+	source, destination *etcdaenixiov1alpha1.EtcdCluster,
+) ([]etcdaenixiov1alpha1.PrefixComparison, error) {
+	sourceCli, err := etcd.NewClusterClient(ctx, r.Client, source)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create source cluster client: %w", err)
+	}
+	defer func() {
+		_ = sourceCli.Close()
+	}()
+	destinationCli, err := etcd.NewClusterClient(ctx, r.Client, destination)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create destination cluster client: %w", err)
+	}
+	defer func() {
+		_ = destinationCli.Close()
+	}()
+
+	comparisons := make([]etcdaenixiov1alpha1.PrefixComparison, 0, len(mirror.Spec.Prefixes))
+	for _, prefix := range mirror.Spec.Prefixes {
+		comparison, err := comparePrefix(ctx, sourceCli, destinationCli, prefix)
+		if err != nil {
+			return nil, err
+		}
+		comparisons = append(comparisons, comparison)
+	}
+	return comparisons, nil
+}
+
+func comparePrefix(ctx context.Context, sourceCli, destinationCli etcd.Client, prefix string) (etcdaenixiov1alpha1.PrefixComparison, error) {
+	sourceDigest, err := etcd.GetPrefixDigest(ctx, sourceCli, prefix)
+	if err != nil {
+		return etcdaenixiov1alpha1.PrefixComparison{}, fmt.Errorf("source cluster: %w", err)
+	}
+	destinationDigest, err := etcd.GetPrefixDigest(ctx, destinationCli, prefix)
+	if err != nil {
+		return etcdaenixiov1alpha1.PrefixComparison{}, fmt.Errorf("destination cluster: %w", err)
+	}
+	return prefixComparison(prefix, sourceDigest, destinationDigest), nil
+}
+
+func prefixComparison(prefix string, source, destination *etcd.PrefixDigest) etcdaenixiov1alpha1.PrefixComparison {
+	diff := etcd.DiffDigests(source, destination)
+	return etcdaenixiov1alpha1.PrefixComparison{
+		Prefix:              prefix,
+		SourceKeys:          int64(len(source.Values)),
+		DestinationKeys:     int64(len(destination.Values)),
+		SourceRevision:      source.Revision,
+		DestinationRevision: destination.Revision,
+		SourceHash:          source.Hash(),
+		DestinationHash:     destination.Hash(),
+		MissingKeys:         diff.Missing,
+		ExtraKeys:           diff.Extra,
+		DifferentKeys:       diff.Different,
+	}
+}
+
+func divergedPrefixes(comparisons []etcdaenixiov1alpha1.PrefixComparison) int {
+	diverged := 0
+	for _, c := range comparisons {
+		if c.SourceHash != c.DestinationHash {
+			diverged++
+		}
+	}
+	return diverged
+}
+
+func (r *EtcdMirrorReconciler) setInSync(
+	ctx context.Context,
+	mirror *etcdaenixiov1alpha1.EtcdMirror,
+	inSync bool,
+	reason, message string,
+) error {
+	status := metav1.ConditionFalse
+	if inSync {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&mirror.Status.Conditions, metav1.Condition{
+		Type:               etcdaenixiov1alpha1.EtcdMirrorConditionInSync,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: mirror.Generation,
+	})
+	return r.Status().Update(ctx, mirror)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdMirrorReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&etcdaenixiov1alpha1.EtcdMirror{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha256"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+func digestOf(revision int64, kvs map[string]string) *etcd.PrefixDigest {
+	digest := &etcd.PrefixDigest{Values: map[string][sha256.Size]byte{}, Revision: revision}
+	for k, v := range kvs {
+		digest.Values[k] = sha256.Sum256([]byte(v))
+	}
+	return digest
+}
+
+var _ = Describe("EtcdMirror controller", func() {
+	Context("When comparing a prefix", func() {
+		It("should report identical prefixes as in sync", func() {
+			kvs := map[string]string{"/a/1": "x", "/a/2": "y"}
+			comparison := prefixComparison("/a/", digestOf(10, kvs), digestOf(20, kvs))
+			Expect(comparison.SourceKeys).To(Equal(int64(2)))
+			Expect(comparison.SourceHash).To(Equal(comparison.DestinationHash))
+			Expect(comparison.SourceRevision).To(Equal(int64(10)))
+			Expect(comparison.DestinationRevision).To(Equal(int64(20)))
+			Expect(divergedPrefixes([]etcdaenixiov1alpha1.PrefixComparison{comparison})).To(BeZero())
+		})
+
+		It("should count missing, extra and different keys", func() {
+			source := digestOf(10, map[string]string{"/a/1": "x", "/a/2": "y", "/a/3": "z"})
+			destination := digestOf(8, map[string]string{"/a/1": "x", "/a/2": "old", "/a/4": "w"})
+			comparison := prefixComparison("/a/", source, destination)
+			Expect(comparison.MissingKeys).To(Equal(int64(1)))
+			Expect(comparison.ExtraKeys).To(Equal(int64(1)))
+			Expect(comparison.DifferentKeys).To(Equal(int64(1)))
+			Expect(comparison.SourceHash).ToNot(Equal(comparison.DestinationHash))
+			Expect(divergedPrefixes([]etcdaenixiov1alpha1.PrefixComparison{comparison})).To(Equal(1))
+		})
+	})
+})
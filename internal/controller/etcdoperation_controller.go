@@ -0,0 +1,299 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+const (
+	// operationLockRetryInterval is how often a pending operation checks if the operation lock is released.
+	operationLockRetryInterval = 30 * time.Second
+	// operationRecoveryInterval is how often a running operation checks if the cluster recovered.
+	operationRecoveryInterval = 10 * time.Second
+)
+
+// EtcdOperationReconciler reconciles a EtcdOperation object
+type EtcdOperationReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdoperations,verbs=get;list;watch
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdoperations/status,verbs=get;update;patch
+
+// Reconcile performs the action requested by the operation once and reports the result in the operation status.
+// Disruptive actions hold the operation lock of the cluster, so they wait for other operations to finish.
+// Finished operations are never performed again.
+func (r *EtcdOperationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	operation := &etcdaenixiov1alpha1.EtcdOperation{}
+	if err := r.Get(ctx, req.NamespacedName, operation); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !operation.DeletionTimestamp.IsZero() || operation.Finished() {
+		return ctrl.Result{}, nil
+	}
+
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: operation.Namespace, Name: operation.Spec.Cluster.Name}, cluster)
+	if errors.IsNotFound(err) {
+		return ctrl.Result{}, r.setPhase(ctx, operation, etcdaenixiov1alpha1.EtcdOperationPhaseFailed,
+			etcdaenixiov1alpha1.EtcdOperationReasonClusterNotFound,
+			fmt.Sprintf("cluster %s does not exist", operation.Spec.Cluster.Name))
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	applyDefaultBackupPolicy(ctx, cluster)
+
+	lock := operationLock(operation.Spec.Type)
+	var holder factory.Operation
+	if lock != "" {
+		if holder, err = factory.AcquireOperationLock(ctx, cluster, r.Client, r.Scheme, lock); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if operation.Status.Phase == etcdaenixiov1alpha1.EtcdOperationPhaseRunning {
+		// the action is performed already, even if the lock is taken over meanwhile
+		return r.waitForRecovery(ctx, operation, cluster, lock)
+	}
+	if holder != lock {
+		return ctrl.Result{RequeueAfter: operationLockRetryInterval}, r.setPhase(ctx, operation,
+			etcdaenixiov1alpha1.EtcdOperationPhasePending, etcdaenixiov1alpha1.EtcdOperationReasonWaitingForLock,
+			fmt.Sprintf("waiting for %s operation to finish", holder))
+	}
+
+	log.FromContext(ctx).Info("performing operation", "type", operation.Spec.Type, "cluster", cluster.Name)
+	operation.Status.StartTime = &metav1.Time{Time: time.Now()}
+	message, err := r.perform(ctx, operation, cluster)
+	if err != nil {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "OperationFailed",
+			"%s operation %s failed: %v", operation.Spec.Type, operation.Name, err)
+		if releaseErr := releaseOperationLock(ctx, cluster, r.Client, lock); releaseErr != nil {
+			return ctrl.Result{}, releaseErr
+		}
+		return ctrl.Result{}, r.setPhase(ctx, operation, etcdaenixiov1alpha1.EtcdOperationPhaseFailed,
+			etcdaenixiov1alpha1.EtcdOperationReasonFailed, err.Error())
+	}
+
+	if operation.Spec.Type == etcdaenixiov1alpha1.EtcdOperationRemoveMember {
+		// the member rejoins the cluster once its pod is recreated
+		return ctrl.Result{RequeueAfter: operationRecoveryInterval}, r.setPhase(ctx, operation,
+			etcdaenixiov1alpha1.EtcdOperationPhaseRunning, etcdaenixiov1alpha1.EtcdOperationReasonRunning, message)
+	}
+	return ctrl.Result{}, r.succeed(ctx, operation, cluster, lock, message)
+}
+
+// operationLock returns the operation lock the action is performed under or empty string
+// if the action does not disrupt the cluster.
+func operationLock(operationType etcdaenixiov1alpha1.EtcdOperationType) factory.Operation {
+	switch operationType {
+	case etcdaenixiov1alpha1.EtcdOperationDefragment:
+		return factory.OperationDefragment
+	case etcdaenixiov1alpha1.EtcdOperationRemoveMember:
+		return factory.OperationRemoveMember
+	default:
+		return ""
+	}
+}
+
+// releaseOperationLock releases the operation lock held for the action, if any.
+func releaseOperationLock(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	lock factory.Operation,
+) error {
+	if lock == "" {
+		return nil
+	}
+	return factory.ReleaseOperationLock(ctx, cluster, rclient, lock)
+}
+
+// perform performs the action requested by the operation and returns the message describing the result.
+func (r *EtcdOperationReconciler) perform(
+	ctx context.Context,
+	operation *etcdaenixiov1alpha1.EtcdOperation,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+) (string, error) {
+	spec := operation.Spec
+	if spec.Member != "" && !slices.Contains(cluster.MemberNames(), spec.Member) {
+		return "", fmt.Errorf("member %q does not exist in the cluster", spec.Member)
+	}
+	switch spec.Type {
+	case etcdaenixiov1alpha1.EtcdOperationSnapshot:
+		if cluster.Spec.Backup == nil {
+			return "", fmt.Errorf("cluster %s has no backup destination", cluster.Name)
+		}
+		snapshot, err := snapshotCluster(ctx, r.Client, r.Recorder, cluster, operation.Status.StartTime.Time, "")
+		if err != nil {
+			return "", err
+		}
+		if err = snapshot.err(); err != nil {
+			return "", err
+		}
+		operation.Status.SnapshotKey = snapshot.key
+		return fmt.Sprintf("snapshot is taken to %s", snapshot.key), nil
+	case etcdaenixiov1alpha1.EtcdOperationRemoveMember:
+		if err := resetMember(ctx, r.Client, cluster, spec.Member); err != nil {
+			return "", err
+		}
+		pod := &corev1.Pod{}
+		pod.Namespace, pod.Name = cluster.Namespace, spec.Member
+		if err := r.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+			return "", fmt.Errorf("cannot delete member pod %s: %w", spec.Member, err)
+		}
+		return fmt.Sprintf("member %s is removed with its data, waiting for it to rejoin the cluster", spec.Member), nil
+	}
+
+	cli, err := etcd.NewClusterClient(ctx, r.Client, cluster)
+	if err != nil {
+		return "", fmt.Errorf("cannot create etcd client: %w", err)
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+	switch spec.Type {
+	case etcdaenixiov1alpha1.EtcdOperationDefragment:
+		members := []string{spec.Member}
+		if spec.Member == "" {
+			leader, err := etcd.LeaderName(ctx, cli)
+			if err != nil {
+				return "", err
+			}
+			// the leader is defragmented last, so the cluster keeps the leader while followers are blocked
+			members = slices.DeleteFunc(cluster.MemberNames(), func(name string) bool { return name == leader })
+			members = append(members, leader)
+		}
+		endpoints := make([]string, 0, len(members))
+		for _, member := range members {
+			endpoints = append(endpoints, etcd.ClientEndpoint(cluster, member))
+		}
+		if err = etcd.Defragment(ctx, cli, endpoints); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d members are defragmented", len(members)), nil
+	case etcdaenixiov1alpha1.EtcdOperationCompact:
+		var revision int64
+		if spec.Revision != nil {
+			revision = *spec.Revision
+		}
+		if operation.Status.Revision, err = etcd.Compact(ctx, cli, revision); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("history is compacted at revision %d", operation.Status.Revision), nil
+	case etcdaenixiov1alpha1.EtcdOperationMoveLeader:
+		if operation.Status.Leader, err = etcd.MoveLeader(ctx, cli, spec.Member); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s is the leader", operation.Status.Leader), nil
+	}
+	return "", fmt.Errorf("unknown operation type %q", spec.Type)
+}
+
+// waitForRecovery completes the running operation once all members are ready again.
+func (r *EtcdOperationReconciler) waitForRecovery(
+	ctx context.Context,
+	operation *etcdaenixiov1alpha1.EtcdOperation,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	lock factory.Operation,
+) (ctrl.Result, error) {
+	ready, err := membersReady(ctx, r.Client, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !ready {
+		return ctrl.Result{RequeueAfter: operationRecoveryInterval}, nil
+	}
+	return ctrl.Result{}, r.succeed(ctx, operation, cluster, lock,
+		fmt.Sprintf("member %s rejoined the cluster", operation.Spec.Member))
+}
+
+// succeed releases the operation lock and marks the operation succeeded.
+func (r *EtcdOperationReconciler) succeed(
+	ctx context.Context,
+	operation *etcdaenixiov1alpha1.EtcdOperation,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	lock factory.Operation,
+	message string,
+) error {
+	if err := releaseOperationLock(ctx, cluster, r.Client, lock); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "OperationSucceeded",
+		"%s operation %s succeeded: %s", operation.Spec.Type, operation.Name, message)
+	return r.setPhase(ctx, operation, etcdaenixiov1alpha1.EtcdOperationPhaseSucceeded,
+		etcdaenixiov1alpha1.EtcdOperationReasonSucceeded, message)
+}
+
+// setPhase updates the phase of the operation together with its Completed condition.
+func (r *EtcdOperationReconciler) setPhase(
+	ctx context.Context,
+	operation *etcdaenixiov1alpha1.EtcdOperation,
+	phase etcdaenixiov1alpha1.EtcdOperationPhase,
+	reason, message string,
+) error {
+	status := metav1.ConditionUnknown
+	switch phase {
+	case etcdaenixiov1alpha1.EtcdOperationPhaseSucceeded:
+		status = metav1.ConditionTrue
+		r.Recorder.Event(operation, corev1.EventTypeNormal, reason, message)
+	case etcdaenixiov1alpha1.EtcdOperationPhaseFailed:
+		status = metav1.ConditionFalse
+		r.Recorder.Event(operation, corev1.EventTypeWarning, reason, message)
+	}
+	operation.Status.Phase = phase
+	if operation.Finished() {
+		operation.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	}
+	meta.SetStatusCondition(&operation.Status.Conditions, metav1.Condition{
+		Type:               etcdaenixiov1alpha1.EtcdOperationConditionCompleted,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: operation.Generation,
+	})
+	return r.Status().Update(ctx, operation)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdOperationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&etcdaenixiov1alpha1.EtcdOperation{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+var _ = Describe("EtcdOperation controller", func() {
+	var (
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+		r       *EtcdOperationReconciler
+	)
+
+	newOperation := func(operationType etcdaenixiov1alpha1.EtcdOperationType, member string) *etcdaenixiov1alpha1.EtcdOperation {
+		return &etcdaenixiov1alpha1.EtcdOperation{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "op"},
+			Spec: etcdaenixiov1alpha1.EtcdOperationSpec{
+				Cluster: corev1.LocalObjectReference{Name: "test"},
+				Type:    operationType,
+				Member:  member,
+			},
+		}
+	}
+	reconcile := func(ctx SpecContext, operation *etcdaenixiov1alpha1.EtcdOperation) (ctrl.Result, *etcdaenixiov1alpha1.EtcdOperation) {
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: operation.Namespace, Name: operation.Name}}
+		result, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, req.NamespacedName, operation)).To(Succeed())
+		return result, operation
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+			Spec:       etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(1))},
+		}
+		r = &EtcdOperationReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).
+				WithStatusSubresource(&etcdaenixiov1alpha1.EtcdOperation{}).Build(),
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	It("should fail if the cluster does not exist", func(ctx SpecContext) {
+		operation := newOperation(etcdaenixiov1alpha1.EtcdOperationCompact, "")
+		operation.Spec.Cluster.Name = "missing"
+		Expect(r.Create(ctx, operation)).To(Succeed())
+
+		_, operation = reconcile(ctx, operation)
+		Expect(operation.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdOperationPhaseFailed))
+		Expect(operation.Status.CompletionTime).NotTo(BeNil())
+		condition := meta.FindStatusCondition(operation.Status.Conditions, etcdaenixiov1alpha1.EtcdOperationConditionCompleted)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(etcdaenixiov1alpha1.EtcdOperationReasonClusterNotFound))
+	})
+
+	It("should never perform finished operations again", func(ctx SpecContext) {
+		operation := newOperation(etcdaenixiov1alpha1.EtcdOperationSnapshot, "")
+		Expect(r.Create(ctx, operation)).To(Succeed())
+		_, operation = reconcile(ctx, operation)
+		Expect(operation.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdOperationPhaseFailed))
+		Expect(operation.Status.Conditions[0].Message).To(ContainSubstring("no backup destination"))
+
+		completion := operation.Status.CompletionTime
+		_, operation = reconcile(ctx, operation)
+		Expect(operation.Status.CompletionTime).To(Equal(completion))
+	})
+
+	It("should fail if the member does not exist", func(ctx SpecContext) {
+		operation := newOperation(etcdaenixiov1alpha1.EtcdOperationRemoveMember, "test-5")
+		Expect(r.Create(ctx, operation)).To(Succeed())
+		_, operation = reconcile(ctx, operation)
+		Expect(operation.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdOperationPhaseFailed))
+		Expect(factory.OperationLockHolder(ctx, cluster, r.Client)).To(BeEmpty())
+	})
+
+	It("should wait for other operations to finish", func(ctx SpecContext) {
+		Expect(factory.AcquireOperationLock(ctx, cluster, r.Client, r.Scheme, factory.OperationRollout)).
+			To(Equal(factory.OperationRollout))
+		operation := newOperation(etcdaenixiov1alpha1.EtcdOperationDefragment, "")
+		Expect(r.Create(ctx, operation)).To(Succeed())
+
+		result, operation := reconcile(ctx, operation)
+		Expect(result.RequeueAfter).To(Equal(operationLockRetryInterval))
+		Expect(operation.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdOperationPhasePending))
+		Expect(operation.Status.Conditions[0].Reason).To(Equal(etcdaenixiov1alpha1.EtcdOperationReasonWaitingForLock))
+	})
+
+	It("should complete member removal once the member is ready", func(ctx SpecContext) {
+		Expect(factory.AcquireOperationLock(ctx, cluster, r.Client, r.Scheme, factory.OperationRemoveMember)).
+			To(Equal(factory.OperationRemoveMember))
+		operation := newOperation(etcdaenixiov1alpha1.EtcdOperationRemoveMember, "test-0")
+		operation.Status.Phase = etcdaenixiov1alpha1.EtcdOperationPhaseRunning
+		Expect(r.Create(ctx, operation)).To(Succeed())
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-0"},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}},
+			},
+		}
+		Expect(r.Create(ctx, pod)).To(Succeed())
+
+		result, operation := reconcile(ctx, operation)
+		Expect(result.RequeueAfter).To(Equal(operationRecoveryInterval))
+		Expect(operation.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdOperationPhaseRunning))
+
+		pod.Status.Conditions[0].Status = corev1.ConditionTrue
+		Expect(r.Status().Update(ctx, pod)).To(Succeed())
+		_, operation = reconcile(ctx, operation)
+		Expect(operation.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdOperationPhaseSucceeded))
+		Expect(factory.OperationLockHolder(ctx, cluster, r.Client)).To(BeEmpty())
+	})
+})
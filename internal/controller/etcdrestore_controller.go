@@ -0,0 +1,291 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+)
+
+const (
+	// restoreBackupRetryInterval is how often a pending restore checks if the backup succeeded.
+	restoreBackupRetryInterval = 30 * time.Second
+	// restoreClusterInterval is how often a running restore checks if the cluster is bootstrapped.
+	restoreClusterInterval = 10 * time.Second
+)
+
+// EtcdRestoreReconciler reconciles a EtcdRestore object
+type EtcdRestoreReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdrestores,verbs=get;list;watch
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdrestores/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=etcd.aenix.io,resources=etcdclusters,verbs=create
+
+// Reconcile creates a new cluster bootstrapped from the snapshot of the restore and reports in the restore status
+// once the restored members form a quorum. An existing cluster is never overwritten. Finished restores are never
+// performed again, the cluster is kept when the restore is deleted.
+func (r *EtcdRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	restore := &etcdaenixiov1alpha1.EtcdRestore{}
+	if err := r.Get(ctx, req.NamespacedName, restore); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !restore.DeletionTimestamp.IsZero() || restore.Finished() {
+		return ctrl.Result{}, nil
+	}
+
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: restore.Namespace, Name: restore.Spec.Cluster.Name}, cluster)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	if restore.Status.Phase == etcdaenixiov1alpha1.EtcdRestorePhaseRestoring {
+		return r.waitForBootstrap(ctx, restore, cluster, errors.IsNotFound(err))
+	}
+	if err == nil && cluster.Labels[etcdaenixiov1alpha1.RestoreLabel] == restore.Name {
+		// the cluster is created by this restore, but the restore status was not updated afterwards
+		return r.startRestoring(ctx, restore, cluster, cluster.Annotations[etcdaenixiov1alpha1.BootstrapFromAnnotation],
+			cluster.CreationTimestamp.Time)
+	}
+	if err == nil {
+		return ctrl.Result{}, r.setPhase(ctx, restore, etcdaenixiov1alpha1.EtcdRestorePhaseFailed,
+			etcdaenixiov1alpha1.EtcdRestoreReasonClusterExists,
+			fmt.Sprintf("cluster %s exists already, restore creates a new cluster", restore.Spec.Cluster.Name))
+	}
+
+	key := restore.Spec.SnapshotKey
+	if restore.Spec.Backup != nil {
+		etcdBackup := &etcdaenixiov1alpha1.EtcdBackup{}
+		err = r.Get(ctx, types.NamespacedName{Namespace: restore.Namespace, Name: restore.Spec.Backup.Name}, etcdBackup)
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, r.setPhase(ctx, restore, etcdaenixiov1alpha1.EtcdRestorePhaseFailed,
+				etcdaenixiov1alpha1.EtcdRestoreReasonBackupNotFound,
+				fmt.Sprintf("backup %s does not exist", restore.Spec.Backup.Name))
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		switch etcdBackup.Status.Phase {
+		case etcdaenixiov1alpha1.EtcdBackupPhaseSucceeded:
+			key = etcdBackup.Status.SnapshotKey
+		case etcdaenixiov1alpha1.EtcdBackupPhaseFailed:
+			return ctrl.Result{}, r.setPhase(ctx, restore, etcdaenixiov1alpha1.EtcdRestorePhaseFailed,
+				etcdaenixiov1alpha1.EtcdRestoreReasonBackupFailed,
+				fmt.Sprintf("backup %s failed", etcdBackup.Name))
+		default:
+			return ctrl.Result{RequeueAfter: restoreBackupRetryInterval}, r.setPhase(ctx, restore,
+				etcdaenixiov1alpha1.EtcdRestorePhasePending, etcdaenixiov1alpha1.EtcdRestoreReasonWaitingForBackup,
+				fmt.Sprintf("waiting for backup %s to succeed", etcdBackup.Name))
+		}
+	}
+
+	if restore.Spec.Cluster.Spec.Backup == nil {
+		return ctrl.Result{}, r.setPhase(ctx, restore, etcdaenixiov1alpha1.EtcdRestorePhaseFailed,
+			etcdaenixiov1alpha1.EtcdRestoreReasonSnapshotNotFound, "cluster has no backup destination to restore from")
+	}
+	// the snapshot is checked before the cluster is created, since members never start without it
+	storage, err := newBackupStorage(ctx, r.Client, restore.Namespace, &restore.Spec.Cluster.Spec.Backup.Destination)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	exists, err := backup.SnapshotExists(ctx, storage, key)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !exists {
+		return ctrl.Result{}, r.setPhase(ctx, restore, etcdaenixiov1alpha1.EtcdRestorePhaseFailed,
+			etcdaenixiov1alpha1.EtcdRestoreReasonSnapshotNotFound,
+			fmt.Sprintf("snapshot %s does not exist in the backup destination of the cluster", key))
+	}
+
+	cluster = restoredCluster(restore, key)
+	if err = r.Create(ctx, cluster); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return ctrl.Result{}, r.setPhase(ctx, restore, etcdaenixiov1alpha1.EtcdRestorePhaseFailed,
+				etcdaenixiov1alpha1.EtcdRestoreReasonClusterExists,
+				fmt.Sprintf("cluster %s exists already, restore creates a new cluster", cluster.Name))
+		}
+		return ctrl.Result{}, fmt.Errorf("cannot create cluster %s: %w", cluster.Name, err)
+	}
+	log.FromContext(ctx).Info("cluster created from snapshot", "cluster", cluster.Name, "snapshot", key)
+	return r.startRestoring(ctx, restore, cluster, key, time.Now())
+}
+
+// startRestoring records in the restore status that the cluster is created from the snapshot stored under the key,
+// the restore then waits for the cluster to be bootstrapped.
+func (r *EtcdRestoreReconciler) startRestoring(
+	ctx context.Context,
+	restore *etcdaenixiov1alpha1.EtcdRestore,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	key string,
+	start time.Time,
+) (ctrl.Result, error) {
+	restore.Status.SnapshotKey = key
+	restore.Status.StartTime = &metav1.Time{Time: start}
+	return ctrl.Result{RequeueAfter: restoreClusterInterval}, r.setPhase(ctx, restore,
+		etcdaenixiov1alpha1.EtcdRestorePhaseRestoring, etcdaenixiov1alpha1.EtcdRestoreReasonRestoring,
+		fmt.Sprintf("cluster %s is created, members restore snapshot %s", cluster.Name, key))
+}
+
+// restoredCluster returns the cluster of the restore bootstrapped from the snapshot stored under the key.
+func restoredCluster(restore *etcdaenixiov1alpha1.EtcdRestore, key string) *etcdaenixiov1alpha1.EtcdCluster {
+	template := restore.Spec.Cluster
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   restore.Namespace,
+			Name:        template.Name,
+			Labels:      maps.Clone(template.Labels),
+			Annotations: maps.Clone(template.Annotations),
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	if cluster.Labels == nil {
+		cluster.Labels = map[string]string{}
+	}
+	cluster.Labels[etcdaenixiov1alpha1.RestoreLabel] = restore.Name
+	if cluster.Annotations == nil {
+		cluster.Annotations = map[string]string{}
+	}
+	cluster.Annotations[etcdaenixiov1alpha1.BootstrapFromAnnotation] = key
+	return cluster
+}
+
+// waitForBootstrap completes the restore once the created cluster is bootstrapped from the snapshot.
+func (r *EtcdRestoreReconciler) waitForBootstrap(
+	ctx context.Context,
+	restore *etcdaenixiov1alpha1.EtcdRestore,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	deleted bool,
+) (ctrl.Result, error) {
+	if deleted || cluster.Labels[etcdaenixiov1alpha1.RestoreLabel] != restore.Name {
+		return ctrl.Result{}, r.setPhase(ctx, restore, etcdaenixiov1alpha1.EtcdRestorePhaseFailed,
+			etcdaenixiov1alpha1.EtcdRestoreReasonClusterDeleted,
+			fmt.Sprintf("cluster %s was deleted while it was restored", restore.Spec.Cluster.Name))
+	}
+	status := cluster.Status.Backup
+	mirrored := false
+	if status != nil && status.RestoreProgress != nil && status.RestoreProgress.Snapshot == restore.Status.SnapshotKey {
+		mirrored = r.mirrorRestoreProgress(restore, status.RestoreProgress)
+	}
+	if status != nil && status.BootstrapFailure != "" {
+		return ctrl.Result{}, r.setPhase(ctx, restore, etcdaenixiov1alpha1.EtcdRestorePhaseFailed,
+			etcdaenixiov1alpha1.EtcdRestoreReasonBootstrapFailed,
+			fmt.Sprintf("cluster %s is not restored: %s", cluster.Name, status.BootstrapFailure))
+	}
+	if status == nil || status.BootstrappedFrom != restore.Status.SnapshotKey {
+		if mirrored {
+			return ctrl.Result{RequeueAfter: restoreClusterInterval}, r.Status().Update(ctx, restore)
+		}
+		return ctrl.Result{RequeueAfter: restoreClusterInterval}, nil
+	}
+	return ctrl.Result{}, r.setPhase(ctx, restore, etcdaenixiov1alpha1.EtcdRestorePhaseSucceeded,
+		etcdaenixiov1alpha1.EtcdRestoreReasonSucceeded,
+		fmt.Sprintf("cluster %s is restored from snapshot %s", cluster.Name, restore.Status.SnapshotKey))
+}
+
+// mirrorRestoreProgress copies progress of member restores of the cluster to the restore status, recording events
+// for members whose restore phase changed since the progress was last copied. It returns true if the progress changed.
+func (r *EtcdRestoreReconciler) mirrorRestoreProgress(
+	restore *etcdaenixiov1alpha1.EtcdRestore,
+	progress *etcdaenixiov1alpha1.RestoreProgress,
+) bool {
+	if equality.Semantic.DeepEqual(restore.Status.Progress, progress) {
+		return false
+	}
+	var previous []etcdaenixiov1alpha1.MemberRestoreProgress
+	if restore.Status.Progress != nil {
+		previous = restore.Status.Progress.Members
+	}
+	for _, member := range progress.Members {
+		phase := etcdaenixiov1alpha1.RestorePhasePending
+		idx := slices.IndexFunc(previous, func(m etcdaenixiov1alpha1.MemberRestoreProgress) bool { return m.Name == member.Name })
+		if idx != -1 {
+			phase = previous[idx].Phase
+		}
+		switch {
+		case member.Phase == phase:
+		case member.Phase == etcdaenixiov1alpha1.RestorePhaseFailed:
+			r.Recorder.Eventf(restore, corev1.EventTypeWarning, "MemberRestoreFailed",
+				"Member %s cannot be restored from snapshot %s", member.Name, progress.Snapshot)
+		default:
+			r.Recorder.Eventf(restore, corev1.EventTypeNormal, "MemberRestoreProgress",
+				"Member %s restore is %s, %s", member.Name, member.Phase, restoredBytes(&member))
+		}
+	}
+	restore.Status.Progress = progress.DeepCopy()
+	return true
+}
+
+// setPhase updates the phase of the restore together with its Completed condition.
+func (r *EtcdRestoreReconciler) setPhase(
+	ctx context.Context,
+	restore *etcdaenixiov1alpha1.EtcdRestore,
+	phase etcdaenixiov1alpha1.EtcdRestorePhase,
+	reason, message string,
+) error {
+	status := metav1.ConditionUnknown
+	switch phase {
+	case etcdaenixiov1alpha1.EtcdRestorePhaseSucceeded:
+		status = metav1.ConditionTrue
+		r.Recorder.Event(restore, corev1.EventTypeNormal, reason, message)
+	case etcdaenixiov1alpha1.EtcdRestorePhaseFailed:
+		status = metav1.ConditionFalse
+		r.Recorder.Event(restore, corev1.EventTypeWarning, reason, message)
+	}
+	restore.Status.Phase = phase
+	if restore.Finished() {
+		restore.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	}
+	meta.SetStatusCondition(&restore.Status.Conditions, metav1.Condition{
+		Type:               etcdaenixiov1alpha1.EtcdRestoreConditionCompleted,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: restore.Generation,
+	})
+	return r.Status().Update(ctx, restore)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EtcdRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&etcdaenixiov1alpha1.EtcdRestore{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
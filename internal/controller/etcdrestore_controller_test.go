@@ -0,0 +1,282 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("EtcdRestore controller", func() {
+	var r *EtcdRestoreReconciler
+
+	newRestore := func() *etcdaenixiov1alpha1.EtcdRestore {
+		return &etcdaenixiov1alpha1.EtcdRestore{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "dr"},
+			Spec: etcdaenixiov1alpha1.EtcdRestoreSpec{
+				Backup: &corev1.LocalObjectReference{Name: "nightly"},
+				Cluster: etcdaenixiov1alpha1.RestoredClusterTemplate{
+					Name:   "restored",
+					Labels: map[string]string{"team": "platform"},
+					Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+						Replicas: ptr.To(int32(3)),
+						Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+							Destination: etcdaenixiov1alpha1.BackupDestination{
+								S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups"},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	reconcile := func(ctx SpecContext, restore *etcdaenixiov1alpha1.EtcdRestore) ctrl.Result {
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: restore.Namespace, Name: restore.Name}}
+		result, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, req.NamespacedName, restore)).To(Succeed())
+		return result
+	}
+	createBackup := func(ctx SpecContext, phase etcdaenixiov1alpha1.EtcdBackupPhase) {
+		etcdBackup := &etcdaenixiov1alpha1.EtcdBackup{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "nightly"}}
+		Expect(r.Create(ctx, etcdBackup)).To(Succeed())
+		etcdBackup.Status.Phase = phase
+		Expect(r.Status().Update(ctx, etcdBackup)).To(Succeed())
+	}
+	completed := func(restore *etcdaenixiov1alpha1.EtcdRestore) *metav1.Condition {
+		return meta.FindStatusCondition(restore.Status.Conditions, etcdaenixiov1alpha1.EtcdRestoreConditionCompleted)
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		r = &EtcdRestoreReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).
+				WithStatusSubresource(&etcdaenixiov1alpha1.EtcdRestore{}, &etcdaenixiov1alpha1.EtcdBackup{}, &etcdaenixiov1alpha1.EtcdCluster{}).Build(),
+			Scheme:   scheme,
+			Recorder: record.NewFakeRecorder(10),
+		}
+	})
+
+	It("should never overwrite an existing cluster", func(ctx SpecContext) {
+		Expect(r.Create(ctx, &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "restored"},
+		})).To(Succeed())
+		restore := newRestore()
+		Expect(r.Create(ctx, restore)).To(Succeed())
+
+		reconcile(ctx, restore)
+		Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhaseFailed))
+		Expect(completed(restore).Reason).To(Equal(etcdaenixiov1alpha1.EtcdRestoreReasonClusterExists))
+	})
+
+	It("should resume the restore if its cluster is created already", func(ctx SpecContext) {
+		restore := newRestore()
+		Expect(r.Create(ctx, restore)).To(Succeed())
+		// the cluster is created, but the restore status update failed afterwards
+		cluster := restoredCluster(restore, "etcd/snapshot.db")
+		cluster.CreationTimestamp = metav1.NewTime(time.Now().Truncate(time.Second))
+		Expect(r.Create(ctx, cluster)).To(Succeed())
+
+		result := reconcile(ctx, restore)
+		Expect(result.RequeueAfter).To(Equal(restoreClusterInterval))
+		Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhaseRestoring))
+		Expect(restore.Status.SnapshotKey).To(Equal("etcd/snapshot.db"))
+		Expect(restore.Status.StartTime).To(Equal(&cluster.CreationTimestamp))
+
+		reconcile(ctx, restore)
+		Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhaseRestoring))
+	})
+
+	It("should fail if the backup does not exist", func(ctx SpecContext) {
+		restore := newRestore()
+		Expect(r.Create(ctx, restore)).To(Succeed())
+
+		reconcile(ctx, restore)
+		Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhaseFailed))
+		Expect(completed(restore).Status).To(Equal(metav1.ConditionFalse))
+		Expect(completed(restore).Reason).To(Equal(etcdaenixiov1alpha1.EtcdRestoreReasonBackupNotFound))
+	})
+
+	It("should wait for the backup to succeed", func(ctx SpecContext) {
+		createBackup(ctx, etcdaenixiov1alpha1.EtcdBackupPhaseRunning)
+		restore := newRestore()
+		Expect(r.Create(ctx, restore)).To(Succeed())
+
+		result := reconcile(ctx, restore)
+		Expect(result.RequeueAfter).To(Equal(restoreBackupRetryInterval))
+		Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhasePending))
+		Expect(completed(restore).Reason).To(Equal(etcdaenixiov1alpha1.EtcdRestoreReasonWaitingForBackup))
+	})
+
+	It("should fail if the backup failed", func(ctx SpecContext) {
+		createBackup(ctx, etcdaenixiov1alpha1.EtcdBackupPhaseFailed)
+		restore := newRestore()
+		Expect(r.Create(ctx, restore)).To(Succeed())
+
+		reconcile(ctx, restore)
+		Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhaseFailed))
+		Expect(completed(restore).Reason).To(Equal(etcdaenixiov1alpha1.EtcdRestoreReasonBackupFailed))
+	})
+
+	It("should create the cluster bootstrapped from the snapshot", func() {
+		cluster := restoredCluster(newRestore(), "etcd/snapshot.db")
+		Expect(cluster.Namespace).To(Equal("ns"))
+		Expect(cluster.Name).To(Equal("restored"))
+		Expect(cluster.Labels).To(Equal(map[string]string{"team": "platform", etcdaenixiov1alpha1.RestoreLabel: "dr"}))
+		Expect(cluster.Annotations).To(HaveKeyWithValue(etcdaenixiov1alpha1.BootstrapFromAnnotation, "etcd/snapshot.db"))
+		Expect(*cluster.Spec.Replicas).To(Equal(int32(3)))
+	})
+
+	When("the cluster is created", func() {
+		var (
+			restore *etcdaenixiov1alpha1.EtcdRestore
+			cluster *etcdaenixiov1alpha1.EtcdCluster
+		)
+
+		BeforeEach(func(ctx SpecContext) {
+			restore = newRestore()
+			Expect(r.Create(ctx, restore)).To(Succeed())
+			restore.Status.Phase = etcdaenixiov1alpha1.EtcdRestorePhaseRestoring
+			restore.Status.SnapshotKey = "etcd/snapshot.db"
+			restore.Status.StartTime = &metav1.Time{Time: time.Now()}
+			Expect(r.Status().Update(ctx, restore)).To(Succeed())
+			cluster = restoredCluster(restore, restore.Status.SnapshotKey)
+			Expect(r.Create(ctx, cluster)).To(Succeed())
+		})
+
+		It("should succeed once the cluster is bootstrapped", func(ctx SpecContext) {
+			result := reconcile(ctx, restore)
+			Expect(result.RequeueAfter).To(Equal(restoreClusterInterval))
+			Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhaseRestoring))
+
+			cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{BootstrappedFrom: "etcd/snapshot.db"}
+			Expect(r.Status().Update(ctx, cluster)).To(Succeed())
+			reconcile(ctx, restore)
+			Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhaseSucceeded))
+			Expect(completed(restore).Status).To(Equal(metav1.ConditionTrue))
+			Expect(restore.Status.CompletionTime).NotTo(BeNil())
+		})
+
+		It("should fail if the cluster is not bootstrapped from the snapshot", func(ctx SpecContext) {
+			cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{
+				BootstrapFailure: "cluster is created already, it cannot be bootstrapped from snapshot etcd/snapshot.db",
+			}
+			Expect(r.Status().Update(ctx, cluster)).To(Succeed())
+			reconcile(ctx, restore)
+			Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhaseFailed))
+			Expect(completed(restore).Reason).To(Equal(etcdaenixiov1alpha1.EtcdRestoreReasonBootstrapFailed))
+		})
+
+		It("should report progress of member restores", func(ctx SpecContext) {
+			cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{
+				RestoringFrom: "etcd/snapshot.db",
+				RestoreProgress: &etcdaenixiov1alpha1.RestoreProgress{
+					Snapshot: "etcd/snapshot.db",
+					Members: []etcdaenixiov1alpha1.MemberRestoreProgress{
+						{Name: "restored-0", Phase: etcdaenixiov1alpha1.RestorePhaseDownloading, BytesDownloaded: 512, TotalBytes: 1024},
+						{Name: "restored-1", Phase: etcdaenixiov1alpha1.RestorePhasePending},
+					},
+				},
+			}
+			Expect(r.Status().Update(ctx, cluster)).To(Succeed())
+			reconcile(ctx, restore)
+			Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhaseRestoring))
+			Expect(restore.Status.Progress).To(Equal(cluster.Status.Backup.RestoreProgress))
+			events := r.Recorder.(*record.FakeRecorder).Events
+			Expect(events).To(Receive(ContainSubstring("Member restored-0 restore is Downloading, 512 of 1024 bytes downloaded")))
+			Expect(events).NotTo(Receive())
+
+			// progress which did not change is not reported again
+			reconcile(ctx, restore)
+			Expect(events).NotTo(Receive())
+		})
+
+		It("should fail if the cluster is deleted", func(ctx SpecContext) {
+			Expect(r.Delete(ctx, cluster)).To(Succeed())
+			reconcile(ctx, restore)
+			Expect(restore.Status.Phase).To(Equal(etcdaenixiov1alpha1.EtcdRestorePhaseFailed))
+			Expect(completed(restore).Reason).To(Equal(etcdaenixiov1alpha1.EtcdRestoreReasonClusterDeleted))
+		})
+	})
+})
+
+var _ = Describe("Bootstrap from snapshot", func() {
+	var (
+		cluster  *etcdaenixiov1alpha1.EtcdCluster
+		recorder *record.FakeRecorder
+		r        *EtcdClusterReconciler
+	)
+
+	BeforeEach(func() {
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ns",
+				Name:        "restored",
+				Annotations: map[string]string{etcdaenixiov1alpha1.BootstrapFromAnnotation: "etcd/snapshot.db"},
+			},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(3)),
+				Backup:   &etcdaenixiov1alpha1.ClusterBackupSpec{},
+			},
+		}
+		recorder = record.NewFakeRecorder(10)
+		r = &EtcdClusterReconciler{Recorder: recorder}
+	})
+
+	It("should restore the snapshot into members of the new cluster", func(ctx SpecContext) {
+		checkIn, err := r.reconcileBootstrap(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkIn).To(Equal(bootstrapCheckInterval))
+		Expect(cluster.Status.Backup.RestoringFrom).To(Equal("etcd/snapshot.db"))
+		Expect(recorder.Events).To(Receive(ContainSubstring("RestoreStarted")))
+	})
+
+	It("should not restore the snapshot into members created already", func(ctx SpecContext) {
+		cluster.Status.Conditions = []metav1.Condition{
+			{Type: etcdaenixiov1alpha1.EtcdConditionInitialized, Status: metav1.ConditionTrue},
+		}
+		checkIn, err := r.reconcileBootstrap(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkIn).To(BeZero())
+		Expect(cluster.Status.Backup.RestoringFrom).To(BeEmpty())
+		Expect(cluster.Status.Backup.BootstrappedFrom).To(BeEmpty())
+		Expect(cluster.Status.Backup.BootstrapFailure).To(ContainSubstring("etcd/snapshot.db"))
+		Expect(recorder.Events).To(Receive(ContainSubstring("RestoreFailed")))
+		Expect(bootstrapSnapshot(cluster)).To(BeEmpty())
+	})
+
+	It("should do nothing once the cluster is bootstrapped", func() {
+		cluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{BootstrappedFrom: "etcd/snapshot.db"}
+		Expect(bootstrapSnapshot(cluster)).To(BeEmpty())
+	})
+})
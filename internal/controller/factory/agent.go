@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/agent"
+)
+
+// AgentContainerName is the name of the agent sidecar container of member pods.
+const AgentContainerName = "agent"
+
+// addAgentSidecar adds the agent sidecar to the pod spec if any of its functions is enabled. The sidecar
+// is added as a native sidecar container if supported, so it starts before etcd and is stopped after it.
+func addAgentSidecar(cluster *etcdaenixiov1alpha1.EtcdCluster, podSpec *corev1.PodSpec) {
+	if cluster.Spec.Agent == nil || !cluster.Spec.Agent.VolumeMetrics {
+		return
+	}
+	args := []string{agent.MetricsCommand, "--data-dir=/var/run/etcd"}
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      "data",
+			ReadOnly:  true,
+			MountPath: "/var/run/etcd",
+		},
+	}
+	if cluster.Spec.Storage.WALVolumeClaimTemplate != nil {
+		args = append(args, "--wal-dir=/var/run/etcd-wal")
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      GetWALPVCName(cluster),
+			ReadOnly:  true,
+			MountPath: "/var/run/etcd-wal",
+		})
+	}
+	container := corev1.Container{
+		Name:  AgentContainerName,
+		Image: settings.AgentImage,
+		Args:  args,
+		Ports: []corev1.ContainerPort{
+			{Name: "agent-metrics", ContainerPort: agent.MetricsPort},
+		},
+		VolumeMounts: volumeMounts,
+	}
+	if !nativeSidecar(cluster) {
+		podSpec.Containers = append(podSpec.Containers, container)
+		return
+	}
+	container.RestartPolicy = ptr.To(corev1.ContainerRestartPolicyAlways)
+	container.StartupProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(agent.MetricsPort)},
+		},
+		PeriodSeconds: 1,
+	}
+	podSpec.InitContainers = append(podSpec.InitContainers, container)
+}
+
+// nativeSidecar checks if the agent sidecar runs as a native sidecar container.
+func nativeSidecar(cluster *etcdaenixiov1alpha1.EtcdCluster) bool {
+	return ptr.Deref(cluster.Spec.Agent.NativeSidecar, settings.NativeSidecars)
+}
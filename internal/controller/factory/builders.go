@@ -24,6 +24,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -37,13 +38,12 @@ func reconcileStatefulSet(ctx context.Context, rclient client.Client, crdName st
 	currentSts := &appsv1.StatefulSet{}
 	logger.V(2).Info("statefulset found", "sts_name", currentSts.Name)
 
-	err := rclient.Get(ctx, types.NamespacedName{Namespace: sts.Namespace, Name: sts.Name}, currentSts)
+	done, err := createOrGet(ctx, rclient, sts, currentSts)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			logger.V(2).Info("creating new statefulset", "sts_name", sts.Name, "crd_object", crdName)
-			return rclient.Create(ctx, sts)
-		}
-		return fmt.Errorf("cannot get existing statefulset: %s, for crd_object: %s, err: %w", sts.Name, crdName, err)
+		return fmt.Errorf("cannot create or get existing statefulset: %s, for crd_object: %s, err: %w", sts.Name, crdName, err)
+	}
+	if done {
+		return nil
 	}
 	sts.Annotations = labels.Merge(currentSts.Annotations, sts.Annotations)
 	logger.V(2).Info("statefulset annotations merged", "sts_annotations", sts.Annotations)
@@ -58,13 +58,12 @@ func reconcileConfigMap(ctx context.Context, rclient client.Client, crdName stri
 	currentConfigMap := &corev1.ConfigMap{}
 	logger.V(2).Info("configmap found", "cm_name", currentConfigMap.Name)
 
-	err := rclient.Get(ctx, types.NamespacedName{Namespace: configMap.Namespace, Name: configMap.Name}, currentConfigMap)
+	done, err := createOrGet(ctx, rclient, configMap, currentConfigMap)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			logger.V(2).Info("creating new configMap", "cm_name", configMap.Name, "crd_object", crdName)
-			return rclient.Create(ctx, configMap)
-		}
-		return fmt.Errorf("cannot get existing configMap: %s, for crd_object: %s, err: %w", configMap.Name, crdName, err)
+		return fmt.Errorf("cannot create or get existing configMap: %s, for crd_object: %s, err: %w", configMap.Name, crdName, err)
+	}
+	if done {
+		return nil
 	}
 	configMap.Annotations = labels.Merge(currentConfigMap.Annotations, configMap.Annotations)
 	logger.V(2).Info("configmap annotations merged", "cm_annotations", configMap.Annotations)
@@ -78,13 +77,12 @@ func reconcileService(ctx context.Context, rclient client.Client, crdName string
 	currentSvc := &corev1.Service{}
 	logger.V(2).Info("service found", "svc_name", currentSvc.Name)
 
-	err := rclient.Get(ctx, types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}, currentSvc)
+	done, err := createOrGet(ctx, rclient, svc, currentSvc)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			logger.V(2).Info("creating new service", "svc_name", svc.Name, "crd_object", crdName)
-			return rclient.Create(ctx, svc)
-		}
-		return fmt.Errorf("cannot get existing service: %s, for crd_object: %s, err: %w", svc.Name, crdName, err)
+		return fmt.Errorf("cannot create or get existing service: %s, for crd_object: %s, err: %w", svc.Name, crdName, err)
+	}
+	if done {
+		return nil
 	}
 	svc.Annotations = labels.Merge(currentSvc.Annotations, svc.Annotations)
 	logger.V(2).Info("service annotations merged", "svc_annotations", svc.Annotations)
@@ -121,14 +119,12 @@ func reconcilePdb(ctx context.Context, rclient client.Client, crdName string, pd
 	currentPdb := &v1.PodDisruptionBudget{}
 	logger.V(2).Info("pdb found", "pdb_name", currentPdb.Name)
 
-	err := rclient.Get(ctx, types.NamespacedName{Namespace: pdb.Namespace, Name: pdb.Name}, currentPdb)
+	done, err := createOrGet(ctx, rclient, pdb, currentPdb)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			logger.V(2).Info("creating new PDB", "pdb_name", pdb.Name, "crd_object", crdName)
-			return rclient.Create(ctx, pdb)
-		}
-		logger.V(2).Info("error getting cluster PDB", "error", err)
-		return fmt.Errorf("cannot get existing pdb resource: %s for crd_object: %s, err: %w", pdb.Name, crdName, err)
+		return fmt.Errorf("cannot create or get existing pdb resource: %s for crd_object: %s, err: %w", pdb.Name, crdName, err)
+	}
+	if done {
+		return nil
 	}
 	pdb.Annotations = labels.Merge(currentPdb.Annotations, pdb.Annotations)
 	logger.V(2).Info("pdb annotations merged", "pdb_annotations", pdb.Annotations)
@@ -136,3 +132,51 @@ func reconcilePdb(ctx context.Context, rclient client.Client, crdName string, pd
 	pdb.Status = currentPdb.Status
 	return rclient.Update(ctx, pdb)
 }
+
+func reconcileSecret(ctx context.Context, rclient client.Client, crdName string, secret *corev1.Secret) error {
+	logger := log.FromContext(ctx)
+	logger.V(2).Info("secret reconciliation started")
+
+	currentSecret := &corev1.Secret{}
+	done, err := createOrGet(ctx, rclient, secret, currentSecret)
+	if err != nil {
+		return fmt.Errorf("cannot create or get existing secret: %s, for crd_object: %s, err: %w", secret.Name, crdName, err)
+	}
+	if done {
+		return nil
+	}
+	// secrets are never taken over, they may hold credentials of other owners
+	if owner := metav1.GetControllerOf(secret); owner != nil && !isControlledByUID(currentSecret, owner.UID) {
+		return fmt.Errorf("secret %s exists and is not managed by crd_object: %s", secret.Name, crdName)
+	}
+	secret.Annotations = labels.Merge(currentSecret.Annotations, secret.Annotations)
+	return rclient.Update(ctx, secret)
+}
+
+// createOrGet creates the object if it doesn't exist, otherwise it fetches the existing object into current
+// for the caller to update. It reports whether there is nothing left to update. Objects are read from the cache,
+// so a reconcile overlapping with the one which created the object, e.g. at cluster creation, may not see it
+// and fail to create it with AlreadyExists. Such an object is fetched and adopted by the caller updating it
+// as any existing object, or left to the reconcile triggered by its creation if the cache hasn't caught up yet.
+func createOrGet(ctx context.Context, rclient client.Client, obj, current client.Object) (bool, error) {
+	key := client.ObjectKeyFromObject(obj)
+	err := rclient.Get(ctx, key, current)
+	if !errors.IsNotFound(err) {
+		return false, err
+	}
+	log.FromContext(ctx).V(2).Info("creating new object", "name", key.Name)
+	if err = rclient.Create(ctx, obj); !errors.IsAlreadyExists(err) {
+		return err == nil, err
+	}
+	log.FromContext(ctx).V(2).Info("object was created concurrently, adopting it", "name", key.Name)
+	if err = rclient.Get(ctx, key, current); errors.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// isControlledByUID checks if the object is controlled by the owner with the UID.
+func isControlledByUID(obj metav1.Object, uid types.UID) bool {
+	owner := metav1.GetControllerOf(obj)
+	return owner != nil && owner.UID == uid
+}
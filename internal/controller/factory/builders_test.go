@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("Object reconciliation", func() {
+	var (
+		existing *corev1.ConfigMap
+		desired  *corev1.ConfigMap
+		// staleGets is the number of reads missing the existing object, as from a cache lagging behind
+		staleGets int
+		rclient   client.Client
+	)
+
+	BeforeEach(func() {
+		existing = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-cluster-state"},
+			Data:       map[string]string{"ETCD_INITIAL_CLUSTER_STATE": "new"},
+		}
+		desired = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-cluster-state"},
+			Data:       map[string]string{"ETCD_INITIAL_CLUSTER_STATE": "existing"},
+		}
+		staleGets = 1
+		rclient = fake.NewClientBuilder().WithObjects(existing).WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if staleGets > 0 {
+					staleGets--
+					return apierrors.NewNotFound(corev1.Resource("configmaps"), key.Name)
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+		}).Build()
+	})
+
+	It("should adopt objects created concurrently", func(ctx SpecContext) {
+		Expect(reconcileConfigMap(ctx, rclient, "test", desired)).To(Succeed())
+
+		current := &corev1.ConfigMap{}
+		Expect(rclient.Get(ctx, client.ObjectKeyFromObject(existing), current)).To(Succeed())
+		Expect(current.Data).To(Equal(desired.Data))
+	})
+
+	It("should leave objects missing in the cache to the next reconcile", func(ctx SpecContext) {
+		staleGets = 2
+		Expect(reconcileConfigMap(ctx, rclient, "test", desired)).To(Succeed())
+
+		current := &corev1.ConfigMap{}
+		Expect(rclient.Get(ctx, client.ObjectKeyFromObject(existing), current)).To(Succeed())
+		Expect(current.Data).To(Equal(existing.Data))
+	})
+
+	It("should return errors other than conflicting creates", func(ctx SpecContext) {
+		desired.Name = ""
+		Expect(reconcileConfigMap(ctx, rclient, "test", desired)).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups="cert-manager.io",resources=certificates,verbs=get;list;watch;create;update
+
+// CertificateGVK is the kind of cert-manager certificates requested for the cluster.
+var CertificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// GetServerCertificateName returns name of the cert-manager certificate of the cluster server certificate.
+func GetServerCertificateName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	return fmt.Sprintf("%s-server", cluster.Name)
+}
+
+// CreateOrUpdateServerCertificate requests the server certificate from the cert-manager issuer referenced
+// in the cluster TLS spec. cert-manager stores the issued certificate in the server secret.
+func CreateOrUpdateServerCertificate(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+) error {
+	if cluster.Spec.Security == nil || cluster.Spec.Security.TLS.ServerIssuerRef == nil {
+		return nil
+	}
+	tlsSpec := cluster.Spec.Security.TLS
+	dnsNames, ipAddresses := serverCertificateSANs(cluster)
+
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(CertificateGVK)
+	certificate.SetNamespace(cluster.Namespace)
+	certificate.SetName(GetServerCertificateName(cluster))
+	certificate.SetLabels(NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy())
+	spec := map[string]interface{}{
+		"secretName": tlsSpec.ServerSecret,
+		"issuerRef": map[string]interface{}{
+			"name":  tlsSpec.ServerIssuerRef.Name,
+			"kind":  tlsSpec.ServerIssuerRef.Kind,
+			"group": tlsSpec.ServerIssuerRef.Group,
+		},
+		"usages":   []interface{}{"server auth", "client auth"},
+		"dnsNames": toInterfaceSlice(dnsNames),
+	}
+	if len(ipAddresses) > 0 {
+		spec["ipAddresses"] = toInterfaceSlice(ipAddresses)
+	}
+	certificate.Object["spec"] = spec
+	log.FromContext(ctx).V(2).Info("server certificate spec generated", "certificate_name", certificate.GetName(), "spec", spec)
+
+	if err := SetOwner(cluster, certificate, rscheme); err != nil {
+		return fmt.Errorf("cannot set controller reference: %w", err)
+	}
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(CertificateGVK)
+	done, err := createOrGet(ctx, rclient, certificate, current)
+	if err != nil {
+		return fmt.Errorf("cannot create or get server certificate %s: %w", certificate.GetName(), err)
+	}
+	if done {
+		return nil
+	}
+	current.Object["spec"] = spec
+	current.SetLabels(certificate.GetLabels())
+	current.SetOwnerReferences(certificate.GetOwnerReferences())
+	return rclient.Update(ctx, current)
+}
+
+// serverCertificateSANs returns DNS names and IP addresses of the server certificate: names of members
+// and the client service, loopback addresses members are checked on and extra SANs from the cluster spec.
+func serverCertificateSANs(cluster *etcdaenixiov1alpha1.EtcdCluster) ([]string, []string) {
+	clientService := GetClientServiceName(cluster)
+	dnsNames := append(cluster.MemberDNSNames(),
+		clientService,
+		fmt.Sprintf("%s.%s", clientService, cluster.Namespace),
+		fmt.Sprintf("%s.%s.svc", clientService, cluster.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", clientService, cluster.Namespace),
+		"localhost",
+	)
+	ipAddresses := []string{"127.0.0.1"}
+	for _, san := range cluster.Spec.Security.TLS.ExtraSANs {
+		if net.ParseIP(san) != nil {
+			ipAddresses = append(ipAddresses, san)
+		} else {
+			dnsNames = append(dnsNames, san)
+		}
+	}
+	return dnsNames, ipAddresses
+}
+
+func toInterfaceSlice(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		result = append(result, v)
+	}
+	return result
+}
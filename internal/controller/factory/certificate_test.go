@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("CreateOrUpdateServerCertificate handler", func() {
+	var (
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+		scheme  *runtime.Scheme
+	)
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(3)),
+				Security: &etcdaenixiov1alpha1.SecuritySpec{TLS: etcdaenixiov1alpha1.TLSSpec{
+					ServerSecret: "test-server-tls",
+					ServerIssuerRef: &etcdaenixiov1alpha1.IssuerReference{
+						Name: "ca", Kind: "ClusterIssuer", Group: "cert-manager.io",
+					},
+					ExtraSANs: []string{"etcd.example.com", "10.0.0.1"},
+				}},
+			},
+		}
+	})
+
+	It("should not request certificate without issuer", func(ctx SpecContext) {
+		cluster.Spec.Security.TLS.ServerIssuerRef = nil
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		Expect(CreateOrUpdateServerCertificate(ctx, cluster, rclient, scheme)).To(Succeed())
+
+		certificate := &unstructured.Unstructured{}
+		certificate.SetGroupVersionKind(CertificateGVK)
+		err := rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-server"}, certificate)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should request certificate with extra SANs", func(ctx SpecContext) {
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		Expect(CreateOrUpdateServerCertificate(ctx, cluster, rclient, scheme)).To(Succeed())
+
+		certificate := &unstructured.Unstructured{}
+		certificate.SetGroupVersionKind(CertificateGVK)
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-server"}, certificate)).To(Succeed())
+		Expect(certificate.GetOwnerReferences()).To(HaveLen(1))
+		Expect(certificate.Object).To(HaveKeyWithValue("spec", SatisfyAll(
+			HaveKeyWithValue("secretName", "test-server-tls"),
+			HaveKeyWithValue("issuerRef", HaveKeyWithValue("kind", "ClusterIssuer")),
+			HaveKeyWithValue("dnsNames", ContainElements("*.test.ns.svc", "test-client.ns.svc", "etcd.example.com")),
+			HaveKeyWithValue("ipAddresses", ConsistOf("127.0.0.1", "10.0.0.1")),
+		)))
+	})
+
+	It("should update SANs of the existing certificate", func(ctx SpecContext) {
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		Expect(CreateOrUpdateServerCertificate(ctx, cluster, rclient, scheme)).To(Succeed())
+		cluster.Spec.Security.TLS.ExtraSANs = []string{"etcd.example.org"}
+		Expect(CreateOrUpdateServerCertificate(ctx, cluster, rclient, scheme)).To(Succeed())
+
+		certificate := &unstructured.Unstructured{}
+		certificate.SetGroupVersionKind(CertificateGVK)
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-server"}, certificate)).To(Succeed())
+		Expect(certificate.Object).To(HaveKeyWithValue("spec", SatisfyAll(
+			HaveKeyWithValue("dnsNames", SatisfyAll(ContainElement("etcd.example.org"), Not(ContainElement("etcd.example.com")))),
+			HaveKeyWithValue("ipAddresses", ConsistOf("127.0.0.1")),
+		)))
+	})
+})
@@ -19,14 +19,16 @@ package factory
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/agent"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -41,14 +43,11 @@ func CreateOrUpdateClusterStateConfigMap(
 	rscheme *runtime.Scheme,
 ) error {
 	initialCluster := ""
-	for i := int32(0); i < *cluster.Spec.Replicas; i++ {
+	for i, member := range cluster.Members() {
 		if i > 0 {
 			initialCluster += ","
 		}
-		initialCluster += fmt.Sprintf("%s-%d=https://%s-%d.%s.%s.svc:2380",
-			cluster.Name, i,
-			cluster.Name, i, cluster.Name, cluster.Namespace,
-		)
+		initialCluster += member.Name + "=" + member.PeerURL
 	}
 
 	logger := log.FromContext(ctx)
@@ -56,6 +55,7 @@ func CreateOrUpdateClusterStateConfigMap(
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: cluster.Namespace,
 			Name:      GetClusterStateConfigMapName(cluster),
+			Labels:    NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy(),
 		},
 		Data: map[string]string{
 			"ETCD_INITIAL_CLUSTER_STATE": "new",
@@ -69,9 +69,13 @@ func CreateOrUpdateClusterStateConfigMap(
 		logger.V(2).Info("updating cluster state", "cluster_name", cluster.Name)
 		configMap.Data["ETCD_INITIAL_CLUSTER_STATE"] = "existing"
 	}
+	if cluster.Status.Backup != nil && cluster.Status.Backup.RestoringFrom != "" {
+		// members started with an empty data directory restore it from the snapshot
+		configMap.Data[agent.RestoreSnapshotEnv] = cluster.Status.Backup.RestoringFrom
+	}
 	logger.V(2).Info("configmap spec generated", "cm_name", configMap.Name, "cm_spec", configMap.Data)
 
-	if err := ctrl.SetControllerReference(cluster, configMap, rscheme); err != nil {
+	if err := SetOwner(cluster, configMap, rscheme); err != nil {
 		return fmt.Errorf("cannot set controller reference: %w", err)
 	}
 
@@ -85,3 +89,76 @@ func isEtcdClusterReady(cluster *etcdaenixiov1alpha1.EtcdCluster) bool {
 	return cond != nil && (cond.Reason == string(etcdaenixiov1alpha1.EtcdCondTypeStatefulSetReady) ||
 		cond.Reason == string(etcdaenixiov1alpha1.EtcdCondTypeStatefulSetNotReady))
 }
+
+// TrafficGateReadyKey is the key of the traffic gate ConfigMap set to "true" while the cluster is safe for
+// client traffic and to "false" otherwise.
+const TrafficGateReadyKey = "ready"
+
+// GetTrafficGateConfigMapName returns the name of the ConfigMap the TrafficReady condition of the cluster is published in.
+func GetTrafficGateConfigMapName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	return cluster.Name + "-traffic-gate"
+}
+
+// CreateOrUpdateTrafficGateConfigMap publishes the TrafficReady condition of the cluster in a ConfigMap, so dependent
+// applications can gate their own behavior on it with read access to a single ConfigMap.
+func CreateOrUpdateTrafficGateConfigMap(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+) error {
+	cond := GetCondition(cluster, etcdaenixiov1alpha1.EtcdConditionTrafficReady)
+	if cond == nil {
+		return nil
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      GetTrafficGateConfigMapName(cluster),
+			Labels:    NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy(),
+		},
+		Data: map[string]string{
+			TrafficGateReadyKey:  strconv.FormatBool(cond.Status == metav1.ConditionTrue),
+			"reason":             cond.Reason,
+			"message":            cond.Message,
+			"lastTransitionTime": cond.LastTransitionTime.UTC().Format(time.RFC3339),
+		},
+	}
+	if err := SetOwner(cluster, configMap, rscheme); err != nil {
+		return fmt.Errorf("cannot set controller reference: %w", err)
+	}
+	return reconcileConfigMap(ctx, rclient, cluster.Name, configMap)
+}
+
+// KeyUsageReportKey is the key of the key usage ConfigMap holding the last report in JSON.
+const KeyUsageReportKey = "report.json"
+
+// GetKeyUsageConfigMapName returns the name of the ConfigMap key usage reports of the cluster are published in.
+func GetKeyUsageConfigMapName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	return cluster.Name + "-key-usage"
+}
+
+// CreateOrUpdateKeyUsageConfigMap publishes the key usage report of the cluster in a ConfigMap, so owners
+// of applications sharing the cluster can read it without access to etcd.
+func CreateOrUpdateKeyUsageConfigMap(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	report []byte,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+) error {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      GetKeyUsageConfigMapName(cluster),
+			Labels:    NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy(),
+		},
+		Data: map[string]string{
+			KeyUsageReportKey: string(report),
+		},
+	}
+	if err := SetOwner(cluster, configMap, rscheme); err != nil {
+		return fmt.Errorf("cannot set controller reference: %w", err)
+	}
+	return reconcileConfigMap(ctx, rclient, cluster.Name, configMap)
+}
@@ -113,6 +113,16 @@ var _ = Describe("CreateOrUpdateClusterStateConfigMap handlers", func() {
 				Eventually(Object(&configMap)).Should(HaveField("ObjectMeta.UID", Equal(configMapUID)))
 				Expect(configMap.Data["ETCD_INITIAL_CLUSTER_STATE"]).To(Equal("new"))
 			})
+
+			By("updating the configmap for cluster restored from snapshot", func() {
+				etcdcluster.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{RestoringFrom: "snapshot.db"}
+				Expect(CreateOrUpdateClusterStateConfigMap(ctx, &etcdcluster, k8sClient, k8sClient.Scheme())).To(Succeed())
+				Eventually(Object(&configMap)).Should(HaveField("Data", HaveKeyWithValue("RESTORE_SNAPSHOT_KEY", "snapshot.db")))
+
+				etcdcluster.Status.Backup.RestoringFrom = ""
+				Expect(CreateOrUpdateClusterStateConfigMap(ctx, &etcdcluster, k8sClient, k8sClient.Scheme())).To(Succeed())
+				Eventually(Object(&configMap)).Should(HaveField("Data", Not(HaveKey("RESTORE_SNAPSHOT_KEY"))))
+			})
 		})
 
 		It("should fail to create the configmap with invalid owner reference", func(ctx SpecContext) {
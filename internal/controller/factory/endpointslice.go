@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// EndpointSliceManagedBy is the value of the managed-by label of EndpointSlices managed by the operator,
+// so the EndpointSlice controller of Kubernetes leaves them alone.
+const EndpointSliceManagedBy = "etcd-operator.etcd.aenix.io"
+
+// managedServiceNames returns names of Services whose EndpointSlices are managed by the operator in Managed mode.
+func managedServiceNames(cluster *etcdaenixiov1alpha1.EtcdCluster) []string {
+	return []string{GetClientServiceName(cluster), GetLeaderServiceName(cluster), GetFollowersServiceName(cluster)}
+}
+
+// deleteEndpointSlices removes EndpointSlices published by the operator in Managed endpoints mode.
+func deleteEndpointSlices(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, rclient client.Client) error {
+	for _, name := range managedServiceNames(cluster) {
+		slice := &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: cluster.Namespace, Name: name}}
+		if err := rclient.Delete(ctx, slice); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("cannot delete endpoint slice %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// CreateOrUpdateEndpointSlice publishes the given member pods as endpoints of the Service in the EtcdCluster
+// namespace. The slice is named after the Service, since the operator manages a single slice per Service.
+func CreateOrUpdateEndpointSlice(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+	serviceName string,
+	pods []*corev1.Pod,
+) error {
+	labels := NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy()
+	labels[discoveryv1.LabelServiceName] = serviceName
+	labels[discoveryv1.LabelManagedBy] = EndpointSliceManagedBy
+
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      serviceName,
+			Labels:    labels,
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   make([]discoveryv1.Endpoint, 0, len(pods)),
+		Ports: []discoveryv1.EndpointPort{
+			{Name: ptr.To("client"), Port: ptr.To(cluster.ClientPort()), Protocol: ptr.To(corev1.ProtocolTCP)},
+		},
+	}
+	for _, pod := range pods {
+		ip := net.ParseIP(pod.Status.PodIP)
+		if ip == nil {
+			continue
+		}
+		if ip.To4() == nil {
+			slice.AddressType = discoveryv1.AddressTypeIPv6
+		}
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{pod.Status.PodIP},
+			Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+			Hostname:   ptr.To(pod.Name),
+			NodeName:   ptr.To(pod.Spec.NodeName),
+			TargetRef: &corev1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+				UID:       pod.UID,
+			},
+		})
+	}
+	log.FromContext(ctx).V(2).Info("endpoint slice generated", "slice_name", slice.Name, "endpoints", slice.Endpoints)
+
+	if err := SetOwner(cluster, slice, rscheme); err != nil {
+		return fmt.Errorf("cannot set controller reference: %w", err)
+	}
+
+	current := &discoveryv1.EndpointSlice{}
+	done, err := createOrGet(ctx, rclient, slice, current)
+	if err != nil {
+		return fmt.Errorf("cannot create or get endpoint slice %s: %w", slice.Name, err)
+	}
+	if done {
+		return nil
+	}
+	if current.AddressType != slice.AddressType {
+		// address type is immutable
+		if err = rclient.Delete(ctx, current); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("cannot delete endpoint slice %s: %w", slice.Name, err)
+		}
+		return rclient.Create(ctx, slice)
+	}
+	slice.ResourceVersion = current.ResourceVersion
+	return rclient.Update(ctx, slice)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Managed endpoints", func() {
+	var (
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+		scheme  *runtime.Scheme
+	)
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas:  ptr.To(int32(3)),
+				Endpoints: &etcdaenixiov1alpha1.EndpointsSpec{Mode: etcdaenixiov1alpha1.EndpointsModeManaged},
+			},
+		}
+	})
+
+	It("should create role services without selectors and remove them in selector mode", func(ctx SpecContext) {
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		Expect(CreateOrUpdateRoleServices(ctx, cluster, rclient, scheme)).To(Succeed())
+		svc := &corev1.Service{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-leader"}, svc)).To(Succeed())
+		Expect(svc.Spec.Selector).To(BeEmpty())
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-followers"}, svc)).To(Succeed())
+
+		cluster.Spec.Endpoints.Mode = etcdaenixiov1alpha1.EndpointsModeSelector
+		Expect(CreateOrUpdateRoleServices(ctx, cluster, rclient, scheme)).To(Succeed())
+		err := rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-leader"}, svc)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should create role services selecting pods by role in selector mode", func(ctx SpecContext) {
+		cluster.Spec.Endpoints = &etcdaenixiov1alpha1.EndpointsSpec{
+			Mode:         etcdaenixiov1alpha1.EndpointsModeSelector,
+			RoleServices: true,
+		}
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		Expect(CreateOrUpdateRoleServices(ctx, cluster, rclient, scheme)).To(Succeed())
+		svc := &corev1.Service{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-leader"}, svc)).To(Succeed())
+		Expect(svc.Spec.Selector).To(HaveKeyWithValue(RoleLabel, RoleLeader))
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-followers"}, svc)).To(Succeed())
+		Expect(svc.Spec.Selector).To(HaveKeyWithValue(RoleLabel, RoleFollower))
+		Expect(svc.Spec.Selector).To(HaveKeyWithValue("app.kubernetes.io/instance", "test"))
+	})
+
+	It("should publish member pods in the endpoint slice of the service", func(ctx SpecContext) {
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-0"},
+			Status:     corev1.PodStatus{PodIP: "10.0.0.1"},
+		}
+		Expect(CreateOrUpdateEndpointSlice(ctx, cluster, rclient, scheme, "test-leader", []*corev1.Pod{pod})).To(Succeed())
+
+		slice := &discoveryv1.EndpointSlice{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-leader"}, slice)).To(Succeed())
+		Expect(slice.Labels).To(HaveKeyWithValue(discoveryv1.LabelServiceName, "test-leader"))
+		Expect(slice.Labels).To(HaveKeyWithValue(discoveryv1.LabelManagedBy, EndpointSliceManagedBy))
+		Expect(slice.AddressType).To(Equal(discoveryv1.AddressTypeIPv4))
+		Expect(slice.Endpoints).To(HaveLen(1))
+		Expect(slice.Endpoints[0].Addresses).To(Equal([]string{"10.0.0.1"}))
+		Expect(*slice.Endpoints[0].Hostname).To(Equal("test-0"))
+
+		pod.Status.PodIP = "fd00::1"
+		Expect(CreateOrUpdateEndpointSlice(ctx, cluster, rclient, scheme, "test-leader", []*corev1.Pod{pod})).To(Succeed())
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-leader"}, slice)).To(Succeed())
+		Expect(slice.AddressType).To(Equal(discoveryv1.AddressTypeIPv6))
+
+		Expect(CreateOrUpdateEndpointSlice(ctx, cluster, rclient, scheme, "test-leader", nil)).To(Succeed())
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-leader"}, slice)).To(Succeed())
+		Expect(slice.Endpoints).To(BeEmpty())
+	})
+})
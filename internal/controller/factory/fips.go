@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// ParseImageMapping parses comma-separated image=fips-image pairs.
+func ParseImageMapping(value string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		image, fipsImage, ok := strings.Cut(pair, "=")
+		if !ok || image == "" || fipsImage == "" {
+			return nil, fmt.Errorf("invalid image mapping %q, expected image=fips-image", pair)
+		}
+		mapping[image] = fipsImage
+	}
+	return mapping, nil
+}
+
+// fipsEnabled checks if member pods of the cluster run in FIPS mode.
+func fipsEnabled(cluster *etcdaenixiov1alpha1.EtcdCluster) bool {
+	return ptr.Deref(cluster.Spec.FIPS, settings.FIPS)
+}
+
+// applyFIPSImages replaces images of all containers with their FIPS-compliant builds. Images which are already
+// FIPS-compliant builds are kept. It fails if there is no FIPS-compliant build of an image, so a cluster
+// in FIPS mode never runs a non-compliant image.
+func applyFIPSImages(spec *corev1.PodSpec) error {
+	fipsImages := make([]string, 0, len(settings.FIPSImages))
+	for _, image := range settings.FIPSImages {
+		fipsImages = append(fipsImages, image)
+	}
+	replace := func(containers []corev1.Container) error {
+		for i := range containers {
+			if slices.Contains(fipsImages, containers[i].Image) {
+				continue
+			}
+			image, ok := settings.FIPSImages[containers[i].Image]
+			if !ok {
+				return fmt.Errorf("no FIPS-compliant image of %s is configured for container %s",
+					containers[i].Image, containers[i].Name)
+			}
+			containers[i].Image = image
+		}
+		return nil
+	}
+	if err := replace(spec.InitContainers); err != nil {
+		return err
+	}
+	return replace(spec.Containers)
+}
+
+// validateFIPSTLS checks that TLS settings of the cluster in FIPS mode use only FIPS-approved cipher suites.
+func validateFIPSTLS(cluster *etcdaenixiov1alpha1.EtcdCluster) error {
+	if cluster.Spec.Security == nil {
+		return nil
+	}
+	for _, suite := range cluster.Spec.Security.TLS.CipherSuites {
+		if !slices.Contains(etcdaenixiov1alpha1.FIPSCipherSuites, suite) {
+			return fmt.Errorf("cipher suite %s is not FIPS-approved", suite)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("FIPS mode", func() {
+	BeforeEach(func() {
+		previous := settings
+		DeferCleanup(func() { settings = previous })
+		settings = Settings{
+			AgentImage: DefaultAgentImage,
+			FIPSImages: map[string]string{
+				etcdaenixiov1alpha1.DefaultEtcdImage: "registry.example.com/etcd-fips:v3.5.12",
+				DefaultAgentImage:                    "registry.example.com/etcd-operator-fips:latest",
+			},
+		}
+	})
+
+	Context("When parsing image mapping", func() {
+		It("should parse image pairs", func() {
+			mapping, err := ParseImageMapping("a:1=b:1, c:2=d:2,")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mapping).To(Equal(map[string]string{"a:1": "b:1", "c:2": "d:2"}))
+		})
+
+		It("should reject pairs without FIPS image", func() {
+			_, err := ParseImageMapping("a:1")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When selecting images", func() {
+		It("should inherit operator-wide FIPS mode", func() {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+			Expect(fipsEnabled(cluster)).To(BeFalse())
+			settings.FIPS = true
+			Expect(fipsEnabled(cluster)).To(BeTrue())
+			cluster.Spec.FIPS = ptr.To(false)
+			Expect(fipsEnabled(cluster)).To(BeFalse())
+		})
+
+		It("should replace images with FIPS-compliant builds", func() {
+			spec := &corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "restore", Image: DefaultAgentImage}},
+				Containers: []corev1.Container{
+					{Name: "etcd", Image: etcdaenixiov1alpha1.DefaultEtcdImage},
+					{Name: "sidecar", Image: "registry.example.com/etcd-fips:v3.5.12"},
+				},
+			}
+			Expect(applyFIPSImages(spec)).To(Succeed())
+			Expect(spec.InitContainers[0].Image).To(Equal("registry.example.com/etcd-operator-fips:latest"))
+			Expect(spec.Containers[0].Image).To(Equal("registry.example.com/etcd-fips:v3.5.12"))
+			Expect(spec.Containers[1].Image).To(Equal("registry.example.com/etcd-fips:v3.5.12"))
+		})
+
+		It("should fail on images without FIPS-compliant build", func() {
+			spec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "etcd", Image: "quay.io/coreos/etcd:v3.5.13"}}}
+			Expect(applyFIPSImages(spec)).To(MatchError(ContainSubstring("quay.io/coreos/etcd:v3.5.13")))
+		})
+	})
+
+	Context("When generating TLS settings", func() {
+		It("should restrict TLS to FIPS-approved cipher suites", func() {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{Spec: etcdaenixiov1alpha1.EtcdClusterSpec{FIPS: ptr.To(true)}}
+			Expect(generateEtcdArgs(cluster)).To(ContainElements(
+				"--tls-min-version=TLS1.2",
+				HavePrefix("--cipher-suites=TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,"),
+			))
+		})
+
+		It("should reject cipher suites which are not FIPS-approved", func() {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Security: &etcdaenixiov1alpha1.SecuritySpec{TLS: etcdaenixiov1alpha1.TLSSpec{
+					CipherSuites: []string{"TLS_CHACHA20_POLY1305_SHA256"},
+				}},
+			}}
+			Expect(validateFIPSTLS(cluster)).NotTo(Succeed())
+		})
+	})
+})
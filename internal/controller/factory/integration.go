@@ -0,0 +1,195 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// CreateOrUpdateIntegrationSecrets publishes the endpoints Secret and, if enabled, the kubeadm-compatible
+// client Secret and the datastore Secret for hosted control planes consuming the cluster, and sets
+// the integration contract in status.
+func CreateOrUpdateIntegrationSecrets(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+) error {
+	integration := cluster.Spec.Integration
+	if integration == nil {
+		integration = &etcdaenixiov1alpha1.IntegrationSpec{}
+	}
+	var serverSecret, clientSecret *corev1.Secret
+	var err error
+	if cluster.Spec.Security != nil && cluster.Spec.Security.TLS.ServerSecret != "" {
+		if serverSecret, err = getSecret(ctx, rclient, cluster.Namespace, cluster.Spec.Security.TLS.ServerSecret); err != nil {
+			return err
+		}
+		if cluster.Spec.Security.TLS.ClientSecret != "" && (integration.KubeadmClientSecret || integration.DatastoreSecret != nil) {
+			if clientSecret, err = getSecret(ctx, rclient, cluster.Namespace, cluster.Spec.Security.TLS.ClientSecret); err != nil {
+				return err
+			}
+		}
+	}
+
+	endpoints := etcd.ClientEndpoints(cluster)
+	status := &etcdaenixiov1alpha1.IntegrationStatus{
+		ContractVersion: etcdaenixiov1alpha1.IntegrationContractVersion,
+		Endpoints:       endpoints,
+		EndpointsSecret: cluster.EndpointsSecretName(),
+		ReadyCondition:  string(etcdaenixiov1alpha1.EtcdConditionTrafficReady),
+	}
+	endpointsSecret := &corev1.Secret{
+		ObjectMeta: integrationSecretMeta(cluster, status.EndpointsSecret),
+		Data: map[string][]byte{
+			etcdaenixiov1alpha1.EndpointsSecretEndpointsKey: []byte(strings.Join(endpoints, ",")),
+		},
+	}
+	copyKey(endpointsSecret, etcdaenixiov1alpha1.CACertKey, serverSecret, etcdaenixiov1alpha1.CACertKey)
+	if err = publishSecret(ctx, cluster, rclient, rscheme, endpointsSecret); err != nil {
+		return err
+	}
+
+	if integration.KubeadmClientSecret && clientSecret != nil {
+		kubeadmSecret := &corev1.Secret{
+			ObjectMeta: integrationSecretMeta(cluster, cluster.KubeadmClientSecretName()),
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{},
+		}
+		copyKey(kubeadmSecret, corev1.TLSCertKey, clientSecret, corev1.TLSCertKey)
+		copyKey(kubeadmSecret, corev1.TLSPrivateKeyKey, clientSecret, corev1.TLSPrivateKeyKey)
+		copyKey(kubeadmSecret, etcdaenixiov1alpha1.CACertKey, serverSecret, etcdaenixiov1alpha1.CACertKey)
+		if err = publishSecret(ctx, cluster, rclient, rscheme, kubeadmSecret); err != nil {
+			return err
+		}
+		status.KubeadmClientSecret = kubeadmSecret.Name
+	} else if err = deleteOwnedSecret(ctx, rclient, cluster, cluster.KubeadmClientSecretName()); err != nil {
+		return err
+	}
+
+	if integration.DatastoreSecret != nil {
+		datastoreSecret := generateDatastoreSecret(cluster, integration.DatastoreSecret.Format, endpoints, serverSecret, clientSecret)
+		if err = publishSecret(ctx, cluster, rclient, rscheme, datastoreSecret); err != nil {
+			return err
+		}
+		status.DatastoreSecret = datastoreSecret.Name
+	} else if err = deleteOwnedSecret(ctx, rclient, cluster, cluster.DatastoreSecretName()); err != nil {
+		return err
+	}
+
+	cluster.Status.Integration = status
+	return nil
+}
+
+// generateDatastoreSecret returns the datastore connection Secret in the layout expected by consumers
+// of the format.
+func generateDatastoreSecret(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	format etcdaenixiov1alpha1.DatastoreFormat,
+	endpoints []string,
+	serverSecret, clientSecret *corev1.Secret,
+) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: integrationSecretMeta(cluster, cluster.DatastoreSecretName()),
+		Data:       map[string][]byte{},
+	}
+	copyKey(secret, etcdaenixiov1alpha1.CACertKey, serverSecret, etcdaenixiov1alpha1.CACertKey)
+	switch format {
+	case etcdaenixiov1alpha1.DatastoreFormatKine:
+		// kine takes etcd URLs in --endpoint and files in --ca-file, --cert-file and --key-file
+		secret.Data["endpoint"] = []byte(strings.Join(endpoints, ","))
+		copyKey(secret, "client.crt", clientSecret, corev1.TLSCertKey)
+		copyKey(secret, "client.key", clientSecret, corev1.TLSPrivateKeyKey)
+	default:
+		// Kamaji DataStore endpoints are host:port pairs without the scheme
+		hosts := make([]string, 0, len(endpoints))
+		for _, endpoint := range endpoints {
+			if u, err := url.Parse(endpoint); err == nil {
+				hosts = append(hosts, u.Host)
+			}
+		}
+		secret.Data["endpoints"] = []byte(strings.Join(hosts, ","))
+		copyKey(secret, corev1.TLSCertKey, clientSecret, corev1.TLSCertKey)
+		copyKey(secret, corev1.TLSPrivateKeyKey, clientSecret, corev1.TLSPrivateKeyKey)
+	}
+	return secret
+}
+
+// copyKey copies the key of the source Secret to the destination Secret if the source has it.
+func copyKey(dst *corev1.Secret, dstKey string, src *corev1.Secret, srcKey string) {
+	if src != nil && len(src.Data[srcKey]) > 0 {
+		dst.Data[dstKey] = src.Data[srcKey]
+	}
+}
+
+// publishSecret creates or updates the Secret published for consumers of the cluster.
+func publishSecret(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+	secret *corev1.Secret,
+) error {
+	if err := SetOwner(cluster, secret, rscheme); err != nil {
+		return fmt.Errorf("cannot set controller reference: %w", err)
+	}
+	return reconcileSecret(ctx, rclient, cluster.Name, secret)
+}
+
+// integrationSecretMeta returns metadata of a Secret published for consumers of the cluster.
+func integrationSecretMeta(cluster *etcdaenixiov1alpha1.EtcdCluster, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Namespace: cluster.Namespace,
+		Name:      name,
+		Labels:    NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy(),
+	}
+}
+
+// getSecret returns the Secret referenced by the cluster.
+func getSecret(ctx context.Context, rclient client.Client, namespace, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := rclient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, fmt.Errorf("cannot get secret %s: %w", name, err)
+	}
+	return secret, nil
+}
+
+// deleteOwnedSecret deletes the Secret if it exists and is controlled by the cluster. Secrets of other owners,
+// e.g. the client Secret of a Cluster API cluster with the same name, are kept.
+func deleteOwnedSecret(ctx context.Context, rclient client.Client, cluster *etcdaenixiov1alpha1.EtcdCluster, name string) error {
+	secret := &corev1.Secret{}
+	err := rclient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, secret)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(secret, cluster) {
+		return nil
+	}
+	return client.IgnoreNotFound(rclient.Delete(ctx, secret))
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Integration secrets", func() {
+	var (
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+		scheme  *runtime.Scheme
+		rclient client.Client
+	)
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		rclient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "server"},
+				Data:       map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("server"), "tls.key": []byte("key")},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "client"},
+				Data:       map[string][]byte{"tls.crt": []byte("client"), "tls.key": []byte("client-key")},
+			},
+		).Build()
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(2)),
+				Security: &etcdaenixiov1alpha1.SecuritySpec{
+					TLS: etcdaenixiov1alpha1.TLSSpec{ServerSecret: "server", ClientSecret: "client"},
+				},
+			},
+		}
+	})
+
+	It("should publish endpoints with the CA and the contract", func(ctx SpecContext) {
+		Expect(CreateOrUpdateIntegrationSecrets(ctx, cluster, rclient, scheme)).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-endpoints"}, secret)).To(Succeed())
+		Expect(secret.Data).To(Equal(map[string][]byte{
+			"endpoints": []byte("https://test-0.test.ns.svc:2379,https://test-1.test.ns.svc:2379"),
+			"ca.crt":    []byte("ca"),
+		}))
+		Expect(cluster.Status.Integration).To(Equal(&etcdaenixiov1alpha1.IntegrationStatus{
+			ContractVersion: "v1",
+			Endpoints:       []string{"https://test-0.test.ns.svc:2379", "https://test-1.test.ns.svc:2379"},
+			EndpointsSecret: "test-endpoints",
+			ReadyCondition:  "TrafficReady",
+		}))
+		err := rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-apiserver-etcd-client"}, &corev1.Secret{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should generate the kubeadm client secret and delete it once disabled", func(ctx SpecContext) {
+		cluster.Spec.Integration = &etcdaenixiov1alpha1.IntegrationSpec{KubeadmClientSecret: true}
+		Expect(CreateOrUpdateIntegrationSecrets(ctx, cluster, rclient, scheme)).To(Succeed())
+		secret := &corev1.Secret{}
+		key := client.ObjectKey{Namespace: "ns", Name: "test-apiserver-etcd-client"}
+		Expect(rclient.Get(ctx, key, secret)).To(Succeed())
+		Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(secret.Data).To(Equal(map[string][]byte{
+			"tls.crt": []byte("client"),
+			"tls.key": []byte("client-key"),
+			"ca.crt":  []byte("ca"),
+		}))
+		Expect(cluster.Status.Integration.KubeadmClientSecret).To(Equal("test-apiserver-etcd-client"))
+
+		cluster.Spec.Integration = nil
+		Expect(CreateOrUpdateIntegrationSecrets(ctx, cluster, rclient, scheme)).To(Succeed())
+		Expect(rclient.Get(ctx, key, secret)).NotTo(Succeed())
+		Expect(cluster.Status.Integration.KubeadmClientSecret).To(BeEmpty())
+	})
+
+	It("should emit the datastore secret for Kamaji", func(ctx SpecContext) {
+		cluster.Spec.Integration = &etcdaenixiov1alpha1.IntegrationSpec{
+			DatastoreSecret: &etcdaenixiov1alpha1.DatastoreSecretSpec{Format: etcdaenixiov1alpha1.DatastoreFormatKamaji},
+		}
+		Expect(CreateOrUpdateIntegrationSecrets(ctx, cluster, rclient, scheme)).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-datastore"}, secret)).To(Succeed())
+		Expect(secret.Data).To(Equal(map[string][]byte{
+			"endpoints": []byte("test-0.test.ns.svc:2379,test-1.test.ns.svc:2379"),
+			"ca.crt":    []byte("ca"),
+			"tls.crt":   []byte("client"),
+			"tls.key":   []byte("client-key"),
+		}))
+		Expect(cluster.Status.Integration.DatastoreSecret).To(Equal("test-datastore"))
+	})
+
+	It("should emit the datastore secret for kine", func(ctx SpecContext) {
+		cluster.Spec.Integration = &etcdaenixiov1alpha1.IntegrationSpec{
+			DatastoreSecret: &etcdaenixiov1alpha1.DatastoreSecretSpec{Format: etcdaenixiov1alpha1.DatastoreFormatKine},
+		}
+		Expect(CreateOrUpdateIntegrationSecrets(ctx, cluster, rclient, scheme)).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-datastore"}, secret)).To(Succeed())
+		Expect(secret.Data).To(Equal(map[string][]byte{
+			"endpoint":   []byte("https://test-0.test.ns.svc:2379,https://test-1.test.ns.svc:2379"),
+			"ca.crt":     []byte("ca"),
+			"client.crt": []byte("client"),
+			"client.key": []byte("client-key"),
+		}))
+	})
+
+	It("should not take over secrets of other owners", func(ctx SpecContext) {
+		Expect(rclient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test-apiserver-etcd-client"},
+		})).To(Succeed())
+		cluster.Spec.Integration = &etcdaenixiov1alpha1.IntegrationSpec{KubeadmClientSecret: true}
+		Expect(CreateOrUpdateIntegrationSecrets(ctx, cluster, rclient, scheme)).NotTo(Succeed())
+
+		cluster.Spec.Integration = nil
+		Expect(CreateOrUpdateIntegrationSecrets(ctx, cluster, rclient, scheme)).To(Succeed())
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-apiserver-etcd-client"}, &corev1.Secret{})).To(Succeed())
+	})
+})
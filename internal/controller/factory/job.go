@@ -0,0 +1,361 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/agent"
+)
+
+const (
+	// SnapshotVerificationComponent is the component of Jobs checking that snapshots can be restored.
+	SnapshotVerificationComponent = "snapshot-verification"
+	// RestoreComponent is the component of Jobs restoring data volumes of members from a snapshot.
+	RestoreComponent = "restore"
+	// SnapshotKeyAnnotation is the storage key of the snapshot a Job works with.
+	SnapshotKeyAnnotation = "etcd.aenix.io/snapshot-key"
+	// ScheduledVerificationAnnotation marks Jobs run by the verification schedule of the cluster.
+	ScheduledVerificationAnnotation = "etcd.aenix.io/scheduled-verification"
+
+	verifyContainerName = "verify"
+	verifyWorkVolume    = "work"
+	verifyWorkDir       = "/var/run/etcd-verify"
+)
+
+// CreateSnapshotVerificationJob creates the Job restoring the snapshot stored under the key into a scratch directory.
+// The Job is named after the time, which is the snapshot time unless the verification is scheduled, so it is created
+// once per snapshot or scheduled verification.
+func CreateSnapshotVerificationJob(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+	key string,
+	takenAt time.Time,
+	scheduled bool,
+) error {
+	destination, _ := json.Marshal(cluster.Spec.Backup.Destination)
+	spec := corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name:  verifyContainerName,
+				Image: settings.AgentImage,
+				Args: []string{
+					agent.VerifyCommand,
+					"--snapshot=" + key,
+					"--work-dir=" + verifyWorkDir,
+					"--credentials-dir=" + backupCredentialsMountDir,
+					"--destination=" + string(destination),
+				},
+				Env: proxyEnv(&cluster.Spec.Backup.Destination),
+				VolumeMounts: []corev1.VolumeMount{
+					{
+						Name:      backupCredentialsVolume,
+						ReadOnly:  true,
+						MountPath: backupCredentialsMountDir,
+					},
+					{
+						Name:      verifyWorkVolume,
+						MountPath: verifyWorkDir,
+					},
+				},
+			},
+		},
+		Volumes: []corev1.Volume{
+			{
+				Name: backupCredentialsVolume,
+				VolumeSource: corev1.VolumeSource{
+					Projected: &corev1.ProjectedVolumeSource{
+						Sources: backupCredentialsSources(&cluster.Spec.Backup.Destination),
+					},
+				},
+			},
+			{
+				Name:         verifyWorkVolume,
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			},
+		},
+	}
+	name := fmt.Sprintf("%s-verify-%s", cluster.Name, jobTimeSuffix(takenAt))
+	job, err := newJob(cluster, SnapshotVerificationComponent, name, spec)
+	if err != nil {
+		return err
+	}
+	job.Annotations = map[string]string{SnapshotKeyAnnotation: key}
+	if scheduled {
+		job.Annotations[ScheduledVerificationAnnotation] = "true"
+	}
+	if err = SetOwner(cluster, job, rscheme); err != nil {
+		return fmt.Errorf("cannot set controller reference: %w", err)
+	}
+	if err = rclient.Create(ctx, job); client.IgnoreAlreadyExists(err) != nil {
+		return fmt.Errorf("cannot create job %s: %w", name, err)
+	}
+	return nil
+}
+
+// RestoreJobName returns the name of the Job restoring data volumes of the member in the restore started at the time.
+func RestoreJobName(member string, startTime time.Time) string {
+	return fmt.Sprintf("%s-restore-%s", member, jobTimeSuffix(startTime))
+}
+
+// CreateRestoreJob creates the Job restoring data volumes of the stopped member from the snapshot stored under the key.
+// The data directory is replaced, so the member starts with the restored data once it is started again.
+func CreateRestoreJob(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+	member, key string,
+	startTime time.Time,
+) error {
+	destination, _ := json.Marshal(cluster.Spec.Backup.Destination)
+	container := corev1.Container{
+		Name:  RestoreContainerName,
+		Image: settings.AgentImage,
+		Args: []string{
+			agent.RestoreCommand,
+			"--overwrite",
+			"--name=" + member,
+			"--data-dir=/var/run/etcd/default.etcd",
+			"--peer-url=" + cluster.Member(member).PeerURL,
+			"--credentials-dir=" + backupCredentialsMountDir,
+			"--destination=" + string(destination),
+		},
+		Ports: []corev1.ContainerPort{
+			{Name: "restore-progress", ContainerPort: agent.RestoreProgressPort},
+		},
+		Env: append([]corev1.EnvVar{{Name: agent.RestoreSnapshotEnv, Value: key}},
+			proxyEnv(&cluster.Spec.Backup.Destination)...),
+		EnvFrom: []corev1.EnvFromSource{
+			{
+				ConfigMapRef: &corev1.ConfigMapEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: GetClusterStateConfigMapName(cluster)},
+				},
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "data",
+				MountPath: "/var/run/etcd",
+			},
+			{
+				Name:      backupCredentialsVolume,
+				ReadOnly:  true,
+				MountPath: backupCredentialsMountDir,
+			},
+		},
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: GetPVCName(cluster) + "-" + member,
+				},
+			},
+		},
+		{
+			Name: backupCredentialsVolume,
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: backupCredentialsSources(&cluster.Spec.Backup.Destination),
+				},
+			},
+		},
+	}
+	if cluster.Spec.Storage.WALVolumeClaimTemplate != nil {
+		container.Args = append(container.Args, "--wal-dir=/var/run/etcd-wal/default.wal")
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "wal",
+			MountPath: "/var/run/etcd-wal",
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: "wal",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: GetWALPVCName(cluster) + "-" + member,
+				},
+			},
+		})
+	}
+
+	name := RestoreJobName(member, startTime)
+	job, err := newJob(cluster, RestoreComponent, name, corev1.PodSpec{Containers: []corev1.Container{container}, Volumes: volumes})
+	if err != nil {
+		return err
+	}
+	job.Annotations = map[string]string{SnapshotKeyAnnotation: key}
+	if err = SetOwner(cluster, job, rscheme); err != nil {
+		return fmt.Errorf("cannot set controller reference: %w", err)
+	}
+	if err = rclient.Create(ctx, job); client.IgnoreAlreadyExists(err) != nil {
+		return fmt.Errorf("cannot create job %s: %w", name, err)
+	}
+	return nil
+}
+
+// jobTimeSuffix formats the time for use in names of Jobs created once per that time.
+func jobTimeSuffix(t time.Time) string {
+	return strings.ToLower(t.UTC().Format("20060102t150405z"))
+}
+
+// newJob creates a Job of the component running the pod spec with the job template of the cluster applied.
+// Job pods are not labeled with the name label, so selectors of member pods never match them.
+func newJob(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	component, name string,
+	spec corev1.PodSpec,
+) (*batchv1.Job, error) {
+	template := ptr.Deref(cluster.Spec.JobTemplate, etcdaenixiov1alpha1.JobTemplate{})
+	labels := NewLabelsBuilder().WithInstance(cluster.Name).WithManagedBy().WithComponent(component)
+
+	spec.RestartPolicy = corev1.RestartPolicyNever
+	spec.NodeSelector = template.NodeSelector
+	addLinuxNodeSelector(&spec)
+	spec.Tolerations = template.Tolerations
+	spec.Affinity = template.Affinity
+	addArchitectures(cluster, &spec)
+	spec.ImagePullSecrets = template.ImagePullSecrets
+	if len(spec.ImagePullSecrets) == 0 {
+		spec.ImagePullSecrets = cluster.Spec.PodTemplate.Spec.ImagePullSecrets
+	}
+	for i := range spec.Containers {
+		spec.Containers[i].Resources = template.Resources
+	}
+	addSecurityContext(cluster, &spec)
+	addOpenShiftSecurityContext(cluster, &spec)
+	if fipsEnabled(cluster) {
+		if err := applyFIPSImages(&spec); err != nil {
+			return nil, err
+		}
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      name,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			TTLSecondsAfterFinished: template.TTLSecondsAfterFinished,
+			BackoffLimit:            ptr.To(ptr.Deref(template.BackoffLimit, etcdaenixiov1alpha1.DefaultJobBackoffLimit)),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       spec,
+			},
+		},
+	}, nil
+}
+
+// ListJobs returns Jobs of the component run for the cluster, newest first.
+func ListJobs(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Reader,
+	component string,
+) ([]batchv1.Job, error) {
+	jobs := &batchv1.JobList{}
+	err := rclient.List(ctx, jobs, client.InNamespace(cluster.Namespace),
+		client.MatchingLabels(NewLabelsBuilder().WithInstance(cluster.Name).WithManagedBy().WithComponent(component)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list %s jobs: %w", component, err)
+	}
+	slices.SortFunc(jobs.Items, func(a, b batchv1.Job) int {
+		if c := b.CreationTimestamp.Compare(a.CreationTimestamp.Time); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Name, a.Name)
+	})
+	return jobs.Items, nil
+}
+
+// JobFinished checks if the Job is finished and whether it succeeded.
+func JobFinished(job *batchv1.Job) (finished, succeeded bool) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, true
+		case batchv1.JobFailed:
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// JobFinishTime returns the time the finished Job completed or failed at.
+func JobFinishTime(job *batchv1.Job) metav1.Time {
+	if job.Status.CompletionTime != nil {
+		return *job.Status.CompletionTime
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return condition.LastTransitionTime
+		}
+	}
+	return job.CreationTimestamp
+}
+
+// PruneJobs deletes finished Jobs beyond history limits of the cluster job template. Jobs are expected
+// to be of the same component and sorted newest first, as returned by ListJobs.
+func PruneJobs(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	jobs []batchv1.Job,
+) error {
+	template := ptr.Deref(cluster.Spec.JobTemplate, etcdaenixiov1alpha1.JobTemplate{})
+	keepSucceeded := ptr.Deref(template.SuccessfulJobsHistoryLimit, etcdaenixiov1alpha1.DefaultSuccessfulJobsHistoryLimit)
+	keepFailed := ptr.Deref(template.FailedJobsHistoryLimit, etcdaenixiov1alpha1.DefaultFailedJobsHistoryLimit)
+	for i := range jobs {
+		finished, succeeded := JobFinished(&jobs[i])
+		if !finished {
+			continue
+		}
+		keep := &keepFailed
+		if succeeded {
+			keep = &keepSucceeded
+		}
+		if *keep > 0 {
+			*keep--
+			continue
+		}
+		err := rclient.Delete(ctx, &jobs[i], client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("cannot delete job %s: %w", jobs[i].Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Operator jobs", func() {
+	var (
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+		scheme  *runtime.Scheme
+	)
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+					Destination: etcdaenixiov1alpha1.BackupDestination{
+						S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups", CredentialsSecret: "s3"},
+					},
+					Verify: true,
+				},
+			},
+		}
+	})
+
+	finishedJob := func(name string, created time.Time, condition batchv1.JobConditionType) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "ns",
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(created),
+				Labels: NewLabelsBuilder().WithInstance("test").WithManagedBy().
+					WithComponent(SnapshotVerificationComponent),
+			},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue}},
+			},
+		}
+	}
+
+	It("should apply job template to verification jobs", func(ctx SpecContext) {
+		cluster.Spec.JobTemplate = &etcdaenixiov1alpha1.JobTemplate{
+			TTLSecondsAfterFinished: ptr.To(int32(600)),
+			NodeSelector:            map[string]string{"pool": "jobs"},
+			Tolerations:             []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+		}
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		takenAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		Expect(CreateSnapshotVerificationJob(ctx, cluster, rclient, scheme, "etcd/ns/test/1.db", takenAt, false)).To(Succeed())
+
+		job := &batchv1.Job{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-verify-20240501t100000z"}, job)).To(Succeed())
+		Expect(job.Annotations).To(HaveKeyWithValue(SnapshotKeyAnnotation, "etcd/ns/test/1.db"))
+		Expect(job.Labels).NotTo(HaveKey("app.kubernetes.io/name"))
+		Expect(job.Spec.TTLSecondsAfterFinished).To(Equal(ptr.To(int32(600))))
+		Expect(job.Spec.BackoffLimit).To(Equal(ptr.To(etcdaenixiov1alpha1.DefaultJobBackoffLimit)))
+		spec := job.Spec.Template.Spec
+		Expect(spec.RestartPolicy).To(Equal(corev1.RestartPolicyNever))
+		Expect(spec.NodeSelector).To(Equal(map[string]string{"pool": "jobs", "kubernetes.io/os": "linux"}))
+		Expect(cluster.Spec.JobTemplate.NodeSelector).To(HaveLen(1))
+		Expect(spec.Tolerations).To(HaveLen(1))
+		Expect(spec.Containers[0].Resources.Limits.Memory().String()).To(Equal("1Gi"))
+		Expect(spec.Containers[0].Args).To(ContainElements("verify", "--snapshot=etcd/ns/test/1.db"))
+	})
+
+	It("should restore member volumes by jobs", func(ctx SpecContext) {
+		cluster.Spec.Storage.WALVolumeClaimTemplate = &etcdaenixiov1alpha1.EmbeddedPersistentVolumeClaim{}
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		startTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		Expect(CreateRestoreJob(ctx, cluster, rclient, scheme, "test-1", "etcd/ns/test/1.db", startTime)).To(Succeed())
+
+		job := &batchv1.Job{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: RestoreJobName("test-1", startTime)}, job)).To(Succeed())
+		Expect(job.Labels).To(HaveKeyWithValue("app.kubernetes.io/component", RestoreComponent))
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.Args).To(ContainElements("--overwrite", "--name=test-1",
+			"--peer-url=https://test-1.test.ns.svc:2380", "--wal-dir=/var/run/etcd-wal/default.wal"))
+		Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "RESTORE_SNAPSHOT_KEY", Value: "etcd/ns/test/1.db"}))
+		var claims []string
+		for _, volume := range job.Spec.Template.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				claims = append(claims, volume.PersistentVolumeClaim.ClaimName)
+			}
+		}
+		Expect(claims).To(ConsistOf(GetPVCName(cluster)+"-test-1", GetWALPVCName(cluster)+"-test-1"))
+	})
+
+	It("should pass the proxy and pull secrets to restore jobs", func(ctx SpecContext) {
+		DeferCleanup(Configure, settings)
+		Configure(Settings{
+			AgentImage: "mirror.example.com/etcd-operator:v0.1",
+			Proxy:      etcdaenixiov1alpha1.ProxySpec{HTTPSProxy: "http://operator-proxy:3128", NoProxy: ".svc"},
+		})
+		cluster.Spec.Backup.Destination.Proxy = &etcdaenixiov1alpha1.ProxySpec{HTTPSProxy: "http://proxy:3128"}
+		cluster.Spec.PodTemplate.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "mirror"}}
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		startTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		Expect(CreateRestoreJob(ctx, cluster, rclient, scheme, "test-1", "etcd/ns/test/1.db", startTime)).To(Succeed())
+
+		job := &batchv1.Job{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: RestoreJobName("test-1", startTime)}, job)).To(Succeed())
+		Expect(job.Spec.Template.Spec.ImagePullSecrets).To(ConsistOf(corev1.LocalObjectReference{Name: "mirror"}))
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal("mirror.example.com/etcd-operator:v0.1"))
+		Expect(container.Env).To(ContainElements(
+			corev1.EnvVar{Name: "HTTPS_PROXY", Value: "http://proxy:3128"},
+			corev1.EnvVar{Name: "NO_PROXY", Value: ".svc"},
+		))
+		Expect(container.Env).NotTo(ContainElement(HaveField("Name", "HTTP_PROXY")))
+	})
+
+	It("should keep finished jobs within history limits", func(ctx SpecContext) {
+		cluster.Spec.JobTemplate = &etcdaenixiov1alpha1.JobTemplate{
+			SuccessfulJobsHistoryLimit: ptr.To(int32(1)),
+			FailedJobsHistoryLimit:     ptr.To(int32(1)),
+		}
+		now := time.Now().Truncate(time.Second)
+		rclient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			finishedJob("test-verify-1", now.Add(-4*time.Hour), batchv1.JobComplete),
+			finishedJob("test-verify-2", now.Add(-3*time.Hour), batchv1.JobFailed),
+			finishedJob("test-verify-3", now.Add(-2*time.Hour), batchv1.JobFailed),
+			finishedJob("test-verify-4", now.Add(-time.Hour), batchv1.JobComplete),
+		).Build()
+
+		jobs, err := ListJobs(ctx, cluster, rclient, SnapshotVerificationComponent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jobs).To(HaveLen(4))
+		Expect(jobs[0].Name).To(Equal("test-verify-4"))
+		Expect(PruneJobs(ctx, cluster, rclient, jobs)).To(Succeed())
+
+		jobs, err = ListJobs(ctx, cluster, rclient, SnapshotVerificationComponent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jobs).To(HaveLen(2))
+		Expect(jobs[0].Name).To(Equal("test-verify-4"))
+		Expect(jobs[1].Name).To(Equal("test-verify-3"))
+	})
+})
@@ -1,5 +1,14 @@
 package factory
 
+// RoleLabel is the label of member pods set by the operator to the role of the member,
+// so the leader and followers Services can select them.
+const RoleLabel = "etcd.aenix.io/role"
+
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
 type LabelsBuilder map[string]string
 
 func NewLabelsBuilder() LabelsBuilder {
@@ -20,3 +29,13 @@ func (b LabelsBuilder) WithManagedBy() LabelsBuilder {
 	b["app.kubernetes.io/managed-by"] = "etcd-operator"
 	return b
 }
+
+func (b LabelsBuilder) WithRole(role string) LabelsBuilder {
+	b[RoleLabel] = role
+	return b
+}
+
+func (b LabelsBuilder) WithComponent(component string) LabelsBuilder {
+	b["app.kubernetes.io/component"] = component
+	return b
+}
@@ -26,6 +26,11 @@ var _ = Describe("Labels builder", func() {
 			builder.WithInstance("local")
 			Expect(builder["app.kubernetes.io/instance"]).To(Equal("local"))
 		})
+		It("WithRole sets correct key and value", func() {
+			builder := NewLabelsBuilder()
+			builder.WithRole(RoleLeader)
+			Expect(builder["etcd.aenix.io/role"]).To(Equal("leader"))
+		})
 		It("Chaining methods builds correct map", func() {
 			builder := NewLabelsBuilder()
 			builder.WithName().WithManagedBy().WithInstance("local")
@@ -0,0 +1,56 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// logsVolumeName is the name of the volume etcd writes logs to while they are shipped by a sidecar.
+const logsVolumeName = "logs"
+
+// addLogShipping adds the volume etcd writes logs to and the log forwarding sidecar reading them to the pod spec.
+// The volume is limited to the size of the log file and its rotated backups with room for one more file.
+func addLogShipping(cluster *etcdaenixiov1alpha1.EtcdCluster, podSpec *corev1.PodSpec) {
+	if cluster.Spec.Logging == nil || cluster.Spec.Logging.Shipping == nil {
+		return
+	}
+	shipping := cluster.Spec.Logging.Shipping
+	sizeLimit := resource.NewQuantity(shipping.MaxSizeMB()*int64(shipping.Backups()+2)<<20, resource.BinarySI)
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         logsVolumeName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{SizeLimit: sizeLimit}},
+	})
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == etcdContainerName {
+			podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, corev1.VolumeMount{
+				Name:      logsVolumeName,
+				MountPath: etcdaenixiov1alpha1.LogShippingPath,
+			})
+		}
+	}
+	sidecar := *shipping.Container.DeepCopy()
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, corev1.VolumeMount{
+		Name:      logsVolumeName,
+		ReadOnly:  true,
+		MountPath: etcdaenixiov1alpha1.LogShippingPath,
+	})
+	podSpec.Containers = append(podSpec.Containers, sidecar)
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// Factory functions never modify the cluster they build objects of, so the spec stays exactly as applied and
+// GitOps tools don't see drift. Parts of the spec which have to be adjusted before they are used are normalized
+// here, on copies.
+
+// normalizedPodTemplateSpec returns a copy of the pod spec of the cluster pod template ready to be
+// strategic-merged into the generated pod spec.
+func normalizedPodTemplateSpec(cluster *etcdaenixiov1alpha1.EtcdCluster) corev1.PodSpec {
+	spec := cluster.Spec.PodTemplate.Spec.DeepCopy()
+	// containers are serialized even if nil, and null would remove generated containers in the merge
+	if spec.Containers == nil {
+		spec.Containers = make([]corev1.Container, 0)
+	}
+	return *spec
+}
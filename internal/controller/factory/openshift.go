@@ -0,0 +1,171 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// ServingCertSecretAnnotation requests a serving certificate from the OpenShift service CA
+	// into the Secret of the given name.
+	ServingCertSecretAnnotation = "service.beta.openshift.io/serving-cert-secret-name"
+	// InjectCABundleAnnotation requests the OpenShift service CA bundle to be injected into a ConfigMap
+	// under the etcd.ServiceCABundleKey key.
+	InjectCABundleAnnotation = "service.beta.openshift.io/inject-cabundle"
+)
+
+// RouteGVK is the kind of OpenShift Routes exposing the client service.
+var RouteGVK = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+
+// addOpenShiftSecurityContext sets security contexts admitted by the restricted-v2 security context constraints
+// to the pod spec and all its containers. The UID and the fsGroup are left to the constraints, which assign them
+// from the range of the namespace.
+func addOpenShiftSecurityContext(cluster *etcdaenixiov1alpha1.EtcdCluster, podSpec *corev1.PodSpec) {
+	if cluster.Spec.OpenShift == nil {
+		return
+	}
+	if podSpec.SecurityContext == nil {
+		podSpec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	podSpec.SecurityContext.RunAsNonRoot = ptr.To(true)
+	podSpec.SecurityContext.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			containers[i].SecurityContext = &corev1.SecurityContext{
+				AllowPrivilegeEscalation: ptr.To(false),
+				Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			}
+		}
+	}
+}
+
+// CreateOrUpdateRoute creates the OpenShift Route of the client service if it is enabled and removes it otherwise.
+// TLS is passed through to members, since etcd clients authenticate members and may authenticate themselves
+// with certificates.
+func CreateOrUpdateRoute(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+) error {
+	if cluster.Spec.OpenShift == nil {
+		// Routes can't exist without OpenShift
+		return nil
+	}
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(RouteGVK)
+	route.SetNamespace(cluster.Namespace)
+	route.SetName(GetClientServiceName(cluster))
+	if cluster.Spec.OpenShift.Route == nil {
+		if err := rclient.Delete(ctx, route); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("cannot delete route %s: %w", route.GetName(), err)
+		}
+		return nil
+	}
+
+	route.SetLabels(NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy())
+	spec := map[string]interface{}{
+		"to": map[string]interface{}{
+			"kind":   "Service",
+			"name":   GetClientServiceName(cluster),
+			"weight": int64(100),
+		},
+		"port": map[string]interface{}{"targetPort": clientServicePort(cluster).Name},
+		"tls": map[string]interface{}{
+			"termination":                   "passthrough",
+			"insecureEdgeTerminationPolicy": "None",
+		},
+	}
+	if host := cluster.Spec.OpenShift.Route.Host; host != "" {
+		spec["host"] = host
+	}
+	route.Object["spec"] = spec
+	if err := SetOwner(cluster, route, rscheme); err != nil {
+		return fmt.Errorf("cannot set controller reference: %w", err)
+	}
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(RouteGVK)
+	done, err := createOrGet(ctx, rclient, route, current)
+	if err != nil {
+		return fmt.Errorf("cannot create or get route %s: %w", route.GetName(), err)
+	}
+	if done {
+		return nil
+	}
+	if _, ok := spec["host"]; !ok {
+		// keep the host generated by the router
+		if host, ok, _ := unstructured.NestedString(current.Object, "spec", "host"); ok {
+			spec["host"] = host
+		}
+	}
+	current.Object["spec"] = spec
+	current.SetLabels(route.GetLabels())
+	current.SetOwnerReferences(route.GetOwnerReferences())
+	return rclient.Update(ctx, current)
+}
+
+// CreateOrUpdateServiceCABundle creates the ConfigMap the OpenShift service CA bundle is injected into if the
+// server certificate is issued by the service CA. The bundle injected into the ConfigMap is kept.
+func CreateOrUpdateServiceCABundle(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+) error {
+	if !cluster.ServiceCAEnabled() {
+		return nil
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   cluster.Namespace,
+			Name:        cluster.ServiceCABundleConfigMap(),
+			Labels:      NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy(),
+			Annotations: map[string]string{InjectCABundleAnnotation: "true"},
+		},
+	}
+	if err := SetOwner(cluster, configMap, rscheme); err != nil {
+		return fmt.Errorf("cannot set controller reference: %w", err)
+	}
+	current := &corev1.ConfigMap{}
+	done, err := createOrGet(ctx, rclient, configMap, current)
+	if err != nil {
+		return fmt.Errorf("cannot create or get service CA bundle configmap: %w", err)
+	}
+	if done {
+		return nil
+	}
+	current.Labels = configMap.Labels
+	if current.Annotations == nil {
+		current.Annotations = map[string]string{}
+	}
+	current.Annotations[InjectCABundleAnnotation] = "true"
+	current.OwnerReferences = configMap.OwnerReferences
+	return rclient.Update(ctx, current)
+}
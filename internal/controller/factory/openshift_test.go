@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("OpenShift", func() {
+	var (
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+		scheme  *runtime.Scheme
+	)
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(3)),
+				Security: &etcdaenixiov1alpha1.SecuritySpec{TLS: etcdaenixiov1alpha1.TLSSpec{
+					ServerSecret: "test-server-tls",
+				}},
+				OpenShift: &etcdaenixiov1alpha1.OpenShiftSpec{
+					Route:     &etcdaenixiov1alpha1.RouteSpec{},
+					ServiceCA: true,
+				},
+			},
+		}
+	})
+
+	It("should set restricted security contexts to pods and containers", func() {
+		podSpec := corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "restore"}},
+			Containers:     []corev1.Container{{Name: "etcd"}, {Name: "agent"}},
+		}
+		addOpenShiftSecurityContext(cluster, &podSpec)
+		Expect(podSpec.SecurityContext.RunAsNonRoot).To(Equal(ptr.To(true)))
+		Expect(podSpec.SecurityContext.RunAsUser).To(BeNil())
+		Expect(podSpec.SecurityContext.SeccompProfile.Type).To(Equal(corev1.SeccompProfileTypeRuntimeDefault))
+		for _, container := range append(podSpec.InitContainers, podSpec.Containers...) {
+			Expect(container.SecurityContext.AllowPrivilegeEscalation).To(Equal(ptr.To(false)))
+			Expect(container.SecurityContext.Capabilities.Drop).To(ConsistOf(corev1.Capability("ALL")))
+		}
+	})
+
+	It("should pass clients through the route and keep the generated host", func(ctx SpecContext) {
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		Expect(CreateOrUpdateRoute(ctx, cluster, rclient, scheme)).To(Succeed())
+
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(RouteGVK)
+		key := client.ObjectKey{Namespace: "ns", Name: "test-client"}
+		Expect(rclient.Get(ctx, key, route)).To(Succeed())
+		Expect(route.GetOwnerReferences()).To(HaveLen(1))
+		Expect(route.Object).To(HaveKeyWithValue("spec", SatisfyAll(
+			HaveKeyWithValue("to", HaveKeyWithValue("name", "test-client")),
+			HaveKeyWithValue("tls", HaveKeyWithValue("termination", "passthrough")),
+			Not(HaveKey("host")),
+		)))
+
+		Expect(unstructured.SetNestedField(route.Object, "test-client-ns.apps.example.com", "spec", "host")).To(Succeed())
+		Expect(rclient.Update(ctx, route)).To(Succeed())
+		Expect(CreateOrUpdateRoute(ctx, cluster, rclient, scheme)).To(Succeed())
+		Expect(rclient.Get(ctx, key, route)).To(Succeed())
+		Expect(route.Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("host", "test-client-ns.apps.example.com")))
+
+		cluster.Spec.OpenShift.Route = nil
+		Expect(CreateOrUpdateRoute(ctx, cluster, rclient, scheme)).To(Succeed())
+		Expect(apierrors.IsNotFound(rclient.Get(ctx, key, route))).To(BeTrue())
+	})
+
+	It("should request service CA certificate and bundle", func(ctx SpecContext) {
+		rclient := fake.NewClientBuilder().WithScheme(scheme).Build()
+		Expect(CreateOrUpdateClusterService(ctx, cluster, rclient, scheme)).To(Succeed())
+		Expect(CreateOrUpdateServiceCABundle(ctx, cluster, rclient, scheme)).To(Succeed())
+
+		svc := &corev1.Service{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test"}, svc)).To(Succeed())
+		Expect(svc.Annotations).To(HaveKeyWithValue(ServingCertSecretAnnotation, "test-server-tls"))
+
+		bundle := &corev1.ConfigMap{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-service-ca"}, bundle)).To(Succeed())
+		Expect(bundle.Annotations).To(HaveKeyWithValue(InjectCABundleAnnotation, "true"))
+
+		bundle.Data = map[string]string{"service-ca.crt": "bundle"}
+		Expect(rclient.Update(ctx, bundle)).To(Succeed())
+		Expect(CreateOrUpdateServiceCABundle(ctx, cluster, rclient, scheme)).To(Succeed())
+		Expect(rclient.Get(ctx, client.ObjectKeyFromObject(bundle), bundle)).To(Succeed())
+		Expect(bundle.Data).To(HaveKeyWithValue("service-ca.crt", "bundle"))
+	})
+})
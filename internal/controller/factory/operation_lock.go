@@ -0,0 +1,167 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// Operation is a disruptive workflow of the cluster. Only one operation runs at a time.
+type Operation string
+
+const (
+	// OperationRollout updates members to the current pod template.
+	OperationRollout Operation = "rollout"
+	// OperationRotation replaces members older than the maximum age.
+	OperationRotation Operation = "rotation"
+	// OperationScale changes the number of members.
+	OperationScale Operation = "scale"
+	// OperationReplaceMember replaces the member requested by the user.
+	OperationReplaceMember Operation = "replace-member"
+	// OperationRestore restores the cluster from a snapshot.
+	OperationRestore Operation = "restore"
+	// OperationDefragment defragments members requested by an EtcdOperation.
+	OperationDefragment Operation = "defragment"
+	// OperationRemoveMember removes the member requested by an EtcdOperation.
+	OperationRemoveMember Operation = "remove-member"
+)
+
+// OperationLockDuration is how long the lock is held by the operation without being renewed.
+// Once it expires, the lock can be taken by other operations.
+const OperationLockDuration = 15 * time.Minute
+
+// preempts checks if the operation takes the lock over from operations which run on their own.
+// Restores and operations requested by the user recover the cluster, so they never wait for updates
+// which may wait for the cluster to become healthy themselves.
+func (o Operation) preempts() bool {
+	return o == OperationRestore || o == OperationReplaceMember || o == OperationRemoveMember
+}
+
+// GetOperationLockName returns the name of the Lease the operation lock of the cluster is kept in.
+func GetOperationLockName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	return cluster.Name + "-operation"
+}
+
+// AcquireOperationLock takes the operation lock of the cluster for the operation, or renews it if the operation
+// already holds it. The lock is taken if it is free, expired or held by an operation the given one preempts.
+// It returns the operation holding the lock, so the caller has to wait unless it is the given one.
+func AcquireOperationLock(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+	operation Operation,
+) (Operation, error) {
+	lease := &coordinationv1.Lease{}
+	err := rclient.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: GetOperationLockName(cluster)}, lease)
+	if client.IgnoreNotFound(err) != nil {
+		return "", fmt.Errorf("cannot get operation lock: %w", err)
+	}
+	exists := err == nil
+	now := time.Now()
+	holder := Operation(ptr.Deref(lease.Spec.HolderIdentity, ""))
+	if holder != "" && holder != operation && !operationLockExpired(lease, now) && (!operation.preempts() || holder.preempts()) {
+		return holder, nil
+	}
+	if holder == operation && !operationLockExpired(lease, now.Add(OperationLockDuration*2/3)) {
+		// renewed recently enough
+		return operation, nil
+	}
+
+	if holder != operation {
+		log.FromContext(ctx).Info("operation lock acquired", "operation", operation, "previous", holder)
+		lease.Spec.AcquireTime = &metav1.MicroTime{Time: now}
+		lease.Spec.LeaseTransitions = ptr.To(ptr.Deref(lease.Spec.LeaseTransitions, 0) + 1)
+	}
+	lease.Spec.HolderIdentity = ptr.To(string(operation))
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(OperationLockDuration.Seconds()))
+	lease.Spec.RenewTime = &metav1.MicroTime{Time: now}
+	if exists {
+		// conflicting updates fail, so only one operation takes the lock
+		if err = rclient.Update(ctx, lease); err != nil {
+			return "", fmt.Errorf("cannot update operation lock: %w", err)
+		}
+		return operation, nil
+	}
+	lease.Namespace = cluster.Namespace
+	lease.Name = GetOperationLockName(cluster)
+	lease.Labels = NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy()
+	if err = SetOwner(cluster, lease, rscheme); err != nil {
+		return "", fmt.Errorf("cannot set controller reference: %w", err)
+	}
+	if err = rclient.Create(ctx, lease); err != nil {
+		return "", fmt.Errorf("cannot create operation lock: %w", err)
+	}
+	return operation, nil
+}
+
+// OperationLockHolder returns the operation holding the operation lock of the cluster or empty string
+// if the lock is free or expired.
+func OperationLockHolder(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, rclient client.Client) (Operation, error) {
+	lease := &coordinationv1.Lease{}
+	err := rclient.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: GetOperationLockName(cluster)}, lease)
+	if err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	if operationLockExpired(lease, time.Now()) {
+		return "", nil
+	}
+	return Operation(ptr.Deref(lease.Spec.HolderIdentity, "")), nil
+}
+
+// ReleaseOperationLock releases the operation lock of the cluster if it is held by the operation.
+func ReleaseOperationLock(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	operation Operation,
+) error {
+	lease := &coordinationv1.Lease{}
+	err := rclient.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: GetOperationLockName(cluster)}, lease)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != string(operation) {
+		return nil
+	}
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.RenewTime = nil
+	if err = rclient.Update(ctx, lease); err != nil {
+		return fmt.Errorf("cannot release operation lock: %w", err)
+	}
+	log.FromContext(ctx).Info("operation lock released", "operation", operation)
+	return nil
+}
+
+// operationLockExpired checks if the lock is not renewed for longer than its duration at the given time.
+func operationLockExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second).Before(now)
+}
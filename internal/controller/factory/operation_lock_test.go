@@ -0,0 +1,85 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Operation lock", func() {
+	var (
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+		scheme  *runtime.Scheme
+		rclient client.Client
+	)
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		rclient = fake.NewClientBuilder().WithScheme(scheme).Build()
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+		}
+	})
+
+	It("should run one operation at a time", func(ctx SpecContext) {
+		Expect(AcquireOperationLock(ctx, cluster, rclient, scheme, OperationRollout)).To(Equal(OperationRollout))
+		Expect(AcquireOperationLock(ctx, cluster, rclient, scheme, OperationRollout)).To(Equal(OperationRollout))
+		Expect(AcquireOperationLock(ctx, cluster, rclient, scheme, OperationScale)).To(Equal(OperationRollout))
+		Expect(OperationLockHolder(ctx, cluster, rclient)).To(Equal(OperationRollout))
+
+		Expect(ReleaseOperationLock(ctx, cluster, rclient, OperationScale)).To(Succeed())
+		Expect(OperationLockHolder(ctx, cluster, rclient)).To(Equal(OperationRollout))
+		Expect(ReleaseOperationLock(ctx, cluster, rclient, OperationRollout)).To(Succeed())
+		Expect(OperationLockHolder(ctx, cluster, rclient)).To(BeEmpty())
+		Expect(AcquireOperationLock(ctx, cluster, rclient, scheme, OperationScale)).To(Equal(OperationScale))
+	})
+
+	It("should let restores take the lock over from updates", func(ctx SpecContext) {
+		Expect(AcquireOperationLock(ctx, cluster, rclient, scheme, OperationRotation)).To(Equal(OperationRotation))
+		Expect(AcquireOperationLock(ctx, cluster, rclient, scheme, OperationRestore)).To(Equal(OperationRestore))
+		Expect(AcquireOperationLock(ctx, cluster, rclient, scheme, OperationReplaceMember)).To(Equal(OperationRestore))
+		Expect(AcquireOperationLock(ctx, cluster, rclient, scheme, OperationRotation)).To(Equal(OperationRestore))
+	})
+
+	It("should let other operations take expired lock", func(ctx SpecContext) {
+		Expect(AcquireOperationLock(ctx, cluster, rclient, scheme, OperationRollout)).To(Equal(OperationRollout))
+		lease := &coordinationv1.Lease{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-operation"}, lease)).To(Succeed())
+		Expect(lease.OwnerReferences).To(HaveLen(1))
+		lease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now().Add(-OperationLockDuration - time.Minute)}
+		Expect(rclient.Update(ctx, lease)).To(Succeed())
+
+		Expect(OperationLockHolder(ctx, cluster, rclient)).To(BeEmpty())
+		Expect(AcquireOperationLock(ctx, cluster, rclient, scheme, OperationScale)).To(Equal(OperationScale))
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-operation"}, lease)).To(Succeed())
+		Expect(lease.Spec.LeaseTransitions).To(Equal(ptr.To(int32(2))))
+	})
+})
@@ -0,0 +1,44 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// OwnedByAnnotation is the field manager of the operator generating the object. Along with the field manager
+// of writes in managedFields, it tells which operator manages the object when several operators or GitOps tools
+// manage objects in the same namespace.
+const OwnedByAnnotation = "etcd.aenix.io/owned-by"
+
+// SetOwner makes the cluster the controller of the generated object and stamps the object with OwnedByAnnotation.
+func SetOwner(cluster *etcdaenixiov1alpha1.EtcdCluster, obj client.Object, rscheme *runtime.Scheme) error {
+	if err := ctrl.SetControllerReference(cluster, obj, rscheme); err != nil {
+		return err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[OwnedByAnnotation] = settings.FieldManager
+	obj.SetAnnotations(annotations)
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("SetOwner", func() {
+	BeforeEach(func() {
+		previous := settings
+		DeferCleanup(func() { settings = previous })
+		settings.FieldManager = "etcd-operator-team-a"
+	})
+
+	It("should make the cluster the controller and stamp the operator", func() {
+		scheme := runtime.NewScheme()
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "uid"}}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "ns",
+			Name:        "test",
+			Annotations: map[string]string{"example.com/key": "value"},
+		}}
+
+		Expect(SetOwner(cluster, configMap, scheme)).To(Succeed())
+		Expect(metav1.IsControlledBy(configMap, cluster)).To(BeTrue())
+		Expect(configMap.Annotations).To(Equal(map[string]string{
+			"example.com/key": "value",
+			OwnedByAnnotation: "etcd-operator-team-a",
+		}))
+	})
+})
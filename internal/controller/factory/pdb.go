@@ -26,7 +26,6 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/utils/ptr"
-	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -67,7 +66,7 @@ func CreateOrUpdatePdb(
 
 	logger.V(2).Info("pdb spec generated", "pdb_name", pdb.Name, "pdb_spec", pdb.Spec)
 
-	if err := ctrl.SetControllerReference(cluster, pdb, rscheme); err != nil {
+	if err := SetOwner(cluster, pdb, rscheme); err != nil {
 		return fmt.Errorf("cannot set controller reference: %w", err)
 	}
 
@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// ControlPlaneNodeRole is the label and taint key of control plane nodes.
+	ControlPlaneNodeRole = "node-role.kubernetes.io/control-plane"
+	// legacyMasterNodeRole is the taint key of control plane nodes set up by older Kubernetes versions.
+	legacyMasterNodeRole = "node-role.kubernetes.io/master"
+)
+
+// addPlacement adds node selector and tolerations of the cluster placement to the pod spec.
+func addPlacement(cluster *etcdaenixiov1alpha1.EtcdCluster, podSpec *corev1.PodSpec) {
+	if cluster.Spec.Placement == nil || !cluster.Spec.Placement.ControlPlane {
+		return
+	}
+	podSpec.NodeSelector = map[string]string{ControlPlaneNodeRole: ""}
+	podSpec.Tolerations = []corev1.Toleration{
+		{Key: ControlPlaneNodeRole, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+		{Key: legacyMasterNodeRole, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	}
+}
+
+// addLinuxNodeSelector selects linux nodes, as etcd and agent images are built for linux only, e.g. to keep pods
+// off Windows node pools. A kubernetes.io/os node selector set in the pod template or the job template is kept.
+func addLinuxNodeSelector(podSpec *corev1.PodSpec) {
+	if _, ok := podSpec.NodeSelector[corev1.LabelOSStable]; ok {
+		return
+	}
+	// the node selector can be shared with the job template of the cluster
+	nodeSelector := maps.Clone(podSpec.NodeSelector)
+	if nodeSelector == nil {
+		nodeSelector = map[string]string{}
+	}
+	nodeSelector[corev1.LabelOSStable] = "linux"
+	podSpec.NodeSelector = nodeSelector
+}
+
+// addArchitectures requires nodes of the cluster architectures in the node affinity of the pod spec. The requirement
+// is added to every required node selector term, as terms are ORed.
+func addArchitectures(cluster *etcdaenixiov1alpha1.EtcdCluster, podSpec *corev1.PodSpec) {
+	if len(cluster.Spec.Architectures) == 0 {
+		return
+	}
+	requirement := corev1.NodeSelectorRequirement{Key: corev1.LabelArchStable, Operator: corev1.NodeSelectorOpIn}
+	for _, arch := range cluster.Spec.Architectures {
+		requirement.Values = append(requirement.Values, string(arch))
+	}
+	// the affinity can be shared with the job template of the cluster
+	affinity := podSpec.Affinity.DeepCopy()
+	if affinity == nil {
+		affinity = &corev1.Affinity{}
+	}
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		required = &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{}}}
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = required
+	}
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		term.MatchExpressions = append(term.MatchExpressions, requirement)
+	}
+	podSpec.Affinity = affinity
+}
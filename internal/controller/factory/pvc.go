@@ -25,3 +25,11 @@ func GetPVCName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
 	//nolint:goconst
 	return "data"
 }
+
+// GetWALPVCName returns the name of the volume claim template used for the dedicated WAL volume.
+func GetWALPVCName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	if cluster.Spec.Storage.WALVolumeClaimTemplate != nil && len(cluster.Spec.Storage.WALVolumeClaimTemplate.Name) > 0 {
+		return cluster.Spec.Storage.WALVolumeClaimTemplate.Name
+	}
+	return "wal"
+}
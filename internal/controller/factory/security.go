@@ -0,0 +1,41 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// addSecurityContext sets the user and groups of the cluster security context in the pod security context.
+func addSecurityContext(cluster *etcdaenixiov1alpha1.EtcdCluster, podSpec *corev1.PodSpec) {
+	securityContext := cluster.Spec.SecurityContext
+	if securityContext == nil {
+		return
+	}
+	if podSpec.SecurityContext == nil {
+		podSpec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	podSpec.SecurityContext.RunAsUser = securityContext.RunAsUser
+	podSpec.SecurityContext.RunAsGroup = securityContext.RunAsGroup
+	podSpec.SecurityContext.FSGroup = securityContext.FSGroup
+	if securityContext.NonRoot() {
+		podSpec.SecurityContext.RunAsNonRoot = ptr.To(true)
+	}
+}
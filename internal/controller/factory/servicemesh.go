@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/agent"
+)
+
+// serviceMeshAnnotations returns annotations of member pods configuring the proxy injected by the service mesh.
+// Client, peer and metrics ports are excluded from interception: etcd secures them with its own TLS, and
+// the operator connects to members from outside of the mesh.
+func serviceMeshAnnotations(cluster *etcdaenixiov1alpha1.EtcdCluster) map[string]string {
+	mesh := cluster.Spec.ServiceMesh
+	if mesh == nil {
+		return nil
+	}
+	annotations := map[string]string{}
+	inbound := []int{int(cluster.ClientPort()), int(cluster.PeerPort()), int(cluster.MetricsPort())}
+	if restoreEnabled(cluster) {
+		inbound = append(inbound, agent.RestoreProgressPort)
+	}
+	if cluster.Spec.Agent != nil && cluster.Spec.Agent.VolumeMetrics {
+		inbound = append(inbound, agent.MetricsPort)
+	}
+	outbound := []int{int(cluster.ClientPort()), int(cluster.PeerPort())}
+
+	switch mesh.Provider {
+	case etcdaenixiov1alpha1.ServiceMeshLinkerd:
+		if ptr.Deref(mesh.ExcludePorts, true) {
+			annotations["config.linkerd.io/skip-inbound-ports"] = joinPorts(inbound)
+			annotations["config.linkerd.io/skip-outbound-ports"] = joinPorts(outbound)
+		}
+		if mesh.HoldUntilProxyStarts {
+			annotations["config.linkerd.io/proxy-await"] = "enabled"
+		}
+		if mesh.NativeSidecars {
+			annotations["config.alpha.linkerd.io/proxy-enable-native-sidecar"] = "true"
+		}
+	default:
+		if ptr.Deref(mesh.ExcludePorts, true) {
+			annotations["traffic.sidecar.istio.io/excludeInboundPorts"] = joinPorts(inbound)
+			annotations["traffic.sidecar.istio.io/excludeOutboundPorts"] = joinPorts(outbound)
+		}
+		if mesh.HoldUntilProxyStarts {
+			config, _ := json.Marshal(map[string]bool{"holdApplicationUntilProxyStarts": true})
+			annotations["proxy.istio.io/config"] = string(config)
+		}
+		if mesh.NativeSidecars {
+			annotations["sidecar.istio.io/nativeSidecar"] = "true"
+		}
+	}
+	return annotations
+}
+
+func joinPorts(ports []int) string {
+	values := make([]string, 0, len(ports))
+	for _, port := range ports {
+		values = append(values, strconv.Itoa(port))
+	}
+	return strings.Join(values, ",")
+}
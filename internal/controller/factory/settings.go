@@ -0,0 +1,53 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// DefaultAgentImage is the image of the operator used to run agents inside etcd member pods.
+const DefaultAgentImage = "ghcr.io/aenix-io/etcd-operator:latest"
+
+// DefaultFieldManager is the field manager of the operator writes and the owner stamped on generated objects.
+const DefaultFieldManager = "etcd-operator"
+
+// Settings are operator-wide settings used to generate managed objects.
+type Settings struct {
+	// AgentImage is the operator image used to run agents inside etcd member pods.
+	AgentImage string
+	// FIPS enables FIPS mode for clusters which don't set it explicitly.
+	FIPS bool
+	// FIPSImages maps images of member pods to their FIPS-compliant builds used in FIPS mode.
+	FIPSImages map[string]string
+	// NativeSidecars runs agent sidecars as native sidecar containers for clusters which don't set it explicitly.
+	NativeSidecars bool
+	// Proxy is the proxy of the operator, passed to agents reaching the backup storage.
+	Proxy etcdaenixiov1alpha1.ProxySpec
+	// FieldManager is the field manager of the operator writes, stamped on generated objects in OwnedByAnnotation.
+	FieldManager string
+}
+
+var settings = Settings{
+	AgentImage:   DefaultAgentImage,
+	FieldManager: DefaultFieldManager,
+}
+
+// Configure sets operator-wide settings. It is expected to be called once on operator start.
+func Configure(s Settings) {
+	settings = s
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// SpecHistoryLimit is the number of the latest spec generations kept in the spec history ConfigMap.
+	SpecHistoryLimit = 20
+	// specHistoryKeyPrefix is the prefix of ConfigMap keys of history entries, followed by the zero-padded
+	// generation, so keys sort in order of generations.
+	specHistoryKeyPrefix = "generation-"
+	// maxChangeValueLength is the maximum length of values shown in the change summary.
+	maxChangeValueLength = 64
+)
+
+// SpecHistoryEntry is the record of a cluster spec generation kept in the spec history ConfigMap.
+type SpecHistoryEntry struct {
+	// Generation is the generation of the cluster spec.
+	Generation int64 `json:"generation"`
+	// ObservedAt is the time the operator observed the generation at.
+	ObservedAt metav1.Time `json:"observedAt"`
+	// Changes summarize differences from the previous recorded generation.
+	Changes []string `json:"changes,omitempty"`
+	// Spec is the cluster spec of the generation.
+	Spec json.RawMessage `json:"spec"`
+}
+
+// GetSpecHistoryConfigMapName returns the name of the ConfigMap spec history of the cluster is kept in.
+func GetSpecHistoryConfigMapName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	return cluster.Name + "-spec-history"
+}
+
+// RecordSpecHistory appends the current generation of the cluster spec to the spec history ConfigMap,
+// together with a summary of changes from the previous recorded generation. Recorded entries are never
+// changed, only the oldest ones are deleted to keep SpecHistoryLimit latest generations.
+func RecordSpecHistory(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+) error {
+	configMap := &corev1.ConfigMap{}
+	err := rclient.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: GetSpecHistoryConfigMapName(cluster)}, configMap)
+	if client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("cannot get spec history configmap: %w", err)
+	}
+	exists := err == nil
+	key := specHistoryKey(cluster.Generation)
+	if _, ok := configMap.Data[key]; ok {
+		return nil
+	}
+
+	spec, err := json.Marshal(cluster.Spec)
+	if err != nil {
+		return fmt.Errorf("cannot marshal cluster spec: %w", err)
+	}
+	entry := SpecHistoryEntry{
+		Generation: cluster.Generation,
+		ObservedAt: metav1.Time{Time: time.Now().Truncate(time.Second)},
+		Spec:       spec,
+	}
+	keys := specHistoryKeys(configMap)
+	if len(keys) > 0 {
+		previous := SpecHistoryEntry{}
+		if err = json.Unmarshal([]byte(configMap.Data[keys[len(keys)-1]]), &previous); err == nil {
+			entry.Changes = SpecChanges(previous.Spec, spec)
+		}
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("cannot marshal spec history entry: %w", err)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[key] = string(data)
+	keys = append(keys, key)
+	for _, old := range keys[:max(len(keys)-SpecHistoryLimit, 0)] {
+		delete(configMap.Data, old)
+	}
+	log.FromContext(ctx).V(2).Info("recording spec generation", "generation", cluster.Generation, "changes", entry.Changes)
+
+	if exists {
+		return rclient.Update(ctx, configMap)
+	}
+	configMap.Namespace = cluster.Namespace
+	configMap.Name = GetSpecHistoryConfigMapName(cluster)
+	configMap.Labels = NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy()
+	if err = SetOwner(cluster, configMap, rscheme); err != nil {
+		return fmt.Errorf("cannot set controller reference: %w", err)
+	}
+	err = rclient.Create(ctx, configMap)
+	if errors.IsAlreadyExists(err) {
+		// the entry is recorded on the next reconciliation
+		return nil
+	}
+	return err
+}
+
+// SpecChanges summarizes differences between two cluster specs marshaled to JSON, one line per changed field.
+// Fields added or removed as a whole are not descended into, lists are compared as a whole.
+func SpecChanges(previous, current json.RawMessage) []string {
+	var before, after interface{}
+	if json.Unmarshal(previous, &before) != nil || json.Unmarshal(current, &after) != nil {
+		return nil
+	}
+	var changes []string
+	diffValues("spec", before, after, &changes)
+	return changes
+}
+
+func diffValues(path string, before, after interface{}, changes *[]string) {
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if !beforeIsMap || !afterIsMap {
+		if !reflect.DeepEqual(before, after) {
+			*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, changeValue(before), changeValue(after)))
+		}
+		return
+	}
+	keys := make([]string, 0, len(beforeMap)+len(afterMap))
+	for key := range beforeMap {
+		keys = append(keys, key)
+	}
+	for key := range afterMap {
+		if _, ok := beforeMap[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		childPath := path + "." + key
+		beforeValue, inBefore := beforeMap[key]
+		afterValue, inAfter := afterMap[key]
+		switch {
+		case !inBefore:
+			*changes = append(*changes, fmt.Sprintf("%s: added %s", childPath, changeValue(afterValue)))
+		case !inAfter:
+			*changes = append(*changes, fmt.Sprintf("%s: removed", childPath))
+		default:
+			diffValues(childPath, beforeValue, afterValue, changes)
+		}
+	}
+}
+
+// changeValue renders the value for the change summary, truncating long values.
+func changeValue(value interface{}) string {
+	data, _ := json.Marshal(value)
+	if len(data) > maxChangeValueLength {
+		return string(data[:maxChangeValueLength]) + "..."
+	}
+	return string(data)
+}
+
+func specHistoryKey(generation int64) string {
+	return fmt.Sprintf("%s%010d", specHistoryKeyPrefix, generation)
+}
+
+// specHistoryKeys returns keys of history entries of the ConfigMap from the oldest generation.
+func specHistoryKeys(configMap *corev1.ConfigMap) []string {
+	var keys []string
+	for key := range configMap.Data {
+		if strings.HasPrefix(key, specHistoryKeyPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"encoding/json"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Spec history", func() {
+	var (
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+		scheme  *runtime.Scheme
+		rclient client.Client
+	)
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		rclient = fake.NewClientBuilder().WithScheme(scheme).Build()
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c", Generation: 1},
+			Spec:       etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(3))},
+		}
+	})
+
+	entries := func(ctx SpecContext) []SpecHistoryEntry {
+		configMap := &corev1.ConfigMap{}
+		Expect(rclient.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "test-spec-history"}, configMap)).To(Succeed())
+		var result []SpecHistoryEntry
+		for _, key := range specHistoryKeys(configMap) {
+			entry := SpecHistoryEntry{}
+			Expect(json.Unmarshal([]byte(configMap.Data[key]), &entry)).To(Succeed())
+			result = append(result, entry)
+		}
+		return result
+	}
+
+	It("should record generations with a summary of changes", func(ctx SpecContext) {
+		Expect(RecordSpecHistory(ctx, cluster, rclient, scheme)).To(Succeed())
+		Expect(RecordSpecHistory(ctx, cluster, rclient, scheme)).To(Succeed())
+
+		cluster.Generation = 2
+		cluster.Spec.Replicas = ptr.To(int32(5))
+		cluster.Spec.Options = map[string]string{"quota-backend-bytes": "8589934592"}
+		Expect(RecordSpecHistory(ctx, cluster, rclient, scheme)).To(Succeed())
+
+		history := entries(ctx)
+		Expect(history).To(HaveLen(2))
+		Expect(history[0].Generation).To(Equal(int64(1)))
+		Expect(history[0].Changes).To(BeEmpty())
+		Expect(history[1].Generation).To(Equal(int64(2)))
+		Expect(history[1].Changes).To(Equal([]string{
+			`spec.options: added {"quota-backend-bytes":"8589934592"}`,
+			"spec.replicas: 3 -> 5",
+		}))
+	})
+
+	It("should keep only the latest generations", func(ctx SpecContext) {
+		for generation := int64(1); generation <= SpecHistoryLimit+5; generation++ {
+			cluster.Generation = generation
+			Expect(RecordSpecHistory(ctx, cluster, rclient, scheme)).To(Succeed())
+		}
+		history := entries(ctx)
+		Expect(history).To(HaveLen(SpecHistoryLimit))
+		Expect(history[0].Generation).To(Equal(int64(6)))
+		Expect(history[SpecHistoryLimit-1].Generation).To(Equal(int64(SpecHistoryLimit + 5)))
+	})
+
+	It("should truncate long values and report removed fields", func() {
+		long := `{"options":{"name":"` + strings.Repeat("a", 100) + `"},"replicas":3}`
+		Expect(SpecChanges(json.RawMessage(long), json.RawMessage(`{"replicas":3}`))).To(Equal([]string{"spec.options: removed"}))
+		changes := SpecChanges(json.RawMessage(`{"image":"a"}`), json.RawMessage(`{"image":"`+strings.Repeat("b", 100)+`"}`))
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0]).To(HaveSuffix("..."))
+	})
+})
@@ -17,26 +17,56 @@ limitations under the License.
 package factory
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	ctrl "sigs.k8s.io/controller-runtime"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/agent"
+	"github.com/aenix-io/etcd-operator/internal/backup"
 	"github.com/aenix-io/etcd-operator/internal/k8sutils"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// RestoreContainerName is the name of the init container restoring member data from snapshots.
+const RestoreContainerName = "restore"
+
+// ReplicasAnnotation is the number of replicas the operator set last on the cluster StatefulSet. Replicas changed
+// by anything else, e.g. kubectl scale or a misconfigured HorizontalPodAutoscaler, bypass member management
+// and are reverted to it.
+const ReplicasAnnotation = "etcd.aenix.io/replicas"
+
 const (
 	etcdContainerName = "etcd"
+
+	backupCredentialsVolume   = "backup-credentials"
+	backupCredentialsMountDir = "/etc/etcd-operator/backup-credentials"
+
+	startupProbePeriodSeconds = 5
+	// baseStartupTimeout is the startup timeout of members with large databases, excluding time to load data.
+	baseStartupTimeout = time.Minute
+	// startupTimePerGiB is the time members take to load every GiB of the database.
+	startupTimePerGiB = 30 * time.Second
 )
 
+// ServingReadinessGate is the readiness gate of member pods set by the operator once the member is a healthy
+// voting member, so learners and unhealthy members are excluded from the client Service endpoints.
+const ServingReadinessGate corev1.PodConditionType = "etcd.aenix.io/serving"
+
 func CreateOrUpdateStatefulSet(
 	ctx context.Context,
 	cluster *etcdaenixiov1alpha1.EtcdCluster,
@@ -57,6 +87,23 @@ func CreateOrUpdateStatefulSet(
 		podMetadata.Annotations = cluster.Spec.PodTemplate.Annotations
 	}
 
+	hooks := veleroHookAnnotations(cluster)
+	mesh := serviceMeshAnnotations(cluster)
+	if hooks != nil || mesh != nil {
+		annotations := make(map[string]string, len(podMetadata.Annotations)+len(hooks)+len(mesh))
+		for key, value := range hooks {
+			annotations[key] = value
+		}
+		for key, value := range mesh {
+			annotations[key] = value
+		}
+		// generated annotations can be overridden in the pod template
+		for key, value := range podMetadata.Annotations {
+			annotations[key] = value
+		}
+		podMetadata.Annotations = annotations
+	}
+
 	volumeClaimTemplates := []corev1.PersistentVolumeClaim{
 		{
 			ObjectMeta: metav1.ObjectMeta{
@@ -68,31 +115,70 @@ func CreateOrUpdateStatefulSet(
 			Status: cluster.Spec.Storage.VolumeClaimTemplate.Status,
 		},
 	}
+	if wal := cluster.Spec.Storage.WALVolumeClaimTemplate; wal != nil {
+		volumeClaimTemplates = append(volumeClaimTemplates, corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        GetWALPVCName(cluster),
+				Labels:      wal.Labels,
+				Annotations: wal.Annotations,
+			},
+			Spec:   wal.Spec,
+			Status: wal.Status,
+		})
+	}
 
 	volumes := generateVolumes(cluster)
 
 	basePodSpec := corev1.PodSpec{
-		Containers: []corev1.Container{generateContainer(cluster)},
-		Volumes:    volumes,
+		InitContainers: generateInitContainers(cluster),
+		Containers:     []corev1.Container{generateContainer(cluster)},
+		Volumes:        volumes,
 	}
-	if cluster.Spec.PodTemplate.Spec.Containers == nil {
-		cluster.Spec.PodTemplate.Spec.Containers = make([]corev1.Container, 0)
-	}
-	finalPodSpec, err := k8sutils.StrategicMerge(basePodSpec, cluster.Spec.PodTemplate.Spec)
+	addAgentSidecar(cluster, &basePodSpec)
+	addLogShipping(cluster, &basePodSpec)
+	addPlacement(cluster, &basePodSpec)
+	addLinuxNodeSelector(&basePodSpec)
+	addSecurityContext(cluster, &basePodSpec)
+	addOpenShiftSecurityContext(cluster, &basePodSpec)
+	finalPodSpec, err := k8sutils.StrategicMerge(basePodSpec, normalizedPodTemplateSpec(cluster))
 	if err != nil {
 		return fmt.Errorf("cannot strategic-merge base podspec with podTemplate.spec: %w", err)
 	}
+	// added after the merge, so architectures are also required in node selector terms of the pod template
+	addArchitectures(cluster, &finalPodSpec)
+	if !slices.ContainsFunc(finalPodSpec.ReadinessGates, func(g corev1.PodReadinessGate) bool {
+		return g.ConditionType == ServingReadinessGate
+	}) {
+		finalPodSpec.ReadinessGates = append(finalPodSpec.ReadinessGates, corev1.PodReadinessGate{ConditionType: ServingReadinessGate})
+	}
+	if fipsEnabled(cluster) {
+		if err = validateFIPSTLS(cluster); err != nil {
+			return err
+		}
+		if err = applyFIPSImages(&finalPodSpec); err != nil {
+			return err
+		}
+	}
 
+	replicas, err := statefulSetReplicas(ctx, cluster, rclient, rscheme)
+	if err != nil {
+		return err
+	}
 	statefulSet := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: cluster.Namespace,
-			Name:      cluster.Name,
+			Namespace:   cluster.Namespace,
+			Name:        cluster.Name,
+			Annotations: map[string]string{ReplicasAnnotation: strconv.Itoa(int(*replicas))},
 		},
 		Spec: appsv1.StatefulSetSpec{
 			// initialize static fields that cannot be changed across updates.
-			Replicas:            cluster.Spec.Replicas,
+			Replicas:            replicas,
 			ServiceName:         cluster.Name,
 			PodManagementPolicy: appsv1.ParallelPodManagement,
+			// members are updated by the operator one by one, see EtcdClusterReconciler.rolloutMembers
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.OnDeleteStatefulSetStrategyType,
+			},
 			Selector: &metav1.LabelSelector{
 				MatchLabels: NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy(),
 			},
@@ -106,13 +192,94 @@ func CreateOrUpdateStatefulSet(
 	logger := log.FromContext(ctx)
 	logger.V(2).Info("statefulset spec generated", "sts_name", statefulSet.Name, "sts_spec", statefulSet.Spec)
 
-	if err := ctrl.SetControllerReference(cluster, statefulSet, rscheme); err != nil {
+	if err := SetOwner(cluster, statefulSet, rscheme); err != nil {
 		return fmt.Errorf("cannot set controller reference: %w", err)
 	}
 
 	return reconcileStatefulSet(ctx, rclient, cluster.Name, statefulSet)
 }
 
+// statefulSetReplicas returns the number of replicas of the cluster StatefulSet. Members are scaled
+// only while the scale operation holds the operation lock and the cluster membership is changed,
+// otherwise the current number is kept.
+func statefulSetReplicas(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+) (*int32, error) {
+	if cluster.RestoringWithJobs() {
+		// members are stopped while Jobs restore their data volumes
+		return ptr.To(int32(0)), nil
+	}
+	current := &appsv1.StatefulSet{}
+	err := rclient.Get(ctx, client.ObjectKeyFromObject(cluster), current)
+	if err != nil {
+		return cluster.Spec.Replicas, client.IgnoreNotFound(err)
+	}
+	if applied, edited := OutOfBandReplicas(current); edited {
+		// replicas changed bypassing member management are reverted, see ReplicasAnnotation
+		log.FromContext(ctx).Info("reverting out-of-band change of statefulset replicas",
+			"replicas", ptr.Deref(current.Spec.Replicas, 0), "applied_replicas", applied)
+		current.Spec.Replicas = ptr.To(applied)
+	}
+	scaling := scaleWorkflow(cluster)
+	if ptr.Deref(current.Spec.Replicas, 0) == *cluster.Spec.Replicas {
+		if current.Status.ReadyReplicas == *cluster.Spec.Replicas && scaling == nil {
+			return cluster.Spec.Replicas, ReleaseOperationLock(ctx, cluster, rclient, OperationScale)
+		}
+		return cluster.Spec.Replicas, nil
+	}
+	holder, err := AcquireOperationLock(ctx, cluster, rclient, rscheme, OperationScale)
+	if err != nil {
+		return nil, err
+	}
+	if holder != OperationScale {
+		log.FromContext(ctx).Info("scaling is waiting for another operation", "operation", holder)
+		return current.Spec.Replicas, nil
+	}
+	// pods are added after their members are registered as learners and deleted after their members are removed
+	if scaling == nil || scaling.Step == etcdaenixiov1alpha1.WorkflowStepChangeMembership {
+		return current.Spec.Replicas, nil
+	}
+	return ptr.To(ScaledReplicas(cluster, scaling)), nil
+}
+
+// ScaledReplicas returns the number of members the cluster is scaled to by the current pass of the scale operation.
+// Members are added one per pass, as etcd allows a single learner at a time, so the pass adding a member scales
+// the cluster up to that member, while members are removed at once.
+func ScaledReplicas(cluster *etcdaenixiov1alpha1.EtcdCluster, scaling *etcdaenixiov1alpha1.WorkflowStatus) int32 {
+	if scaling != nil && scaling.Member != "" {
+		for i := int32(0); i < *cluster.Spec.Replicas; i++ {
+			if cluster.MemberName(i) == scaling.Member {
+				return i + 1
+			}
+		}
+	}
+	return *cluster.Spec.Replicas
+}
+
+// OutOfBandReplicas checks if replicas of the cluster StatefulSet differ from the number the operator set last
+// and returns that number. StatefulSets without ReplicasAnnotation, created by older operator versions,
+// are not checked.
+func OutOfBandReplicas(sts *appsv1.StatefulSet) (int32, bool) {
+	applied, err := strconv.ParseInt(sts.Annotations[ReplicasAnnotation], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(applied), int32(applied) != ptr.Deref(sts.Spec.Replicas, 0)
+}
+
+// scaleWorkflow returns the state of the scale operation recorded in status or nil if members are not being scaled.
+func scaleWorkflow(cluster *etcdaenixiov1alpha1.EtcdCluster) *etcdaenixiov1alpha1.WorkflowStatus {
+	for i := range cluster.Status.Workflows {
+		if cluster.Status.Workflows[i].Operation == string(OperationScale) {
+			return &cluster.Status.Workflows[i]
+		}
+	}
+	return nil
+}
+
 func generateVolumes(cluster *etcdaenixiov1alpha1.EtcdCluster) []corev1.Volume {
 	volumes := []corev1.Volume{}
 
@@ -187,10 +354,75 @@ func generateVolumes(cluster *etcdaenixiov1alpha1.EtcdCluster) []corev1.Volume {
 			}...)
 	}
 
+	if cluster.Spec.Security != nil && cluster.Spec.Security.TLS.ClientCRLSecret != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: "client-crl",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: cluster.Spec.Security.TLS.ClientCRLSecret,
+				},
+			},
+		})
+	}
+
+	if cluster.Spec.Velero != nil && cluster.Spec.Security != nil && cluster.Spec.Security.TLS.ClientSecret != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: clientCertificateVolume,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: cluster.Spec.Security.TLS.ClientSecret,
+				},
+			},
+		})
+	}
+
+	if restoreEnabled(cluster) {
+		volumes = append(volumes, corev1.Volume{
+			Name: backupCredentialsVolume,
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: backupCredentialsSources(&cluster.Spec.Backup.Destination),
+				},
+			},
+		})
+	}
+
 	return volumes
 
 }
 
+// backupCredentialsSources projects referenced keys of backup credentials secrets to files named
+// as backup.LoadCredentials expects them. Optional keys are projected by separate sources, so a missing
+// optional key does not hide a missing required one.
+func backupCredentialsSources(destination *etcdaenixiov1alpha1.BackupDestination) []corev1.VolumeProjection {
+	refs := backup.CredentialRefs(destination)
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var sources []corev1.VolumeProjection
+	for _, name := range names {
+		ref := refs[name]
+		var optional *bool
+		if ptr.Deref(ref.Optional, false) {
+			optional = ptr.To(true)
+		}
+		idx := slices.IndexFunc(sources, func(source corev1.VolumeProjection) bool {
+			return source.Secret.Name == ref.Name && (source.Secret.Optional == nil) == (optional == nil)
+		})
+		if idx == -1 {
+			sources = append(sources, corev1.VolumeProjection{
+				Secret: &corev1.SecretProjection{LocalObjectReference: ref.LocalObjectReference, Optional: optional},
+			})
+			idx = len(sources) - 1
+		}
+		sources[idx].Secret.Items = append(sources[idx].Secret.Items, corev1.KeyToPath{Key: ref.Key, Path: name})
+	}
+	return sources
+}
+
 func generateVolumeMounts(cluster *etcdaenixiov1alpha1.EtcdCluster) []corev1.VolumeMount {
 
 	volumeMounts := []corev1.VolumeMount{}
@@ -201,6 +433,14 @@ func generateVolumeMounts(cluster *etcdaenixiov1alpha1.EtcdCluster) []corev1.Vol
 		MountPath: "/var/run/etcd",
 	})
 
+	if cluster.Spec.Storage.WALVolumeClaimTemplate != nil {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      GetWALPVCName(cluster),
+			ReadOnly:  false,
+			MountPath: "/var/run/etcd-wal",
+		})
+	}
+
 	if cluster.Spec.Security != nil && cluster.Spec.Security.TLS.PeerSecret != "" {
 		volumeMounts = append(volumeMounts, []corev1.VolumeMount{
 			{
@@ -237,6 +477,24 @@ func generateVolumeMounts(cluster *etcdaenixiov1alpha1.EtcdCluster) []corev1.Vol
 		}...)
 	}
 
+	if cluster.Spec.Security != nil && cluster.Spec.Security.TLS.ClientCRLSecret != "" {
+		// mounted without subPath, so kubelet updates the list in place when the secret changes
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "client-crl",
+			ReadOnly:  true,
+			MountPath: "/etc/etcd/pki/client/crl",
+		})
+	}
+
+	if cluster.Spec.Velero != nil && cluster.Spec.Security != nil && cluster.Spec.Security.TLS.ClientSecret != "" {
+		// used by etcdctl in Velero hooks
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      clientCertificateVolume,
+			ReadOnly:  true,
+			MountPath: clientCertificateMountDir,
+		})
+	}
+
 	return volumeMounts
 }
 
@@ -260,6 +518,30 @@ func generateEtcdArgs(cluster *etcdaenixiov1alpha1.EtcdCluster) []string {
 		args = append(args, fmt.Sprintf("%s=%s", flag, value))
 	}
 
+	typedOptions := map[string]string{}
+	if preset := cluster.SizePreset(); preset != nil {
+		for name, value := range preset.Options() {
+			if _, ok := cluster.Spec.Options[name]; !ok {
+				typedOptions[name] = value
+			}
+		}
+	}
+	if cluster.Spec.Tuning != nil {
+		maps.Copy(typedOptions, cluster.Spec.Tuning.Options(cluster.EtcdVersion()))
+	}
+	if cluster.Spec.Logging != nil {
+		maps.Copy(typedOptions, cluster.Spec.Logging.Options())
+	}
+	names := make([]string, 0, len(typedOptions))
+	for name := range typedOptions {
+		names = append(names, name)
+	}
+	// sorted, so the pod template does not change between reconciliations
+	slices.Sort(names)
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("--%s=%s", name, typedOptions[name]))
+	}
+
 	peerTlsSettings := []string{"--peer-auto-tls"}
 
 	if cluster.Spec.Security != nil && cluster.Spec.Security.TLS.PeerSecret != "" {
@@ -291,25 +573,157 @@ func generateEtcdArgs(cluster *etcdaenixiov1alpha1.EtcdCluster) []string {
 		}
 	}
 
+	if cluster.Spec.Security != nil && cluster.Spec.Security.TLS.ClientCRLSecret != "" {
+		clientTlsSettings = append(clientTlsSettings, "--client-crl-file=/etc/etcd/pki/client/crl/crl.pem")
+	}
+
+	listenClientURLs := []string{fmt.Sprintf("%s://0.0.0.0:%d", serverProtocol, cluster.ClientPort())}
+	advertiseClientURLs := []string{
+		cluster.PodMember().ClientURL,
+	}
+	if cluster.Spec.ClientURLs != nil {
+		listenClientURLs = append(listenClientURLs, cluster.Spec.ClientURLs.Listen...)
+		advertiseClientURLs = append(advertiseClientURLs, cluster.Spec.ClientURLs.Advertise...)
+	}
+
 	args = append(args, []string{
 		"--name=$(POD_NAME)",
-		"--listen-metrics-urls=http://0.0.0.0:2381",
-		"--listen-peer-urls=https://0.0.0.0:2380",
-		fmt.Sprintf("--listen-client-urls=%s://0.0.0.0:2379", serverProtocol),
-		fmt.Sprintf("--initial-advertise-peer-urls=https://$(POD_NAME).%s.$(POD_NAMESPACE).svc:2380", cluster.Name),
+		fmt.Sprintf("--listen-metrics-urls=http://0.0.0.0:%d", cluster.MetricsPort()),
+		fmt.Sprintf("--listen-peer-urls=https://0.0.0.0:%d", cluster.PeerPort()),
+		"--listen-client-urls=" + strings.Join(listenClientURLs, ","),
+		"--initial-advertise-peer-urls=" + cluster.PodMember().PeerURL,
 		"--data-dir=/var/run/etcd/default.etcd",
-		fmt.Sprintf("--advertise-client-urls=%s://$(POD_NAME).%s.$(POD_NAMESPACE).svc:2379", serverProtocol, cluster.Name),
+		"--advertise-client-urls=" + strings.Join(advertiseClientURLs, ","),
 	}...)
 
+	if cluster.Spec.Storage.WALVolumeClaimTemplate != nil {
+		args = append(args, "--wal-dir=/var/run/etcd-wal/default.wal")
+	}
+
 	args = append(args, peerTlsSettings...)
 	args = append(args, serverTlsSettings...)
 	args = append(args, clientTlsSettings...)
 
+	var cipherSuites []string
+	var minVersion string
+	if cluster.Spec.Security != nil {
+		cipherSuites = cluster.Spec.Security.TLS.CipherSuites
+		minVersion = cluster.Spec.Security.TLS.MinVersion
+	}
+	if fipsEnabled(cluster) {
+		// restrict TLS to FIPS-approved settings unless they are set explicitly
+		if minVersion == "" {
+			minVersion = etcdaenixiov1alpha1.TLSVersion12
+		}
+		if len(cipherSuites) == 0 && minVersion != etcdaenixiov1alpha1.TLSVersion13 {
+			cipherSuites = etcdaenixiov1alpha1.FIPSCipherSuites
+		}
+	}
+	if len(cipherSuites) > 0 {
+		args = append(args, "--cipher-suites="+strings.Join(cipherSuites, ","))
+	}
+	if minVersion != "" {
+		args = append(args, "--tls-min-version="+minVersion)
+	}
+
 	return args
 }
 
-func generateContainer(cluster *etcdaenixiov1alpha1.EtcdCluster) corev1.Container {
-	podEnv := []corev1.EnvVar{
+// proxyEnv returns proxy environment variables of agents reaching the backup storage. The proxy of the destination
+// overrides the proxy of the operator field by field, as the storage client of the operator does.
+func proxyEnv(destination *etcdaenixiov1alpha1.BackupDestination) []corev1.EnvVar {
+	proxy := settings.Proxy
+	if destination.Proxy != nil {
+		proxy.HTTPProxy = cmp.Or(destination.Proxy.HTTPProxy, proxy.HTTPProxy)
+		proxy.HTTPSProxy = cmp.Or(destination.Proxy.HTTPSProxy, proxy.HTTPSProxy)
+		proxy.NoProxy = cmp.Or(destination.Proxy.NoProxy, proxy.NoProxy)
+	}
+	var env []corev1.EnvVar
+	for _, v := range []corev1.EnvVar{
+		{Name: "HTTP_PROXY", Value: proxy.HTTPProxy},
+		{Name: "HTTPS_PROXY", Value: proxy.HTTPSProxy},
+		{Name: "NO_PROXY", Value: proxy.NoProxy},
+	} {
+		if v.Value != "" {
+			env = append(env, v)
+		}
+	}
+	return env
+}
+
+// restoreEnabled checks if the cluster can be restored from snapshots: automatically, once quorum is lost,
+// from the snapshot taken before the Velero backup the cluster is restored from, or from the snapshot the new
+// cluster is bootstrapped from.
+func restoreEnabled(cluster *etcdaenixiov1alpha1.EtcdCluster) bool {
+	if cluster.Spec.Backup == nil {
+		return false
+	}
+	return cluster.Spec.Backup.AutoRestore != nil || cluster.Spec.Velero != nil && cluster.Spec.Velero.Quiesce ||
+		cluster.Annotations[etcdaenixiov1alpha1.BootstrapFromAnnotation] != ""
+}
+
+// generateInitContainers returns the restore container if restore from snapshots is enabled. It restores member data
+// directory from the snapshot set in the cluster state ConfigMap, if the member starts without data. Data restored
+// by Velero is replaced with the snapshot too, so all members start from the same data.
+func generateInitContainers(cluster *etcdaenixiov1alpha1.EtcdCluster) []corev1.Container {
+	if !restoreEnabled(cluster) {
+		return nil
+	}
+	destination, _ := json.Marshal(cluster.Spec.Backup.Destination)
+	args := []string{
+		agent.RestoreCommand,
+		"--data-dir=/var/run/etcd/default.etcd",
+		"--peer-url=" + cluster.PodMember().PeerURL,
+		"--credentials-dir=" + backupCredentialsMountDir,
+		"--destination=" + string(destination),
+	}
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      "data",
+			MountPath: "/var/run/etcd",
+		},
+		{
+			Name:      backupCredentialsVolume,
+			ReadOnly:  true,
+			MountPath: backupCredentialsMountDir,
+		},
+	}
+	if cluster.Spec.Storage.WALVolumeClaimTemplate != nil {
+		args = append(args, "--wal-dir=/var/run/etcd-wal/default.wal")
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      GetWALPVCName(cluster),
+			MountPath: "/var/run/etcd-wal",
+		})
+	}
+	if cluster.Spec.Velero != nil && cluster.Spec.Velero.Quiesce {
+		args = append(args, "--overwrite")
+	}
+
+	return []corev1.Container{
+		{
+			Name:  RestoreContainerName,
+			Image: settings.AgentImage,
+			Args:  args,
+			Ports: []corev1.ContainerPort{
+				{Name: "restore-progress", ContainerPort: agent.RestoreProgressPort},
+			},
+			Env: append(generatePodEnv(), proxyEnv(&cluster.Spec.Backup.Destination)...),
+			EnvFrom: []corev1.EnvFromSource{
+				{
+					ConfigMapRef: &corev1.ConfigMapEnvSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: GetClusterStateConfigMapName(cluster),
+						},
+					},
+				},
+			},
+			VolumeMounts: volumeMounts,
+		},
+	}
+}
+
+func generatePodEnv() []corev1.EnvVar {
+	return []corev1.EnvVar{
 		{
 			Name: "POD_NAME",
 			ValueFrom: &corev1.EnvVarSource{
@@ -327,6 +741,10 @@ func generateContainer(cluster *etcdaenixiov1alpha1.EtcdCluster) corev1.Containe
 			},
 		},
 	}
+}
+
+func generateContainer(cluster *etcdaenixiov1alpha1.EtcdCluster) corev1.Container {
+	podEnv := generatePodEnv()
 
 	c := corev1.Container{}
 	c.Name = etcdContainerName
@@ -334,8 +752,8 @@ func generateContainer(cluster *etcdaenixiov1alpha1.EtcdCluster) corev1.Containe
 	c.Command = generateEtcdCommand()
 	c.Args = generateEtcdArgs(cluster)
 	c.Ports = []corev1.ContainerPort{
-		{Name: "peer", ContainerPort: 2380},
-		{Name: "client", ContainerPort: 2379},
+		{Name: "peer", ContainerPort: cluster.PeerPort()},
+		{Name: "client", ContainerPort: cluster.ClientPort()},
 	}
 	clusterStateConfigMapName := GetClusterStateConfigMapName(cluster)
 	c.EnvFrom = []corev1.EnvFromSource{
@@ -347,45 +765,67 @@ func generateContainer(cluster *etcdaenixiov1alpha1.EtcdCluster) corev1.Containe
 			},
 		},
 	}
-	c.StartupProbe = getStartupProbe()
-	c.LivenessProbe = getLivenessProbe()
-	c.ReadinessProbe = getReadinessProbe()
+	c.StartupProbe = getStartupProbe(cluster.MetricsPort())
+	c.StartupProbe.FailureThreshold = startupFailureThreshold(cluster)
+	c.LivenessProbe = getLivenessProbe(cluster.MetricsPort())
+	c.ReadinessProbe = getReadinessProbe(cluster.MetricsPort())
 	c.Env = podEnv
 	c.VolumeMounts = generateVolumeMounts(cluster)
 
 	return c
 }
 
-func getStartupProbe() *corev1.Probe {
+func getStartupProbe(port int32) *corev1.Probe {
 	return &corev1.Probe{
 		ProbeHandler: corev1.ProbeHandler{
 			HTTPGet: &corev1.HTTPGetAction{
 				Path: "/readyz?serializable=false",
-				Port: intstr.FromInt32(2381),
+				Port: intstr.FromInt32(port),
 			},
 		},
-		PeriodSeconds: 5,
+		PeriodSeconds: startupProbePeriodSeconds,
+	}
+}
+
+// startupFailureThreshold returns failure threshold of the startup probe covering the startup timeout of members.
+// Without configured timeout, the timeout grows with the observed database size in power of two GiB steps, so
+// members are not restarted every time the database grows a bit. Zero keeps the Kubernetes default.
+func startupFailureThreshold(cluster *etcdaenixiov1alpha1.EtcdCluster) int32 {
+	var timeout time.Duration
+	switch {
+	case cluster.Spec.Startup != nil && cluster.Spec.Startup.Timeout != nil:
+		timeout = cluster.Spec.Startup.Timeout.Duration
+	case cluster.Status.DBSize != nil && cluster.Status.DBSize.Value() >= 1<<30:
+		gib := int64(1)
+		for gib<<30 < cluster.Status.DBSize.Value() {
+			gib <<= 1
+		}
+		timeout = baseStartupTimeout + time.Duration(gib)*startupTimePerGiB
+	default:
+		return 0
 	}
+	period := time.Duration(startupProbePeriodSeconds) * time.Second
+	return int32((timeout + period - 1) / period)
 }
 
-func getReadinessProbe() *corev1.Probe {
+func getReadinessProbe(port int32) *corev1.Probe {
 	return &corev1.Probe{
 		ProbeHandler: corev1.ProbeHandler{
 			HTTPGet: &corev1.HTTPGetAction{
 				Path: "/readyz",
-				Port: intstr.FromInt32(2381),
+				Port: intstr.FromInt32(port),
 			},
 		},
 		PeriodSeconds: 5,
 	}
 }
 
-func getLivenessProbe() *corev1.Probe {
+func getLivenessProbe(port int32) *corev1.Probe {
 	return &corev1.Probe{
 		ProbeHandler: corev1.ProbeHandler{
 			HTTPGet: &corev1.HTTPGetAction{
 				Path: "/livez",
-				Port: intstr.FromInt32(2381),
+				Port: intstr.FromInt32(port),
 			},
 		},
 		PeriodSeconds: 5,
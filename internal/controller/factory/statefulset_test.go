@@ -17,12 +17,16 @@ limitations under the License.
 package factory
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	. "sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -33,6 +37,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 
 	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/k8sutils"
 )
 
 var _ = Describe("CreateOrUpdateStatefulSet handler", func() {
@@ -89,10 +94,16 @@ var _ = Describe("CreateOrUpdateStatefulSet handler", func() {
 		})
 
 		It("should successfully ensure the statefulSet with empty spec", func(ctx SpecContext) {
+			spec := etcdcluster.Spec.DeepCopy()
 			Expect(CreateOrUpdateStatefulSet(ctx, &etcdcluster, k8sClient, k8sClient.Scheme())).To(Succeed())
+			Expect(etcdcluster.Spec).To(Equal(*spec))
 			Eventually(Object(&statefulSet)).Should(
 				HaveField("Spec.Replicas", Equal(etcdcluster.Spec.Replicas)),
 			)
+			Expect(statefulSet.Spec.UpdateStrategy.Type).To(Equal(appsv1.OnDeleteStatefulSetStrategyType))
+			Expect(statefulSet.Spec.Template.Spec.ReadinessGates).To(ContainElement(
+				corev1.PodReadinessGate{ConditionType: ServingReadinessGate},
+			))
 		})
 
 		It("should successfully ensure the statefulSet with filled spec", func(ctx SpecContext) {
@@ -369,12 +380,51 @@ var _ = Describe("CreateOrUpdateStatefulSet handler", func() {
 			})
 		})
 
+		It("should successfully create statefulSet with dedicated WAL volume", func(ctx SpecContext) {
+			etcdcluster.Spec.Storage.WALVolumeClaimTemplate = &etcdaenixiov1alpha1.EmbeddedPersistentVolumeClaim{
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: resource.MustParse("1Gi"),
+						},
+					},
+					StorageClassName: ptr.To("fast-ssd"),
+				},
+			}
+			Expect(CreateOrUpdateStatefulSet(ctx, &etcdcluster, k8sClient, k8sClient.Scheme())).To(Succeed())
+			Eventually(Get(&statefulSet)).Should(Succeed())
+
+			By("Checking the WAL volume claim template", func() {
+				Expect(statefulSet.Spec.VolumeClaimTemplates).To(HaveLen(2))
+				Expect(statefulSet.Spec.VolumeClaimTemplates[1].Name).To(Equal("wal"))
+				Expect(statefulSet.Spec.VolumeClaimTemplates[1].Spec.StorageClassName).To(Equal(ptr.To("fast-ssd")))
+			})
+
+			By("Checking the WAL volume mount and flag", func() {
+				Expect(statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{
+					Name:      "wal",
+					MountPath: "/var/run/etcd-wal",
+				}))
+				Expect(statefulSet.Spec.Template.Spec.Containers[0].Args).To(ContainElement("--wal-dir=/var/run/etcd-wal/default.wal"))
+			})
+		})
+
 		It("should fail on creating the statefulset with invalid owner reference", func(ctx SpecContext) {
 			emptyScheme := runtime.NewScheme()
 			Expect(CreateOrUpdateStatefulSet(ctx, &etcdcluster, k8sClient, emptyScheme)).NotTo(Succeed())
 		})
 	})
 
+	Context("When normalizing the pod template", func() {
+		It("should keep generated containers without modifying the cluster", func() {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+			Expect(normalizedPodTemplateSpec(cluster).Containers).To(BeEmpty())
+			Expect(normalizedPodTemplateSpec(cluster).Containers).NotTo(BeNil())
+			Expect(cluster.Spec.PodTemplate.Spec.Containers).To(BeNil())
+		})
+	})
+
 	Context("When generating a etcd command", func() {
 		It("should correctly fill options to args", func() {
 			extraArgs := map[string]string{
@@ -396,6 +446,628 @@ var _ = Describe("CreateOrUpdateStatefulSet handler", func() {
 		})
 	})
 
+	Context("When generating a etcd command of a large cluster", func() {
+		It("should pass parameters of the size preset unless they are set in options", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Replicas: ptr.To(int32(5)),
+					Options:  map[string]string{"snapshot-count": "10000"},
+				},
+			}
+			args := generateEtcdArgs(etcdcluster)
+			Expect(args).To(ContainElements("--heartbeat-interval=150", "--election-timeout=1500", "--snapshot-count=10000"))
+			Expect(args).NotTo(ContainElement("--snapshot-count=75000"))
+
+			etcdcluster.Spec.Replicas = ptr.To(int32(3))
+			Expect(generateEtcdArgs(etcdcluster)).NotTo(ContainElement(HavePrefix("--heartbeat-interval")))
+		})
+	})
+
+	Context("When generating a etcd container with custom ports", func() {
+		It("should listen on and advertise the ports", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "ns"},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					Ports:    &etcdaenixiov1alpha1.PortsSpec{Client: 12379, Peer: 12380, Metrics: 12381},
+				},
+			}
+			container := generateContainer(etcdcluster)
+			Expect(container.Args).To(ContainElements(
+				"--listen-metrics-urls=http://0.0.0.0:12381",
+				"--listen-peer-urls=https://0.0.0.0:12380",
+				"--listen-client-urls=http://0.0.0.0:12379",
+				"--initial-advertise-peer-urls=https://$(POD_NAME).test.$(POD_NAMESPACE).svc:12380",
+				"--advertise-client-urls=http://$(POD_NAME).test.$(POD_NAMESPACE).svc:12379",
+			))
+			Expect(container.Ports).To(ConsistOf(
+				corev1.ContainerPort{Name: "peer", ContainerPort: 12380},
+				corev1.ContainerPort{Name: "client", ContainerPort: 12379},
+			))
+			Expect(container.ReadinessProbe.HTTPGet.Port).To(Equal(intstr.FromInt32(12381)))
+			Expect(container.LivenessProbe.HTTPGet.Port).To(Equal(intstr.FromInt32(12381)))
+			Expect(container.StartupProbe.HTTPGet.Port).To(Equal(intstr.FromInt32(12381)))
+		})
+	})
+
+	Context("When generating a etcd command with additional client URLs", func() {
+		It("should listen on and advertise them along with the generated ones", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "ns"},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Replicas: ptr.To(int32(3)),
+					ClientURLs: &etcdaenixiov1alpha1.ClientURLsSpec{
+						Advertise: []string{"http://$(POD_NAME).etcd.example.com:2379", "http://10.0.0.1:2379"},
+						Listen:    []string{"http://0.0.0.0:12379"},
+					},
+				},
+			}
+			args := generateEtcdArgs(etcdcluster)
+			Expect(args).To(ContainElements(
+				"--listen-client-urls=http://0.0.0.0:2379,http://0.0.0.0:12379",
+				"--advertise-client-urls=http://$(POD_NAME).test.$(POD_NAMESPACE).svc:2379,"+
+					"http://$(POD_NAME).etcd.example.com:2379,http://10.0.0.1:2379",
+			))
+		})
+	})
+
+	Context("When generating a etcd command with client certificate revocation list", func() {
+		It("should pass the list mounted from the secret", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Security: &etcdaenixiov1alpha1.SecuritySpec{TLS: etcdaenixiov1alpha1.TLSSpec{
+						ClientTrustedCASecret: "client-ca",
+						ClientSecret:          "client",
+						ClientCRLSecret:       "client-crl",
+					}},
+				},
+			}
+			Expect(generateEtcdArgs(etcdcluster)).To(ContainElement("--client-crl-file=/etc/etcd/pki/client/crl/crl.pem"))
+			Expect(generateVolumes(etcdcluster)).To(ContainElement(corev1.Volume{
+				Name: "client-crl",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: "client-crl"},
+				},
+			}))
+			Expect(generateVolumeMounts(etcdcluster)).To(ContainElement(corev1.VolumeMount{
+				Name:      "client-crl",
+				ReadOnly:  true,
+				MountPath: "/etc/etcd/pki/client/crl",
+			}))
+		})
+	})
+
+	Context("When generating a etcd command with TLS settings", func() {
+		It("should pass cipher suites and minimum TLS version", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Security: &etcdaenixiov1alpha1.SecuritySpec{TLS: etcdaenixiov1alpha1.TLSSpec{
+						CipherSuites: []string{
+							"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+							"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+						},
+						MinVersion: "TLS1.2",
+					}},
+				},
+			}
+			Expect(generateEtcdArgs(etcdcluster)).To(ContainElements(
+				"--cipher-suites=TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+				"--tls-min-version=TLS1.2",
+			))
+		})
+
+		It("should not pass TLS settings by default", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{}
+			Expect(generateEtcdArgs(etcdcluster)).NotTo(ContainElement(HavePrefix("--cipher-suites")))
+			Expect(generateEtcdArgs(etcdcluster)).NotTo(ContainElement(HavePrefix("--tls-min-version")))
+		})
+	})
+
+	Context("When generating a etcd command with tuned parameters", func() {
+		It("should pass tuned parameters as flags", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Tuning: &etcdaenixiov1alpha1.TuningSpec{
+						MaxRequestBytes:       ptr.To(resource.MustParse("10Mi")),
+						GRPCKeepaliveMinTime:  &metav1.Duration{Duration: 5 * time.Second},
+						GRPCKeepaliveInterval: &metav1.Duration{Duration: time.Hour},
+						GRPCKeepaliveTimeout:  &metav1.Duration{Duration: 20 * time.Second},
+					},
+				},
+			}
+			Expect(generateEtcdArgs(etcdcluster)).To(ContainElements(
+				"--max-request-bytes=10485760",
+				"--grpc-keepalive-min-time=5s",
+				"--grpc-keepalive-interval=1h0m0s",
+				"--grpc-keepalive-timeout=20s",
+			))
+		})
+
+		It("should pass watch progress notify interval", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Tuning: &etcdaenixiov1alpha1.TuningSpec{
+						WatchProgressNotifyInterval: &metav1.Duration{Duration: 10 * time.Minute},
+					},
+				},
+			}
+			Expect(generateEtcdArgs(etcdcluster)).To(ContainElement("--experimental-watch-progress-notify-interval=10m0s"))
+		})
+	})
+
+	Context("When generating startup probe", func() {
+		It("should keep default failure threshold for small databases", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{}
+			Expect(startupFailureThreshold(etcdcluster)).To(BeZero())
+			etcdcluster.Status.DBSize = ptr.To(resource.MustParse("512Mi"))
+			Expect(startupFailureThreshold(etcdcluster)).To(BeZero())
+		})
+
+		It("should scale failure threshold with observed database size", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{}
+			etcdcluster.Status.DBSize = ptr.To(resource.MustParse("3Gi"))
+			// one minute plus 30 seconds for each of 4 GiB, checked every 5 seconds
+			Expect(startupFailureThreshold(etcdcluster)).To(Equal(int32(36)))
+			etcdcluster.Status.DBSize = ptr.To(resource.MustParse("4Gi"))
+			Expect(startupFailureThreshold(etcdcluster)).To(Equal(int32(36)))
+		})
+
+		It("should use configured startup timeout", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Startup: &etcdaenixiov1alpha1.StartupSpec{Timeout: &metav1.Duration{Duration: 10 * time.Minute}},
+				},
+			}
+			etcdcluster.Status.DBSize = ptr.To(resource.MustParse("3Gi"))
+			Expect(generateContainer(etcdcluster).StartupProbe.FailureThreshold).To(Equal(int32(120)))
+		})
+	})
+
+	Context("When generating a etcd command with dedicated WAL volume", func() {
+		It("should not pass --wal-dir without WAL volume", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{}
+			Expect(generateEtcdArgs(etcdcluster)).NotTo(ContainElement(HavePrefix("--wal-dir")))
+		})
+
+		It("should use custom WAL volume claim template name", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Storage: etcdaenixiov1alpha1.StorageSpec{
+						WALVolumeClaimTemplate: &etcdaenixiov1alpha1.EmbeddedPersistentVolumeClaim{
+							EmbeddedObjectMetadata: etcdaenixiov1alpha1.EmbeddedObjectMetadata{Name: "etcd-wal"},
+						},
+					},
+				},
+			}
+			Expect(GetWALPVCName(etcdcluster)).To(Equal("etcd-wal"))
+			Expect(generateVolumeMounts(etcdcluster)).To(ContainElement(corev1.VolumeMount{
+				Name:      "etcd-wal",
+				MountPath: "/var/run/etcd-wal",
+			}))
+		})
+	})
+
+	Context("When generating init containers", func() {
+		It("should not add restore container without automatic restore", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{},
+				},
+			}
+			Expect(generateInitContainers(etcdcluster)).To(BeEmpty())
+		})
+
+		It("should add restore container with automatic restore", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Storage: etcdaenixiov1alpha1.StorageSpec{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+						Destination: etcdaenixiov1alpha1.BackupDestination{
+							S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups", CredentialsSecret: "s3"},
+						},
+						AutoRestore: &etcdaenixiov1alpha1.AutoRestoreSpec{},
+					},
+				},
+			}
+			containers := generateInitContainers(etcdcluster)
+			Expect(containers).To(HaveLen(1))
+			Expect(containers[0].Image).To(Equal(DefaultAgentImage))
+			Expect(containers[0].Args).To(ContainElements(
+				"restore",
+				"--data-dir=/var/run/etcd/default.etcd",
+				"--peer-url=https://$(POD_NAME).test.$(POD_NAMESPACE).svc:2380",
+			))
+			Expect(containers[0].VolumeMounts).To(ContainElement(HaveField("Name", "data")))
+			Expect(generateVolumes(etcdcluster)).To(ContainElement(corev1.Volume{
+				Name: "backup-credentials",
+				VolumeSource: corev1.VolumeSource{
+					Projected: &corev1.ProjectedVolumeSource{
+						Sources: []corev1.VolumeProjection{{
+							Secret: &corev1.SecretProjection{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "s3"},
+								Items: []corev1.KeyToPath{
+									{Key: "accessKeyID", Path: "accessKeyID"},
+									{Key: "secretAccessKey", Path: "secretAccessKey"},
+								},
+							},
+						}},
+					},
+				},
+			}))
+		})
+
+		It("should add restore container to clusters bootstrapped from a snapshot", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Annotations: map[string]string{etcdaenixiov1alpha1.BootstrapFromAnnotation: "test/snapshot.db"},
+				},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{},
+				},
+			}
+			containers := generateInitContainers(etcdcluster)
+			Expect(containers).To(HaveLen(1))
+			Expect(containers[0].Name).To(Equal(RestoreContainerName))
+		})
+
+		It("should project referenced credential keys", func() {
+			destination := &etcdaenixiov1alpha1.BackupDestination{
+				S3: &etcdaenixiov1alpha1.S3Destination{
+					CredentialsSecret: "s3",
+					AccessKeyIDRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "sops"}, Key: "AWS_ACCESS_KEY_ID",
+					},
+					SessionTokenRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "sops"},
+						Key:                  "AWS_SESSION_TOKEN",
+						Optional:             ptr.To(true),
+					},
+				},
+			}
+			Expect(backupCredentialsSources(destination)).To(Equal([]corev1.VolumeProjection{
+				{Secret: &corev1.SecretProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "sops"},
+					Items:                []corev1.KeyToPath{{Key: "AWS_ACCESS_KEY_ID", Path: "accessKeyID"}},
+				}},
+				{Secret: &corev1.SecretProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "s3"},
+					Items:                []corev1.KeyToPath{{Key: "secretAccessKey", Path: "secretAccessKey"}},
+				}},
+				{Secret: &corev1.SecretProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "sops"},
+					Items:                []corev1.KeyToPath{{Key: "AWS_SESSION_TOKEN", Path: "sessionToken"}},
+					Optional:             ptr.To(true),
+				}},
+			}))
+		})
+
+		It("should replace data restored by Velero with quiesce", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Storage: etcdaenixiov1alpha1.StorageSpec{
+						WALVolumeClaimTemplate: &etcdaenixiov1alpha1.EmbeddedPersistentVolumeClaim{},
+					},
+					Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+						Destination: etcdaenixiov1alpha1.BackupDestination{
+							S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups", CredentialsSecret: "s3"},
+						},
+					},
+					Velero: &etcdaenixiov1alpha1.VeleroSpec{Quiesce: true},
+				},
+			}
+			containers := generateInitContainers(etcdcluster)
+			Expect(containers).To(HaveLen(1))
+			Expect(containers[0].Args).To(ContainElements("--overwrite", "--wal-dir=/var/run/etcd-wal/default.wal"))
+			Expect(containers[0].VolumeMounts).To(ContainElement(HaveField("MountPath", "/var/run/etcd-wal")))
+		})
+	})
+
+	Context("When generating service mesh annotations", func() {
+		It("should not annotate pods outside of a mesh", func() {
+			Expect(serviceMeshAnnotations(&etcdaenixiov1alpha1.EtcdCluster{})).To(BeNil())
+		})
+
+		It("should exclude etcd ports and configure the Istio proxy", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					ServiceMesh: &etcdaenixiov1alpha1.ServiceMeshSpec{
+						Provider:             etcdaenixiov1alpha1.ServiceMeshIstio,
+						HoldUntilProxyStarts: true,
+						NativeSidecars:       true,
+					},
+				},
+			}
+			annotations := serviceMeshAnnotations(etcdcluster)
+			Expect(annotations).To(HaveKeyWithValue("traffic.sidecar.istio.io/excludeInboundPorts", "2379,2380,2381"))
+			Expect(annotations).To(HaveKeyWithValue("traffic.sidecar.istio.io/excludeOutboundPorts", "2379,2380"))
+			Expect(annotations).To(HaveKeyWithValue("proxy.istio.io/config", `{"holdApplicationUntilProxyStarts":true}`))
+			Expect(annotations).To(HaveKeyWithValue("sidecar.istio.io/nativeSidecar", "true"))
+		})
+
+		It("should configure the Linkerd proxy without port exclusion", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					ServiceMesh: &etcdaenixiov1alpha1.ServiceMeshSpec{
+						Provider:             etcdaenixiov1alpha1.ServiceMeshLinkerd,
+						ExcludePorts:         ptr.To(false),
+						HoldUntilProxyStarts: true,
+					},
+				},
+			}
+			Expect(serviceMeshAnnotations(etcdcluster)).To(Equal(map[string]string{
+				"config.linkerd.io/proxy-await": "enabled",
+			}))
+		})
+	})
+
+	Context("When adding the agent sidecar", func() {
+		It("should not add the sidecar without enabled functions", func() {
+			podSpec := corev1.PodSpec{}
+			addAgentSidecar(&etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{Agent: &etcdaenixiov1alpha1.AgentSpec{}},
+			}, &podSpec)
+			Expect(podSpec.InitContainers).To(BeEmpty())
+			Expect(podSpec.Containers).To(BeEmpty())
+		})
+
+		It("should add a native sidecar container if enabled", func() {
+			podSpec := corev1.PodSpec{}
+			addAgentSidecar(&etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Agent: &etcdaenixiov1alpha1.AgentSpec{VolumeMetrics: true, NativeSidecar: ptr.To(true)},
+				},
+			}, &podSpec)
+			Expect(podSpec.Containers).To(BeEmpty())
+			Expect(podSpec.InitContainers).To(HaveLen(1))
+			Expect(podSpec.InitContainers[0].Name).To(Equal(AgentContainerName))
+			Expect(podSpec.InitContainers[0].RestartPolicy).To(Equal(ptr.To(corev1.ContainerRestartPolicyAlways)))
+			Expect(podSpec.InitContainers[0].Args).To(Equal([]string{"metrics", "--data-dir=/var/run/etcd"}))
+		})
+
+		It("should add a regular container if native sidecars are disabled", func() {
+			podSpec := corev1.PodSpec{}
+			addAgentSidecar(&etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Agent: &etcdaenixiov1alpha1.AgentSpec{VolumeMetrics: true, NativeSidecar: ptr.To(false)},
+				},
+			}, &podSpec)
+			Expect(podSpec.InitContainers).To(BeEmpty())
+			Expect(podSpec.Containers).To(HaveLen(1))
+			Expect(podSpec.Containers[0].RestartPolicy).To(BeNil())
+		})
+	})
+
+	Context("When shipping logs", func() {
+		It("should write rotated logs to a volume shared with the sidecar", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Logging: &etcdaenixiov1alpha1.LoggingSpec{
+						Level: "warn",
+						Shipping: &etcdaenixiov1alpha1.LogShippingSpec{
+							Container:  corev1.Container{Name: "fluent-bit", Image: "fluent/fluent-bit:3.1"},
+							MaxSize:    ptr.To(resource.MustParse("10Mi")),
+							MaxBackups: ptr.To(int32(1)),
+						},
+					},
+				},
+			}
+			Expect(generateEtcdArgs(etcdcluster)).To(ContainElements(
+				"--log-level=warn",
+				"--log-outputs=/var/log/etcd/etcd.log",
+				"--enable-log-rotation=true",
+				`--log-rotation-config-json={"maxsize":10,"maxbackups":1}`,
+			))
+
+			podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "etcd"}}}
+			addLogShipping(etcdcluster, &podSpec)
+			Expect(podSpec.Volumes).To(HaveLen(1))
+			Expect(podSpec.Volumes[0].EmptyDir.SizeLimit.String()).To(Equal("30Mi"))
+			Expect(podSpec.Containers).To(HaveLen(2))
+			Expect(podSpec.Containers[0].VolumeMounts).To(ConsistOf(HaveField("MountPath", "/var/log/etcd")))
+			Expect(podSpec.Containers[1].Name).To(Equal("fluent-bit"))
+			Expect(podSpec.Containers[1].VolumeMounts).To(ConsistOf(HaveField("ReadOnly", true)))
+		})
+	})
+
+	Context("When adding placement", func() {
+		It("should schedule members to control plane nodes", func() {
+			podSpec := corev1.PodSpec{}
+			addPlacement(&etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Placement: &etcdaenixiov1alpha1.PlacementSpec{ControlPlane: true},
+				},
+			}, &podSpec)
+			Expect(podSpec.NodeSelector).To(Equal(map[string]string{"node-role.kubernetes.io/control-plane": ""}))
+			Expect(podSpec.Tolerations).To(ConsistOf(
+				HaveField("Key", "node-role.kubernetes.io/control-plane"),
+				HaveField("Key", "node-role.kubernetes.io/master"),
+			))
+		})
+
+		It("should let the pod template override tolerations", func() {
+			podSpec := corev1.PodSpec{}
+			addPlacement(&etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Placement: &etcdaenixiov1alpha1.PlacementSpec{ControlPlane: true},
+				},
+			}, &podSpec)
+			tolerations := []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}
+			merged, err := k8sutils.StrategicMerge(podSpec, corev1.PodSpec{Tolerations: tolerations})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged.Tolerations).To(Equal(tolerations))
+			Expect(merged.NodeSelector).To(HaveKey("node-role.kubernetes.io/control-plane"))
+		})
+	})
+
+	Context("When selecting linux nodes", func() {
+		It("should add the linux node selector unless the os is selected", func() {
+			podSpec := corev1.PodSpec{NodeSelector: map[string]string{"pool": "etcd"}}
+			addLinuxNodeSelector(&podSpec)
+			Expect(podSpec.NodeSelector).To(Equal(map[string]string{"pool": "etcd", "kubernetes.io/os": "linux"}))
+
+			merged, err := k8sutils.StrategicMerge(podSpec, corev1.PodSpec{
+				NodeSelector: map[string]string{"kubernetes.io/os": "other"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(merged.NodeSelector).To(HaveKeyWithValue("kubernetes.io/os", "other"))
+			addLinuxNodeSelector(&merged)
+			Expect(merged.NodeSelector).To(HaveKeyWithValue("kubernetes.io/os", "other"))
+		})
+	})
+
+	Context("When adding architectures", func() {
+		It("should require nodes of the architectures in every node selector term", func() {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Architectures: []etcdaenixiov1alpha1.Architecture{
+						etcdaenixiov1alpha1.ArchitectureAMD64,
+						etcdaenixiov1alpha1.ArchitectureARM64,
+					},
+				},
+			}
+			requirement := corev1.NodeSelectorRequirement{
+				Key:      "kubernetes.io/arch",
+				Operator: corev1.NodeSelectorOpIn,
+				Values:   []string{"amd64", "arm64"},
+			}
+			podSpec := corev1.PodSpec{}
+			addArchitectures(cluster, &podSpec)
+			Expect(podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms).To(
+				Equal([]corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{requirement}}}))
+
+			zone := corev1.NodeSelectorRequirement{
+				Key:      "topology.kubernetes.io/zone",
+				Operator: corev1.NodeSelectorOpIn,
+				Values:   []string{"a"},
+			}
+			affinity := &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{zone}},
+						{MatchFields: []corev1.NodeSelectorRequirement{{
+							Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"node"},
+						}}},
+					},
+				},
+			}}
+			podSpec = corev1.PodSpec{Affinity: affinity}
+			addArchitectures(cluster, &podSpec)
+			terms := podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+			Expect(terms).To(HaveLen(2))
+			Expect(terms[0].MatchExpressions).To(Equal([]corev1.NodeSelectorRequirement{zone, requirement}))
+			Expect(terms[1].MatchExpressions).To(Equal([]corev1.NodeSelectorRequirement{requirement}))
+			By("keeping the original affinity unchanged")
+			Expect(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions).
+				To(HaveLen(1))
+		})
+	})
+
+	Context("When adding security context", func() {
+		It("should run members as the configured non-root user", func() {
+			podSpec := corev1.PodSpec{}
+			addSecurityContext(&etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					SecurityContext: &etcdaenixiov1alpha1.MemberSecurityContext{
+						RunAsUser:  ptr.To(int64(1000)),
+						RunAsGroup: ptr.To(int64(1000)),
+						FSGroup:    ptr.To(int64(2000)),
+					},
+				},
+			}, &podSpec)
+			Expect(podSpec.SecurityContext).To(Equal(&corev1.PodSecurityContext{
+				RunAsUser:    ptr.To(int64(1000)),
+				RunAsGroup:   ptr.To(int64(1000)),
+				FSGroup:      ptr.To(int64(2000)),
+				RunAsNonRoot: ptr.To(true),
+			}))
+		})
+
+		It("should not require non-root for root user", func() {
+			podSpec := corev1.PodSpec{}
+			addSecurityContext(&etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					SecurityContext: &etcdaenixiov1alpha1.MemberSecurityContext{RunAsUser: ptr.To(int64(0))},
+				},
+			}, &podSpec)
+			Expect(podSpec.SecurityContext.RunAsNonRoot).To(BeNil())
+		})
+	})
+
+	Context("When replicas of the StatefulSet are changed out of band", func() {
+		It("should not check StatefulSets without applied replicas", func() {
+			_, edited := OutOfBandReplicas(&appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Replicas: ptr.To(int32(5))}})
+			Expect(edited).To(BeFalse())
+		})
+
+		It("should revert to the replicas set by the operator", func(ctx SpecContext) {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+			sts := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "ns",
+					Name:        "test",
+					Annotations: map[string]string{ReplicasAnnotation: "3"},
+				},
+				Spec:   appsv1.StatefulSetSpec{Replicas: ptr.To(int32(5))},
+				Status: appsv1.StatefulSetStatus{ReadyReplicas: 3},
+			}
+			rclient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(sts).Build()
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test", UID: "0b1c"},
+				Spec:       etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(3))},
+			}
+			applied, edited := OutOfBandReplicas(sts)
+			Expect(edited).To(BeTrue())
+			Expect(applied).To(Equal(int32(3)))
+			Expect(statefulSetReplicas(ctx, cluster, rclient, scheme)).To(Equal(ptr.To(int32(3))))
+			Expect(OperationLockHolder(ctx, cluster, rclient)).To(BeEmpty())
+		})
+	})
+
+	Context("When generating Velero hooks", func() {
+		It("should not annotate pods without Velero integration", func() {
+			Expect(veleroHookAnnotations(&etcdaenixiov1alpha1.EtcdCluster{})).To(BeNil())
+		})
+
+		It("should save snapshot before backup and check health after restore", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Velero: &etcdaenixiov1alpha1.VeleroSpec{HookTimeout: metav1.Duration{Duration: time.Minute}},
+				},
+			}
+			annotations := veleroHookAnnotations(etcdcluster)
+			Expect(annotations).To(HaveKeyWithValue("pre.hook.backup.velero.io/container", "etcd"))
+			Expect(annotations).To(HaveKeyWithValue("pre.hook.backup.velero.io/command",
+				`["etcdctl","--endpoints=http://localhost:2379","snapshot","save","/var/run/etcd/velero-snapshot.db"]`))
+			Expect(annotations).To(HaveKeyWithValue("pre.hook.backup.velero.io/timeout", "1m0s"))
+			Expect(annotations).To(HaveKeyWithValue("post.hook.restore.velero.io/command",
+				`["etcdctl","--endpoints=http://localhost:2379","endpoint","health"]`))
+		})
+
+		It("should use client certificate with TLS", func() {
+			etcdcluster := &etcdaenixiov1alpha1.EtcdCluster{
+				Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+					Security: &etcdaenixiov1alpha1.SecuritySpec{
+						TLS: etcdaenixiov1alpha1.TLSSpec{ServerSecret: "server", ClientSecret: "client"},
+					},
+					Velero: &etcdaenixiov1alpha1.VeleroSpec{},
+				},
+			}
+			Expect(etcdctlCommand(etcdcluster)).To(Equal([]string{
+				"etcdctl",
+				"--endpoints=https://localhost:2379",
+				"--insecure-skip-tls-verify",
+				"--cert=/etc/etcd/pki/client/cert/tls.crt",
+				"--key=/etc/etcd/pki/client/cert/tls.key",
+			}))
+			Expect(generateVolumeMounts(etcdcluster)).To(ContainElement(HaveField("MountPath", "/etc/etcd/pki/client/cert")))
+		})
+	})
+
 	/* TODO: all of the following tests validate merging logic, but all merging logic is now handled externally.
 		These tests now need a rewrite.
 
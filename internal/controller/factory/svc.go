@@ -24,7 +24,6 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
@@ -35,6 +34,14 @@ func GetClientServiceName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
 	return fmt.Sprintf("%s-client", cluster.Name)
 }
 
+func GetLeaderServiceName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	return fmt.Sprintf("%s-leader", cluster.Name)
+}
+
+func GetFollowersServiceName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	return fmt.Sprintf("%s-followers", cluster.Name)
+}
+
 func CreateOrUpdateClusterService(
 	ctx context.Context,
 	cluster *etcdaenixiov1alpha1.EtcdCluster,
@@ -50,8 +57,8 @@ func CreateOrUpdateClusterService(
 		},
 		Spec: corev1.ServiceSpec{
 			Ports: []corev1.ServicePort{
-				{Name: "peer", TargetPort: intstr.FromInt32(2380), Port: 2380, Protocol: corev1.ProtocolTCP},
-				{Name: "client", TargetPort: intstr.FromInt32(2379), Port: 2379, Protocol: corev1.ProtocolTCP},
+				{Name: "peer", TargetPort: intstr.FromInt32(cluster.PeerPort()), Port: cluster.PeerPort(), Protocol: corev1.ProtocolTCP},
+				clientServicePort(cluster),
 			},
 			Type:                     corev1.ServiceTypeClusterIP,
 			ClusterIP:                "None",
@@ -59,9 +66,13 @@ func CreateOrUpdateClusterService(
 			PublishNotReadyAddresses: true,
 		},
 	}
+	if cluster.ServiceCAEnabled() {
+		// certificates of headless services cover names of their endpoints
+		svc.Annotations = map[string]string{ServingCertSecretAnnotation: cluster.Spec.Security.TLS.ServerSecret}
+	}
 	logger.V(2).Info("cluster service spec generated", "svc_name", svc.Name, "svc_spec", svc.Spec)
 
-	if err := ctrl.SetControllerReference(cluster, svc, rscheme); err != nil {
+	if err := SetOwner(cluster, svc, rscheme); err != nil {
 		return fmt.Errorf("cannot set controller reference: %w", err)
 	}
 
@@ -83,17 +94,86 @@ func CreateOrUpdateClientService(
 		},
 		Spec: corev1.ServiceSpec{
 			Ports: []corev1.ServicePort{
-				{Name: "client", TargetPort: intstr.FromInt32(2379), Port: 2379, Protocol: corev1.ProtocolTCP},
+				clientServicePort(cluster),
 			},
 			Type:     corev1.ServiceTypeClusterIP,
 			Selector: NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy(),
 		},
 	}
+	if cluster.ManagedEndpoints() {
+		// endpoints are published by the operator, see CreateOrUpdateEndpointSlice
+		svc.Spec.Selector = nil
+	}
 	logger.V(2).Info("client service spec generated", "svc_name", svc.Name, "svc_spec", svc.Spec)
 
-	if err := ctrl.SetControllerReference(cluster, svc, rscheme); err != nil {
+	if err := SetOwner(cluster, svc, rscheme); err != nil {
 		return fmt.Errorf("cannot set controller reference: %w", err)
 	}
 
 	return reconcileService(ctx, rclient, cluster.Name, svc)
 }
+
+// CreateOrUpdateRoleServices creates the leader and followers Services if role Services are enabled and removes
+// them otherwise. In Selector endpoints mode they select member pods by RoleLabel kept up to date by the operator,
+// in Managed mode they have no selector and the operator publishes their EndpointSlices.
+// EndpointSlices published by the operator are removed in Selector mode.
+func CreateOrUpdateRoleServices(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	rclient client.Client,
+	rscheme *runtime.Scheme,
+) error {
+	if !cluster.ManagedEndpoints() {
+		if err := deleteEndpointSlices(ctx, cluster, rclient); err != nil {
+			return err
+		}
+	}
+	logger := log.FromContext(ctx)
+	for _, role := range []struct{ service, role string }{
+		{service: GetLeaderServiceName(cluster), role: RoleLeader},
+		{service: GetFollowersServiceName(cluster), role: RoleFollower},
+	} {
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      role.service,
+				Namespace: cluster.Namespace,
+				Labels:    NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy(),
+			},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{
+					clientServicePort(cluster),
+				},
+				Type:     corev1.ServiceTypeClusterIP,
+				Selector: NewLabelsBuilder().WithName().WithInstance(cluster.Name).WithManagedBy().WithRole(role.role),
+			},
+		}
+		if !cluster.RoleServices() {
+			if err := rclient.Delete(ctx, svc); client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("cannot delete service %s: %w", svc.Name, err)
+			}
+			continue
+		}
+		if cluster.ManagedEndpoints() {
+			svc.Spec.Selector = nil
+		}
+		logger.V(2).Info("role service spec generated", "svc_name", svc.Name, "svc_spec", svc.Spec)
+
+		if err := SetOwner(cluster, svc, rscheme); err != nil {
+			return fmt.Errorf("cannot set controller reference: %w", err)
+		}
+		if err := reconcileService(ctx, rclient, cluster.Name, svc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientServicePort returns the client port of cluster Services.
+func clientServicePort(cluster *etcdaenixiov1alpha1.EtcdCluster) corev1.ServicePort {
+	return corev1.ServicePort{
+		Name:       "client",
+		TargetPort: intstr.FromInt32(cluster.ClientPort()),
+		Port:       cluster.ClientPort(),
+		Protocol:   corev1.ProtocolTCP,
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"encoding/json"
+	"fmt"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// VeleroSnapshotPath is the file in the member data volume the pre-backup hook saves a consistent snapshot to,
+	// so file system backups of the volume contain it next to the data directory.
+	VeleroSnapshotPath = "/var/run/etcd/velero-snapshot.db"
+
+	clientCertificateVolume   = "client-certificate"
+	clientCertificateMountDir = "/etc/etcd/pki/client/cert"
+)
+
+// veleroHookAnnotations returns Velero hook annotations of member pods. Before the pod is backed up, the member saves
+// a snapshot to its data volume, and after the pod is restored, Velero waits for the member to become healthy.
+// Hooks run etcdctl inside the etcd container.
+func veleroHookAnnotations(cluster *etcdaenixiov1alpha1.EtcdCluster) map[string]string {
+	if cluster.Spec.Velero == nil {
+		return nil
+	}
+	timeout := cluster.Spec.Velero.HookTimeout.Duration.String()
+	snapshotCommand, _ := json.Marshal(append(etcdctlCommand(cluster), "snapshot", "save", VeleroSnapshotPath))
+	healthCommand, _ := json.Marshal(append(etcdctlCommand(cluster), "endpoint", "health"))
+
+	return map[string]string{
+		"pre.hook.backup.velero.io/container":      etcdContainerName,
+		"pre.hook.backup.velero.io/command":        string(snapshotCommand),
+		"pre.hook.backup.velero.io/on-error":       "Fail",
+		"pre.hook.backup.velero.io/timeout":        timeout,
+		"post.hook.restore.velero.io/container":    etcdContainerName,
+		"post.hook.restore.velero.io/command":      string(healthCommand),
+		"post.hook.restore.velero.io/on-error":     "Continue",
+		"post.hook.restore.velero.io/exec-timeout": timeout,
+		"post.hook.restore.velero.io/wait-timeout": timeout,
+	}
+}
+
+// etcdctlCommand returns etcdctl command connecting to the member it is run in.
+func etcdctlCommand(cluster *etcdaenixiov1alpha1.EtcdCluster) []string {
+	command := []string{"etcdctl", fmt.Sprintf("--endpoints=http://localhost:%d", cluster.ClientPort())}
+	if cluster.Spec.Security == nil || cluster.Spec.Security.TLS.ServerSecret == "" {
+		return command
+	}
+	// server certificate is not issued for localhost
+	command = []string{"etcdctl", fmt.Sprintf("--endpoints=https://localhost:%d", cluster.ClientPort()), "--insecure-skip-tls-verify"}
+	if cluster.Spec.Security.TLS.ClientSecret != "" {
+		command = append(command,
+			fmt.Sprintf("--cert=%s/tls.crt", clientCertificateMountDir),
+			fmt.Sprintf("--key=%s/tls.key", clientCertificateMountDir),
+		)
+	}
+	return command
+}
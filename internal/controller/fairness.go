@@ -0,0 +1,156 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// objectReconcileRate is the sustained number of reconciliations per second of a single object.
+	objectReconcileRate = rate.Limit(1)
+	// objectReconcileBurst is the number of reconciliations of a single object allowed in a row.
+	objectReconcileBurst = 10
+	// objectLimiterPruneInterval is how often limiters of objects which are not reconciled any more are dropped.
+	objectLimiterPruneInterval = 10 * time.Minute
+
+	// failureBaseDelay is the delay before the first retry of a failed reconciliation.
+	failureBaseDelay = time.Second
+	// failureMaxDelay is the maximum delay between retries of an object failing to reconcile.
+	failureMaxDelay = 5 * time.Minute
+)
+
+// failureRateLimiter is the rate limiter of the reconcile queue, which delays retries of every failing object
+// exponentially. Unlike the default one, it has no limit shared by all objects, so objects failing constantly
+// are retried slower and slower and never use up retries of others. The queue forgets failures of requeued
+// requests, so failures of requests postponed by fairReconciler are kept until the object is reconciled.
+type failureRateLimiter struct {
+	workqueue.RateLimiter
+
+	mu        sync.Mutex
+	postponed map[any]bool
+}
+
+func newFailureRateLimiter() *failureRateLimiter {
+	return &failureRateLimiter{
+		RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(failureBaseDelay, failureMaxDelay),
+		postponed:   map[any]bool{},
+	}
+}
+
+// postpone keeps failures of the item when the queue forgets it next.
+func (l *failureRateLimiter) postpone(item any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.postponed[item] = true
+}
+
+// Forget resets failures of the item unless it was postponed.
+func (l *failureRateLimiter) Forget(item any) {
+	l.mu.Lock()
+	postponed := l.postponed[item]
+	delete(l.postponed, item)
+	l.mu.Unlock()
+	if !postponed {
+		l.RateLimiter.Forget(item)
+	}
+}
+
+// fairReconciler limits the rate of reconciliations of every object with its own token bucket, so an object
+// changing constantly, e.g. a flapping cluster updating its status, can't keep workers busy and starve other
+// objects. Reconciliations over the limit are postponed until a token is available instead of being run.
+type fairReconciler struct {
+	reconcile.Reconciler
+
+	rate     rate.Limit
+	burst    int
+	failures *failureRateLimiter
+
+	mu        sync.Mutex
+	limiters  map[types.NamespacedName]*rate.Limiter
+	lastPrune time.Time
+}
+
+func newFairReconciler(r reconcile.Reconciler) *fairReconciler {
+	return &fairReconciler{
+		Reconciler: r,
+		rate:       objectReconcileRate,
+		burst:      objectReconcileBurst,
+		failures:   newFailureRateLimiter(),
+		limiters:   map[types.NamespacedName]*rate.Limiter{},
+		lastPrune:  time.Now(),
+	}
+}
+
+// Reconcile reconciles the object if its rate limit allows, otherwise it is requeued after the delay
+// the limit imposes.
+func (f *fairReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if delay := f.delay(req.NamespacedName, time.Now()); delay > 0 {
+		log.FromContext(ctx).V(1).Info("reconciliation is postponed by the object rate limit", "delay", delay)
+		f.failures.postpone(req)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+	return f.Reconciler.Reconcile(ctx, req)
+}
+
+// delay takes a token of the object and returns zero, or returns the time until the next token is available
+// if there are none.
+func (f *fairReconciler) delay(key types.NamespacedName, now time.Time) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now.Sub(f.lastPrune) > objectLimiterPruneInterval {
+		f.prune(now)
+	}
+	limiter, ok := f.limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(f.rate, f.burst)
+		f.limiters[key] = limiter
+	}
+	reservation := limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		// the token is taken when the object is reconciled later
+		reservation.CancelAt(now)
+	}
+	return delay
+}
+
+// forget drops the limiter of the deleted object.
+func (f *fairReconciler) forget(key types.NamespacedName) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.limiters, key)
+}
+
+// prune drops limiters with all tokens available, since their objects are not reconciled for a while.
+func (f *fairReconciler) prune(now time.Time) {
+	for key, limiter := range f.limiters {
+		if limiter.TokensAt(now) >= float64(f.burst) {
+			delete(f.limiters, key)
+		}
+	}
+	f.lastPrune = now
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Fair reconciliation", func() {
+	var (
+		calls map[types.NamespacedName]int
+		fair  *fairReconciler
+	)
+
+	BeforeEach(func() {
+		calls = map[types.NamespacedName]int{}
+		fair = newFairReconciler(reconcile.Func(func(_ context.Context, req ctrl.Request) (ctrl.Result, error) {
+			calls[req.NamespacedName]++
+			return ctrl.Result{}, nil
+		}))
+	})
+
+	It("should postpone reconciliations of an object over its rate limit", func(ctx SpecContext) {
+		flapping := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "flapping"}}
+		healthy := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "healthy"}}
+		for i := 0; i < objectReconcileBurst; i++ {
+			Expect(fair.Reconcile(ctx, flapping)).To(Equal(ctrl.Result{}))
+		}
+		result, err := fair.Reconcile(ctx, flapping)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", time.Second))
+		Expect(calls[flapping.NamespacedName]).To(Equal(objectReconcileBurst))
+
+		Expect(fair.Reconcile(ctx, healthy)).To(Equal(ctrl.Result{}))
+		Expect(calls[healthy.NamespacedName]).To(Equal(1))
+	})
+
+	It("should keep failures of postponed reconciliations", func(ctx SpecContext) {
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns", Name: "failing"}}
+		failures := fair.failures
+		Expect(failures.When(req)).To(Equal(failureBaseDelay))
+		Expect(failures.When(req)).To(Equal(2 * failureBaseDelay))
+
+		for i := 0; i < objectReconcileBurst; i++ {
+			fair.delay(req.NamespacedName, time.Now())
+		}
+		result, err := fair.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		// the queue forgets requeued requests
+		failures.Forget(req)
+		Expect(failures.NumRequeues(req)).To(Equal(2))
+		Expect(failures.When(req)).To(Equal(4 * failureBaseDelay))
+
+		failures.Forget(req)
+		Expect(failures.NumRequeues(req)).To(BeZero())
+	})
+
+	It("should drop limiters of objects not reconciled for a while", func() {
+		key := types.NamespacedName{Namespace: "ns", Name: "test"}
+		now := time.Now()
+		Expect(fair.delay(key, now)).To(BeZero())
+		Expect(fair.limiters).To(HaveKey(key))
+
+		fair.prune(now.Add(objectLimiterPruneInterval))
+		Expect(fair.limiters).NotTo(HaveKey(key))
+	})
+
+	It("should drop limiters of deleted objects", func() {
+		key := types.NamespacedName{Namespace: "ns", Name: "test"}
+		r := &EtcdClusterReconciler{fair: fair}
+		Expect(fair.delay(key, time.Now())).To(BeZero())
+		r.forgetCluster(key)
+		Expect(fair.limiters).NotTo(HaveKey(key))
+	})
+})
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+// autoscale updates the autoscaling status of the cluster and returns the number of replicas the cluster has to be
+// scaled to or zero if replicas are kept. Replicas are changed by one member at a time towards an odd number
+// of members advised by the highest request rate of a member, and only while all safety conditions hold,
+// see autoscalingBlockedBy.
+func autoscale(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	requestRate float64,
+	lockHolder factory.Operation,
+	now time.Time,
+) int32 {
+	spec := cluster.Spec.Autoscaling
+	status := cluster.Status.Autoscaling
+	if status == nil {
+		status = &etcdaenixiov1alpha1.AutoscalingStatus{}
+		cluster.Status.Autoscaling = status
+	}
+	current := *cluster.Spec.Replicas
+	desired := current
+	switch {
+	case current%2 == 0 && status.DesiredReplicas != 0 && status.DesiredReplicas != current:
+		// a change to an odd number of members is in progress
+		desired = status.DesiredReplicas
+	case requestRate > requestRateThreshold:
+		desired = current + 1 + current%2
+	case current > spec.MinReplicas &&
+		(status.LastScaleTime == nil || now.Sub(status.LastScaleTime.Time) >= spec.ScaleDownDelay.Duration):
+		// members are removed only if the remaining ones stay well below the threshold, so scaling does not flap
+		smaller := max(current-1-current%2, 1)
+		if requestRate*float64(current)/float64(smaller) < requestRateThreshold/2 {
+			desired = smaller
+		}
+	}
+	desired = min(max(desired, spec.MinReplicas), spec.MaxReplicas)
+	status.DesiredReplicas = desired
+	status.BlockedBy = ""
+	if desired == current {
+		return 0
+	}
+	if status.BlockedBy = autoscalingBlockedBy(cluster, lockHolder, now); status.BlockedBy != "" {
+		return 0
+	}
+	status.LastScaleTime = &metav1.Time{Time: now}
+	if desired > current {
+		return current + 1
+	}
+	return current - 1
+}
+
+// autoscalingBlockedBy returns the safety condition preventing replicas of the cluster from being changed or empty
+// string if replicas can be changed: all members are ready, no other operation is in progress, the last snapshot
+// is recent and the time is inside the maintenance window.
+func autoscalingBlockedBy(cluster *etcdaenixiov1alpha1.EtcdCluster, lockHolder factory.Operation, now time.Time) string {
+	spec := cluster.Spec.Autoscaling
+	ready := meta.FindStatusCondition(cluster.Status.Conditions, etcdaenixiov1alpha1.EtcdConditionReady)
+	switch {
+	case ready == nil || ready.Status != metav1.ConditionTrue ||
+		ready.Reason != string(etcdaenixiov1alpha1.EtcdCondTypeStatefulSetReady):
+		return "not all members are ready"
+	case len(cluster.Status.Workflows) > 0:
+		return fmt.Sprintf("operation %s is in progress", cluster.Status.Workflows[0].Operation)
+	case lockHolder != "":
+		return fmt.Sprintf("operation %s is in progress", lockHolder)
+	case cluster.Status.Backup == nil || cluster.Status.Backup.LastSnapshotTime == nil:
+		return "no snapshot is taken yet"
+	case now.Sub(cluster.Status.Backup.LastSnapshotTime.Time) > spec.MaxBackupAge.Duration:
+		return fmt.Sprintf("last snapshot is older than %s", spec.MaxBackupAge.Duration)
+	case spec.MaintenanceWindow != nil && !spec.MaintenanceWindow.Contains(now):
+		return "outside of the maintenance window"
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+)
+
+var _ = Describe("Cluster autoscaling", func() {
+	var cluster *etcdaenixiov1alpha1.EtcdCluster
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(3)),
+				Autoscaling: &etcdaenixiov1alpha1.AutoscalingSpec{
+					MinReplicas:    3,
+					MaxReplicas:    5,
+					MaxBackupAge:   metav1.Duration{Duration: 24 * time.Hour},
+					ScaleDownDelay: metav1.Duration{Duration: time.Hour},
+				},
+			},
+			Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupStatus{LastSnapshotTime: &metav1.Time{Time: now.Add(-time.Hour)}},
+			},
+		}
+		factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionReady).
+			WithStatus(true).
+			WithReason(string(etcdaenixiov1alpha1.EtcdCondTypeStatefulSetReady)).
+			Complete())
+	})
+
+	It("should add members one at a time towards an odd number", func() {
+		Expect(autoscale(cluster, 2*requestRateThreshold, "", now)).To(Equal(int32(4)))
+		Expect(cluster.Status.Autoscaling.DesiredReplicas).To(Equal(int32(5)))
+		Expect(cluster.Status.Autoscaling.LastScaleTime.Time).To(Equal(now))
+
+		cluster.Spec.Replicas = ptr.To(int32(4))
+		Expect(autoscale(cluster, 0, "", now.Add(5*time.Minute))).To(Equal(int32(5)))
+	})
+
+	It("should keep replicas within bounds", func() {
+		cluster.Spec.Replicas = ptr.To(int32(5))
+		Expect(autoscale(cluster, 2*requestRateThreshold, "", now)).To(BeZero())
+		Expect(cluster.Status.Autoscaling.DesiredReplicas).To(Equal(int32(5)))
+	})
+
+	It("should remove members only after the delay and with low load", func() {
+		cluster.Spec.Replicas = ptr.To(int32(5))
+		cluster.Status.Autoscaling = &etcdaenixiov1alpha1.AutoscalingStatus{
+			DesiredReplicas: 5,
+			LastScaleTime:   &metav1.Time{Time: now.Add(-30 * time.Minute)},
+		}
+		Expect(autoscale(cluster, 0, "", now)).To(BeZero())
+		Expect(autoscale(cluster, requestRateThreshold/2, "", now.Add(time.Hour))).To(BeZero())
+		Expect(autoscale(cluster, 100, "", now.Add(time.Hour))).To(Equal(int32(4)))
+	})
+
+	DescribeTable("should not change replicas unless safety conditions hold",
+		func(modify func(*etcdaenixiov1alpha1.EtcdCluster), lockHolder factory.Operation, blockedBy string) {
+			modify(cluster)
+			Expect(autoscale(cluster, 2*requestRateThreshold, lockHolder, now)).To(BeZero())
+			Expect(cluster.Status.Autoscaling.BlockedBy).To(ContainSubstring(blockedBy))
+		},
+		Entry("members are not ready", func(cluster *etcdaenixiov1alpha1.EtcdCluster) {
+			factory.SetCondition(cluster, factory.NewCondition(etcdaenixiov1alpha1.EtcdConditionReady).
+				WithStatus(true).
+				WithReason(string(etcdaenixiov1alpha1.EtcdCondTypeStatefulSetNotReady)).
+				Complete())
+		}, factory.Operation(""), "not all members are ready"),
+		Entry("another operation holds the lock", func(*etcdaenixiov1alpha1.EtcdCluster) {}, factory.OperationRollout,
+			"operation rollout is in progress"),
+		Entry("snapshot is old", func(cluster *etcdaenixiov1alpha1.EtcdCluster) {
+			cluster.Status.Backup.LastSnapshotTime = &metav1.Time{Time: now.Add(-48 * time.Hour)}
+		}, factory.Operation(""), "last snapshot is older than 24h0m0s"),
+		Entry("outside of the maintenance window", func(cluster *etcdaenixiov1alpha1.EtcdCluster) {
+			cluster.Spec.Autoscaling.MaintenanceWindow = &etcdaenixiov1alpha1.MaintenanceWindow{
+				Start: "02:00", Duration: metav1.Duration{Duration: 2 * time.Hour}}
+		}, factory.Operation(""), "outside of the maintenance window"),
+	)
+})
@@ -0,0 +1,308 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/controller/factory"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+const (
+	// recommendationInterval is how often usage metrics of members are sampled. Rates are averaged over it.
+	recommendationInterval = 5 * time.Minute
+	// quotaUsageThreshold is the share of the backend quota used by the database which requires a larger quota.
+	quotaUsageThreshold = 0.8
+	// quotaExhaustionHorizon is how soon the quota may be exhausted at the current growth before
+	// a larger quota is recommended.
+	quotaExhaustionHorizon = 7 * 24 * time.Hour
+	// walFsyncThreshold and backendCommitThreshold are average disk write latencies etcd needs storage
+	// to stay below of.
+	walFsyncThreshold      = 10 * time.Millisecond
+	backendCommitThreshold = 25 * time.Millisecond
+	// minDiskWrites is the number of disk writes in a sample needed to judge their latency.
+	minDiskWrites = 100
+	// requestRateThreshold is the request rate of a member per second which requires dedicated resources.
+	requestRateThreshold = 5000
+)
+
+// usageSample is usage metrics of all reachable members of a cluster taken at the same time.
+type usageSample struct {
+	takenAt time.Time
+	members map[string]etcd.UsageMetrics
+}
+
+// RecommendationReconciler samples usage metrics of members of ready clusters and records scaling and tuning
+// recommendations in the cluster status and events. Only replicas of clusters with autoscaling enabled are changed.
+type RecommendationReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// samples holds the last usageSample of every cluster keyed by its namespaced name.
+	samples sync.Map
+}
+
+// Reconcile compares usage metrics of cluster members with the previous sample and updates recommendations.
+func (r *RecommendationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+	if err := r.Get(ctx, req.NamespacedName, cluster); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			r.samples.Delete(req.String())
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	interval := cluster.ProbeInterval(recommendationInterval)
+	// metrics of starting or recovering members are not representative
+	if !cluster.DeletionTimestamp.IsZero() ||
+		!meta.IsStatusConditionTrue(cluster.Status.Conditions, etcdaenixiov1alpha1.EtcdConditionReady) {
+		r.samples.Delete(req.String())
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+	var previous usageSample
+	if value, ok := r.samples.Load(req.String()); ok {
+		previous = value.(usageSample)
+		if next := interval - time.Since(previous.takenAt); next > 0 {
+			return ctrl.Result{RequeueAfter: next}, nil
+		}
+	}
+
+	current := usageSample{takenAt: time.Now(), members: map[string]etcd.UsageMetrics{}}
+	for _, name := range cluster.MemberNames() {
+		var metrics etcd.UsageMetrics
+		err := etcd.Probe(ctx, func(ctx context.Context) (err error) {
+			metrics, err = etcd.GetUsageMetrics(ctx, metricsClient, etcd.MetricsURL(cluster, name))
+			return err
+		})
+		if err != nil {
+			log.FromContext(ctx).V(2).Info("cannot get member metrics", "member", name, "reason", err.Error())
+			continue
+		}
+		current.members[name] = metrics
+	}
+	r.samples.Store(req.String(), current)
+	if len(previous.members) == 0 {
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+
+	original := cluster.DeepCopy()
+	for _, recommendation := range setRecommendations(cluster, recommend(previous, current), current.takenAt) {
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "Recommendation", "%s: %s",
+			recommendation.Type, recommendation.Message)
+	}
+	var replicas int32
+	if cluster.Spec.Autoscaling != nil {
+		holder, err := factory.OperationLockHolder(ctx, cluster, r.Client)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		replicas = autoscale(cluster, maxRequestRate(previous, current), holder, current.takenAt)
+	} else {
+		cluster.Status.Autoscaling = nil
+	}
+	if err := clusterStatuses.write(ctx, r.Client, original, cluster); err != nil {
+		return ctrl.Result{}, err
+	}
+	if replicas != 0 {
+		if err := r.scale(ctx, cluster, replicas); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// scale changes the number of members of the cluster, members are added and removed by EtcdClusterReconciler.
+func (r *RecommendationReconciler) scale(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, replicas int32) error {
+	from := *cluster.Spec.Replicas
+	patch := client.MergeFrom(cluster.DeepCopy())
+	cluster.Spec.Replicas = ptr.To(replicas)
+	if err := r.Patch(ctx, cluster, patch); err != nil {
+		return fmt.Errorf("cannot change replicas: %w", err)
+	}
+	log.FromContext(ctx).Info("replicas are changed by autoscaling", "from", from, "to", replicas)
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "Autoscaled", "Replicas are changed from %d to %d, %d members are desired",
+		from, replicas, cluster.Status.Autoscaling.DesiredReplicas)
+	return nil
+}
+
+// recommend returns messages of recommendations advised from the change of usage metrics between samples.
+// Members which restarted between samples are skipped for rates, since their counters are reset.
+func recommend(previous, current usageSample) map[etcdaenixiov1alpha1.RecommendationType]string {
+	recommendations := map[etcdaenixiov1alpha1.RecommendationType]string{}
+	elapsed := current.takenAt.Sub(previous.takenAt)
+	if elapsed <= 0 {
+		return recommendations
+	}
+	names := make([]string, 0, len(current.members))
+	for name := range current.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := current.members[name]
+		before, sampled := previous.members[name]
+		if _, ok := recommendations[etcdaenixiov1alpha1.RecommendationIncreaseQuota]; !ok && m.Quota > 0 {
+			if message := quotaRecommendation(name, before, m, sampled, elapsed); message != "" {
+				recommendations[etcdaenixiov1alpha1.RecommendationIncreaseQuota] = message
+			}
+		}
+		if !sampled || m.Requests < before.Requests || m.WALFsyncs < before.WALFsyncs ||
+			m.BackendCommits < before.BackendCommits {
+			continue
+		}
+		if _, ok := recommendations[etcdaenixiov1alpha1.RecommendationFasterStorage]; !ok {
+			if message := storageRecommendation(name, before, m); message != "" {
+				recommendations[etcdaenixiov1alpha1.RecommendationFasterStorage] = message
+			}
+		}
+		if rate := requestRate(before, m, elapsed); rate > requestRateThreshold {
+			if _, ok := recommendations[etcdaenixiov1alpha1.RecommendationMoreResources]; !ok {
+				recommendations[etcdaenixiov1alpha1.RecommendationMoreResources] = fmt.Sprintf(
+					"Member %s serves %.0f requests/s; give members guaranteed CPU and memory or dedicated nodes",
+					name, rate)
+			}
+		}
+	}
+	return recommendations
+}
+
+// maxRequestRate returns the highest request rate per second of a member between samples. Members which restarted
+// between samples are skipped.
+func maxRequestRate(previous, current usageSample) float64 {
+	elapsed := current.takenAt.Sub(previous.takenAt)
+	var rate float64
+	for name, m := range current.members {
+		if before, ok := previous.members[name]; ok && elapsed > 0 && m.Requests >= before.Requests {
+			rate = max(rate, requestRate(before, m, elapsed))
+		}
+	}
+	return rate
+}
+
+func requestRate(before, m etcd.UsageMetrics, elapsed time.Duration) float64 {
+	return (m.Requests - before.Requests) / elapsed.Seconds()
+}
+
+// quotaRecommendation recommends a larger backend quota if the database of the member uses most of it
+// or is growing fast enough to exhaust it soon.
+func quotaRecommendation(name string, before, m etcd.UsageMetrics, sampled bool, elapsed time.Duration) string {
+	quota := resource.NewQuantity(int64(m.Quota), resource.BinarySI).String()
+	if m.DBSize >= quotaUsageThreshold*m.Quota {
+		return fmt.Sprintf("Database of member %s uses %.0f%% of the %s quota; increase quota-backend-bytes "+
+			"in spec.options or compact and defragment the database", name, 100*m.DBSize/m.Quota, quota)
+	}
+	if !sampled || m.DBSize <= before.DBSize {
+		return ""
+	}
+	growth := (m.DBSize - before.DBSize) / elapsed.Seconds()
+	exhaustedIn := time.Duration((m.Quota - m.DBSize) / growth * float64(time.Second))
+	if exhaustedIn >= quotaExhaustionHorizon {
+		return ""
+	}
+	return fmt.Sprintf("Database of member %s grows by %s/h and exhausts the %s quota in about %s; "+
+		"increase quota-backend-bytes in spec.options", name,
+		resource.NewQuantity(int64(growth*time.Hour.Seconds()), resource.BinarySI), quota, exhaustedIn.Round(time.Hour))
+}
+
+// storageRecommendation recommends faster storage if disk writes of the member were slow on average.
+func storageRecommendation(name string, before, m etcd.UsageMetrics) string {
+	average := func(count uint64, seconds float64) time.Duration {
+		return time.Duration(seconds / float64(count) * float64(time.Second))
+	}
+	if fsyncs := m.WALFsyncs - before.WALFsyncs; fsyncs >= minDiskWrites {
+		if latency := average(fsyncs, m.WALFsyncSeconds-before.WALFsyncSeconds); latency > walFsyncThreshold {
+			return fmt.Sprintf("WAL fsync of member %s takes %s on average; move members to a faster storage class",
+				name, latency.Round(time.Millisecond))
+		}
+	}
+	if commits := m.BackendCommits - before.BackendCommits; commits >= minDiskWrites {
+		if latency := average(commits, m.BackendCommitSeconds-before.BackendCommitSeconds); latency > backendCommitThreshold {
+			return fmt.Sprintf("Backend commit of member %s takes %s on average; move members to a faster storage class",
+				name, latency.Round(time.Millisecond))
+		}
+	}
+	return ""
+}
+
+// setRecommendations replaces recommendations in the cluster status. Recommendations which are still advised
+// keep the time they were first made. It returns recommendations which were not made before.
+func setRecommendations(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	messages map[etcdaenixiov1alpha1.RecommendationType]string,
+	now time.Time,
+) []etcdaenixiov1alpha1.Recommendation {
+	var recommendations, added []etcdaenixiov1alpha1.Recommendation
+	for _, recommendationType := range []etcdaenixiov1alpha1.RecommendationType{
+		etcdaenixiov1alpha1.RecommendationIncreaseQuota,
+		etcdaenixiov1alpha1.RecommendationFasterStorage,
+		etcdaenixiov1alpha1.RecommendationMoreResources,
+	} {
+		message, ok := messages[recommendationType]
+		if !ok {
+			continue
+		}
+		recommendation := etcdaenixiov1alpha1.Recommendation{Type: recommendationType, Message: message, Since: metav1.NewTime(now)}
+		if previous := findRecommendation(cluster, recommendationType); previous != nil {
+			recommendation.Since = previous.Since
+		} else {
+			added = append(added, recommendation)
+		}
+		recommendations = append(recommendations, recommendation)
+	}
+	cluster.Status.Recommendations = recommendations
+	return added
+}
+
+func findRecommendation(
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	recommendationType etcdaenixiov1alpha1.RecommendationType,
+) *etcdaenixiov1alpha1.Recommendation {
+	for i := range cluster.Status.Recommendations {
+		if cluster.Status.Recommendations[i].Type == recommendationType {
+			return &cluster.Status.Recommendations[i]
+		}
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RecommendationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("recommendation").
+		For(&etcdaenixiov1alpha1.EtcdCluster{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
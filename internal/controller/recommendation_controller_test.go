@@ -0,0 +1,85 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+var _ = Describe("Cluster recommendations", func() {
+	const gib = 1 << 30
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	sample := func(at time.Time, metrics etcd.UsageMetrics) usageSample {
+		return usageSample{takenAt: at, members: map[string]etcd.UsageMetrics{"test-0": metrics}}
+	}
+
+	It("should recommend a larger quota for a database close to it", func() {
+		metrics := etcd.UsageMetrics{DBSize: 1.8 * gib, Quota: 2 * gib}
+		recommendations := recommend(sample(start, metrics), sample(start.Add(5*time.Minute), metrics))
+		Expect(recommendations).To(HaveLen(1))
+		Expect(recommendations[etcdaenixiov1alpha1.RecommendationIncreaseQuota]).To(ContainSubstring("90% of the 2Gi quota"))
+	})
+
+	It("should recommend a larger quota for a database growing fast", func() {
+		before := etcd.UsageMetrics{DBSize: 0.5 * gib, Quota: 2 * gib}
+		after := etcd.UsageMetrics{DBSize: 0.6 * gib, Quota: 2 * gib}
+		recommendations := recommend(sample(start, before), sample(start.Add(time.Hour), after))
+		Expect(recommendations[etcdaenixiov1alpha1.RecommendationIncreaseQuota]).To(ContainSubstring("in about 14h"))
+	})
+
+	It("should recommend faster storage and more resources from rates", func() {
+		before := etcd.UsageMetrics{Quota: 2 * gib, Requests: 1000, WALFsyncs: 1000, WALFsyncSeconds: 1}
+		after := etcd.UsageMetrics{Quota: 2 * gib, Requests: 1000 + 60*6000, WALFsyncs: 2000, WALFsyncSeconds: 31}
+		recommendations := recommend(sample(start, before), sample(start.Add(time.Minute), after))
+		Expect(recommendations[etcdaenixiov1alpha1.RecommendationFasterStorage]).To(ContainSubstring("takes 30ms"))
+		Expect(recommendations[etcdaenixiov1alpha1.RecommendationMoreResources]).To(ContainSubstring("6000 requests/s"))
+	})
+
+	It("should skip rates of restarted members", func() {
+		before := etcd.UsageMetrics{Quota: 2 * gib, Requests: 1e9, WALFsyncs: 1e6}
+		after := etcd.UsageMetrics{Quota: 2 * gib, Requests: 10, WALFsyncs: 1000, WALFsyncSeconds: 100}
+		Expect(recommend(sample(start, before), sample(start.Add(time.Minute), after))).To(BeEmpty())
+	})
+
+	It("should keep the time of recommendations made before", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+		cluster.Status.Recommendations = []etcdaenixiov1alpha1.Recommendation{
+			{Type: etcdaenixiov1alpha1.RecommendationIncreaseQuota, Message: "old", Since: metav1.NewTime(start)},
+			{Type: etcdaenixiov1alpha1.RecommendationMoreResources, Message: "old", Since: metav1.NewTime(start)},
+		}
+		now := start.Add(time.Hour)
+		added := setRecommendations(cluster, map[etcdaenixiov1alpha1.RecommendationType]string{
+			etcdaenixiov1alpha1.RecommendationIncreaseQuota: "new",
+			etcdaenixiov1alpha1.RecommendationFasterStorage: "new",
+		}, now)
+
+		Expect(added).To(HaveLen(1))
+		Expect(added[0].Type).To(Equal(etcdaenixiov1alpha1.RecommendationFasterStorage))
+		Expect(cluster.Status.Recommendations).To(HaveLen(2))
+		Expect(cluster.Status.Recommendations[0].Since.Time).To(Equal(start))
+		Expect(cluster.Status.Recommendations[0].Message).To(Equal("new"))
+		Expect(cluster.Status.Recommendations[1].Since.Time).To(Equal(now))
+	})
+})
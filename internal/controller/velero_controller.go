@@ -0,0 +1,140 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// VeleroBackupGVK is the kind of Velero backups.
+var VeleroBackupGVK = schema.GroupVersionKind{Group: "velero.io", Version: "v1", Kind: "Backup"}
+
+// VeleroBackupReconciler quiesces clusters before Velero backs up their namespaces: as soon as a backup starts,
+// a snapshot of every cluster with quiesce enabled in the backed up namespaces is taken to the cluster backup
+// destination. Clusters restored from the backup are restored from this snapshot by EtcdClusterReconciler.
+type VeleroBackupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// Reconcile takes snapshots of clusters in namespaces included into the Velero backup while the backup is running.
+func (r *VeleroBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	veleroBackup := &unstructured.Unstructured{}
+	veleroBackup.SetGroupVersionKind(VeleroBackupGVK)
+	if err := r.Get(ctx, req.NamespacedName, veleroBackup); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	phase, _, _ := unstructured.NestedString(veleroBackup.Object, "status", "phase")
+	if phase != "" && phase != "New" && phase != "InProgress" {
+		return ctrl.Result{}, nil
+	}
+
+	clusters := &etcdaenixiov1alpha1.EtcdClusterList{}
+	if err := r.List(ctx, clusters); err != nil {
+		return ctrl.Result{}, err
+	}
+	var errs []error
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		applyDefaultBackupPolicy(ctx, cluster)
+		if !quiesceRequired(cluster, veleroBackup) {
+			continue
+		}
+		if err := r.quiesce(ctx, cluster, veleroBackup.GetName()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return ctrl.Result{}, errs[0]
+	}
+	return ctrl.Result{}, nil
+}
+
+// quiesce takes a snapshot of the cluster for the Velero backup and records it in the cluster status.
+func (r *VeleroBackupReconciler) quiesce(ctx context.Context, cluster *etcdaenixiov1alpha1.EtcdCluster, backupName string) error {
+	snapshot, err := snapshotCluster(ctx, r.Client, r.Recorder, cluster, time.Now(), backupName)
+	if err == nil {
+		// the cluster is restored from the backup destination
+		err = snapshot.err()
+	}
+	if err != nil {
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, "QuiesceFailed",
+			"Cannot take snapshot for Velero backup %s: %v", backupName, err)
+		return err
+	}
+	key := snapshot.key
+	log.FromContext(ctx).Info("snapshot taken for Velero backup", "cluster", client.ObjectKeyFromObject(cluster), "key", key)
+	r.Recorder.Eventf(cluster, corev1.EventTypeNormal, "Quiesced", "Snapshot %s is taken for Velero backup %s", key, backupName)
+
+	original := cluster.DeepCopy()
+	if cluster.Status.Velero == nil {
+		cluster.Status.Velero = &etcdaenixiov1alpha1.VeleroStatus{}
+	}
+	cluster.Status.Velero.LastQuiescedBackup = backupName
+	cluster.Status.Velero.LastQuiesceTime = &metav1.Time{Time: time.Now()}
+	return clusterStatuses.write(ctx, r.Client, original, cluster)
+}
+
+// quiesceRequired checks if a snapshot of the cluster has to be taken for the Velero backup.
+func quiesceRequired(cluster *etcdaenixiov1alpha1.EtcdCluster, veleroBackup *unstructured.Unstructured) bool {
+	if cluster.Spec.Velero == nil || !cluster.Spec.Velero.Quiesce || cluster.Spec.Backup == nil {
+		return false
+	}
+	if cluster.Status.Velero != nil && cluster.Status.Velero.LastQuiescedBackup == veleroBackup.GetName() {
+		return false
+	}
+	// never overwrite snapshots with data which is about to be replaced
+	if cluster.Status.Backup != nil && cluster.Status.Backup.RestoringFrom != "" || veleroRestorePending(cluster) {
+		return false
+	}
+	return backupIncludesNamespace(veleroBackup, cluster.Namespace)
+}
+
+// backupIncludesNamespace checks if the namespace is backed up by the Velero backup.
+func backupIncludesNamespace(veleroBackup *unstructured.Unstructured, namespace string) bool {
+	excluded, _, _ := unstructured.NestedStringSlice(veleroBackup.Object, "spec", "excludedNamespaces")
+	if slices.Contains(excluded, namespace) {
+		return false
+	}
+	included, _, _ := unstructured.NestedStringSlice(veleroBackup.Object, "spec", "includedNamespaces")
+	return len(included) == 0 || slices.Contains(included, "*") || slices.Contains(included, namespace)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *VeleroBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	veleroBackup := &unstructured.Unstructured{}
+	veleroBackup.SetGroupVersionKind(VeleroBackupGVK)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("velerobackup").
+		For(veleroBackup).
+		Complete(r)
+}
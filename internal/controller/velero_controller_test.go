@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Velero integration", func() {
+	newBackup := func(included, excluded []interface{}) *unstructured.Unstructured {
+		veleroBackup := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"includedNamespaces": included, "excludedNamespaces": excluded},
+		}}
+		veleroBackup.SetGroupVersionKind(VeleroBackupGVK)
+		veleroBackup.SetName("daily")
+		return veleroBackup
+	}
+	newCluster := func() *etcdaenixiov1alpha1.EtcdCluster {
+		return &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{},
+				Velero: &etcdaenixiov1alpha1.VeleroSpec{Quiesce: true},
+			},
+		}
+	}
+
+	Context("When matching backed up namespaces", func() {
+		It("should include all namespaces by default", func() {
+			Expect(backupIncludesNamespace(newBackup(nil, nil), "ns")).To(BeTrue())
+			Expect(backupIncludesNamespace(newBackup([]interface{}{"*"}, nil), "ns")).To(BeTrue())
+		})
+
+		It("should honor included and excluded namespaces", func() {
+			Expect(backupIncludesNamespace(newBackup([]interface{}{"ns"}, nil), "ns")).To(BeTrue())
+			Expect(backupIncludesNamespace(newBackup([]interface{}{"other"}, nil), "ns")).To(BeFalse())
+			Expect(backupIncludesNamespace(newBackup([]interface{}{"*"}, []interface{}{"ns"}), "ns")).To(BeFalse())
+		})
+	})
+
+	Context("When quiescing clusters", func() {
+		It("should quiesce cluster once per backup", func() {
+			cluster := newCluster()
+			Expect(quiesceRequired(cluster, newBackup(nil, nil))).To(BeTrue())
+			cluster.Status.Velero = &etcdaenixiov1alpha1.VeleroStatus{LastQuiescedBackup: "daily"}
+			Expect(quiesceRequired(cluster, newBackup(nil, nil))).To(BeFalse())
+		})
+
+		It("should not quiesce cluster without quiesce enabled", func() {
+			cluster := newCluster()
+			cluster.Spec.Velero.Quiesce = false
+			Expect(quiesceRequired(cluster, newBackup(nil, nil))).To(BeFalse())
+		})
+
+		It("should not quiesce cluster being restored", func() {
+			cluster := newCluster()
+			cluster.Labels = map[string]string{veleroBackupNameLabel: "weekly", veleroRestoreNameLabel: "weekly-1"}
+			Expect(quiesceRequired(cluster, newBackup(nil, nil))).To(BeFalse())
+			cluster.Status.Velero = &etcdaenixiov1alpha1.VeleroStatus{RestoredBackup: "weekly"}
+			Expect(quiesceRequired(cluster, newBackup(nil, nil))).To(BeTrue())
+		})
+	})
+
+	Context("When cluster is restored by Velero", func() {
+		It("should restore data only of restored clusters", func() {
+			cluster := newCluster()
+			Expect(veleroRestorePending(cluster)).To(BeFalse())
+			cluster.Labels = map[string]string{veleroBackupNameLabel: "daily"}
+			Expect(veleroRestorePending(cluster)).To(BeFalse())
+			cluster.Labels[veleroRestoreNameLabel] = "daily-1"
+			Expect(veleroRestorePending(cluster)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,205 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cron parses standard five-field cron expressions and computes their activation times.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set if the field is a wildcard without a step, like "*" or "?", but not "1-31",
+	// a day then matches if both fields match, otherwise it matches if either of restricted fields does.
+	domAny, dowAny bool
+}
+
+// field is the range of values of a cron field and names of its values.
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	// day of week 7 is Sunday as well as 0
+	dowField = field{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression of five fields: minute, hour, day of month, month and day of week.
+// Fields are lists of values, ranges and wildcards with optional steps, months and days of week can be named.
+// Macros @yearly, @monthly, @weekly, @daily and @hourly are supported as well.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("expected 5 fields in cron expression %q, found %d", expr, len(fields))
+	}
+	var s Schedule
+	var err error
+	if s.minute, _, err = parseField(fields[0], minuteField); err != nil {
+		return Schedule{}, err
+	}
+	if s.hour, _, err = parseField(fields[1], hourField); err != nil {
+		return Schedule{}, err
+	}
+	if s.dom, s.domAny, err = parseField(fields[2], domField); err != nil {
+		return Schedule{}, err
+	}
+	if s.month, _, err = parseField(fields[3], monthField); err != nil {
+		return Schedule{}, err
+	}
+	if s.dow, s.dowAny, err = parseField(fields[4], dowField); err != nil {
+		return Schedule{}, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseField parses a comma-separated list of the field into the set of values.
+// It reports if any part of the list is a wildcard without a step.
+func parseField(expr string, f field) (uint64, bool, error) {
+	var set uint64
+	anyValue := false
+	for _, part := range strings.Split(expr, ",") {
+		values, wildcard, err := parseRange(part, f)
+		if err != nil {
+			return 0, false, err
+		}
+		set |= values
+		anyValue = anyValue || wildcard
+	}
+	return set, anyValue, nil
+}
+
+// parseRange parses a wildcard, a value or a range of the field with an optional step into the set of values.
+// It reports if the range is a wildcard with no step or a step of 1, like the robfig/cron parser does.
+func parseRange(expr string, f field) (uint64, bool, error) {
+	rangeExpr, stepExpr, hasStep := strings.Cut(expr, "/")
+	step := 1
+	if hasStep {
+		var err error
+		if step, err = strconv.Atoi(stepExpr); err != nil || step <= 0 {
+			return 0, false, fmt.Errorf("invalid step %q of %s", stepExpr, f.name)
+		}
+	}
+	first, last := f.min, f.max
+	wildcard := rangeExpr == "*" || rangeExpr == "?"
+	if !wildcard {
+		low, high, isRange := strings.Cut(rangeExpr, "-")
+		var err error
+		if first, err = parseValue(low, f); err != nil {
+			return 0, false, err
+		}
+		last = first
+		if isRange {
+			if last, err = parseValue(high, f); err != nil {
+				return 0, false, err
+			}
+		} else if hasStep {
+			// a single value with a step means all values from it
+			last = f.max
+		}
+		if first > last {
+			return 0, false, fmt.Errorf("invalid range %q of %s", rangeExpr, f.name)
+		}
+	}
+	var set uint64
+	for v := first; v <= last; v += step {
+		set |= 1 << v
+	}
+	return set, wildcard && step == 1, nil
+}
+
+// parseValue parses a number or a name of the field value.
+func parseValue(expr string, f field) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(expr, name) {
+			return i + f.min, nil
+		}
+	}
+	v, err := strconv.Atoi(expr)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected a value from %d to %d", f.name, expr, f.min, f.max)
+	}
+	return v, nil
+}
+
+// maxSearch limits the search of the next activation time of schedules which never activate, like on February 30.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Next returns the first activation time of the schedule after the time or zero time if there is none.
+// Activation times are in the location of the time.
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		switch {
+		case !has(s.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !has(s.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !has(s.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchDay checks if the day of the time matches the schedule.
+func (s Schedule) matchDay(t time.Time) bool {
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<v) != 0
+}
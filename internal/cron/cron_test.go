@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schedule", func() {
+	at := func(value string) time.Time {
+		t, err := time.Parse(time.RFC3339, value)
+		Expect(err).NotTo(HaveOccurred())
+		return t
+	}
+
+	DescribeTable("computes the next activation time",
+		func(expr, from, next string) {
+			schedule, err := Parse(expr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule.Next(at(from))).To(Equal(at(next)))
+		},
+		Entry("every minute", "* * * * *", "2024-05-01T10:15:30Z", "2024-05-01T10:16:00Z"),
+		Entry("step of minutes", "*/15 * * * *", "2024-05-01T10:15:00Z", "2024-05-01T10:30:00Z"),
+		Entry("list of hours", "30 2,14 * * *", "2024-05-01T10:00:00Z", "2024-05-01T14:30:00Z"),
+		Entry("range of hours", "0 9-17 * * *", "2024-05-01T17:30:00Z", "2024-05-02T09:00:00Z"),
+		Entry("named month", "0 0 1 jan *", "2024-05-01T00:00:00Z", "2025-01-01T00:00:00Z"),
+		Entry("named day of week", "0 3 * * sat", "2024-05-01T00:00:00Z", "2024-05-04T03:00:00Z"),
+		Entry("Sunday as 7", "0 0 * * 7", "2024-05-01T00:00:00Z", "2024-05-05T00:00:00Z"),
+		Entry("day of month or day of week", "0 0 15 * mon", "2024-05-01T00:00:00Z", "2024-05-06T00:00:00Z"),
+		Entry("end of month", "0 0 31 * *", "2024-04-01T00:00:00Z", "2024-05-31T00:00:00Z"),
+		Entry("leap day", "0 0 29 2 *", "2024-03-01T00:00:00Z", "2028-02-29T00:00:00Z"),
+		Entry("macro", "@daily", "2024-05-01T10:00:00Z", "2024-05-02T00:00:00Z"),
+		Entry("hourly macro", "@hourly", "2024-05-01T10:00:00Z", "2024-05-01T11:00:00Z"),
+	)
+
+	// expected times are the ones of github.com/robfig/cron/v3, which restricts days by both fields only if
+	// one of them matches every day
+	DescribeTable("combines day of month and day of week as robfig/cron",
+		func(expr, from, next string) {
+			schedule, err := Parse(expr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule.Next(at(from))).To(Equal(at(next)))
+		},
+		Entry("wildcard day of month", "0 0 * * mon", "2024-05-01T00:00:00Z", "2024-05-06T00:00:00Z"),
+		Entry("question mark day of month", "0 0 ? * mon", "2024-05-01T00:00:00Z", "2024-05-06T00:00:00Z"),
+		Entry("wildcard day of month with step 1", "0 0 */1 * mon", "2024-05-01T00:00:00Z", "2024-05-06T00:00:00Z"),
+		Entry("list with wildcard day of month", "0 0 1,* * mon", "2024-05-01T00:00:00Z", "2024-05-06T00:00:00Z"),
+		Entry("wildcard day of month with step 2", "0 0 */2 * mon", "2024-05-01T00:00:00Z", "2024-05-03T00:00:00Z"),
+		Entry("wildcard day of week with step 1", "0 0 13 * */1", "2024-05-01T00:00:00Z", "2024-05-13T00:00:00Z"),
+		Entry("wildcard day of week with step 2", "0 0 13 * */2", "2024-05-01T00:00:00Z", "2024-05-02T00:00:00Z"),
+		Entry("restricted day of month and day of week", "0 0 13 * mon", "2024-05-01T00:00:00Z", "2024-05-06T00:00:00Z"),
+		Entry("full range of days of month", "0 0 1-31 * mon", "2024-05-01T00:00:00Z", "2024-05-02T00:00:00Z"),
+		Entry("full range of days of week", "0 0 13 * 0-6", "2024-05-01T00:00:00Z", "2024-05-02T00:00:00Z"),
+	)
+
+	It("returns zero time if the schedule never activates", func() {
+		schedule, err := Parse("0 0 30 2 *")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(schedule.Next(at("2024-01-01T00:00:00Z")).IsZero()).To(BeTrue())
+	})
+
+	DescribeTable("rejects invalid expressions",
+		func(expr string) {
+			_, err := Parse(expr)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("too few fields", "* * * *"),
+		Entry("out of range", "60 * * * *"),
+		Entry("reversed range", "0 5-2 * * *"),
+		Entry("zero step", "*/0 * * * *"),
+		Entry("unknown name", "0 0 * * funday"),
+		Entry("unknown macro", "@fortnightly"),
+	)
+})
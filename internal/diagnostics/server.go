@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package diagnostics serves pprof profiles and expvar runtime variables of the operator, so its memory and CPU
+// usage can be profiled in production. Callers are authorized with their Kubernetes bearer tokens against
+// the non-resource URL they request, the same way /debug/pprof/ of the API server is.
+package diagnostics
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/aenix-io/etcd-operator/internal/httpapi"
+)
+
+// Server serves diagnostics endpoints of the operator.
+type Server struct {
+	// BindAddress is the address the server listens on.
+	BindAddress string
+	// CertDir is the directory with tls.crt and tls.key serving certificate.
+	// Self-signed certificate is generated if it is empty.
+	CertDir string
+	// Client is used to review callers' tokens and permissions.
+	Client client.Client
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica is served to profile it.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+func (s *Server) Start(ctx context.Context) error {
+	return httpapi.Serve(ctx, s.BindAddress, s.CertDir, s.Handler())
+}
+
+// Handler returns the HTTP handler of pprof endpoints under /debug/pprof/ and expvar variables at /debug/vars.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	return s.authorize(mux)
+}
+
+// authorize allows only callers permitted to get the requested path.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, err := httpapi.AuthorizeNonResource(r.Context(), s.Client, r, authorizationv1.NonResourceAttributes{
+			Path: r.URL.Path,
+			Verb: "get",
+		})
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
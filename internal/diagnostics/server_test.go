@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnostics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("Diagnostics server", func() {
+	var (
+		server  *Server
+		checked *authorizationv1.NonResourceAttributes
+	)
+
+	BeforeEach(func() {
+		checked = nil
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		server = &Server{
+			Client: fake.NewClientBuilder().WithScheme(scheme).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+						switch review := obj.(type) {
+						case *authenticationv1.TokenReview:
+							review.Status.Authenticated = review.Spec.Token != "invalid-token"
+							review.Status.User.Username = review.Spec.Token
+						case *authorizationv1.SubjectAccessReview:
+							checked = review.Spec.NonResourceAttributes
+							review.Status.Allowed = review.Spec.User == "profiler"
+						}
+						return nil
+					},
+				}).Build(),
+		}
+	})
+
+	serve := func(ctx context.Context, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("should serve profiles and runtime variables to authorized callers", func(ctx SpecContext) {
+		rec := serve(ctx, "/debug/pprof/heap", "profiler")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(checked.Path).To(Equal("/debug/pprof/heap"))
+		Expect(checked.Verb).To(Equal("get"))
+
+		rec = serve(ctx, "/debug/vars", "profiler")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("memstats"))
+	})
+
+	It("should reject unauthorized callers", func(ctx SpecContext) {
+		Expect(serve(ctx, "/debug/pprof/heap", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(serve(ctx, "/debug/pprof/heap", "invalid-token").Code).To(Equal(http.StatusUnauthorized))
+		rec := serve(ctx, "/debug/vars", "viewer")
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(rec.Body.String()).To(ContainSubstring(`user "viewer" cannot get /debug/vars`))
+	})
+})
@@ -0,0 +1,208 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.etcd.io/etcd/api/v3/authpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// rootRole is the built-in etcd role granting all permissions.
+const rootRole = "root"
+
+// SetUserPassword creates the user with the password or changes the password of the existing user,
+// and grants the roles to the user. Requests are sent to the leader and retried while it is unavailable.
+func SetUserPassword(ctx context.Context, cli Client, name, password string, roles []string) error {
+	return OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		_, err := cli.UserAdd(ctx, name, password)
+		if errors.Is(err, rpctypes.ErrUserAlreadyExist) {
+			_, err = cli.UserChangePassword(ctx, name, password)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot set password of user %s: %w", name, err)
+		}
+		for _, role := range roles {
+			if role == rootRole {
+				if _, err = cli.RoleAdd(ctx, rootRole); err != nil && !errors.Is(err, rpctypes.ErrRoleAlreadyExist) {
+					return fmt.Errorf("cannot add role %s: %w", role, err)
+				}
+			}
+			if _, err = cli.UserGrantRole(ctx, name, role); err != nil {
+				return fmt.Errorf("cannot grant role %s to user %s: %w", role, name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// EnableAuth enables authentication if it is not enabled yet. The root user has to exist and have the root role.
+func EnableAuth(ctx context.Context, cli Client) error {
+	return OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		status, err := cli.AuthStatus(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot get auth status: %w", err)
+		}
+		if status.Enabled {
+			return nil
+		}
+		if _, err = cli.AuthEnable(ctx); err != nil {
+			return fmt.Errorf("cannot enable auth: %w", err)
+		}
+		return nil
+	})
+}
+
+// ReadOnlyRole is the role granted to users in place of their roles while the cluster is read-only.
+// It permits reading all keys.
+const ReadOnlyRole = "etcd-operator-read-only"
+
+// UsersRoles returns roles of all users except root keyed by user names.
+func UsersRoles(ctx context.Context, cli Client) (map[string][]string, error) {
+	users := map[string][]string{}
+	err := OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		list, err := cli.UserList(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot list users: %w", err)
+		}
+		for _, name := range list.Users {
+			if name == rootRole {
+				continue
+			}
+			user, err := cli.UserGet(ctx, name)
+			if err != nil {
+				return fmt.Errorf("cannot get user %s: %w", name, err)
+			}
+			users[name] = user.Roles
+		}
+		return nil
+	})
+	return users, err
+}
+
+// FreezeUser grants the read-only role to the user and revokes the roles from it, so the user can't write anymore.
+// The read-only role is created if it does not exist.
+func FreezeUser(ctx context.Context, cli Client, name string, roles []string) error {
+	return OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		_, err := cli.RoleAdd(ctx, ReadOnlyRole)
+		if err == nil {
+			// the whole key space, as granted by etcdctl for the empty prefix
+			_, err = cli.RoleGrantPermission(ctx, ReadOnlyRole, "\x00", "\x00", clientv3.PermissionType(clientv3.PermRead))
+		}
+		if err != nil && !errors.Is(err, rpctypes.ErrRoleAlreadyExist) {
+			return fmt.Errorf("cannot add role %s: %w", ReadOnlyRole, err)
+		}
+		if _, err = cli.UserGrantRole(ctx, name, ReadOnlyRole); err != nil {
+			return fmt.Errorf("cannot grant role %s to user %s: %w", ReadOnlyRole, name, err)
+		}
+		for _, role := range roles {
+			_, err = cli.UserRevokeRole(ctx, name, role)
+			if err != nil && !errors.Is(err, rpctypes.ErrRoleNotGranted) {
+				return fmt.Errorf("cannot revoke role %s from user %s: %w", role, name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ThawUser grants the roles back to the user and revokes the read-only role from it.
+// Roles and users deleted in the meantime are skipped.
+func ThawUser(ctx context.Context, cli Client, name string, roles []string) error {
+	return OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		found, err := grantRoles(ctx, cli, name, roles)
+		if err != nil || !found {
+			return err
+		}
+		_, err = cli.UserRevokeRole(ctx, name, ReadOnlyRole)
+		if err != nil && !errors.Is(err, rpctypes.ErrRoleNotGranted) && !errors.Is(err, rpctypes.ErrUserNotFound) {
+			return fmt.Errorf("cannot revoke role %s from user %s: %w", ReadOnlyRole, name, err)
+		}
+		return nil
+	})
+}
+
+// GrantRoles grants the roles back to the user without revoking the read-only role from it.
+// Roles and users deleted in the meantime are skipped.
+func GrantRoles(ctx context.Context, cli Client, name string, roles []string) error {
+	return OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		_, err := grantRoles(ctx, cli, name, roles)
+		return err
+	})
+}
+
+// grantRoles grants the roles to the user skipping deleted roles. It returns false if the user does not exist.
+func grantRoles(ctx context.Context, cli Client, name string, roles []string) (bool, error) {
+	for _, role := range roles {
+		_, err := cli.UserGrantRole(ctx, name, role)
+		if errors.Is(err, rpctypes.ErrUserNotFound) {
+			return false, nil
+		}
+		if err != nil && !errors.Is(err, rpctypes.ErrRoleNotFound) {
+			return false, fmt.Errorf("cannot grant role %s to user %s: %w", role, name, err)
+		}
+	}
+	return true, nil
+}
+
+// WritingRoles returns those of the roles that permit writes of any key under the prefixes, in the order of roles.
+// The root role permits all writes. Roles deleted in the meantime are skipped.
+func WritingRoles(ctx context.Context, cli Client, roles, prefixes []string) ([]string, error) {
+	var writing []string
+	err := OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		writing = nil
+		for _, role := range roles {
+			if role == rootRole {
+				writing = append(writing, role)
+				continue
+			}
+			resp, err := cli.RoleGet(ctx, role)
+			if errors.Is(err, rpctypes.ErrRoleNotFound) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("cannot get role %s: %w", role, err)
+			}
+			if slices.ContainsFunc(resp.Perm, func(perm *authpb.Permission) bool {
+				return perm.PermType != authpb.READ && slices.ContainsFunc(prefixes, func(prefix string) bool {
+					return overlapsPrefix(perm, prefix)
+				})
+			}) {
+				writing = append(writing, role)
+			}
+		}
+		return nil
+	})
+	return writing, err
+}
+
+// overlapsPrefix checks if the permission covers any key under the prefix.
+func overlapsPrefix(perm *authpb.Permission, prefix string) bool {
+	if len(perm.RangeEnd) == 0 {
+		return bytes.HasPrefix(perm.Key, []byte(prefix))
+	}
+	// the range end of "\x00" means all keys from the key, for the permission and the prefix of "\xff" bytes alike
+	fromKey := []byte{0}
+	prefixEnd := []byte(clientv3.GetPrefixRangeEnd(prefix))
+	return (bytes.Equal(prefixEnd, fromKey) || bytes.Compare(perm.Key, prefixEnd) < 0) &&
+		(bytes.Equal(perm.RangeEnd, fromKey) || bytes.Compare([]byte(prefix), perm.RangeEnd) < 0)
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// Client is the etcd client the operator talks to clusters with. It is implemented by *clientv3.Client, clients
+// created by another factory, e.g. an in-memory fake, have to implement it too, see ConfigureClientFactory.
+type Client interface {
+	clientv3.Cluster
+	clientv3.KV
+	clientv3.Maintenance
+	clientv3.Auth
+	// Endpoints returns endpoints requests are balanced across.
+	Endpoints() []string
+	// SetEndpoints replaces endpoints requests are balanced across.
+	SetEndpoints(endpoints ...string)
+	// Ctx returns the context of the client, it is canceled once the client is closed.
+	Ctx() context.Context
+	Close() error
+}
+
+// ClientFactory creates etcd clients connected to endpoints of the configuration.
+type ClientFactory func(cfg clientv3.Config) (Client, error)
+
+var clientFactory = newGRPCClient
+
+// ConfigureClientFactory replaces the factory of etcd clients of all clusters, so controllers can be run against
+// fake clusters. Nil restores the default factory connecting to members. It has to be called before controllers
+// are started.
+func ConfigureClientFactory(factory ClientFactory) {
+	if factory == nil {
+		factory = newGRPCClient
+	}
+	clientFactory = factory
+}
+
+// newGRPCClient is the default client factory connecting to members over gRPC.
+func newGRPCClient(cfg clientv3.Config) (Client, error) {
+	cli, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+// ClientEndpoints returns client URLs of all cluster members.
+func ClientEndpoints(cluster *etcdaenixiov1alpha1.EtcdCluster) []string {
+	endpoints := make([]string, 0, *cluster.Spec.Replicas)
+	for _, member := range cluster.Members() {
+		endpoints = append(endpoints, member.ClientURL)
+	}
+	return endpoints
+}
+
+// ClientEndpoint returns client URL of the member with the given name.
+func ClientEndpoint(cluster *etcdaenixiov1alpha1.EtcdCluster, memberName string) string {
+	return cluster.Member(memberName).ClientURL
+}
+
+// PeerURL returns peer URL of the member with the given name.
+func PeerURL(cluster *etcdaenixiov1alpha1.EtcdCluster, memberName string) string {
+	return cluster.Member(memberName).PeerURL
+}
+
+// NewClusterClient creates etcd client connected to all members of the cluster.
+// Client certificate and trusted CA are read from secrets referenced in cluster security spec.
+// If auth is managed by the operator, the client authenticates as the root user.
+// Caller is responsible for closing the returned client.
+func NewClusterClient(
+	ctx context.Context,
+	rclient client.Reader,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+) (Client, error) {
+	tlsConfig, err := clientTLSConfig(ctx, rclient, cluster)
+	if err != nil {
+		return nil, err
+	}
+	passwords, err := rootPasswords(ctx, rclient, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if len(passwords) == 0 {
+		return newClient(ctx, cluster, tlsConfig, "", "")
+	}
+	return newClientWithPasswords(ctx, cluster, tlsConfig, etcdaenixiov1alpha1.RootUser, passwords)
+}
+
+// NewClusterClientFromSecret creates etcd client connected to all members of the cluster, which authenticates
+// with the username and password stored in the given credentials Secret of the cluster namespace.
+// Caller is responsible for closing the returned client.
+func NewClusterClientFromSecret(
+	ctx context.Context,
+	rclient client.Reader,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	secretName string,
+) (Client, error) {
+	secret := &corev1.Secret{}
+	if err := rclient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: secretName}, secret); err != nil {
+		return nil, fmt.Errorf("cannot get credentials secret %s: %w", secretName, err)
+	}
+	username := string(secret.Data[corev1.BasicAuthUsernameKey])
+	if username == "" {
+		return nil, fmt.Errorf("credentials secret %s has no %s", secretName, corev1.BasicAuthUsernameKey)
+	}
+	tlsConfig, err := clientTLSConfig(ctx, rclient, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return newClientWithPasswords(ctx, cluster, tlsConfig, username, SecretPasswords(secret))
+}
+
+// NewClusterClientAs creates etcd client connected to all members of the cluster, which authenticates
+// as the given user. Caller is responsible for closing the returned client.
+func NewClusterClientAs(
+	ctx context.Context,
+	rclient client.Reader,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	username, password string,
+) (Client, error) {
+	tlsConfig, err := clientTLSConfig(ctx, rclient, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(ctx, cluster, tlsConfig, username, password)
+}
+
+// newClientWithPasswords tries passwords of the user in order until authentication does not fail:
+// while a password is being rotated, the new one may be set in etcd already.
+func newClientWithPasswords(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	tlsConfig *tls.Config,
+	username string,
+	passwords []string,
+) (cli Client, err error) {
+	for _, password := range passwords {
+		cli, err = newClient(ctx, cluster, tlsConfig, username, password)
+		if !errors.Is(err, rpctypes.ErrAuthFailed) {
+			break
+		}
+	}
+	return cli, err
+}
+
+func newClient(
+	ctx context.Context,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	tlsConfig *tls.Config,
+	username, password string,
+) (Client, error) {
+	policy := newAPIPolicy(cluster)
+	// only requests take the probe of the half-open circuit, see unaryInterceptor
+	if err := policy.check(); err != nil {
+		return nil, err
+	}
+	cfg := &clientv3.Config{
+		Endpoints:       ClientEndpoints(cluster),
+		DialTimeout:     policy.dialTimeout,
+		DialOptions:     []grpc.DialOption{grpc.WithChainUnaryInterceptor(policy.unaryInterceptor)},
+		MaxUnaryRetries: policy.unaryAttempts,
+		TLS:             tlsConfig,
+		Username:        username,
+		Password:        password,
+		Logger:          zap.NewNop(),
+	}
+	// the configuration is kept in the context of the client to create clients bound to its members, see memberClient
+	cfg.Context = context.WithValue(context.WithValue(ctx, policyKey{}, policy), configKey{}, cfg)
+	return clientFactory(*cfg)
+}
+
+// configKey is the context key of the configuration a client is created with.
+type configKey struct{}
+
+// memberClient creates a client with the configuration of the given client, which sends requests only to the member
+// serving the endpoint. Each unary request is limited by the member timeout. Caller is responsible for closing
+// the returned client.
+func memberClient(cli Client, endpoint string) (Client, error) {
+	cfg, ok := cli.Ctx().Value(configKey{}).(*clientv3.Config)
+	if !ok {
+		return nil, errors.New("client is not created for a cluster, requests can't be sent to its members")
+	}
+	memberCfg := *cfg
+	memberCfg.Endpoints = []string{endpoint}
+	memberCfg.DialOptions = append(slices.Clip(cfg.DialOptions),
+		grpc.WithChainUnaryInterceptor(policyOf(cli).memberInterceptor))
+	return clientFactory(memberCfg)
+}
+
+// ServiceCABundleKey is the key the OpenShift service CA bundle is injected under.
+const ServiceCABundleKey = "service-ca.crt"
+
+// clientTLSConfig builds TLS configuration for operator's etcd client or returns nil if cluster does not serve TLS.
+func clientTLSConfig(
+	ctx context.Context,
+	rclient client.Reader,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+) (*tls.Config, error) {
+	if cluster.Spec.Security == nil || cluster.Spec.Security.TLS.ServerSecret == "" {
+		return nil, nil
+	}
+	tlsSpec := cluster.Spec.Security.TLS
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	serverSecret := &corev1.Secret{}
+	if err := rclient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: tlsSpec.ServerSecret}, serverSecret); err != nil {
+		return nil, fmt.Errorf("cannot get server certificate secret: %w", err)
+	}
+	if ca, ok := serverSecret.Data["ca.crt"]; ok {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("cannot parse ca.crt from secret %s", tlsSpec.ServerSecret)
+		}
+		tlsConfig.RootCAs = pool
+	} else if cluster.ServiceCAEnabled() {
+		// certificates issued by the OpenShift service CA come without the CA, which is injected into a ConfigMap
+		bundle := &corev1.ConfigMap{}
+		name := cluster.ServiceCABundleConfigMap()
+		if err := rclient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, bundle); err != nil {
+			return nil, fmt.Errorf("cannot get service CA bundle configmap: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(bundle.Data[ServiceCABundleKey])) {
+			return nil, fmt.Errorf("cannot parse %s from configmap %s", ServiceCABundleKey, name)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if tlsSpec.ClientSecret != "" {
+		clientSecret := &corev1.Secret{}
+		if err := rclient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: tlsSpec.ClientSecret}, clientSecret); err != nil {
+			return nil, fmt.Errorf("cannot get client certificate secret: %w", err)
+		}
+		cert, err := tls.X509KeyPair(clientSecret.Data[corev1.TLSCertKey], clientSecret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse client certificate from secret %s: %w", tlsSpec.ClientSecret, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// PreviousPasswordKey is the key of the password replaced by rotation in a credentials Secret.
+// It is kept until the new password is set in etcd.
+const PreviousPasswordKey = "previous-password"
+
+// rootPasswords returns passwords of the root user the operator authenticates with if auth is managed
+// by the operator. While a new root password is not known to be set in etcd, the previous password is returned
+// first. No passwords are returned if credentials are not generated yet, since auth is not enabled then.
+func rootPasswords(ctx context.Context, rclient client.Reader, cluster *etcdaenixiov1alpha1.EtcdCluster) ([]string, error) {
+	if cluster.Spec.Security == nil || cluster.Spec.Security.Auth == nil {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	err := rclient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.RootCredentialsSecret()}, secret)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get root credentials secret: %w", err)
+	}
+	return SecretPasswords(secret), nil
+}
+
+// SecretPasswords returns passwords stored in the credentials Secret. While the password is not known
+// to be set in etcd, the previous password is returned first.
+func SecretPasswords(secret *corev1.Secret) []string {
+	passwords := []string{string(secret.Data[corev1.BasicAuthPasswordKey])}
+	if previous, ok := secret.Data[PreviousPasswordKey]; ok &&
+		secret.Annotations[etcdaenixiov1alpha1.CredentialsAppliedAnnotation] != "true" {
+		passwords = append([]string{string(previous)}, passwords...)
+	}
+	return passwords
+}
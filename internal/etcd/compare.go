@@ -0,0 +1,119 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const digestPageSize = 1000
+
+// PrefixDigest summarizes keys under a prefix of a single cluster.
+type PrefixDigest struct {
+	// Values contains sha256 of the value of every key under the prefix.
+	Values map[string][sha256.Size]byte
+	// Revision is the latest modification revision of the keys.
+	Revision int64
+}
+
+// Hash returns a hash over all keys and values of the digest, which is equal for identical prefixes.
+func (d *PrefixDigest) Hash() string {
+	keys := make([]string, 0, len(d.Values))
+	for key := range d.Values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		value := d.Values[key]
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write(value[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GetPrefixDigest reads all keys under the prefix page by page, consistently at a single revision.
+func GetPrefixDigest(ctx context.Context, cli Client, prefix string) (*PrefixDigest, error) {
+	digest := &PrefixDigest{Values: map[string][sha256.Size]byte{}}
+	end := clientv3.GetPrefixRangeEnd(prefix)
+	key := prefix
+	var revision int64
+	for {
+		opts := []clientv3.OpOption{clientv3.WithRange(end), clientv3.WithLimit(digestPageSize)}
+		if revision != 0 {
+			opts = append(opts, clientv3.WithRev(revision))
+		}
+		resp, err := cli.Get(ctx, key, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get keys with prefix %s: %w", prefix, err)
+		}
+		if revision == 0 {
+			revision = resp.Header.Revision
+		}
+		for _, kv := range resp.Kvs {
+			digest.Values[string(kv.Key)] = sha256.Sum256(kv.Value)
+			digest.Revision = max(digest.Revision, kv.ModRevision)
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return digest, nil
+		}
+		// continue right after the last returned key
+		key = string(append(resp.Kvs[len(resp.Kvs)-1].Key, 0))
+	}
+}
+
+// PrefixDiff is the difference between digests of the same prefix in two clusters.
+type PrefixDiff struct {
+	// Missing is the number of source keys absent in the destination.
+	Missing int64
+	// Extra is the number of destination keys absent in the source.
+	Extra int64
+	// Different is the number of keys with different values.
+	Different int64
+}
+
+// InSync reports whether the digests are identical.
+func (d PrefixDiff) InSync() bool {
+	return d.Missing == 0 && d.Extra == 0 && d.Different == 0
+}
+
+// DiffDigests compares digests of the same prefix in the source and destination clusters.
+func DiffDigests(source, destination *PrefixDigest) PrefixDiff {
+	diff := PrefixDiff{}
+	for key, value := range source.Values {
+		other, ok := destination.Values[key]
+		switch {
+		case !ok:
+			diff.Missing++
+		case other != value:
+			diff.Different++
+		}
+	}
+	for key := range destination.Values {
+		if _, ok := source.Values[key]; !ok {
+			diff.Extra++
+		}
+	}
+	return diff
+}
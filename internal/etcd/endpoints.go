@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"k8s.io/client-go/util/retry"
+)
+
+// MemberError is an error returned by a single member.
+type MemberError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e MemberError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Endpoint, e.Err)
+}
+
+func (e MemberError) Unwrap() error {
+	return e.Err
+}
+
+// MemberErrors is a list of errors returned by members, none of which could serve the request.
+type MemberErrors []MemberError
+
+func (e MemberErrors) Error() string {
+	if len(e) == 0 {
+		return "no members to send the request to"
+	}
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// OnAnyMember calls fn with a client bound to every member of the client endpoints in turn until one of the calls
+// succeeds, so the request is served while at least one member is available. Each request fn sends is limited
+// by the member timeout. If all calls fail, MemberErrors with the error of every member is returned.
+func OnAnyMember(ctx context.Context, cli Client, fn func(ctx context.Context, member Client) error) error {
+	var errs MemberErrors
+	for _, endpoint := range cli.Endpoints() {
+		if err := callEndpoint(ctx, cli, endpoint, fn); err != nil {
+			errs = append(errs, MemberError{Endpoint: endpoint, Err: err})
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		return nil
+	}
+	return errs
+}
+
+// OnLeader calls fn with a client bound to the cluster leader. Mutating requests are served by the leader anyway,
+// so sending them there directly saves forwarding and fails fast if there is no leader. Each request fn sends
+// is limited by the member timeout. The call is retried while the leader cannot be found or does not respond,
+// fn has to be idempotent.
+func OnLeader(ctx context.Context, cli Client, fn func(ctx context.Context, leader Client) error) error {
+	return retry.OnError(policyOf(cli).leaderBackoff, func(error) bool { return ctx.Err() == nil }, func() error {
+		leader, err := leaderEndpoint(ctx, cli)
+		if err != nil {
+			return err
+		}
+		if err = callEndpoint(ctx, cli, leader, fn); err != nil {
+			return MemberError{Endpoint: leader, Err: err}
+		}
+		return nil
+	})
+}
+
+// leaderEndpoint returns the endpoint of the member which is the cluster leader
+// as seen by members responding to status requests.
+func leaderEndpoint(ctx context.Context, cli Client) (string, error) {
+	var errs MemberErrors
+	for _, endpoint := range cli.Endpoints() {
+		resp, err := endpointStatus(ctx, cli, endpoint)
+		if err != nil {
+			errs = append(errs, MemberError{Endpoint: endpoint, Err: err})
+			continue
+		}
+		if resp.Leader != 0 && resp.Leader == resp.Header.MemberId {
+			return endpoint, nil
+		}
+	}
+	if len(errs) > 0 {
+		return "", fmt.Errorf("cannot find cluster leader: %w", errs)
+	}
+	return "", errors.New("cluster has no leader")
+}
+
+// endpointStatus requests the status of the member serving the endpoint.
+func endpointStatus(ctx context.Context, cli Client, endpoint string) (*clientv3.StatusResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, policyOf(cli).memberTimeout)
+	defer cancel()
+	return cli.Status(ctx, endpoint)
+}
+
+// callEndpoint calls fn with a client bound to the member serving the endpoint. The client is closed afterwards.
+func callEndpoint(ctx context.Context, cli Client, endpoint string, fn func(ctx context.Context, member Client) error) error {
+	member, err := memberClient(cli, endpoint)
+	if err != nil {
+		return err
+	}
+	defer member.Close()
+	return fn(ctx, member)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Tests of this file run against the fake cluster of the etcdclienttest package, which imports this package.
+package etcd_test
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+	"github.com/aenix-io/etcd-operator/pkg/etcdclient/etcdclienttest"
+)
+
+var _ = Describe("Member endpoints", func() {
+	var (
+		ctx       context.Context
+		cluster   *etcdaenixiov1alpha1.EtcdCluster
+		fakeEtcd  *etcdclienttest.Cluster
+		cli       etcd.Client
+		endpoints []string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := runtime.NewScheme()
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(3)),
+				EtcdAPI:  &etcdaenixiov1alpha1.EtcdAPISpec{MaxRetries: ptr.To(int32(0))},
+			},
+		}
+		fakeEtcd = etcdclienttest.NewClusterFor(cluster)
+		etcd.ConfigureClientFactory(etcdclienttest.NewFactory(fakeEtcd))
+		DeferCleanup(func() {
+			etcd.ConfigureClientFactory(nil)
+		})
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).Build()
+
+		var err error
+		cli, err = etcd.NewClusterClient(ctx, reader, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(cli.Close)
+		endpoints = etcd.ClientEndpoints(cluster)
+	})
+
+	It("sends requests to the first available member", func() {
+		Expect(fakeEtcd.StopMember("test-0")).To(Succeed())
+
+		var served []string
+		err := etcd.OnAnyMember(ctx, cli, func(ctx context.Context, member etcd.Client) error {
+			served = member.Endpoints()
+			_, err := member.MemberList(ctx)
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(served).To(Equal(endpoints[1:2]))
+		Expect(cli.Endpoints()).To(Equal(endpoints))
+	})
+
+	It("returns errors of all members if none is available", func() {
+		for _, name := range []string{"test-0", "test-1", "test-2"} {
+			Expect(fakeEtcd.StopMember(name)).To(Succeed())
+		}
+		err := etcd.OnAnyMember(ctx, cli, func(ctx context.Context, member etcd.Client) error {
+			_, err := member.MemberList(ctx)
+			return err
+		})
+		var errs etcd.MemberErrors
+		Expect(err).To(BeAssignableToTypeOf(errs))
+		Expect(err.(etcd.MemberErrors)).To(HaveLen(3))
+	})
+
+	It("sends requests to the leader", func() {
+		Expect(fakeEtcd.SetLeader("test-2")).To(Succeed())
+
+		var served []string
+		err := etcd.OnLeader(ctx, cli, func(ctx context.Context, leader etcd.Client) error {
+			served = leader.Endpoints()
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(served).To(Equal(endpoints[2:3]))
+	})
+
+	It("fails without leader", func() {
+		Expect(fakeEtcd.StopMember("test-0")).To(Succeed())
+		Expect(fakeEtcd.StopMember("test-1")).To(Succeed())
+		err := etcd.OnLeader(ctx, cli, func(context.Context, etcd.Client) error {
+			Fail("request sent without leader")
+			return nil
+		})
+		Expect(err).To(MatchError(ContainSubstring("cannot find cluster leader")))
+	})
+
+	It("does not change endpoints of the client shared by concurrent requests", func() {
+		Expect(fakeEtcd.SetLeader("test-1")).To(Succeed())
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(etcd.OnLeader(ctx, cli, func(ctx context.Context, leader etcd.Client) error {
+					Expect(leader.Endpoints()).To(Equal(endpoints[1:2]))
+					_, err := leader.MemberList(ctx)
+					return err
+				})).To(Succeed())
+			}()
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(etcd.OnAnyMember(ctx, cli, func(ctx context.Context, member etcd.Client) error {
+					Expect(member.Endpoints()).To(Equal(endpoints[:1]))
+					_, err := cli.Get(ctx, "/")
+					return err
+				})).To(Succeed())
+			}()
+		}
+		wg.Wait()
+		Expect(cli.Endpoints()).To(Equal(endpoints))
+	})
+
+	It("replaces members with several requests to the leader", func() {
+		Expect(etcd.ReplaceMember(ctx, cli, cluster.Member("test-2").PeerURL)).To(Succeed())
+		members := fakeEtcd.Members()
+		Expect(members).To(HaveLen(3))
+		Expect(members[2].Name).To(BeEmpty())
+		Expect(members[2].PeerURLs).To(Equal([]string{cluster.Member("test-2").PeerURL}))
+	})
+})
@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// HealthyMembers returns the number of members which respond to status requests and see the cluster leader.
+// Error is returned only if the client cannot be configured, unreachable members are counted as unhealthy.
+func HealthyMembers(ctx context.Context, rclient client.Reader, cluster *etcdaenixiov1alpha1.EtcdCluster) (int, error) {
+	unhealthy, err := UnhealthyMembers(ctx, rclient, cluster)
+	if err != nil {
+		return 0, err
+	}
+	return int(*cluster.Spec.Replicas) - len(unhealthy), nil
+}
+
+// UnhealthyMembers checks every member separately and returns the reason each unhealthy member is unhealthy for.
+// Members are probed in parallel up to the probe parallelism of the cluster. Error is returned only if the client
+// cannot be configured.
+func UnhealthyMembers(ctx context.Context, rclient client.Reader, cluster *etcdaenixiov1alpha1.EtcdCluster) (MemberErrors, error) {
+	tlsConfig, err := clientTLSConfig(ctx, rclient, cluster)
+	if err != nil {
+		return nil, err
+	}
+	// probes are not rejected by the circuit breaker, they tell when members are available again
+	timeout := newAPIPolicy(cluster).memberTimeout
+	endpoints := ClientEndpoints(cluster)
+	errs := make([]error, len(endpoints))
+	slots := make(chan struct{}, cluster.ProbeParallelism())
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			errs[i] = Probe(ctx, func(ctx context.Context) error {
+				return checkEndpointHealth(ctx, endpoint, tlsConfig, timeout)
+			})
+		}()
+	}
+	wg.Wait()
+
+	var unhealthy MemberErrors
+	for i, endpoint := range endpoints {
+		if errs[i] != nil {
+			unhealthy = append(unhealthy, MemberError{Endpoint: endpoint, Err: errs[i]})
+		}
+	}
+	return unhealthy, nil
+}
+
+func checkEndpointHealth(ctx context.Context, endpoint string, tlsConfig *tls.Config, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cli, err := clientFactory(clientv3.Config{
+		Endpoints:   []string{endpoint},
+		DialTimeout: timeout,
+		TLS:         tlsConfig,
+		Context:     ctx,
+		Logger:      zap.NewNop(),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+
+	resp, err := cli.Status(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	if resp.Leader == 0 {
+		return errors.New("member has no leader")
+	}
+	return nil
+}
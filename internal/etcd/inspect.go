@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// EndpointStatus is the status of a single member as returned by `etcdctl endpoint status`.
+type EndpointStatus struct {
+	Endpoint    string   `json:"endpoint"`
+	MemberID    string   `json:"memberID,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	DBSize      int64    `json:"dbSize,omitempty"`
+	DBSizeInUse int64    `json:"dbSizeInUse,omitempty"`
+	IsLeader    bool     `json:"isLeader"`
+	IsLearner   bool     `json:"isLearner"`
+	RaftTerm    uint64   `json:"raftTerm,omitempty"`
+	RaftIndex   uint64   `json:"raftIndex,omitempty"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// Member is a cluster member as returned by `etcdctl member list`.
+type Member struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs"`
+	IsLearner  bool     `json:"isLearner"`
+}
+
+// Alarm is an active alarm as returned by `etcdctl alarm list`.
+type Alarm struct {
+	MemberID string `json:"memberID"`
+	Alarm    string `json:"alarm"`
+}
+
+func formatID(id uint64) string {
+	return fmt.Sprintf("%x", id)
+}
+
+// GetEndpointStatus returns status of every cluster endpoint. Unreachable endpoints are reported with an error
+// instead of failing the whole request.
+func GetEndpointStatus(ctx context.Context, cli Client) []EndpointStatus {
+	endpoints := cli.Endpoints()
+	statuses := make([]EndpointStatus, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		status := EndpointStatus{Endpoint: endpoint}
+		resp, err := cli.Status(ctx, endpoint)
+		if err != nil {
+			status.Errors = []string{err.Error()}
+			statuses = append(statuses, status)
+			continue
+		}
+		status.MemberID = formatID(resp.Header.MemberId)
+		status.Version = resp.Version
+		status.DBSize = resp.DbSize
+		status.DBSizeInUse = resp.DbSizeInUse
+		status.IsLeader = resp.Header.MemberId == resp.Leader
+		status.IsLearner = resp.IsLearner
+		status.RaftTerm = resp.RaftTerm
+		status.RaftIndex = resp.RaftIndex
+		status.Errors = resp.Errors
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// ListMembers returns members of the cluster as seen by the first member responding to the request.
+func ListMembers(ctx context.Context, cli Client) ([]Member, error) {
+	var resp *clientv3.MemberListResponse
+	err := OnAnyMember(ctx, cli, func(ctx context.Context, cli Client) (err error) {
+		resp, err = cli.MemberList(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list members: %w", err)
+	}
+	members := make([]Member, 0, len(resp.Members))
+	for _, m := range resp.Members {
+		members = append(members, Member{
+			ID:         formatID(m.ID),
+			Name:       m.Name,
+			PeerURLs:   m.PeerURLs,
+			ClientURLs: m.ClientURLs,
+			IsLearner:  m.IsLearner,
+		})
+	}
+	return members, nil
+}
+
+// ListAlarms returns active alarms of the cluster.
+func ListAlarms(ctx context.Context, cli Client) ([]Alarm, error) {
+	resp, err := cli.AlarmList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list alarms: %w", err)
+	}
+	alarms := make([]Alarm, 0, len(resp.Alarms))
+	for _, a := range resp.Alarms {
+		alarms = append(alarms, Alarm{
+			MemberID: formatID(a.MemberID),
+			Alarm:    etcdserverpb.AlarmType_name[int32(a.Alarm)],
+		})
+	}
+	return alarms, nil
+}
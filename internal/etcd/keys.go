@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// SyncResult describes changes made by SyncKeys.
+type SyncResult struct {
+	// Written is the number of created or updated keys.
+	Written int
+	// Pruned is the number of deleted keys.
+	Pruned int
+}
+
+// SyncKeys writes the desired keys, which must all be under the prefix, and deletes other keys under the prefix
+// if prune is set. Keys which already have the desired value are not written, so their revision does not change.
+func SyncKeys(ctx context.Context, cli Client, prefix string, desired map[string]string, prune bool) (SyncResult, error) {
+	result := SyncResult{}
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return result, fmt.Errorf("cannot get keys with prefix %s: %w", prefix, err)
+	}
+	current := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		current[string(kv.Key)] = string(kv.Value)
+	}
+
+	for key, value := range desired {
+		if existing, ok := current[key]; ok && existing == value {
+			continue
+		}
+		if _, err = cli.Put(ctx, key, value); err != nil {
+			return result, fmt.Errorf("cannot put key %s: %w", key, err)
+		}
+		result.Written++
+	}
+	if !prune {
+		return result, nil
+	}
+	for key := range current {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		if _, err = cli.Delete(ctx, key); err != nil {
+			return result, fmt.Errorf("cannot delete key %s: %w", key, err)
+		}
+		result.Pruned++
+	}
+	return result, nil
+}
+
+// DeletePrefix deletes all keys under the prefix.
+func DeletePrefix(ctx context.Context, cli Client, prefix string) error {
+	if _, err := cli.Delete(ctx, prefix, clientv3.WithPrefix()); err != nil {
+		return fmt.Errorf("cannot delete keys with prefix %s: %w", prefix, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// defragmentTimeout limits defragmentation of a single member, which blocks the member while it rewrites
+	// the whole database.
+	defragmentTimeout = 5 * time.Minute
+)
+
+// Defragment defragments members serving the given endpoints one by one in the given order,
+// so at most one member is blocked at a time. It stops at the first member which fails.
+func Defragment(ctx context.Context, cli Client, endpoints []string) error {
+	for _, endpoint := range endpoints {
+		if err := defragmentEndpoint(ctx, cli, endpoint); err != nil {
+			return MemberError{Endpoint: endpoint, Err: err}
+		}
+	}
+	return nil
+}
+
+func defragmentEndpoint(ctx context.Context, cli Client, endpoint string) error {
+	ctx, cancel := context.WithTimeout(ctx, defragmentTimeout)
+	defer cancel()
+	_, err := cli.Defragment(ctx, endpoint)
+	return err
+}
+
+// Compact compacts the key-value history of the cluster up to the given revision or the current one if revision
+// is not positive. It returns the revision the history is compacted at. Compacting at a revision which is already
+// compacted succeeds.
+func Compact(ctx context.Context, cli Client, revision int64) (int64, error) {
+	var current int64
+	err := OnAnyMember(ctx, cli, func(ctx context.Context, cli Client) error {
+		resp, err := cli.Get(ctx, "/", clientv3.WithCountOnly())
+		if err != nil {
+			return err
+		}
+		current = resp.Header.Revision
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot get current revision: %w", err)
+	}
+	if revision <= 0 {
+		revision = current
+	}
+	if revision > current {
+		return 0, fmt.Errorf("revision %d is newer than the current revision %d", revision, current)
+	}
+
+	err = OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		_, err := cli.Compact(ctx, revision)
+		if errors.Is(err, rpctypes.ErrCompacted) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot compact at revision %d: %w", revision, err)
+	}
+	return revision, nil
+}
+
+// MoveLeader transfers leadership to the started voting member with the given name, or to any other such member
+// if the name is empty. It returns the name of the leader afterwards.
+func MoveLeader(ctx context.Context, cli Client, memberName string) (string, error) {
+	leader, err := LeaderName(ctx, cli)
+	if err != nil {
+		return "", err
+	}
+	if memberName == "" {
+		return MoveLeaderAway(ctx, cli, []string{leader})
+	}
+	if memberName == leader {
+		return leader, nil
+	}
+
+	var resp *clientv3.MemberListResponse
+	err = OnAnyMember(ctx, cli, func(ctx context.Context, cli Client) (err error) {
+		resp, err = cli.MemberList(ctx)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot list members: %w", err)
+	}
+	idx := slices.IndexFunc(resp.Members, func(m *etcdserverpb.Member) bool { return m.Name == memberName })
+	if idx == -1 {
+		return "", fmt.Errorf("member %s is not started", memberName)
+	}
+	if resp.Members[idx].IsLearner {
+		return "", fmt.Errorf("member %s is a learner", memberName)
+	}
+	target := resp.Members[idx]
+
+	// leadership can be moved only by the request sent to the leader
+	err = OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		_, err := cli.MoveLeader(ctx, target.ID)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot move leadership from %s to %s: %w", leader, target.Name, err)
+	}
+	return target.Name, nil
+}
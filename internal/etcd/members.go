@@ -0,0 +1,239 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ReplaceMember removes the member with the given peer URL from the cluster membership and registers it again,
+// so that the member can rejoin the cluster with an empty data directory.
+// The operation is idempotent: a member that is already registered but has not started yet is left untouched.
+// Requests are sent to the leader and retried while it is unavailable.
+func ReplaceMember(ctx context.Context, cli Client, peerURL string) error {
+	return OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		resp, err := cli.MemberList(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot list members: %w", err)
+		}
+
+		member := findMemberByPeerURL(resp.Members, peerURL)
+		if member != nil && member.Name == "" {
+			// member is already re-registered and waits for the new instance to start
+			return nil
+		}
+		if member != nil {
+			if _, err := cli.MemberRemove(ctx, member.ID); err != nil {
+				return fmt.Errorf("cannot remove member %s: %w", member.Name, err)
+			}
+		}
+		if _, err := cli.MemberAdd(ctx, []string{peerURL}); err != nil {
+			return fmt.Errorf("cannot add member with peer url %s: %w", peerURL, err)
+		}
+		return nil
+	})
+}
+
+// ScaleMembership makes the cluster membership match members with the given peer URLs. Missing members are added
+// as learners, so they don't count towards quorum until they catch up with the leader, see PromoteLearners.
+// etcd allows a single learner at a time, so only the first missing member is added, and only once no learner
+// waits for promotion. Other members are removed after leadership is moved away from them.
+// It returns true if no more members are left to add, otherwise it has to be called again once the learner
+// is promoted. Requests are sent to the leader and retried while it is unavailable.
+func ScaleMembership(ctx context.Context, cli Client, peerURLs []string) (bool, error) {
+	var resp *clientv3.MemberListResponse
+	err := OnAnyMember(ctx, cli, func(ctx context.Context, cli Client) (err error) {
+		resp, err = cli.MemberList(ctx)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("cannot list members: %w", err)
+	}
+	var removed []*etcdserverpb.Member
+	var removedNames []string
+	for _, m := range resp.Members {
+		if !slices.ContainsFunc(m.PeerURLs, func(url string) bool { return slices.Contains(peerURLs, url) }) {
+			removed = append(removed, m)
+			removedNames = append(removedNames, m.Name)
+		}
+	}
+	var missing []string
+	for _, url := range peerURLs {
+		if findMemberByPeerURL(resp.Members, url) == nil {
+			missing = append(missing, url)
+		}
+	}
+	learning := slices.ContainsFunc(resp.Members, func(m *etcdserverpb.Member) bool {
+		return m.IsLearner && !slices.Contains(removed, m)
+	})
+	if len(removed) > 0 {
+		if _, err = MoveLeaderAway(ctx, cli, removedNames); err != nil {
+			return false, err
+		}
+	}
+	err = OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		for _, m := range removed {
+			if _, err := cli.MemberRemove(ctx, m.ID); err != nil && !errors.Is(err, rpctypes.ErrMemberNotFound) {
+				return fmt.Errorf("cannot remove member %s: %w", m.Name, err)
+			}
+		}
+		if learning || len(missing) == 0 {
+			return nil
+		}
+		if _, err := cli.MemberAddAsLearner(ctx, missing[:1]); err != nil && !errors.Is(err, rpctypes.ErrPeerURLExist) {
+			return fmt.Errorf("cannot add learner with peer url %s: %w", missing[0], err)
+		}
+		missing = missing[1:]
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(missing) == 0, nil
+}
+
+// PromoteLearners promotes learners with the given peer URLs to voting members. It returns false
+// if some of them have not caught up with the leader yet.
+func PromoteLearners(ctx context.Context, cli Client, peerURLs []string) (bool, error) {
+	var resp *clientv3.MemberListResponse
+	err := OnAnyMember(ctx, cli, func(ctx context.Context, cli Client) (err error) {
+		resp, err = cli.MemberList(ctx)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("cannot list members: %w", err)
+	}
+	promoted := true
+	for _, url := range peerURLs {
+		member := findMemberByPeerURL(resp.Members, url)
+		if member == nil || !member.IsLearner {
+			continue
+		}
+		err = OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+			_, err := cli.MemberPromote(ctx, member.ID)
+			if errors.Is(err, rpctypes.ErrMemberNotLearner) {
+				return nil
+			}
+			return err
+		})
+		if errors.Is(err, rpctypes.ErrMemberLearnerNotReady) {
+			promoted = false
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("cannot promote learner %s: %w", member.Name, err)
+		}
+	}
+	return promoted, nil
+}
+
+func findMemberByPeerURL(members []*etcdserverpb.Member, peerURL string) *etcdserverpb.Member {
+	idx := slices.IndexFunc(members, func(m *etcdserverpb.Member) bool {
+		return slices.Contains(m.PeerURLs, peerURL)
+	})
+	if idx == -1 {
+		return nil
+	}
+	return members[idx]
+}
+
+// MoveLeaderAway transfers leadership to another started voting member if the current leader is one of the given
+// members. It returns the name of the new leader or empty string if leadership did not have to be moved.
+func MoveLeaderAway(ctx context.Context, cli Client, members []string) (string, error) {
+	var resp *clientv3.MemberListResponse
+	err := OnAnyMember(ctx, cli, func(ctx context.Context, cli Client) (err error) {
+		resp, err = cli.MemberList(ctx)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot list members: %w", err)
+	}
+	leaderID, err := leaderID(ctx, cli)
+	if err != nil {
+		return "", err
+	}
+	idx := slices.IndexFunc(resp.Members, func(m *etcdserverpb.Member) bool { return m.ID == leaderID })
+	if idx == -1 || !slices.Contains(members, resp.Members[idx].Name) {
+		return "", nil
+	}
+	leader := resp.Members[idx]
+
+	idx = slices.IndexFunc(resp.Members, func(m *etcdserverpb.Member) bool {
+		return m.Name != "" && !m.IsLearner && m.ID != leaderID && !slices.Contains(members, m.Name)
+	})
+	if idx == -1 {
+		return "", fmt.Errorf("no member to move leadership from %s to", leader.Name)
+	}
+	target := resp.Members[idx]
+
+	// leadership can be moved only by the request sent to the leader
+	err = OnLeader(ctx, cli, func(ctx context.Context, cli Client) error {
+		_, err := cli.MoveLeader(ctx, target.ID)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot move leadership from %s to %s: %w", leader.Name, target.Name, err)
+	}
+	return target.Name, nil
+}
+
+// LeaderName returns the name of the cluster leader.
+func LeaderName(ctx context.Context, cli Client) (string, error) {
+	var resp *clientv3.MemberListResponse
+	err := OnAnyMember(ctx, cli, func(ctx context.Context, cli Client) (err error) {
+		resp, err = cli.MemberList(ctx)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot list members: %w", err)
+	}
+	leaderID, err := leaderID(ctx, cli)
+	if err != nil {
+		return "", err
+	}
+	idx := slices.IndexFunc(resp.Members, func(m *etcdserverpb.Member) bool { return m.ID == leaderID })
+	if idx == -1 {
+		return "", fmt.Errorf("leader %x is not a member", leaderID)
+	}
+	return resp.Members[idx].Name, nil
+}
+
+// leaderID returns ID of the cluster leader as seen by the first endpoint responding to status request.
+func leaderID(ctx context.Context, cli Client) (uint64, error) {
+	var errs MemberErrors
+	for _, endpoint := range cli.Endpoints() {
+		resp, err := endpointStatus(ctx, cli, endpoint)
+		if err != nil {
+			errs = append(errs, MemberError{Endpoint: endpoint, Err: err})
+			continue
+		}
+		if resp.Leader != 0 {
+			return resp.Leader, nil
+		}
+	}
+	if len(errs) > 0 {
+		return 0, fmt.Errorf("cannot find cluster leader: %w", errs)
+	}
+	return 0, fmt.Errorf("cluster has no leader")
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	peerRoundTripMetric    = "etcd_network_peer_round_trip_time_seconds"
+	peerSentFailuresMetric = "etcd_network_peer_sent_failures_total"
+	proposalsFailedMetric  = "etcd_server_proposals_failed_total"
+	dbSizeMetric           = "etcd_mvcc_db_total_size_in_bytes"
+	quotaMetric            = "etcd_server_quota_backend_bytes"
+	requestsMetric         = "grpc_server_handled_total"
+	walFsyncMetric         = "etcd_disk_wal_fsync_duration_seconds"
+	backendCommitMetric    = "etcd_disk_backend_commit_duration_seconds"
+	serverVersionMetric    = "etcd_server_version"
+)
+
+// PeerMetrics are counters of a member describing its communication with peers. Peers are identified
+// by member IDs in the format of Member.ID.
+type PeerMetrics struct {
+	// RoundTrips is the number of round trip time probes of every peer.
+	RoundTrips map[string]uint64
+	// SentFailures is the number of messages which could not be sent to every peer.
+	SentFailures map[string]float64
+	// ProposalsFailed is the number of failed raft proposals.
+	ProposalsFailed float64
+}
+
+// UsageMetrics are metrics of a member describing its storage and load. Counters are cumulative since
+// the member started.
+type UsageMetrics struct {
+	// DBSize is the size of the database file in bytes.
+	DBSize float64
+	// Quota is the backend quota of the database in bytes.
+	Quota float64
+	// Requests is the number of handled gRPC requests.
+	Requests float64
+	// WALFsyncs and WALFsyncSeconds are the number and the total duration of WAL fsyncs.
+	WALFsyncs       uint64
+	WALFsyncSeconds float64
+	// BackendCommits and BackendCommitSeconds are the number and the total duration of backend commits.
+	BackendCommits       uint64
+	BackendCommitSeconds float64
+}
+
+// MetricsURL returns the URL of metrics of the member with the given name.
+func MetricsURL(cluster *etcdaenixiov1alpha1.EtcdCluster, memberName string) string {
+	return cluster.Member(memberName).MetricsURL + "/metrics"
+}
+
+// GetPeerMetrics scrapes peer metrics of a member from its metrics URL.
+func GetPeerMetrics(ctx context.Context, httpClient *http.Client, url string) (PeerMetrics, error) {
+	body, err := getMetrics(ctx, httpClient, url)
+	if err != nil {
+		return PeerMetrics{}, err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	return ParsePeerMetrics(body)
+}
+
+// GetUsageMetrics scrapes usage metrics of a member from its metrics URL.
+func GetUsageMetrics(ctx context.Context, httpClient *http.Client, url string) (UsageMetrics, error) {
+	body, err := getMetrics(ctx, httpClient, url)
+	if err != nil {
+		return UsageMetrics{}, err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	return ParseUsageMetrics(body)
+}
+
+// GetServerVersion scrapes the etcd version a member runs from its metrics URL.
+func GetServerVersion(ctx context.Context, httpClient *http.Client, url string) (string, error) {
+	body, err := getMetrics(ctx, httpClient, url)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	return ParseServerVersion(body)
+}
+
+func getMetrics(ctx context.Context, httpClient *http.Client, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get metrics: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("cannot get metrics: unexpected status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// ParsePeerMetrics parses peer metrics from metrics in the Prometheus text format.
+func ParsePeerMetrics(r io.Reader) (PeerMetrics, error) {
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return PeerMetrics{}, fmt.Errorf("cannot parse metrics: %w", err)
+	}
+	metrics := PeerMetrics{RoundTrips: map[string]uint64{}, SentFailures: map[string]float64{}}
+	if family, ok := families[peerRoundTripMetric]; ok {
+		for _, m := range family.GetMetric() {
+			metrics.RoundTrips[label(m.GetLabel(), "To")] += m.GetHistogram().GetSampleCount()
+		}
+	}
+	if family, ok := families[peerSentFailuresMetric]; ok {
+		for _, m := range family.GetMetric() {
+			metrics.SentFailures[label(m.GetLabel(), "To")] += m.GetCounter().GetValue()
+		}
+	}
+	if family, ok := families[proposalsFailedMetric]; ok {
+		for _, m := range family.GetMetric() {
+			metrics.ProposalsFailed += m.GetCounter().GetValue()
+		}
+	}
+	return metrics, nil
+}
+
+// ParseUsageMetrics parses usage metrics from metrics in the Prometheus text format.
+func ParseUsageMetrics(r io.Reader) (UsageMetrics, error) {
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return UsageMetrics{}, fmt.Errorf("cannot parse metrics: %w", err)
+	}
+	metrics := UsageMetrics{}
+	for _, m := range families[dbSizeMetric].GetMetric() {
+		metrics.DBSize += m.GetGauge().GetValue()
+	}
+	for _, m := range families[quotaMetric].GetMetric() {
+		metrics.Quota += m.GetGauge().GetValue()
+	}
+	for _, m := range families[requestsMetric].GetMetric() {
+		metrics.Requests += m.GetCounter().GetValue()
+	}
+	for _, m := range families[walFsyncMetric].GetMetric() {
+		metrics.WALFsyncs += m.GetHistogram().GetSampleCount()
+		metrics.WALFsyncSeconds += m.GetHistogram().GetSampleSum()
+	}
+	for _, m := range families[backendCommitMetric].GetMetric() {
+		metrics.BackendCommits += m.GetHistogram().GetSampleCount()
+		metrics.BackendCommitSeconds += m.GetHistogram().GetSampleSum()
+	}
+	return metrics, nil
+}
+
+// ParseServerVersion parses the etcd version from metrics in the Prometheus text format.
+func ParseServerVersion(r io.Reader) (string, error) {
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse metrics: %w", err)
+	}
+	for _, m := range families[serverVersionMetric].GetMetric() {
+		if v := label(m.GetLabel(), "server_version"); v != "" {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("metric %s is not found", serverVersionMetric)
+}
+
+func label(labels []*dto.LabelPair, name string) string {
+	for _, l := range labels {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
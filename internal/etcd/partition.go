@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"fmt"
+	"slices"
+)
+
+// PeerLink is a direction of communication between two members.
+type PeerLink struct {
+	From string
+	To   string
+}
+
+func (l PeerLink) String() string {
+	return fmt.Sprintf("%s -> %s", l.From, l.To)
+}
+
+// HalfOpenLinks compares two samples of peer metrics of members keyed by member names and returns links which
+// stopped working while the opposite direction still works. A link is broken if messages could not be sent
+// through it or round trip time probes stopped. Links of members without both samples are not checked.
+// ids maps member names to member IDs used in metrics.
+func HalfOpenLinks(previous, current map[string]PeerMetrics, ids map[string]string) []PeerLink {
+	broken := func(from, to string) bool {
+		prev, cur := previous[from], current[from]
+		id := ids[to]
+		return cur.SentFailures[id] > prev.SentFailures[id] || cur.RoundTrips[id] <= prev.RoundTrips[id]
+	}
+
+	var members []string
+	for name := range current {
+		if _, ok := previous[name]; ok && ids[name] != "" {
+			members = append(members, name)
+		}
+	}
+	slices.Sort(members)
+
+	var links []PeerLink
+	for _, from := range members {
+		for _, to := range members {
+			if from == to {
+				continue
+			}
+			if broken(from, to) && !broken(to, from) {
+				links = append(links, PeerLink{From: from, To: to})
+			}
+		}
+	}
+	return links
+}
+
+// FailedProposals returns the number of raft proposals failed on all members between two samples.
+func FailedProposals(previous, current map[string]PeerMetrics) float64 {
+	var failed float64
+	for name, cur := range current {
+		if prev, ok := previous[name]; ok && cur.ProposalsFailed > prev.ProposalsFailed {
+			failed += cur.ProposalsFailed - prev.ProposalsFailed
+		}
+	}
+	return failed
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	leaderChangesMetric = "etcd_server_leader_changes_seen_total"
+	slowAppliesMetric   = "etcd_server_slow_apply_total"
+)
+
+const (
+	// MaxWALFsyncP99 is the 99th percentile of WAL fsync durations above which the disk of a member is too slow
+	// for etcd to stay stable.
+	MaxWALFsyncP99 = 10 * time.Millisecond
+	// MaxBackendCommitP99 is the 99th percentile of backend commit durations above which the disk of a member
+	// is too slow for etcd to stay stable.
+	MaxBackendCommitP99 = 25 * time.Millisecond
+	// SlowFdatasync is the WAL fsync duration above which etcd logs "slow fdatasync" warnings.
+	SlowFdatasync = time.Second
+)
+
+// Histogram is a cumulative histogram: Counts are numbers of observations less than or equal to UpperBounds,
+// the last bound being +Inf.
+type Histogram struct {
+	UpperBounds []float64
+	Counts      []uint64
+}
+
+// Sub returns the histogram of observations made since the previous histogram. If the histograms don't match,
+// e.g. the member restarted in between, all observations of the histogram are returned.
+func (h Histogram) Sub(previous Histogram) Histogram {
+	if len(previous.Counts) != len(h.Counts) || len(previous.UpperBounds) != len(h.UpperBounds) {
+		return h
+	}
+	diff := Histogram{UpperBounds: h.UpperBounds, Counts: make([]uint64, len(h.Counts))}
+	for i := range h.Counts {
+		if h.UpperBounds[i] != previous.UpperBounds[i] || h.Counts[i] < previous.Counts[i] {
+			return h
+		}
+		diff.Counts[i] = h.Counts[i] - previous.Counts[i]
+	}
+	return diff
+}
+
+// Quantile estimates the q-quantile of observations interpolating linearly within buckets, the way Prometheus
+// histogram_quantile does. It returns zero without observations.
+func (h Histogram) Quantile(q float64) float64 {
+	if len(h.Counts) == 0 || h.Counts[len(h.Counts)-1] == 0 {
+		return 0
+	}
+	rank := q * float64(h.Counts[len(h.Counts)-1])
+	lower, lowerCount := 0.0, uint64(0)
+	for i, count := range h.Counts {
+		if float64(count) >= rank {
+			if math.IsInf(h.UpperBounds[i], 1) {
+				return lower
+			}
+			if count == lowerCount {
+				return h.UpperBounds[i]
+			}
+			return lower + (h.UpperBounds[i]-lower)*(rank-float64(lowerCount))/float64(count-lowerCount)
+		}
+		lower, lowerCount = h.UpperBounds[i], count
+	}
+	return lower
+}
+
+// CountAbove returns the number of observations above the first bucket bound which is not less than bound.
+// Observations between bound and that bucket bound are not counted, so the result is a lower estimate.
+func (h Histogram) CountAbove(bound float64) uint64 {
+	if len(h.Counts) == 0 {
+		return 0
+	}
+	for i, upper := range h.UpperBounds {
+		if upper >= bound {
+			return h.Counts[len(h.Counts)-1] - h.Counts[i]
+		}
+	}
+	return 0
+}
+
+// PerformanceMetrics are cumulative metrics of a member describing its disk latency and stability, which gate
+// disruptive operations on the cluster.
+type PerformanceMetrics struct {
+	WALFsync        Histogram
+	BackendCommit   Histogram
+	LeaderChanges   float64
+	ProposalsFailed float64
+	SlowApplies     float64
+}
+
+// MemberPerformance is the performance of a member observed between two samples of its metrics.
+type MemberPerformance struct {
+	WALFsyncP99      time.Duration
+	BackendCommitP99 time.Duration
+	LeaderChanges    float64
+	ProposalsFailed  float64
+	// SlowApplies is the number of requests which took too long to apply, logged by etcd
+	// as "apply request took too long".
+	SlowApplies float64
+	// SlowFdatasyncs is the number of WAL fsyncs which took longer than SlowFdatasync.
+	SlowFdatasyncs uint64
+}
+
+// ComparePerformance returns the performance of a member between the previous and the current sample of its metrics.
+// Counters reset by a restart of the member count from zero.
+func ComparePerformance(previous, current PerformanceMetrics) MemberPerformance {
+	increase := func(previous, current float64) float64 {
+		if current < previous {
+			return current
+		}
+		return current - previous
+	}
+	seconds := func(s float64) time.Duration {
+		return time.Duration(s * float64(time.Second))
+	}
+	walFsync := current.WALFsync.Sub(previous.WALFsync)
+	return MemberPerformance{
+		WALFsyncP99:      seconds(walFsync.Quantile(0.99)),
+		BackendCommitP99: seconds(current.BackendCommit.Sub(previous.BackendCommit).Quantile(0.99)),
+		LeaderChanges:    increase(previous.LeaderChanges, current.LeaderChanges),
+		ProposalsFailed:  increase(previous.ProposalsFailed, current.ProposalsFailed),
+		SlowApplies:      increase(previous.SlowApplies, current.SlowApplies),
+		SlowFdatasyncs:   walFsync.CountAbove(SlowFdatasync.Seconds()),
+	}
+}
+
+// Problems describes how the performance of the member is degraded, if it is.
+func (p MemberPerformance) Problems() []string {
+	var problems []string
+	if p.WALFsyncP99 > MaxWALFsyncP99 {
+		problems = append(problems, fmt.Sprintf("WAL fsync p99 %s exceeds %s", p.WALFsyncP99.Round(time.Millisecond), MaxWALFsyncP99))
+	}
+	if p.BackendCommitP99 > MaxBackendCommitP99 {
+		problems = append(problems, fmt.Sprintf("backend commit p99 %s exceeds %s",
+			p.BackendCommitP99.Round(time.Millisecond), MaxBackendCommitP99))
+	}
+	if p.LeaderChanges > 0 {
+		problems = append(problems, fmt.Sprintf("%.0f leader changes seen", p.LeaderChanges))
+	}
+	if p.ProposalsFailed > 0 {
+		problems = append(problems, fmt.Sprintf("%.0f proposals failed", p.ProposalsFailed))
+	}
+	return problems
+}
+
+// GetPerformanceMetrics scrapes performance metrics of a member from its metrics URL.
+func GetPerformanceMetrics(ctx context.Context, httpClient *http.Client, url string) (PerformanceMetrics, error) {
+	body, err := getMetrics(ctx, httpClient, url)
+	if err != nil {
+		return PerformanceMetrics{}, err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	return ParsePerformanceMetrics(body)
+}
+
+// ParsePerformanceMetrics parses performance metrics from metrics in the Prometheus text format.
+func ParsePerformanceMetrics(r io.Reader) (PerformanceMetrics, error) {
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return PerformanceMetrics{}, fmt.Errorf("cannot parse metrics: %w", err)
+	}
+	metrics := PerformanceMetrics{
+		WALFsync:      parseHistogram(families[walFsyncMetric]),
+		BackendCommit: parseHistogram(families[backendCommitMetric]),
+	}
+	for _, m := range families[leaderChangesMetric].GetMetric() {
+		metrics.LeaderChanges += m.GetCounter().GetValue()
+	}
+	for _, m := range families[proposalsFailedMetric].GetMetric() {
+		metrics.ProposalsFailed += m.GetCounter().GetValue()
+	}
+	for _, m := range families[slowAppliesMetric].GetMetric() {
+		metrics.SlowApplies += m.GetCounter().GetValue()
+	}
+	return metrics, nil
+}
+
+// parseHistogram returns the histogram of the family, summing up series with the same buckets.
+func parseHistogram(family *dto.MetricFamily) Histogram {
+	var h Histogram
+	for _, m := range family.GetMetric() {
+		var series Histogram
+		for _, b := range m.GetHistogram().GetBucket() {
+			series.UpperBounds = append(series.UpperBounds, b.GetUpperBound())
+			series.Counts = append(series.Counts, b.GetCumulativeCount())
+		}
+		if n := len(series.UpperBounds); n == 0 || !math.IsInf(series.UpperBounds[n-1], 1) {
+			series.UpperBounds = append(series.UpperBounds, math.Inf(1))
+			series.Counts = append(series.Counts, m.GetHistogram().GetSampleCount())
+		}
+		switch {
+		case h.Counts == nil:
+			h = series
+		case len(h.Counts) == len(series.Counts):
+			for i := range h.Counts {
+				h.Counts[i] += series.Counts[i]
+			}
+		}
+	}
+	return h
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	defaultDialTimeout = 5 * time.Second
+	// defaultMemberTimeout limits a single call to a member, so unavailable members do not block calls to others.
+	defaultMemberTimeout = 2 * time.Second
+	// defaultRequestTimeout limits attempts of requests which are not limited otherwise.
+	defaultRequestTimeout = 30 * time.Second
+	// defaultLeaderRetries is the number of retries of calls to the leader while it is being elected or changed.
+	defaultLeaderRetries    = 3
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned for requests rejected by the open circuit breaker of the cluster.
+var ErrCircuitOpen = errors.New("etcd API requests to the cluster are suspended after consecutive failures")
+
+// apiPolicy limits etcd API requests of a client to the cluster it is created for. It is kept in the context
+// of the client, so helpers working with the client apply it.
+type apiPolicy struct {
+	dialTimeout    time.Duration
+	memberTimeout  time.Duration
+	requestTimeout time.Duration
+	leaderBackoff  wait.Backoff
+	// unaryAttempts is the maximum number of attempts of requests by the client including the first one,
+	// zero for the client default.
+	unaryAttempts uint
+	// breaker is the circuit breaker of the cluster, nil if it is disabled.
+	breaker          *circuitBreaker
+	failureThreshold int
+	openDuration     time.Duration
+}
+
+// policyKey is the context key of the policy of a client.
+type policyKey struct{}
+
+var (
+	// breakers are circuit breakers of clusters, they outlive clients created by reconciles.
+	breakers sync.Map
+	// defaultPolicy applies to clients created without a cluster.
+	defaultPolicy = newAPIPolicy(&etcdaenixiov1alpha1.EtcdCluster{})
+)
+
+func newAPIPolicy(cluster *etcdaenixiov1alpha1.EtcdCluster) *apiPolicy {
+	p := &apiPolicy{
+		dialTimeout:    defaultDialTimeout,
+		memberTimeout:  defaultMemberTimeout,
+		requestTimeout: defaultRequestTimeout,
+		leaderBackoff: wait.Backoff{
+			Steps:    defaultLeaderRetries + 1,
+			Duration: 500 * time.Millisecond,
+			Factor:   2.0,
+			Jitter:   0.1,
+		},
+	}
+	spec := cluster.Spec.EtcdAPI
+	if spec == nil {
+		return p
+	}
+	for _, d := range []struct {
+		value  *metav1.Duration
+		target *time.Duration
+	}{
+		{value: spec.DialTimeout, target: &p.dialTimeout},
+		{value: spec.MemberTimeout, target: &p.memberTimeout},
+		{value: spec.RequestTimeout, target: &p.requestTimeout},
+	} {
+		if d.value != nil && d.value.Duration > 0 {
+			*d.target = d.value.Duration
+		}
+	}
+	if spec.MaxRetries != nil {
+		p.leaderBackoff.Steps = int(*spec.MaxRetries) + 1
+		p.unaryAttempts = uint(*spec.MaxRetries) + 1
+	}
+	if cb := spec.CircuitBreaker; cb != nil {
+		p.failureThreshold, p.openDuration = defaultFailureThreshold, defaultOpenDuration
+		if cb.FailureThreshold != nil {
+			p.failureThreshold = int(*cb.FailureThreshold)
+		}
+		if cb.OpenDuration != nil && cb.OpenDuration.Duration > 0 {
+			p.openDuration = cb.OpenDuration.Duration
+		}
+		key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+		breaker, _ := breakers.LoadOrStore(key, &circuitBreaker{})
+		p.breaker = breaker.(*circuitBreaker)
+	}
+	return p
+}
+
+// policyOf returns the policy of the client.
+func policyOf(cli Client) *apiPolicy {
+	if p, ok := cli.Ctx().Value(policyKey{}).(*apiPolicy); ok {
+		return p
+	}
+	return defaultPolicy
+}
+
+// allow returns ErrCircuitOpen while requests to the cluster are suspended. Otherwise the request is let through,
+// it is the probe request if the circuit is half-open.
+func (p *apiPolicy) allow() error {
+	if p.breaker == nil {
+		return nil
+	}
+	return p.breaker.allow(time.Now())
+}
+
+// check returns ErrCircuitOpen while the circuit is open, without taking the probe of the half-open circuit,
+// so clients aren't created only to have their requests rejected.
+func (p *apiPolicy) check() error {
+	if p.breaker == nil {
+		return nil
+	}
+	return p.breaker.check(time.Now())
+}
+
+// record counts requests failed because members were unavailable or didn't respond in time. Other errors
+// are responses of the cluster, so they close the circuit like successful requests.
+func (p *apiPolicy) record(err error) {
+	if p.breaker == nil {
+		return
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		p.breaker.fail(time.Now(), p.failureThreshold, p.openDuration)
+	default:
+		p.breaker.succeed()
+	}
+}
+
+// unaryInterceptor limits attempts of requests without a deadline by the request timeout and records their results
+// in the circuit breaker of the cluster. Requests are rejected without being sent while the circuit is open.
+func (p *apiPolicy) unaryInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	if err := p.allow(); err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.requestTimeout)
+		defer cancel()
+	}
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	p.record(err)
+	return err
+}
+
+// memberInterceptor limits each attempt of requests sent to a single member by the member timeout.
+func (p *apiPolicy) memberInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, p.memberTimeout)
+	defer cancel()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// ForgetCluster drops the circuit breaker of the deleted cluster.
+func ForgetCluster(key types.NamespacedName) {
+	breakers.Delete(key)
+}
+
+// circuitBreaker counts consecutive failed requests to a cluster. Once the circuit has been open for the open
+// duration, it is half-open: a single probe request is let through while others are still rejected, which closes
+// the circuit if it succeeds and opens it again if it fails.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures int
+	// until is the time the open circuit becomes half-open, zero if the circuit is closed.
+	until time.Time
+	// probing is set while the probe request of the half-open circuit is in flight.
+	probing bool
+}
+
+func (b *circuitBreaker) check(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Before(b.until) {
+		return fmt.Errorf("%w, retrying at %s", ErrCircuitOpen, b.until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (b *circuitBreaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.until.IsZero():
+		return nil
+	case now.Before(b.until):
+		return fmt.Errorf("%w, retrying at %s", ErrCircuitOpen, b.until.Format(time.RFC3339))
+	case b.probing:
+		return fmt.Errorf("%w, a probe request is in flight", ErrCircuitOpen)
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *circuitBreaker) fail(now time.Time, threshold int, openDuration time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= threshold || b.probing {
+		b.until = now.Add(openDuration)
+		b.probing = false
+	}
+}
+
+func (b *circuitBreaker) succeed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.until = time.Time{}
+	b.probing = false
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("etcd API policy", func() {
+	DescribeTable("applies defaults and overrides",
+		func(spec *etcdaenixiov1alpha1.EtcdAPISpec, expected apiPolicy) {
+			cluster := &etcdaenixiov1alpha1.EtcdCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "policy"},
+				Spec:       etcdaenixiov1alpha1.EtcdClusterSpec{EtcdAPI: spec},
+			}
+			p := newAPIPolicy(cluster)
+			DeferCleanup(ForgetCluster, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name})
+			Expect(p.dialTimeout).To(Equal(expected.dialTimeout))
+			Expect(p.memberTimeout).To(Equal(expected.memberTimeout))
+			Expect(p.requestTimeout).To(Equal(expected.requestTimeout))
+			Expect(p.leaderBackoff.Steps).To(Equal(expected.leaderBackoff.Steps))
+			Expect(p.unaryAttempts).To(Equal(expected.unaryAttempts))
+			Expect(p.failureThreshold).To(Equal(expected.failureThreshold))
+			Expect(p.openDuration).To(Equal(expected.openDuration))
+			Expect(p.breaker != nil).To(Equal(spec != nil && spec.CircuitBreaker != nil))
+		},
+		Entry("defaults", nil, apiPolicy{
+			dialTimeout:    defaultDialTimeout,
+			memberTimeout:  defaultMemberTimeout,
+			requestTimeout: defaultRequestTimeout,
+			leaderBackoff:  wait.Backoff{Steps: defaultLeaderRetries + 1},
+		}),
+		Entry("timeouts", &etcdaenixiov1alpha1.EtcdAPISpec{
+			DialTimeout:    &metav1.Duration{Duration: time.Second},
+			MemberTimeout:  &metav1.Duration{Duration: 3 * time.Second},
+			RequestTimeout: &metav1.Duration{Duration: time.Minute},
+		}, apiPolicy{
+			dialTimeout:    time.Second,
+			memberTimeout:  3 * time.Second,
+			requestTimeout: time.Minute,
+			leaderBackoff:  wait.Backoff{Steps: defaultLeaderRetries + 1},
+		}),
+		Entry("non-positive timeouts", &etcdaenixiov1alpha1.EtcdAPISpec{
+			DialTimeout:    &metav1.Duration{},
+			RequestTimeout: &metav1.Duration{Duration: -time.Second},
+		}, apiPolicy{
+			dialTimeout:    defaultDialTimeout,
+			memberTimeout:  defaultMemberTimeout,
+			requestTimeout: defaultRequestTimeout,
+			leaderBackoff:  wait.Backoff{Steps: defaultLeaderRetries + 1},
+		}),
+		Entry("no retries", &etcdaenixiov1alpha1.EtcdAPISpec{MaxRetries: ptr.To(int32(0))}, apiPolicy{
+			dialTimeout:    defaultDialTimeout,
+			memberTimeout:  defaultMemberTimeout,
+			requestTimeout: defaultRequestTimeout,
+			leaderBackoff:  wait.Backoff{Steps: 1},
+			unaryAttempts:  1,
+		}),
+		Entry("retries", &etcdaenixiov1alpha1.EtcdAPISpec{MaxRetries: ptr.To(int32(5))}, apiPolicy{
+			dialTimeout:    defaultDialTimeout,
+			memberTimeout:  defaultMemberTimeout,
+			requestTimeout: defaultRequestTimeout,
+			leaderBackoff:  wait.Backoff{Steps: 6},
+			unaryAttempts:  6,
+		}),
+		Entry("default circuit breaker", &etcdaenixiov1alpha1.EtcdAPISpec{
+			CircuitBreaker: &etcdaenixiov1alpha1.CircuitBreakerSpec{},
+		}, apiPolicy{
+			dialTimeout:      defaultDialTimeout,
+			memberTimeout:    defaultMemberTimeout,
+			requestTimeout:   defaultRequestTimeout,
+			leaderBackoff:    wait.Backoff{Steps: defaultLeaderRetries + 1},
+			failureThreshold: defaultFailureThreshold,
+			openDuration:     defaultOpenDuration,
+		}),
+		Entry("circuit breaker", &etcdaenixiov1alpha1.EtcdAPISpec{
+			CircuitBreaker: &etcdaenixiov1alpha1.CircuitBreakerSpec{
+				FailureThreshold: ptr.To(int32(2)),
+				OpenDuration:     &metav1.Duration{Duration: time.Minute},
+			},
+		}, apiPolicy{
+			dialTimeout:      defaultDialTimeout,
+			memberTimeout:    defaultMemberTimeout,
+			requestTimeout:   defaultRequestTimeout,
+			leaderBackoff:    wait.Backoff{Steps: defaultLeaderRetries + 1},
+			failureThreshold: 2,
+			openDuration:     time.Minute,
+		}),
+	)
+
+	It("should share the circuit breaker of a cluster until it is forgotten", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shared"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{EtcdAPI: &etcdaenixiov1alpha1.EtcdAPISpec{
+				CircuitBreaker: &etcdaenixiov1alpha1.CircuitBreakerSpec{},
+			}},
+		}
+		key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+		breaker := newAPIPolicy(cluster).breaker
+		Expect(newAPIPolicy(cluster).breaker).To(BeIdenticalTo(breaker))
+		ForgetCluster(key)
+		_, ok := breakers.Load(key)
+		Expect(ok).To(BeFalse())
+		Expect(newAPIPolicy(cluster).breaker).NotTo(BeIdenticalTo(breaker))
+		ForgetCluster(key)
+	})
+
+	DescribeTable("counts only failures of unavailable members",
+		func(err error, failed bool) {
+			p := &apiPolicy{breaker: &circuitBreaker{failures: 1}, failureThreshold: 5, openDuration: time.Minute}
+			p.record(err)
+			if failed {
+				Expect(p.breaker.failures).To(Equal(2))
+			} else {
+				Expect(p.breaker.failures).To(BeZero())
+			}
+		},
+		Entry("unavailable", status.Error(codes.Unavailable, "connection refused"), true),
+		Entry("deadline exceeded", status.Error(codes.DeadlineExceeded, "context deadline exceeded"), true),
+		Entry("success", nil, false),
+		Entry("not found", status.Error(codes.NotFound, "member not found"), false),
+		Entry("permission denied", status.Error(codes.PermissionDenied, "permission denied"), false),
+		Entry("canceled", status.Error(codes.Canceled, "context canceled"), false),
+		Entry("other error", errors.New("other"), false),
+	)
+
+	It("should open, half-open and close the circuit", func() {
+		b := &circuitBreaker{}
+		now := time.Now()
+		Expect(b.allow(now)).To(Succeed())
+		b.fail(now, 2, time.Minute)
+		Expect(b.allow(now)).To(Succeed())
+		b.fail(now, 2, time.Minute)
+		Expect(b.allow(now.Add(time.Second))).To(MatchError(ErrCircuitOpen))
+
+		By("letting a single probe through once the open duration passes")
+		now = now.Add(time.Minute)
+		Expect(b.allow(now)).To(Succeed())
+		Expect(b.allow(now)).To(MatchError(ErrCircuitOpen))
+
+		By("opening the circuit again if the probe fails")
+		b.fail(now, 2, time.Minute)
+		Expect(b.allow(now.Add(30 * time.Second))).To(MatchError(ErrCircuitOpen))
+
+		By("closing the circuit if the probe succeeds")
+		now = now.Add(time.Minute)
+		Expect(b.allow(now)).To(Succeed())
+		b.succeed()
+		Expect(b.allow(now)).To(Succeed())
+		Expect(b.allow(now)).To(Succeed())
+		b.fail(now, 2, time.Minute)
+		Expect(b.allow(now)).To(Succeed())
+	})
+
+	It("should reject requests without sending them while the circuit is open", func() {
+		p := &apiPolicy{breaker: &circuitBreaker{}, failureThreshold: 1, openDuration: time.Minute,
+			requestTimeout: time.Second}
+		sent := 0
+		invoker := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			sent++
+			return status.Error(codes.Unavailable, "connection refused")
+		}
+		Expect(p.unaryInterceptor(context.Background(), "/etcdserverpb.KV/Range", nil, nil, nil, invoker)).
+			To(MatchError(ContainSubstring("connection refused")))
+		Expect(p.unaryInterceptor(context.Background(), "/etcdserverpb.KV/Range", nil, nil, nil, invoker)).
+			To(MatchError(ErrCircuitOpen))
+		Expect(sent).To(Equal(1))
+	})
+
+	It("should send the probe request of clients created while the circuit is half-open", func(ctx SpecContext) {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "half-open"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(1)),
+				EtcdAPI: &etcdaenixiov1alpha1.EtcdAPISpec{CircuitBreaker: &etcdaenixiov1alpha1.CircuitBreakerSpec{
+					FailureThreshold: ptr.To(int32(1)),
+					OpenDuration:     &metav1.Duration{Duration: time.Minute},
+				}},
+			},
+		}
+		DeferCleanup(ForgetCluster, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name})
+		var cfg clientv3.Config
+		ConfigureClientFactory(func(c clientv3.Config) (Client, error) {
+			cfg = c
+			return nil, nil
+		})
+		DeferCleanup(func() {
+			ConfigureClientFactory(nil)
+		})
+		sent := 0
+		invoker := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			sent++
+			return nil
+		}
+
+		newAPIPolicy(cluster).breaker.until = time.Now().Add(-time.Second)
+		_, err := newClient(ctx, cluster, nil, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		p := cfg.Context.Value(policyKey{}).(*apiPolicy)
+		Expect(p.unaryInterceptor(ctx, "/etcdserverpb.KV/Range", nil, nil, nil, invoker)).To(Succeed())
+		Expect(sent).To(Equal(1))
+		Expect(p.breaker.until.IsZero()).To(BeTrue())
+
+		By("rejecting clients while the circuit is open")
+		p.breaker.fail(time.Now(), 1, time.Minute)
+		_, err = newClient(ctx, cluster, nil, "", "")
+		Expect(err).To(MatchError(ErrCircuitOpen))
+	})
+})
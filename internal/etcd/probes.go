@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"math"
+
+	"golang.org/x/time/rate"
+)
+
+// ProbeLimits limits member probes of all clusters managed by the operator, so a large fleet doesn't
+// probe members in storms.
+type ProbeLimits struct {
+	// QPS is the sustained number of member probes per second. Zero means no limit.
+	QPS float64
+	// Burst is the number of probes allowed in a row over QPS.
+	Burst int
+	// MaxConcurrent is the maximum number of probes in flight. Zero means no limit.
+	MaxConcurrent int
+}
+
+// probeLimiter delays probes over the rate and concurrency limits.
+type probeLimiter struct {
+	rate  *rate.Limiter
+	slots chan struct{}
+}
+
+var probes = newProbeLimiter(ProbeLimits{})
+
+// ConfigureProbes sets limits of member probes. It has to be called before probes are started.
+func ConfigureProbes(limits ProbeLimits) {
+	probes = newProbeLimiter(limits)
+}
+
+func newProbeLimiter(limits ProbeLimits) *probeLimiter {
+	l := &probeLimiter{rate: rate.NewLimiter(rate.Inf, 0)}
+	if limits.QPS > 0 {
+		l.rate = rate.NewLimiter(rate.Limit(limits.QPS), max(limits.Burst, int(math.Ceil(limits.QPS))))
+	}
+	if limits.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return l
+}
+
+// Probe runs the member probe once the operator-wide limits allow. Error is returned if the context is done
+// before that.
+func Probe(ctx context.Context, probe func(ctx context.Context) error) error {
+	l := probes
+	if err := l.rate.Wait(ctx); err != nil {
+		return err
+	}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() {
+			<-l.slots
+		}()
+	}
+	return probe(ctx)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const usagePageSize = 500
+
+// PrefixUsage is the number and size of keys under a key prefix.
+type PrefixUsage struct {
+	Prefix string `json:"prefix"`
+	Keys   int64  `json:"keys"`
+	// Bytes is the total size of keys and their values.
+	Bytes int64 `json:"bytes"`
+}
+
+// KeyUsage is the usage of the keyspace by key prefixes at a single revision.
+type KeyUsage struct {
+	Revision    int64 `json:"revision"`
+	ScannedKeys int64 `json:"scannedKeys"`
+	// Complete is false if reading keys stopped at the maximum number of keys.
+	Complete bool `json:"complete"`
+	// Prefixes are sorted by size, the largest first.
+	Prefixes []PrefixUsage `json:"prefixes"`
+	// Quotas is the usage of prefixes with quotas in the order they were requested.
+	Quotas []PrefixUsage `json:"quotas,omitempty"`
+}
+
+// Top returns the usage with the n largest prefixes only.
+func (u *KeyUsage) Top(n int) *KeyUsage {
+	top := *u
+	top.Prefixes = u.Prefixes[:min(n, len(u.Prefixes))]
+	return &top
+}
+
+// KeyPrefix returns the prefix of the key consisting of its first depth segments, including the separator
+// following them. Keys with fewer segments are their own prefix.
+func KeyPrefix(key, separator string, depth int) string {
+	end := 0
+	// a leading separator does not start a segment, e.g. /registry/ is the first segment of /registry/pods
+	if strings.HasPrefix(key, separator) {
+		end = len(separator)
+	}
+	for i := 0; i < depth; i++ {
+		idx := strings.Index(key[end:], separator)
+		if idx == -1 {
+			return key
+		}
+		end += idx + len(separator)
+	}
+	return key[:end]
+}
+
+// GetKeyUsage reads keys page by page, consistently at a single revision, and sums up their number and size
+// by prefixes. Keys under each of quotaPrefixes are summed up too. Reading stops after maxKeys keys.
+func GetKeyUsage(
+	ctx context.Context,
+	cli Client,
+	separator string,
+	depth int,
+	maxKeys int64,
+	quotaPrefixes []string,
+) (*KeyUsage, error) {
+	usage := &KeyUsage{Quotas: make([]PrefixUsage, len(quotaPrefixes))}
+	for i, prefix := range quotaPrefixes {
+		usage.Quotas[i].Prefix = prefix
+	}
+	prefixes := map[string]*PrefixUsage{}
+	key := "\x00"
+	for {
+		limit := min(usagePageSize, maxKeys-usage.ScannedKeys)
+		opts := []clientv3.OpOption{clientv3.WithFromKey(), clientv3.WithLimit(limit)}
+		if usage.Revision != 0 {
+			opts = append(opts, clientv3.WithRev(usage.Revision))
+		}
+		resp, err := cli.Get(ctx, key, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get keys: %w", err)
+		}
+		if usage.Revision == 0 {
+			usage.Revision = resp.Header.Revision
+		}
+		for _, kv := range resp.Kvs {
+			prefix := KeyPrefix(string(kv.Key), separator, depth)
+			p, ok := prefixes[prefix]
+			if !ok {
+				p = &PrefixUsage{Prefix: prefix}
+				prefixes[prefix] = p
+			}
+			p.Keys++
+			p.Bytes += int64(len(kv.Key) + len(kv.Value))
+			for i := range usage.Quotas {
+				if strings.HasPrefix(string(kv.Key), usage.Quotas[i].Prefix) {
+					usage.Quotas[i].Keys++
+					usage.Quotas[i].Bytes += int64(len(kv.Key) + len(kv.Value))
+				}
+			}
+		}
+		usage.ScannedKeys += int64(len(resp.Kvs))
+		if !resp.More || len(resp.Kvs) == 0 {
+			usage.Complete = true
+			break
+		}
+		if usage.ScannedKeys >= maxKeys {
+			break
+		}
+		// continue right after the last returned key
+		key = string(append(resp.Kvs[len(resp.Kvs)-1].Key, 0))
+	}
+	for _, p := range prefixes {
+		usage.Prefixes = append(usage.Prefixes, *p)
+	}
+	slices.SortFunc(usage.Prefixes, func(a, b PrefixUsage) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(a.Prefix, b.Prefix))
+	})
+	return usage, nil
+}
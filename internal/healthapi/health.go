@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthapi
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// ClusterHealth is the health summary of a single cluster.
+type ClusterHealth struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Ready mirrors the Ready condition of the cluster.
+	Ready bool `json:"ready"`
+	// QuorumLost mirrors the QuorumLost condition of the cluster.
+	QuorumLost bool `json:"quorumLost"`
+	// Reason and Message of the Ready condition.
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Replicas is the desired number of members.
+	Replicas int32          `json:"replicas"`
+	Members  []MemberHealth `json:"members,omitempty"`
+	// LastSnapshotTime is the time of the last periodic snapshot.
+	LastSnapshotTime *metav1.Time `json:"lastSnapshotTime,omitempty"`
+	// ObservedGeneration is the generation of the cluster spec the summary is built from.
+	ObservedGeneration int64 `json:"observedGeneration"`
+}
+
+// MemberHealth is the health summary of a single member.
+type MemberHealth struct {
+	Name                  string `json:"name"`
+	NodeName              string `json:"nodeName,omitempty"`
+	NodeLost              bool   `json:"nodeLost,omitempty"`
+	Restarts              int32  `json:"restarts,omitempty"`
+	OOMKills              int32  `json:"oomKills,omitempty"`
+	LastTerminationReason string `json:"lastTerminationReason,omitempty"`
+}
+
+// Summarize builds health summary of the cluster from its status.
+func Summarize(cluster *etcdaenixiov1alpha1.EtcdCluster) ClusterHealth {
+	health := ClusterHealth{
+		Namespace:          cluster.Namespace,
+		Name:               cluster.Name,
+		ObservedGeneration: cluster.Generation,
+	}
+	if cluster.Spec.Replicas != nil {
+		health.Replicas = *cluster.Spec.Replicas
+	}
+	if ready := meta.FindStatusCondition(cluster.Status.Conditions, etcdaenixiov1alpha1.EtcdConditionReady); ready != nil {
+		health.Ready = ready.Status == metav1.ConditionTrue
+		health.Reason = ready.Reason
+		health.Message = ready.Message
+	}
+	health.QuorumLost = meta.IsStatusConditionTrue(cluster.Status.Conditions, etcdaenixiov1alpha1.EtcdConditionQuorumLost)
+	for _, m := range cluster.Status.Members {
+		health.Members = append(health.Members, MemberHealth{
+			Name:                  m.Name,
+			NodeName:              m.NodeName,
+			NodeLost:              m.PinnedNodeLost,
+			Restarts:              m.Restarts,
+			OOMKills:              m.OOMKills,
+			LastTerminationReason: m.LastTerminationReason,
+		})
+	}
+	if cluster.Status.Backup != nil {
+		health.LastSnapshotTime = cluster.Status.Backup.LastSnapshotTime
+	}
+	return health
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package healthapi implements the HTTP API serving health summaries of managed clusters to external control planes.
+// Summaries can be fetched and watched, callers are authorized with their Kubernetes bearer tokens against
+// the etcdclusters/status resource.
+package healthapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/httpapi"
+)
+
+// EventType is the type of the watch event.
+type EventType string
+
+const (
+	EventAdded    EventType = "ADDED"
+	EventModified EventType = "MODIFIED"
+	EventDeleted  EventType = "DELETED"
+)
+
+// Event is a single change of cluster health streamed to watchers as a line of JSON.
+type Event struct {
+	Type   EventType     `json:"type"`
+	Object ClusterHealth `json:"object"`
+}
+
+// Server serves health summaries of managed clusters.
+type Server struct {
+	// BindAddress is the address the server listens on.
+	BindAddress string
+	// CertDir is the directory with tls.crt and tls.key serving certificate.
+	// Self-signed certificate is generated if it is empty.
+	CertDir string
+	// Client is used to read clusters and to review callers' tokens and permissions.
+	Client client.Client
+	// Informers provides cluster change notifications for watches.
+	Informers cache.Informers
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, the API is served by every replica.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+func (s *Server) Start(ctx context.Context) error {
+	return httpapi.Serve(ctx, s.BindAddress, s.CertDir, s.Handler())
+}
+
+// Handler returns the HTTP handler of the API.
+// List endpoints stream changes as newline-delimited JSON events if called with watch=true query parameter.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /clusters", s.handleList)
+	mux.HandleFunc("GET /namespaces/{namespace}/clusters", s.handleList)
+	mux.HandleFunc("GET /namespaces/{namespace}/clusters/{name}", s.handleGet)
+	return mux
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	key := types.NamespacedName{Namespace: r.PathValue("namespace"), Name: r.PathValue("name")}
+	if code, err := s.authorize(r, key.Namespace, key.Name, "get"); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+	if err := s.Client.Get(r.Context(), key, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.Error(w, fmt.Sprintf("cluster %s not found", key), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, Summarize(cluster))
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	namespace := r.PathValue("namespace")
+	watch := r.URL.Query().Get("watch") == "true"
+	verb := "list"
+	if watch {
+		verb = "watch"
+	}
+	if code, err := s.authorize(r, namespace, "", verb); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if watch {
+		s.watch(w, r, namespace)
+		return
+	}
+
+	clusters := &etcdaenixiov1alpha1.EtcdClusterList{}
+	if err := s.Client.List(r.Context(), clusters, client.InNamespace(namespace)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]ClusterHealth, 0, len(clusters.Items))
+	for i := range clusters.Items {
+		items = append(items, Summarize(&clusters.Items[i]))
+	}
+	writeJSON(w, items)
+}
+
+// watch streams cluster health changes until the client disconnects. Current state of every cluster
+// is sent as ADDED event first.
+func (s *Server) watch(w http.ResponseWriter, r *http.Request, namespace string) {
+	ctx := r.Context()
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	informer, err := s.Informers.GetInformer(ctx, &etcdaenixiov1alpha1.EtcdCluster{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	events := make(chan Event)
+	send := func(eventType EventType, obj any) {
+		if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		cluster, ok := obj.(*etcdaenixiov1alpha1.EtcdCluster)
+		if !ok || namespace != "" && cluster.Namespace != namespace {
+			return
+		}
+		select {
+		case events <- Event{Type: eventType, Object: Summarize(cluster)}:
+		case <-ctx.Done():
+		}
+	}
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { send(EventAdded, obj) },
+		UpdateFunc: func(_, obj any) { send(EventModified, obj) },
+		DeleteFunc: func(obj any) { send(EventDeleted, obj) },
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		_ = informer.RemoveEventHandler(registration)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if err = encoder.Encode(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// authorize checks the caller is allowed to perform the verb on status of clusters.
+func (s *Server) authorize(r *http.Request, namespace, name, verb string) (int, error) {
+	return httpapi.Authorize(r.Context(), s.Client, r, authorizationv1.ResourceAttributes{
+		Namespace:   namespace,
+		Name:        name,
+		Verb:        verb,
+		Group:       etcdaenixiov1alpha1.GroupVersion.Group,
+		Resource:    "etcdclusters",
+		Subresource: "status",
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
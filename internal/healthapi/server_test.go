@@ -0,0 +1,191 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+func testCluster(namespace string, ready bool) *etcdaenixiov1alpha1.EtcdCluster {
+	status := metav1.ConditionFalse
+	if ready {
+		status = metav1.ConditionTrue
+	}
+	return &etcdaenixiov1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "test"},
+		Spec:       etcdaenixiov1alpha1.EtcdClusterSpec{Replicas: ptr.To(int32(3))},
+		Status: etcdaenixiov1alpha1.EtcdClusterStatus{
+			Conditions: []metav1.Condition{{
+				Type:   etcdaenixiov1alpha1.EtcdConditionReady,
+				Status: status,
+				Reason: "StatefulSetReady",
+			}},
+			Members: []etcdaenixiov1alpha1.MemberStatus{{Name: "test-0", Restarts: 2, OOMKills: 1}},
+		},
+	}
+}
+
+var _ = Describe("Health API", func() {
+	var (
+		server    *Server
+		informers *informertest.FakeInformers
+		checked   *authorizationv1.ResourceAttributes
+	)
+
+	BeforeEach(func() {
+		checked = nil
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		informers = &informertest.FakeInformers{Scheme: scheme}
+		server = &Server{
+			Informers: informers,
+			Client: fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(testCluster("default", true), testCluster("other", false)).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+						switch review := obj.(type) {
+						case *authenticationv1.TokenReview:
+							review.Status.Authenticated = review.Spec.Token == "valid-token"
+						case *authorizationv1.SubjectAccessReview:
+							checked = review.Spec.ResourceAttributes
+							review.Status.Allowed = true
+						}
+						return nil
+					},
+				}).Build(),
+		}
+	})
+
+	serve := func(ctx context.Context, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("should summarize cluster status", func() {
+		health := Summarize(testCluster("default", true))
+		Expect(health.Ready).To(BeTrue())
+		Expect(health.Replicas).To(Equal(int32(3)))
+		Expect(health.Members).To(HaveLen(1))
+		Expect(health.Members[0].OOMKills).To(Equal(int32(1)))
+	})
+
+	It("should get health of a single cluster", func(ctx SpecContext) {
+		rec := serve(ctx, "/namespaces/other/clusters/test")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		health := ClusterHealth{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &health)).To(Succeed())
+		Expect(health.Namespace).To(Equal("other"))
+		Expect(health.Ready).To(BeFalse())
+		Expect(checked.Verb).To(Equal("get"))
+		Expect(checked.Subresource).To(Equal("status"))
+
+		Expect(serve(ctx, "/namespaces/other/clusters/unknown").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should list clusters in a namespace and in all namespaces", func(ctx SpecContext) {
+		var items []ClusterHealth
+		rec := serve(ctx, "/namespaces/default/clusters")
+		Expect(json.Unmarshal(rec.Body.Bytes(), &items)).To(Succeed())
+		Expect(items).To(HaveLen(1))
+		Expect(checked.Verb).To(Equal("list"))
+
+		rec = serve(ctx, "/clusters")
+		Expect(json.Unmarshal(rec.Body.Bytes(), &items)).To(Succeed())
+		Expect(items).To(HaveLen(2))
+		Expect(checked.Namespace).To(BeEmpty())
+	})
+
+	It("should stream changes of clusters in the namespace", func(ctx SpecContext) {
+		informer, err := informers.FakeInformerFor(ctx, &etcdaenixiov1alpha1.EtcdCluster{})
+		Expect(err).ToNot(HaveOccurred())
+
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream := &streamRecorder{header: http.Header{}, started: make(chan int, 1), lines: make(chan string, 10)}
+		req := httptest.NewRequest(http.MethodGet, "/namespaces/default/clusters?watch=true", nil).WithContext(watchCtx)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		go server.Handler().ServeHTTP(stream, req)
+
+		// the header is written once the watch is registered
+		Eventually(stream.started).Should(Receive(Equal(http.StatusOK)))
+		Expect(checked.Verb).To(Equal("watch"))
+
+		// the fake informer delivers events synchronously and blocks until they are written
+		go func() {
+			informer.Add(testCluster("other", true))
+			informer.Add(testCluster("default", false))
+			informer.Update(testCluster("default", false), testCluster("default", true))
+		}()
+
+		event := Event{}
+		var line string
+		Eventually(stream.lines).Should(Receive(&line))
+		Expect(json.Unmarshal([]byte(line), &event)).To(Succeed())
+		Expect(event.Type).To(Equal(EventAdded))
+		Expect(event.Object.Namespace).To(Equal("default"))
+		Expect(event.Object.Ready).To(BeFalse())
+		Eventually(stream.lines).Should(Receive(&line))
+		Expect(json.Unmarshal([]byte(line), &event)).To(Succeed())
+		Expect(event.Type).To(Equal(EventModified))
+		Expect(event.Object.Ready).To(BeTrue())
+	})
+})
+
+// streamRecorder is a http.ResponseWriter passing every written line to the test as soon as it is written.
+type streamRecorder struct {
+	header  http.Header
+	started chan int
+	lines   chan string
+}
+
+func (s *streamRecorder) Header() http.Header {
+	return s.header
+}
+
+func (s *streamRecorder) WriteHeader(code int) {
+	s.started <- code
+}
+
+func (s *streamRecorder) Write(b []byte) (int, error) {
+	s.lines <- strings.TrimSpace(string(b))
+	return len(b), nil
+}
+
+func (s *streamRecorder) Flush() {}
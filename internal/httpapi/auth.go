@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups="authentication.k8s.io",resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups="authorization.k8s.io",resources=subjectaccessreviews,verbs=create
+
+// Authorize authenticates the request bearer token with a TokenReview and checks the caller is allowed
+// to perform the action with a SubjectAccessReview. It returns HTTP status code to respond with
+// if the request is not allowed.
+func Authorize(ctx context.Context, c client.Client, r *http.Request, attributes authorizationv1.ResourceAttributes) (int, error) {
+	resource := attributes.Resource
+	if attributes.Subresource != "" {
+		resource += "/" + attributes.Subresource
+	}
+	action := fmt.Sprintf("%s %s in namespace %q", attributes.Verb, resource, attributes.Namespace)
+	return authorize(ctx, c, r, authorizationv1.SubjectAccessReviewSpec{ResourceAttributes: &attributes}, action)
+}
+
+// AuthorizeNonResource is Authorize for non-resource URLs, like /debug/pprof/ of the API server.
+func AuthorizeNonResource(ctx context.Context, c client.Client, r *http.Request, attributes authorizationv1.NonResourceAttributes) (int, error) {
+	action := fmt.Sprintf("%s %s", attributes.Verb, attributes.Path)
+	return authorize(ctx, c, r, authorizationv1.SubjectAccessReviewSpec{NonResourceAttributes: &attributes}, action)
+}
+
+// authorize reviews the caller of the request against the spec with attributes set, action describes
+// the attributes in the error returned if the caller is not allowed.
+func authorize(ctx context.Context, c client.Client, r *http.Request, spec authorizationv1.SubjectAccessReviewSpec, action string) (int, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return http.StatusUnauthorized, errors.New("bearer token is required")
+	}
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := c.Create(ctx, review); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("cannot review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return http.StatusUnauthorized, errors.New("invalid bearer token")
+	}
+
+	user := review.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	spec.User = user.Username
+	spec.UID = user.UID
+	spec.Groups = user.Groups
+	spec.Extra = extra
+	access := &authorizationv1.SubjectAccessReview{Spec: spec}
+	if err := c.Create(ctx, access); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("cannot review access: %w", err)
+	}
+	if !access.Status.Allowed {
+		return http.StatusForbidden, fmt.Errorf("user %q cannot %s", user.Username, action)
+	}
+	return 0, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package inspect implements the HTTP API exposing read-only etcdctl operations on managed clusters.
+// Requests are authenticated with the Kubernetes bearer token of the caller and authorized against
+// the etcdclusters/etcdctl subresource, so the API can be granted to users without pods/exec permission.
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+	"github.com/aenix-io/etcd-operator/internal/httpapi"
+)
+
+// Operation is a read-only etcdctl operation available through the API.
+type Operation string
+
+const (
+	// OperationEndpointStatus is the equivalent of `etcdctl endpoint status --cluster`.
+	OperationEndpointStatus Operation = "endpoint-status"
+	// OperationMemberList is the equivalent of `etcdctl member list`.
+	OperationMemberList Operation = "member-list"
+	// OperationAlarmList is the equivalent of `etcdctl alarm list`.
+	OperationAlarmList Operation = "alarm-list"
+
+	// Subresource is the EtcdCluster subresource callers need `get` permission on.
+	Subresource = "etcdctl"
+
+	requestTimeout = 10 * time.Second
+)
+
+// Server serves read-only etcdctl operations on managed clusters.
+type Server struct {
+	// BindAddress is the address the server listens on.
+	BindAddress string
+	// CertDir is the directory with tls.crt and tls.key serving certificate.
+	// Self-signed certificate is generated if it is empty.
+	CertDir string
+	// Client is used to read clusters and their secrets and to review callers' tokens and permissions.
+	Client client.Client
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, the API is served by every replica.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+func (s *Server) Start(ctx context.Context) error {
+	return httpapi.Serve(ctx, s.BindAddress, s.CertDir, s.Handler())
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /namespaces/{namespace}/etcdclusters/{name}/{operation}", s.handleOperation)
+	return mux
+}
+
+func (s *Server) handleOperation(w http.ResponseWriter, r *http.Request) {
+	key := types.NamespacedName{Namespace: r.PathValue("namespace"), Name: r.PathValue("name")}
+	operation := Operation(r.PathValue("operation"))
+	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+	defer cancel()
+
+	if code, err := s.authorize(ctx, r, key); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	switch operation {
+	case OperationEndpointStatus, OperationMemberList, OperationAlarmList:
+	default:
+		http.Error(w, fmt.Sprintf("unsupported operation %q", operation), http.StatusNotFound)
+		return
+	}
+
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+	if err := s.Client.Get(ctx, key, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.Error(w, fmt.Sprintf("cluster %s not found", key), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cli, err := etcd.NewClusterClient(ctx, s.Client, cluster)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot create etcd client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		_ = cli.Close()
+	}()
+
+	var result any
+	switch operation {
+	case OperationEndpointStatus:
+		result = etcd.GetEndpointStatus(ctx, cli)
+	case OperationMemberList:
+		result, err = etcd.ListMembers(ctx, cli)
+	case OperationAlarmList:
+		result, err = etcd.ListAlarms(ctx, cli)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// authorize checks the caller is allowed to get etcdctl subresource of the cluster.
+func (s *Server) authorize(ctx context.Context, r *http.Request, key types.NamespacedName) (int, error) {
+	return httpapi.Authorize(ctx, s.Client, r, authorizationv1.ResourceAttributes{
+		Namespace:   key.Namespace,
+		Name:        key.Name,
+		Verb:        "get",
+		Group:       etcdaenixiov1alpha1.GroupVersion.Group,
+		Resource:    "etcdclusters",
+		Subresource: Subresource,
+	})
+}
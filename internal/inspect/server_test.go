@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inspect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const validToken = "valid-token"
+
+var _ = Describe("etcdctl API", func() {
+	var (
+		server  *Server
+		allowed bool
+		checked *authorizationv1.ResourceAttributes
+	)
+
+	BeforeEach(func() {
+		allowed = false
+		checked = nil
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		server = &Server{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					switch review := obj.(type) {
+					case *authenticationv1.TokenReview:
+						review.Status.Authenticated = review.Spec.Token == validToken
+						review.Status.User.Username = "alice"
+					case *authorizationv1.SubjectAccessReview:
+						checked = review.Spec.ResourceAttributes
+						review.Status.Allowed = allowed
+					}
+					return nil
+				},
+			}).Build(),
+		}
+	})
+
+	serve := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	It("should require authentication", func() {
+		Expect(serve("/namespaces/default/etcdclusters/test/member-list", "")).To(Equal(http.StatusUnauthorized))
+		Expect(serve("/namespaces/default/etcdclusters/test/member-list", "invalid")).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should check permission on the etcdctl subresource of the cluster", func() {
+		Expect(serve("/namespaces/default/etcdclusters/test/member-list", validToken)).To(Equal(http.StatusForbidden))
+		Expect(checked).ToNot(BeNil())
+		Expect(checked.Namespace).To(Equal("default"))
+		Expect(checked.Name).To(Equal("test"))
+		Expect(checked.Verb).To(Equal("get"))
+		Expect(checked.Resource).To(Equal("etcdclusters"))
+		Expect(checked.Subresource).To(Equal(Subresource))
+	})
+
+	It("should reject operations which are not whitelisted", func() {
+		allowed = true
+		Expect(serve("/namespaces/default/etcdclusters/test/del", validToken)).To(Equal(http.StatusNotFound))
+		req := httptest.NewRequest(http.MethodPost, "/namespaces/default/etcdclusters/test/member-list", nil)
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("should report missing cluster", func() {
+		allowed = true
+		Expect(serve("/namespaces/default/etcdclusters/test/alarm-list", validToken)).To(Equal(http.StatusNotFound))
+	})
+})
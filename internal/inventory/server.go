@@ -0,0 +1,162 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package inventory serves the inventory of managed clusters as JSON to CMDB and asset management systems which
+// can't list custom resources. Callers are authorized with their Kubernetes bearer tokens against listing
+// etcdclusters in all namespaces.
+package inventory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/httpapi"
+)
+
+// Health is the health of a cluster in the inventory.
+type Health string
+
+const (
+	HealthHealthy    Health = "Healthy"
+	HealthDegraded   Health = "Degraded"
+	HealthQuorumLost Health = "QuorumLost"
+	HealthUnknown    Health = "Unknown"
+)
+
+// Cluster is the inventory record of a single cluster.
+type Cluster struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid"`
+	// Image is the etcd image of members.
+	Image string `json:"image"`
+	// Version is the etcd version of the image, empty if the image tag is not a version.
+	Version string `json:"version,omitempty"`
+	// Replicas is the desired number of members.
+	Replicas int32 `json:"replicas"`
+	// DBSize is the largest database size among members.
+	DBSize string `json:"dbSize,omitempty"`
+	Health Health `json:"health"`
+	// LastBackupTime and LastBackupKey identify the last periodic snapshot.
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+	LastBackupKey  string       `json:"lastBackupKey,omitempty"`
+}
+
+// Server serves the inventory of managed clusters.
+type Server struct {
+	// BindAddress is the address the server listens on.
+	BindAddress string
+	// CertDir is the directory with tls.crt and tls.key serving certificate.
+	// Self-signed certificate is generated if it is empty.
+	CertDir string
+	// Client is used to read clusters and to review callers' tokens and permissions.
+	Client client.Client
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, the inventory is served by every replica.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+func (s *Server) Start(ctx context.Context) error {
+	return httpapi.Serve(ctx, s.BindAddress, s.CertDir, s.Handler())
+}
+
+// Handler returns the HTTP handler serving the inventory at /inventory.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /inventory", s.handleInventory)
+	return mux
+}
+
+func (s *Server) handleInventory(w http.ResponseWriter, r *http.Request) {
+	code, err := httpapi.Authorize(r.Context(), s.Client, r, authorizationv1.ResourceAttributes{
+		Verb:     "list",
+		Group:    etcdaenixiov1alpha1.GroupVersion.Group,
+		Resource: "etcdclusters",
+	})
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	clusters := &etcdaenixiov1alpha1.EtcdClusterList{}
+	if err = s.Client.List(r.Context(), clusters); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]Cluster, 0, len(clusters.Items))
+	for i := range clusters.Items {
+		items = append(items, Record(&clusters.Items[i]))
+	}
+	slices.SortFunc(items, func(a, b Cluster) int {
+		return cmp.Or(strings.Compare(a.Namespace, b.Namespace), strings.Compare(a.Name, b.Name))
+	})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// Record builds the inventory record of the cluster from its spec and status.
+func Record(cluster *etcdaenixiov1alpha1.EtcdCluster) Cluster {
+	record := Cluster{
+		Namespace: cluster.Namespace,
+		Name:      cluster.Name,
+		UID:       string(cluster.UID),
+		Image:     cluster.EtcdImage(),
+		Health:    health(cluster),
+	}
+	if v := cluster.EtcdVersion(); v != nil {
+		record.Version = v.String()
+	}
+	if cluster.Spec.Replicas != nil {
+		record.Replicas = *cluster.Spec.Replicas
+	}
+	if cluster.Status.DBSize != nil {
+		record.DBSize = cluster.Status.DBSize.String()
+	}
+	if backup := cluster.Status.Backup; backup != nil {
+		record.LastBackupTime = backup.LastSnapshotTime
+		record.LastBackupKey = backup.LastSnapshotKey
+	}
+	return record
+}
+
+// health summarizes Ready and QuorumLost conditions of the cluster.
+func health(cluster *etcdaenixiov1alpha1.EtcdCluster) Health {
+	conditions := cluster.Status.Conditions
+	ready := meta.FindStatusCondition(conditions, etcdaenixiov1alpha1.EtcdConditionReady)
+	switch {
+	case meta.IsStatusConditionTrue(conditions, etcdaenixiov1alpha1.EtcdConditionQuorumLost):
+		return HealthQuorumLost
+	case ready == nil || ready.Status == metav1.ConditionUnknown:
+		return HealthUnknown
+	case ready.Status == metav1.ConditionTrue:
+		return HealthHealthy
+	default:
+		return HealthDegraded
+	}
+}
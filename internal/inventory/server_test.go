@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+func testCluster(namespace string, conditions ...metav1.Condition) *etcdaenixiov1alpha1.EtcdCluster {
+	return &etcdaenixiov1alpha1.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "test"},
+		Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+			Replicas: ptr.To(int32(3)),
+			PodTemplate: etcdaenixiov1alpha1.PodTemplate{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "etcd", Image: "quay.io/coreos/etcd:v3.5.13"}}},
+			},
+		},
+		Status: etcdaenixiov1alpha1.EtcdClusterStatus{Conditions: conditions},
+	}
+}
+
+var _ = Describe("Inventory", func() {
+	var (
+		server  *Server
+		checked *authorizationv1.ResourceAttributes
+	)
+
+	BeforeEach(func() {
+		checked = nil
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		ready := testCluster("default", metav1.Condition{Type: etcdaenixiov1alpha1.EtcdConditionReady, Status: metav1.ConditionTrue})
+		ready.Status.DBSize = ptr.To(resource.MustParse("64Mi"))
+		ready.Status.Backup = &etcdaenixiov1alpha1.ClusterBackupStatus{
+			LastSnapshotTime: &metav1.Time{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+			LastSnapshotKey:  "default/test/1.db",
+		}
+		server = &Server{
+			Client: fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(ready, testCluster("other",
+					metav1.Condition{Type: etcdaenixiov1alpha1.EtcdConditionReady, Status: metav1.ConditionFalse},
+					metav1.Condition{Type: etcdaenixiov1alpha1.EtcdConditionQuorumLost, Status: metav1.ConditionTrue},
+				)).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+						switch review := obj.(type) {
+						case *authenticationv1.TokenReview:
+							review.Status.Authenticated = review.Spec.Token == "valid-token"
+						case *authorizationv1.SubjectAccessReview:
+							checked = review.Spec.ResourceAttributes
+							review.Status.Allowed = true
+						}
+						return nil
+					},
+				}).Build(),
+		}
+	})
+
+	serve := func(ctx context.Context, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/inventory", nil).WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("should summarize health of clusters", func() {
+		Expect(Record(testCluster("default")).Health).To(Equal(HealthUnknown))
+		Expect(Record(testCluster("default",
+			metav1.Condition{Type: etcdaenixiov1alpha1.EtcdConditionReady, Status: metav1.ConditionFalse},
+		)).Health).To(Equal(HealthDegraded))
+	})
+
+	It("should serve records of clusters in all namespaces", func(ctx SpecContext) {
+		rec := serve(ctx, "valid-token")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var items []Cluster
+		Expect(json.Unmarshal(rec.Body.Bytes(), &items)).To(Succeed())
+		Expect(items).To(HaveLen(2))
+		Expect(items[0].Namespace).To(Equal("default"))
+		Expect(items[0].Image).To(Equal("quay.io/coreos/etcd:v3.5.13"))
+		Expect(items[0].Version).To(Equal("3.5.13"))
+		Expect(items[0].Replicas).To(Equal(int32(3)))
+		Expect(items[0].DBSize).To(Equal("64Mi"))
+		Expect(items[0].Health).To(Equal(HealthHealthy))
+		Expect(items[0].LastBackupKey).To(Equal("default/test/1.db"))
+		Expect(items[1].Namespace).To(Equal("other"))
+		Expect(items[1].Health).To(Equal(HealthQuorumLost))
+		Expect(checked.Verb).To(Equal("list"))
+		Expect(checked.Resource).To(Equal("etcdclusters"))
+		Expect(checked.Namespace).To(BeEmpty())
+	})
+
+	It("should reject unauthenticated callers", func(ctx SpecContext) {
+		Expect(serve(ctx, "invalid-token").Code).To(Equal(http.StatusUnauthorized))
+	})
+})
@@ -0,0 +1,124 @@
+package k8sutils
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// maxDiffValueLength is the length values of changed fields are truncated to.
+const maxDiffValueLength = 64
+
+// ignoredDiffPaths are paths maintained by the API server, which change with every write.
+var ignoredDiffPaths = []string{
+	"metadata.creationTimestamp",
+	"metadata.generation",
+	"metadata.managedFields",
+	"metadata.resourceVersion",
+	"metadata.selfLink",
+	"metadata.uid",
+	"status",
+}
+
+// FieldChange is a change of a single field between two versions of an object.
+type FieldChange struct {
+	// Path is the path of the field, such as spec.template.spec.containers[0].image.
+	Path string
+	// Old and New are values of the field, nil if the field is not set.
+	Old, New any
+	// Redacted is true if values must not be revealed, e.g. values of Secret data.
+	Redacted bool
+}
+
+// String formats the change as "path: old -> new".
+func (c FieldChange) String() string {
+	if c.Redacted {
+		return c.Path + ": changed"
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Path, formatDiffValue(c.Old), formatDiffValue(c.New))
+}
+
+// Diff returns changes of fields between the old and the new version of the object, sorted by path. Status and
+// metadata maintained by the API server are ignored. Values of Secret data are redacted.
+func Diff(old, new runtime.Object) ([]FieldChange, error) {
+	oldFields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(old)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert object to unstructured: %w", err)
+	}
+	newFields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(new)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert object to unstructured: %w", err)
+	}
+	_, secret := new.(*corev1.Secret)
+	var changes []FieldChange
+	diffValues("", oldFields, newFields, func(change FieldChange) {
+		if slices.Contains(ignoredDiffPaths, change.Path) {
+			return
+		}
+		change.Redacted = secret && (strings.HasPrefix(change.Path, "data") || strings.HasPrefix(change.Path, "stringData"))
+		changes = append(changes, change)
+	})
+	slices.SortFunc(changes, func(a, b FieldChange) int { return strings.Compare(a.Path, b.Path) })
+	return changes, nil
+}
+
+// diffValues reports changed leaves of the values. Lists of different lengths are reported as a whole.
+func diffValues(path string, old, new any, report func(FieldChange)) {
+	if slices.Contains(ignoredDiffPaths, path) {
+		return
+	}
+	switch oldValue := old.(type) {
+	case map[string]any:
+		if newValue, ok := new.(map[string]any); ok {
+			for key := range oldValue {
+				diffValues(joinDiffPath(path, key), oldValue[key], newValue[key], report)
+			}
+			for key := range newValue {
+				if _, ok := oldValue[key]; !ok {
+					diffValues(joinDiffPath(path, key), nil, newValue[key], report)
+				}
+			}
+			return
+		}
+	case []any:
+		if newValue, ok := new.([]any); ok && len(oldValue) == len(newValue) {
+			for i := range oldValue {
+				diffValues(fmt.Sprintf("%s[%d]", path, i), oldValue[i], newValue[i], report)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(old, new) {
+		report(FieldChange{Path: path, Old: old, New: new})
+	}
+}
+
+func joinDiffPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// formatDiffValue formats the value compactly, nested objects and lists are summarized.
+func formatDiffValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "<unset>"
+	case map[string]any:
+		return fmt.Sprintf("{%d fields}", len(v))
+	case []any:
+		return fmt.Sprintf("[%d items]", len(v))
+	case string:
+		if len(v) > maxDiffValueLength {
+			v = v[:maxDiffValueLength] + "..."
+		}
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
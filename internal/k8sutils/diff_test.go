@@ -0,0 +1,50 @@
+package k8sutils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Diff", func() {
+	statefulSet := func(image string, replicas int32, resourceVersion string) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", ResourceVersion: resourceVersion},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: ptr.To(replicas),
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "etcd", Image: image}},
+				}},
+			},
+			Status: appsv1.StatefulSetStatus{ReadyReplicas: replicas},
+		}
+	}
+
+	It("should report changed fields only", func() {
+		changes, err := Diff(statefulSet("etcd:v3.5.12", 3, "1"), statefulSet("etcd:v3.5.13", 5, "2"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(2))
+		Expect(changes[0].String()).To(Equal("spec.replicas: 3 -> 5"))
+		Expect(changes[1].String()).To(Equal(`spec.template.spec.containers[0].image: "etcd:v3.5.12" -> "etcd:v3.5.13"`))
+
+		changes, err = Diff(statefulSet("etcd:v3.5.12", 3, "1"), statefulSet("etcd:v3.5.12", 3, "2"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(BeEmpty())
+	})
+
+	It("should summarize added fields and redact secret data", func() {
+		old := &corev1.Secret{Data: map[string][]byte{"password": []byte("old")}}
+		new := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"a": "b", "c": "d"}},
+			Data:       map[string][]byte{"password": []byte("new")},
+		}
+		changes, err := Diff(old, new)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(2))
+		Expect(changes[0].String()).To(Equal("data.password: changed"))
+		Expect(changes[1].String()).To(Equal("metadata.labels: <unset> -> {2 fields}"))
+	})
+})
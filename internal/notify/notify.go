@@ -0,0 +1,223 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends notifications of lifecycle events of clusters to sinks, such as webhooks, Slack-compatible
+// incoming webhooks and CloudEvents receivers.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+const (
+	// sendTimeout bounds reading the sink URL and posting a notification.
+	sendTimeout = 10 * time.Second
+	// repeatInterval is the time during which the same event of a cluster is not notified again, so events
+	// repeated with every reconciliation don't flood sinks.
+	repeatInterval = 10 * time.Minute
+	// cloudEventTypePrefix prefixes event names in types of CloudEvents.
+	cloudEventTypePrefix = "io.aenix.etcd.cluster."
+)
+
+// reasonEvents maps reasons of Kubernetes events recorded for clusters to lifecycle events sinks are notified of.
+var reasonEvents = map[string]etcdaenixiov1alpha1.NotificationEvent{
+	"Created":                    etcdaenixiov1alpha1.NotificationCreated,
+	"Ready":                      etcdaenixiov1alpha1.NotificationReady,
+	"Degraded":                   etcdaenixiov1alpha1.NotificationDegraded,
+	"SnapshotTaken":              etcdaenixiov1alpha1.NotificationBackupCompleted,
+	"SnapshotFailed":             etcdaenixiov1alpha1.NotificationBackupFailed,
+	"SnapshotVerificationFailed": etcdaenixiov1alpha1.NotificationBackupFailed,
+	"QuorumLost":                 etcdaenixiov1alpha1.NotificationQuorumLost,
+	"UpgradeCompleted":           etcdaenixiov1alpha1.NotificationUpgradeCompleted,
+}
+
+var logger = ctrl.Log.WithName("notify")
+
+// Notification is a structured notification of a lifecycle event of a cluster.
+type Notification struct {
+	Event     etcdaenixiov1alpha1.NotificationEvent `json:"event"`
+	Namespace string                                `json:"namespace"`
+	Cluster   string                                `json:"cluster"`
+	Message   string                                `json:"message"`
+	Time      time.Time                             `json:"time"`
+}
+
+// Recorder records events and notifies sinks of lifecycle events of clusters the events stand for. Sinks are
+// notified asynchronously, so slow sinks never delay reconciliation.
+type Recorder struct {
+	record.EventRecorder
+	// Reader reads Secrets with URLs of sinks.
+	Reader client.Reader
+	// Sinks are notified of events of all clusters. They can't reference Secrets.
+	Sinks []etcdaenixiov1alpha1.NotificationSink
+	// HTTPClient posts notifications, http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	sent sync.Map
+}
+
+// Event implements record.EventRecorder.
+func (r *Recorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.EventRecorder.Event(object, eventtype, reason, message)
+	r.notify(object, reason, message)
+}
+
+// Eventf implements record.EventRecorder.
+func (r *Recorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf implements record.EventRecorder.
+func (r *Recorder) AnnotatedEventf(
+	object runtime.Object,
+	annotations map[string]string,
+	eventtype, reason, messageFmt string,
+	args ...interface{},
+) {
+	message := fmt.Sprintf(messageFmt, args...)
+	r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+	r.notify(object, reason, message)
+}
+
+// notify sends the notification of the event to sinks of the operator and of the cluster notified of it.
+func (r *Recorder) notify(object runtime.Object, reason, message string) {
+	cluster, ok := object.(*etcdaenixiov1alpha1.EtcdCluster)
+	if !ok {
+		return
+	}
+	event, ok := reasonEvents[reason]
+	if !ok {
+		return
+	}
+	var sinks []etcdaenixiov1alpha1.NotificationSink
+	for _, sinkList := range [][]etcdaenixiov1alpha1.NotificationSink{r.Sinks, cluster.Spec.Notifications} {
+		for _, sink := range sinkList {
+			if sink.Notifies(event) {
+				sinks = append(sinks, *sink.DeepCopy())
+			}
+		}
+	}
+	if len(sinks) == 0 {
+		return
+	}
+
+	now := time.Now()
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}.String() + "/" + string(event)
+	if last, ok := r.sent.Load(key); ok && now.Sub(last.(time.Time)) < repeatInterval {
+		return
+	}
+	r.sent.Store(key, now)
+
+	notification := Notification{
+		Event:     event,
+		Namespace: cluster.Namespace,
+		Cluster:   cluster.Name,
+		Message:   message,
+		Time:      now.UTC(),
+	}
+	for _, sink := range sinks {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+			if err := r.send(ctx, sink, notification); err != nil {
+				logger.Error(err, "cannot send notification", "sink", sink.Name, "event", event,
+					"namespace", cluster.Namespace, "cluster", cluster.Name)
+			}
+		}()
+	}
+}
+
+// send posts the notification to the sink in its format.
+func (r *Recorder) send(ctx context.Context, sink etcdaenixiov1alpha1.NotificationSink, notification Notification) error {
+	url := sink.URL
+	if ref := sink.URLSecretRef; ref != nil {
+		secret := &corev1.Secret{}
+		if err := r.Reader.Get(ctx, types.NamespacedName{Namespace: notification.Namespace, Name: ref.Name}, secret); err != nil {
+			return fmt.Errorf("cannot get secret %s with the sink URL: %w", ref.Name, err)
+		}
+		url = string(secret.Data[ref.Key])
+		if url == "" {
+			return fmt.Errorf("secret %s has no key %s with the sink URL", ref.Name, ref.Key)
+		}
+	}
+
+	contentType, body, err := Encode(sink.Type, notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	httpClient := r.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sink responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// Encode returns the content type and the body of the notification posted to sinks of the type.
+func Encode(sinkType etcdaenixiov1alpha1.NotificationSinkType, notification Notification) (string, []byte, error) {
+	var payload any
+	contentType := "application/json"
+	switch sinkType {
+	case etcdaenixiov1alpha1.NotificationSinkSlack:
+		payload = map[string]string{
+			"text": fmt.Sprintf("*%s* of etcd cluster %s/%s: %s",
+				notification.Event, notification.Namespace, notification.Cluster, notification.Message),
+		}
+	case etcdaenixiov1alpha1.NotificationSinkCloudEvents:
+		contentType = "application/cloudevents+json"
+		payload = map[string]any{
+			"specversion":     "1.0",
+			"id":              string(uuid.NewUUID()),
+			"type":            cloudEventTypePrefix + string(notification.Event),
+			"source":          fmt.Sprintf("/apis/%s/namespaces/%s/etcdclusters/%s", etcdaenixiov1alpha1.GroupVersion, notification.Namespace, notification.Cluster),
+			"time":            notification.Time.Format(time.RFC3339),
+			"datacontenttype": "application/json",
+			"data":            notification,
+		}
+	default:
+		payload = notification
+	}
+	body, err := json.Marshal(payload)
+	return contentType, body, err
+}
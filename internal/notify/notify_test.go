@@ -0,0 +1,144 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Recorder", func() {
+	var (
+		server *httptest.Server
+		bodies chan []byte
+	)
+
+	BeforeEach(func() {
+		bodies = make(chan []byte, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			bodies <- body
+		}))
+		DeferCleanup(server.Close)
+	})
+
+	It("should notify sinks of lifecycle events of clusters once", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "etcd"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Notifications: []etcdaenixiov1alpha1.NotificationSink{{
+					Name:   "upgrades",
+					Type:   etcdaenixiov1alpha1.NotificationSinkSlack,
+					URL:    server.URL,
+					Events: []etcdaenixiov1alpha1.NotificationEvent{etcdaenixiov1alpha1.NotificationUpgradeCompleted},
+				}},
+			},
+		}
+		events := record.NewFakeRecorder(10)
+		recorder := &Recorder{
+			EventRecorder: events,
+			Sinks: []etcdaenixiov1alpha1.NotificationSink{{
+				Name: "ops",
+				Type: etcdaenixiov1alpha1.NotificationSinkWebhook,
+				URL:  server.URL,
+			}},
+		}
+
+		recorder.Eventf(cluster, corev1.EventTypeWarning, "QuorumLost", "Less than quorum of members is healthy")
+		recorder.Eventf(cluster, corev1.EventTypeWarning, "QuorumLost", "Less than quorum of members is healthy")
+		recorder.Eventf(cluster, corev1.EventTypeNormal, "MemberRestarted", "Member etcd-0 is restarted")
+		Expect(events.Events).To(HaveLen(3))
+
+		var body []byte
+		Eventually(bodies).Should(Receive(&body))
+		notification := Notification{}
+		Expect(json.Unmarshal(body, &notification)).To(Succeed())
+		Expect(notification.Event).To(Equal(etcdaenixiov1alpha1.NotificationQuorumLost))
+		Expect(notification.Namespace).To(Equal("db"))
+		Expect(notification.Cluster).To(Equal("etcd"))
+		Expect(notification.Message).To(Equal("Less than quorum of members is healthy"))
+		Consistently(bodies, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should emit CloudEvents of lifecycle transitions of clusters", func() {
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "etcd"}}
+		recorder := &Recorder{
+			EventRecorder: record.NewFakeRecorder(10),
+			Sinks: []etcdaenixiov1alpha1.NotificationSink{{
+				Name: "audit",
+				Type: etcdaenixiov1alpha1.NotificationSinkCloudEvents,
+				URL:  server.URL,
+			}},
+		}
+
+		recorder.Event(cluster, corev1.EventTypeNormal, "Created", "Created members and auxiliary objects of the cluster")
+		recorder.Event(cluster, corev1.EventTypeNormal, "Ready", "All members are ready")
+		recorder.Event(cluster, corev1.EventTypeWarning, "Degraded", "Not all members are ready")
+		recorder.Eventf(cluster, corev1.EventTypeNormal, "SnapshotTaken", "Took snapshot %s", "db/etcd/1.db")
+
+		var types []string
+		for range 4 {
+			var body []byte
+			Eventually(bodies).Should(Receive(&body))
+			event := map[string]any{}
+			Expect(json.Unmarshal(body, &event)).To(Succeed())
+			types = append(types, event["type"].(string))
+		}
+		Expect(types).To(ConsistOf(
+			"io.aenix.etcd.cluster.Created",
+			"io.aenix.etcd.cluster.Ready",
+			"io.aenix.etcd.cluster.Degraded",
+			"io.aenix.etcd.cluster.BackupCompleted",
+		))
+	})
+
+	It("should encode notifications as CloudEvents and Slack messages", func() {
+		notification := Notification{
+			Event:     etcdaenixiov1alpha1.NotificationBackupFailed,
+			Namespace: "db",
+			Cluster:   "etcd",
+			Message:   "Cannot take snapshot: timeout",
+			Time:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		}
+
+		contentType, body, err := Encode(etcdaenixiov1alpha1.NotificationSinkCloudEvents, notification)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(contentType).To(Equal("application/cloudevents+json"))
+		event := map[string]any{}
+		Expect(json.Unmarshal(body, &event)).To(Succeed())
+		Expect(event).To(HaveKeyWithValue("specversion", "1.0"))
+		Expect(event).To(HaveKeyWithValue("type", "io.aenix.etcd.cluster.BackupFailed"))
+		Expect(event).To(HaveKeyWithValue("source", "/apis/etcd.aenix.io/v1alpha1/namespaces/db/etcdclusters/etcd"))
+		Expect(event).To(HaveKeyWithValue("time", "2024-05-01T12:00:00Z"))
+		Expect(event).To(HaveKey("id"))
+
+		_, body, err = Encode(etcdaenixiov1alpha1.NotificationSinkSlack, notification)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal(`{"text":"*BackupFailed* of etcd cluster db/etcd: Cannot take snapshot: timeout"}`))
+	})
+})
@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package protection implements webhooks protecting objects clusters depend on from deletion.
+package protection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/backup"
+)
+
+// Mode defines how deletion of objects in use by clusters is handled.
+type Mode string
+
+const (
+	// ModeBlock refuses deletion of objects in use.
+	ModeBlock Mode = "block"
+	// ModeWarn admits deletion of objects in use with a warning.
+	ModeWarn Mode = "warn"
+	// ModeDisabled admits deletion of any objects.
+	ModeDisabled Mode = "disabled"
+)
+
+// ParseMode parses the protection mode.
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case ModeBlock, ModeWarn, ModeDisabled:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown protection mode %q, expected %s, %s or %s", s, ModeBlock, ModeWarn, ModeDisabled)
+	}
+}
+
+// +kubebuilder:webhook:path=/validate--v1-secret,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=secrets,verbs=delete,versions=v1,name=vsecret.etcd.aenix.io,admissionReviewVersions=v1
+
+// SecretValidator protects Secrets with backup storage credentials of clusters from deletion, so backups and
+// restores of the clusters don't break silently. Clusters being deleted don't protect their Secrets.
+type SecretValidator struct {
+	Client client.Reader
+	Mode   Mode
+}
+
+var _ webhook.CustomValidator = &SecretValidator{}
+
+// SetupWebhookWithManager registers the webhook in the manager.
+func (v *SecretValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&corev1.Secret{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate implements webhook.CustomValidator, Secrets are validated on deletion only.
+func (v *SecretValidator) ValidateCreate(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateUpdate implements webhook.CustomValidator, Secrets are validated on deletion only.
+func (v *SecretValidator) ValidateUpdate(context.Context, runtime.Object, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateDelete refuses deletion of the Secret or warns about it if clusters use it as backup storage credentials.
+func (v *SecretValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || v.Mode == ModeDisabled {
+		return nil, nil
+	}
+	users, err := v.backupUsers(ctx, secret)
+	if err != nil {
+		// like unavailability of the webhook, failures to check don't block deletion
+		return admission.Warnings{fmt.Sprintf("cannot check whether EtcdClusters use secret %s: %v", secret.Name, err)}, nil
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	message := fmt.Sprintf("secret %s holds backup storage credentials of EtcdClusters %s", secret.Name, strings.Join(users, ", "))
+	if v.Mode == ModeWarn {
+		return admission.Warnings{message + ", their backups will fail"}, nil
+	}
+	return nil, apierrors.NewForbidden(corev1.Resource("secrets"), secret.Name,
+		errors.New(message+", remove references to it from the clusters first"))
+}
+
+// backupUsers returns names of clusters requiring the Secret to reach their backup storage.
+func (v *SecretValidator) backupUsers(ctx context.Context, secret *corev1.Secret) ([]string, error) {
+	clusters := &etcdaenixiov1alpha1.EtcdClusterList{}
+	if err := v.Client.List(ctx, clusters, client.InNamespace(secret.Namespace)); err != nil {
+		return nil, fmt.Errorf("cannot list clusters: %w", err)
+	}
+	var users []string
+	for _, cluster := range clusters.Items {
+		// clusters without backups configured use the default backup policy of the operator
+		cluster.ApplyDefaultBackupPolicy()
+		if !cluster.DeletionTimestamp.IsZero() || cluster.Spec.Backup == nil {
+			continue
+		}
+		if slices.ContainsFunc(cluster.Spec.Backup.AllDestinations(), func(destination *etcdaenixiov1alpha1.BackupDestination) bool {
+			for _, ref := range backup.CredentialRefs(destination) {
+				if ref.Name == secret.Name && !ptr.Deref(ref.Optional, false) {
+					return true
+				}
+			}
+			return false
+		}) {
+			users = append(users, cluster.Name)
+		}
+	}
+	slices.Sort(users)
+	return users, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protection
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Secret deletion protection", func() {
+	var validator *SecretValidator
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Backup: &etcdaenixiov1alpha1.ClusterBackupSpec{
+					Destination: etcdaenixiov1alpha1.BackupDestination{
+						S3: &etcdaenixiov1alpha1.S3Destination{Bucket: "backups", CredentialsSecret: "s3"},
+					},
+				},
+			},
+		}
+		validator = &SecretValidator{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).Build(),
+			Mode:   ModeBlock,
+		}
+	})
+
+	secret := func(namespace, name string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+
+	It("should block deletion of backup credentials in use", func(ctx SpecContext) {
+		_, err := validator.ValidateDelete(ctx, secret("ns", "s3"))
+		Expect(err).To(MatchError(ContainSubstring("secret s3 holds backup storage credentials of EtcdClusters test")))
+	})
+
+	It("should warn about deletion of backup credentials in use", func(ctx SpecContext) {
+		validator.Mode = ModeWarn
+		warnings, err := validator.ValidateDelete(ctx, secret("ns", "s3"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf(ContainSubstring("their backups will fail")))
+	})
+
+	It("should admit deletion of secrets not in use", func(ctx SpecContext) {
+		Expect(validator.ValidateDelete(ctx, secret("ns", "other"))).To(BeEmpty())
+		Expect(validator.ValidateDelete(ctx, secret("other", "s3"))).To(BeEmpty())
+	})
+})
@@ -0,0 +1,250 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package registry reads image manifests from container registries.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+	// maxManifestSize limits the size of manifests and image configs read.
+	maxManifestSize = 4 << 20
+)
+
+// manifestMediaTypes are media types of manifest lists and manifests accepted from registries.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Client reads manifests of public images, authenticating with anonymous bearer tokens if the registry asks for them.
+type Client struct {
+	// HTTPClient sends requests to registries, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// reference is a parsed image reference.
+type reference struct {
+	registry   string
+	repository string
+	// reference is the tag or the digest of the image.
+	reference string
+}
+
+// parseReference parses an image reference such as quay.io/coreos/etcd:v3.5.12. Images without a registry are
+// pulled from Docker Hub, images without a tag or a digest have the latest tag.
+func parseReference(image string) (reference, error) {
+	ref := reference{registry: dockerHubDomain, repository: image, reference: "latest"}
+	if i := strings.IndexByte(image, '/'); i > 0 {
+		domain := image[:i]
+		if strings.ContainsAny(domain, ".:") || domain == "localhost" {
+			ref.registry, ref.repository = domain, image[i+1:]
+		}
+	}
+	var digest string
+	ref.repository, digest, _ = strings.Cut(ref.repository, "@")
+	if i := strings.LastIndexByte(ref.repository, ':'); i >= 0 {
+		ref.repository, ref.reference = ref.repository[:i], ref.repository[i+1:]
+	}
+	// the tag is ignored if there is a digest
+	if digest != "" {
+		ref.reference = digest
+	}
+	if ref.repository == "" || ref.reference == "" {
+		return reference{}, fmt.Errorf("invalid image reference %q", image)
+	}
+	if ref.registry == dockerHubDomain {
+		ref.registry = dockerHubRegistry
+		if !strings.Contains(ref.repository, "/") {
+			ref.repository = "library/" + ref.repository
+		}
+	}
+	return ref, nil
+}
+
+// manifest is a manifest list, an image index or an image manifest.
+type manifest struct {
+	Manifests []struct {
+		Platform *struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+	Config *struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+}
+
+// imageConfig is the part of an image config describing its platform.
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// Architectures returns the CPU architectures of linux images the image is built for, read from its manifest list,
+// or from the config of a single-platform image.
+func (c *Client) Architectures(ctx context.Context, image string) ([]string, error) {
+	ref, err := parseReference(image)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err = c.get(ctx, ref, "manifests/"+ref.reference, manifestMediaTypes, &m); err != nil {
+		return nil, fmt.Errorf("failed to get manifest of %s: %w", image, err)
+	}
+	var architectures []string
+	if m.Config != nil && m.Config.Digest != "" {
+		var config imageConfig
+		if err = c.get(ctx, ref, "blobs/"+m.Config.Digest, nil, &config); err != nil {
+			return nil, fmt.Errorf("failed to get config of %s: %w", image, err)
+		}
+		if config.OS == "linux" {
+			architectures = append(architectures, config.Architecture)
+		}
+		return architectures, nil
+	}
+	for _, platform := range m.Manifests {
+		// attestation manifests have the unknown platform
+		if platform.Platform == nil || platform.Platform.OS != "linux" ||
+			slices.Contains(architectures, platform.Platform.Architecture) {
+			continue
+		}
+		architectures = append(architectures, platform.Platform.Architecture)
+	}
+	return architectures, nil
+}
+
+// get reads the JSON document at the path of the repository. Unauthorized requests are retried with an anonymous
+// token of the realm the registry returns.
+func (c *Client) get(ctx context.Context, ref reference, path string, accept []string, v any) error {
+	u := fmt.Sprintf("https://%s/v2/%s/%s", ref.registry, ref.repository, path)
+	resp, err := c.do(ctx, u, accept, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		token, err := c.token(ctx, challenge)
+		if err != nil {
+			return err
+		}
+		if resp, err = c.do(ctx, u, accept, token); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(v)
+}
+
+func (c *Client) do(ctx context.Context, u string, accept []string, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// token requests an anonymous token for the bearer challenge of the registry.
+func (c *Client) token(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", errors.New("registry requires credentials")
+	}
+	values := url.Values{}
+	var realm string
+	for _, param := range splitChallengeParams(params) {
+		key, value, _ := strings.Cut(param, "=")
+		value = strings.Trim(value, `"`)
+		switch key = strings.TrimSpace(key); key {
+		case "realm":
+			realm = value
+		case "service", "scope":
+			values.Set(key, value)
+		}
+	}
+	if realm == "" {
+		return "", fmt.Errorf("no realm in challenge %q", challenge)
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid realm %q: %w", realm, err)
+	}
+	u.RawQuery = values.Encode()
+	resp, err := c.do(ctx, u.String(), nil, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s of token request", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+// splitChallengeParams splits parameters of a challenge at commas outside of quoted values,
+// as scopes can contain commas.
+func splitChallengeParams(params string) []string {
+	var result []string
+	quoted, start := false, 0
+	for i, r := range params {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			result = append(result, params[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, params[start:])
+}
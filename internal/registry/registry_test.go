@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		server *httptest.Server
+		client *Client
+	)
+
+	BeforeEach(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("scope") != "repository:coreos/etcd:pull" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"token": "anonymous"}`)
+		})
+		mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer anonymous" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+					`Bearer realm="%s/token",service="registry",scope="repository:coreos/etcd:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch r.URL.Path {
+			case "/v2/coreos/etcd/manifests/v3.5.12":
+				Expect(r.Header.Get("Accept")).To(ContainSubstring("application/vnd.oci.image.index.v1+json"))
+				fmt.Fprint(w, `{"manifests": [
+					{"platform": {"architecture": "amd64", "os": "linux"}},
+					{"platform": {"architecture": "arm64", "os": "linux"}},
+					{"platform": {"architecture": "unknown", "os": "unknown"}},
+					{"platform": {"architecture": "amd64", "os": "windows"}}
+				]}`)
+			case "/v2/coreos/etcd/manifests/sha256:0123":
+				fmt.Fprint(w, `{"config": {"digest": "sha256:4567"}}`)
+			case "/v2/coreos/etcd/blobs/sha256:4567":
+				fmt.Fprint(w, `{"architecture": "ppc64le", "os": "linux"}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+		server = httptest.NewTLSServer(mux)
+		client = &Client{HTTPClient: server.Client()}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Should return linux architectures of the manifest list", func(ctx context.Context) {
+		image := strings.TrimPrefix(server.URL, "https://") + "/coreos/etcd:v3.5.12"
+		Expect(client.Architectures(ctx, image)).To(Equal([]string{"amd64", "arm64"}))
+	})
+
+	It("Should return the architecture of a single-platform image", func(ctx context.Context) {
+		image := strings.TrimPrefix(server.URL, "https://") + "/coreos/etcd:v3.5.12@sha256:0123"
+		Expect(client.Architectures(ctx, image)).To(Equal([]string{"ppc64le"}))
+	})
+
+	It("Should fail for missing images", func(ctx context.Context) {
+		image := strings.TrimPrefix(server.URL, "https://") + "/coreos/etcd:v0.0.0"
+		_, err := client.Architectures(ctx, image)
+		Expect(err).To(MatchError(ContainSubstring("404")))
+	})
+})
+
+var _ = Describe("parseReference", func() {
+	DescribeTable("Should parse image references",
+		func(image string, expected reference) {
+			Expect(parseReference(image)).To(Equal(expected))
+		},
+		Entry("Docker Hub official image", "alpine",
+			reference{registry: "registry-1.docker.io", repository: "library/alpine", reference: "latest"}),
+		Entry("Docker Hub image", "bitnami/etcd:3.5",
+			reference{registry: "registry-1.docker.io", repository: "bitnami/etcd", reference: "3.5"}),
+		Entry("registry with a port", "localhost:5000/etcd:v3.5.12",
+			reference{registry: "localhost:5000", repository: "etcd", reference: "v3.5.12"}),
+		Entry("digest", "quay.io/coreos/etcd:v3.5.12@sha256:0123",
+			reference{registry: "quay.io", repository: "coreos/etcd", reference: "sha256:0123"}),
+	)
+})
@@ -0,0 +1,111 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backupstorage defines storage backups are kept in and the registry of storage providers. Providers of
+// backends the operator doesn't support natively, e.g. Ceph RGW, Swift or HDFS, are compiled into the operator
+// binary by registering them in an init function of a package imported by the main package:
+//
+//	func init() {
+//		backupstorage.Register("swift", backupstorage.Provider{
+//			Credentials: []string{"username", "password"},
+//			New:         newSwiftStorage,
+//		})
+//	}
+//
+// Clusters keep their backups in storage of the provider with spec.backup.destination.provider.
+package backupstorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+)
+
+// Storage is a place backups are kept in. Objects are streamed, so snapshots are never held in memory.
+type Storage interface {
+	// Upload stores data read from r under the key, tagged with the tags.
+	Upload(ctx context.Context, key string, r io.Reader, tags map[string]string) error
+	// Download returns content of the object stored under the key. Caller is responsible for closing it.
+	Download(ctx context.Context, key string) (io.ReadCloser, error)
+	// List returns keys of all objects with the prefix in ascending order.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes the object stored under the key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Options are passed to providers creating storage of a destination.
+type Options struct {
+	// Config is the provider configuration of the destination.
+	Config map[string]string
+	// Credentials are read from the credentials secret of the destination, keyed by their names.
+	// Missing optional credentials are not set.
+	Credentials map[string][]byte
+	// Proxy selects the proxy of HTTP requests to the storage as configured in the destination.
+	Proxy func(*http.Request) (*url.URL, error)
+}
+
+// Provider creates storage of destinations referring to it by name.
+type Provider struct {
+	// Credentials are keys of the destination credentials secret passed to the provider.
+	Credentials []string
+	// OptionalCredentials are keys of the destination credentials secret which may be missing.
+	OptionalCredentials []string
+	// New creates storage of the destination.
+	New func(options Options) (Storage, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{}
+)
+
+// Register makes the provider available under the name. It panics if a provider is registered twice
+// under the same name or has no New function.
+func Register(name string, provider Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	if provider.New == nil {
+		panic(fmt.Sprintf("backup storage provider %s has no New function", name))
+	}
+	if _, ok := providers[name]; ok {
+		panic(fmt.Sprintf("backup storage provider %s is registered twice", name))
+	}
+	providers[name] = provider
+}
+
+// Lookup returns the provider registered under the name.
+func Lookup(name string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	provider, ok := providers[name]
+	return provider, ok
+}
+
+// Names returns names of registered providers in ascending order.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package etcdclient creates etcd clients for clusters managed by etcd-operator, so controllers building
+// on the operator do not have to discover endpoints, TLS and credentials of the cluster themselves.
+//
+//	cli, err := etcdclient.New(ctx, mgr.GetAPIReader(), client.ObjectKey{Namespace: "db", Name: "etcd"},
+//		etcdclient.WithUser("app"))
+//	if err != nil {
+//		return err
+//	}
+//	defer cli.Close()
+package etcdclient
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+)
+
+// Client is the etcd client of a cluster. Clients are *clientv3.Client unless another factory is configured,
+// so watches and leases are available after a type assertion.
+type Client = etcd.Client
+
+// Factory creates etcd clients connected to endpoints of the configuration.
+type Factory = etcd.ClientFactory
+
+// ConfigureFactory replaces the factory of etcd clients created by New and by the controllers of the operator,
+// e.g. with the factory of fake clusters of the etcdclienttest package. Nil restores the default factory
+// connecting to members. It has to be called before controllers are started.
+func ConfigureFactory(factory Factory) {
+	etcd.ConfigureClientFactory(factory)
+}
+
+type options struct {
+	user       string
+	secretName string
+}
+
+// Option configures the client created by New.
+type Option func(*options)
+
+// WithUser makes the client authenticate as the user managed by the operator, see AuthSpec.Users.
+// The password is read from the credentials Secret of the user.
+func WithUser(name string) Option {
+	return func(o *options) {
+		o.user = name
+	}
+}
+
+// WithCredentialsSecret makes the client authenticate with the username and password stored in the given
+// basic-auth Secret of the cluster namespace.
+func WithCredentialsSecret(name string) Option {
+	return func(o *options) {
+		o.secretName = name
+	}
+}
+
+// New returns etcd client connected to all members of the EtcdCluster with the given key.
+// The trusted CA and client certificate are read from Secrets referenced in the cluster security spec.
+// Without options the client authenticates as the root user if auth is managed by the operator, which requires
+// access to the root credentials Secret; prefer WithUser for clients of applications.
+// While a password is being rotated, both the new and the previous password are tried.
+// Caller is responsible for closing the returned client.
+func New(ctx context.Context, reader client.Reader, key client.ObjectKey, opts ...Option) (Client, error) {
+	cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+	if err := reader.Get(ctx, key, cluster); err != nil {
+		return nil, fmt.Errorf("cannot get etcd cluster %s: %w", key, err)
+	}
+	return NewForCluster(ctx, reader, cluster, opts...)
+}
+
+// NewForCluster is like New for the already fetched cluster.
+func NewForCluster(
+	ctx context.Context,
+	reader client.Reader,
+	cluster *etcdaenixiov1alpha1.EtcdCluster,
+	opts ...Option,
+) (Client, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.user != "" {
+		secretName, err := userSecretName(cluster, o.user)
+		if err != nil {
+			return nil, err
+		}
+		o.secretName = secretName
+	}
+	if o.secretName != "" {
+		return etcd.NewClusterClientFromSecret(ctx, reader, cluster, o.secretName)
+	}
+	return etcd.NewClusterClient(ctx, reader, cluster)
+}
+
+// Endpoints returns client URLs of all members of the cluster.
+func Endpoints(cluster *etcdaenixiov1alpha1.EtcdCluster) []string {
+	return etcd.ClientEndpoints(cluster)
+}
+
+// userSecretName returns the credentials Secret of the managed user.
+func userSecretName(cluster *etcdaenixiov1alpha1.EtcdCluster, name string) (string, error) {
+	if cluster.Spec.Security != nil && cluster.Spec.Security.Auth != nil {
+		for _, user := range cluster.Spec.Security.Auth.Users {
+			if user.Name != name {
+				continue
+			}
+			if user.SecretName != "" {
+				return user.SecretName, nil
+			}
+			return cluster.UserCredentialsSecret(user.Name), nil
+		}
+	}
+	return "", fmt.Errorf("user %s is not managed by the operator for etcd cluster %s/%s", name, cluster.Namespace, cluster.Name)
+}
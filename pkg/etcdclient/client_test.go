@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcdclient
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+var _ = Describe("Etcd client", func() {
+	var (
+		ctx     context.Context
+		reader  client.Reader
+		cluster *etcdaenixiov1alpha1.EtcdCluster
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(3)),
+				Security: &etcdaenixiov1alpha1.SecuritySpec{
+					Auth: &etcdaenixiov1alpha1.AuthSpec{
+						Users: []etcdaenixiov1alpha1.ManagedUser{{Name: "app"}},
+					},
+				},
+			},
+		}
+		reader = fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).Build()
+	})
+
+	It("fails for a missing cluster", func() {
+		_, err := New(ctx, reader, client.ObjectKey{Namespace: "default", Name: "missing"})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("fails for a user not managed by the operator", func() {
+		_, err := New(ctx, reader, client.ObjectKeyFromObject(cluster), WithUser("other"))
+		Expect(err).To(MatchError(ContainSubstring("user other is not managed")))
+	})
+
+	It("reads credentials of a managed user from the default secret", func() {
+		_, err := New(ctx, reader, client.ObjectKeyFromObject(cluster), WithUser("app"))
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("test-app-credentials")))
+	})
+
+	It("returns client URLs of all members", func() {
+		Expect(Endpoints(cluster)).To(Equal([]string{
+			"http://test-0.test.default.svc:2379",
+			"http://test-1.test.default.svc:2379",
+			"http://test-2.test.default.svc:2379",
+		}))
+	})
+})
@@ -0,0 +1,458 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcdclienttest
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	"go.etcd.io/etcd/api/v3/authpb"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// rootRole is the built-in etcd role granting all permissions.
+const rootRole = "root"
+
+type user struct {
+	password   string
+	noPassword bool
+	roles      []string
+}
+
+// authStore keeps users and roles of the cluster. Roles other than root are granted permissions to key ranges.
+type authStore struct {
+	enabled  bool
+	revision uint64
+	users    map[string]*user
+	roles    map[string][]*authpb.Permission
+}
+
+func (a *authStore) authenticate(name, password string) error {
+	u, ok := a.users[name]
+	if !ok || u.noPassword || u.password != password {
+		return rpctypes.ErrAuthFailed
+	}
+	return nil
+}
+
+// userRoles returns roles of the user of a client. Like clients authenticating again once their token expires,
+// clients fail once the password of the user is changed.
+func (a *authStore) userRoles(name, password string) ([]string, error) {
+	if name == "" {
+		return nil, rpctypes.ErrUserEmpty
+	}
+	if err := a.authenticate(name, password); err != nil {
+		return nil, err
+	}
+	return a.users[name].roles, nil
+}
+
+func (a *authStore) checkAdmin(name, password string) error {
+	roles, err := a.userRoles(name, password)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(roles, rootRole) {
+		return rpctypes.ErrPermissionDenied
+	}
+	return nil
+}
+
+// checkRange checks if a role of the user is permitted to read or write all keys of the range.
+func (a *authStore) checkRange(name, password string, key, end []byte, write bool) error {
+	roles, err := a.userRoles(name, password)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(roles, rootRole) {
+		return nil
+	}
+	for _, role := range roles {
+		for _, perm := range a.roles[role] {
+			permitted := perm.PermType == authpb.READWRITE ||
+				write && perm.PermType == authpb.WRITE || !write && perm.PermType == authpb.READ
+			if permitted && covers(perm, key, end) {
+				return nil
+			}
+		}
+	}
+	return rpctypes.ErrPermissionDenied
+}
+
+// covers checks if the permission covers all keys of the range.
+func covers(perm *authpb.Permission, key, end []byte) bool {
+	fromKey := []byte{0}
+	switch {
+	case len(perm.RangeEnd) == 0:
+		return len(end) == 0 && bytes.Equal(perm.Key, key)
+	case bytes.Compare(key, perm.Key) < 0:
+		return false
+	case bytes.Equal(perm.RangeEnd, fromKey):
+		return true
+	case len(end) == 0:
+		return bytes.Compare(key, perm.RangeEnd) < 0
+	default:
+		return !bytes.Equal(end, fromKey) && bytes.Compare(end, perm.RangeEnd) <= 0
+	}
+}
+
+// serveAuth locks the cluster for the auth management request, which requires the root role once auth is enabled.
+func (cli *etcdClient) serveAuth(ctx context.Context) (*etcdserverpb.ResponseHeader, *authStore, func(), error) {
+	m, unlock, err := cli.serve(ctx, true, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	a := &cli.cluster.auth
+	if a.users == nil {
+		a.users, a.roles = map[string]*user{}, map[string][]*authpb.Permission{}
+	}
+	return cli.cluster.header(m.ID), a, unlock, nil
+}
+
+// changed completes the change of users or roles.
+func (a *authStore) changed() {
+	a.revision++
+}
+
+func (cli *etcdClient) Authenticate(
+	ctx context.Context,
+	name string,
+	password string,
+) (*clientv3.AuthenticateResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	a := &cli.cluster.auth
+	if !a.enabled {
+		return nil, rpctypes.ErrAuthNotEnabled
+	}
+	if err := a.authenticate(name, password); err != nil {
+		return nil, err
+	}
+	return &clientv3.AuthenticateResponse{Header: cli.cluster.header(m.ID), Token: "fake." + name}, nil
+}
+
+func (cli *etcdClient) AuthEnable(ctx context.Context) (*clientv3.AuthEnableResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	root, ok := a.users[rootRole]
+	switch {
+	case !ok:
+		return nil, rpctypes.ErrRootUserNotExist
+	case !slices.Contains(root.roles, rootRole):
+		return nil, rpctypes.ErrRootRoleNotExist
+	}
+	a.enabled = true
+	a.changed()
+	return &clientv3.AuthEnableResponse{Header: header}, nil
+}
+
+func (cli *etcdClient) AuthDisable(ctx context.Context) (*clientv3.AuthDisableResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	a.enabled = false
+	a.changed()
+	return &clientv3.AuthDisableResponse{Header: header}, nil
+}
+
+func (cli *etcdClient) AuthStatus(ctx context.Context) (*clientv3.AuthStatusResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	a := &cli.cluster.auth
+	return &clientv3.AuthStatusResponse{
+		Header:       cli.cluster.header(m.ID),
+		Enabled:      a.enabled,
+		AuthRevision: a.revision,
+	}, nil
+}
+
+func (cli *etcdClient) UserAdd(
+	ctx context.Context,
+	name string,
+	password string,
+) (*clientv3.AuthUserAddResponse, error) {
+	return cli.UserAddWithOptions(ctx, name, password, &clientv3.UserAddOptions{})
+}
+
+func (cli *etcdClient) UserAddWithOptions(
+	ctx context.Context,
+	name string,
+	password string,
+	opt *clientv3.UserAddOptions,
+) (*clientv3.AuthUserAddResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if name == "" {
+		return nil, rpctypes.ErrUserEmpty
+	}
+	if _, ok := a.users[name]; ok {
+		return nil, rpctypes.ErrUserAlreadyExist
+	}
+	a.users[name] = &user{password: password, noPassword: opt != nil && opt.NoPassword}
+	a.changed()
+	return &clientv3.AuthUserAddResponse{Header: header}, nil
+}
+
+func (cli *etcdClient) UserDelete(ctx context.Context, name string) (*clientv3.AuthUserDeleteResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if _, ok := a.users[name]; !ok {
+		return nil, rpctypes.ErrUserNotFound
+	}
+	if a.enabled && name == rootRole {
+		return nil, rpctypes.ErrInvalidAuthMgmt
+	}
+	delete(a.users, name)
+	a.changed()
+	return &clientv3.AuthUserDeleteResponse{Header: header}, nil
+}
+
+func (cli *etcdClient) UserChangePassword(
+	ctx context.Context,
+	name string,
+	password string,
+) (*clientv3.AuthUserChangePasswordResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	u, ok := a.users[name]
+	if !ok {
+		return nil, rpctypes.ErrUserNotFound
+	}
+	u.password = password
+	a.changed()
+	return &clientv3.AuthUserChangePasswordResponse{Header: header}, nil
+}
+
+func (cli *etcdClient) UserGrantRole(
+	ctx context.Context,
+	name string,
+	role string,
+) (*clientv3.AuthUserGrantRoleResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	u, ok := a.users[name]
+	if !ok {
+		return nil, rpctypes.ErrUserNotFound
+	}
+	if _, ok := a.roles[role]; !ok && role != rootRole {
+		return nil, rpctypes.ErrRoleNotFound
+	}
+	if !slices.Contains(u.roles, role) {
+		u.roles = append(u.roles, role)
+		slices.Sort(u.roles)
+	}
+	a.changed()
+	return &clientv3.AuthUserGrantRoleResponse{Header: header}, nil
+}
+
+func (cli *etcdClient) UserGet(ctx context.Context, name string) (*clientv3.AuthUserGetResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	u, ok := a.users[name]
+	if !ok {
+		return nil, rpctypes.ErrUserNotFound
+	}
+	return &clientv3.AuthUserGetResponse{Header: header, Roles: slices.Clone(u.roles)}, nil
+}
+
+func (cli *etcdClient) UserList(ctx context.Context) (*clientv3.AuthUserListResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	resp := &clientv3.AuthUserListResponse{Header: header}
+	for name := range a.users {
+		resp.Users = append(resp.Users, name)
+	}
+	slices.Sort(resp.Users)
+	return resp, nil
+}
+
+func (cli *etcdClient) UserRevokeRole(
+	ctx context.Context,
+	name string,
+	role string,
+) (*clientv3.AuthUserRevokeRoleResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	u, ok := a.users[name]
+	if !ok {
+		return nil, rpctypes.ErrUserNotFound
+	}
+	if a.enabled && name == rootRole && role == rootRole {
+		return nil, rpctypes.ErrInvalidAuthMgmt
+	}
+	idx := slices.Index(u.roles, role)
+	if idx == -1 {
+		return nil, rpctypes.ErrRoleNotGranted
+	}
+	u.roles = slices.Delete(u.roles, idx, idx+1)
+	a.changed()
+	return &clientv3.AuthUserRevokeRoleResponse{Header: header}, nil
+}
+
+func (cli *etcdClient) RoleAdd(ctx context.Context, name string) (*clientv3.AuthRoleAddResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if name == "" {
+		return nil, rpctypes.ErrRoleEmpty
+	}
+	if _, ok := a.roles[name]; ok {
+		return nil, rpctypes.ErrRoleAlreadyExist
+	}
+	a.roles[name] = nil
+	a.changed()
+	return &clientv3.AuthRoleAddResponse{Header: header}, nil
+}
+
+func (cli *etcdClient) RoleGrantPermission(
+	ctx context.Context,
+	name string,
+	key, rangeEnd string,
+	permType clientv3.PermissionType,
+) (*clientv3.AuthRoleGrantPermissionResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	perms, ok := a.roles[name]
+	if !ok {
+		return nil, rpctypes.ErrRoleNotFound
+	}
+	perm := &authpb.Permission{PermType: authpb.Permission_Type(permType), Key: []byte(key), RangeEnd: []byte(rangeEnd)}
+	// granting the permission of the same range again replaces its type
+	perms = slices.DeleteFunc(perms, func(p *authpb.Permission) bool {
+		return bytes.Equal(p.Key, perm.Key) && bytes.Equal(p.RangeEnd, perm.RangeEnd)
+	})
+	a.roles[name] = append(perms, perm)
+	a.changed()
+	return &clientv3.AuthRoleGrantPermissionResponse{Header: header}, nil
+}
+
+func (cli *etcdClient) RoleGet(ctx context.Context, role string) (*clientv3.AuthRoleGetResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	perms, ok := a.roles[role]
+	if !ok {
+		return nil, rpctypes.ErrRoleNotFound
+	}
+	resp := &clientv3.AuthRoleGetResponse{Header: header}
+	for _, p := range perms {
+		cloned := *p
+		resp.Perm = append(resp.Perm, &cloned)
+	}
+	return resp, nil
+}
+
+func (cli *etcdClient) RoleList(ctx context.Context) (*clientv3.AuthRoleListResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	resp := &clientv3.AuthRoleListResponse{Header: header}
+	for name := range a.roles {
+		resp.Roles = append(resp.Roles, name)
+	}
+	slices.Sort(resp.Roles)
+	return resp, nil
+}
+
+func (cli *etcdClient) RoleRevokePermission(
+	ctx context.Context,
+	role string,
+	key, rangeEnd string,
+) (*clientv3.AuthRoleRevokePermissionResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	perms, ok := a.roles[role]
+	if !ok {
+		return nil, rpctypes.ErrRoleNotFound
+	}
+	idx := slices.IndexFunc(perms, func(p *authpb.Permission) bool {
+		return string(p.Key) == key && string(p.RangeEnd) == rangeEnd
+	})
+	if idx == -1 {
+		return nil, rpctypes.ErrPermissionNotGranted
+	}
+	a.roles[role] = slices.Delete(perms, idx, idx+1)
+	a.changed()
+	return &clientv3.AuthRoleRevokePermissionResponse{Header: header}, nil
+}
+
+func (cli *etcdClient) RoleDelete(ctx context.Context, role string) (*clientv3.AuthRoleDeleteResponse, error) {
+	header, a, unlock, err := cli.serveAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if _, ok := a.roles[role]; !ok {
+		return nil, rpctypes.ErrRoleNotFound
+	}
+	if a.enabled && role == rootRole {
+		return nil, rpctypes.ErrInvalidAuthMgmt
+	}
+	delete(a.roles, role)
+	for _, u := range a.users {
+		u.roles = slices.DeleteFunc(u.roles, func(r string) bool { return r == role })
+	}
+	a.changed()
+	return &clientv3.AuthRoleDeleteResponse{Header: header}, nil
+}
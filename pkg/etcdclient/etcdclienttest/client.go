@@ -0,0 +1,397 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcdclienttest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+	"sync"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aenix-io/etcd-operator/pkg/etcdclient"
+)
+
+// etcdClient is a client of the fake cluster. Requests are served by the first started member of its endpoints.
+type etcdClient struct {
+	cluster *Cluster
+	ctx     context.Context
+	cancel  context.CancelFunc
+	// user and password are credentials of the client, user is empty if the client is not authenticated.
+	user     string
+	password string
+
+	mu        sync.Mutex
+	endpoints []string
+}
+
+var _ etcdclient.Client = &etcdClient{}
+
+func (c *Cluster) newClient(cfg clientv3.Config) (*etcdClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cfg.Username != "" && c.auth.enabled {
+		if err := c.auth.authenticate(cfg.Username, cfg.Password); err != nil {
+			return nil, err
+		}
+	}
+	ctx := cfg.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &etcdClient{
+		cluster:   c,
+		ctx:       ctx,
+		cancel:    cancel,
+		user:      cfg.Username,
+		password:  cfg.Password,
+		endpoints: slices.Clone(cfg.Endpoints),
+	}, nil
+}
+
+func (cli *etcdClient) Endpoints() []string {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	return slices.Clone(cli.endpoints)
+}
+
+func (cli *etcdClient) SetEndpoints(endpoints ...string) {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	cli.endpoints = slices.Clone(endpoints)
+}
+
+func (cli *etcdClient) Ctx() context.Context {
+	return cli.ctx
+}
+
+func (cli *etcdClient) Close() error {
+	cli.cancel()
+	return nil
+}
+
+// serve locks the cluster and returns the member serving the request. The leader is required by linearizable
+// requests. Requests fail if the user isn't permitted to send them once auth is enabled, admin requests are
+// permitted to users with the root role.
+func (cli *etcdClient) serve(ctx context.Context, linearizable, admin bool) (*member, func(), error) {
+	if err := cli.alive(ctx); err != nil {
+		return nil, nil, err
+	}
+	c := cli.cluster
+	c.mu.Lock()
+	m, err := cli.member(cli.Endpoints())
+	if err == nil && linearizable && c.leader == 0 {
+		err = rpctypes.ErrNoLeader
+	}
+	if err == nil && admin && c.auth.enabled {
+		err = c.auth.checkAdmin(cli.user, cli.password)
+	}
+	if err != nil {
+		c.mu.Unlock()
+		return nil, nil, err
+	}
+	return m, c.mu.Unlock, nil
+}
+
+// serveEndpoint locks the cluster and returns the started member serving the endpoint.
+func (cli *etcdClient) serveEndpoint(ctx context.Context, endpoint string) (*member, func(), error) {
+	if err := cli.alive(ctx); err != nil {
+		return nil, nil, err
+	}
+	cli.cluster.mu.Lock()
+	m, err := cli.member([]string{endpoint})
+	if err != nil {
+		cli.cluster.mu.Unlock()
+		return nil, nil, err
+	}
+	return m, cli.cluster.mu.Unlock, nil
+}
+
+func (cli *etcdClient) alive(ctx context.Context) error {
+	if err := cli.ctx.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// member returns the first started voting member serving one of the endpoints.
+func (cli *etcdClient) member(endpoints []string) (*member, error) {
+	for _, endpoint := range endpoints {
+		if m := cli.cluster.memberByClientURL(endpoint); m != nil && m.started {
+			return m, nil
+		}
+	}
+	return nil, status.Errorf(codes.Unavailable, "no started member serves endpoints %v", endpoints)
+}
+
+func (cli *etcdClient) MemberList(ctx context.Context) (*clientv3.MemberListResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	return &clientv3.MemberListResponse{Header: c.header(m.ID), Members: c.memberList()}, nil
+}
+
+func (cli *etcdClient) MemberAdd(ctx context.Context, peerAddrs []string) (*clientv3.MemberAddResponse, error) {
+	return cli.memberAdd(ctx, peerAddrs, false)
+}
+
+func (cli *etcdClient) MemberAddAsLearner(
+	ctx context.Context,
+	peerAddrs []string,
+) (*clientv3.MemberAddResponse, error) {
+	return cli.memberAdd(ctx, peerAddrs, true)
+}
+
+func (cli *etcdClient) memberAdd(
+	ctx context.Context,
+	peerAddrs []string,
+	learner bool,
+) (*clientv3.MemberAddResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	if len(peerAddrs) == 0 {
+		return nil, rpctypes.ErrMemberBadURLs
+	}
+	for _, url := range peerAddrs {
+		if c.memberByPeerURL(url) != nil {
+			return nil, rpctypes.ErrPeerURLExist
+		}
+	}
+	if learner && slices.ContainsFunc(c.members, func(m *member) bool { return m.IsLearner }) {
+		return nil, rpctypes.ErrTooManyLearners
+	}
+	// members which are not started yet must not cost the cluster its quorum
+	if !learner && !c.quorate(1, 0) {
+		return nil, rpctypes.ErrUnhealthy
+	}
+	added := &member{Member: etcdserverpb.Member{ID: c.newID(), PeerURLs: slices.Clone(peerAddrs), IsLearner: learner}}
+	c.members = append(c.members, added)
+	c.index++
+	pb := added.Member
+	return &clientv3.MemberAddResponse{Header: c.header(m.ID), Member: &pb, Members: c.memberList()}, nil
+}
+
+func (cli *etcdClient) MemberRemove(ctx context.Context, id uint64) (*clientv3.MemberRemoveResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	removed := c.memberByID(id)
+	if removed == nil {
+		return nil, rpctypes.ErrMemberNotFound
+	}
+	if !removed.IsLearner && removed.started && !c.quorate(-1, -1) {
+		return nil, rpctypes.ErrUnhealthy
+	}
+	c.members = slices.DeleteFunc(c.members, func(m *member) bool { return m.ID == id })
+	c.index++
+	c.elect()
+	return &clientv3.MemberRemoveResponse{Header: c.header(m.ID), Members: c.memberList()}, nil
+}
+
+func (cli *etcdClient) MemberUpdate(
+	ctx context.Context,
+	id uint64,
+	peerAddrs []string,
+) (*clientv3.MemberUpdateResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	updated := c.memberByID(id)
+	if updated == nil {
+		return nil, rpctypes.ErrMemberNotFound
+	}
+	for _, url := range peerAddrs {
+		if other := c.memberByPeerURL(url); other != nil && other.ID != id {
+			return nil, rpctypes.ErrPeerURLExist
+		}
+	}
+	updated.PeerURLs = slices.Clone(peerAddrs)
+	c.index++
+	return &clientv3.MemberUpdateResponse{Header: c.header(m.ID), Members: c.memberList()}, nil
+}
+
+func (cli *etcdClient) MemberPromote(ctx context.Context, id uint64) (*clientv3.MemberPromoteResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	promoted := c.memberByID(id)
+	switch {
+	case promoted == nil:
+		return nil, rpctypes.ErrMemberNotFound
+	case !promoted.IsLearner:
+		return nil, rpctypes.ErrMemberNotLearner
+	case !promoted.started:
+		// started learners are caught up with the leader at once
+		return nil, rpctypes.ErrMemberLearnerNotReady
+	}
+	promoted.IsLearner = false
+	c.index++
+	return &clientv3.MemberPromoteResponse{Header: c.header(m.ID), Members: c.memberList()}, nil
+}
+
+func (cli *etcdClient) AlarmList(ctx context.Context) (*clientv3.AlarmResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	return &clientv3.AlarmResponse{Header: c.header(m.ID), Alarms: cloneAlarms(c.alarms)}, nil
+}
+
+func (cli *etcdClient) AlarmDisarm(ctx context.Context, am *clientv3.AlarmMember) (*clientv3.AlarmResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	var disarmed []*etcdserverpb.AlarmMember
+	c.alarms = slices.DeleteFunc(c.alarms, func(a *etcdserverpb.AlarmMember) bool {
+		// like etcdctl, the zero alarm member disarms all alarms
+		if am.MemberID == 0 && am.Alarm == etcdserverpb.AlarmType_NONE ||
+			a.MemberID == am.MemberID && a.Alarm == am.Alarm {
+			disarmed = append(disarmed, a)
+			return true
+		}
+		return false
+	})
+	return &clientv3.AlarmResponse{Header: c.header(m.ID), Alarms: cloneAlarms(disarmed)}, nil
+}
+
+func cloneAlarms(alarms []*etcdserverpb.AlarmMember) []*etcdserverpb.AlarmMember {
+	cloned := make([]*etcdserverpb.AlarmMember, 0, len(alarms))
+	for _, a := range alarms {
+		cloned = append(cloned, &etcdserverpb.AlarmMember{MemberID: a.MemberID, Alarm: a.Alarm})
+	}
+	return cloned
+}
+
+func (cli *etcdClient) Defragment(ctx context.Context, endpoint string) (*clientv3.DefragmentResponse, error) {
+	m, unlock, err := cli.serveEndpoint(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return &clientv3.DefragmentResponse{Header: cli.cluster.header(m.ID)}, nil
+}
+
+func (cli *etcdClient) Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	m, unlock, err := cli.serveEndpoint(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	resp := &clientv3.StatusResponse{
+		Header:      c.header(m.ID),
+		Version:     c.version,
+		DbSize:      c.kv.size(),
+		DbSizeInUse: c.kv.size(),
+		Leader:      c.leader,
+		RaftIndex:   c.index,
+		RaftTerm:    c.term,
+		IsLearner:   m.IsLearner,
+	}
+	for _, a := range c.alarms {
+		if a.MemberID == m.ID {
+			resp.Errors = append(resp.Errors, fmt.Sprintf("alarm:%s", a.Alarm))
+		}
+	}
+	return resp, nil
+}
+
+func (cli *etcdClient) HashKV(ctx context.Context, endpoint string, rev int64) (*clientv3.HashKVResponse, error) {
+	m, unlock, err := cli.serveEndpoint(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	kvs, err := c.kv.rangeAt(nil, []byte{0}, rev)
+	if err != nil {
+		return nil, err
+	}
+	hash := crc32.NewIEEE()
+	for _, kv := range kvs {
+		_, _ = hash.Write(kv.Key)
+		_, _ = hash.Write(kv.Value)
+	}
+	return &clientv3.HashKVResponse{
+		Header:          c.header(m.ID),
+		Hash:            hash.Sum32(),
+		CompactRevision: c.kv.compacted,
+	}, nil
+}
+
+// Snapshot returns keys and values of the cluster encoded as JSON, it is not an etcd database file.
+func (cli *etcdClient) Snapshot(ctx context.Context) (io.ReadCloser, error) {
+	_, unlock, err := cli.serve(ctx, false, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	data, err := json.Marshal(cli.cluster.kv.scan(nil, []byte{0}, 0))
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (cli *etcdClient) MoveLeader(ctx context.Context, transfereeID uint64) (*clientv3.MoveLeaderResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	if m.ID != c.leader {
+		return nil, rpctypes.ErrNotLeader
+	}
+	transferee := c.memberByID(transfereeID)
+	if transferee == nil || !transferee.started || transferee.IsLearner {
+		return nil, rpctypes.ErrBadLeaderTransferee
+	}
+	c.setLeader(transfereeID)
+	return &clientv3.MoveLeaderResponse{Header: c.header(m.ID)}, nil
+}
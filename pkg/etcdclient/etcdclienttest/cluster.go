@@ -0,0 +1,298 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package etcdclienttest provides in-memory etcd clusters for tests of controllers built on etcd-operator, so
+// workflows can be tested without running etcd. Clients of fake clusters serve membership, status, maintenance,
+// auth and key-value requests, and tests start and stop members to simulate failures:
+//
+//	fake := etcdclienttest.NewClusterFor(cluster)
+//	etcdclient.ConfigureFactory(etcdclienttest.NewFactory(fake))
+//	defer etcdclient.ConfigureFactory(nil)
+//	fake.StopMember("etcd-0")
+//
+// Requests are served at once, members have no data of their own and snapshots are not etcd database files.
+package etcdclienttest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/version"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/pkg/etcdclient"
+)
+
+// Member is a started member of a fake cluster.
+type Member struct {
+	Name      string
+	PeerURL   string
+	ClientURL string
+}
+
+// member is a member registered in the cluster. Members added by requests are not started until StartMember.
+type member struct {
+	etcdserverpb.Member
+	started bool
+}
+
+// Cluster is an in-memory etcd cluster. It is safe for concurrent use.
+type Cluster struct {
+	mu      sync.Mutex
+	id      uint64
+	version string
+	members []*member
+	nextID  uint64
+	leader  uint64
+	term    uint64
+	index   uint64
+	alarms  []*etcdserverpb.AlarmMember
+	kv      store
+	auth    authStore
+}
+
+// NewCluster returns a cluster of started voting members, the first of them is the leader.
+func NewCluster(members ...Member) *Cluster {
+	c := &Cluster{id: 0xcdf818194e3a8c32, version: version.Version, nextID: 0x8e9e05c52164694d}
+	for _, m := range members {
+		c.members = append(c.members, &member{
+			Member: etcdserverpb.Member{
+				ID:         c.newID(),
+				Name:       m.Name,
+				PeerURLs:   []string{m.PeerURL},
+				ClientURLs: []string{m.ClientURL},
+			},
+			started: true,
+		})
+	}
+	c.elect()
+	return c
+}
+
+// NewClusterFor returns a cluster of started members of the EtcdCluster, so clients the operator creates for it
+// are connected to the fake.
+func NewClusterFor(cluster *etcdaenixiov1alpha1.EtcdCluster) *Cluster {
+	var members []Member
+	for _, m := range cluster.Members() {
+		members = append(members, Member{Name: m.Name, PeerURL: m.PeerURL, ClientURL: m.ClientURL})
+	}
+	return NewCluster(members...)
+}
+
+// NewFactory returns the factory of clients of the clusters, see etcdclient.ConfigureFactory. A client is connected
+// to the cluster with a member serving one of its endpoints, clients of other endpoints fail to connect like
+// clients of unreachable members. Credentials of clients are checked once auth is enabled in the cluster.
+func NewFactory(clusters ...*Cluster) etcdclient.Factory {
+	return func(cfg clientv3.Config) (etcdclient.Client, error) {
+		for _, c := range clusters {
+			if c.serves(cfg.Endpoints) {
+				return c.newClient(cfg)
+			}
+		}
+		return nil, context.DeadlineExceeded
+	}
+}
+
+// SetVersion sets the version of etcd members report.
+func (c *Cluster) SetVersion(v string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version = v
+}
+
+// StartMember starts the member registered with its peer URL, e.g. a member added by the operator once its pod is
+// running, or the stopped member with its name. An error is returned if there is no such member.
+func (c *Cluster) StartMember(m Member) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	idx := slices.IndexFunc(c.members, func(mm *member) bool {
+		return mm.Name == "" && slices.Contains(mm.PeerURLs, m.PeerURL) || mm.Name != "" && mm.Name == m.Name
+	})
+	if idx == -1 {
+		return fmt.Errorf("member %s with peer URL %s is not registered", m.Name, m.PeerURL)
+	}
+	mm := c.members[idx]
+	mm.Name = m.Name
+	if m.ClientURL != "" {
+		mm.ClientURLs = []string{m.ClientURL}
+	}
+	mm.started = true
+	c.elect()
+	return nil
+}
+
+// StopMember stops the member with the name, so requests to it fail as unavailable. The cluster elects another
+// leader if the member was the leader and the rest of the members have quorum.
+func (c *Cluster) StopMember(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.memberByName(name)
+	if m == nil {
+		return fmt.Errorf("member %s is not registered", name)
+	}
+	m.started = false
+	c.elect()
+	return nil
+}
+
+// SetLeader makes the started voting member with the name the leader.
+func (c *Cluster) SetLeader(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.memberByName(name)
+	if m == nil || !m.started || m.IsLearner {
+		return fmt.Errorf("member %s is not a started voting member", name)
+	}
+	c.setLeader(m.ID)
+	return nil
+}
+
+// Leader returns the name of the leader, empty if the cluster has no leader.
+func (c *Cluster) Leader() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m := c.memberByID(c.leader); m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+// Members returns the cluster membership.
+func (c *Cluster) Members() []*etcdserverpb.Member {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.memberList()
+}
+
+// RaiseAlarm raises the alarm on the member with the name.
+func (c *Cluster) RaiseAlarm(name string, alarm etcdserverpb.AlarmType) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.memberByName(name)
+	if m == nil {
+		return fmt.Errorf("member %s is not registered", name)
+	}
+	c.alarms = append(c.alarms, &etcdserverpb.AlarmMember{MemberID: m.ID, Alarm: alarm})
+	return nil
+}
+
+// serves checks if a member of the cluster serves one of the endpoints.
+func (c *Cluster) serves(endpoints []string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.ContainsFunc(endpoints, func(endpoint string) bool { return c.memberByClientURL(endpoint) != nil })
+}
+
+func (c *Cluster) newID() uint64 {
+	c.nextID++
+	return c.nextID
+}
+
+func (c *Cluster) memberByName(name string) *member {
+	idx := slices.IndexFunc(c.members, func(m *member) bool { return m.Name != "" && m.Name == name })
+	if idx == -1 {
+		return nil
+	}
+	return c.members[idx]
+}
+
+func (c *Cluster) memberByID(id uint64) *member {
+	idx := slices.IndexFunc(c.members, func(m *member) bool { return m.ID == id })
+	if idx == -1 {
+		return nil
+	}
+	return c.members[idx]
+}
+
+func (c *Cluster) memberByClientURL(url string) *member {
+	idx := slices.IndexFunc(c.members, func(m *member) bool { return slices.Contains(m.ClientURLs, url) })
+	if idx == -1 {
+		return nil
+	}
+	return c.members[idx]
+}
+
+func (c *Cluster) memberByPeerURL(url string) *member {
+	idx := slices.IndexFunc(c.members, func(m *member) bool { return slices.Contains(m.PeerURLs, url) })
+	if idx == -1 {
+		return nil
+	}
+	return c.members[idx]
+}
+
+func (c *Cluster) memberList() []*etcdserverpb.Member {
+	members := make([]*etcdserverpb.Member, 0, len(c.members))
+	for _, m := range c.members {
+		pb := m.Member
+		pb.PeerURLs = slices.Clone(m.PeerURLs)
+		pb.ClientURLs = slices.Clone(m.ClientURLs)
+		members = append(members, &pb)
+	}
+	return members
+}
+
+// quorate checks if started voting members would be a quorum of voting members with the change of their numbers.
+func (c *Cluster) quorate(votersChange, startedChange int) bool {
+	voters, started := votersChange, startedChange
+	for _, m := range c.members {
+		if m.IsLearner {
+			continue
+		}
+		voters++
+		if m.started {
+			started++
+		}
+	}
+	return voters > 0 && started > voters/2
+}
+
+// elect keeps the leader while it is a started voting member of the quorate cluster, or elects the first started
+// voting member otherwise. The cluster has no leader without quorum.
+func (c *Cluster) elect() {
+	if !c.quorate(0, 0) {
+		c.leader = 0
+		return
+	}
+	if m := c.memberByID(c.leader); m != nil && m.started && !m.IsLearner {
+		return
+	}
+	for _, m := range c.members {
+		if m.started && !m.IsLearner {
+			c.setLeader(m.ID)
+			return
+		}
+	}
+}
+
+func (c *Cluster) setLeader(id uint64) {
+	if c.leader != id {
+		c.leader = id
+		c.term++
+	}
+}
+
+func (c *Cluster) header(memberID uint64) *etcdserverpb.ResponseHeader {
+	return &etcdserverpb.ResponseHeader{
+		ClusterId: c.id,
+		MemberId:  memberID,
+		Revision:  c.kv.revision,
+		RaftTerm:  c.term,
+	}
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcdclienttest
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+	"github.com/aenix-io/etcd-operator/internal/etcd"
+	"github.com/aenix-io/etcd-operator/pkg/etcdclient"
+)
+
+var _ = Describe("Fake etcd cluster", func() {
+	var (
+		ctx      context.Context
+		reader   client.Reader
+		cluster  *etcdaenixiov1alpha1.EtcdCluster
+		fakeEtcd *Cluster
+		cli      etcdclient.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := runtime.NewScheme()
+		Expect(etcdaenixiov1alpha1.AddToScheme(scheme)).To(Succeed())
+		cluster = &etcdaenixiov1alpha1.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+			Spec: etcdaenixiov1alpha1.EtcdClusterSpec{
+				Replicas: ptr.To(int32(3)),
+				// failed requests to the leader are not retried, so the learner which is not ready fails at once
+				EtcdAPI: &etcdaenixiov1alpha1.EtcdAPISpec{MaxRetries: ptr.To(int32(0))},
+			},
+		}
+		reader = fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).Build()
+		fakeEtcd = NewClusterFor(cluster)
+		etcdclient.ConfigureFactory(NewFactory(fakeEtcd))
+		DeferCleanup(func() {
+			etcdclient.ConfigureFactory(nil)
+		})
+
+		var err error
+		cli, err = etcdclient.NewForCluster(ctx, reader, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(cli.Close)
+	})
+
+	It("serves members and status of the cluster", func() {
+		members, err := etcd.ListMembers(ctx, cli)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(HaveLen(3))
+		Expect(members[0].Name).To(Equal("test-0"))
+
+		leader, err := etcd.LeaderName(ctx, cli)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(leader).To(Equal("test-0"))
+	})
+
+	It("fails to connect to endpoints of no member", func() {
+		other := cluster.DeepCopy()
+		other.Name = "other"
+		_, err := etcdclient.NewForCluster(ctx, reader, other)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("elects another leader while stopped members leave quorum", func() {
+		Expect(fakeEtcd.StopMember("test-0")).To(Succeed())
+		Expect(fakeEtcd.Leader()).To(Equal("test-1"))
+		_, err := cli.Status(ctx, etcdclient.Endpoints(cluster)[0])
+		Expect(err).To(HaveOccurred())
+
+		Expect(fakeEtcd.StopMember("test-1")).To(Succeed())
+		Expect(fakeEtcd.Leader()).To(BeEmpty())
+		_, err = cli.MemberList(ctx)
+		Expect(err).To(MatchError(rpctypes.ErrNoLeader))
+
+		Expect(fakeEtcd.StartMember(Member{Name: "test-0"})).To(Succeed())
+		Expect(fakeEtcd.Leader()).To(Equal("test-0"))
+	})
+
+	It("adds members as learners and promotes them once started", func() {
+		scaled := cluster.DeepCopy()
+		scaled.Spec.Replicas = ptr.To(int32(4))
+		var peerURLs []string
+		for _, m := range scaled.Members() {
+			peerURLs = append(peerURLs, m.PeerURL)
+		}
+		Expect(etcd.ScaleMembership(ctx, cli, peerURLs)).To(BeTrue())
+		promoted, err := etcd.PromoteLearners(ctx, cli, peerURLs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(promoted).To(BeFalse())
+
+		added := scaled.Member("test-3")
+		started := Member{Name: added.Name, PeerURL: added.PeerURL, ClientURL: added.ClientURL}
+		Expect(fakeEtcd.StartMember(started)).To(Succeed())
+		promoted, err = etcd.PromoteLearners(ctx, cli, peerURLs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(promoted).To(BeTrue())
+		Expect(fakeEtcd.Members()).To(HaveEach(HaveField("IsLearner", BeFalse())))
+	})
+
+	It("adds one learner at a time", func() {
+		scaled := cluster.DeepCopy()
+		scaled.Spec.Replicas = ptr.To(int32(5))
+		urls := peerURLs(scaled)
+		done, err := etcd.ScaleMembership(ctx, cli, urls)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeFalse())
+		Expect(fakeEtcd.Members()).To(HaveLen(4))
+
+		// the next learner waits for the one added to be promoted
+		done, err = etcd.ScaleMembership(ctx, cli, urls)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeFalse())
+		Expect(fakeEtcd.Members()).To(HaveLen(4))
+
+		for _, name := range []string{"test-3", "test-4"} {
+			added := scaled.Member(name)
+			Expect(fakeEtcd.StartMember(Member{Name: added.Name, PeerURL: added.PeerURL, ClientURL: added.ClientURL})).
+				To(Succeed())
+			Expect(etcd.PromoteLearners(ctx, cli, urls)).To(BeTrue())
+			Expect(etcd.ScaleMembership(ctx, cli, urls)).To(BeTrue())
+		}
+		Expect(fakeEtcd.Members()).To(HaveLen(5))
+		Expect(fakeEtcd.Members()).To(HaveEach(HaveField("IsLearner", BeFalse())))
+	})
+
+	It("moves leadership away from removed members", func() {
+		Expect(etcd.ScaleMembership(ctx, cli, peerURLs(cluster)[1:])).To(BeTrue())
+		Expect(fakeEtcd.Members()).To(HaveLen(2))
+		Expect(fakeEtcd.Leader()).To(Equal("test-1"))
+	})
+
+	It("keeps revisions of keys", func() {
+		put, err := cli.Put(ctx, "/app/a", "1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cli.Put(ctx, "/app/a", "2")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cli.Put(ctx, "/app/b", "3")
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := cli.Get(ctx, "/app/", clientv3.WithPrefix())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Kvs).To(HaveLen(2))
+		Expect(string(resp.Kvs[0].Value)).To(Equal("2"))
+		Expect(resp.Kvs[0].Version).To(Equal(int64(2)))
+
+		resp, err = cli.Get(ctx, "/app/a", clientv3.WithRev(put.Header.Revision))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(resp.Kvs[0].Value)).To(Equal("1"))
+
+		_, err = etcd.Compact(ctx, cli, resp.Header.Revision)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cli.Get(ctx, "/app/a", clientv3.WithRev(put.Header.Revision))
+		Expect(err).To(MatchError(rpctypes.ErrCompacted))
+	})
+
+	It("commits transactions if comparisons succeed", func() {
+		txn, err := cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.Version("/lock"), "=", 0)).
+			Then(clientv3.OpPut("/lock", "owner"), clientv3.OpGet("/lock")).
+			Commit()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(txn.Succeeded).To(BeTrue())
+		Expect(txn.Responses[1].GetResponseRange().Kvs).To(HaveLen(1))
+
+		txn, err = cli.Txn(ctx).If(clientv3.Compare(clientv3.Version("/lock"), "=", 0)).Commit()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(txn.Succeeded).To(BeFalse())
+	})
+
+	It("checks credentials once auth is enabled", func() {
+		Expect(etcd.SetUserPassword(ctx, cli, "root", "secret", []string{"root"})).To(Succeed())
+		Expect(etcd.EnableAuth(ctx, cli)).To(Succeed())
+
+		_, err := cli.Put(ctx, "/key", "value")
+		Expect(err).To(MatchError(rpctypes.ErrUserEmpty))
+		_, err = etcd.NewClusterClientAs(ctx, reader, cluster, "root", "wrong")
+		Expect(err).To(MatchError(rpctypes.ErrAuthFailed))
+
+		root, err := etcd.NewClusterClientAs(ctx, reader, cluster, "root", "secret")
+		Expect(err).NotTo(HaveOccurred())
+		defer root.Close()
+		Expect(etcd.FreezeUser(ctx, root, "root", nil)).To(Succeed())
+		_, err = root.RoleGet(ctx, etcd.ReadOnlyRole)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("freezes writes under prefixes only", func() {
+		Expect(etcd.SetUserPassword(ctx, cli, "root", "secret", []string{"root"})).To(Succeed())
+		perms := map[string][]string{
+			"tenant-a-rw": {"/tenant-a/", clientv3.GetPrefixRangeEnd("/tenant-a/")},
+			"tenant-b-rw": {"/tenant-b/", clientv3.GetPrefixRangeEnd("/tenant-b/")},
+			"tenants-rw":  {"/tenant-", clientv3.GetPrefixRangeEnd("/tenant-")},
+			"config-rw":   {"/tenant-a/config", ""},
+			"all-r":       {"\x00", "\x00"},
+		}
+		for role, perm := range perms {
+			_, err := cli.RoleAdd(ctx, role)
+			Expect(err).NotTo(HaveOccurred())
+			permType := clientv3.PermissionType(clientv3.PermReadWrite)
+			if role == "all-r" {
+				permType = clientv3.PermissionType(clientv3.PermRead)
+			}
+			_, err = cli.RoleGrantPermission(ctx, role, perm[0], perm[1], permType)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(etcd.SetUserPassword(ctx, cli, "shared", "secret", []string{"tenant-a-rw", "tenant-b-rw"})).To(Succeed())
+		Expect(etcd.EnableAuth(ctx, cli)).To(Succeed())
+		root, err := etcd.NewClusterClientAs(ctx, reader, cluster, "root", "secret")
+		Expect(err).NotTo(HaveOccurred())
+		defer root.Close()
+
+		writing, err := etcd.WritingRoles(ctx, root,
+			[]string{"root", "tenant-a-rw", "tenant-b-rw", "tenants-rw", "config-rw", "all-r", "deleted"}, []string{"/tenant-a/"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writing).To(Equal([]string{"root", "tenant-a-rw", "tenants-rw", "config-rw"}))
+
+		Expect(etcd.FreezeUser(ctx, root, "shared", []string{"tenant-a-rw"})).To(Succeed())
+		shared, err := etcd.NewClusterClientAs(ctx, reader, cluster, "shared", "secret")
+		Expect(err).NotTo(HaveOccurred())
+		defer shared.Close()
+		_, err = shared.Put(ctx, "/tenant-a/key", "value")
+		Expect(err).To(MatchError(rpctypes.ErrPermissionDenied))
+		_, err = shared.Get(ctx, "/tenant-a/key")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = shared.Put(ctx, "/tenant-b/key", "value")
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+func peerURLs(cluster *etcdaenixiov1alpha1.EtcdCluster) []string {
+	var urls []string
+	for _, m := range cluster.Members() {
+		urls = append(urls, m.PeerURL)
+	}
+	return urls
+}
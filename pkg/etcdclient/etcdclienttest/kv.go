@@ -0,0 +1,396 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcdclienttest
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// store keeps every revision of keys, so keys can be read at past revisions until they are compacted.
+type store struct {
+	revision  int64
+	compacted int64
+	// history is the list of changes in the order of revisions, deletions have zero version.
+	history []*mvccpb.KeyValue
+}
+
+// rangeAt returns keys in the range at the revision in ascending order, the latest revision if it is zero.
+// The end of the range is exclusive, it is nil for the single key and a zero byte for all keys from the key.
+func (s *store) rangeAt(key, end []byte, rev int64) ([]*mvccpb.KeyValue, error) {
+	switch {
+	case rev > s.revision:
+		return nil, rpctypes.ErrFutureRev
+	case rev > 0 && rev < s.compacted:
+		return nil, rpctypes.ErrCompacted
+	}
+	return s.scan(key, end, rev), nil
+}
+
+// scan returns keys in the range at the revision, including writes of the transaction being applied
+// if the revision is zero.
+func (s *store) scan(key, end []byte, rev int64) []*mvccpb.KeyValue {
+	latest := map[string]*mvccpb.KeyValue{}
+	for _, kv := range s.history {
+		if rev > 0 && kv.ModRevision > rev {
+			break
+		}
+		if inRange(kv.Key, key, end) {
+			latest[string(kv.Key)] = kv
+		}
+	}
+	kvs := make([]*mvccpb.KeyValue, 0, len(latest))
+	for _, kv := range latest {
+		if kv.Version > 0 {
+			cloned := *kv
+			kvs = append(kvs, &cloned)
+		}
+	}
+	slices.SortFunc(kvs, func(a, b *mvccpb.KeyValue) int { return bytes.Compare(a.Key, b.Key) })
+	return kvs
+}
+
+func inRange(k, key, end []byte) bool {
+	switch {
+	case len(end) == 0:
+		return bytes.Equal(k, key)
+	case bytes.Equal(end, []byte{0}):
+		return bytes.Compare(k, key) >= 0
+	default:
+		return bytes.Compare(k, key) >= 0 && bytes.Compare(k, end) < 0
+	}
+}
+
+// put stores the value of the key at the revision.
+func (s *store) put(key, value []byte, rev int64) {
+	kv := &mvccpb.KeyValue{Key: key, Value: value, CreateRevision: rev, ModRevision: rev, Version: 1}
+	if prev := s.scan(key, nil, 0); len(prev) > 0 {
+		kv.CreateRevision = prev[0].CreateRevision
+		kv.Version = prev[0].Version + 1
+	}
+	s.history = append(s.history, kv)
+}
+
+// deleteRange deletes keys in the range at the revision and returns the number of deleted keys.
+func (s *store) deleteRange(key, end []byte, rev int64) int64 {
+	kvs := s.scan(key, end, 0)
+	for _, kv := range kvs {
+		s.history = append(s.history, &mvccpb.KeyValue{Key: kv.Key, ModRevision: rev})
+	}
+	return int64(len(kvs))
+}
+
+// size returns the size of all revisions of keys as the size of the database.
+func (s *store) size() int64 {
+	var size int64
+	for _, kv := range s.history {
+		size += int64(kv.Size())
+	}
+	return size
+}
+
+// checkRange checks if the user of the client is permitted to read or write keys in the range.
+func (cli *etcdClient) checkRange(key, end []byte, write bool) error {
+	c := cli.cluster
+	if !c.auth.enabled {
+		return nil
+	}
+	return c.auth.checkRange(cli.user, cli.password, key, end, write)
+}
+
+func (cli *etcdClient) Put(
+	ctx context.Context,
+	key, val string,
+	opts ...clientv3.OpOption,
+) (*clientv3.PutResponse, error) {
+	resp, err := cli.Do(ctx, clientv3.OpPut(key, val, opts...))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Put(), nil
+}
+
+func (cli *etcdClient) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	resp, err := cli.Do(ctx, clientv3.OpGet(key, opts...))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Get(), nil
+}
+
+func (cli *etcdClient) Delete(
+	ctx context.Context,
+	key string,
+	opts ...clientv3.OpOption,
+) (*clientv3.DeleteResponse, error) {
+	resp, err := cli.Do(ctx, clientv3.OpDelete(key, opts...))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Del(), nil
+}
+
+func (cli *etcdClient) Compact(
+	ctx context.Context,
+	rev int64,
+	_ ...clientv3.CompactOption,
+) (*clientv3.CompactResponse, error) {
+	m, unlock, err := cli.serve(ctx, true, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	c := cli.cluster
+	switch {
+	case rev > c.kv.revision:
+		return nil, rpctypes.ErrFutureRev
+	case rev <= c.kv.compacted:
+		return nil, rpctypes.ErrCompacted
+	}
+	c.kv.compacted = rev
+	return &clientv3.CompactResponse{Header: c.header(m.ID)}, nil
+}
+
+// Do serves the operation. Limits, sorting and options of the previous key-values and leases are not supported.
+func (cli *etcdClient) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	m, unlock, err := cli.serve(ctx, !op.IsSerializable(), false)
+	if err != nil {
+		return clientv3.OpResponse{}, err
+	}
+	defer unlock()
+	rev := cli.cluster.kv.revision + 1
+	resp, wrote, err := cli.apply(m, op, rev)
+	if err != nil {
+		return clientv3.OpResponse{}, err
+	}
+	if wrote {
+		cli.commit(rev)
+	}
+	switch r := resp.Response.(type) {
+	case *etcdserverpb.ResponseOp_ResponseRange:
+		return (*clientv3.GetResponse)(r.ResponseRange).OpResponse(), nil
+	case *etcdserverpb.ResponseOp_ResponsePut:
+		return (*clientv3.PutResponse)(r.ResponsePut).OpResponse(), nil
+	case *etcdserverpb.ResponseOp_ResponseDeleteRange:
+		return (*clientv3.DeleteResponse)(r.ResponseDeleteRange).OpResponse(), nil
+	default:
+		return (*clientv3.TxnResponse)(resp.GetResponseTxn()).OpResponse(), nil
+	}
+}
+
+// commit completes the write at the revision, headers of responses have the revision already.
+func (cli *etcdClient) commit(rev int64) {
+	cli.cluster.kv.revision = rev
+	cli.cluster.index++
+}
+
+// apply applies the operation at the revision and reports if it wrote keys. Writes of the revision are visible
+// to later operations of the transaction.
+func (cli *etcdClient) apply(m *member, op clientv3.Op, rev int64) (*etcdserverpb.ResponseOp, bool, error) {
+	c := cli.cluster
+	header := c.header(m.ID)
+	switch {
+	case op.IsGet():
+		if err := cli.checkRange(op.KeyBytes(), op.RangeBytes(), false); err != nil {
+			return nil, false, err
+		}
+		// reads at the latest revision see writes of the transaction
+		kvs, err := c.kv.rangeAt(op.KeyBytes(), op.RangeBytes(), op.Rev())
+		if err != nil {
+			return nil, false, err
+		}
+		kvs = slices.DeleteFunc(kvs, func(kv *mvccpb.KeyValue) bool { return !matchRevisions(op, kv) })
+		resp := &etcdserverpb.RangeResponse{Header: header, Count: int64(len(kvs))}
+		if !op.IsCountOnly() {
+			resp.Kvs = kvs
+			if op.IsKeysOnly() {
+				for _, kv := range resp.Kvs {
+					kv.Value = nil
+				}
+			}
+		}
+		return &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponseRange{ResponseRange: resp}}, false, nil
+	case op.IsPut():
+		if len(op.KeyBytes()) == 0 {
+			return nil, false, rpctypes.ErrEmptyKey
+		}
+		if err := cli.checkRange(op.KeyBytes(), nil, true); err != nil {
+			return nil, false, err
+		}
+		c.kv.put(op.KeyBytes(), op.ValueBytes(), rev)
+		header.Revision = rev
+		return &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponsePut{
+			ResponsePut: &etcdserverpb.PutResponse{Header: header},
+		}}, true, nil
+	case op.IsDelete():
+		if err := cli.checkRange(op.KeyBytes(), op.RangeBytes(), true); err != nil {
+			return nil, false, err
+		}
+		deleted := c.kv.deleteRange(op.KeyBytes(), op.RangeBytes(), rev)
+		if deleted > 0 {
+			header.Revision = rev
+		}
+		return &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponseDeleteRange{
+			ResponseDeleteRange: &etcdserverpb.DeleteRangeResponse{Header: header, Deleted: deleted},
+		}}, deleted > 0, nil
+	default:
+		cmps, thenOps, elseOps := op.Txn()
+		resp, wrote, err := cli.applyTxn(m, cmps, thenOps, elseOps, rev)
+		if err != nil {
+			return nil, false, err
+		}
+		return &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponseTxn{ResponseTxn: resp}}, wrote, nil
+	}
+}
+
+func matchRevisions(op clientv3.Op, kv *mvccpb.KeyValue) bool {
+	return (op.MinModRev() == 0 || kv.ModRevision >= op.MinModRev()) &&
+		(op.MaxModRev() == 0 || kv.ModRevision <= op.MaxModRev()) &&
+		(op.MinCreateRev() == 0 || kv.CreateRevision >= op.MinCreateRev()) &&
+		(op.MaxCreateRev() == 0 || kv.CreateRevision <= op.MaxCreateRev())
+}
+
+func (cli *etcdClient) applyTxn(
+	m *member,
+	cmps []clientv3.Cmp,
+	thenOps, elseOps []clientv3.Op,
+	rev int64,
+) (*etcdserverpb.TxnResponse, bool, error) {
+	c := cli.cluster
+	succeeded := true
+	for i := range cmps {
+		cmp := (*etcdserverpb.Compare)(&cmps[i])
+		if err := cli.checkRange(cmp.Key, cmp.RangeEnd, false); err != nil {
+			return nil, false, err
+		}
+		succeeded = succeeded && c.kv.compare(cmp)
+	}
+	ops := elseOps
+	if succeeded {
+		ops = thenOps
+	}
+	resp := &etcdserverpb.TxnResponse{Succeeded: succeeded}
+	var wrote bool
+	for _, op := range ops {
+		r, w, err := cli.apply(m, op, rev)
+		if err != nil {
+			return nil, false, err
+		}
+		resp.Responses = append(resp.Responses, r)
+		wrote = wrote || w
+	}
+	resp.Header = c.header(m.ID)
+	if wrote {
+		resp.Header.Revision = rev
+	}
+	return resp, wrote, nil
+}
+
+// compare checks if all keys in the range of the comparison satisfy it. Missing keys compare as zero values,
+// except for comparisons of values which fail.
+func (s *store) compare(cmp *etcdserverpb.Compare) bool {
+	kvs := s.scan(cmp.Key, cmp.RangeEnd, 0)
+	if len(kvs) == 0 {
+		if cmp.Target == etcdserverpb.Compare_VALUE {
+			return false
+		}
+		kvs = []*mvccpb.KeyValue{{}}
+	}
+	for _, kv := range kvs {
+		var result int
+		switch cmp.Target {
+		case etcdserverpb.Compare_VERSION:
+			result = compareInt(kv.Version, cmp.GetVersion())
+		case etcdserverpb.Compare_CREATE:
+			result = compareInt(kv.CreateRevision, cmp.GetCreateRevision())
+		case etcdserverpb.Compare_MOD:
+			result = compareInt(kv.ModRevision, cmp.GetModRevision())
+		case etcdserverpb.Compare_VALUE:
+			result = bytes.Compare(kv.Value, cmp.GetValue())
+		case etcdserverpb.Compare_LEASE:
+			result = compareInt(kv.Lease, cmp.GetLease())
+		}
+		var ok bool
+		switch cmp.Result {
+		case etcdserverpb.Compare_EQUAL:
+			ok = result == 0
+		case etcdserverpb.Compare_NOT_EQUAL:
+			ok = result != 0
+		case etcdserverpb.Compare_GREATER:
+			ok = result > 0
+		case etcdserverpb.Compare_LESS:
+			ok = result < 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (cli *etcdClient) Txn(ctx context.Context) clientv3.Txn {
+	return &txn{cli: cli, ctx: ctx}
+}
+
+// txn is a transaction of the fake client.
+type txn struct {
+	cli     *etcdClient
+	ctx     context.Context
+	cmps    []clientv3.Cmp
+	thenOps []clientv3.Op
+	elseOps []clientv3.Op
+}
+
+func (t *txn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = append(t.cmps, cs...)
+	return t
+}
+
+func (t *txn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.thenOps = append(t.thenOps, ops...)
+	return t
+}
+
+func (t *txn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.elseOps = append(t.elseOps, ops...)
+	return t
+}
+
+func (t *txn) Commit() (*clientv3.TxnResponse, error) {
+	resp, err := t.cli.Do(t.ctx, clientv3.OpTxn(t.cmps, t.thenOps, t.elseOps))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Txn(), nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lint validates EtcdCluster manifests offline with the rules of the operator admission webhook, so CI
+// pipelines can reject invalid specs before they are applied.
+//
+//	results, err := lint.Manifests(file)
+//	if err != nil {
+//		return err
+//	}
+//	for _, result := range results {
+//		if result.Err != nil {
+//			fmt.Println(result.Name, result.Err)
+//		}
+//	}
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	etcdaenixiov1alpha1 "github.com/aenix-io/etcd-operator/api/v1alpha1"
+)
+
+// Result is the outcome of validation of a single cluster.
+type Result struct {
+	// Name is the namespace and name of the cluster.
+	Name string
+	// Warnings are returned by the webhook to clients without rejecting the cluster.
+	Warnings []string
+	// Err is the error the webhook rejects the cluster with, nil for valid clusters.
+	Err error
+}
+
+// Cluster validates the cluster as the webhook validates its creation. The cluster is defaulted first, as the
+// mutating webhook defaults it before validation; the given cluster is not modified.
+func Cluster(cluster *etcdaenixiov1alpha1.EtcdCluster) Result {
+	defaulted := cluster.DeepCopy()
+	defaulted.Default()
+	warnings, allErrors := defaulted.ValidateSpec()
+	result := Result{Name: clusterName(cluster), Warnings: warnings}
+	if len(allErrors) > 0 {
+		result.Err = apierrors.NewInvalid(
+			schema.GroupKind{Group: etcdaenixiov1alpha1.GroupVersion.Group, Kind: "EtcdCluster"},
+			cluster.Name, allErrors)
+	}
+	return result
+}
+
+// Manifests validates EtcdClusters in a stream of YAML or JSON documents. Documents of other kinds are skipped.
+// Clusters with fields unknown to the API are rejected. An error is returned only if the stream can't be read.
+func Manifests(r io.Reader) ([]Result, error) {
+	var results []Result
+	reader := yaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		document, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return results, nil
+		}
+		if err != nil {
+			return results, err
+		}
+		data, err := yaml.ToJSON(document)
+		if err != nil {
+			return results, err
+		}
+		if len(bytes.TrimSpace(data)) == 0 || bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+			continue
+		}
+
+		object := &metav1.PartialObjectMetadata{}
+		if err = json.Unmarshal(data, object); err != nil {
+			return results, err
+		}
+		if object.GroupVersionKind() != etcdaenixiov1alpha1.GroupVersion.WithKind("EtcdCluster") {
+			continue
+		}
+
+		cluster := &etcdaenixiov1alpha1.EtcdCluster{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(cluster); err != nil {
+			cluster.ObjectMeta = object.ObjectMeta
+			results = append(results, Result{Name: clusterName(cluster), Err: fmt.Errorf("cannot decode cluster: %w", err)})
+			continue
+		}
+		results = append(results, Cluster(cluster))
+	}
+}
+
+func clusterName(cluster *etcdaenixiov1alpha1.EtcdCluster) string {
+	if cluster.Namespace == "" {
+		return cluster.Name
+	}
+	return cluster.Namespace + "/" + cluster.Name
+}
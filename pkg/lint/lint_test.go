@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The etcd-operator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Manifests", func() {
+	It("should validate clusters and skip other documents", func() {
+		results, err := Manifests(strings.NewReader(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: etcd.aenix.io/v1alpha1
+kind: EtcdCluster
+metadata:
+  name: valid
+  namespace: db
+spec:
+  replicas: 3
+---
+apiVersion: etcd.aenix.io/v1alpha1
+kind: EtcdCluster
+metadata:
+  name: read-only
+spec:
+  replicas: 3
+  readOnly: true
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].Name).To(Equal("db/valid"))
+		Expect(results[0].Err).NotTo(HaveOccurred())
+		Expect(results[1].Name).To(Equal("read-only"))
+		Expect(results[1].Err).To(MatchError(ContainSubstring("spec.readOnly: Forbidden: requires spec.security.auth")))
+	})
+
+	It("should reject unknown fields", func() {
+		results, err := Manifests(strings.NewReader(`{"apiVersion": "etcd.aenix.io/v1alpha1", "kind": "EtcdCluster",
+"metadata": {"name": "typo"}, "spec": {"replica": 3}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Name).To(Equal("typo"))
+		Expect(results[0].Err).To(MatchError(ContainSubstring(`unknown field "replica"`)))
+	})
+})